@@ -1,6 +1,8 @@
 package api
 
 import (
+	"time"
+
 	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/middleware"
 	"github.com/divyam234/teldrive/pkg/controller"
@@ -8,49 +10,225 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func InitRouter(r *gin.Engine, c *controller.Controller, cnf *config.Config) *gin.Engine {
-	authmiddleware := middleware.Authmiddleware(cnf.JWT.Secret)
+func InitRouter(r *gin.Engine, c *controller.Controller, cnf *config.Config, live *config.Live) (*gin.Engine, error) {
+	authmiddleware := middleware.Authmiddleware(cnf.JWT.Secret, c.AuthService.SessionActive)
+	stepUp := middleware.StepUp(cnf.JWT.Secret, cnf.Login.StepUp)
+	authFilter, err := middleware.IPFilter(cnf.Access.Auth)
+	if err != nil {
+		return nil, err
+	}
+	streamFilter, err := middleware.IPFilter(cnf.Access.Stream)
+	if err != nil {
+		return nil, err
+	}
+	adminFilter, err := middleware.IPFilter(cnf.Access.Admin)
+	if err != nil {
+		return nil, err
+	}
+	authLimit := middleware.LiveRateLimit(func() config.LimitBudget { return live.Load().Limits.Auth }, middleware.ByIP)
+	listLimit := middleware.LiveRateLimit(func() config.LimitBudget { return live.Load().Limits.List }, middleware.ByUser)
+	streamLimit := middleware.LiveRateLimit(func() config.LimitBudget { return live.Load().Limits.Stream }, middleware.ByIP)
+	statusLimit := middleware.RateLimit(config.LimitBudget{Requests: 30, Window: time.Minute}, middleware.ByIP)
+	r.GET("/healthz", c.Healthz)
+	r.GET("/readyz", c.Readyz)
 	api := r.Group("/api")
+	if cnf.Replication.PrimaryUrl != "" {
+		api.Use(middleware.ReadOnly("/api/auth"))
+	}
+	api.Use(middleware.Maintenance(c.AdminService.MaintenanceActive, "/api/admin", "/api/auth"))
 	{
+		api.GET("/status", statusLimit, c.GetStatus)
 		auth := api.Group("/auth")
 		{
+			// only the routes taking credentials are limited, the UI polls the session
+			auth.Use(authFilter)
 			auth.GET("/session", c.GetSession)
-			auth.POST("/login", c.LogIn)
+			auth.POST("/login", authLimit, c.LogIn)
 			auth.POST("/logout", authmiddleware, c.Logout)
-			auth.GET("/ws", c.HandleMultipleLogin)
+			auth.GET("/ws", authLimit, c.HandleMultipleLogin)
+			auth.GET("/oidc", c.GetOIDCConfig)
+			auth.GET("/oidc/login", authLimit, c.OIDCLogin)
+			auth.GET("/oidc/callback", authLimit, c.OIDCCallback)
+			auth.POST("/elevate", authmiddleware, authLimit, c.Elevate)
+			auth.POST("/totp", authmiddleware, stepUp, c.SetupTOTP)
+			auth.POST("/totp/enable", authmiddleware, stepUp, authLimit, c.EnableTOTP)
+			auth.DELETE("/totp", authmiddleware, stepUp, c.DisableTOTP)
 
 		}
 		files := api.Group("/files")
 		{
-			files.GET("", authmiddleware, c.ListFiles)
+			files.GET("", authmiddleware, listLimit, c.ListFiles)
 			files.POST("", authmiddleware, c.CreateFile)
 			files.GET(":fileID", authmiddleware, c.GetFileByID)
 			files.PATCH(":fileID", authmiddleware, c.UpdateFile)
-			files.HEAD(":fileID/stream/:fileName", c.GetFileStream)
-			files.GET(":fileID/stream/:fileName", c.GetFileStream)
+			files.HEAD(":fileID/stream/:fileName", streamFilter, streamLimit, c.GetFileStream)
+			files.GET(":fileID/stream/:fileName", streamFilter, streamLimit, c.GetFileStream)
 			files.DELETE(":fileID/parts", authmiddleware, c.DeleteFileParts)
+			files.GET(":fileID/image", authmiddleware, c.GetImage)
+			files.GET(":fileID/playlist", authmiddleware, c.GetPlaylist)
+			files.POST(":fileID/extract", authmiddleware, c.ExtractArchive)
+			files.POST(":fileID/split", authmiddleware, c.SplitFile)
+			files.GET(":fileID/preview", authmiddleware, c.GetPreview)
+			files.GET(":fileID/render", authmiddleware, c.GetRendered)
+			files.GET(":fileID/subtitles", authmiddleware, c.GetSubtitles)
+			files.GET(":fileID/subtitles/:subtitleID", authmiddleware, c.GetSubtitle)
+			files.GET(":fileID/shares", authmiddleware, c.ListShares)
+			files.POST(":fileID/shares", authmiddleware, c.ShareFile)
+			files.DELETE(":fileID/shares/:shareID", authmiddleware, stepUp, c.DeleteShare)
+			files.GET(":fileID/links", authmiddleware, c.ListShareLinks)
+			files.POST(":fileID/links", authmiddleware, c.CreateShareLink)
+			files.DELETE(":fileID/links/:linkID", authmiddleware, stepUp, c.DeleteShareLink)
+			files.POST(":fileID/telegram", authmiddleware, c.SendToTelegram)
 			files.GET("/category/stats", authmiddleware, c.GetCategoryStats)
+			files.GET("/categories/:category", authmiddleware, listLimit, c.ListCategory)
 			files.POST("/move", authmiddleware, c.MoveFiles)
+			files.POST("/appearance", authmiddleware, c.SetFolderAppearance)
 			files.POST("/directories", authmiddleware, c.MakeDirectory)
+			files.POST("/directories/template", authmiddleware, c.CreateFromTemplate)
 			files.POST("/delete", authmiddleware, c.DeleteFiles)
+			files.GET("/trash", authmiddleware, c.ListTrash)
+			files.POST("/trash/restore", authmiddleware, c.RestoreFiles)
+			files.POST("/trash/purge", authmiddleware, stepUp, c.PurgeTrash)
+			files.GET("/cleanup", authmiddleware, c.ListCleanupRules)
+			files.POST("/cleanup", authmiddleware, c.CreateCleanupRule)
+			files.PUT("/cleanup/:ruleID", authmiddleware, c.UpdateCleanupRule)
+			files.DELETE("/cleanup/:ruleID", authmiddleware, c.DeleteCleanupRule)
+			files.GET("/cleanup/:ruleID/preview", authmiddleware, c.PreviewCleanupRule)
 			files.POST("/copy", authmiddleware, c.CopyFile)
+			files.POST("/join", authmiddleware, c.JoinFiles)
+			files.POST("/archive", authmiddleware, c.CreateArchive)
+			files.POST("/checksums", authmiddleware, c.BackfillChecksums)
+			files.POST("/quickhashes", authmiddleware, c.BackfillQuickHashes)
+			files.POST("/mime", authmiddleware, c.RepairMimeTypes)
+			files.POST("/duplicates", authmiddleware, c.FindDuplicates)
+			files.POST("/duplicates/resolve", authmiddleware, c.ResolveDuplicates)
+			files.POST("/import", authmiddleware, c.ImportChannel)
+			files.GET("/export", authmiddleware, c.ExportMetadata)
+			files.GET(":fileID/index", authmiddleware, c.ExportIndex)
+			files.POST(":fileID/index", authmiddleware, c.ExportIndex)
+			files.POST("/restore", authmiddleware, c.RestoreMetadata)
+			files.POST("/snippets", authmiddleware, c.UploadSnippet)
 			files.POST("/directories/move", authmiddleware, c.MoveDirectory)
 		}
 		uploads := api.Group("/uploads")
 		{
 			uploads.Use(authmiddleware)
+			uploads.GET("", c.ListUploadSessions)
 			uploads.GET("/stats", c.UploadStats)
 			uploads.GET(":id", c.GetUploadFileById)
 			uploads.POST(":id", c.UploadFile)
 			uploads.DELETE(":id", c.DeleteUploadFile)
+			uploads.POST(":id/abort", c.AbortUploadSession)
+		}
+		operations := api.Group("/operations")
+		{
+			operations.Use(authmiddleware)
+			operations.GET("", c.ListOperations)
+			operations.POST(":operationID/undo", c.UndoOperation)
+		}
+		agents := api.Group("/agents")
+		{
+			agents.POST("/session", authFilter, authLimit, c.AgentSession)
+			agents.GET("", authmiddleware, c.ListAgents)
+			agents.POST("", authmiddleware, c.CreateAgent)
+			agents.DELETE(":agentID", authmiddleware, c.DeleteAgent)
+			agents.POST(":agentID/plan", authmiddleware, c.PlanAgentSync)
+			agents.POST(":agentID/commit", authmiddleware, c.CommitAgentFile)
+			agents.GET(":agentID/conflicts", authmiddleware, c.ListAgentConflicts)
+			agents.POST(":agentID/conflicts/:conflictID/resolve", authmiddleware, c.ResolveAgentConflict)
+		}
+		mounts := api.Group("/mounts")
+		{
+			mounts.GET("", authmiddleware, c.ListMounts)
+			mounts.POST("", authmiddleware, c.CreateMount)
+			mounts.DELETE(":mountID", authmiddleware, c.DeleteMount)
+			mounts.GET(":mountID/files", authmiddleware, c.ListMountFiles)
+			mounts.HEAD(":mountID/files/:messageID/stream/:fileName", streamFilter, streamLimit, authmiddleware,
+				c.GetMountFileStream)
+			mounts.GET(":mountID/files/:messageID/stream/:fileName", streamFilter, streamLimit, authmiddleware,
+				c.GetMountFileStream)
+		}
+		snapshots := api.Group("/snapshots")
+		{
+			snapshots.Use(authmiddleware)
+			snapshots.GET("", c.ListSnapshots)
+			snapshots.POST("", c.CreateSnapshot)
+			snapshots.GET(":snapshotID/files", c.ListSnapshotFiles)
+			snapshots.POST(":snapshotID/restore", c.RestoreSnapshot)
+			snapshots.DELETE(":snapshotID", c.DeleteSnapshot)
+		}
+		jobs := api.Group("/jobs")
+		{
+			jobs.Use(authmiddleware)
+			jobs.GET("", listLimit, c.ListJobs)
+			jobs.GET(":id", c.GetJob)
+			jobs.DELETE(":id", c.CancelJob)
+		}
+		admin := api.Group("/admin")
+		{
+			admin.Use(adminFilter, authmiddleware, middleware.Admin(cnf.Access.Admins))
+			admin.GET("/bots", listLimit, c.ListBots)
+			admin.POST("/bots/:botID/disable", c.DisableBot)
+			admin.POST("/bots/:botID/enable", c.EnableBot)
+			admin.POST("/bots/:botID/rotate", c.RotateBot)
+			admin.POST("/verify", c.VerifyFiles)
+			admin.POST("/config/reload", c.ReloadConfig)
+			admin.GET("/cache", c.CacheStats)
+			admin.GET("/invites", c.ListInvites)
+			admin.POST("/invites", c.CreateInvite)
+			admin.DELETE("/invites/:code", c.DeleteInvite)
+			admin.GET("/registrations", c.ListRegistrations)
+			admin.POST("/registrations/:userID/approve", c.ApproveRegistration)
+			admin.POST("/registrations/:userID/reject", c.RejectRegistration)
+			admin.GET("/replication", c.GetReplicationStatus)
+			admin.GET("/maintenance", c.GetMaintenance)
+			admin.PUT("/maintenance", c.SetMaintenance)
+			admin.GET("/quarantine", c.ListQuarantine)
+			admin.POST("/quarantine/:fileID/release", c.ReleaseQuarantined)
+			admin.DELETE("/quarantine/:fileID", c.DeleteQuarantined)
+		}
+		replication := api.Group("/replication")
+		{
+			replication.Use(adminFilter, middleware.SharedToken(cnf.Replication.Token))
+			replication.GET("/accounts", c.ReplicationAccounts)
+			replication.GET("/changes", c.ReplicationChanges)
+			replication.GET("/versions", c.ReplicationVersions)
+			replication.POST("/files", c.ReplicationFiles)
+		}
+		orgs := api.Group("/orgs")
+		{
+			orgs.Use(authmiddleware)
+			orgs.GET("", c.ListOrgs)
+			orgs.POST("", c.CreateOrg)
+			orgs.DELETE(":orgID", c.DeleteOrg)
+			orgs.GET(":orgID/members", c.ListOrgMembers)
+			orgs.POST(":orgID/members", c.SetOrgMember)
+			orgs.DELETE(":orgID/members/:userID", c.RemoveOrgMember)
+			orgs.GET(":orgID/audit", listLimit, c.ListOrgAudit)
+		}
+		stats := api.Group("/stats")
+		{
+			stats.Use(authmiddleware)
+			stats.GET("/timeline", c.GetTimeline)
 		}
 		users := api.Group("/users")
 		{
 			users.Use(authmiddleware)
 			users.GET("/profile", c.GetProfilePhoto)
 			users.GET("/stats", c.GetStats)
-			users.GET("/channels", c.ListChannels)
+			users.GET("/channels", listLimit, c.ListChannels)
 			users.PATCH("/channels", c.UpdateChannel)
+			users.POST("/channels", c.CreateChannel)
+			users.DELETE("/channels/:channelID", stepUp, c.RemoveChannel)
+			users.GET("/preferences", c.GetPreferences)
+			users.PUT("/preferences", c.UpdatePreferences)
+			users.GET("/quick-access", c.ListQuickAccess)
+			users.POST("/quick-access", c.AddQuickAccess)
+			users.PUT("/quick-access", c.ReorderQuickAccess)
+			users.DELETE("/quick-access/:fileID", c.RemoveQuickAccess)
+			users.GET("/notifications", c.GetNotificationSettings)
+			users.PUT("/notifications", c.UpdateNotificationSettings)
+			users.POST("/notifications/test", c.TestNotification)
 			users.POST("/bots", c.AddBots)
 			users.DELETE("/bots", c.RemoveBots)
 		}
@@ -58,5 +236,5 @@ func InitRouter(r *gin.Engine, c *controller.Controller, cnf *config.Config) *gi
 
 	ui.AddRoutes(r)
 
-	return r
+	return r, nil
 }
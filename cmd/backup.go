@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/divyam234/teldrive/internal/backup"
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+func NewBackup() *cobra.Command {
+	var dataSource string
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Export or restore drive metadata",
+		Long: `Export the metadata of all drives, or restore it into another database.
+
+File contents stay in Telegram, a snapshot holds everything needed to make
+them browsable again. Sessions and bot tokens are not part of it.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			loadViperConfig(cmd)
+			if !cmd.Flags().Changed("db-data-source") {
+				dataSource = viper.GetString("db.data-source")
+			}
+			if dataSource == "" {
+				return fmt.Errorf("db data source is required")
+			}
+			return nil
+		},
+	}
+	cmd.PersistentFlags().StringP("config", "c", "", "config file (default is $HOME/.teldrive/config.toml)")
+	cmd.PersistentFlags().StringVar(&dataSource, "db-data-source", "", "Postgres connection string, or sqlite:<file> for SQLite")
+
+	open := func() (*gorm.DB, error) {
+		cfg := &config.Config{}
+		cfg.DB.DataSource = dataSource
+		cfg.DB.Migrate.Enable = true
+		return database.NewDatabase(cfg)
+	}
+
+	var (
+		output string
+		format string
+		userId int64
+	)
+	export := &cobra.Command{
+		Use:   "export",
+		Short: "Write a metadata snapshot",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "json" && format != "sql" {
+				return fmt.Errorf("unknown format %q", format)
+			}
+			db, err := open()
+			if err != nil {
+				return err
+			}
+			snap, err := backup.Export(cmd.Context(), db, userId)
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = cmd.OutOrStdout()
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			if format == "sql" {
+				return backup.WriteSQL(w, db, snap)
+			}
+			return backup.WriteJSON(w, snap)
+		},
+	}
+	export.Flags().StringVarP(&output, "output", "o", "", "file to write to (default stdout)")
+	export.Flags().StringVar(&format, "format", "json", "snapshot format, json or sql")
+	export.Flags().Int64Var(&userId, "user", 0, "only export the drive of this user id")
+
+	restore := &cobra.Command{
+		Use:   "restore [file]",
+		Short: "Restore a JSON metadata snapshot",
+		Long: `Restore a JSON snapshot written by export, reading stdin when no file is
+given. The database is migrated first, rows already present are kept.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var r io.Reader = cmd.InOrStdin()
+			if len(args) > 0 && args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			snap, err := backup.Read(r)
+			if err != nil {
+				return err
+			}
+			db, err := open()
+			if err != nil {
+				return err
+			}
+			res, err := backup.Restore(cmd.Context(), db, snap, userId)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(res)
+		},
+	}
+	restore.Flags().Int64Var(&userId, "user", 0, "restore the channels and files as belonging to this user id")
+
+	cmd.AddCommand(export, restore)
+	return cmd
+}
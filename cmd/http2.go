@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configureHTTP2 applies the HTTP/2 settings to srv. Over TLS HTTP/2 is
+// negotiated with ALPN, without it only h2c is served and only when enabled.
+func configureHTTP2(srv *http.Server, cnf *config.HTTP2Config, secure bool) error {
+	h2 := &http2.Server{
+		MaxConcurrentStreams:         uint32(cnf.MaxStreams),
+		MaxUploadBufferPerStream:     int32(cnf.StreamWindow),
+		MaxUploadBufferPerConnection: int32(cnf.ConnWindow),
+	}
+	// browsers make each new request of a player depend exclusively on the
+	// previous ones, so with priorities a seek waits for the earlier ranges
+	if cnf.FairScheduling {
+		h2.NewWriteScheduler = http2.NewRandomWriteScheduler
+	}
+	if secure {
+		return http2.ConfigureServer(srv, h2)
+	}
+	if cnf.Cleartext {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2)
+	}
+	return nil
+}
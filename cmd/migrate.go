@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var migrateCommands = []string{"up", "up-by-one", "up-to", "down", "down-to", "redo", "status", "version"}
+
+func NewMigrate() *cobra.Command {
+	var dataSource string
+	cmd := &cobra.Command{
+		Use:   "migrate [command] [version]",
+		Short: "Apply or roll back database migrations",
+		Long: `Apply or roll back the database migrations embedded in the binary.
+
+Commands:
+  up          apply all pending migrations (default)
+  up-by-one   apply the next pending migration
+  up-to       apply migrations up to a version
+  down        roll back the latest migration
+  down-to     roll back migrations down to a version
+  redo        roll back and reapply the latest migration
+  status      list migrations and whether they are applied
+  version     print the current schema version`,
+		Args:      cobra.RangeArgs(0, 2),
+		ValidArgs: migrateCommands,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			loadViperConfig(cmd)
+			if !cmd.Flags().Changed("db-data-source") {
+				dataSource = viper.GetString("db.data-source")
+			}
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			command := "up"
+			if len(args) > 0 {
+				command = args[0]
+			}
+			if !isMigrateCommand(command) {
+				return fmt.Errorf("unknown migrate command %q", command)
+			}
+			if dataSource == "" {
+				return fmt.Errorf("db data source is required")
+			}
+
+			db, err := database.OpenMigrations(dataSource)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			return database.Migrate(db, command, args[min(1, len(args)):]...)
+		},
+	}
+	cmd.Flags().StringP("config", "c", "", "config file (default is $HOME/.teldrive/config.toml)")
+	cmd.Flags().StringVar(&dataSource, "db-data-source", "", "Postgres connection string, or sqlite:<file> for SQLite")
+	return cmd
+}
+
+func isMigrateCommand(command string) bool {
+	for _, c := range migrateCommands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
@@ -12,6 +12,7 @@ func New() *cobra.Command {
 			cmd.Help()
 		},
 	}
-	cmd.AddCommand(NewRun(), NewVersion())
+	cmd.AddCommand(NewRun(), NewMigrate(), NewBackup(), NewImportChannel(), NewVerify(), NewPurgeOrphans(),
+		NewUser(), NewVersion())
 	return cmd
 }
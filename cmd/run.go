@@ -4,25 +4,32 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 	"unicode"
 
 	"github.com/divyam234/teldrive/api"
 	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/diskcache"
 	"github.com/divyam234/teldrive/internal/duration"
 	"github.com/divyam234/teldrive/internal/kv"
 	"github.com/divyam234/teldrive/internal/middleware"
+	"github.com/divyam234/teldrive/internal/render"
+	"github.com/divyam234/teldrive/internal/scan"
 	"github.com/divyam234/teldrive/internal/tgc"
 	"github.com/divyam234/teldrive/internal/utils"
 	"github.com/divyam234/teldrive/pkg/controller"
 	"github.com/divyam234/teldrive/pkg/cron"
 	"github.com/divyam234/teldrive/pkg/logging"
 	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/fsnotify/fsnotify"
 	"github.com/gin-contrib/gzip"
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
@@ -35,22 +42,173 @@ import (
 )
 
 func NewRun() *cobra.Command {
-	config := config.Config{}
+	return newRun(&config.Config{})
+}
+
+func newRun(config *config.Config) *cobra.Command {
 	runCmd := &cobra.Command{
-		Use:   "run",
-		Short: "Start Teldrive Server",
+		Use:     "run",
+		Aliases: []string{"serve"},
+		Short:   "Start Teldrive Server",
 		Run: func(cmd *cobra.Command, args []string) {
-			runApplication(&config)
+			runApplication(cmd, config)
 
 		},
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			return initViperConfig(cmd)
+			if err := initViperConfig(cmd); err != nil {
+				return err
+			}
+			return config.Validate()
 		},
 	}
 
+	runCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "migrate" {
+			name = "db-migrate-enable"
+		}
+		return pflag.NormalizedName(name)
+	})
+
 	runCmd.Flags().StringP("config", "c", "", "config file (default is $HOME/.teldrive/config.toml)")
 	runCmd.Flags().IntVarP(&config.Server.Port, "server-port", "p", 8080, "Server port")
 	duration.DurationVar(runCmd.Flags(), &config.Server.GracefulShutdown, "server-graceful-shutdown", 15*time.Second, "Server graceful shutdown timeout")
+	runCmd.Flags().StringSliceVar(&config.Server.TrustedProxies, "server-trusted-proxies", []string{},
+		"Proxies allowed to set the client IP through X-Forwarded-For")
+	runCmd.Flags().StringSliceVar(&config.Server.RemoteIpHeaders, "server-remote-ip-headers",
+		[]string{"X-Forwarded-For", "X-Real-IP"}, "Headers trusted proxies pass the client IP in, tried in order")
+	runCmd.Flags().StringVar(&config.Server.BasePath, "server-base-path", "",
+		"Path prefix all routes are served under, such as /teldrive (empty serves at the root)")
+	runCmd.Flags().StringVar(&config.Server.PublicUrl, "server-public-url", "",
+		"Address clients reach the server at, such as https://drive.example.com, needed to make links")
+	runCmd.Flags().BoolVar(&config.Server.HTTP2.Cleartext, "server-http2-cleartext", false,
+		"Serve HTTP/2 without TLS (h2c) for proxies that forward it unencrypted")
+	runCmd.Flags().IntVar(&config.Server.HTTP2.MaxStreams, "server-http2-max-streams", 250,
+		"Concurrent HTTP/2 streams per connection, such as parallel range requests of a player")
+	runCmd.Flags().IntVar(&config.Server.HTTP2.StreamWindow, "server-http2-stream-window", 4*1024*1024,
+		"HTTP/2 flow control window in bytes of each request body")
+	runCmd.Flags().IntVar(&config.Server.HTTP2.ConnWindow, "server-http2-conn-window", 16*1024*1024,
+		"HTTP/2 flow control window in bytes shared by the request bodies of a connection")
+	runCmd.Flags().BoolVar(&config.Server.HTTP2.FairScheduling, "server-http2-fair-scheduling", true,
+		"Ignore the priorities browsers give HTTP/2 responses, so a seek is not queued behind the ranges requested before")
+
+	runCmd.Flags().StringSliceVar(&config.Security.Cors.AllowedOrigins, "security-cors-allowed-origins", []string{"*"},
+		"Origins allowed to make cross-origin requests (* allows any, empty disables CORS)")
+	runCmd.Flags().BoolVar(&config.Security.Cors.AllowCredentials, "security-cors-allow-credentials", false,
+		"Allow cross-origin requests to send cookies, not allowed with a * origin")
+	duration.DurationVar(runCmd.Flags(), &config.Security.Cors.MaxAge, "security-cors-max-age", 12*time.Hour,
+		"How long browsers may cache preflight responses")
+	runCmd.Flags().StringVar(&config.Security.ContentSecurityPolicy, "security-content-security-policy", "",
+		"Content-Security-Policy header value (empty disables)")
+	runCmd.Flags().StringVar(&config.Security.FrameOptions, "security-frame-options", "SAMEORIGIN",
+		"X-Frame-Options header value (empty disables)")
+	runCmd.Flags().StringVar(&config.Security.ReferrerPolicy, "security-referrer-policy", "strict-origin-when-cross-origin",
+		"Referrer-Policy header value (empty disables)")
+	duration.DurationVar(runCmd.Flags(), &config.Security.HstsMaxAge, "security-hsts-max-age", 0,
+		"Strict-Transport-Security max age for HTTPS requests (0 disables)")
+	runCmd.Flags().BoolVar(&config.Security.HstsIncludeSubdomains, "security-hsts-include-subdomains", false,
+		"Apply Strict-Transport-Security to subdomains")
+
+	runCmd.Flags().IntVar(&config.Limits.Auth.Requests, "limits-auth-requests", 10, "Login attempts allowed per IP and window (0 disables)")
+	duration.DurationVar(runCmd.Flags(), &config.Limits.Auth.Window, "limits-auth-window", time.Minute, "Auth rate limit window")
+	runCmd.Flags().IntVar(&config.Limits.List.Requests, "limits-list-requests", 120, "Listing requests allowed per user and window (0 disables)")
+	duration.DurationVar(runCmd.Flags(), &config.Limits.List.Window, "limits-list-window", time.Minute, "Listing rate limit window")
+	runCmd.Flags().IntVar(&config.Limits.Stream.Requests, "limits-stream-requests", 300, "Stream requests allowed per IP and window (0 disables)")
+	duration.DurationVar(runCmd.Flags(), &config.Limits.Stream.Window, "limits-stream-window", time.Minute, "Stream rate limit window")
+
+	runCmd.Flags().StringVar(&config.Search.Mode, "search-mode", "fulltext",
+		"How file names are searched: fulltext (Postgres text search) or substring (ILIKE, no custom functions needed)")
+
+	runCmd.Flags().StringVar(&config.Render.Backend, "render-backend", "",
+		"Service office documents are converted to PDF with for previews: gotenberg or collabora (empty disables)")
+	runCmd.Flags().StringVar(&config.Render.Url, "render-url", "", "Base URL of the render service")
+	duration.DurationVar(runCmd.Flags(), &config.Render.Timeout, "render-timeout", 2*time.Minute,
+		"Time allowed for a single document conversion")
+	runCmd.Flags().Int64Var(&config.Render.MaxSize, "render-max-size", 50*1024*1024,
+		"Largest document in bytes sent to the render service")
+
+	runCmd.Flags().StringVar(&config.Scan.Backend, "scan-backend", "",
+		"Virus scanner uploads are streamed through once finalized: clamav or icap (empty disables)")
+	runCmd.Flags().StringVar(&config.Scan.Url, "scan-url", "",
+		"Address of the scanner: tcp://host:3310 or unix:///path for clamav, icap://host:1344/service for icap")
+	duration.DurationVar(runCmd.Flags(), &config.Scan.Timeout, "scan-timeout", 10*time.Minute,
+		"Time allowed for scanning a single file")
+	runCmd.Flags().Int64Var(&config.Scan.MaxSize, "scan-max-size", 100*1024*1024,
+		"Largest file in bytes sent to the scanner (0 scans every file)")
+
+	runCmd.Flags().StringVar(&config.TLS.CertFile, "tls-cert-file", "", "TLS certificate file, served on the server port")
+	runCmd.Flags().StringVar(&config.TLS.KeyFile, "tls-key-file", "", "TLS private key file")
+	runCmd.Flags().StringSliceVar(&config.TLS.AcmeDomains, "tls-acme-domains", []string{},
+		"Domains to obtain Let's Encrypt certificates for (empty disables)")
+	runCmd.Flags().StringVar(&config.TLS.AcmeEmail, "tls-acme-email", "", "Contact email for the Let's Encrypt account")
+	runCmd.Flags().StringVar(&config.TLS.AcmeCacheDir, "tls-acme-cache-dir", "",
+		"Directory Let's Encrypt certificates are kept in (default is $HOME/.teldrive/acme)")
+	runCmd.Flags().IntVar(&config.TLS.RedirectPort, "tls-redirect-port", 0,
+		"Port serving HTTP redirects to HTTPS and ACME HTTP-01 challenges, usually 80 (0 disables)")
+
+	duration.DurationVar(runCmd.Flags(), &config.Trash.Retention, "trash-retention", 30*24*time.Hour,
+		"How long deleted files stay in the trash before their messages are removed (0 turns the trash off and deletes right away)")
+	duration.DurationVar(runCmd.Flags(), &config.Undo.Window, "undo-window", 10*time.Minute,
+		"How long moves, renames and deletes can be undone, deletes only with trash-retention (0 disables)")
+
+	runCmd.Flags().IntVar(&config.Login.MaxAttempts, "login-max-attempts", 5,
+		"Failed login attempts per IP, or per account from one IP, before a lockout (0 disables)")
+	duration.DurationVar(runCmd.Flags(), &config.Login.Lockout, "login-lockout", time.Minute,
+		"First lockout duration, doubled on every further lockout")
+	duration.DurationVar(runCmd.Flags(), &config.Login.MaxLockout, "login-max-lockout", time.Hour, "Longest lockout duration")
+	runCmd.Flags().StringVar(&config.Login.CountryHeader, "login-country-header", "",
+		"Request header holding the client country set by a proxy (e.g. CF-IPCountry)")
+	runCmd.Flags().BoolVar(&config.Login.StepUp, "login-step-up", false,
+		"Confirm irreversible operations with a TOTP code or a fresh Telegram login")
+	duration.DurationVar(runCmd.Flags(), &config.Login.StepUpTtl, "login-step-up-ttl", 5*time.Minute,
+		"How long a confirmation allows irreversible operations")
+
+	runCmd.Flags().StringVar(&config.Inbox.BotToken, "inbox-bot-token", "",
+		"Token of a bot filing the documents users send it into their drive (empty disables)")
+	runCmd.Flags().StringVar(&config.Inbox.Folder, "inbox-folder", "/Inbox", "Folder documents sent to the inbox bot are filed under")
+	runCmd.Flags().StringVar(&config.Inbox.PublicUrl, "inbox-public-url", "",
+		"URL the server is reached at, for streaming links sent by the inbox bot (empty sends none)")
+
+	runCmd.Flags().StringVar(&config.Notify.BotToken, "notify-bot-token", "",
+		"Token of a bot messaging users about the events they opted in to (empty disables)")
+
+	runCmd.Flags().StringVar(&config.Replication.Token, "replication-token", "",
+		"Secret shared with the other instance, serving the replication feed when set")
+	runCmd.Flags().StringVar(&config.Replication.PrimaryUrl, "replication-primary-url", "",
+		"URL of the instance to replicate, making this instance a replica (empty disables)")
+	duration.DurationVar(runCmd.Flags(), &config.Replication.Interval, "replication-interval", time.Minute,
+		"How often a replica pulls the changes of the primary")
+	duration.DurationVar(runCmd.Flags(), &config.Replication.Reconcile, "replication-reconcile", time.Hour,
+		"How often a replica compares every file with the primary")
+	runCmd.Flags().BoolVar(&config.Replication.Mirror, "replication-mirror", false,
+		"Forward the messages of replicated files into channels owned by the replica")
+	runCmd.Flags().StringVar(&config.Replication.SessionKey, "replication-session-key", "",
+		"Base64 X25519 key sealing replicated sessions: the replica's public key on the primary, its private key on the replica (empty keeps sessions off the feed)")
+
+	runCmd.Flags().StringVar(&config.OIDC.Issuer, "oidc-issuer", "",
+		"OpenID Connect issuer URL enabling single sign-on (empty disables)")
+	runCmd.Flags().StringVar(&config.OIDC.ClientId, "oidc-client-id", "", "OpenID Connect client ID")
+	runCmd.Flags().StringVar(&config.OIDC.ClientSecret, "oidc-client-secret", "", "OpenID Connect client secret")
+	runCmd.Flags().StringVar(&config.OIDC.RedirectUrl, "oidc-redirect-url", "",
+		"Callback URL registered with the provider (default is <server url>/api/auth/oidc/callback)")
+	runCmd.Flags().StringSliceVar(&config.OIDC.Scopes, "oidc-scopes", []string{"openid", "profile", "email"},
+		"Scopes requested from the provider")
+	runCmd.Flags().BoolVar(&config.OIDC.Enforce, "oidc-enforce", false,
+		"Only sign users in through the provider, Telegram logins then only link storage accounts")
+
+	runCmd.Flags().StringVar(&config.Registration.Mode, "registration-mode", "open",
+		"Who can sign up: open, invite (invite code needed), approval (admin approves sign ups without a code) or closed")
+
+	runCmd.Flags().StringVar(&config.Alerts.WebhookUrl, "alerts-webhook-url", "", "URL security alerts are posted to as JSON")
+	runCmd.Flags().StringVar(&config.Alerts.BotToken, "alerts-bot-token", "", "Bot token used to send security alerts")
+	runCmd.Flags().Int64Var(&config.Alerts.ChatId, "alerts-chat-id", 0, "Telegram chat security alerts are sent to")
+
+	runCmd.Flags().StringSliceVar(&config.Access.Auth.Allow, "access-auth-allow", []string{}, "CIDRs allowed to use auth routes")
+	runCmd.Flags().StringSliceVar(&config.Access.Auth.Deny, "access-auth-deny", []string{}, "CIDRs denied from auth routes")
+	runCmd.Flags().StringSliceVar(&config.Access.Stream.Allow, "access-stream-allow", []string{}, "CIDRs allowed to stream files")
+	runCmd.Flags().StringSliceVar(&config.Access.Stream.Deny, "access-stream-deny", []string{}, "CIDRs denied from streaming files")
+	runCmd.Flags().StringSliceVar(&config.Access.Admin.Allow, "access-admin-allow", []string{}, "CIDRs allowed to use admin routes")
+	runCmd.Flags().StringSliceVar(&config.Access.Admin.Deny, "access-admin-deny", []string{}, "CIDRs denied from admin routes")
+	runCmd.Flags().Int64SliceVar(&config.Access.Admins, "access-admins", []int64{}, "Telegram user ids allowed to use admin routes")
 
 	runCmd.Flags().IntVarP(&config.Log.Level, "log-level", "", -1, "Logging level")
 	runCmd.Flags().StringVar(&config.Log.File, "log-file", "", "Logging file path")
@@ -60,12 +218,15 @@ func NewRun() *cobra.Command {
 	duration.DurationVar(runCmd.Flags(), &config.JWT.SessionTime, "jwt-session-time", (30*24)*time.Hour, "JWT session duration")
 	runCmd.Flags().StringSliceVar(&config.JWT.AllowedUsers, "jwt-allowed-users", []string{}, "Allowed users")
 
-	runCmd.Flags().StringVar(&config.DB.DataSource, "db-data-source", "", "Database connection string")
+	runCmd.Flags().StringVar(&config.DB.DataSource, "db-data-source", "", "Postgres connection string, or sqlite:<file> for SQLite")
 	runCmd.Flags().IntVar(&config.DB.LogLevel, "db-log-level", 1, "Database log level")
-	runCmd.Flags().BoolVar(&config.DB.Migrate.Enable, "db-migrate-enable", true, "Enable database migration")
+	runCmd.Flags().BoolVar(&config.DB.Migrate.Enable, "db-migrate-enable", true,
+		"Apply pending database migrations on startup (--migrate for short)")
 	runCmd.Flags().IntVar(&config.DB.Pool.MaxIdleConnections, "db-pool-max-open-connections", 25, "Database max open connections")
 	runCmd.Flags().IntVar(&config.DB.Pool.MaxIdleConnections, "db-pool-max-idle-connections", 25, "Database max idle connections")
 	duration.DurationVar(runCmd.Flags(), &config.DB.Pool.MaxLifetime, "db-pool-max-lifetime", 10*time.Minute, "Database max connection lifetime")
+	duration.DurationVar(runCmd.Flags(), &config.DB.QueryTimeout, "db-query-timeout", time.Minute,
+		"Longest a database statement may run (0 disables)")
 
 	runCmd.Flags().IntVar(&config.TG.AppId, "tg-app-id", 0, "Telegram app ID")
 	runCmd.Flags().StringVar(&config.TG.AppHash, "tg-app-hash", "", "Telegram app hash")
@@ -80,14 +241,65 @@ func NewRun() *cobra.Command {
 	runCmd.Flags().StringVar(&config.TG.LangCode, "tg-lang-code", "en", "Language code")
 	runCmd.Flags().StringVar(&config.TG.SystemLangCode, "tg-system-lang-code", "en-US", "System language code")
 	runCmd.Flags().StringVar(&config.TG.LangPack, "tg-lang-pack", "webk", "Language pack")
-	runCmd.Flags().StringVar(&config.TG.Proxy, "tg-proxy", "", "HTTP OR SOCKS5 proxy URL")
+	runCmd.Flags().StringVar(&config.TG.Proxy, "tg-proxy", "", "HTTP, SOCKS5 or MTProto (mtproxy://host:port?secret=...) proxy URL")
 	runCmd.Flags().IntVar(&config.TG.BgBotsLimit, "tg-bg-bots-limit", 5, "Background bots limit")
 	runCmd.Flags().BoolVar(&config.TG.DisableStreamBots, "tg-disable-stream-bots", false, "Disable stream bots")
+	duration.DurationVar(runCmd.Flags(), &config.TG.PingInterval, "tg-ping-interval", time.Minute,
+		"Keep-alive ping interval for stream clients (0 disables supervision)")
+	runCmd.Flags().IntVar(&config.TG.PoolSize, "tg-pool-size", 8, "Data connections per stream client (1 disables pooling)")
+	duration.DurationVar(runCmd.Flags(), &config.TG.ChunkTimeout, "tg-chunk-timeout", 30*time.Second,
+		"Longest a file chunk request to Telegram may take (0 disables)")
 	runCmd.Flags().StringVar(&config.TG.Uploads.EncryptionKey, "tg-uploads-encryption-key", "", "Uploads encryption key")
 	runCmd.Flags().IntVar(&config.TG.Uploads.Threads, "tg-uploads-threads", 8, "Uploads threads")
 	runCmd.Flags().IntVar(&config.TG.Uploads.MaxRetries, "tg-uploads-max-retries", 10, "Uploads Retries")
 	duration.DurationVar(runCmd.Flags(), &config.TG.Uploads.Retention, "tg-uploads-retention", (24*7)*time.Hour,
-		"Uploads retention duration")
+		"How long uploads in progress are kept after their last part before they expire")
+	runCmd.Flags().IntVar(&config.TG.Uploads.ChunkSize, "tg-uploads-chunk-size", 512*1024,
+		"Size in bytes of each request a document is uploaded in (multiple of 1024 dividing 524288)")
+	runCmd.Flags().Int64Var(&config.TG.Uploads.SplitSize, "tg-uploads-split-size", 2000*1024*1024,
+		"Largest document in bytes server side uploads are split into (at most 2000 MiB, encrypted parts are cut to fit)")
+	runCmd.Flags().BoolVar(&config.TG.Uploads.AutoChannel, "tg-uploads-auto-channel", false,
+		"Create a private storage channel for users uploading without a default channel")
+	runCmd.Flags().StringSliceVar(&config.TG.Uploads.Blocked, "tg-uploads-blocked", []string{},
+		"Extensions (.exe) and mime types (video/*) of files rejected when uploads are finalized")
+	runCmd.Flags().StringSliceVar(&config.TG.Uploads.Quarantined, "tg-uploads-quarantined", []string{},
+		"Extensions and mime types of uploaded files held until an admin releases them")
+	runCmd.Flags().Int64Var(&config.TG.Uploads.MaxFileSize, "tg-uploads-max-file-size", 0,
+		"Largest file in bytes accepted when uploads are finalized (0 disables)")
+	runCmd.Flags().IntVar(&config.TG.Uploads.RateLimit, "tg-uploads-rate-limit", 0,
+		"Bandwidth in KiB/s shared by uploads to Telegram (0 disables)")
+	runCmd.Flags().StringSliceVar(&config.TG.Uploads.RateSchedule, "tg-uploads-rate-schedule", []string{},
+		"Upload bandwidth by time of day, like 08:00-22:00=10240 in KiB/s of local time (0 disables)")
+	runCmd.Flags().BoolVar(&config.TG.Uploads.Dedup, "tg-uploads-dedup", false,
+		"Store uploads whose content is already stored, by any user, as references to the existing messages")
+
+	runCmd.Flags().StringVar(&config.Cache.Dir, "cache-dir", "", "Disk cache directory (default is $HOME/.teldrive/cache)")
+	runCmd.Flags().Int64Var(&config.Cache.MaxSize, "cache-max-size", 1024,
+		"MiB the disk cache may grow to before the least recently used entries are evicted (0 is unbounded)")
+
+	runCmd.Flags().IntVar(&config.Archive.CompressionLevel, "archive-compression-level", 6,
+		"Deflate level (0-9) for archives created on the server")
+
+	runCmd.Flags().IntVar(&config.Stream.Browser.Prefetch, "stream-browser-prefetch", 2, "Chunks fetched ahead of browser streams")
+	runCmd.Flags().IntVar(&config.Stream.Browser.RateLimit, "stream-browser-rate-limit", 0,
+		"Bandwidth in KiB/s shared by browser streams (0 disables)")
+	runCmd.Flags().IntVar(&config.Stream.Player.Prefetch, "stream-player-prefetch", 4, "Chunks fetched ahead of media player streams")
+	runCmd.Flags().IntVar(&config.Stream.Player.RateLimit, "stream-player-rate-limit", 0,
+		"Bandwidth in KiB/s shared by media player streams (0 disables)")
+	runCmd.Flags().IntVar(&config.Stream.Rclone.Prefetch, "stream-rclone-prefetch", 0, "Chunks fetched ahead of rclone streams")
+	runCmd.Flags().IntVar(&config.Stream.Rclone.RateLimit, "stream-rclone-rate-limit", 0,
+		"Bandwidth in KiB/s shared by rclone streams (0 disables)")
+	runCmd.Flags().IntVar(&config.Stream.Other.Prefetch, "stream-other-prefetch", 0, "Chunks fetched ahead of other streams")
+	runCmd.Flags().IntVar(&config.Stream.Other.RateLimit, "stream-other-rate-limit", 0,
+		"Bandwidth in KiB/s shared by other streams (0 disables)")
+	duration.DurationVar(runCmd.Flags(), &config.Stream.IdleTimeout, "stream-idle-timeout", time.Minute,
+		"Drop streams whose client stopped reading for this long (0 disables)")
+	runCmd.Flags().IntVar(&config.Stream.BufferSize, "stream-buffer-size", 256,
+		"KiB copied to the client before each flush, smaller starts playback sooner")
+	runCmd.Flags().IntVar(&config.Stream.WarmCacheSize, "stream-warm-cache-size", 64,
+		"MiB of memory caching the head and tail of videos for player probes (0 disables)")
+	runCmd.Flags().BoolVar(&config.Stream.Faststart, "stream-faststart", false,
+		"Move the index of MP4s stored with it at the end ahead of the media while streaming")
 
 	runCmd.MarkFlagRequired("tg-app-id")
 	runCmd.MarkFlagRequired("tg-app-hash")
@@ -97,7 +309,7 @@ func NewRun() *cobra.Command {
 	return runCmd
 }
 
-func runApplication(conf *config.Config) {
+func runApplication(cmd *cobra.Command, conf *config.Config) {
 	logging.SetConfig(&logging.Config{
 		Level:       zapcore.Level(conf.Log.Level),
 		Development: conf.Log.Development,
@@ -111,31 +323,171 @@ func runApplication(conf *config.Config) {
 		cancel()
 	}()
 
+	live := config.NewLive(conf, func() (*config.Config, error) {
+		return reloadConfig(cmd)
+	})
+	live.Watch(func(r *config.Runtime) {
+		logging.SetLevel(zapcore.Level(r.LogLevel))
+	})
+	watchConfig(tgContext, live)
+
 	app := fx.New(
 		fx.Supply(conf),
+		fx.Supply(live),
 		fx.Supply(logging.DefaultLogger().Desugar()),
 		fx.NopLogger,
 		fx.StopTimeout(conf.Server.GracefulShutdown+time.Second),
 		fx.Invoke(
 			initApp,
 			cron.StartCronJobs,
+			services.StartInbox,
 		),
 		fx.Provide(
 			database.NewDatabase,
 			kv.NewBoltKV,
+			diskcache.NewDiskCache,
+			render.New,
+			scan.New,
 			tgc.NewStreamWorker(tgContext),
 			tgc.NewUploadWorker,
 			services.NewAuthService,
 			services.NewFileService,
+			services.NewUploadLimiter,
 			services.NewUploadService,
 			services.NewUserService,
+			services.NewJobService,
+			services.NewArchiveService,
+			services.NewAdminService,
+			services.NewStatusService,
+			services.NewReplicationService,
+			services.NewMaintenance,
+			services.NewOrgService,
+			services.NewNotifier,
 			controller.NewController,
 		),
 	)
 	app.Run()
 }
 
+// reloadConfig resolves the configuration again the way the run command did
+// at startup: flags given on the command line win over the config file and the
+// environment, which win over flag defaults.
+func reloadConfig(cmd *cobra.Command) (*config.Config, error) {
+	conf := &config.Config{}
+	flags := newRun(conf).Flags()
+
+	var err error
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		target := flags.Lookup(f.Name)
+		if target == nil || err != nil {
+			return
+		}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			err = target.Value.(pflag.SliceValue).Replace(slice.GetSlice())
+			target.Changed = true
+			return
+		}
+		err = flags.Set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	loadViperConfig(cmd)
+	bindFlagsRecursive(flags, "", reflect.ValueOf(config.Config{}))
+	return conf, nil
+}
+
+// watchConfig reloads the configuration on SIGHUP and whenever the config
+// file changes.
+func watchConfig(ctx context.Context, live *config.Live) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				signal.Stop(hup)
+				return
+			case <-hup:
+				applyReload(live, "signal")
+			}
+		}
+	}()
+
+	// viper.WatchConfig would read the file on its own goroutine, racing the
+	// reads of Reload, so changes only trigger a reload, which Live serializes
+	if file := viper.ConfigFileUsed(); file != "" {
+		if err := watchConfigFile(ctx, file, func() { applyReload(live, "file") }); err != nil {
+			logging.DefaultLogger().Warnw("failed to watch config file", "file", file, "err", err)
+		}
+	}
+}
+
+// watchConfigFile calls fn whenever file is written or replaced. The folder is
+// watched since editors and config maps replace the file rather than write it.
+func watchConfigFile(ctx context.Context, file string, fn func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	file = filepath.Clean(file)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return err
+	}
+	real, _ := filepath.EvalSymlinks(file)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				current, _ := filepath.EvalSymlinks(file)
+				if (filepath.Clean(event.Name) == file && event.Has(fsnotify.Write|fsnotify.Create)) ||
+					(current != "" && current != real) {
+					real = current
+					fn()
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func applyReload(live *config.Live, trigger string) {
+	logger := logging.DefaultLogger()
+	changed, restart, err := live.Reload()
+	if err != nil {
+		logger.Errorw("failed to reload config", "trigger", trigger, "err", err)
+		return
+	}
+	if len(changed) > 0 {
+		logger.Infow("reloaded config", "trigger", trigger, "changed", changed)
+	}
+	if len(restart) > 0 {
+		logger.Warnw("config changes need a restart", "trigger", trigger, "settings", restart)
+	}
+}
+
 func initViperConfig(cmd *cobra.Command) error {
+	loadViperConfig(cmd)
+	bindFlagsRecursive(cmd.Flags(), "", reflect.ValueOf(config.Config{}))
+	return nil
+
+}
+
+// loadViperConfig reads the config file and environment named by the command's
+// config flag without binding them to flags.
+func loadViperConfig(cmd *cobra.Command) {
 
 	viper.SetConfigType("toml")
 
@@ -155,9 +507,6 @@ func initViperConfig(cmd *cobra.Command) error {
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv()
 	viper.ReadInConfig()
-	bindFlagsRecursive(cmd.Flags(), "", reflect.ValueOf(config.Config{}))
-	return nil
-
 }
 func bindFlagsRecursive(flags *pflag.FlagSet, prefix string, v reflect.Value) {
 	t := v.Type()
@@ -204,49 +553,107 @@ func modifyFlag(s string) string {
 	return string(result)
 }
 
-func initApp(lc fx.Lifecycle, cfg *config.Config, c *controller.Controller) *gin.Engine {
+func initApp(lc fx.Lifecycle, cfg *config.Config, live *config.Live, c *controller.Controller) (*gin.Engine, error) {
 
 	gin.SetMode(gin.ReleaseMode)
 
 	r := gin.New()
 
+	r.ContextWithFallback = true
+
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
+	r.RemoteIPHeaders = cfg.Server.RemoteIpHeaders
+
+	forwarded, err := middleware.Forwarded(cfg.Server.TrustedProxies, cfg.Server.BasePath, cfg.Server.PublicUrl)
+	if err != nil {
+		return nil, err
+	}
+	r.Use(forwarded)
+
 	r.Use(ginzap.GinzapWithConfig(logging.DefaultLogger().Desugar(), &ginzap.Config{
 		TimeFormat: time.RFC3339,
 		UTC:        true,
 		SkipPaths:  []string{"/favicon.ico", "/assets"},
 	}))
 
-	r.Use(middleware.Cors())
+	cors, err := middleware.Cors(&cfg.Security.Cors)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Use(cors, middleware.SecurityHeaders(&cfg.Security))
 
 	r.Use(func(c *gin.Context) {
 		pattern := `/(assets|images|fonts)/.*\.(js|css|svg|jpeg|jpg|png|woff|woff2|ttf|json|webp|png|ico|txt)$`
 		re, _ := regexp.Compile(pattern)
 		if re.MatchString(c.Request.URL.Path) {
-			c.Writer.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
 			gzip.Gzip(gzip.DefaultCompression)(c)
 		}
 		c.Next()
 	})
 
-	r = api.InitRouter(r, c, cfg)
+	r, err = api.InitRouter(r, c, cfg, live)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, redirect, err := newTLSConfig(&cfg.TLS, cfg.Server.Port)
+	if err != nil {
+		return nil, err
+	}
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler: r,
+		Addr:      fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:   middleware.StripBasePath(cfg.Server.BasePath, r),
+		TLSConfig: tlsConfig,
+	}
+	if err := configureHTTP2(srv, &cfg.Server.HTTP2, tlsConfig != nil); err != nil {
+		return nil, err
+	}
+	var redirectSrv *http.Server
+	if redirect != nil && cfg.TLS.RedirectPort != 0 {
+		redirectSrv = &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.TLS.RedirectPort),
+			Handler:           redirect,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
 	}
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
-			logging.FromContext(ctx).Infof("Started server http://localhost:%d", cfg.Server.Port)
+			scheme := "http"
+			if tlsConfig != nil {
+				scheme = "https"
+			}
+			logging.FromContext(ctx).Infof("Started server %s://localhost:%d%s/", scheme, cfg.Server.Port,
+				cfg.Server.BasePath)
 			go func() {
-				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				var err error
+				if tlsConfig != nil {
+					// certificates come from the TLS config
+					err = srv.ListenAndServeTLS("", "")
+				} else {
+					err = srv.ListenAndServe()
+				}
+				if err != nil && err != http.ErrServerClosed {
 					logging.DefaultLogger().Errorw("failed to close http server", "err", err)
 				}
 			}()
+			if redirectSrv != nil {
+				go func() {
+					if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+						logging.DefaultLogger().Errorw("failed to close redirect server", "err", err)
+					}
+				}()
+			}
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
 			logging.FromContext(ctx).Info("Stopped server")
+			if redirectSrv != nil {
+				redirectSrv.Shutdown(ctx)
+			}
 			return srv.Shutdown(ctx)
 		},
 	})
-	return r
+	return r, nil
 }
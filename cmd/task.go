@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/diskcache"
+	"github.com/divyam234/teldrive/internal/render"
+	"github.com/divyam234/teldrive/internal/scan"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/spf13/cobra"
+	"go.uber.org/fx"
+	"go.uber.org/zap/zapcore"
+	"gorm.io/gorm"
+)
+
+// task holds the services maintenance commands work with.
+type task struct {
+	db    *gorm.DB
+	files *services.FileService
+	jobs  *services.JobService
+}
+
+// newTask returns a command taking the same settings as run. Its RunE gets the
+// services of the server, built without starting the server, its cron jobs or
+// its bots, so it can run next to a live server.
+func newTask(use, short string, runE func(cmd *cobra.Command, args []string, t *task) error) *cobra.Command {
+	conf := &config.Config{}
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := initViperConfig(cmd); err != nil {
+				return err
+			}
+			return conf.Validate()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := openTask(conf)
+			if err != nil {
+				return err
+			}
+			return runE(cmd, args, t)
+		},
+	}
+	cmd.Flags().AddFlagSet(newRun(conf).Flags())
+	return cmd
+}
+
+func openTask(conf *config.Config) (*task, error) {
+	logging.SetConfig(&logging.Config{
+		Level:       zapcore.Level(conf.Log.Level),
+		Development: conf.Log.Development,
+		FilePath:    conf.Log.File,
+	})
+
+	t := &task{}
+	app := fx.New(taskOptions(conf), fx.NopLogger, fx.Populate(&t.db, &t.files, &t.jobs))
+	if err := app.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func taskOptions(conf *config.Config) fx.Option {
+	return fx.Options(
+		fx.Supply(conf),
+		fx.Supply(config.NewLive(conf, nil)),
+		fx.Provide(
+			database.NewDatabase,
+			diskcache.NewDiskCache,
+			render.New,
+			scan.New,
+			// streams are not served, which keeps the session file of a
+			// running server unlocked
+			func() *tgc.StreamWorker { return nil },
+			services.NewJobService,
+			services.NewNotifier,
+			services.NewFileService,
+		),
+	)
+}
+
+func printResult(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func NewImportChannel() *cobra.Command {
+	var (
+		userId  int64
+		payload schemas.ImportIn
+	)
+	cmd := newTask("import-channel", "Import the documents of a Telegram channel as files",
+		func(cmd *cobra.Command, args []string, t *task) error {
+			if userId == 0 || payload.ChannelID == 0 {
+				return fmt.Errorf("user and channel are required")
+			}
+			res, err := t.jobs.Run(cmd.Context(), userId, services.JobImportChannel, &payload)
+			if res != nil {
+				if err := printResult(cmd.OutOrStdout(), res); err != nil {
+					return err
+				}
+			}
+			return err
+		})
+	cmd.Long = `Import every document posted to a channel the user can read as a file of
+their drive. Messages imported by an earlier run are skipped, so an
+interrupted import can be started again.`
+	cmd.Flags().Int64Var(&userId, "user", 0, "user id to import for")
+	cmd.Flags().Int64Var(&payload.ChannelID, "channel", 0, "channel id to import from")
+	cmd.Flags().StringVar(&payload.Destination, "destination", "/", "folder to import into")
+	return cmd
+}
+
+func NewVerify() *cobra.Command {
+	var (
+		userId int64
+		query  schemas.VerifyQuery
+	)
+	cmd := newTask("verify", "Check that files are still readable from Telegram",
+		func(cmd *cobra.Command, args []string, t *task) error {
+			userIds := []int64{userId}
+			if userId == 0 {
+				if err := t.db.WithContext(cmd.Context()).Model(&models.Session{}).
+					Distinct("user_id").Pluck("user_id", &userIds).Error; err != nil {
+					return err
+				}
+			}
+
+			results := make(map[int64]any)
+			corrupted := 0
+			for _, id := range userIds {
+				query.UserID = id
+				res, err := t.jobs.Run(cmd.Context(), id, services.JobVerifyFiles, &query)
+				if err != nil {
+					return fmt.Errorf("user %d: %w", id, err)
+				}
+				results[id] = res
+				corrupted += res.(*schemas.VerifyResult).Corrupted
+			}
+			if err := printResult(cmd.OutOrStdout(), results); err != nil {
+				return err
+			}
+			if corrupted > 0 {
+				return fmt.Errorf("%d corrupted files found", corrupted)
+			}
+			return nil
+		})
+	cmd.Long = `Check that the files of a user, or of every user with a session, are still
+backed by readable Telegram documents of the expected size. Damaged files are
+flagged in the drive and the command exits with an error.`
+	cmd.Flags().Int64Var(&userId, "user", 0, "only verify the files of this user id")
+	cmd.Flags().BoolVar(&query.Full, "full", false, "download files to compare their checksums")
+	return cmd
+}
+
+func NewPurgeOrphans() *cobra.Command {
+	var (
+		userId int64
+		dryRun bool
+	)
+	cmd := newTask("purge-orphans", "Delete files left without a parent folder",
+		func(cmd *cobra.Command, args []string, t *task) error {
+			res, err := t.files.PurgeOrphans(cmd.Context(), userId, dryRun)
+			if err != nil {
+				return err
+			}
+			return printResult(cmd.OutOrStdout(), res)
+		})
+	cmd.Long = `Delete the files and folders cut off from the drive tree because a folder
+above them no longer exists, along with their Telegram messages.`
+	cmd.Flags().Int64Var(&userId, "user", 0, "only purge the orphans of this user id")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only count the orphans")
+	return cmd
+}
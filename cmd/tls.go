@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newTLSConfig returns the TLS config of the server and the handler of the
+// plain HTTP listener on the redirect port. Both are nil when TLS is off.
+func newTLSConfig(cnf *config.TLSConfig, port int) (*tls.Config, http.Handler, error) {
+	if !cnf.Enabled() {
+		return nil, nil, nil
+	}
+
+	redirect := redirectHTTPS(port)
+
+	if cnf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cnf.CertFile, cnf.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, redirect, nil
+	}
+
+	cacheDir := cnf.AcmeCacheDir
+	if cacheDir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			home = utils.ExecutableDir()
+		}
+		cacheDir = filepath.Join(home, ".teldrive", "acme")
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cnf.AcmeDomains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      cnf.AcmeEmail,
+	}
+
+	// TLS-ALPN-01 challenges are answered on the server port itself, HTTP-01
+	// ones only when the redirect port is 80
+	tlsConfig := m.TLSConfig()
+	tlsConfig.MinVersion = tls.VersionTLS12
+	return tlsConfig, m.HTTPHandler(redirect), nil
+}
+
+// redirectHTTPS sends requests to the same host and path over HTTPS on port.
+// Methods other than GET and HEAD get a 308 so clients resend their body.
+func redirectHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+func NewUser() *cobra.Command {
+	var dataSource string
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Add, disable or enable users",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			loadViperConfig(cmd)
+			if !cmd.Flags().Changed("db-data-source") {
+				dataSource = viper.GetString("db.data-source")
+			}
+			if dataSource == "" {
+				return fmt.Errorf("db data source is required")
+			}
+			return nil
+		},
+	}
+	cmd.PersistentFlags().StringP("config", "c", "", "config file (default is $HOME/.teldrive/config.toml)")
+	cmd.PersistentFlags().StringVar(&dataSource, "db-data-source", "", "Postgres connection string, or sqlite:<file> for SQLite")
+
+	open := func() (*gorm.DB, error) {
+		cfg := &config.Config{}
+		cfg.DB.DataSource = dataSource
+		cfg.DB.Migrate.Enable = true
+		return database.NewDatabase(cfg)
+	}
+
+	var user models.User
+	add := &cobra.Command{
+		Use:   "add [user id]",
+		Short: "Create a user and its drive ahead of its first login",
+		Long: `Create a user and the root folder of its drive, so channels can be imported
+for it before it first logs in. Logins are still subject to jwt-allowed-users.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			userId, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid user id %q", args[0])
+			}
+			db, err := open()
+			if err != nil {
+				return err
+			}
+			user.UserId = userId
+			created, err := services.AddUser(cmd.Context(), db, &user)
+			if err != nil {
+				return err
+			}
+			if !created {
+				return fmt.Errorf("user %d already exists", userId)
+			}
+			cmd.Printf("added user %d\n", userId)
+			return nil
+		},
+	}
+	add.Flags().StringVar(&user.Name, "name", "", "display name of the user")
+	add.Flags().StringVar(&user.UserName, "username", "", "Telegram username of the user")
+
+	setDisabled := func(disabled bool) func(cmd *cobra.Command, args []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			userId, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid user id %q", args[0])
+			}
+			db, err := open()
+			if err != nil {
+				return err
+			}
+			err = services.SetUserDisabled(cmd.Context(), db, userId, disabled)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("user %d not found", userId)
+			}
+			if err != nil {
+				return err
+			}
+			if disabled {
+				cmd.Printf("disabled user %d\n", userId)
+			} else {
+				cmd.Printf("enabled user %d\n", userId)
+			}
+			return nil
+		}
+	}
+
+	disable := &cobra.Command{
+		Use:   "disable [user id]",
+		Short: "Block the logins of a user",
+		Long: `Block the logins of a user and sign out its sessions. Running servers
+refuse its tokens and stream links within about a minute, as they keep
+sessions cached for that long.`,
+		Args: cobra.ExactArgs(1),
+		RunE: setDisabled(true),
+	}
+
+	enable := &cobra.Command{
+		Use:   "enable [user id]",
+		Short: "Allow a disabled user to log in again",
+		Args:  cobra.ExactArgs(1),
+		RunE:  setDisabled(false),
+	}
+
+	cmd.AddCommand(add, disable, enable)
+	return cmd
+}
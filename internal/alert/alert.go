@@ -0,0 +1,125 @@
+// Package alert delivers security notifications to an operator webhook and,
+// optionally, to a Telegram chat through the Bot API.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/pkg/logging"
+)
+
+const sendTimeout = 10 * time.Second
+
+type Event struct {
+	Type    string            `json:"type"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+type Notifier struct {
+	cnf    *config.AlertsConfig
+	client *http.Client
+}
+
+func New(cnf *config.AlertsConfig) *Notifier {
+	return &Notifier{cnf: cnf, client: &http.Client{Timeout: sendTimeout}}
+}
+
+func (n *Notifier) Enabled() bool {
+	return n.cnf.WebhookUrl != "" || (n.cnf.BotToken != "" && n.cnf.ChatId != 0)
+}
+
+// Notify sends event in the background. Delivery failures are only logged.
+func (n *Notifier) Notify(event Event) {
+	if !n.Enabled() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		logger := logging.DefaultLogger()
+		if n.cnf.WebhookUrl != "" {
+			if err := n.webhook(ctx, event); err != nil {
+				logger.Warnw("failed to send alert webhook", "type", event.Type, "err", err)
+			}
+		}
+		if n.cnf.BotToken != "" && n.cnf.ChatId != 0 {
+			if err := n.telegram(ctx, event); err != nil {
+				logger.Warnw("failed to send alert message", "type", event.Type, "err", err)
+			}
+		}
+	}()
+}
+
+func (n *Notifier) webhook(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cnf.WebhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(n.client, req)
+}
+
+func (n *Notifier) telegram(ctx context.Context, event Event) error {
+	var text strings.Builder
+	text.WriteString(event.Message)
+	keys := make([]string, 0, len(event.Fields))
+	for k := range event.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&text, "\n%s: %s", k, event.Fields[k])
+	}
+
+	return SendTelegram(ctx, n.client, n.cnf.BotToken, n.cnf.ChatId, text.String())
+}
+
+// SendTelegram sends text to chatId as the bot of token through the Bot API.
+func SendTelegram(ctx context.Context, client *http.Client, token string, chatId int64, text string) error {
+	form := url.Values{}
+	form.Set("chat_id", strconv.FormatInt(chatId, 10))
+	form.Set("text", text)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://api.telegram.org/bot"+token+"/sendMessage", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return do(client, req)
+}
+
+func do(client *http.Client, req *http.Request) error {
+	res, err := client.Do(req)
+	if err != nil {
+		// drop the URL, it may carry the bot token
+		if urlErr, ok := err.(*url.Error); ok {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
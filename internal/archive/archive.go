@@ -0,0 +1,190 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/ulikunitz/xz"
+)
+
+var ErrUnsupported = errors.New("unsupported archive format")
+
+type Entry struct {
+	Name    string
+	Size    int64
+	Dir     bool
+	ModTime time.Time
+}
+
+// WalkFunc is called for every regular file and directory in an archive. The
+// reader is only valid until the callback returns and is nil for directories.
+type WalkFunc func(entry Entry, r io.Reader) error
+
+var suffixes = []struct {
+	suffix string
+	format string
+}{
+	{".tar.gz", "tar.gz"},
+	{".tgz", "tar.gz"},
+	{".tar.bz2", "tar.bz2"},
+	{".tbz2", "tar.bz2"},
+	{".tar.xz", "tar.xz"},
+	{".txz", "tar.xz"},
+	{".tar", "tar"},
+	{".zip", "zip"},
+	{".7z", "7z"},
+}
+
+// Format detects the archive format from a file name and returns an empty
+// string if the name does not look like a supported archive.
+func Format(name string) string {
+	name = strings.ToLower(name)
+	for _, s := range suffixes {
+		if strings.HasSuffix(name, s.suffix) {
+			return s.format
+		}
+	}
+	return ""
+}
+
+// List returns all entries of an archive without reading file contents.
+func List(r io.ReaderAt, size int64, format string) ([]Entry, error) {
+	entries := []Entry{}
+	err := walk(r, size, format, false, func(entry Entry, _ io.Reader) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// Walk calls fn for every entry of an archive in the order they are stored.
+func Walk(r io.ReaderAt, size int64, format string, fn WalkFunc) error {
+	return walk(r, size, format, true, fn)
+}
+
+func walk(r io.ReaderAt, size int64, format string, open bool, fn WalkFunc) error {
+	switch format {
+	case "zip":
+		return walkZip(r, size, open, fn)
+	case "7z":
+		return walk7z(r, size, open, fn)
+	case "tar", "tar.gz", "tar.bz2", "tar.xz":
+		return walkTar(io.NewSectionReader(r, 0, size), format, fn)
+	}
+	return ErrUnsupported
+}
+
+func walkZip(r io.ReaderAt, size int64, open bool, fn WalkFunc) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			continue
+		}
+		if err := visit(f.Name, int64(f.UncompressedSize64), mode.IsDir(), f.Modified, open, f.Open, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walk7z(r io.ReaderAt, size int64, open bool, fn WalkFunc) error {
+	zr, err := sevenzip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			continue
+		}
+		if err := visit(f.Name, int64(f.UncompressedSize), mode.IsDir(), f.Modified, open, f.Open, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(r io.Reader, format string, fn WalkFunc) error {
+	var err error
+	switch format {
+	case "tar.gz":
+		r, err = gzip.NewReader(r)
+	case "tar.bz2":
+		r = bzip2.NewReader(r)
+	case "tar.xz":
+		r, err = xz.NewReader(r)
+	}
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+			continue
+		}
+		name, ok := cleanName(hdr.Name)
+		if !ok {
+			continue
+		}
+		entry := Entry{Name: name, Size: hdr.Size, Dir: hdr.Typeflag == tar.TypeDir, ModTime: hdr.ModTime}
+		if entry.Dir {
+			entry.Size = 0
+			err = fn(entry, nil)
+		} else {
+			err = fn(entry, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func visit(rawName string, size int64, dir bool, modTime time.Time, open bool,
+	openFn func() (io.ReadCloser, error), fn WalkFunc) error {
+	name, ok := cleanName(rawName)
+	if !ok {
+		return nil
+	}
+	entry := Entry{Name: name, Size: size, Dir: dir, ModTime: modTime}
+	if dir {
+		entry.Size = 0
+		return fn(entry, nil)
+	}
+	if !open {
+		return fn(entry, nil)
+	}
+	rc, err := openFn()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return fn(entry, rc)
+}
+
+// cleanName normalizes an entry name to a slash separated relative path that
+// cannot escape the extraction root.
+func cleanName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return name, name != ""
+}
@@ -0,0 +1,79 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "tar.gz", Format("backup.TAR.GZ"))
+	assert.Equal(t, "zip", Format("photos.zip"))
+	assert.Equal(t, "7z", Format("data.7z"))
+	assert.Equal(t, "", Format("movie.mkv"))
+}
+
+func TestWalkZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Create("docs/")
+	w, _ := zw.Create("docs/readme.txt")
+	w.Write([]byte("hello"))
+	w, _ = zw.Create("../../etc/passwd")
+	w.Write([]byte("x"))
+	assert.NoError(t, zw.Close())
+
+	r := bytes.NewReader(buf.Bytes())
+
+	entries, err := List(r, r.Size(), "zip")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.True(t, entries[0].Dir)
+	assert.Equal(t, "docs/readme.txt", entries[1].Name)
+	assert.Equal(t, int64(5), entries[1].Size)
+	assert.Equal(t, "etc/passwd", entries[2].Name)
+
+	contents := map[string]string{}
+	err = Walk(r, r.Size(), "zip", func(entry Entry, r io.Reader) error {
+		if !entry.Dir {
+			b, _ := io.ReadAll(r)
+			contents[entry.Name] = string(b)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", contents["docs/readme.txt"])
+}
+
+func TestWalkTarGz(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "a/b.txt", Typeflag: tar.TypeReg, Size: 3, Mode: 0644})
+	tw.Write([]byte("abc"))
+	tw.WriteHeader(&tar.Header{Name: "a/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	tw.Close()
+	gw.Close()
+
+	r := bytes.NewReader(buf.Bytes())
+
+	var names []string
+	err := Walk(r, r.Size(), "tar.gz", func(entry Entry, r io.Reader) error {
+		b, _ := io.ReadAll(r)
+		assert.Equal(t, "abc", string(b))
+		names = append(names, entry.Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/b.txt"}, names)
+}
+
+func TestUnsupported(t *testing.T) {
+	_, err := List(bytes.NewReader(nil), 0, "rar")
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
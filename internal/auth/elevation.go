@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/types"
+)
+
+var ErrNotElevated = errors.New("confirmation required")
+
+// elevation marks the session it was issued for as recently confirmed, for
+// operations that cannot be undone.
+type elevation struct {
+	Subject string `json:"sub"`
+	Hash    string `json:"hash"`
+	Expires int64  `json:"exp"`
+}
+
+// Elevate returns a token confirming the session of claims until ttl passes.
+func Elevate(secret string, claims *types.JWTClaims, ttl time.Duration) (string, error) {
+	return Seal(secret, &elevation{Subject: claims.Subject, Hash: claims.Hash,
+		Expires: time.Now().Add(ttl).Unix()})
+}
+
+// CheckElevation tells whether token confirms the session of claims.
+func CheckElevation(secret, token string, claims *types.JWTClaims) error {
+	var e elevation
+	if token == "" || Open(secret, token, &e) != nil {
+		return ErrNotElevated
+	}
+	if e.Subject != claims.Subject || e.Hash != claims.Hash || time.Now().Unix() > e.Expires {
+		return ErrNotElevated
+	}
+	return nil
+}
@@ -8,6 +8,22 @@ import (
 )
 
 func Encode(secret string, payload *types.JWTClaims) (string, error) {
+	return Seal(secret, payload)
+}
+
+func Decode(secret string, token string) (*types.JWTClaims, error) {
+	jwtToken := &types.JWTClaims{}
+
+	if err := Open(secret, token, jwtToken); err != nil {
+		return nil, err
+	}
+
+	return jwtToken, nil
+
+}
+
+// Seal encrypts the JSON encoding of payload with secret.
+func Seal(secret string, payload any) (string, error) {
 
 	rcpt := jose.Recipient{
 		Algorithm: jose.PBES2_HS256_A128KW,
@@ -20,42 +36,33 @@ func Encode(secret string, payload *types.JWTClaims) (string, error) {
 		return "", err
 	}
 
-	jwt, _ := json.Marshal(payload)
-
-	jweObject, err := enc.Encrypt(jwt)
+	data, err := json.Marshal(payload)
 
 	if err != nil {
 		return "", err
 	}
 
-	jweToken, err := jweObject.CompactSerialize()
+	jweObject, err := enc.Encrypt(data)
 
 	if err != nil {
 		return "", err
 	}
-	return jweToken, nil
+
+	return jweObject.CompactSerialize()
 }
 
-func Decode(secret string, token string) (*types.JWTClaims, error) {
+// Open decrypts a token made by Seal into payload.
+func Open(secret string, token string, payload any) error {
 	jwe, err := jose.ParseEncrypted(token)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	decryptedData, err := jwe.Decrypt(secret)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	jwtToken := &types.JWTClaims{}
-
-	err = json.Unmarshal(decryptedData, jwtToken)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return jwtToken, nil
-
+	return json.Unmarshal(decryptedData, payload)
 }
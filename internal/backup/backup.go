@@ -0,0 +1,276 @@
+// Package backup exports the metadata teldrive keeps about files stored in
+// Telegram and restores it into another database. The file contents never
+// leave Telegram, so a snapshot is all that is needed to rebuild a drive.
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Version is the snapshot format written by Export.
+const Version = 1
+
+const batchSize = 500
+
+var ErrUnsupportedVersion = errors.New("unsupported snapshot version")
+
+// Snapshot holds the rows needed to rebuild one or all drives. Sessions and
+// bot tokens are secrets and are left out, users log in again and re-add
+// their bots after a restore.
+type Snapshot struct {
+	Version    int                `json:"version"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	Users      []models.User      `json:"users"`
+	Channels   []models.Channel   `json:"channels"`
+	Files      []models.File      `json:"files"`
+	Shares     []models.Share     `json:"shares,omitempty"`
+	Orgs       []models.Org       `json:"orgs,omitempty"`
+	OrgMembers []models.OrgMember `json:"orgMembers,omitempty"`
+}
+
+// Result counts the rows a restore inserted. Rows already present are kept
+// as they are and not counted. Channels and files whose ids are taken by
+// another user are not restored and listed as conflicts.
+type Result struct {
+	Users            int64    `json:"users"`
+	Channels         int64    `json:"channels"`
+	Files            int64    `json:"files"`
+	Shares           int64    `json:"shares"`
+	Orgs             int64    `json:"orgs"`
+	ChannelConflicts []int64  `json:"channelConflicts,omitempty"`
+	FileConflicts    []string `json:"fileConflicts,omitempty"`
+}
+
+// Export reads the snapshot of userId, or of every user when userId is 0.
+// Shares and orgs span several users and are only part of full snapshots.
+func Export(ctx context.Context, db *gorm.DB, userId int64) (*Snapshot, error) {
+	snap := &Snapshot{Version: Version, CreatedAt: time.Now().UTC()}
+
+	scoped := func(tx *gorm.DB) *gorm.DB {
+		if userId != 0 {
+			return tx.Where("user_id = ?", userId)
+		}
+		return tx
+	}
+
+	db = db.WithContext(ctx)
+	if err := scoped(db).Order("user_id").Find(&snap.Users).Error; err != nil {
+		return nil, err
+	}
+	if err := scoped(db).Order("channel_id").Find(&snap.Channels).Error; err != nil {
+		return nil, err
+	}
+	if err := scoped(db).Where("status = ?", "active").Order("id").Find(&snap.Files).Error; err != nil {
+		return nil, err
+	}
+	if userId != 0 {
+		return snap, nil
+	}
+	if err := db.Order("id").Find(&snap.Shares).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Order("id").Find(&snap.Orgs).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Order("org_id, user_id").Find(&snap.OrgMembers).Error; err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Restore inserts snap into db in a single transaction. When userId is not 0
+// the channels and files are restored as belonging to that user and rows
+// involving other users are skipped, which lets a user move their drive to
+// another account or instance. Restored channels are not selected so the
+// user's default channel stays as it is.
+func Restore(ctx context.Context, db *gorm.DB, snap *Snapshot, userId int64) (*Result, error) {
+	if err := check(snap); err != nil {
+		return nil, err
+	}
+
+	if userId != 0 {
+		scoped := *snap
+		scoped.Users, scoped.Shares, scoped.Orgs, scoped.OrgMembers = nil, nil, nil, nil
+		scoped.Channels = make([]models.Channel, len(snap.Channels))
+		for i, c := range snap.Channels {
+			c.UserID = userId
+			c.Selected = false
+			scoped.Channels[i] = c
+		}
+		scoped.Files = make([]models.File, len(snap.Files))
+		for i, f := range snap.Files {
+			f.UserID = userId
+			scoped.Files[i] = f
+		}
+		snap = &scoped
+	}
+
+	res := &Result{}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if res.ChannelConflicts, err = channelConflicts(tx, snap.Channels); err != nil {
+			return err
+		}
+		if res.FileConflicts, err = fileConflicts(tx, snap.Files); err != nil {
+			return err
+		}
+		steps := []struct {
+			rows  any
+			n     int
+			count *int64
+		}{
+			{&snap.Users, len(snap.Users), &res.Users},
+			{&snap.Channels, len(snap.Channels), &res.Channels},
+			{&snap.Files, len(snap.Files), &res.Files},
+			{&snap.Shares, len(snap.Shares), &res.Shares},
+			{&snap.Orgs, len(snap.Orgs), &res.Orgs},
+			{&snap.OrgMembers, len(snap.OrgMembers), nil},
+		}
+		for _, step := range steps {
+			if step.n == 0 {
+				continue
+			}
+			r := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(step.rows, batchSize)
+			if r.Error != nil {
+				return r.Error
+			}
+			if step.count != nil {
+				*step.count = r.RowsAffected
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// channelConflicts returns the channels of the snapshot that another user
+// already holds.
+func channelConflicts(tx *gorm.DB, channels []models.Channel) ([]int64, error) {
+	owners := make(map[int64]int64, len(channels))
+	ids := make([]int64, 0, len(channels))
+	for _, c := range channels {
+		owners[c.ChannelID] = c.UserID
+		ids = append(ids, c.ChannelID)
+	}
+	var res []int64
+	for start := 0; start < len(ids); start += batchSize {
+		var existing []models.Channel
+		if err := tx.Select("channel_id", "user_id").Where("channel_id IN ?", ids[start:min(start+batchSize, len(ids))]).
+			Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		for _, c := range existing {
+			if c.UserID != owners[c.ChannelID] {
+				res = append(res, c.ChannelID)
+			}
+		}
+	}
+	return res, nil
+}
+
+// fileConflicts returns the ids of the files of the snapshot that already
+// exist under another user.
+func fileConflicts(tx *gorm.DB, files []models.File) ([]string, error) {
+	owners := make(map[string]int64, len(files))
+	ids := make([]string, 0, len(files))
+	for _, f := range files {
+		owners[f.ID] = f.UserID
+		ids = append(ids, f.ID)
+	}
+	var res []string
+	for start := 0; start < len(ids); start += batchSize {
+		var existing []models.File
+		if err := tx.Select("id", "user_id").Where("id IN ?", ids[start:min(start+batchSize, len(ids))]).
+			Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		for _, f := range existing {
+			if f.UserID != owners[f.ID] {
+				res = append(res, f.ID)
+			}
+		}
+	}
+	return res, nil
+}
+
+// Read decodes a snapshot written by WriteJSON.
+func Read(r io.Reader) (*Snapshot, error) {
+	var snap Snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, err
+	}
+	if err := check(&snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+func WriteJSON(w io.Writer, snap *Snapshot) error {
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// WriteSQL writes snap as INSERT statements for db's dialect, to be replayed
+// with psql against a migrated database.
+func WriteSQL(w io.Writer, db *gorm.DB, snap *Snapshot) error {
+	dry := db.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true})
+
+	if _, err := io.WriteString(w, "BEGIN;\n"); err != nil {
+		return err
+	}
+	write := func(row any) error {
+		stmt := dry.Clauses(clause.OnConflict{DoNothing: true}).Create(row).Statement
+		_, err := fmt.Fprintf(w, "%s;\n", db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...))
+		return err
+	}
+	for i := range snap.Users {
+		if err := write(&snap.Users[i]); err != nil {
+			return err
+		}
+	}
+	for i := range snap.Channels {
+		if err := write(&snap.Channels[i]); err != nil {
+			return err
+		}
+	}
+	for i := range snap.Files {
+		if err := write(&snap.Files[i]); err != nil {
+			return err
+		}
+	}
+	for i := range snap.Shares {
+		if err := write(&snap.Shares[i]); err != nil {
+			return err
+		}
+	}
+	for i := range snap.Orgs {
+		if err := write(&snap.Orgs[i]); err != nil {
+			return err
+		}
+	}
+	for i := range snap.OrgMembers {
+		if err := write(&snap.OrgMembers[i]); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "COMMIT;\n")
+	return err
+}
+
+func check(snap *Snapshot) error {
+	if snap.Version != Version {
+		return fmt.Errorf("%w %d", ErrUnsupportedVersion, snap.Version)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package backup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	size, channel := int64(42), int64(7)
+	parts := models.Parts{{ID: 3, Salt: "s"}}
+	snap := &Snapshot{Version: Version, Files: []models.File{{ID: "a", Name: "a.txt", Type: "file",
+		Size: &size, ChannelID: &channel, Parts: &parts, UserID: 1}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, snap))
+
+	got, err := Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, snap.Files, got.Files)
+
+	_, err = Read(strings.NewReader(`{"version": 99}`))
+	assert.ErrorContains(t, err, "unsupported snapshot version")
+}
+
+func TestWriteSQL(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		NamingStrategy:       schema.NamingStrategy{TablePrefix: "teldrive."},
+	})
+	require.NoError(t, err)
+
+	parts := models.Parts{{ID: 3}}
+	snap := &Snapshot{Version: Version,
+		Users: []models.User{{UserId: 1, UserName: "o'neil"}},
+		Files: []models.File{{ID: "a", Name: "a.txt", Type: "file", Parts: &parts, UserID: 1}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSQL(&buf, db, snap))
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "BEGIN;\n"))
+	assert.True(t, strings.HasSuffix(out, "COMMIT;\n"))
+	assert.Contains(t, out, `INSERT INTO "teldrive"."users"`)
+	assert.Contains(t, out, `'o''neil'`)
+	assert.Contains(t, out, `'[{"id":3}]'`)
+	assert.Contains(t, out, "ON CONFLICT DO NOTHING")
+}
@@ -0,0 +1,144 @@
+// Package bandwidth caps a shared bandwidth with a limit that varies with the
+// time of day. A schedule is a default limit and windows like
+// "08:00-22:00=10240" with their own limit, in KiB/s of the local time. 0
+// lifts the limit and windows ending before they start wrap past midnight.
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type window struct {
+	start, end time.Duration
+	rate       int
+}
+
+func (w window) contains(d time.Duration) bool {
+	if w.start <= w.end {
+		return d >= w.start && d < w.end
+	}
+	return d >= w.start || d < w.end
+}
+
+// Schedule is a bandwidth limit in KiB/s by time of day.
+type Schedule struct {
+	def     int
+	windows []window
+}
+
+// Parse builds a schedule from its default limit and windows. The first
+// window holding a time wins.
+func Parse(def int, windows []string) (*Schedule, error) {
+	if def < 0 {
+		return nil, fmt.Errorf("bandwidth limit cannot be negative, got %d", def)
+	}
+	s := &Schedule{def: def}
+	for _, spec := range windows {
+		span, limit, ok := strings.Cut(spec, "=")
+		from, to, ok2 := strings.Cut(span, "-")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("bandwidth window must look like 08:00-22:00=10240, got %q", spec)
+		}
+		w := window{}
+		var err error
+		if w.start, err = clock(from); err != nil {
+			return nil, fmt.Errorf("bandwidth window %q: %w", spec, err)
+		}
+		if w.end, err = clock(to); err != nil {
+			return nil, fmt.Errorf("bandwidth window %q: %w", spec, err)
+		}
+		if w.rate, err = strconv.Atoi(strings.TrimSpace(limit)); err != nil || w.rate < 0 {
+			return nil, fmt.Errorf("bandwidth window %q: limit must be a non negative number of KiB/s", spec)
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+func clock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// At returns the limit in KiB/s at t, 0 when unlimited.
+func (s *Schedule) At(t time.Time) int {
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	for _, w := range s.windows {
+		if w.contains(d) {
+			return w.rate
+		}
+	}
+	return s.def
+}
+
+// Limiter shares the bandwidth of a schedule between readers.
+type Limiter struct {
+	schedule *Schedule
+	now      func() time.Time
+
+	mu      sync.Mutex
+	rate    int
+	limiter *rate.Limiter
+}
+
+func NewLimiter(schedule *Schedule) *Limiter {
+	return &Limiter{schedule: schedule, now: time.Now}
+}
+
+// current returns the limiter for the limit in force, nil when unlimited.
+func (l *Limiter) current() *rate.Limiter {
+	kib := l.schedule.At(l.now())
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if kib != l.rate || (kib > 0 && l.limiter == nil) {
+		l.rate, l.limiter = kib, nil
+		if kib > 0 {
+			l.limiter = rate.NewLimiter(rate.Limit(kib*1024), kib*1024)
+		}
+	}
+	return l.limiter
+}
+
+// Reader limits reads from r to the bandwidth in force, which it shares with
+// the other readers of l. A nil Limiter returns r unchanged.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, l: l}
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	limiter := r.l.current()
+	if limiter == nil {
+		return r.r.Read(p)
+	}
+	if len(p) > limiter.Burst() {
+		p = p[:limiter.Burst()]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
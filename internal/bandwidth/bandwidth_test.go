@@ -0,0 +1,52 @@
+package bandwidth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	s, err := Parse(0, []string{"08:00-22:00=10240", "23:30-01:00=512"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		at   string
+		want int
+	}{
+		{"07:59", 0},
+		{"08:00", 10240},
+		{"21:59", 10240},
+		{"22:00", 0},
+		{"23:45", 512},
+		{"00:30", 512},
+		{"01:00", 0},
+	} {
+		d, _ := clock(tc.at)
+		if got := s.At(day.Add(d)); got != tc.want {
+			t.Errorf("At(%s) = %d, want %d", tc.at, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"08:00=10", "8-22=10", "08:00-22:00=-1", "08:00-25:00=1"} {
+		if _, err := Parse(0, []string{bad}); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestLimiterFollowsSchedule(t *testing.T) {
+	s, _ := Parse(0, []string{"08:00-22:00=10"})
+	now := time.Date(2024, 5, 30, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(s)
+	l.now = func() time.Time { return now }
+
+	if lim := l.current(); lim == nil || lim.Burst() != 10*1024 {
+		t.Fatalf("limiter at noon = %v", lim)
+	}
+	now = now.Add(11 * time.Hour)
+	if lim := l.current(); lim != nil {
+		t.Errorf("limiter at night = %v, want none", lim)
+	}
+}
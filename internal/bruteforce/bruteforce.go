@@ -0,0 +1,110 @@
+// Package bruteforce locks out keys, such as client IPs or accounts, after
+// repeated authentication failures. Each lockout doubles the previous one.
+package bruteforce
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	failures    int
+	lockouts    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+type Guard struct {
+	mu          sync.Mutex
+	maxAttempts int
+	lockout     time.Duration
+	maxLockout  time.Duration
+	entries     map[string]*entry
+	now         func() time.Time
+}
+
+// New returns a guard locking a key for lockout after maxAttempts consecutive
+// failures, doubling up to maxLockout on every further lockout. A key's history
+// is forgotten once it has not failed for maxLockout.
+func New(maxAttempts int, lockout, maxLockout time.Duration) *Guard {
+	return &Guard{
+		maxAttempts: maxAttempts,
+		lockout:     lockout,
+		maxLockout:  max(lockout, maxLockout),
+		entries:     make(map[string]*entry),
+		now:         time.Now,
+	}
+}
+
+// Locked returns how long the most restricted of keys stays locked, or zero.
+func (g *Guard) Locked(keys ...string) time.Duration {
+	if g.maxAttempts <= 0 {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	var wait time.Duration
+	for _, key := range keys {
+		if e, ok := g.entries[key]; ok && e.lockedUntil.After(now) {
+			wait = max(wait, e.lockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// Fail records a failure for every key and returns the keys it locked out
+// along with the longest lockout applied.
+func (g *Guard) Fail(keys ...string) ([]string, time.Duration) {
+	if g.maxAttempts <= 0 {
+		return nil, 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	g.sweep(now)
+
+	var (
+		locked []string
+		wait   time.Duration
+	)
+	for _, key := range keys {
+		e, ok := g.entries[key]
+		if !ok {
+			e = &entry{}
+			g.entries[key] = e
+		}
+		e.failures++
+		e.lastFailure = now
+		if e.failures < g.maxAttempts {
+			continue
+		}
+		d := g.lockout << e.lockouts
+		if d <= 0 || d > g.maxLockout {
+			d = g.maxLockout
+		}
+		e.lockouts++
+		e.failures = 0
+		e.lockedUntil = now.Add(d)
+		locked = append(locked, key)
+		wait = max(wait, d)
+	}
+	return locked, wait
+}
+
+// Succeed clears the failure history of keys.
+func (g *Guard) Succeed(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range keys {
+		delete(g.entries, key)
+	}
+}
+
+func (g *Guard) sweep(now time.Time) {
+	for key, e := range g.entries {
+		if now.Sub(e.lastFailure) > g.maxLockout && now.After(e.lockedUntil) {
+			delete(g.entries, key)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package bruteforce
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuard(t *testing.T) {
+	now := time.Now()
+	g := New(3, time.Minute, 10*time.Minute)
+	g.now = func() time.Time { return now }
+
+	for range 2 {
+		locked, _ := g.Fail("ip:1", "acct:a")
+		assert.Empty(t, locked)
+	}
+	assert.Zero(t, g.Locked("ip:1"))
+
+	locked, wait := g.Fail("ip:1", "acct:a")
+	assert.ElementsMatch(t, []string{"ip:1", "acct:a"}, locked)
+	assert.Equal(t, time.Minute, wait)
+	assert.Equal(t, time.Minute, g.Locked("acct:a", "ip:2"))
+
+	now = now.Add(2 * time.Minute)
+	assert.Zero(t, g.Locked("ip:1"))
+
+	// the second lockout doubles
+	for range 3 {
+		_, wait = g.Fail("ip:1")
+	}
+	assert.Equal(t, 2*time.Minute, wait)
+
+	g.Succeed("ip:1")
+	assert.Zero(t, g.Locked("ip:1"))
+}
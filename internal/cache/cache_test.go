@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -26,3 +28,63 @@ func TestCache(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, result, value)
 }
+
+func TestFetchSharesLoad(t *testing.T) {
+	ctx := context.Background()
+	ns := NewNamespace[string]("test", time.Minute)
+
+	var calls int32
+	load := func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := ns.Fetch(ctx, ns.Key("fetch"), load)
+			assert.NoError(t, err)
+			assert.Equal(t, "value", result)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	stats := ns.stats()
+	assert.Equal(t, int64(10), stats.Hits+stats.Misses)
+}
+
+func TestFetchIgnoresCanceledWaiter(t *testing.T) {
+	ns := NewNamespace[string]("test-cancel", time.Minute)
+
+	release := make(chan struct{})
+	load := func(ctx context.Context) (string, error) {
+		<-release
+		return "value", ctx.Err()
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := ns.Fetch(canceled, ns.Key("fetch"), load)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	result := make(chan string)
+	go func() {
+		value, err := ns.Fetch(context.Background(), ns.Key("fetch"), load)
+		assert.NoError(t, err)
+		result <- value
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	close(release)
+	assert.Equal(t, "value", <-result)
+}
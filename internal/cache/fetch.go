@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+	"golang.org/x/sync/singleflight"
+)
+
+// ttlJitter spreads expiry of entries written with the same ttl so that keys
+// filled together do not all expire together.
+const ttlJitter = 0.1
+
+type entry struct {
+	Data    []byte
+	Expires int64
+}
+
+func (e *entry) expired() bool {
+	return e.Expires != 0 && time.Now().UnixNano() > e.Expires
+}
+
+type loadFunc func(ctx context.Context) (interface{}, error)
+
+var (
+	group      singleflight.Group
+	refreshing sync.Map
+)
+
+// fetch reads key into value, calling load on a miss, and reports whether the
+// value came from the cache. Concurrent misses for the same key share a single
+// load. Once an entry is older than ttl it is still served for another ttl
+// while one background load refreshes it, so a hot key expiring never blocks
+// callers on the upstream. A zero ttl never expires.
+func (c *Cache) fetch(ctx context.Context, key string, value interface{}, ttl time.Duration, load loadFunc) (bool, error) {
+	var e entry
+	if err := c.Get(key, &e); err == nil {
+		if e.expired() {
+			if _, busy := refreshing.LoadOrStore(key, struct{}{}); !busy {
+				go c.refresh(context.WithoutCancel(ctx), key, ttl, load)
+			}
+		}
+		return true, msgpack.Unmarshal(e.Data, value)
+	}
+
+	// the load is shared by every caller waiting on key, so one of them going
+	// away must not fail the others
+	flight := group.DoChan(key, func() (interface{}, error) {
+		return c.load(context.WithoutCancel(ctx), key, ttl, load)
+	})
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case res := <-flight:
+		if res.Err != nil {
+			return false, res.Err
+		}
+		return false, msgpack.Unmarshal(res.Val.([]byte), value)
+	}
+}
+
+func (c *Cache) refresh(ctx context.Context, key string, ttl time.Duration, load loadFunc) {
+	defer refreshing.Delete(key)
+	group.Do(key, func() (interface{}, error) {
+		return c.load(ctx, key, ttl, load)
+	})
+}
+
+func (c *Cache) load(ctx context.Context, key string, ttl time.Duration, load loadFunc) ([]byte, error) {
+	value, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.put(key, data, ttl); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// put stores encoded data as an entry that expires after ttl and is kept for
+// as long again to be served while it is refreshed.
+func (c *Cache) put(key string, data []byte, ttl time.Duration) error {
+	e := entry{Data: data}
+	if ttl > 0 {
+		ttl = jitter(ttl)
+		e.Expires = time.Now().Add(ttl).UnixNano()
+		ttl *= 2
+	}
+	return c.Set(key, &e, ttl)
+}
+
+func jitter(ttl time.Duration) time.Duration {
+	delta := float64(ttl) * ttlJitter
+	return ttl + time.Duration(delta*(2*rand.Float64()-1))
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// Namespace is a typed view over the cache for keys sharing a prefix and TTL.
+type Namespace[T any] struct {
+	name   string
+	ttl    time.Duration
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type NamespaceStats struct {
+	Name     string  `json:"name"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hitRatio"`
+}
+
+type statser interface {
+	stats() NamespaceStats
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]statser{}
+)
+
+// NewNamespace declares a namespace. Names must be unique, so namespaces are
+// meant to be created once as package level variables.
+func NewNamespace[T any](name string, ttl time.Duration) *Namespace[T] {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("cache: namespace %q already registered", name))
+	}
+	n := &Namespace[T]{name: name, ttl: ttl}
+	registry[name] = n
+	return n
+}
+
+// Key joins parts into a key within the namespace.
+func (n *Namespace[T]) Key(parts ...any) string {
+	s := make([]string, 0, len(parts)+1)
+	s = append(s, n.name)
+	for _, p := range parts {
+		s = append(s, fmt.Sprint(p))
+	}
+	return strings.Join(s, ":")
+}
+
+// Get returns the value for key unless it is missing or expired. Values are
+// stored the way Fetch stores them, so both can be used on the same key.
+func (n *Namespace[T]) Get(ctx context.Context, key string) (T, bool) {
+	var value T
+	var e entry
+	if err := FromContext(ctx).Get(key, &e); err != nil || e.expired() || msgpack.Unmarshal(e.Data, &value) != nil {
+		n.misses.Add(1)
+		return value, false
+	}
+	n.hits.Add(1)
+	return value, true
+}
+
+func (n *Namespace[T]) Set(ctx context.Context, key string, value T) error {
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return FromContext(ctx).put(key, data, n.ttl)
+}
+
+func (n *Namespace[T]) Delete(ctx context.Context, key string) {
+	FromContext(ctx).Delete(key)
+}
+
+// Fetch returns the value for key, calling load when it is missing. Expired
+// values are served while being refreshed in the background.
+func (n *Namespace[T]) Fetch(ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	hit, err := FromContext(ctx).fetch(ctx, key, &value, n.ttl, func(ctx context.Context) (interface{}, error) {
+		return load(ctx)
+	})
+	if hit {
+		n.hits.Add(1)
+	} else {
+		n.misses.Add(1)
+	}
+	return value, err
+}
+
+func (n *Namespace[T]) stats() NamespaceStats {
+	s := NamespaceStats{Name: n.name, Hits: n.hits.Load(), Misses: n.misses.Load()}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRatio = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+// Stats returns hit and miss counters for every namespace, sorted by name.
+func Stats() []NamespaceStats {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	res := make([]NamespaceStats, 0, len(registry))
+	for _, n := range registry {
+		res = append(res, n.stats())
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
@@ -0,0 +1,49 @@
+// Package clientclass guesses what kind of client issued a stream request so
+// operators can apply different streaming policies to each kind.
+package clientclass
+
+import (
+	"net/http"
+	"strings"
+)
+
+type Class string
+
+const (
+	Browser Class = "browser"
+	Player  Class = "player"
+	Rclone  Class = "rclone"
+	Other   Class = "other"
+)
+
+// players lists lowercase user agent fragments of media players and the
+// streaming stacks they are built on.
+var players = []string{
+	"vlc", "mpv", "kodi", "infuse", "exoplayer", "applecoremedia", "lavf", "mxplayer", "mx player",
+	"nplayer", "stagefright", "jellyfin", "plex", "emby", "potplayer", "iina", "gstreamer", "libmpv",
+}
+
+func Classify(r *http.Request) Class {
+	ua := strings.ToLower(r.UserAgent())
+
+	if strings.Contains(ua, "rclone") {
+		return Rclone
+	}
+
+	for _, p := range players {
+		if strings.Contains(ua, p) {
+			return Player
+		}
+	}
+
+	if strings.HasPrefix(ua, "mozilla/") {
+		// media elements in a page behave like a player: sequential reads with seeks
+		switch r.Header.Get("Sec-Fetch-Dest") {
+		case "video", "audio":
+			return Player
+		}
+		return Browser
+	}
+
+	return Other
+}
@@ -0,0 +1,34 @@
+package clientclass
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		ua    string
+		dest  string
+		class Class
+	}{
+		{"rclone/v1.66.0", "", Rclone},
+		{"VLC/3.0.20 LibVLC/3.0.20", "", Player},
+		{"Lavf/60.3.100", "", Player},
+		{"AppleCoreMedia/1.0.0.21E230 (iPhone; U; CPU OS 17_4 like Mac OS X; en_us)", "", Player},
+		{"Mozilla/5.0 (X11; Linux x86_64) Gecko/20100101 Firefox/125.0", "", Browser},
+		{"Mozilla/5.0 (X11; Linux x86_64) Gecko/20100101 Firefox/125.0", "video", Player},
+		{"curl/8.5.0", "", Other},
+		{"", "", Other},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", test.ua)
+		if test.dest != "" {
+			r.Header.Set("Sec-Fetch-Dest", test.dest)
+		}
+		assert.Equal(t, test.class, Classify(r), test.ua)
+	}
+}
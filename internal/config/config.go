@@ -1,20 +1,260 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/divyam234/teldrive/internal/bandwidth"
+	"github.com/divyam234/teldrive/internal/uploadpolicy"
 )
 
 type Config struct {
-	Server ServerConfig
-	Log    LoggingConfig
-	JWT    JWTConfig
-	DB     DBConfig
-	TG     TGConfig
+	Server   ServerConfig
+	Log      LoggingConfig
+	JWT      JWTConfig
+	DB       DBConfig
+	TG       TGConfig
+	Cache    CacheConfig
+	Archive  ArchiveConfig
+	Stream   StreamConfig
+	Access   AccessConfig
+	Security SecurityConfig
+	Limits   LimitsConfig
+	Login    LoginConfig
+	Alerts   AlertsConfig
+	Search   SearchConfig
+	Render   RenderConfig
+	Scan     ScanConfig
+	Trash    TrashConfig
+	Undo     UndoConfig
+	TLS      TLSConfig
+	// Registration decides who gets an account on their first login.
+	Registration RegistrationConfig
+	OIDC         OIDCConfig
+	Inbox        InboxConfig
+	Notify       NotifyConfig
+	Replication  ReplicationConfig
 }
 
 type ServerConfig struct {
 	Port             int
 	GracefulShutdown time.Duration
+	TrustedProxies   []string
+	// RemoteIpHeaders are read, in order, for the client IP of requests from
+	// trusted proxies.
+	RemoteIpHeaders []string
+	// BasePath serves every route under a path prefix such as /teldrive.
+	BasePath string
+	// PublicUrl is the address clients reach the server at. Share, stream and
+	// index links are only made when it is set, as the Host header of a
+	// request is up to the client.
+	PublicUrl string
+	HTTP2     HTTP2Config
+}
+
+// HTTP2Config tunes HTTP/2, which is served over TLS and, when Cleartext is
+// set, as h2c for proxies that forward it unencrypted. The windows bound how
+// much request body a client may send before it is read; how much response a
+// download may have in flight is up to the window the client grants. With
+// FairScheduling the responses of a connection are sent regardless of the
+// priorities the client gives them.
+type HTTP2Config struct {
+	Cleartext      bool
+	MaxStreams     int
+	StreamWindow   int
+	ConnWindow     int
+	FairScheduling bool
+}
+
+// AccessConfig holds the IP rules enforced on each route group. Admins are the
+// Telegram user IDs allowed to use the admin routes, nobody is when it is empty.
+type AccessConfig struct {
+	Auth   AccessRules
+	Stream AccessRules
+	Admin  AccessRules
+	Admins []int64
+}
+
+type SecurityConfig struct {
+	Cors                  CorsConfig
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ReferrerPolicy        string
+	HstsMaxAge            time.Duration
+	HstsIncludeSubdomains bool
+}
+
+type CorsConfig struct {
+	AllowedOrigins   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// LimitsConfig holds the request budgets of rate limited route groups.
+type LimitsConfig struct {
+	Auth   LimitBudget
+	List   LimitBudget
+	Stream LimitBudget
+}
+
+type LimitBudget struct {
+	Requests int
+	Window   time.Duration
+}
+
+const (
+	// SearchFullText matches names with the teldrive.get_tsvector functions.
+	SearchFullText = "fulltext"
+	// SearchSubstring matches names with ILIKE and needs no custom functions.
+	SearchSubstring = "substring"
+)
+
+type SearchConfig struct {
+	Mode string
+}
+
+// RenderConfig selects the service office documents are converted to PDF
+// with for previews.
+type RenderConfig struct {
+	Backend string
+	Url     string
+	Timeout time.Duration
+	MaxSize int64
+}
+
+// ScanConfig selects the virus scanner finalized uploads are streamed through,
+// clamav for a clamd daemon or icap. Larger files than MaxSize are not scanned.
+type ScanConfig struct {
+	Backend string
+	Url     string
+	Timeout time.Duration
+	MaxSize int64
+}
+
+// TrashConfig sets how long deleted files can be restored before their
+// messages are removed from Telegram.
+type TrashConfig struct {
+	Retention time.Duration
+}
+
+// UndoConfig sets how long moves, renames and deletes can be undone.
+type UndoConfig struct {
+	Window time.Duration
+}
+
+// TLSConfig terminates TLS in the server, either with a certificate from
+// files or with certificates obtained from Let's Encrypt for AcmeDomains.
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	AcmeDomains  []string
+	AcmeEmail    string
+	AcmeCacheDir string
+	// RedirectPort serves plain HTTP, redirecting to HTTPS and answering ACME
+	// HTTP-01 challenges.
+	RedirectPort int
+}
+
+func (t *TLSConfig) Enabled() bool {
+	return t.CertFile != "" || len(t.AcmeDomains) > 0
+}
+
+const (
+	// RegistrationOpen lets anyone allowed by jwt-allowed-users sign up.
+	RegistrationOpen = "open"
+	// RegistrationInvite needs an invite code to sign up.
+	RegistrationInvite = "invite"
+	// RegistrationApproval queues sign ups without an invite code until an
+	// admin approves them.
+	RegistrationApproval = "approval"
+	// RegistrationClosed only lets existing users in.
+	RegistrationClosed = "closed"
+)
+
+// RegistrationConfig controls sign ups. Invites and approvals are managed by
+// the users listed in Access.Admins.
+type RegistrationConfig struct {
+	Mode string
+}
+
+// OIDCConfig enables single sign-on through an OpenID Connect provider such as
+// Authentik, Keycloak or Google. Identities are linked once to the Telegram
+// account storing their files, whose session is reused on later sign-ins.
+type OIDCConfig struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	// RedirectUrl defaults to the callback route under the URL the login was
+	// started from.
+	RedirectUrl string
+	Scopes      []string
+	// Enforce only lets users in through the provider, Telegram logins are
+	// then only used to link a storage account.
+	Enforce bool
+}
+
+func (c *OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// InboxConfig runs a bot that files the documents users send or forward to it
+// under Folder in their drive and answers commands browsing the drive.
+// PublicUrl is the address the server is reached at, for the streaming links
+// the bot replies with.
+type InboxConfig struct {
+	BotToken  string
+	Folder    string
+	PublicUrl string
+}
+
+// NotifyConfig runs a bot that messages users about the events they opted in
+// to. Users have to start a chat with the bot before it can reach them.
+type NotifyConfig struct {
+	BotToken string
+}
+
+// ReplicationConfig mirrors the metadata of a primary instance into this one.
+// Both instances share Token: the primary serves its change feed to requests
+// carrying it and a replica, which has PrimaryUrl set, pulls the feed every
+// Interval and compares every file with the primary every Reconcile. Mirror
+// makes the replica forward the messages of each file into a channel of its
+// own, so its copy outlives the channels of the primary. SessionKey is the
+// base64 X25519 key Telegram sessions are replicated with: the public key of
+// the replica on the primary and its private key on the replica. Sessions are
+// not replicated without it.
+type ReplicationConfig struct {
+	Token      string
+	PrimaryUrl string
+	Interval   time.Duration
+	Reconcile  time.Duration
+	Mirror     bool
+	SessionKey string
+}
+
+type LoginConfig struct {
+	MaxAttempts   int
+	Lockout       time.Duration
+	MaxLockout    time.Duration
+	CountryHeader string
+	// StepUp makes irreversible operations wait for a TOTP code or a fresh
+	// Telegram login, which counts for StepUpTtl.
+	StepUp    bool
+	StepUpTtl time.Duration
+}
+
+type AlertsConfig struct {
+	WebhookUrl string
+	BotToken   string
+	ChatId     int64
+}
+
+type AccessRules struct {
+	Allow []string
+	Deny  []string
 }
 
 type TGConfig struct {
@@ -32,15 +272,68 @@ type TGConfig struct {
 	SessionFile       string
 	BgBotsLimit       int
 	DisableStreamBots bool
+	PingInterval      time.Duration
+	PoolSize          int
 	Proxy             string
-	Uploads           struct {
+	// ChunkTimeout bounds each chunk request of a read, so a stalled call
+	// fails the stream instead of holding its client forever.
+	ChunkTimeout time.Duration
+	Uploads      struct {
 		EncryptionKey string
 		Threads       int
 		MaxRetries    int
 		Retention     time.Duration
+		ChunkSize     int
+		SplitSize     int64
+		AutoChannel   bool
+		// Blocked and Quarantined are the extensions and mime types of files
+		// rejected or held for an admin when uploads are finalized, see
+		// internal/uploadpolicy. MaxFileSize, in bytes, rejects larger files.
+		Blocked     []string
+		Quarantined []string
+		MaxFileSize int64
+		// RateLimit caps in KiB/s the bandwidth uploads to Telegram share and
+		// RateSchedule sets other limits by time of day, see internal/bandwidth.
+		RateLimit    int
+		RateSchedule []string
+		// Dedup points uploads whose content is already stored at the
+		// existing messages, see FileService.DedupPendingFiles.
+		Dedup bool
 	}
 }
 
+// CacheConfig places the disk cache of resized images and renders. MaxSize is
+// in MiB; the least recently used entries are evicted beyond it.
+type CacheConfig struct {
+	Dir     string
+	MaxSize int64
+}
+
+type ArchiveConfig struct {
+	CompressionLevel int
+}
+
+// StreamConfig holds the policy applied to streams from each client class.
+// IdleTimeout drops streams whose client stopped reading for that long and
+// BufferSize, in KiB, is how much is copied to the client between flushes.
+// WarmCacheSize, in MiB, holds the heads and tails of videos being played.
+// Faststart plays MP4s with their index at the end as if it came first.
+type StreamConfig struct {
+	Browser       StreamPolicy
+	Player        StreamPolicy
+	Rclone        StreamPolicy
+	Other         StreamPolicy
+	IdleTimeout   time.Duration
+	BufferSize    int
+	WarmCacheSize int
+	Faststart     bool
+}
+
+type StreamPolicy struct {
+	Prefetch  int
+	RateLimit int
+}
+
 type LoggingConfig struct {
 	Level       int
 	Development bool
@@ -56,7 +349,9 @@ type JWTConfig struct {
 type DBConfig struct {
 	DataSource string
 	LogLevel   int
-	Migrate    struct {
+	// QueryTimeout is the statement_timeout of the connections, 0 disables it.
+	QueryTimeout time.Duration
+	Migrate      struct {
 		Enable bool
 	}
 	Pool struct {
@@ -65,3 +360,98 @@ type DBConfig struct {
 		MaxLifetime        time.Duration
 	}
 }
+
+const (
+	// MaxChunkSize is the largest file part accepted by upload.saveBigFilePart.
+	MaxChunkSize = 512 * 1024
+	// MaxSplitSize is the largest document Telegram accepts.
+	MaxSplitSize int64 = 2000 * 1024 * 1024
+)
+
+// Validate checks settings that would otherwise only fail once Telegram
+// rejects a request.
+func (c *Config) Validate() error {
+	if c.Search.Mode != SearchFullText && c.Search.Mode != SearchSubstring {
+		return fmt.Errorf("search mode must be %q or %q, got %q", SearchFullText, SearchSubstring, c.Search.Mode)
+	}
+	switch c.Registration.Mode {
+	case RegistrationOpen, RegistrationInvite, RegistrationApproval, RegistrationClosed:
+	default:
+		return fmt.Errorf("registration mode must be %q, %q, %q or %q, got %q", RegistrationOpen,
+			RegistrationInvite, RegistrationApproval, RegistrationClosed, c.Registration.Mode)
+	}
+	if c.OIDC.Enabled() && c.OIDC.ClientId == "" {
+		return fmt.Errorf("oidc client id is required with an issuer")
+	}
+	if c.OIDC.Enforce && !c.OIDC.Enabled() {
+		return fmt.Errorf("oidc enforce needs an issuer")
+	}
+	if c.Inbox.BotToken != "" && !strings.HasPrefix(c.Inbox.Folder, "/") {
+		return fmt.Errorf("inbox folder must be an absolute path, got %q", c.Inbox.Folder)
+	}
+	if r := c.Replication; r.PrimaryUrl != "" && (r.Token == "" || r.Interval <= 0 || r.Reconcile <= 0) {
+		return fmt.Errorf("replication needs a token and positive interval and reconcile periods")
+	}
+	if p := c.Replication.PrimaryUrl; p != "" && !strings.HasPrefix(p, "https://") {
+		return fmt.Errorf("replication primary url must use https, got %q", p)
+	}
+	if k := c.Replication.SessionKey; k != "" {
+		if b, err := base64.StdEncoding.DecodeString(k); err != nil || len(b) != 32 {
+			return fmt.Errorf("replication session key must be a base64 32 byte key")
+		}
+	}
+	if c.Login.StepUp && c.Login.StepUpTtl <= 0 {
+		return fmt.Errorf("login step up ttl must be positive")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls cert file and key file must be set together")
+	}
+	if c.TLS.CertFile != "" && len(c.TLS.AcmeDomains) > 0 {
+		return fmt.Errorf("tls cert file and acme domains cannot be used together")
+	}
+	if p := c.Server.BasePath; p != "" && (!strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/")) {
+		return fmt.Errorf("server base path must start and not end with /, got %q", p)
+	}
+	if u := c.Server.PublicUrl; u != "" {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("server public url must be an http or https url, got %q", u)
+		}
+	}
+	h2 := c.Server.HTTP2
+	if h2.MaxStreams < 0 || h2.StreamWindow < 0 || h2.ConnWindow < 0 {
+		return fmt.Errorf("server http2 settings cannot be negative")
+	}
+	if h2.StreamWindow > math.MaxInt32 || h2.ConnWindow > math.MaxInt32 {
+		return fmt.Errorf("server http2 windows cannot exceed %d bytes", math.MaxInt32)
+	}
+	if h2.StreamWindow > h2.ConnWindow && h2.ConnWindow > 0 {
+		return fmt.Errorf("server http2 stream window cannot exceed the connection window")
+	}
+	if c.TLS.RedirectPort != 0 && !c.TLS.Enabled() {
+		return fmt.Errorf("tls redirect port needs a cert file or acme domains")
+	}
+	if c.Stream.BufferSize <= 0 {
+		return fmt.Errorf("stream buffer size must be positive, got %d", c.Stream.BufferSize)
+	}
+	u := c.TG.Uploads
+	if u.ChunkSize <= 0 || u.ChunkSize%1024 != 0 || MaxChunkSize%u.ChunkSize != 0 {
+		return fmt.Errorf("tg uploads chunk size must be a multiple of 1024 dividing %d, got %d", MaxChunkSize, u.ChunkSize)
+	}
+	if u.SplitSize < int64(u.ChunkSize) || u.SplitSize > MaxSplitSize {
+		return fmt.Errorf("tg uploads split size must be between the chunk size and %d, got %d", MaxSplitSize, u.SplitSize)
+	}
+	if u.Retention <= 0 {
+		return fmt.Errorf("tg uploads retention must be positive, got %s", u.Retention)
+	}
+	if u.MaxFileSize < 0 {
+		return fmt.Errorf("tg uploads max file size cannot be negative, got %d", u.MaxFileSize)
+	}
+	if _, err := bandwidth.Parse(u.RateLimit, u.RateSchedule); err != nil {
+		return fmt.Errorf("tg uploads rate: %w", err)
+	}
+	if err := uploadpolicy.Validate(append(u.Blocked, u.Quarantined...)); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// Runtime holds the settings that can be reloaded while the server runs, so
+// changing them does not need a restart that would drop active streams.
+type Runtime struct {
+	LogLevel          int
+	Limits            LimitsConfig
+	ChunkSize         int
+	BgBotsLimit       int
+	DisableStreamBots bool
+}
+
+func (c *Config) Runtime() *Runtime {
+	return &Runtime{
+		LogLevel:          c.Log.Level,
+		Limits:            c.Limits,
+		ChunkSize:         c.TG.Uploads.ChunkSize,
+		BgBotsLimit:       c.TG.BgBotsLimit,
+		DisableStreamBots: c.TG.DisableStreamBots,
+	}
+}
+
+func (c *Config) setRuntime(r *Runtime) {
+	c.Log.Level = r.LogLevel
+	c.Limits = r.Limits
+	c.TG.Uploads.ChunkSize = r.ChunkSize
+	c.TG.BgBotsLimit = r.BgBotsLimit
+	c.TG.DisableStreamBots = r.DisableStreamBots
+}
+
+// isRuntimeSetting tells whether the setting with the given flag name is part
+// of Runtime.
+func isRuntimeSetting(name string) bool {
+	switch name {
+	case "log-level", "tg-uploads-chunk-size", "tg-bg-bots-limit", "tg-disable-stream-bots":
+		return true
+	}
+	return strings.HasPrefix(name, "limits-")
+}
+
+var ErrReloadUnsupported = errors.New("configuration reload is not supported")
+
+// Live holds the current Runtime settings and swaps them on Reload. Readers
+// get an immutable snapshot from Load.
+type Live struct {
+	mu       sync.Mutex
+	current  atomic.Pointer[Runtime]
+	applied  Config
+	load     func() (*Config, error)
+	watchers []func(*Runtime)
+}
+
+// NewLive starts from c. load resolves the configuration again from its
+// sources and may be nil when it cannot be reloaded.
+func NewLive(c *Config, load func() (*Config, error)) *Live {
+	l := &Live{applied: *c, load: load}
+	l.current.Store(c.Runtime())
+	return l
+}
+
+func (l *Live) Load() *Runtime {
+	return l.current.Load()
+}
+
+// Watch registers fn to be called with the new settings after every reload
+// that changed them.
+func (l *Live) Watch(fn func(*Runtime)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.watchers = append(l.watchers, fn)
+}
+
+// Reload loads the configuration again and applies its Runtime settings. It
+// returns the flag names of the settings it applied and of those that changed
+// but only take effect after a restart. An invalid configuration is rejected
+// as a whole.
+func (l *Live) Reload() (changed, restart []string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.load == nil {
+		return nil, nil, ErrReloadUnsupported
+	}
+	next, err := l.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := next.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range diffSettings("", reflect.ValueOf(l.applied), reflect.ValueOf(*next)) {
+		if isRuntimeSetting(name) {
+			changed = append(changed, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+
+	if len(changed) > 0 {
+		runtime := next.Runtime()
+		l.applied.setRuntime(runtime)
+		l.current.Store(runtime)
+		for _, fn := range l.watchers {
+			fn(runtime)
+		}
+	}
+	return changed, restart, nil
+}
+
+// diffSettings returns the flag names of the settings that differ between a
+// and b, without their values as some of them are secrets.
+func diffSettings(prefix string, a, b reflect.Value) []string {
+	var names []string
+	for i := range a.NumField() {
+		field := a.Type().Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			names = append(names, diffSettings(prefix+strings.ToLower(field.Name)+"-", a.Field(i), b.Field(i))...)
+			continue
+		}
+		name := prefix + flagName(field.Name)
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// flagName turns a field name into its part of a flag name, as the run
+// command does.
+func flagName(s string) string {
+	var result []rune
+	for i, c := range s {
+		if i > 0 && unicode.IsUpper(c) {
+			result = append(result, '-')
+		}
+		result = append(result, unicode.ToLower(c))
+	}
+	return string(result)
+}
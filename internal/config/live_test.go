@@ -0,0 +1,71 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func validConfig() *Config {
+	c := &Config{}
+	c.Search.Mode = SearchFullText
+	c.Registration.Mode = RegistrationOpen
+	c.TG.Uploads.ChunkSize = MaxChunkSize
+	c.TG.Uploads.SplitSize = MaxSplitSize
+	c.TG.Uploads.Retention = 7 * 24 * time.Hour
+	c.Stream.BufferSize = 256
+	c.Limits.List = LimitBudget{Requests: 120, Window: time.Minute}
+	return c
+}
+
+func TestLiveReload(t *testing.T) {
+	next := validConfig()
+	live := NewLive(validConfig(), func() (*Config, error) {
+		c := *next
+		return &c, nil
+	})
+
+	var watched *Runtime
+	live.Watch(func(r *Runtime) { watched = r })
+
+	next.Limits.List.Requests = 10
+	next.TG.Uploads.ChunkSize = 128 * 1024
+	next.DB.DataSource = "postgres://other"
+
+	changed, restart, err := live.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"tg-uploads-chunk-size", "limits-list-requests"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if want := []string{"db-data-source"}; !reflect.DeepEqual(restart, want) {
+		t.Errorf("restart = %v, want %v", restart, want)
+	}
+	if got := live.Load(); got.Limits.List.Requests != 10 || got.ChunkSize != 128*1024 {
+		t.Errorf("runtime not applied: %+v", got)
+	}
+	if watched != live.Load() {
+		t.Error("watcher not called with the new settings")
+	}
+
+	// nothing changed since, so watchers stay quiet
+	watched = nil
+	if changed, _, err := live.Reload(); err != nil || len(changed) != 0 || watched != nil {
+		t.Errorf("second reload changed %v, err %v", changed, err)
+	}
+
+	next.TG.Uploads.ChunkSize = 1000
+	if _, _, err := live.Reload(); err == nil {
+		t.Error("invalid config accepted")
+	}
+	if live.Load().ChunkSize != 128*1024 {
+		t.Error("invalid config applied")
+	}
+}
+
+func TestLiveReloadUnsupported(t *testing.T) {
+	if _, _, err := NewLive(validConfig(), nil).Reload(); err != ErrReloadUnsupported {
+		t.Errorf("err = %v, want %v", err, ErrReloadUnsupported)
+	}
+}
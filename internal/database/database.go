@@ -7,7 +7,6 @@ import (
 	"github.com/divyam234/teldrive/pkg/logging"
 
 	"go.uber.org/zap/zapcore"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
 )
@@ -20,8 +19,13 @@ func NewDatabase(cfg *config.Config) (*gorm.DB, error) {
 		logger = NewLogger(time.Second, true, zapcore.Level(cfg.DB.LogLevel))
 	)
 
+	dialect, err := dialector(cfg.DB.DataSource, cfg.DB.QueryTimeout)
+	if err != nil {
+		return nil, err
+	}
+
 	for i := 0; i <= 10; i++ {
-		db, err = gorm.Open(postgres.Open(cfg.DB.DataSource), &gorm.Config{
+		db, err = gorm.Open(dialect, &gorm.Config{
 			Logger: logger,
 			NamingStrategy: schema.NamingStrategy{
 				TablePrefix:   "teldrive.",
@@ -50,10 +54,14 @@ func NewDatabase(cfg *config.Config) (*gorm.DB, error) {
 	rawDB.SetConnMaxLifetime(cfg.DB.Pool.MaxLifetime)
 
 	if cfg.DB.Migrate.Enable {
-		err := migrateDB(rawDB)
+		migrations, err := OpenMigrations(cfg.DB.DataSource)
 		if err != nil {
 			return nil, err
 		}
+		defer migrations.Close()
+		if err := migrateDB(migrations); err != nil {
+			return nil, err
+		}
 	}
 	return db, nil
 }
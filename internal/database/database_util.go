@@ -13,9 +13,10 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"gorm.io/gorm/schema"
+	"modernc.org/sqlite"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/sqlite/*.sql
 var embedMigrations embed.FS
 
 func NewTestDatabase(tb testing.TB, migration bool) *gorm.DB {
@@ -70,12 +71,25 @@ func DeleteRecordAll(_ testing.TB, db *gorm.DB, tableWhereClauses []string) erro
 }
 
 func migrateDB(db *sql.DB) error {
+	return Migrate(db, "up")
+}
+
+// Migrate runs a goose command, such as up, down, down-to, redo or status,
+// against the migrations embedded in the binary. SQLite databases opened by
+// OpenMigrations get the migrations of their own schema.
+func Migrate(db *sql.DB, command string, args ...string) error {
 	goose.SetBaseFS(embedMigrations)
 
-	if err := goose.SetDialect("postgres"); err != nil {
+	dialect, dir, table := "postgres", "migrations", "goose_db_version"
+	if _, ok := db.Driver().(*sqlite.Driver); ok {
+		// the main database of a connection is in memory, see sqliteConnector
+		dialect, dir, table = "sqlite3", "migrations/sqlite", "teldrive.goose_db_version"
+	}
+	goose.SetTableName(table)
+	if err := goose.SetDialect(dialect); err != nil {
 		return fmt.Errorf("failed run migrate: %w", err)
 	}
-	if err := goose.Up(db, "migrations"); err != nil {
+	if err := goose.Run(command, db, dir, args...); err != nil {
 		return fmt.Errorf("failed run migrate: %w", err)
 	}
 	return nil
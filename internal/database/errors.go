@@ -5,6 +5,8 @@ import (
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 var (
@@ -25,6 +27,10 @@ func IsKeyConflictErr(err error) bool {
 		if e.Code == "23505" {
 			return true
 		}
+	case *sqlite.Error:
+		if e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || e.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+			return true
+		}
 	}
 	return false
 }
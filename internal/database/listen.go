@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/jackc/pgx/v5"
+)
+
+const listenRetryDelay = 5 * time.Second
+
+// Listener relays the notifications sent on a Postgres channel to the
+// goroutines waiting for their payload. All waiters share one connection,
+// which is opened on the first Wait and reopened when it fails.
+type Listener struct {
+	dsn     string
+	channel string
+	once    sync.Once
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]bool
+}
+
+func NewListener(dsn, channel string) *Listener {
+	return &Listener{dsn: dsn, channel: channel, waiters: make(map[string]map[chan struct{}]bool)}
+}
+
+// Wait returns a channel closed by the next notification carrying payload,
+// and a function to call once the caller stops waiting. Waiters are also
+// woken whenever the connection is reopened, as notifications sent meanwhile
+// are lost, so they have to check again what they are waiting for. SQLite
+// has no notifications, so on it waiters are never woken.
+func (l *Listener) Wait(payload string) (<-chan struct{}, func()) {
+	l.once.Do(func() {
+		if _, ok := sqlitePath(l.dsn); !ok {
+			go l.run()
+		}
+	})
+
+	ch := make(chan struct{})
+	l.mu.Lock()
+	if l.waiters[payload] == nil {
+		l.waiters[payload] = make(map[chan struct{}]bool)
+	}
+	l.waiters[payload][ch] = true
+	l.mu.Unlock()
+
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.waiters[payload][ch] {
+			delete(l.waiters[payload], ch)
+			if len(l.waiters[payload]) == 0 {
+				delete(l.waiters, payload)
+			}
+		}
+	}
+}
+
+func (l *Listener) run() {
+	logger := logging.DefaultLogger()
+	for {
+		err := l.listen(context.Background())
+		logger.Warnw("database listener disconnected", "channel", l.channel, "err", err)
+		time.Sleep(listenRetryDelay)
+	}
+}
+
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, l.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{l.channel}.Sanitize()); err != nil {
+		return err
+	}
+	l.wake(nil)
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		l.wake(&n.Payload)
+	}
+}
+
+// wake releases the waiters of payload, or all of them when payload is nil.
+func (l *Listener) wake(payload *string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, waiters := range l.waiters {
+		if payload != nil && key != *payload {
+			continue
+		}
+		for ch := range waiters {
+			close(ch)
+		}
+		delete(l.waiters, key)
+	}
+}
@@ -280,3 +280,6 @@ END;
 $$ LANGUAGE plpgsql;
 -- +goose StatementEnd
 
+-- +goose Down
+-- the uploads table is created this way from the start and the functions are
+-- recreated unchanged, so there is nothing to undo
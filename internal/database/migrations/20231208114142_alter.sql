@@ -3,4 +3,11 @@
 ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS "encrypted" BOOLEAN NOT NULL DEFAULT FALSE;
 ALTER TABLE teldrive.uploads ADD COLUMN IF NOT EXISTS "encrypted" BOOLEAN NOT NULL DEFAULT FALSE;
 ALTER TABLE teldrive.uploads ADD COLUMN IF NOT EXISTS "salt" TEXT;
--- +goose StatementEnd
\ No newline at end of file
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS "encrypted";
+ALTER TABLE teldrive.uploads DROP COLUMN IF EXISTS "encrypted";
+ALTER TABLE teldrive.uploads DROP COLUMN IF EXISTS "salt";
+-- +goose StatementEnd
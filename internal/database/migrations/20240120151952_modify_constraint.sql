@@ -3,4 +3,8 @@
 ALTER TABLE teldrive.bots DROP CONSTRAINT IF EXISTS btoken_user_un;
 ALTER TABLE teldrive.bots DROP CONSTRAINT IF EXISTS btoken_user_channel_un;
 ALTER TABLE teldrive.bots ADD CONSTRAINT btoken_user_channel_un UNIQUE (user_id,token,channel_id);
--- +goose StatementEnd
\ No newline at end of file
+-- +goose StatementEnd
+
+-- +goose Down
+-- btoken_user_channel_un is the constraint the bots table is created with, and
+-- the per user constraint it replaced would reject bots shared by channels
@@ -29,4 +29,10 @@ SET category =
     END
 WHERE type = 'file';
 
--- +goose StatementEnd
\ No newline at end of file
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS "teldrive"."files_category_type_user_id_index";
+ALTER TABLE "teldrive"."files" DROP COLUMN IF EXISTS "category";
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.jobs (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	user_id bigint NOT NULL,
+	"type" text NOT NULL,
+	status text NOT NULL,
+	payload jsonb,
+	result jsonb,
+	progress bigint NOT NULL DEFAULT 0,
+	total bigint NOT NULL DEFAULT 0,
+	error text,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	updated_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	finished_at timestamp
+);
+CREATE INDEX IF NOT EXISTS jobs_user_id_created_at_idx ON teldrive.jobs (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS jobs_status_idx ON teldrive.jobs (status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.jobs;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "teldrive"."files" ADD COLUMN "checksum" text;
+CREATE INDEX IF NOT EXISTS "files_user_id_checksum_index" ON "teldrive"."files" ("user_id","checksum") WHERE "checksum" IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS "teldrive"."files_user_id_checksum_index";
+ALTER TABLE "teldrive"."files" DROP COLUMN IF EXISTS "checksum";
+-- +goose StatementEnd
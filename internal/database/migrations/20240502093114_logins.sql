@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.logins (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	user_id bigint NOT NULL,
+	ip text NOT NULL,
+	network text NOT NULL,
+	country text,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+CREATE INDEX IF NOT EXISTS logins_user_id_idx ON teldrive.logins (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.logins;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "teldrive"."files" ADD COLUMN "verified_at" timestamp;
+ALTER TABLE "teldrive"."files" ADD COLUMN "integrity_error" text;
+CREATE INDEX IF NOT EXISTS "files_user_id_integrity_error_index" ON "teldrive"."files" ("user_id") WHERE "integrity_error" IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS "teldrive"."files_user_id_integrity_error_index";
+ALTER TABLE "teldrive"."files" DROP COLUMN IF EXISTS "integrity_error";
+ALTER TABLE "teldrive"."files" DROP COLUMN IF EXISTS "verified_at";
+-- +goose StatementEnd
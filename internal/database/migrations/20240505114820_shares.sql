@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.shares (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	file_id text NOT NULL REFERENCES teldrive.files(id) ON DELETE CASCADE,
+	owner_id bigint NOT NULL,
+	user_id bigint NOT NULL,
+	permission text NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	CONSTRAINT shares_file_id_user_id_key UNIQUE (file_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS shares_user_id_idx ON teldrive.shares (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.shares;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.orgs (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	name text NOT NULL,
+	owner_id bigint NOT NULL,
+	channel_id bigint NOT NULL,
+	root_id text NOT NULL REFERENCES teldrive.files(id) ON DELETE CASCADE,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	CONSTRAINT orgs_owner_id_name_key UNIQUE (owner_id, name)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS orgs_root_id_idx ON teldrive.orgs (root_id);
+
+CREATE TABLE IF NOT EXISTS teldrive.org_members (
+	org_id text NOT NULL REFERENCES teldrive.orgs(id) ON DELETE CASCADE,
+	user_id bigint NOT NULL,
+	role text NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	PRIMARY KEY (org_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS org_members_user_id_idx ON teldrive.org_members (user_id);
+
+CREATE TABLE IF NOT EXISTS teldrive.org_audits (
+	id bigserial PRIMARY KEY,
+	org_id text NOT NULL REFERENCES teldrive.orgs(id) ON DELETE CASCADE,
+	user_id bigint NOT NULL,
+	action text NOT NULL,
+	target text,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+CREATE INDEX IF NOT EXISTS org_audits_org_id_created_at_idx ON teldrive.org_audits (org_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.org_audits;
+DROP TABLE IF EXISTS teldrive.org_members;
+DROP TABLE IF EXISTS teldrive.orgs;
+-- +goose StatementEnd
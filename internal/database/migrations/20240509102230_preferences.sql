@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.preferences (
+	user_id bigint PRIMARY KEY REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	sort text NOT NULL DEFAULT 'name',
+	sort_order text NOT NULL DEFAULT 'asc',
+	page_size integer NOT NULL DEFAULT 500,
+	show_hidden boolean NOT NULL DEFAULT true,
+	date_format text NOT NULL DEFAULT '',
+	updated_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.preferences;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "teldrive"."files" ADD COLUMN IF NOT EXISTS "hidden" boolean NOT NULL DEFAULT false;
+UPDATE "teldrive"."files" SET "hidden" = true WHERE "name" LIKE '.%';
+
+CREATE OR REPLACE FUNCTION teldrive.hide_dotfiles() RETURNS TRIGGER LANGUAGE PLPGSQL AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.name IS DISTINCT FROM OLD.name THEN
+        IF NEW.name LIKE '.%' THEN
+            NEW.hidden := true;
+        ELSIF TG_OP = 'UPDATE' AND OLD.name LIKE '.%' THEN
+            NEW.hidden := false;
+        END IF;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER files_hide_dotfiles BEFORE INSERT OR UPDATE OF name ON teldrive.files
+FOR EACH ROW EXECUTE FUNCTION teldrive.hide_dotfiles();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS files_hide_dotfiles ON teldrive.files;
+DROP FUNCTION IF EXISTS teldrive.hide_dotfiles;
+ALTER TABLE "teldrive"."files" DROP COLUMN IF EXISTS "hidden";
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "teldrive"."files" ADD COLUMN IF NOT EXISTS "deleted_at" timestamp;
+ALTER TABLE "teldrive"."files" ADD COLUMN IF NOT EXISTS "deleted_path" text;
+CREATE INDEX IF NOT EXISTS "files_user_id_deleted_path_index" ON "teldrive"."files" ("user_id", "deleted_path")
+WHERE "status" = 'pending_deletion';
+
+-- remembers where a file was deleted from, as its folder is removed right after
+CREATE OR REPLACE FUNCTION teldrive.record_deletion() RETURNS TRIGGER LANGUAGE PLPGSQL AS $$
+BEGIN
+    IF NEW.status = 'pending_deletion' AND OLD.status IS DISTINCT FROM 'pending_deletion' THEN
+        NEW.deleted_at := timezone('utc'::text, now());
+        NEW.deleted_path := (SELECT path FROM teldrive.files WHERE id = NEW.parent_id);
+    ELSIF NEW.status = 'active' THEN
+        NEW.deleted_at := NULL;
+        NEW.deleted_path := NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER files_record_deletion BEFORE UPDATE OF status ON teldrive.files
+FOR EACH ROW EXECUTE FUNCTION teldrive.record_deletion();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS files_record_deletion ON teldrive.files;
+DROP FUNCTION IF EXISTS teldrive.record_deletion;
+DROP INDEX IF EXISTS "teldrive"."files_user_id_deleted_path_index";
+ALTER TABLE "teldrive"."files" DROP COLUMN IF EXISTS "deleted_path";
+ALTER TABLE "teldrive"."files" DROP COLUMN IF EXISTS "deleted_at";
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "teldrive"."files" ADD COLUMN IF NOT EXISTS "revision" bigint NOT NULL DEFAULT 0;
+
+-- bumps the revision on every change a client can make, including those done
+-- by the move and rename functions, but not on folder size or path updates
+CREATE OR REPLACE FUNCTION teldrive.bump_revision() RETURNS TRIGGER LANGUAGE PLPGSQL AS $$
+BEGIN
+    IF ROW(NEW.name, NEW.parent_id, NEW.parts, NEW.mime_type, NEW.starred, NEW.hidden, NEW.status)
+        IS DISTINCT FROM ROW(OLD.name, OLD.parent_id, OLD.parts, OLD.mime_type, OLD.starred, OLD.hidden, OLD.status) THEN
+        NEW.revision := OLD.revision + 1;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER files_bump_revision BEFORE UPDATE ON teldrive.files
+FOR EACH ROW EXECUTE FUNCTION teldrive.bump_revision();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS files_bump_revision ON teldrive.files;
+DROP FUNCTION IF EXISTS teldrive.bump_revision;
+ALTER TABLE "teldrive"."files" DROP COLUMN IF EXISTS "revision";
+-- +goose StatementEnd
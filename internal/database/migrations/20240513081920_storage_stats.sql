@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.storage_stats (
+    user_id bigint NOT NULL,
+    day date NOT NULL,
+    category text NOT NULL,
+    added_bytes bigint NOT NULL DEFAULT 0,
+    added_files bigint NOT NULL DEFAULT 0,
+    removed_bytes bigint NOT NULL DEFAULT 0,
+    removed_files bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day, category)
+);
+
+-- how far the files table has been folded into storage_stats
+CREATE TABLE IF NOT EXISTS teldrive.stat_rollups (
+    name text PRIMARY KEY,
+    rolled_until timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS "files_created_at_index" ON "teldrive"."files" ("created_at") WHERE "type" = 'file';
+CREATE INDEX IF NOT EXISTS "files_deleted_at_index" ON "teldrive"."files" ("deleted_at") WHERE "status" = 'pending_deletion';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS "teldrive"."files_deleted_at_index";
+DROP INDEX IF EXISTS "teldrive"."files_created_at_index";
+DROP TABLE IF EXISTS teldrive.stat_rollups;
+DROP TABLE IF EXISTS teldrive.storage_stats;
+-- +goose StatementEnd
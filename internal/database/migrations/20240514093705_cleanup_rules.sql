@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.cleanup_rules (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	user_id bigint NOT NULL,
+	name text NOT NULL,
+	action text NOT NULL,
+	path text NOT NULL DEFAULT '',
+	days integer NOT NULL,
+	enabled boolean NOT NULL DEFAULT true,
+	last_run_at timestamp,
+	last_count bigint NOT NULL DEFAULT 0,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	updated_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+CREATE INDEX IF NOT EXISTS cleanup_rules_user_id_idx ON teldrive.cleanup_rules (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.cleanup_rules;
+-- +goose StatementEnd
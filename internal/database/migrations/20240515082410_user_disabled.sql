@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "teldrive"."users" ADD COLUMN IF NOT EXISTS "disabled" bool NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "teldrive"."users" DROP COLUMN IF EXISTS "disabled";
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.invites (
+	code text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	created_by bigint NOT NULL,
+	note text NOT NULL DEFAULT '',
+	max_uses integer NOT NULL DEFAULT 1,
+	uses integer NOT NULL DEFAULT 0,
+	expires_at timestamp,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE TABLE IF NOT EXISTS teldrive.registrations (
+	user_id bigint NOT NULL PRIMARY KEY,
+	name text NOT NULL DEFAULT '',
+	user_name text NOT NULL DEFAULT '',
+	is_premium boolean NOT NULL DEFAULT false,
+	status text NOT NULL DEFAULT 'pending',
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	updated_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+CREATE INDEX IF NOT EXISTS registrations_status_idx ON teldrive.registrations (status, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.registrations;
+DROP TABLE IF EXISTS teldrive.invites;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.identities (
+	issuer text NOT NULL,
+	subject text NOT NULL,
+	user_id bigint,
+	email text NOT NULL DEFAULT '',
+	name text NOT NULL DEFAULT '',
+	last_login_at timestamp,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	PRIMARY KEY (issuer, subject),
+	FOREIGN KEY (user_id) REFERENCES teldrive.users(user_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS identities_user_id_idx ON teldrive.identities (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.identities;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "teldrive"."users" ADD COLUMN IF NOT EXISTS "totp_secret" text;
+ALTER TABLE "teldrive"."users" ADD COLUMN IF NOT EXISTS "totp_enabled" bool NOT NULL DEFAULT false;
+ALTER TABLE "teldrive"."users" ADD COLUMN IF NOT EXISTS "totp_last_step" bigint NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "teldrive"."users" DROP COLUMN IF EXISTS "totp_secret";
+ALTER TABLE "teldrive"."users" DROP COLUMN IF EXISTS "totp_enabled";
+ALTER TABLE "teldrive"."users" DROP COLUMN IF EXISTS "totp_last_step";
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.share_links (
+	id text NOT NULL DEFAULT teldrive.generate_uid(24) PRIMARY KEY,
+	file_id text NOT NULL REFERENCES teldrive.files(id) ON DELETE CASCADE,
+	owner_id bigint NOT NULL,
+	max_downloads integer NOT NULL DEFAULT 0,
+	rate_limit integer NOT NULL DEFAULT 0,
+	expires_at timestamp,
+	downloads bigint NOT NULL DEFAULT 0,
+	bytes_served bigint NOT NULL DEFAULT 0,
+	last_access_at timestamp,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+CREATE INDEX IF NOT EXISTS share_links_file_id_idx ON teldrive.share_links (file_id);
+
+CREATE TABLE IF NOT EXISTS teldrive.share_link_visitors (
+	link_id text NOT NULL REFERENCES teldrive.share_links(id) ON DELETE CASCADE,
+	ip text NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	PRIMARY KEY (link_id, ip)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.share_link_visitors;
+DROP TABLE IF EXISTS teldrive.share_links;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.notification_settings (
+	user_id bigint NOT NULL PRIMARY KEY REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	share_accessed bool NOT NULL DEFAULT false,
+	storage_full bool NOT NULL DEFAULT false,
+	import_finished bool NOT NULL DEFAULT false,
+	integrity_failed bool NOT NULL DEFAULT false,
+	storage_limit bigint NOT NULL DEFAULT 0,
+	storage_alerted bool NOT NULL DEFAULT false,
+	updated_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.notification_settings;
+-- +goose StatementEnd
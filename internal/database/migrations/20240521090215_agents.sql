@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.agents (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	name text NOT NULL,
+	root text NOT NULL,
+	conflict text NOT NULL DEFAULT 'rename',
+	token_hash text NOT NULL UNIQUE,
+	session_hash text NOT NULL,
+	last_seen_at timestamp,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+CREATE INDEX IF NOT EXISTS agents_user_id_idx ON teldrive.agents (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.agents;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE teldrive.agents SET conflict = CASE conflict
+	WHEN 'rename' THEN 'keep-both'
+	WHEN 'overwrite' THEN 'client-wins'
+	WHEN 'skip' THEN 'server-wins'
+	ELSE conflict END;
+ALTER TABLE teldrive.agents ALTER COLUMN conflict SET DEFAULT 'keep-both';
+
+CREATE TABLE IF NOT EXISTS teldrive.agent_conflicts (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	agent_id text NOT NULL REFERENCES teldrive.agents(id) ON DELETE CASCADE,
+	user_id bigint NOT NULL,
+	path text NOT NULL,
+	file_id text REFERENCES teldrive.files(id) ON DELETE SET NULL,
+	checksum text NOT NULL,
+	size bigint NOT NULL,
+	mod_time timestamp,
+	parts jsonb,
+	channel_id bigint NOT NULL,
+	encrypted bool NOT NULL DEFAULT false,
+	policy text NOT NULL,
+	resolution text,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	resolved_at timestamp
+);
+CREATE INDEX IF NOT EXISTS agent_conflicts_agent_id_idx ON teldrive.agent_conflicts (agent_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.agent_conflicts;
+ALTER TABLE teldrive.agents ALTER COLUMN conflict SET DEFAULT 'rename';
+UPDATE teldrive.agents SET conflict = CASE conflict
+	WHEN 'keep-both' THEN 'rename'
+	WHEN 'client-wins' THEN 'overwrite'
+	WHEN 'last-writer-wins' THEN 'overwrite'
+	WHEN 'server-wins' THEN 'skip'
+	ELSE conflict END;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.replication_states (
+	id int NOT NULL PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+	cursor_at timestamp NOT NULL,
+	cursor_id text NOT NULL,
+	reconciled_at timestamp,
+	updated_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE TABLE IF NOT EXISTS teldrive.replica_channels (
+	user_id bigint NOT NULL PRIMARY KEY REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	channel_id bigint NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS teldrive.replica_copies (
+	file_id text NOT NULL PRIMARY KEY,
+	user_id bigint NOT NULL,
+	source_channel_id bigint NOT NULL,
+	source_parts jsonb NOT NULL,
+	channel_id bigint NOT NULL,
+	parts jsonb NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX IF NOT EXISTS files_updated_at_id_index ON teldrive.files (updated_at, id) WHERE status = 'active';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS teldrive.files_updated_at_id_index;
+DROP TABLE IF EXISTS teldrive.replica_copies;
+DROP TABLE IF EXISTS teldrive.replica_channels;
+DROP TABLE IF EXISTS teldrive.replication_states;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.snapshots (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	folder_id text REFERENCES teldrive.files(id) ON DELETE SET NULL,
+	path text NOT NULL,
+	name text NOT NULL,
+	files bigint NOT NULL DEFAULT 0,
+	size bigint NOT NULL DEFAULT 0,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	UNIQUE (user_id, path, name)
+);
+
+CREATE TABLE IF NOT EXISTS teldrive.snapshot_files (
+	snapshot_id text NOT NULL REFERENCES teldrive.snapshots(id) ON DELETE CASCADE,
+	path text NOT NULL,
+	parent text NOT NULL,
+	name text NOT NULL,
+	type text NOT NULL,
+	mime_type text NOT NULL,
+	size bigint,
+	parts jsonb,
+	channel_id bigint,
+	encrypted bool NOT NULL DEFAULT false,
+	checksum text,
+	updated_at timestamp NOT NULL,
+	PRIMARY KEY (snapshot_id, path)
+);
+CREATE INDEX IF NOT EXISTS snapshot_files_parent_idx ON teldrive.snapshot_files (snapshot_id, parent);
+CREATE INDEX IF NOT EXISTS snapshot_files_channel_id_idx ON teldrive.snapshot_files (channel_id) WHERE parts IS NOT NULL;
+CREATE INDEX IF NOT EXISTS snapshot_files_parts_idx ON teldrive.snapshot_files USING gin (parts jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS files_parts_idx ON teldrive.files USING gin (parts jsonb_path_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS teldrive.files_parts_idx;
+DROP TABLE IF EXISTS teldrive.snapshot_files;
+DROP TABLE IF EXISTS teldrive.snapshots;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS target_id text REFERENCES teldrive.files(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS files_target_id_idx ON teldrive.files (target_id) WHERE target_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS teldrive.files_target_id_idx;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS target_id;
+-- +goose StatementEnd
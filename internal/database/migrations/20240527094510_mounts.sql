@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.mounts (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	channel_id bigint NOT NULL,
+	name text NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	UNIQUE (user_id, channel_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.mounts;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS scan_status text;
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS quarantine_reason text;
+CREATE INDEX IF NOT EXISTS files_scan_pending_idx ON teldrive.files (created_at) WHERE scan_status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS teldrive.files_scan_pending_idx;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS quarantine_reason;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS scan_status;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS dedup_pending boolean NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS files_dedup_pending_idx ON teldrive.files (created_at) WHERE dedup_pending;
+CREATE INDEX IF NOT EXISTS files_checksum_size_idx ON teldrive.files (checksum, size)
+    WHERE checksum IS NOT NULL AND type = 'file' AND status = 'active';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS teldrive.files_checksum_size_idx;
+DROP INDEX IF EXISTS teldrive.files_dedup_pending_idx;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS dedup_pending;
+-- +goose StatementEnd
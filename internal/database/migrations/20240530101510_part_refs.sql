@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+-- counts the files and snapshot entries holding each message, so a message is
+-- only deleted with its last reference
+CREATE TABLE IF NOT EXISTS teldrive.part_refs (
+	channel_id bigint NOT NULL,
+	message_id bigint NOT NULL,
+	refs integer NOT NULL,
+	PRIMARY KEY (channel_id, message_id)
+);
+
+INSERT INTO teldrive.part_refs (channel_id, message_id, refs)
+SELECT channel_id, message_id, count(*) FROM (
+	SELECT DISTINCT f.id AS ref, f.channel_id, (p->>'id')::bigint AS message_id
+	FROM teldrive.files f, jsonb_array_elements(f.parts) p WHERE f.channel_id IS NOT NULL
+	UNION ALL
+	SELECT DISTINCT s.snapshot_id || '/' || s.path, s.channel_id, (p->>'id')::bigint
+	FROM teldrive.snapshot_files s, jsonb_array_elements(s.parts) p WHERE s.channel_id IS NOT NULL
+) r GROUP BY channel_id, message_id
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION teldrive.update_part_refs() RETURNS TRIGGER LANGUAGE PLPGSQL AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.parts IS NOT NULL AND OLD.channel_id IS NOT NULL THEN
+        UPDATE teldrive.part_refs r SET refs = r.refs - 1
+        FROM (SELECT DISTINCT (p->>'id')::bigint AS id FROM jsonb_array_elements(OLD.parts) p) m
+        WHERE r.channel_id = OLD.channel_id AND r.message_id = m.id;
+        DELETE FROM teldrive.part_refs WHERE channel_id = OLD.channel_id AND refs <= 0
+        AND message_id IN (SELECT (p->>'id')::bigint FROM jsonb_array_elements(OLD.parts) p);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.parts IS NOT NULL AND NEW.channel_id IS NOT NULL THEN
+        INSERT INTO teldrive.part_refs (channel_id, message_id, refs)
+        SELECT DISTINCT NEW.channel_id, (p->>'id')::bigint, 1 FROM jsonb_array_elements(NEW.parts) p
+        ON CONFLICT (channel_id, message_id) DO UPDATE SET refs = teldrive.part_refs.refs + 1;
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER files_part_refs AFTER INSERT OR DELETE ON teldrive.files
+FOR EACH ROW EXECUTE FUNCTION teldrive.update_part_refs();
+
+CREATE TRIGGER files_part_refs_update AFTER UPDATE OF parts, channel_id ON teldrive.files
+FOR EACH ROW WHEN (ROW(OLD.parts, OLD.channel_id) IS DISTINCT FROM ROW(NEW.parts, NEW.channel_id))
+EXECUTE FUNCTION teldrive.update_part_refs();
+
+CREATE TRIGGER snapshot_files_part_refs AFTER INSERT OR DELETE ON teldrive.snapshot_files
+FOR EACH ROW EXECUTE FUNCTION teldrive.update_part_refs();
+
+-- held messages are looked up in part_refs now
+DROP INDEX IF EXISTS teldrive.files_parts_idx;
+DROP INDEX IF EXISTS teldrive.snapshot_files_parts_idx;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS snapshot_files_parts_idx ON teldrive.snapshot_files USING gin (parts jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS files_parts_idx ON teldrive.files USING gin (parts jsonb_path_ops);
+DROP TRIGGER IF EXISTS snapshot_files_part_refs ON teldrive.snapshot_files;
+DROP TRIGGER IF EXISTS files_part_refs_update ON teldrive.files;
+DROP TRIGGER IF EXISTS files_part_refs ON teldrive.files;
+DROP FUNCTION IF EXISTS teldrive.update_part_refs;
+DROP TABLE IF EXISTS teldrive.part_refs;
+-- +goose StatementEnd
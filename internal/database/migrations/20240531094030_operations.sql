@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.operations (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	kind text NOT NULL,
+	inverse jsonb NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	undone_at timestamp
+);
+CREATE INDEX IF NOT EXISTS operations_user_id_idx ON teldrive.operations (user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.operations;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS color text;
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS icon text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS icon;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS color;
+-- +goose StatementEnd
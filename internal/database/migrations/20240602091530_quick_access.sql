@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.pins (
+	user_id bigint NOT NULL REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	file_id text NOT NULL REFERENCES teldrive.files(id) ON DELETE CASCADE,
+	position integer NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	PRIMARY KEY (user_id, file_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.pins;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- messages of imported channels belong to their channel, not to teldrive, and
+-- are never deleted with the files pointing at them
+CREATE TABLE IF NOT EXISTS teldrive.imported_parts (
+	channel_id bigint NOT NULL,
+	message_id bigint NOT NULL,
+	PRIMARY KEY (channel_id, message_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.imported_parts;
+-- +goose StatementEnd
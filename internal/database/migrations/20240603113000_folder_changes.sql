@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- long polling listings wait for a notification naming the folder
+CREATE OR REPLACE FUNCTION teldrive.notify_folder_change() RETURNS TRIGGER LANGUAGE PLPGSQL AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' AND OLD.parent_id IS NOT NULL THEN
+        PERFORM pg_notify('folder_changes', OLD.parent_id);
+    END IF;
+    IF TG_OP <> 'DELETE' AND NEW.parent_id IS NOT NULL THEN
+        PERFORM pg_notify('folder_changes', NEW.parent_id);
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER files_folder_changes AFTER INSERT OR UPDATE OR DELETE ON teldrive.files
+FOR EACH ROW EXECUTE FUNCTION teldrive.notify_folder_change();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS files_folder_changes ON teldrive.files;
+DROP FUNCTION IF EXISTS teldrive.notify_folder_change;
+-- +goose StatementEnd
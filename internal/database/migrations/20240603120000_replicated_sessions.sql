@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- replicas only drop the sessions they pulled from their primary, not those
+-- of users logging in to the replica itself
+ALTER TABLE teldrive.sessions ADD COLUMN IF NOT EXISTS replicated boolean NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.sessions DROP COLUMN IF EXISTS replicated;
+-- +goose StatementEnd
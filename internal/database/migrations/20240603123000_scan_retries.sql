@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- failed scans are retried with a backoff counted from the last attempt
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS scan_attempts integer NOT NULL DEFAULT 0;
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS scanned_at timestamp;
+DROP INDEX IF EXISTS teldrive.files_scan_pending_idx;
+CREATE INDEX IF NOT EXISTS files_scan_queue_idx ON teldrive.files (scanned_at NULLS FIRST, created_at)
+WHERE scan_status IN ('pending', 'failed');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS teldrive.files_scan_queue_idx;
+CREATE INDEX IF NOT EXISTS files_scan_pending_idx ON teldrive.files (created_at) WHERE scan_status = 'pending';
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS scanned_at;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS scan_attempts;
+-- +goose StatementEnd
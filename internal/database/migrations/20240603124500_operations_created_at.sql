@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- operations past the undo window are pruned by their age alone
+CREATE INDEX IF NOT EXISTS operations_created_at_idx ON teldrive.operations (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS teldrive.operations_created_at_idx;
+-- +goose StatementEnd
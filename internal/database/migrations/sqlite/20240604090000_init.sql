@@ -0,0 +1,540 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the schema the Postgres migrations up to 20240603124500 build. Every
+-- connection attaches the database file as teldrive, and objects in an attached
+-- database are named by schema while the tables they refer to are not.
+
+CREATE TABLE teldrive.users (
+	user_id bigint NOT NULL PRIMARY KEY,
+	name text,
+	user_name text NOT NULL,
+	is_premium boolean NOT NULL,
+	disabled boolean NOT NULL DEFAULT false,
+	totp_secret text,
+	totp_enabled boolean NOT NULL DEFAULT false,
+	totp_last_step bigint NOT NULL DEFAULT 0,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE teldrive.files (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	name text NOT NULL,
+	type text NOT NULL,
+	mime_type text NOT NULL,
+	path text,
+	size bigint,
+	starred boolean NOT NULL,
+	depth integer,
+	user_id bigint NOT NULL,
+	parent_id text,
+	status text DEFAULT 'active',
+	channel_id bigint,
+	parts blob,
+	encrypted boolean NOT NULL DEFAULT false,
+	category text,
+	checksum text,
+	quick_hash text,
+	verified_at timestamp,
+	integrity_error text,
+	hidden boolean NOT NULL DEFAULT false,
+	deleted_at timestamp,
+	deleted_path text,
+	revision bigint NOT NULL DEFAULT 0,
+	target_id text REFERENCES files(id) ON DELETE CASCADE,
+	scan_status text,
+	quarantine_reason text,
+	scan_attempts integer NOT NULL DEFAULT 0,
+	scanned_at timestamp,
+	dedup_pending boolean NOT NULL DEFAULT false,
+	color text,
+	icon text,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX teldrive.name_idx ON files (name);
+CREATE INDEX teldrive.parent_idx ON files (parent_id);
+CREATE INDEX teldrive.parent_name_idx ON files (parent_id, name DESC);
+CREATE INDEX teldrive.path_idx ON files (path);
+CREATE INDEX teldrive.starred_updated_at_idx ON files (starred, updated_at DESC);
+CREATE INDEX teldrive.status_idx ON files (status);
+CREATE UNIQUE INDEX teldrive.unique_file ON files (name, parent_id, user_id) WHERE status = 'active';
+CREATE INDEX teldrive.user_id_idx ON files (user_id);
+CREATE INDEX teldrive.files_category_type_user_id_index ON files (category, type, user_id);
+CREATE INDEX teldrive.files_user_id_checksum_index ON files (user_id, checksum) WHERE checksum IS NOT NULL;
+CREATE INDEX teldrive.files_user_id_integrity_error_index ON files (user_id) WHERE integrity_error IS NOT NULL;
+CREATE INDEX teldrive.files_user_id_deleted_path_index ON files (user_id, deleted_path) WHERE status = 'pending_deletion';
+CREATE INDEX teldrive.files_created_at_index ON files (created_at) WHERE type = 'file';
+CREATE INDEX teldrive.files_deleted_at_index ON files (deleted_at) WHERE status = 'pending_deletion';
+CREATE INDEX teldrive.files_updated_at_id_index ON files (updated_at, id) WHERE status = 'active';
+CREATE INDEX teldrive.files_target_id_idx ON files (target_id) WHERE target_id IS NOT NULL;
+CREATE INDEX teldrive.files_scan_queue_idx ON files (scanned_at, created_at) WHERE scan_status IN ('pending', 'failed');
+CREATE INDEX teldrive.files_dedup_pending_idx ON files (created_at) WHERE dedup_pending;
+CREATE INDEX teldrive.files_checksum_size_idx ON files (checksum, size)
+WHERE checksum IS NOT NULL AND type = 'file' AND status = 'active';
+
+CREATE TABLE teldrive.uploads (
+	upload_id text NOT NULL,
+	name text NOT NULL,
+	user_id bigint,
+	part_no integer NOT NULL,
+	part_id integer NOT NULL PRIMARY KEY CHECK (part_id > 0),
+	channel_id bigint NOT NULL,
+	size bigint NOT NULL,
+	encrypted boolean NOT NULL DEFAULT false,
+	salt text,
+	mime_type text,
+	created_at timestamp DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE teldrive.channels (
+	channel_id bigint NOT NULL PRIMARY KEY,
+	channel_name text NOT NULL,
+	user_id bigint NOT NULL REFERENCES users(user_id),
+	selected boolean DEFAULT false
+);
+
+CREATE TABLE teldrive.bots (
+	user_id bigint NOT NULL REFERENCES users(user_id),
+	token text NOT NULL,
+	bot_user_name text NOT NULL,
+	bot_id bigint NOT NULL,
+	channel_id bigint,
+	CONSTRAINT btoken_user_channel_un UNIQUE (user_id, token, channel_id)
+);
+
+CREATE TABLE teldrive.sessions (
+	session text NOT NULL,
+	user_id bigint NOT NULL REFERENCES users(user_id),
+	hash text NOT NULL,
+	replicated boolean NOT NULL DEFAULT false,
+	created_at timestamp DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (session, hash)
+);
+
+CREATE TABLE teldrive.jobs (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	user_id bigint NOT NULL,
+	type text NOT NULL,
+	status text NOT NULL,
+	payload blob,
+	result blob,
+	progress bigint NOT NULL DEFAULT 0,
+	total bigint NOT NULL DEFAULT 0,
+	error text,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	finished_at timestamp
+);
+CREATE INDEX teldrive.jobs_user_id_created_at_idx ON jobs (user_id, created_at DESC);
+CREATE INDEX teldrive.jobs_status_idx ON jobs (status);
+
+CREATE TABLE teldrive.logins (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	user_id bigint NOT NULL,
+	ip text NOT NULL,
+	network text NOT NULL,
+	country text,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX teldrive.logins_user_id_idx ON logins (user_id);
+
+CREATE TABLE teldrive.shares (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	file_id text NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+	owner_id bigint NOT NULL,
+	user_id bigint NOT NULL,
+	permission text NOT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT shares_file_id_user_id_key UNIQUE (file_id, user_id)
+);
+CREATE INDEX teldrive.shares_user_id_idx ON shares (user_id);
+
+CREATE TABLE teldrive.orgs (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	name text NOT NULL,
+	owner_id bigint NOT NULL,
+	channel_id bigint NOT NULL,
+	root_id text NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT orgs_owner_id_name_key UNIQUE (owner_id, name)
+);
+CREATE UNIQUE INDEX teldrive.orgs_root_id_idx ON orgs (root_id);
+
+CREATE TABLE teldrive.org_members (
+	org_id text NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+	user_id bigint NOT NULL,
+	role text NOT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (org_id, user_id)
+);
+CREATE INDEX teldrive.org_members_user_id_idx ON org_members (user_id);
+
+CREATE TABLE teldrive.org_audits (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	org_id text NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+	user_id bigint NOT NULL,
+	action text NOT NULL,
+	target text,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX teldrive.org_audits_org_id_created_at_idx ON org_audits (org_id, created_at DESC);
+
+CREATE TABLE teldrive.preferences (
+	user_id bigint PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+	sort text NOT NULL DEFAULT 'name',
+	sort_order text NOT NULL DEFAULT 'asc',
+	page_size integer NOT NULL DEFAULT 500,
+	show_hidden boolean NOT NULL DEFAULT true,
+	date_format text NOT NULL DEFAULT '',
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE teldrive.storage_stats (
+	user_id bigint NOT NULL,
+	day date NOT NULL,
+	category text NOT NULL,
+	added_bytes bigint NOT NULL DEFAULT 0,
+	added_files bigint NOT NULL DEFAULT 0,
+	removed_bytes bigint NOT NULL DEFAULT 0,
+	removed_files bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, day, category)
+);
+
+CREATE TABLE teldrive.stat_rollups (
+	name text PRIMARY KEY,
+	rolled_until timestamp NOT NULL
+);
+
+CREATE TABLE teldrive.cleanup_rules (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	user_id bigint NOT NULL,
+	name text NOT NULL,
+	action text NOT NULL,
+	path text NOT NULL DEFAULT '',
+	days integer NOT NULL,
+	enabled boolean NOT NULL DEFAULT true,
+	last_run_at timestamp,
+	last_count bigint NOT NULL DEFAULT 0,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX teldrive.cleanup_rules_user_id_idx ON cleanup_rules (user_id);
+
+CREATE TABLE teldrive.invites (
+	code text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	created_by bigint NOT NULL,
+	note text NOT NULL DEFAULT '',
+	max_uses integer NOT NULL DEFAULT 1,
+	uses integer NOT NULL DEFAULT 0,
+	expires_at timestamp,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE teldrive.registrations (
+	user_id bigint NOT NULL PRIMARY KEY,
+	name text NOT NULL DEFAULT '',
+	user_name text NOT NULL DEFAULT '',
+	is_premium boolean NOT NULL DEFAULT false,
+	status text NOT NULL DEFAULT 'pending',
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX teldrive.registrations_status_idx ON registrations (status, created_at);
+
+CREATE TABLE teldrive.identities (
+	issuer text NOT NULL,
+	subject text NOT NULL,
+	user_id bigint REFERENCES users(user_id) ON DELETE SET NULL,
+	email text NOT NULL DEFAULT '',
+	name text NOT NULL DEFAULT '',
+	last_login_at timestamp,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX teldrive.identities_user_id_idx ON identities (user_id);
+
+CREATE TABLE teldrive.share_links (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(12)))),
+	file_id text NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+	owner_id bigint NOT NULL,
+	max_downloads integer NOT NULL DEFAULT 0,
+	rate_limit integer NOT NULL DEFAULT 0,
+	expires_at timestamp,
+	downloads bigint NOT NULL DEFAULT 0,
+	bytes_served bigint NOT NULL DEFAULT 0,
+	last_access_at timestamp,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX teldrive.share_links_file_id_idx ON share_links (file_id);
+
+CREATE TABLE teldrive.share_link_visitors (
+	link_id text NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+	ip text NOT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (link_id, ip)
+);
+
+CREATE TABLE teldrive.notification_settings (
+	user_id bigint NOT NULL PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+	share_accessed boolean NOT NULL DEFAULT false,
+	storage_full boolean NOT NULL DEFAULT false,
+	import_finished boolean NOT NULL DEFAULT false,
+	integrity_failed boolean NOT NULL DEFAULT false,
+	storage_limit bigint NOT NULL DEFAULT 0,
+	storage_alerted boolean NOT NULL DEFAULT false,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE teldrive.agents (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+	name text NOT NULL,
+	root text NOT NULL,
+	conflict text NOT NULL DEFAULT 'keep-both',
+	token_hash text NOT NULL UNIQUE,
+	session_hash text NOT NULL,
+	last_seen_at timestamp,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX teldrive.agents_user_id_idx ON agents (user_id);
+
+CREATE TABLE teldrive.agent_conflicts (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	agent_id text NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+	user_id bigint NOT NULL,
+	path text NOT NULL,
+	file_id text REFERENCES files(id) ON DELETE SET NULL,
+	checksum text NOT NULL,
+	size bigint NOT NULL,
+	mod_time timestamp,
+	parts blob,
+	channel_id bigint NOT NULL,
+	encrypted boolean NOT NULL DEFAULT false,
+	policy text NOT NULL,
+	resolution text,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	resolved_at timestamp
+);
+CREATE INDEX teldrive.agent_conflicts_agent_id_idx ON agent_conflicts (agent_id);
+
+CREATE TABLE teldrive.replication_states (
+	id integer NOT NULL PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+	cursor_at timestamp NOT NULL,
+	cursor_id text NOT NULL,
+	reconciled_at timestamp,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE teldrive.replica_channels (
+	user_id bigint NOT NULL PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+	channel_id bigint NOT NULL
+);
+
+CREATE TABLE teldrive.replica_copies (
+	file_id text NOT NULL PRIMARY KEY,
+	user_id bigint NOT NULL,
+	source_channel_id bigint NOT NULL,
+	source_parts blob NOT NULL,
+	channel_id bigint NOT NULL,
+	parts blob NOT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE teldrive.snapshots (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+	folder_id text REFERENCES files(id) ON DELETE SET NULL,
+	path text NOT NULL,
+	name text NOT NULL,
+	files bigint NOT NULL DEFAULT 0,
+	size bigint NOT NULL DEFAULT 0,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, path, name)
+);
+
+CREATE TABLE teldrive.snapshot_files (
+	snapshot_id text NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+	path text NOT NULL,
+	parent text NOT NULL,
+	name text NOT NULL,
+	type text NOT NULL,
+	mime_type text NOT NULL,
+	size bigint,
+	parts blob,
+	channel_id bigint,
+	encrypted boolean NOT NULL DEFAULT false,
+	checksum text,
+	updated_at timestamp NOT NULL,
+	PRIMARY KEY (snapshot_id, path)
+);
+CREATE INDEX teldrive.snapshot_files_parent_idx ON snapshot_files (snapshot_id, parent);
+CREATE INDEX teldrive.snapshot_files_channel_id_idx ON snapshot_files (channel_id) WHERE parts IS NOT NULL;
+
+CREATE TABLE teldrive.mounts (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+	channel_id bigint NOT NULL,
+	name text NOT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, channel_id)
+);
+
+CREATE TABLE teldrive.part_refs (
+	channel_id bigint NOT NULL,
+	message_id bigint NOT NULL,
+	refs integer NOT NULL,
+	PRIMARY KEY (channel_id, message_id)
+);
+
+CREATE TABLE teldrive.imported_parts (
+	channel_id bigint NOT NULL,
+	message_id bigint NOT NULL,
+	PRIMARY KEY (channel_id, message_id)
+);
+
+CREATE TABLE teldrive.operations (
+	id text NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+	user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+	kind text NOT NULL,
+	inverse blob NOT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	undone_at timestamp
+);
+CREATE INDEX teldrive.operations_user_id_idx ON operations (user_id, created_at);
+CREATE INDEX teldrive.operations_created_at_idx ON operations (created_at);
+
+CREATE TABLE teldrive.pins (
+	user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+	file_id text NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+	position integer NOT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, file_id)
+);
+
+-- SQLite triggers cannot change the row being written, so the Postgres
+-- BEFORE triggers become updates of the row once it is written. A trigger
+-- does not fire itself again, which lets files_bump_revision set hidden.
+
+-- bumps the revision on every change a client can make, and hides files
+-- renamed to a dotfile
+CREATE TRIGGER teldrive.files_bump_revision AFTER UPDATE ON files
+WHEN OLD.name IS NOT NEW.name OR OLD.parent_id IS NOT NEW.parent_id OR OLD.parts IS NOT NEW.parts
+	OR OLD.mime_type IS NOT NEW.mime_type OR OLD.starred IS NOT NEW.starred OR OLD.hidden IS NOT NEW.hidden
+	OR OLD.status IS NOT NEW.status
+BEGIN
+	UPDATE files SET revision = NEW.revision + 1,
+		hidden = CASE
+			WHEN OLD.name IS NEW.name THEN NEW.hidden
+			WHEN NEW.name LIKE '.%' THEN true
+			WHEN OLD.name LIKE '.%' THEN false
+			ELSE NEW.hidden
+		END
+	WHERE id = NEW.id;
+END;
+
+-- files_bump_revision counts this update, which leaves the file at revision 0
+CREATE TRIGGER teldrive.files_hide_dotfiles AFTER INSERT ON files
+WHEN NEW.name LIKE '.%' AND NOT NEW.hidden
+BEGIN
+	UPDATE files SET hidden = true, revision = NEW.revision - 1 WHERE id = NEW.id;
+END;
+
+-- remembers where a file was deleted from, as its folder is removed right after
+CREATE TRIGGER teldrive.files_record_deletion AFTER UPDATE OF status ON files
+WHEN (NEW.status = 'pending_deletion' AND OLD.status IS NOT 'pending_deletion') OR NEW.status = 'active'
+BEGIN
+	UPDATE files SET
+		deleted_at = CASE WHEN NEW.status = 'active' THEN NULL ELSE CURRENT_TIMESTAMP END,
+		deleted_path = CASE WHEN NEW.status = 'active' THEN NULL
+			ELSE (SELECT path FROM files WHERE id = NEW.parent_id) END
+	WHERE id = NEW.id;
+END;
+
+-- counts the files and snapshot entries holding each message, so a message is
+-- only deleted with its last reference
+CREATE TRIGGER teldrive.files_part_refs_insert AFTER INSERT ON files
+WHEN NEW.parts IS NOT NULL AND NEW.channel_id IS NOT NULL
+BEGIN
+	INSERT INTO part_refs (channel_id, message_id, refs)
+	SELECT DISTINCT NEW.channel_id, json_extract(p.value, '$.id'), 1
+	FROM json_each(CAST(NEW.parts AS text)) p WHERE p.type = 'object'
+	ON CONFLICT (channel_id, message_id) DO UPDATE SET refs = refs + 1;
+END;
+
+CREATE TRIGGER teldrive.files_part_refs_delete AFTER DELETE ON files
+WHEN OLD.parts IS NOT NULL AND OLD.channel_id IS NOT NULL
+BEGIN
+	UPDATE part_refs SET refs = refs - 1 WHERE channel_id = OLD.channel_id
+	AND message_id IN (SELECT json_extract(value, '$.id') FROM json_each(CAST(OLD.parts AS text)));
+	DELETE FROM part_refs WHERE channel_id = OLD.channel_id AND refs <= 0;
+END;
+
+CREATE TRIGGER teldrive.files_part_refs_update AFTER UPDATE OF parts, channel_id ON files
+WHEN OLD.parts IS NOT NEW.parts OR OLD.channel_id IS NOT NEW.channel_id
+BEGIN
+	UPDATE part_refs SET refs = refs - 1 WHERE OLD.parts IS NOT NULL AND channel_id = OLD.channel_id
+	AND message_id IN (SELECT json_extract(value, '$.id') FROM json_each(CAST(OLD.parts AS text)));
+	DELETE FROM part_refs WHERE channel_id = OLD.channel_id AND refs <= 0;
+	INSERT INTO part_refs (channel_id, message_id, refs)
+	SELECT DISTINCT NEW.channel_id, json_extract(p.value, '$.id'), 1
+	FROM json_each(CAST(NEW.parts AS text)) p WHERE p.type = 'object' AND NEW.channel_id IS NOT NULL
+	ON CONFLICT (channel_id, message_id) DO UPDATE SET refs = refs + 1;
+END;
+
+CREATE TRIGGER teldrive.snapshot_files_part_refs_insert AFTER INSERT ON snapshot_files
+WHEN NEW.parts IS NOT NULL AND NEW.channel_id IS NOT NULL
+BEGIN
+	INSERT INTO part_refs (channel_id, message_id, refs)
+	SELECT DISTINCT NEW.channel_id, json_extract(p.value, '$.id'), 1
+	FROM json_each(CAST(NEW.parts AS text)) p WHERE p.type = 'object'
+	ON CONFLICT (channel_id, message_id) DO UPDATE SET refs = refs + 1;
+END;
+
+CREATE TRIGGER teldrive.snapshot_files_part_refs_delete AFTER DELETE ON snapshot_files
+WHEN OLD.parts IS NOT NULL AND OLD.channel_id IS NOT NULL
+BEGIN
+	UPDATE part_refs SET refs = refs - 1 WHERE channel_id = OLD.channel_id
+	AND message_id IN (SELECT json_extract(value, '$.id') FROM json_each(CAST(OLD.parts AS text)));
+	DELETE FROM part_refs WHERE channel_id = OLD.channel_id AND refs <= 0;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.pins;
+DROP TABLE IF EXISTS teldrive.operations;
+DROP TABLE IF EXISTS teldrive.imported_parts;
+DROP TABLE IF EXISTS teldrive.part_refs;
+DROP TABLE IF EXISTS teldrive.mounts;
+DROP TABLE IF EXISTS teldrive.snapshot_files;
+DROP TABLE IF EXISTS teldrive.snapshots;
+DROP TABLE IF EXISTS teldrive.replica_copies;
+DROP TABLE IF EXISTS teldrive.replica_channels;
+DROP TABLE IF EXISTS teldrive.replication_states;
+DROP TABLE IF EXISTS teldrive.agent_conflicts;
+DROP TABLE IF EXISTS teldrive.agents;
+DROP TABLE IF EXISTS teldrive.notification_settings;
+DROP TABLE IF EXISTS teldrive.share_link_visitors;
+DROP TABLE IF EXISTS teldrive.share_links;
+DROP TABLE IF EXISTS teldrive.identities;
+DROP TABLE IF EXISTS teldrive.registrations;
+DROP TABLE IF EXISTS teldrive.invites;
+DROP TABLE IF EXISTS teldrive.cleanup_rules;
+DROP TABLE IF EXISTS teldrive.stat_rollups;
+DROP TABLE IF EXISTS teldrive.storage_stats;
+DROP TABLE IF EXISTS teldrive.preferences;
+DROP TABLE IF EXISTS teldrive.org_audits;
+DROP TABLE IF EXISTS teldrive.org_members;
+DROP TABLE IF EXISTS teldrive.orgs;
+DROP TABLE IF EXISTS teldrive.shares;
+DROP TABLE IF EXISTS teldrive.logins;
+DROP TABLE IF EXISTS teldrive.jobs;
+DROP TABLE IF EXISTS teldrive.sessions;
+DROP TABLE IF EXISTS teldrive.bots;
+DROP TABLE IF EXISTS teldrive.channels;
+DROP TABLE IF EXISTS teldrive.uploads;
+DROP TABLE IF EXISTS teldrive.files;
+DROP TABLE IF EXISTS teldrive.users;
+-- +goose StatementEnd
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/jackc/pgx/v5/pgtype"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnsupportedDialect = errors.New("database dialect not supported")
+
+// Procedures implements the file tree operations that Postgres runs as stored
+// procedures. Every method takes the handle to run on, which may carry a
+// context or be a transaction.
+type Procedures interface {
+	// CreateDirectories creates path and its missing parents and returns the
+	// folder at path first.
+	CreateDirectories(db *gorm.DB, userId int64, path string) ([]models.File, error)
+	// UpdateFolder renames a folder, rewriting the path of everything below it.
+	UpdateFolder(db *gorm.DB, id, name string, userId int64) ([]models.File, error)
+	MoveItems(db *gorm.DB, ids []string, destination string, userId int64) error
+	MoveDirectory(db *gorm.DB, source, destination string, userId int64) error
+	// DeleteFiles marks files and the contents of folders for deletion.
+	DeleteFiles(db *gorm.DB, ids []string) error
+	// UpdateFolderSizes recomputes the size of every folder.
+	UpdateFolderSizes(db *gorm.DB) error
+	// SearchName returns a condition matching file names against search.
+	SearchName(search string) clause.Expression
+}
+
+var (
+	proceduresMu sync.RWMutex
+	procedures   = map[string]Procedures{"postgres": postgresProcedures{}, "sqlite": sqliteProcedures{}}
+)
+
+// RegisterProcedures makes p the implementation used for databases opened
+// with the named gorm dialector.
+func RegisterProcedures(dialect string, p Procedures) {
+	proceduresMu.Lock()
+	defer proceduresMu.Unlock()
+	procedures[dialect] = p
+}
+
+// Procs returns the implementation matching the dialector of db. Databases
+// without one get an implementation failing with ErrUnsupportedDialect.
+func Procs(db *gorm.DB) Procedures {
+	name := db.Dialector.Name()
+	proceduresMu.RLock()
+	defer proceduresMu.RUnlock()
+	if p, ok := procedures[name]; ok {
+		return p
+	}
+	return unsupportedProcedures{dialect: name}
+}
+
+type postgresProcedures struct{}
+
+func (postgresProcedures) CreateDirectories(db *gorm.DB, userId int64, path string) ([]models.File, error) {
+	var files []models.File
+	err := db.Raw("select * from teldrive.create_directories(?, ?)", userId, path).Scan(&files).Error
+	return files, err
+}
+
+func (postgresProcedures) UpdateFolder(db *gorm.DB, id, name string, userId int64) ([]models.File, error) {
+	var files []models.File
+	err := db.Raw("select * from teldrive.update_folder(?, ?, ?)", id, name, userId).Scan(&files).Error
+	return files, err
+}
+
+func (postgresProcedures) MoveItems(db *gorm.DB, ids []string, destination string, userId int64) error {
+	items := pgtype.Array[string]{
+		Elements: ids,
+		Valid:    true,
+		Dims:     []pgtype.ArrayDimension{{Length: int32(len(ids)), LowerBound: 1}},
+	}
+	return db.Exec("select * from teldrive.move_items(? , ? , ?)", items, destination, userId).Error
+}
+
+func (postgresProcedures) MoveDirectory(db *gorm.DB, source, destination string, userId int64) error {
+	return db.Exec("select * from teldrive.move_directory(? , ? , ?)", source, destination, userId).Error
+}
+
+func (postgresProcedures) DeleteFiles(db *gorm.DB, ids []string) error {
+	return db.Exec("call teldrive.delete_files($1)", ids).Error
+}
+
+func (postgresProcedures) UpdateFolderSizes(db *gorm.DB) error {
+	return db.Exec("call teldrive.update_size();").Error
+}
+
+func (postgresProcedures) SearchName(search string) clause.Expression {
+	return clause.Expr{SQL: "teldrive.get_tsquery(?) @@ teldrive.get_tsvector(name)", Vars: []interface{}{search}}
+}
+
+type unsupportedProcedures struct {
+	dialect string
+}
+
+func (p unsupportedProcedures) err() error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedDialect, p.dialect)
+}
+
+func (p unsupportedProcedures) CreateDirectories(*gorm.DB, int64, string) ([]models.File, error) {
+	return nil, p.err()
+}
+
+func (p unsupportedProcedures) UpdateFolder(*gorm.DB, string, string, int64) ([]models.File, error) {
+	return nil, p.err()
+}
+
+func (p unsupportedProcedures) MoveItems(*gorm.DB, []string, string, int64) error {
+	return p.err()
+}
+
+func (p unsupportedProcedures) MoveDirectory(*gorm.DB, string, string, int64) error {
+	return p.err()
+}
+
+func (p unsupportedProcedures) DeleteFiles(*gorm.DB, []string) error {
+	return p.err()
+}
+
+func (p unsupportedProcedures) UpdateFolderSizes(*gorm.DB) error {
+	return p.err()
+}
+
+// SearchName falls back to a plain substring match.
+func (unsupportedProcedures) SearchName(search string) clause.Expression {
+	return clause.Expr{SQL: `name LIKE ? ESCAPE '\'`, Vars: []interface{}{"%" + EscapeLike(search) + "%"}}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// EscapeLike escapes the wildcards of s for a LIKE pattern using '\' as its
+// escape character.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+	"modernc.org/sqlite"
+)
+
+const sqlitePrefix = "sqlite:"
+
+// sqliteOptions are applied to the in-memory main database of every
+// connection. Times are written in the format the SQLite date functions read,
+// and write transactions take their lock up front instead of failing with
+// SQLITE_BUSY when they upgrade a read.
+const sqliteOptions = "?_time_format=sqlite&_txlock=immediate&_pragma=foreign_keys(1)&_pragma=busy_timeout(10000)"
+
+// sqlitePath returns the file of a data source such as sqlite:/var/lib/teldrive.db.
+func sqlitePath(dsn string) (string, bool) {
+	path, ok := strings.CutPrefix(dsn, sqlitePrefix)
+	return strings.TrimPrefix(path, "//"), ok
+}
+
+// sqliteConnector opens connections to an in-memory database with the
+// database file attached as teldrive, so the tables are found under the same
+// schema qualified names as on Postgres.
+type sqliteConnector struct {
+	path string
+}
+
+func (c sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(":memory:" + sqliteOptions)
+	if err != nil {
+		return nil, err
+	}
+	exec := conn.(driver.ExecerContext)
+	for _, stmt := range []struct {
+		sql  string
+		args []driver.NamedValue
+	}{
+		{"ATTACH DATABASE ? AS teldrive", []driver.NamedValue{{Ordinal: 1, Value: c.path}}},
+		{"PRAGMA teldrive.journal_mode = WAL", nil},
+	} {
+		if _, err := exec.ExecContext(ctx, stmt.sql, stmt.args); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("sqlite %s: %w", c.path, err)
+		}
+	}
+	return conn, nil
+}
+
+func (sqliteConnector) Driver() driver.Driver {
+	return &sqlite.Driver{}
+}
+
+func openSQLite(path string) *sql.DB {
+	return sql.OpenDB(sqliteConnector{path: path})
+}
+
+// sqliteDialector is a gorm dialector for databases opened by openSQLite.
+type sqliteDialector struct {
+	conn gorm.ConnPool
+}
+
+func (sqliteDialector) Name() string {
+	return "sqlite"
+}
+
+func (d sqliteDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{
+		CreateClauses: []string{"INSERT", "VALUES", "ON CONFLICT", "RETURNING"},
+		UpdateClauses: []string{"UPDATE", "SET", "FROM", "WHERE", "RETURNING"},
+		DeleteClauses: []string{"DELETE", "FROM", "WHERE", "RETURNING"},
+	})
+	db.ConnPool = d.conn
+	// SQLite only takes an offset after a limit
+	db.ClauseBuilders["LIMIT"] = func(c clause.Clause, builder clause.Builder) {
+		if limit, ok := c.Expression.(clause.Limit); ok && (limit.Limit == nil || *limit.Limit < 0) && limit.Offset > 0 {
+			builder.WriteString("LIMIT -1 ")
+		}
+		c.Build(builder)
+	}
+	return nil
+}
+
+func (d sqliteDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return migrator.Migrator{Config: migrator.Config{
+		DB:                          db,
+		Dialector:                   d,
+		CreateIndexAfterCreateTable: true,
+	}}
+}
+
+func (sqliteDialector) DataTypeOf(field *schema.Field) string {
+	switch field.DataType {
+	case schema.Bool:
+		return "boolean"
+	case schema.Int, schema.Uint:
+		return "integer"
+	case schema.Float:
+		return "real"
+	case schema.String:
+		return "text"
+	case schema.Time:
+		return "timestamp"
+	case schema.Bytes:
+		return "blob"
+	default:
+		return string(field.DataType)
+	}
+}
+
+// DefaultValueOf is used for fields left out of a batch insert. SQLite has no
+// DEFAULT keyword in VALUES, so they are set to NULL.
+func (sqliteDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "NULL"}
+}
+
+func (sqliteDialector) BindVarTo(writer clause.Writer, _ *gorm.Statement, _ interface{}) {
+	writer.WriteByte('?')
+}
+
+// QuoteTo quotes every part of a dotted name, as in "teldrive"."files".
+func (sqliteDialector) QuoteTo(writer clause.Writer, str string) {
+	for i, part := range strings.Split(str, ".") {
+		if i > 0 {
+			writer.WriteByte('.')
+		}
+		part = strings.Trim(part, `"`)
+		writer.WriteByte('"')
+		writer.WriteString(strings.ReplaceAll(part, `"`, `""`))
+		writer.WriteByte('"')
+	}
+}
+
+func (sqliteDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, `'`, vars...)
+}
+
+func (sqliteDialector) SavePoint(tx *gorm.DB, name string) error {
+	return tx.Exec("SAVEPOINT " + name).Error
+}
+
+func (sqliteDialector) RollbackTo(tx *gorm.DB, name string) error {
+	return tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error
+}
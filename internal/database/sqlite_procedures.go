@@ -0,0 +1,245 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sqliteProcedures runs the Postgres procedures as statements from Go, as
+// SQLite has no stored procedures. Each method runs in a transaction, or a
+// savepoint when db already is one.
+type sqliteProcedures struct{}
+
+func (p sqliteProcedures) CreateDirectories(db *gorm.DB, userId int64, path string) ([]models.File, error) {
+	var files []models.File
+	err := db.Transaction(func(tx *gorm.DB) error {
+		id, err := p.createDirectories(tx, userId, path)
+		if err != nil {
+			return err
+		}
+		return tx.Raw("select * from teldrive.files where id = ?", id).Scan(&files).Error
+	})
+	return files, err
+}
+
+// createDirectories returns the id of the folder at path.
+func (sqliteProcedures) createDirectories(tx *gorm.DB, userId int64, path string) (string, error) {
+	var current string
+	if err := tx.Raw("select id from teldrive.files where parent_id = 'root' and user_id = ?", userId).
+		Scan(&current).Error; err != nil {
+		return "", err
+	}
+
+	pathSoFar := ""
+	depth := 0
+	for _, name := range strings.Split(strings.TrimLeft(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		pathSoFar += "/" + name
+		depth++
+
+		var next string
+		if err := tx.Raw("select id from teldrive.files where parent_id = ? and name = ? and user_id = ?",
+			current, name, userId).Scan(&next).Error; err != nil {
+			return "", err
+		}
+		if next == "" {
+			if err := tx.Raw(`insert into teldrive.files (name, type, mime_type, parent_id, user_id, starred, depth, path)
+				values (?, 'folder', 'drive/folder', ?, ?, false, ?, ?) returning id`,
+				name, current, userId, depth, pathSoFar).Scan(&next).Error; err != nil {
+				return "", err
+			}
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func (p sqliteProcedures) UpdateFolder(db *gorm.DB, id, name string, userId int64) ([]models.File, error) {
+	var files []models.File
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := p.updateFolder(tx, id, name, userId); err != nil {
+			return err
+		}
+		return tx.Raw("select * from teldrive.files where id = ?", id).Scan(&files).Error
+	})
+	return files, err
+}
+
+func (sqliteProcedures) updateFolder(tx *gorm.DB, id, name string, userId int64) error {
+	var oldPath string
+	if err := tx.Raw("select path from teldrive.files where id = ? and user_id = ?", id, userId).
+		Scan(&oldPath).Error; err != nil || oldPath == "" {
+		return err
+	}
+	newPath := oldPath[:strings.LastIndex(oldPath, "/")] + "/" + name
+
+	if err := tx.Exec("update teldrive.files set path = ?, name = ? where id = ? and user_id = ?",
+		newPath, name, id, userId).Error; err != nil {
+		return err
+	}
+	return rebasePaths(tx, oldPath, newPath, userId)
+}
+
+// rebasePaths moves the paths of the folders below oldPath under newPath.
+func rebasePaths(tx *gorm.DB, oldPath, newPath string, userId int64) error {
+	return tx.Exec(`update teldrive.files set path = ? || substr(path, length(?) + 1)
+		where type = 'folder' and user_id = ? and substr(path, 1, length(?) + 1) = ? || '/'`,
+		newPath, oldPath, userId, oldPath, oldPath).Error
+}
+
+func (p sqliteProcedures) MoveItems(db *gorm.DB, ids []string, destination string, userId int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var destId string
+		if err := tx.Raw("select id from teldrive.files where path = ? and user_id = ?", destination, userId).
+			Scan(&destId).Error; err != nil {
+			return err
+		}
+		if destId == "" {
+			var err error
+			if destId, err = p.createDirectories(tx, userId, destination); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("update teldrive.files set parent_id = ? where id in ?", destId, ids).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`with recursive folders as (
+				select id, case when ? = '/' then '/' || name else ? || '/' || name end as new_path
+				from teldrive.files where id in ? and type = 'folder' and user_id = ?
+				union all
+				select f.id, case when fo.new_path = '/' then '/' || f.name else fo.new_path || '/' || f.name end
+				from teldrive.files f inner join folders fo on f.parent_id = fo.id where f.type = 'folder'
+			)
+			update teldrive.files as f set path = folders.new_path from folders where f.id = folders.id`,
+			destination, destination, ids, userId).Error
+	})
+}
+
+func (p sqliteProcedures) MoveDirectory(db *gorm.DB, source, destination string, userId int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var srcId, destId string
+		if err := tx.Raw("select id from teldrive.files where path = ? and user_id = ?", source, userId).
+			Scan(&srcId).Error; err != nil {
+			return err
+		}
+		if err := tx.Raw("select id from teldrive.files where path = ? and user_id = ?", destination, userId).
+			Scan(&destId).Error; err != nil {
+			return err
+		}
+		if srcId == "" {
+			return errors.New("source directory not found")
+		}
+		if destId != "" {
+			return errors.New("destination directory exists")
+		}
+
+		srcParent, srcBase := splitPath(source)
+		destParent, destBase := splitPath(destination)
+
+		if srcParent != destParent {
+			destId, err := p.createDirectories(tx, userId, destination)
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec("update teldrive.files set parent_id = ? where parent_id = ?", destId, srcId).
+				Error; err != nil {
+				return err
+			}
+			if err := rebasePaths(tx, source, destination, userId); err != nil {
+				return err
+			}
+			if err := tx.Exec("delete from teldrive.files where id = ?", srcId).Error; err != nil {
+				return err
+			}
+		}
+
+		if srcBase != destBase && srcParent == destParent {
+			return p.updateFolder(tx, srcId, destBase, userId)
+		}
+		return nil
+	})
+}
+
+// splitPath splits path into its parent folder and base name the way
+// teldrive.split_path does.
+func splitPath(path string) (parent, base string) {
+	if path == "/" {
+		return "/", ""
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	path = strings.TrimSuffix(path, "/")
+	i := strings.LastIndex(path, "/")
+	return path[:i], path[i+1:]
+}
+
+func (sqliteProcedures) DeleteFiles(db *gorm.DB, ids []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var folders []string
+		if err := tx.Raw(`with recursive tree as (
+				select id from teldrive.files where id in ? and type = 'folder'
+				union
+				select f.id from teldrive.files f inner join tree t on f.parent_id = t.id where f.type = 'folder'
+			)
+			select id from tree`, ids).Scan(&folders).Error; err != nil {
+			return err
+		}
+
+		// files are marked before their folders go, so the trash still finds
+		// the path they were deleted from
+		if err := tx.Exec(`update teldrive.files set status = 'pending_deletion'
+			where type != 'folder' and (id in ? or parent_id in ?)`, ids, folders).Error; err != nil {
+			return err
+		}
+		if len(folders) == 0 {
+			return nil
+		}
+		return tx.Exec("delete from teldrive.files where id in ?", folders).Error
+	})
+}
+
+// UpdateFolderSizes sums the folders of each depth in turn, deepest first, so
+// every folder adds up the sizes of its subfolders computed before it.
+func (sqliteProcedures) UpdateFolderSizes(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var depths []*int
+		if err := tx.Raw(`select distinct depth from teldrive.files where type = 'folder'
+			order by depth desc nulls first`).Scan(&depths).Error; err != nil {
+			return err
+		}
+		for _, depth := range depths {
+			if err := tx.Exec(`update teldrive.files as f
+				set size = (select sum(c.size) from teldrive.files c where c.parent_id = f.id)
+				where f.type = 'folder' and f.depth is ?`, depth).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SearchName matches names holding every word of search, ignoring case. Like
+// the Postgres search, anything other than letters and digits separates words.
+func (sqliteProcedures) SearchName(search string) clause.Expression {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		return r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return unsupportedProcedures{}.SearchName(search)
+	}
+	exprs := make([]clause.Expression, 0, len(words))
+	for _, word := range words {
+		exprs = append(exprs, clause.Expr{SQL: "name LIKE ?", Vars: []interface{}{"%" + word + "%"}})
+	}
+	return clause.And(exprs...)
+}
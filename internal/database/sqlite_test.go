@@ -0,0 +1,224 @@
+package database
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+func newSQLiteDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := sqlitePrefix + filepath.Join(t.TempDir(), "teldrive.db")
+
+	migrations, err := OpenMigrations(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrations.Close()
+	if err := migrateDB(migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	dialect, err := dialector(dsn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(dialect, &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{TablePrefix: "teldrive."},
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.Exec("insert into teldrive.users (user_id, user_name, is_premium) values (1, 'user', false)").
+		Error; err != nil {
+		t.Fatal(err)
+	}
+	root := models.File{Name: "root", Type: "folder", MimeType: "drive/folder", Path: "/", UserID: 1,
+		ParentID: "root", Status: "active", Depth: new(int)}
+	if err := db.Create(&root).Error; err != nil {
+		t.Fatal(err)
+	}
+	if root.ID == "" {
+		t.Fatal("root folder created without an id")
+	}
+	return db
+}
+
+func paths(t *testing.T, db *gorm.DB) map[string]string {
+	t.Helper()
+	var files []models.File
+	if err := db.Where("status = ?", "active").Find(&files).Error; err != nil {
+		t.Fatal(err)
+	}
+	res := make(map[string]string, len(files))
+	for _, f := range files {
+		if f.Type == "folder" {
+			res[f.Path] = f.ID
+		}
+	}
+	return res
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSQLiteProcedures(t *testing.T) {
+	db := newSQLiteDB(t)
+	procs := Procs(db)
+
+	files, err := procs.CreateDirectories(db, 1, "/a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "/a/b/c" || *files[0].Depth != 3 {
+		t.Fatalf("CreateDirectories returned %+v", files)
+	}
+	again, err := procs.CreateDirectories(db, 1, "/a/b/c")
+	if err != nil || len(again) != 1 || again[0].ID != files[0].ID {
+		t.Fatalf("CreateDirectories of an existing path returned %+v, %v", again, err)
+	}
+
+	folders := paths(t, db)
+	if _, err := procs.UpdateFolder(db, folders["/a"], "x", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedKeys(paths(t, db)); !equal(got, []string{"/", "/x", "/x/b", "/x/b/c"}) {
+		t.Fatalf("paths after rename: %v", got)
+	}
+
+	if _, err := procs.CreateDirectories(db, 1, "/d"); err != nil {
+		t.Fatal(err)
+	}
+	folders = paths(t, db)
+	if err := procs.MoveItems(db, []string{folders["/x/b"]}, "/d", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedKeys(paths(t, db)); !equal(got, []string{"/", "/d", "/d/b", "/d/b/c", "/x"}) {
+		t.Fatalf("paths after move: %v", got)
+	}
+
+	if err := procs.MoveDirectory(db, "/d", "/e/f", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedKeys(paths(t, db)); !equal(got, []string{"/", "/e", "/e/f", "/e/f/b", "/e/f/b/c", "/x"}) {
+		t.Fatalf("paths after moving a directory: %v", got)
+	}
+	if err := procs.MoveDirectory(db, "/e/f", "/x", 1); err == nil {
+		t.Fatal("moved a directory onto an existing one")
+	}
+
+	folders = paths(t, db)
+	size := int64(10)
+	file := models.File{Name: "file.txt", Type: "file", MimeType: "text/plain", UserID: 1, Size: &size,
+		ParentID: folders["/e/f/b/c"], Status: "active"}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := procs.UpdateFolderSizes(db); err != nil {
+		t.Fatal(err)
+	}
+	var e models.File
+	if err := db.Where("id = ?", folders["/e"]).First(&e).Error; err != nil {
+		t.Fatal(err)
+	}
+	if e.Size == nil || *e.Size != size {
+		t.Fatalf("size of /e is %v, want %d", e.Size, size)
+	}
+
+	var found []models.File
+	if err := db.Where(procs.SearchName("FILE txt")).Find(&found).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != file.ID {
+		t.Fatalf("search found %+v", found)
+	}
+
+	if err := procs.DeleteFiles(db, []string{folders["/e/f"]}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedKeys(paths(t, db)); !equal(got, []string{"/", "/e", "/x"}) {
+		t.Fatalf("paths after delete: %v", got)
+	}
+	if err := db.Where("id = ?", file.ID).First(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if file.Status != "pending_deletion" || file.DeletedPath == nil || *file.DeletedPath != "/e/f/b/c" {
+		t.Fatalf("deleted file has status %q and path %v", file.Status, file.DeletedPath)
+	}
+}
+
+func TestSQLiteTriggers(t *testing.T) {
+	db := newSQLiteDB(t)
+
+	channel := int64(5)
+	parts := models.Parts{{ID: 1}, {ID: 2}}
+	file := models.File{Name: ".env", Type: "file", MimeType: "text/plain", UserID: 1, ParentID: "p",
+		Status: "active", ChannelID: &channel, Parts: &parts}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("id = ?", file.ID).First(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !file.Hidden || file.Revision != 0 {
+		t.Fatalf("new dotfile has hidden %v and revision %d", file.Hidden, file.Revision)
+	}
+
+	if err := db.Model(&file).Update("name", "env").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("id = ?", file.ID).First(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if file.Hidden || file.Revision != 1 {
+		t.Fatalf("renamed file has hidden %v and revision %d", file.Hidden, file.Revision)
+	}
+
+	var refs int64
+	if err := db.Raw("select count(*) from teldrive.part_refs where channel_id = ?", channel).Scan(&refs).
+		Error; err != nil {
+		t.Fatal(err)
+	}
+	if refs != 2 {
+		t.Fatalf("%d part refs, want 2", refs)
+	}
+	if err := db.Exec("delete from teldrive.files where id = ?", file.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Raw("select count(*) from teldrive.part_refs").Scan(&refs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if refs != 0 {
+		t.Fatalf("%d part refs left after delete", refs)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
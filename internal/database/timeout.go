@@ -0,0 +1,40 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dialector connects to dsn, with every statement bounded by timeout on the
+// server when it is positive. Postgres enforces statement_timeout itself, so
+// it also covers the rows of raw queries read after the ORM returned them.
+// SQLite has no such setting, so timeout is ignored for its data sources.
+func dialector(dsn string, timeout time.Duration) (gorm.Dialector, error) {
+	if path, ok := sqlitePath(dsn); ok {
+		return sqliteDialector{conn: openSQLite(path)}, nil
+	}
+	if timeout <= 0 {
+		return postgres.Open(dsn), nil
+	}
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.RuntimeParams["statement_timeout"] = strconv.FormatInt(timeout.Milliseconds(), 10)
+	return postgres.New(postgres.Config{Conn: stdlib.OpenDB(*cfg)}), nil
+}
+
+// OpenMigrations connects to dsn without a statement timeout, as migrations
+// can rewrite large tables.
+func OpenMigrations(dsn string) (*sql.DB, error) {
+	if path, ok := sqlitePath(dsn); ok {
+		return openSQLite(path), nil
+	}
+	return sql.Open("pgx", dsn)
+}
@@ -0,0 +1,162 @@
+package diskcache
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/md5"
+	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/mitchellh/go-homedir"
+)
+
+var ErrNotFound = errors.New("cache entry not found")
+
+// Cache stores entries as files below dir. Once they take more than maxSize
+// bytes, the least recently opened ones are evicted.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	size int64
+}
+
+func New(dir string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &Cache{dir: dir, maxSize: maxSize}
+	for _, e := range c.entries() {
+		c.size += e.size
+	}
+	return c, nil
+}
+
+func NewDiskCache(cnf *config.Config) (*Cache, error) {
+	dir := cnf.Cache.Dir
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			home = utils.ExecutableDir()
+		}
+		dir = filepath.Join(home, ".teldrive", "cache")
+	}
+	return New(dir, cnf.Cache.MaxSize<<20)
+}
+
+func (c *Cache) path(namespace, key string) string {
+	hash := md5.FromString(key)
+	return filepath.Join(c.dir, namespace, hash[:2], hash)
+}
+
+// Open returns the cached entry for key. Callers must close the file.
+func (c *Cache) Open(namespace, key string) (*os.File, error) {
+	path := c.path(namespace, key)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err == nil {
+		// the modification time orders entries for eviction
+		now := time.Now()
+		os.Chtimes(path, now, now)
+	}
+	return f, err
+}
+
+// Write stores data for key. The entry becomes visible atomically so readers
+// never observe a partially written file.
+func (c *Cache) Write(namespace, key string, data []byte) error {
+	path := c.path(namespace, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	c.grow(int64(len(data)))
+	return nil
+}
+
+type entry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *Cache) entries() []entry {
+	var res []entry
+	filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			res = append(res, entry{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	return res
+}
+
+// grow accounts for n written bytes and evicts the oldest entries down to 90%
+// of the bound once it is crossed.
+func (c *Cache) grow(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += n
+	if c.maxSize <= 0 || c.size <= c.maxSize {
+		return
+	}
+	entries := c.entries()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	c.size = 0
+	for _, e := range entries {
+		c.size += e.size
+	}
+	for _, e := range entries {
+		if c.size <= c.maxSize/10*9 {
+			break
+		}
+		if os.Remove(e.path) == nil {
+			c.size -= e.size
+		}
+	}
+}
+
+func (c *Cache) Delete(namespace, key string) error {
+	err := os.Remove(c.path(namespace, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Check verifies the cache directory is still writable.
+func (c *Cache) Check() error {
+	tmp, err := os.CreateTemp(c.dir, ".check-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
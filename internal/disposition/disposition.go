@@ -0,0 +1,64 @@
+// Package disposition builds Content-Disposition headers following RFC 6266.
+//
+// Names that are not plain printable ASCII are sent twice: as a quoted
+// filename with the offending characters replaced for old clients, and as an
+// RFC 5987 encoded filename* that modern browsers prefer.
+package disposition
+
+import (
+	"strings"
+)
+
+const (
+	Inline     = "inline"
+	Attachment = "attachment"
+)
+
+// Format returns the header value for disposition and filename.
+func Format(disposition, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+	fallback := asciiName(filename)
+	value := disposition + `; filename="` + fallback + `"`
+	if fallback != filename {
+		value += "; filename*=UTF-8''" + encode(filename)
+	}
+	return value
+}
+
+// asciiName replaces everything that cannot appear in a quoted ASCII filename
+// with an underscore.
+func asciiName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// encode percent-encodes name as an RFC 5987 value-chars sequence.
+func encode(name string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if isAttrChar(c) {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hex[c>>4])
+		sb.WriteByte(hex[c&0xf])
+	}
+	return sb.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
@@ -0,0 +1,33 @@
+package disposition
+
+import (
+	"mime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		disposition, name, want string
+	}{
+		{Inline, "", "inline"},
+		{Inline, "report.pdf", `inline; filename="report.pdf"`},
+		{Attachment, "my file.txt", `attachment; filename="my file.txt"`},
+		{Attachment, "résumé.pdf", `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+		{Attachment, `a"b\c.txt`, `attachment; filename="a_b_c.txt"; filename*=UTF-8''a%22b%5Cc.txt`},
+		{Inline, "日本.mp4", `inline; filename="__.mp4"; filename*=UTF-8''%E6%97%A5%E6%9C%AC.mp4`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Format(tt.disposition, tt.name), tt.name)
+	}
+}
+
+func TestFormatParses(t *testing.T) {
+	for _, name := range []string{"plain.txt", "résumé.pdf", `quo"te.txt`, "日本 語.mkv"} {
+		disposition, params, err := mime.ParseMediaType(Format(Attachment, name))
+		assert.NoError(t, err)
+		assert.Equal(t, Attachment, disposition)
+		assert.Equal(t, name, params["filename"])
+	}
+}
@@ -0,0 +1,235 @@
+// Package faststart serves an MP4 whose moov box follows its media data as if
+// the moov came first, so browsers can start playing it without fetching the
+// tail. The output has the size of the input: the moov is moved ahead of the
+// first mdat and the chunk offsets it holds are shifted by its size.
+package faststart
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	// ErrNotNeeded is returned for files whose moov already comes first.
+	ErrNotNeeded = errors.New("moov already precedes the media data")
+	// ErrUnsupported is returned for files that are not MP4s that can be
+	// rearranged, like fragmented ones or those with a compressed moov.
+	ErrUnsupported = errors.New("file cannot be served as faststart")
+)
+
+// MaxMoovSize is the largest moov Plan reads into memory.
+const MaxMoovSize = 32 * 1024 * 1024
+
+// maxBoxes bounds how many top level boxes Plan walks to find moov.
+const maxBoxes = 64
+
+// ReadAtFunc reads n bytes of the input at off.
+type ReadAtFunc func(off, n int64) ([]byte, error)
+
+// Segment is a part of the output. It holds Data, or else stands for the
+// input bytes from Start to End inclusive.
+type Segment struct {
+	Data       []byte
+	Start, End int64
+}
+
+func (s Segment) len() int64 {
+	if s.Data != nil {
+		return int64(len(s.Data))
+	}
+	return s.End - s.Start + 1
+}
+
+// Layout is the output as a sequence of segments.
+type Layout struct {
+	Segments []Segment
+}
+
+type box struct {
+	typ        string
+	start, end int64
+}
+
+// Plan lays out the input of size bytes with its moov first.
+func Plan(size int64, readAt ReadAtFunc) (*Layout, error) {
+	var mdat, moov *box
+	for off, n := int64(0), 0; off < size && (mdat == nil || moov == nil); n++ {
+		if n == maxBoxes {
+			return nil, ErrUnsupported
+		}
+		b, err := readBox(off, size, readAt)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case n == 0 && b.typ != "ftyp":
+			return nil, ErrUnsupported
+		case b.typ == "moof":
+			return nil, ErrUnsupported
+		case b.typ == "mdat" && mdat == nil:
+			mdat = b
+		case b.typ == "moov":
+			if mdat == nil {
+				return nil, ErrNotNeeded
+			}
+			moov = b
+		}
+		off = b.end
+	}
+	if mdat == nil || moov == nil {
+		return nil, ErrUnsupported
+	}
+	if moov.end-moov.start > MaxMoovSize {
+		return nil, ErrUnsupported
+	}
+
+	data, err := readAt(moov.start, moov.end-moov.start)
+	if err != nil {
+		return nil, err
+	}
+	data = append([]byte(nil), data...)
+	if err := shift(data[8:], mdat.start, moov.start, moov.end-moov.start); err != nil {
+		return nil, err
+	}
+
+	l := &Layout{}
+	if mdat.start > 0 {
+		l.Segments = append(l.Segments, Segment{Start: 0, End: mdat.start - 1})
+	}
+	l.Segments = append(l.Segments, Segment{Data: data}, Segment{Start: mdat.start, End: moov.start - 1})
+	if moov.end < size {
+		l.Segments = append(l.Segments, Segment{Start: moov.end, End: size - 1})
+	}
+	return l, nil
+}
+
+// Range returns the segments covering the output bytes from start to end
+// inclusive, cut to fit.
+// Size is how many bytes of the output the layout holds in memory.
+func (l *Layout) Size() int64 {
+	var n int64
+	for _, s := range l.Segments {
+		n += int64(len(s.Data))
+	}
+	return n
+}
+
+func (l *Layout) Range(start, end int64) []Segment {
+	var res []Segment
+	pos := int64(0)
+	for _, s := range l.Segments {
+		from, to := max(start, pos), min(end, pos+s.len()-1)
+		if from <= to {
+			if s.Data != nil {
+				res = append(res, Segment{Data: s.Data[from-pos : to-pos+1]})
+			} else {
+				res = append(res, Segment{Start: s.Start + from - pos, End: s.Start + to - pos})
+			}
+		}
+		pos += s.len()
+	}
+	return res
+}
+
+// readBox reads the header of the box at off.
+func readBox(off, size int64, readAt ReadAtFunc) (*box, error) {
+	head, err := readAt(off, min(16, size-off))
+	if err != nil {
+		return nil, err
+	}
+	if len(head) < 8 {
+		return nil, ErrUnsupported
+	}
+	b := &box{typ: string(head[4:8]), start: off}
+	switch n := int64(binary.BigEndian.Uint32(head)); n {
+	case 0:
+		b.end = size
+	case 1:
+		if len(head) < 16 {
+			return nil, ErrUnsupported
+		}
+		large := binary.BigEndian.Uint64(head[8:])
+		if large < 16 || large > uint64(size-off) {
+			return nil, ErrUnsupported
+		}
+		b.end = off + int64(large)
+	default:
+		if n < 8 || n > size-off {
+			return nil, ErrUnsupported
+		}
+		b.end = off + n
+	}
+	return b, nil
+}
+
+// containers are the boxes on the way from moov to the chunk offset tables.
+var containers = map[string]bool{"trak": true, "mdia": true, "minf": true, "stbl": true}
+
+// shift adds delta to the chunk offsets in the boxes of data that point
+// between from and to, the media data the moov is moved ahead of.
+func shift(data []byte, from, to, delta int64) error {
+	for len(data) >= 8 {
+		n := int64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		header := int64(8)
+		if n == 1 {
+			if len(data) < 16 {
+				return ErrUnsupported
+			}
+			n, header = int64(binary.BigEndian.Uint64(data[8:])), 16
+		}
+		if n < header || n > int64(len(data)) {
+			return ErrUnsupported
+		}
+		body := data[header:n]
+		switch {
+		case typ == "cmov":
+			return ErrUnsupported
+		case containers[typ]:
+			if err := shift(body, from, to, delta); err != nil {
+				return err
+			}
+		case typ == "stco" || typ == "co64":
+			if err := shiftOffsets(body, typ == "co64", from, to, delta); err != nil {
+				return err
+			}
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func shiftOffsets(body []byte, wide bool, from, to, delta int64) error {
+	if len(body) < 8 {
+		return ErrUnsupported
+	}
+	count := int64(binary.BigEndian.Uint32(body[4:]))
+	width := int64(4)
+	if wide {
+		width = 8
+	}
+	if int64(len(body)-8) < count*width {
+		return ErrUnsupported
+	}
+	entries := body[8:]
+	for i := int64(0); i < count; i++ {
+		entry := entries[i*width:]
+		if wide {
+			off := int64(binary.BigEndian.Uint64(entry))
+			if off >= from && off < to {
+				binary.BigEndian.PutUint64(entry, uint64(off+delta))
+			}
+			continue
+		}
+		off := int64(binary.BigEndian.Uint32(entry))
+		if off >= from && off < to {
+			// widening the table would change the size of the moov
+			if off+delta > math.MaxUint32 {
+				return ErrUnsupported
+			}
+			binary.BigEndian.PutUint32(entry, uint32(off+delta))
+		}
+	}
+	return nil
+}
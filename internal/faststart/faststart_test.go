@@ -0,0 +1,72 @@
+package faststart
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mp4Box(typ string, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	head := binary.BigEndian.AppendUint32(nil, uint32(len(b)+8))
+	return append(append(head, typ...), b...)
+}
+
+func stco(offsets ...uint32) []byte {
+	body := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(offsets)))
+	for _, off := range offsets {
+		body = binary.BigEndian.AppendUint32(body, off)
+	}
+	return mp4Box("stco", body)
+}
+
+func assemble(t *testing.T, l *Layout, input []byte, start, end int64) []byte {
+	var out []byte
+	for _, s := range l.Range(start, end) {
+		if s.Data != nil {
+			out = append(out, s.Data...)
+		} else {
+			out = append(out, input[s.Start:s.End+1]...)
+		}
+	}
+	return out
+}
+
+func TestPlan(t *testing.T) {
+	ftyp := mp4Box("ftyp", []byte("isom\x00\x00\x02\x00"))
+	mdat := mp4Box("mdat", []byte("firstsecond"))
+	first, second := uint32(len(ftyp)+8), uint32(len(ftyp)+8+5)
+	moov := mp4Box("moov", mp4Box("mvhd", make([]byte, 8)),
+		mp4Box("trak", mp4Box("mdia", mp4Box("minf", mp4Box("stbl", stco(first, second))))))
+	input := bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+	size := int64(len(input))
+
+	readAt := func(off, n int64) ([]byte, error) { return input[off : off+n], nil }
+	l, err := Plan(size, readAt)
+	require.NoError(t, err)
+
+	out := assemble(t, l, input, 0, size-1)
+	require.Len(t, out, len(input))
+	assert.Equal(t, ftyp, out[:len(ftyp)])
+	assert.Equal(t, "moov", string(out[len(ftyp)+4:len(ftyp)+8]))
+
+	// the offsets in the moved moov point at the same samples
+	table := out[len(out)-len(mdat)-8 : len(out)-len(mdat)]
+	shifted := binary.BigEndian.Uint32(table)
+	assert.Equal(t, first+uint32(len(moov)), shifted)
+	assert.Equal(t, "first", string(out[shifted:shifted+5]))
+
+	// ranges cut across segments match the whole output
+	assert.Equal(t, out[10:len(ftyp)+len(moov)+3], assemble(t, l, input, 10, int64(len(ftyp)+len(moov)+2)))
+
+	_, err = Plan(size, func(off, n int64) ([]byte, error) {
+		return bytes.Join([][]byte{ftyp, moov, mdat}, nil)[off : off+n], nil
+	})
+	assert.ErrorIs(t, err, ErrNotNeeded)
+
+	_, err = Plan(8, func(off, n int64) ([]byte, error) { return []byte("\x00\x00\x00\x08RIFF")[off : off+n], nil })
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
@@ -0,0 +1,87 @@
+package foldertemplate
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownTemplate = errors.New("unknown folder template")
+	ErrInvalidFolder   = errors.New("invalid folder in template")
+	ErrEmptyTemplate   = errors.New("template has no folders")
+)
+
+var builtin = map[string][]string{
+	"project": {
+		"docs",
+		"src",
+		"assets/images",
+		"assets/videos",
+		"archive",
+	},
+	"media": {
+		"Movies",
+		"TV Shows",
+		"Music",
+		"Photos",
+	},
+	"movies": {
+		"Movies",
+	},
+	"tv": {
+		"TV Shows",
+	},
+}
+
+func Names() []string {
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Get(name string) ([]string, error) {
+	folders, ok := builtin[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrUnknownTemplate
+	}
+	return folders, nil
+}
+
+// Expand resolves template folders relative to base and returns the absolute
+// paths that need to exist, with parents always listed before their children.
+func Expand(base string, folders []string) ([]string, error) {
+	if len(folders) == 0 {
+		return nil, ErrEmptyTemplate
+	}
+
+	base = path.Clean("/" + strings.TrimSpace(base))
+
+	seen := make(map[string]bool)
+	paths := []string{}
+
+	for _, folder := range folders {
+		folder = strings.TrimSpace(folder)
+		if folder == "" || strings.Contains(folder, "..") {
+			return nil, ErrInvalidFolder
+		}
+		full := path.Join(base, path.Clean("/"+folder))
+		if full == base {
+			return nil, ErrInvalidFolder
+		}
+		if !seen[full] {
+			seen[full] = true
+			paths = append(paths, full)
+		}
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		return strings.Count(paths[i], "/") < strings.Count(paths[j], "/")
+	})
+
+	return paths, nil
+}
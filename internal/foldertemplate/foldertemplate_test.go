@@ -0,0 +1,39 @@
+package foldertemplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpand(t *testing.T) {
+	paths, err := Expand("/work", []string{"assets/images", "docs", "assets", "docs"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/work/docs", "/work/assets", "/work/assets/images"}, paths)
+}
+
+func TestExpandRoot(t *testing.T) {
+	paths, err := Expand("/", []string{"Movies"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/Movies"}, paths)
+}
+
+func TestExpandInvalid(t *testing.T) {
+	_, err := Expand("/work", []string{"../escape"})
+	assert.ErrorIs(t, err, ErrInvalidFolder)
+
+	_, err = Expand("/work", []string{"/"})
+	assert.ErrorIs(t, err, ErrInvalidFolder)
+
+	_, err = Expand("/work", nil)
+	assert.ErrorIs(t, err, ErrEmptyTemplate)
+}
+
+func TestGet(t *testing.T) {
+	folders, err := Get("Media")
+	assert.NoError(t, err)
+	assert.Contains(t, folders, "TV Shows")
+
+	_, err = Get("missing")
+	assert.ErrorIs(t, err, ErrUnknownTemplate)
+}
@@ -0,0 +1,113 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+const MaxDimension = 4096
+
+// MaxSourcePixels bounds the decoded size of source images, as a small file
+// can declare dimensions that take gigabytes to decode.
+const MaxSourcePixels = 64 << 20
+
+var (
+	ErrInvalidSize   = errors.New("invalid image size")
+	ErrUnknownFormat = errors.New("unsupported image format")
+	ErrTooLarge      = errors.New("image dimensions too large")
+)
+
+var contentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"webp": "image/webp",
+}
+
+// ContentType returns the mime type of an output format or an empty string
+// if the format cannot be encoded.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Fit scales srcW x srcH down to fit into a box of width x height while keeping
+// the aspect ratio. A zero width or height leaves that side unconstrained.
+// Images are never upscaled.
+func Fit(srcW, srcH, width, height int) (int, int) {
+	if srcW <= 0 || srcH <= 0 {
+		return 0, 0
+	}
+	scale := 1.0
+	if width > 0 && float64(width)/float64(srcW) < scale {
+		scale = float64(width) / float64(srcW)
+	}
+	if height > 0 && float64(height)/float64(srcH) < scale {
+		scale = float64(height) / float64(srcH)
+	}
+	return max(1, int(float64(srcW)*scale+0.5)), max(1, int(float64(srcH)*scale+0.5))
+}
+
+// Resize decodes src, resizes it into the width x height box and encodes the
+// result in the requested format. An empty format keeps the source format
+// when it can be encoded and falls back to jpeg otherwise.
+func Resize(dst io.Writer, src io.Reader, width, height int, format string, quality int) (string, error) {
+	if width < 0 || height < 0 || width > MaxDimension || height > MaxDimension {
+		return "", ErrInvalidSize
+	}
+
+	// the header is read twice, once to check the dimensions before decoding
+	var head bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(src, &head))
+	if err != nil {
+		return "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxSourcePixels {
+		return "", ErrTooLarge
+	}
+
+	img, srcFormat, err := image.Decode(io.MultiReader(&head, src))
+	if err != nil {
+		return "", err
+	}
+
+	if format == "" {
+		format = srcFormat
+		if ContentType(format) == "" {
+			format = "jpeg"
+		}
+	}
+
+	if ContentType(format) == "" {
+		return "", ErrUnknownFormat
+	}
+
+	bounds := img.Bounds()
+	w, h := Fit(bounds.Dx(), bounds.Dy(), width, height)
+
+	if w != bounds.Dx() || h != bounds.Dy() {
+		resized := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
+		img = resized
+	}
+
+	switch format {
+	case "png":
+		err = png.Encode(dst, img)
+	case "webp":
+		err = nativewebp.Encode(dst, img, nil)
+	default:
+		err = jpeg.Encode(dst, img, &jpeg.Options{Quality: quality})
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return ContentType(format), nil
+}
@@ -0,0 +1,65 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFit(t *testing.T) {
+	w, h := Fit(1920, 1080, 640, 0)
+	assert.Equal(t, 640, w)
+	assert.Equal(t, 360, h)
+
+	w, h = Fit(1920, 1080, 640, 100)
+	assert.Equal(t, 178, w)
+	assert.Equal(t, 100, h)
+
+	w, h = Fit(100, 50, 400, 400)
+	assert.Equal(t, 100, w)
+	assert.Equal(t, 50, h)
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for x := 0; x < 200; x++ {
+		src.Set(x, 10, color.RGBA{R: 255, A: 255})
+	}
+	var in bytes.Buffer
+	assert.NoError(t, png.Encode(&in, src))
+
+	for _, format := range []string{"", "jpeg", "webp"} {
+		var out bytes.Buffer
+		contentType, err := Resize(&out, bytes.NewReader(in.Bytes()), 50, 0, format, 80)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, contentType)
+
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(out.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, 50, cfg.Width)
+		assert.Equal(t, 25, cfg.Height)
+	}
+
+	_, err := Resize(&bytes.Buffer{}, bytes.NewReader(in.Bytes()), 50, 0, "bmp", 80)
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestResizeTooLarge(t *testing.T) {
+	var in bytes.Buffer
+	assert.NoError(t, png.Encode(&in, image.NewGray(image.Rect(0, 0, 1, 1))))
+
+	// claim 100000 x 100000 pixels in the header of a tiny png
+	data := in.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	_, err := Resize(&bytes.Buffer{}, bytes.NewReader(data), 50, 0, "", 80)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
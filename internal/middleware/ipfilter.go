@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func parsePrefixes(rules []string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if !strings.Contains(rule, "/") {
+			addr, err := netip.ParseAddr(rule)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", rule, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", rule, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPFilter rejects requests whose client IP matches a deny rule or, when allow
+// rules are set, matches none of them. Rules are CIDRs or plain addresses.
+func IPFilter(rules config.AccessRules) (gin.HandlerFunc, error) {
+	allow, err := parsePrefixes(rules.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parsePrefixes(rules.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		if len(allow) == 0 && len(deny) == 0 {
+			c.Next()
+			return
+		}
+
+		addr, err := netip.ParseAddr(c.ClientIP())
+
+		if err != nil || containsAddr(deny, addr.Unmap()) || (len(allow) > 0 && !containsAddr(allow, addr.Unmap())) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}, nil
+}
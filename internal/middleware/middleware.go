@@ -2,12 +2,18 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/divyam234/cors"
 	"github.com/divyam234/teldrive/internal/auth"
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/pkg/types"
 	"github.com/gin-contrib/secure"
 	"github.com/go-jose/go-jose/v3/jwt"
 
@@ -29,18 +35,46 @@ func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
 	}
 }
 
-func Cors() gin.HandlerFunc {
-	return cors.New(cors.Config{
-		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders: []string{"Authorization", "Content-Length", "Content-Type"},
-		AllowOriginFunc: func(origin string) bool {
-			return true
-		},
-		MaxAge: 12 * time.Hour,
-	})
+var errCorsWildcard = errors.New("cors: a \"*\" origin cannot be combined with credentials")
+
+// Cors answers cross-origin requests from the configured origins. A "*" origin
+// allows any site but no credentials, and no origins disables CORS handling
+// altogether.
+func Cors(cnf *config.CorsConfig) (gin.HandlerFunc, error) {
+	if len(cnf.AllowedOrigins) == 0 {
+		return func(c *gin.Context) { c.Next() }, nil
+	}
+
+	corsConfig := cors.Config{
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders:     []string{"Authorization", "Content-Length", "Content-Type", "Range", ElevationHeader},
+		ExposeHeaders:    []string{"Content-Length", "Content-Range", "Accept-Ranges", "Content-Disposition"},
+		AllowCredentials: cnf.AllowCredentials,
+		MaxAge:           cnf.MaxAge,
+		AllowWildcard:    true,
+	}
+
+	if slices.Contains(cnf.AllowedOrigins, "*") {
+		// any site could act with the user's cookies otherwise
+		if cnf.AllowCredentials {
+			return nil, errCorsWildcard
+		}
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = cnf.AllowedOrigins
+	}
+
+	if err := corsConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cors.New(corsConfig), nil
 }
 
-func Authmiddleware(secret string) gin.HandlerFunc {
+// Authmiddleware accepts the session tokens issued at login. Tokens outlive
+// their session, so active is asked whether the session behind them still
+// exists and its user was not disabled since.
+func Authmiddleware(secret string, active func(ctx context.Context, claims *types.JWTClaims) error) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var token string
 
@@ -75,22 +109,147 @@ func Authmiddleware(secret string) gin.HandlerFunc {
 			return
 		}
 
+		if err := active(c, jwePayload); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
 		c.Set("jwtUser", jwePayload)
 
 		c.Next()
 	}
 }
 
-func SecurityMiddleware() gin.HandlerFunc {
-	return secure.New(secure.Config{
-		STSSeconds:            315360000,
-		STSIncludeSubdomains:  true,
-		FrameDeny:             true,
-		ContentTypeNosniff:    true,
-		BrowserXssFilter:      true,
-		ContentSecurityPolicy: "default-src 'self'",
-		IENoOpen:              true,
-		ReferrerPolicy:        "strict-origin-when-cross-origin",
-		SSLProxyHeaders:       map[string]string{"X-Forwarded-Proto": "https"},
+const (
+	ElevationCookie = "elevated-session"
+	ElevationHeader = "X-Elevation-Token"
+)
+
+// StepUp lets a request through only when the session was confirmed again
+// recently, with a token from the elevated-session cookie or the
+// X-Elevation-Token header. It runs after Authmiddleware and lets everything
+// through when step-up confirmation is turned off.
+func StepUp(secret string, enabled bool) gin.HandlerFunc {
+	if !enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		token := c.GetHeader(ElevationHeader)
+		if token == "" {
+			token, _ = c.Cookie(ElevationCookie)
+		}
+		claims, _ := c.Get("jwtUser")
+		jwtUser, ok := claims.(*types.JWTClaims)
+		if !ok || auth.CheckElevation(secret, token, jwtUser) != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": auth.ErrNotElevated.Error(), "stepUp": true})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Admin lets a request through only for the users listed in admins. It runs
+// after Authmiddleware, and no admins closes the routes it guards to everyone.
+func Admin(admins []int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := c.Get("jwtUser")
+		jwtUser, ok := claims.(*types.JWTClaims)
+		if ok {
+			userId, err := strconv.ParseInt(jwtUser.Subject, 10, 64)
+			ok = err == nil && slices.Contains(admins, userId)
+		}
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SecurityHeaders sets the configured browser security headers. HSTS is only
+// sent on requests that arrived over TLS or when the public URL set through
+// Forwarded, which must run first, is https.
+func SecurityHeaders(cnf *config.SecurityConfig) gin.HandlerFunc {
+	headers := secure.New(secure.Config{
+		CustomFrameOptionsValue: cnf.FrameOptions,
+		ContentTypeNosniff:      true,
+		ContentSecurityPolicy:   cnf.ContentSecurityPolicy,
+		ReferrerPolicy:          cnf.ReferrerPolicy,
 	})
+	hsts := ""
+	if cnf.HstsMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(cnf.HstsMaxAge.Seconds()), 10)
+		if cnf.HstsIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+	return func(c *gin.Context) {
+		if hsts != "" && (c.Request.TLS != nil || strings.HasPrefix(BaseURL(c), "https://")) {
+			c.Header("Strict-Transport-Security", hsts)
+		}
+		headers(c)
+	}
+}
+
+// SharedToken lets a request through only when it carries token as a bearer
+// token. No token disables the routes it guards.
+func SharedToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			c.Abort()
+			return
+		}
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func isMutation(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+// ReadOnly rejects requests that could change data, for replicas whose data
+// is overwritten by their primary. Routes under the exempt prefixes go
+// through, so users can still log in to the replica.
+func ReadOnly(exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isMutation(c.Request.Method) && !slices.ContainsFunc(exempt, func(prefix string) bool {
+			return strings.HasPrefix(c.FullPath(), prefix)
+		}) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "this instance is a read-only replica"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Maintenance rejects requests that could change data while active reports
+// maintenance, telling clients when to retry. Routes under the exempt
+// prefixes go through, so admins can still log in and end maintenance.
+func Maintenance(active func() (bool, string, time.Duration), exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		on, message, retryAfter := active()
+		if !on || !isMutation(c.Request.Method) || slices.ContainsFunc(exempt, func(prefix string) bool {
+			return strings.HasPrefix(c.FullPath(), prefix)
+		}) {
+			c.Next()
+			return
+		}
+		if message == "" {
+			message = "the server is under maintenance"
+		}
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": message, "maintenance": true})
+		c.Abort()
+	}
 }
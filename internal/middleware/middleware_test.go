@@ -6,7 +6,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/divyam234/teldrive/internal/auth"
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/pkg/types"
 	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -34,3 +38,233 @@ func setupRouterWithHandler(middlewareFunc func(c *gin.Engine), handler func(c *
 	r.GET("/foo", handler)
 	return r
 }
+
+func TestIPFilter(t *testing.T) {
+	filter, err := IPFilter(config.AccessRules{Allow: []string{"10.0.0.0/8", "192.168.1.5"}, Deny: []string{"10.1.0.0/16"}})
+	assert.NoError(t, err)
+
+	s := setupRouterWithHandler(func(c *gin.Engine) {
+		c.Use(filter)
+	}, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		addr string
+		code int
+	}{
+		{"10.2.3.4:1234", http.StatusOK},
+		{"192.168.1.5:1234", http.StatusOK},
+		{"10.1.2.3:1234", http.StatusForbidden},
+		{"172.16.0.1:1234", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost/foo", nil)
+		req.RemoteAddr = test.addr
+		s.ServeHTTP(res, req)
+		assert.Equal(t, test.code, res.Code, test.addr)
+	}
+
+	_, err = IPFilter(config.AccessRules{Deny: []string{"not-an-ip"}})
+	assert.Error(t, err)
+}
+
+func TestCors(t *testing.T) {
+	cors, err := Cors(&config.CorsConfig{AllowedOrigins: []string{"https://app.example.com"}})
+	assert.NoError(t, err)
+
+	s := setupRouterWithHandler(func(c *gin.Engine) {
+		c.Use(cors)
+	}, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost/foo", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	s.ServeHTTP(res, req)
+	assert.Equal(t, "https://app.example.com", res.Header().Get("Access-Control-Allow-Origin"))
+
+	res = httptest.NewRecorder()
+	req.Header.Set("Origin", "https://evil.example.com")
+	s.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	_, err = Cors(&config.CorsConfig{AllowedOrigins: []string{"example.com"}})
+	assert.Error(t, err)
+
+	_, err = Cors(&config.CorsConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	assert.ErrorIs(t, err, errCorsWildcard)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	s := newSlidingWindow(2, time.Minute)
+	start := time.Now().Truncate(time.Minute)
+
+	ok, _ := s.allow("a", start)
+	assert.True(t, ok)
+	ok, _ = s.allow("a", start.Add(10*time.Second))
+	assert.True(t, ok)
+	ok, wait := s.allow("a", start.Add(20*time.Second))
+	assert.False(t, ok)
+	assert.Greater(t, wait, 40*time.Second)
+
+	ok, _ = s.allow("b", start.Add(20*time.Second))
+	assert.True(t, ok)
+
+	// halfway through the next window only one of the two earlier requests counts
+	ok, _ = s.allow("a", start.Add(90*time.Second))
+	assert.True(t, ok)
+	ok, _ = s.allow("a", start.Add(91*time.Second))
+	assert.False(t, ok)
+}
+
+func TestForwarded(t *testing.T) {
+	tests := []struct {
+		publicURL string
+		addr      string
+		wantURL   string
+		wantPath  string
+	}{
+		{"https://drive.example.com/", "10.0.0.1:1234", "https://drive.example.com", "/proxy/teldrive"},
+		{"https://drive.example.com", "10.0.0.2:1234", "https://drive.example.com", "/teldrive"},
+		{"", "10.0.0.1:1234", "", "/proxy/teldrive"},
+	}
+
+	for _, test := range tests {
+		forwarded, err := Forwarded([]string{"10.0.0.1"}, "/teldrive", test.publicURL)
+		assert.NoError(t, err)
+
+		var baseURL, basePath string
+		s := setupRouterWithHandler(func(c *gin.Engine) {
+			c.Use(forwarded)
+		}, func(c *gin.Context) {
+			baseURL, basePath = BaseURL(c), BasePath(c)
+		})
+
+		req, _ := http.NewRequest("GET", "http://evil.example/foo", nil)
+		req.RemoteAddr = test.addr
+		req.Header.Set("X-Forwarded-Host", "evil.example")
+		req.Header.Set("X-Forwarded-Prefix", "/proxy/")
+		s.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, test.wantURL, baseURL, test.addr)
+		assert.Equal(t, test.wantPath, basePath, test.addr)
+	}
+}
+
+func TestStripBasePath(t *testing.T) {
+	s := StripBasePath("/teldrive", setupRouterWithHandler(func(c *gin.Engine) {}, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/teldrive/foo", http.StatusOK},
+		{"/teldrive", http.StatusMovedPermanently},
+		{"/foo", http.StatusNotFound},
+		{"/teldrivefoo", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost"+test.path, nil)
+		s.ServeHTTP(res, req)
+		assert.Equal(t, test.code, res.Code, test.path)
+	}
+}
+
+func TestStepUp(t *testing.T) {
+	const secret = "secret"
+	user := &types.JWTClaims{Claims: jwt.Claims{Subject: "1"}, Hash: "a"}
+	s := setupRouterWithHandler(func(c *gin.Engine) {
+		c.Use(func(c *gin.Context) { c.Set("jwtUser", user) }, StepUp(secret, true))
+	}, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	elevated, err := auth.Elevate(secret, user, time.Minute)
+	assert.NoError(t, err)
+	otherSession, _ := auth.Elevate(secret, &types.JWTClaims{Claims: jwt.Claims{Subject: "1"}, Hash: "b"}, time.Minute)
+	expired, _ := auth.Elevate(secret, user, -time.Minute)
+
+	tests := []struct {
+		token string
+		code  int
+	}{
+		{elevated, http.StatusOK},
+		{"", http.StatusForbidden},
+		{otherSession, http.StatusForbidden},
+		{expired, http.StatusForbidden},
+	}
+
+	for i, test := range tests {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost/foo", nil)
+		req.Header.Set(ElevationHeader, test.token)
+		s.ServeHTTP(res, req)
+		assert.Equal(t, test.code, res.Code, i)
+	}
+}
+
+func TestSharedToken(t *testing.T) {
+	tests := []struct {
+		token  string
+		header string
+		code   int
+	}{
+		{"secret", "Bearer secret", http.StatusOK},
+		{"secret", "Bearer other", http.StatusUnauthorized},
+		{"secret", "", http.StatusUnauthorized},
+		{"", "Bearer ", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		s := setupRouterWithHandler(func(c *gin.Engine) {
+			c.Use(SharedToken(tt.token))
+		}, func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost/foo", nil)
+		req.Header.Set("Authorization", tt.header)
+		s.ServeHTTP(res, req)
+		assert.Equal(t, tt.code, res.Code, tt.header)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	on := true
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Maintenance(func() (bool, string, time.Duration) { return on, "", time.Minute }, "/api/admin"))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/api/files", ok)
+	r.POST("/api/files", ok)
+	r.PUT("/api/admin/maintenance", ok)
+
+	tests := []struct {
+		on     bool
+		method string
+		path   string
+		code   int
+	}{
+		{true, "GET", "/api/files", http.StatusOK},
+		{true, "POST", "/api/files", http.StatusServiceUnavailable},
+		{true, "PUT", "/api/admin/maintenance", http.StatusOK},
+		{false, "POST", "/api/files", http.StatusOK},
+	}
+	for _, tt := range tests {
+		on = tt.on
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, "http://localhost"+tt.path, nil)
+		r.ServeHTTP(res, req)
+		assert.Equal(t, tt.code, res.Code, tt.method+" "+tt.path)
+		if tt.code == http.StatusServiceUnavailable {
+			assert.Equal(t, "60", res.Header().Get("Retry-After"))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	baseURLKey  = "baseURL"
+	basePathKey = "basePath"
+)
+
+// Forwarded resolves where clients reached the server, for links and cookies.
+// The path prefix set by X-Forwarded-Prefix is only honored from trusted
+// proxies; basePath is the prefix the server itself is mounted under. Links
+// are made from publicURL alone, never from the Host of a request, which is
+// up to the client.
+func Forwarded(trusted []string, basePath, publicURL string) (gin.HandlerFunc, error) {
+	proxies, err := parsePrefixes(trusted)
+	if err != nil {
+		return nil, err
+	}
+	publicURL = strings.TrimSuffix(publicURL, "/")
+
+	return func(c *gin.Context) {
+		prefix := ""
+		if addr, err := netip.ParseAddr(c.RemoteIP()); err == nil && containsAddr(proxies, addr.Unmap()) {
+			prefix = strings.TrimSuffix(forwardedValue(c, "X-Forwarded-Prefix"), "/")
+			if prefix != "" && !strings.HasPrefix(prefix, "/") {
+				prefix = ""
+			}
+		}
+
+		c.Set(basePathKey, prefix+basePath)
+		c.Set(baseURLKey, publicURL)
+		c.Next()
+	}, nil
+}
+
+// forwardedValue returns the value set by the proxy closest to the client
+// when a header was appended to along a chain of proxies.
+func forwardedValue(c *gin.Context, header string) string {
+	value, _, _ := strings.Cut(c.GetHeader(header), ",")
+	return strings.TrimSpace(value)
+}
+
+// BaseURL returns the external URL of the server root without a trailing
+// slash, empty when no public URL is configured.
+func BaseURL(c *gin.Context) string {
+	return c.GetString(baseURLKey)
+}
+
+// BasePath returns the external path of the server root without a trailing
+// slash, empty when it is served at the root.
+func BasePath(c *gin.Context) string {
+	return c.GetString(basePathKey)
+}
+
+// StripBasePath serves h under basePath, redirecting basePath itself to
+// basePath/ and answering 404 outside of it.
+func StripBasePath(basePath string, h http.Handler) http.Handler {
+	if basePath == "" {
+		return h
+	}
+	strip := http.StripPrefix(basePath, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == basePath:
+			target := basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, basePath+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc returns the key a request is counted under.
+type KeyFunc func(c *gin.Context) string
+
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser keys requests by the authenticated user and falls back to the client
+// IP, so it must run after Authmiddleware to be effective.
+func ByUser(c *gin.Context) string {
+	if val, ok := c.Get("jwtUser"); ok {
+		if claims, ok := val.(*types.JWTClaims); ok {
+			return "user:" + claims.Subject
+		}
+	}
+	return ByIP(c)
+}
+
+type window struct {
+	start time.Time
+	curr  int
+	prev  int
+}
+
+// slidingWindow approximates a sliding log by weighting the previous fixed
+// window's count by how much of it still overlaps the sliding one.
+type slidingWindow struct {
+	mu        sync.Mutex
+	limit     int
+	size      time.Duration
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+func newSlidingWindow(limit int, size time.Duration) *slidingWindow {
+	return &slidingWindow{limit: limit, size: size, windows: make(map[string]*window), lastSweep: time.Now()}
+}
+
+// allow records a request for key unless it exceeds the budget, in which case
+// it returns how long to wait before retrying.
+func (s *slidingWindow) allow(key string, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := now.Truncate(s.size)
+
+	if now.Sub(s.lastSweep) > 2*s.size {
+		for k, w := range s.windows {
+			if start.Sub(w.start) > s.size {
+				delete(s.windows, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok {
+		w = &window{start: start}
+		s.windows[key] = w
+	}
+
+	switch start.Sub(w.start) {
+	case 0:
+	case s.size:
+		w.prev, w.curr = w.curr, 0
+	default:
+		w.prev, w.curr = 0, 0
+	}
+	w.start = start
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(s.size)
+
+	if float64(w.prev)*weight+float64(w.curr+1) <= float64(s.limit) {
+		w.curr++
+		return true, 0
+	}
+
+	var wait time.Duration
+	if w.curr+1 > s.limit {
+		// the current window alone is over budget: wait for it to end and for
+		// enough of it to slide out of the next one
+		wait = s.size - elapsed + time.Duration(float64(s.size)*(1-float64(s.limit-1)/float64(w.curr)))
+	} else {
+		wait = time.Duration(float64(s.size)*(1-float64(s.limit-1-w.curr)/float64(w.prev))) - elapsed
+	}
+	return false, max(wait, time.Second)
+}
+
+// RateLimit allows budget.Requests requests per budget.Window for each key and
+// answers 429 with Retry-After beyond that. A zero budget disables the limit.
+func RateLimit(budget config.LimitBudget, key KeyFunc) gin.HandlerFunc {
+	if budget.Requests <= 0 || budget.Window <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	limiter := newSlidingWindow(budget.Requests, budget.Window)
+
+	return func(c *gin.Context) {
+		limit(c, limiter, key)
+	}
+}
+
+// LiveRateLimit is RateLimit with the budget read on every request, so it can
+// be reloaded while the server runs. Counts start over when it changes.
+func LiveRateLimit(budget func() config.LimitBudget, key KeyFunc) gin.HandlerFunc {
+	var (
+		mu      sync.Mutex
+		current config.LimitBudget
+		limiter *slidingWindow
+	)
+
+	return func(c *gin.Context) {
+		b := budget()
+		if b.Requests <= 0 || b.Window <= 0 {
+			c.Next()
+			return
+		}
+
+		mu.Lock()
+		if limiter == nil || b != current {
+			current, limiter = b, newSlidingWindow(b.Requests, b.Window)
+		}
+		l := limiter
+		mu.Unlock()
+
+		limit(c, l, key)
+	}
+}
+
+func limit(c *gin.Context, limiter *slidingWindow, key KeyFunc) {
+	if ok, wait := limiter.allow(key(c), time.Now()); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
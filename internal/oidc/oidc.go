@@ -0,0 +1,261 @@
+// Package oidc signs users in through an OpenID Connect provider with the
+// authorization code flow and PKCE, verifying ID tokens against the keys the
+// provider publishes.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	// keys are fetched again for unknown key ids, at most this often
+	keysRefresh = time.Minute
+	clockLeeway = time.Minute
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid id token")
+	ErrNonce        = errors.New("id token nonce mismatch")
+)
+
+// Claims identifies the user an ID token was issued for.
+type Claims struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to the provider configured by cnf. Its metadata is
+// discovered on first use, so the server starts while the provider is down.
+type Provider struct {
+	cnf    *config.OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *discovery
+	keys        jose.JSONWebKeySet
+	keysFetched time.Time
+}
+
+func New(cnf *config.OIDCConfig) *Provider {
+	return &Provider{cnf: cnf, client: &http.Client{Timeout: requestTimeout}}
+}
+
+// AuthCodeURL returns the provider page the user signs in on. verifier is the
+// PKCE secret later passed to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURL, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cnf.ClientId},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+func (p *Provider) scopes() []string {
+	for _, s := range p.cnf.Scopes {
+		if s == "openid" {
+			return p.cnf.Scopes
+		}
+	}
+	return append([]string{"openid"}, p.cnf.Scopes...)
+}
+
+// Exchange trades the code the provider redirected back with for the claims of
+// the ID token, checking that it was issued for this client and nonce.
+func (p *Provider) Exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (*Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.cnf.ClientId},
+		"code_verifier": {verifier},
+	}
+	if p.cnf.ClientSecret != "" {
+		form.Set("client_secret", p.cnf.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token exchange: no id token returned")
+	}
+	return p.verify(ctx, meta, token.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, meta *discovery, raw, nonce string) (*Claims, error) {
+	tok, err := jwt.ParseSigned(raw)
+	if err != nil || len(tok.Headers) != 1 {
+		return nil, ErrInvalidToken
+	}
+	key, err := p.key(ctx, meta, tok.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		std    jwt.Claims
+		claims Claims
+	)
+	if err := tok.Claims(key, &std, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := std.ValidateWithLeeway(jwt.Expected{
+		Issuer:   meta.Issuer,
+		Audience: jwt.Audience{p.cnf.ClientId},
+		Time:     time.Now(),
+	}, clockLeeway); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if std.Expiry == nil || std.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonce
+	}
+	return &claims, nil
+}
+
+// key returns the public key tokens signed with kid are verified with.
+func (p *Provider) key(ctx context.Context, meta *discovery, kid string) (*jose.JSONWebKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	find := func() *jose.JSONWebKey {
+		for i, k := range p.keys.Keys {
+			if (kid == "" || k.KeyID == kid) && k.Valid() && k.IsPublic() && k.Use != "enc" {
+				return &p.keys.Keys[i]
+			}
+		}
+		return nil
+	}
+	if k := find(); k != nil {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < keysRefresh {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var keys jose.JSONWebKeySet
+	if err := p.do(req, &keys); err != nil {
+		return nil, fmt.Errorf("fetch signing keys: %w", err)
+	}
+	p.keys, p.keysFetched = keys, time.Now()
+
+	if k := find(); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	issuer := strings.TrimSuffix(p.cnf.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta discovery
+	if err := p.do(req, &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", meta.Issuer, p.cnf.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JwksURI == "" {
+		return nil, fmt.Errorf("oidc discovery: incomplete provider metadata")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+func (p *Provider) do(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// RandomString returns an unguessable URL safe value for states, nonces and
+// PKCE verifiers.
+func RandomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+type testProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	claims    map[string]any
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := &testProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 tp.URL,
+			"authorization_endpoint": tp.URL + "/authorize",
+			"token_endpoint":         tp.URL + "/token",
+			"jwks_uri":               tp.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "k1", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "good" || base64.RawURLEncoding.EncodeToString(sum[:]) != tp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+			(&jose.SignerOptions{}).WithHeader("kid", "k1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := jwt.Signed(signer).Claims(tp.claims).CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": raw})
+	})
+	tp.Server = httptest.NewServer(mux)
+	t.Cleanup(tp.Close)
+	return tp
+}
+
+func TestExchange(t *testing.T) {
+	tp := newTestProvider(t)
+	p := New(&config.OIDCConfig{Issuer: tp.URL, ClientId: "teldrive", Scopes: []string{"email"}})
+	ctx := context.Background()
+
+	verifier := RandomString()
+	authURL, err := p.AuthCodeURL(ctx, "http://drive/callback", "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if q.Get("scope") != "openid email" || q.Get("state") != "state" || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected auth url %s", authURL)
+	}
+	tp.challenge = q.Get("code_challenge")
+
+	now := time.Now()
+	tp.claims = map[string]any{
+		"iss": tp.URL, "sub": "alice", "aud": "teldrive", "nonce": "nonce", "email": "alice@example.com",
+		"exp": now.Add(time.Minute).Unix(), "iat": now.Unix(),
+	}
+
+	claims, err := p.Exchange(ctx, "http://drive/callback", "good", verifier, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice" || claims.Email != "alice@example.com" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	if _, err := p.Exchange(ctx, "http://drive/callback", "good", "other", "nonce"); err == nil {
+		t.Error("wrong verifier accepted")
+	}
+	if _, err := p.Exchange(ctx, "http://drive/callback", "good", verifier, "replayed"); !errors.Is(err, ErrNonce) {
+		t.Errorf("err = %v, want %v", err, ErrNonce)
+	}
+
+	tp.claims["aud"] = "other"
+	if _, err := p.Exchange(ctx, "http://drive/callback", "good", verifier, "nonce"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidToken)
+	}
+
+	tp.claims["aud"] = "teldrive"
+	tp.claims["exp"] = now.Add(-time.Hour).Unix()
+	if _, err := p.Exchange(ctx, "http://drive/callback", "good", verifier, "nonce"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidToken)
+	}
+}
@@ -0,0 +1,380 @@
+// Package pdftext pulls readable text out of the leading bytes of a PDF to
+// preview it. It is not a PDF parser: it scans for page content streams and
+// decodes their text operators, which works for the common case of simple
+// fonts and is good enough to tell what a document is about.
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrNoText = errors.New("no text found")
+
+// maxStreamSize caps what a single content stream inflates to, a few kilobytes
+// of Flate data could otherwise expand to gigabytes.
+const maxStreamSize = 4 << 20
+
+// skipDicts mark streams that never carry page text.
+var skipDicts = [][]byte{
+	[]byte("/Image"), []byte("/XRef"), []byte("/ObjStm"), []byte("/Metadata"),
+	[]byte("/Length1"), []byte("/Length2"), []byte("/FontFile"), []byte("/ICCBased"),
+}
+
+// FirstPage returns the text of the first content stream in data that draws
+// any, cut to at most limit bytes.
+func FirstPage(data []byte, limit int) (string, error) {
+	for len(data) > 0 {
+		i := bytes.Index(data, []byte("stream"))
+		if i < 0 {
+			break
+		}
+		dict := data[:i]
+		if j := bytes.LastIndex(dict, []byte("obj")); j >= 0 {
+			dict = dict[j:]
+		}
+		rest := data[i+len("stream"):]
+		data = rest
+
+		if !bytes.HasSuffix(bytes.TrimRight(dict, " \r\n\t"), []byte(">>")) {
+			continue
+		}
+		switch {
+		case bytes.HasPrefix(rest, []byte("\r\n")):
+			rest = rest[2:]
+		case bytes.HasPrefix(rest, []byte("\n")):
+			rest = rest[1:]
+		default:
+			continue
+		}
+		if skip(dict) {
+			continue
+		}
+
+		body := rest
+		if end := bytes.Index(rest, []byte("endstream")); end >= 0 {
+			body = rest[:end]
+			data = rest[end:]
+		}
+
+		content, ok := decode(dict, body)
+		if !ok {
+			continue
+		}
+		if text := extract(content, limit); text != "" {
+			return text, nil
+		}
+	}
+	return "", ErrNoText
+}
+
+func skip(dict []byte) bool {
+	for _, s := range skipDicts {
+		if bytes.Contains(dict, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// decode undoes the stream filter. Only Flate is supported, a stream cut off
+// by the end of data or by maxStreamSize yields what could be inflated.
+func decode(dict, body []byte) ([]byte, bool) {
+	if !bytes.Contains(dict, []byte("/Filter")) {
+		return body, true
+	}
+	if !bytes.Contains(dict, []byte("/FlateDecode")) || bytes.Count(dict, []byte("Decode")) > 1 {
+		return nil, false
+	}
+	r, err := zlib.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, false
+	}
+	out, _ := io.ReadAll(io.LimitReader(r, maxStreamSize))
+	return out, len(out) > 0
+}
+
+// extract runs the text showing operators of a content stream.
+func extract(content []byte, limit int) string {
+	var (
+		out      strings.Builder
+		operands []any
+		array    []any
+		inArray  bool
+	)
+	newline := func() {
+		if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			out.WriteByte('\n')
+		}
+	}
+	space := func() {
+		if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") && !strings.HasSuffix(s, " ") {
+			out.WriteByte(' ')
+		}
+	}
+	show := func(v any) {
+		if s, ok := v.(string); ok {
+			out.WriteString(s)
+		}
+	}
+
+	s := &scanner{data: content}
+	for out.Len() < limit {
+		tok, ok := s.next()
+		if !ok {
+			break
+		}
+		switch tok := tok.(type) {
+		case string, float64:
+			if inArray {
+				array = append(array, tok)
+			} else {
+				operands = append(operands, tok)
+			}
+			continue
+		case arrayStart:
+			inArray, array = true, nil
+			continue
+		case arrayEnd:
+			inArray = false
+			operands = append(operands, array)
+			continue
+		case operator:
+			switch tok {
+			case "Tj":
+				if len(operands) > 0 {
+					show(operands[len(operands)-1])
+				}
+			case "'", "\"":
+				newline()
+				if len(operands) > 0 {
+					show(operands[len(operands)-1])
+				}
+			case "TJ":
+				if len(operands) == 0 {
+					break
+				}
+				items, _ := operands[len(operands)-1].([]any)
+				for _, item := range items {
+					// large negative kerning separates words
+					if n, ok := item.(float64); ok && n < -200 {
+						space()
+					}
+					show(item)
+				}
+			case "T*", "Tm", "ET":
+				newline()
+			case "Td", "TD":
+				if len(operands) >= 2 {
+					if ty, ok := operands[len(operands)-1].(float64); ok && ty != 0 {
+						newline()
+					} else {
+						space()
+					}
+				}
+			}
+			operands = operands[:0]
+		}
+	}
+
+	text := strings.TrimSpace(out.String())
+	if len(text) > limit {
+		text = text[:limit]
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	return text
+}
+
+type (
+	arrayStart struct{}
+	arrayEnd   struct{}
+	operator   string
+)
+
+type scanner struct {
+	data []byte
+	pos  int
+}
+
+// next returns the next string, number, array delimiter or operator. Names,
+// dictionaries and inline images are skipped.
+func (s *scanner) next() (any, bool) {
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case isSpace(c):
+			s.pos++
+		case c == '%':
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' && s.data[s.pos] != '\r' {
+				s.pos++
+			}
+		case c == '(':
+			return s.literal(), true
+		case c == '<' && s.pos+1 < len(s.data) && s.data[s.pos+1] == '<':
+			s.pos += 2
+		case c == '>' && s.pos+1 < len(s.data) && s.data[s.pos+1] == '>':
+			s.pos += 2
+		case c == '<':
+			return s.hex(), true
+		case c == '[':
+			s.pos++
+			return arrayStart{}, true
+		case c == ']':
+			s.pos++
+			return arrayEnd{}, true
+		case c == '/':
+			s.pos++
+			s.word()
+		default:
+			w := s.word()
+			if w == "" {
+				s.pos++
+				continue
+			}
+			if n, err := strconv.ParseFloat(w, 64); err == nil {
+				return n, true
+			}
+			if w == "BI" {
+				s.skipInlineImage()
+				continue
+			}
+			return operator(w), true
+		}
+	}
+	return nil, false
+}
+
+func (s *scanner) word() string {
+	start := s.pos
+	for s.pos < len(s.data) && !isSpace(s.data[s.pos]) && !isDelim(s.data[s.pos]) {
+		s.pos++
+	}
+	return string(s.data[start:s.pos])
+}
+
+func (s *scanner) skipInlineImage() {
+	if i := bytes.Index(s.data[s.pos:], []byte("EI")); i >= 0 {
+		s.pos += i + 2
+		return
+	}
+	s.pos = len(s.data)
+}
+
+func (s *scanner) literal() string {
+	var b []byte
+	depth := 0
+	s.pos++
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		s.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return printable(b)
+			}
+			depth--
+		case '\\':
+			if s.pos >= len(s.data) {
+				continue
+			}
+			e := s.data[s.pos]
+			s.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b', 'f':
+				continue
+			case '\r', '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for k := 0; k < 2 && s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '7'; k++ {
+						n = n*8 + int(s.data[s.pos]-'0')
+						s.pos++
+					}
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return printable(b)
+}
+
+// hex decodes a hex string. Two byte glyph codes are only kept when they
+// look like plain Unicode, other CID fonts cannot be mapped without their
+// ToUnicode table.
+func (s *scanner) hex() string {
+	s.pos++
+	var digits []byte
+	for s.pos < len(s.data) && s.data[s.pos] != '>' {
+		if c := s.data[s.pos]; !isSpace(c) {
+			digits = append(digits, c)
+		}
+		s.pos++
+	}
+	s.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	for i := range b {
+		n, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return ""
+		}
+		b[i] = byte(n)
+	}
+	if len(b) >= 2 && len(b)%2 == 0 && b[0] == 0 {
+		runes := make([]rune, 0, len(b)/2)
+		for i := 0; i < len(b); i += 2 {
+			runes = append(runes, rune(b[i])<<8|rune(b[i+1]))
+		}
+		return printable([]byte(string(runes)))
+	}
+	return printable(b)
+}
+
+// printable maps Latin-1 bytes to text and drops control characters, which
+// is how most simple fonts are encoded.
+func printable(b []byte) string {
+	if utf8.Valid(b) {
+		return strings.Map(func(r rune) rune {
+			if r < 0x20 && r != '\n' && r != '\t' {
+				return -1
+			}
+			return r
+		}, string(b))
+	}
+	var sb strings.Builder
+	for _, c := range b {
+		if c >= 0x20 || c == '\n' || c == '\t' {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
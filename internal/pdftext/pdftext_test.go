@@ -0,0 +1,65 @@
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pdf(streams ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	for i, s := range streams {
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		w.Write([]byte(s))
+		w.Close()
+		fmt.Fprintf(&b, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", i+1, z.Len())
+		b.Write(z.Bytes())
+		b.WriteString("\nendstream\nendobj\n")
+	}
+	return b.Bytes()
+}
+
+func TestFirstPage(t *testing.T) {
+	data := pdf(
+		"q 1 0 0 1 0 0 cm Q",
+		"BT /F1 12 Tf 72 720 Td (Hello \\(PDF\\)) Tj 0 -14 Td [(Wor) 20 (ld) -300 (again)] TJ ET",
+		"BT (Second page) Tj ET",
+	)
+
+	text, err := FirstPage(data, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello (PDF)\nWorld again", text)
+
+	text, err = FirstPage(data, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", text)
+}
+
+func TestFirstPageHex(t *testing.T) {
+	text, err := FirstPage(pdf("BT <48692E> Tj T* <00480069> Tj ET"), 1024)
+	require.NoError(t, err)
+	assert.Equal(t, "Hi.\nHi", text)
+}
+
+func TestFirstPageTruncated(t *testing.T) {
+	data := pdf("BT (Cut off) Tj ET")
+	_, err := FirstPage(data[:20], 1024)
+	assert.ErrorIs(t, err, ErrNoText)
+}
+
+func TestDecodeLimit(t *testing.T) {
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	w.Write(make([]byte, 2*maxStreamSize))
+	w.Close()
+
+	out, ok := decode([]byte("<< /Filter /FlateDecode >>"), z.Bytes())
+	require.True(t, ok)
+	assert.Len(t, out, maxStreamSize)
+}
@@ -0,0 +1,30 @@
+package playlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Track struct {
+	Title    string
+	URL      string
+	Duration int
+}
+
+// Write renders tracks as an extended M3U playlist. Unknown durations are
+// written as -1 as the format expects.
+func Write(w io.Writer, tracks []Track) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("#EXTM3U\n")
+	for _, track := range tracks {
+		duration := track.Duration
+		if duration <= 0 {
+			duration = -1
+		}
+		title := strings.NewReplacer("\n", " ", "\r", " ").Replace(track.Title)
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n%s\n", duration, title, track.URL)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,31 @@
+package quickhash
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanges(t *testing.T) {
+	assert.Nil(t, Ranges(0))
+	assert.Equal(t, [][2]int64{{0, 99}}, Ranges(100))
+	assert.Equal(t, [][2]int64{{0, Window - 1}}, Ranges(Window))
+	assert.Equal(t, [][2]int64{{0, Window - 1}, {1, Window}}, Ranges(Window+1))
+	assert.Equal(t, [][2]int64{{0, Window - 1}, {10*Window - Window, 10*Window - 1}}, Ranges(10*Window))
+}
+
+func TestSum(t *testing.T) {
+	file := bytes.Repeat([]byte("teldrive"), Window)
+	size := int64(len(file))
+
+	var chunks [][]byte
+	for _, r := range Ranges(size) {
+		chunks = append(chunks, file[r[0]:r[1]+1])
+	}
+	sum := Sum(size, chunks...)
+	assert.Len(t, sum, 64)
+
+	assert.NotEqual(t, sum, Sum(size+1, chunks...))
+	assert.Equal(t, "af5570f5a1810b7af78caf4bc70a660f0df51e42baf91d4de5b2328de0e83dfc", Sum(0))
+}
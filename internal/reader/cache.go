@@ -0,0 +1,113 @@
+package reader
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/divyam234/teldrive/pkg/types"
+)
+
+// ChunkCache keeps whole chunks of documents in memory so the requests
+// players send for the index of a video are answered without Telegram. The
+// least recently used chunks go first once it holds more than its size.
+type ChunkCache struct {
+	mu    sync.Mutex
+	size  int64
+	used  int64
+	order *list.List
+	items map[blockKey]*list.Element
+}
+
+type blockKey struct {
+	doc    int64
+	offset int64
+}
+
+type cachedBlock struct {
+	key  blockKey
+	data []byte
+}
+
+// NewChunkCache returns a cache holding up to size bytes, or nil when size is
+// not positive. A nil cache holds nothing.
+func NewChunkCache(size int64) *ChunkCache {
+	if size <= 0 {
+		return nil
+	}
+	return &ChunkCache{size: size, order: list.New(), items: make(map[blockKey]*list.Element)}
+}
+
+// get returns the limit bytes at offset of doc when the chunk holding them is
+// cached. Requests are aligned to their size, which divides maxChunkSize, so
+// a request never spans two chunks.
+func (c *ChunkCache) get(doc, offset, limit int64) (*chunk, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := blockKey{doc: doc, offset: offset - offset%maxChunkSize}
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	data := el.Value.(*cachedBlock).data
+	from := min(offset-key.offset, int64(len(data)))
+	to := min(from+limit, int64(len(data)))
+	return newChunk(data[from:to]), true
+}
+
+// Slices returns the bytes start to end of the document made of parts when
+// the cache holds every chunk they span. The slices share the memory of the
+// cache, which is never written once a chunk is stored, so a range is served
+// without copying or Telegram; they must not be modified.
+func (c *ChunkCache) Slices(parts []types.Part, start, end int64) ([][]byte, bool) {
+	if c == nil || len(parts) == 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var slices [][]byte
+	for _, r := range calculatePartByteRanges(start, end, parts[0].Size) {
+		if r.PartNo >= int64(len(parts)) {
+			return nil, false
+		}
+		doc := parts[r.PartNo].Location.ID
+		for offset := r.Start - r.Start%maxChunkSize; offset <= r.End; offset += maxChunkSize {
+			el, ok := c.items[blockKey{doc: doc, offset: offset}]
+			if !ok {
+				return nil, false
+			}
+			c.order.MoveToFront(el)
+			data := el.Value.(*cachedBlock).data
+			from := max(r.Start, offset) - offset
+			to := min(r.End, offset+maxChunkSize-1) - offset + 1
+			if to > int64(len(data)) {
+				return nil, false
+			}
+			slices = append(slices, data[from:to])
+		}
+	}
+	return slices, true
+}
+
+// put stores a copy of the whole chunk at offset of doc.
+func (c *ChunkCache) put(doc, offset int64, data []byte) {
+	if c == nil || int64(len(data)) > c.size {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := blockKey{doc: doc, offset: offset}
+	if _, ok := c.items[key]; ok {
+		return
+	}
+	c.items[key] = c.order.PushFront(&cachedBlock{key: key, data: append([]byte(nil), data...)})
+	c.used += int64(len(data))
+	for c.used > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*cachedBlock)
+		delete(c.items, oldest.key)
+		c.used -= int64(len(oldest.data))
+	}
+}
@@ -0,0 +1,222 @@
+package reader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"golang.org/x/sync/singleflight"
+)
+
+// dcRouter sends file requests to the data center a document is stored in.
+// Documents start on the client's own DC and are pinned to another one after
+// the first FILE_MIGRATE error, so the remaining chunks go there directly.
+type dcRouter struct {
+	ctx    context.Context
+	client *telegram.Client
+	api    tg.Invoker
+	mu     sync.Mutex
+	dc     func(ctx context.Context, id int) (tg.Invoker, error)
+	routes map[int]tg.Invoker
+	pools  map[int]telegram.CloseInvoker
+	docs   map[int64]int
+	// prefetch is the number of chunks requested ahead of the reader
+	prefetch int
+	// chunkTimeout bounds each chunk request, 0 leaves them unbounded
+	chunkTimeout time.Duration
+	// cache answers requests for chunks it holds, fill stores the fetched ones
+	cache *ChunkCache
+	fill  bool
+}
+
+// Option configures how a reader talks to Telegram.
+type Option func(d *dcRouter)
+
+// WithInvoker sends requests for documents on the client's own DC through inv,
+// typically a connection pool, instead of the client's main connection.
+func WithInvoker(inv tg.Invoker) Option {
+	return func(d *dcRouter) {
+		if inv != nil {
+			d.api = inv
+		}
+	}
+}
+
+// WithDC gets the connections to other DCs from dc, typically ones shared by
+// all readers of a client, instead of opening them for this reader alone. The
+// reader leaves closing them to dc.
+func WithDC(dc func(ctx context.Context, id int) (tg.Invoker, error)) Option {
+	return func(d *dcRouter) {
+		d.dc = dc
+	}
+}
+
+// WithPrefetch keeps up to n chunk requests in flight ahead of the reader. Zero
+// fetches chunks one at a time as they are read.
+func WithPrefetch(n int) Option {
+	return func(d *dcRouter) {
+		d.prefetch = max(n, 0)
+	}
+}
+
+// WithChunkTimeout fails a chunk request that takes longer than d, so a stalled
+// call does not hold the reader and its client forever.
+func WithChunkTimeout(d time.Duration) Option {
+	return func(r *dcRouter) {
+		r.chunkTimeout = max(d, 0)
+	}
+}
+
+// WithCache answers requests for chunks held by c from memory.
+func WithCache(c *ChunkCache) Option {
+	return func(d *dcRouter) {
+		d.cache = c
+	}
+}
+
+// WithCacheFill stores the whole chunks the reader fetches in its cache.
+func WithCacheFill() Option {
+	return func(d *dcRouter) {
+		d.fill = true
+	}
+}
+
+func newDCRouter(ctx context.Context, client *telegram.Client, opts ...Option) *dcRouter {
+	d := &dcRouter{
+		ctx:    ctx,
+		client: client,
+		api:    client,
+		routes: make(map[int]tg.Invoker),
+		pools:  make(map[int]telegram.CloseInvoker),
+		docs:   make(map[int64]int),
+	}
+	d.dc = d.open
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+func (d *dcRouter) invoker(location *tg.InputDocumentFileLocation) tg.Invoker {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dc, ok := d.docs[location.ID]; ok {
+		return d.routes[dc]
+	}
+	return d.api
+}
+
+func (d *dcRouter) migrate(location *tg.InputDocumentFileLocation, dc int) (tg.Invoker, error) {
+	api, err := d.dc(d.ctx, dc)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes[dc] = api
+	d.docs[location.ID] = dc
+	return api, nil
+}
+
+// open connects to dc for this reader alone, the connection is closed with it.
+func (d *dcRouter) open(ctx context.Context, dc int) (tg.Invoker, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if pool, ok := d.pools[dc]; ok {
+		return pool, nil
+	}
+	// DC exports the current authorization and imports it on the target DC
+	pool, err := d.client.DC(ctx, dc, 1)
+	if err != nil {
+		return nil, err
+	}
+	d.pools[dc] = pool
+	return pool, nil
+}
+
+// flights coalesces identical chunk requests of concurrent streams, so a file
+// many viewers watch at once is fetched from Telegram once per chunk.
+var flights singleflight.Group
+
+// getFile returns a chunk whose bytes sit in a pooled buffer, which the caller
+// releases once it is done with them. A request already in flight for another
+// stream is waited for instead of sent again.
+func (d *dcRouter) getFile(ctx context.Context, location *tg.InputDocumentFileLocation,
+	req *tg.UploadGetFileRequest) (*chunk, error) {
+	if c, ok := d.cache.get(location.ID, req.Offset, int64(req.Limit)); ok {
+		return c, nil
+	}
+	key := fmt.Sprintf("%d:%d:%d", location.ID, req.Offset, req.Limit)
+	flight := flights.DoChan(key, func() (any, error) {
+		return d.fetch(ctx, location, req)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-flight:
+		if res.Err != nil {
+			// the stream that sent the request went away, this one still wants the chunk
+			if res.Shared && errors.Is(res.Err, context.Canceled) && ctx.Err() == nil {
+				return d.fetch(ctx, location, req)
+			}
+			return nil, res.Err
+		}
+		c := res.Val.(*chunk)
+		if d.fill && req.Limit == maxChunkSize && req.Offset%maxChunkSize == 0 {
+			d.cache.put(location.ID, req.Offset, c.data)
+		}
+		if res.Shared {
+			// every stream releases its own buffer, the shared one is left to the collector
+			return c.clone(), nil
+		}
+		return c, nil
+	}
+}
+
+// fetch requests a chunk and decodes its bytes into a pooled buffer.
+func (d *dcRouter) fetch(ctx context.Context, location *tg.InputDocumentFileLocation,
+	req *tg.UploadGetFileRequest) (*chunk, error) {
+	if d.chunkTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.chunkTimeout)
+		defer cancel()
+	}
+	res := &chunk{}
+	err := d.invoker(location).Invoke(ctx, req, res)
+	if rpcErr, ok := tgerr.AsType(err, "FILE_MIGRATE"); ok {
+		api, err := d.migrate(location, rpcErr.Argument)
+		if err != nil {
+			return nil, err
+		}
+		res.release()
+		res = &chunk{}
+		if err := api.Invoke(ctx, req, res); err != nil {
+			res.release()
+			return nil, err
+		}
+		return res, nil
+	}
+	if err != nil {
+		res.release()
+		return nil, err
+	}
+	return res, nil
+}
+
+func (d *dcRouter) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var err error
+	for dc, pool := range d.pools {
+		if cerr := pool.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(d.pools, dc)
+	}
+	return err
+}
@@ -14,7 +14,7 @@ type decrpytedReader struct {
 	parts         []types.Part
 	ranges        []types.Range
 	pos           int
-	client        *telegram.Client
+	router        *dcRouter
 	reader        io.ReadCloser
 	limit         int64
 	err           error
@@ -26,12 +26,13 @@ func NewDecryptedReader(
 	client *telegram.Client,
 	parts []types.Part,
 	start, end int64,
-	encryptionKey string) (io.ReadCloser, error) {
+	encryptionKey string,
+	opts ...Option) (io.ReadCloser, error) {
 
 	r := &decrpytedReader{
 		ctx:           ctx,
 		parts:         parts,
-		client:        client,
+		router:        newDCRouter(ctx, client, opts...),
 		limit:         end - start + 1,
 		ranges:        calculatePartByteRanges(start, end, parts[0].DecryptedSize),
 		encryptionKey: encryptionKey,
@@ -70,7 +71,11 @@ func (r *decrpytedReader) Read(p []byte) (n int, err error) {
 		}
 		r.pos++
 		if r.pos < len(r.ranges) {
-			r.reader, err = r.nextPart()
+			r.reader.Close()
+			r.reader = nil
+			if err = r.ctx.Err(); err == nil {
+				r.reader, err = r.nextPart()
+			}
 		}
 	}
 	r.err = err
@@ -81,9 +86,11 @@ func (r *decrpytedReader) Close() (err error) {
 	if r.reader != nil {
 		err = r.reader.Close()
 		r.reader = nil
-		return err
 	}
-	return nil
+	if cerr := r.router.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
 func (r *decrpytedReader) nextPart() (io.ReadCloser, error) {
@@ -105,7 +112,7 @@ func (r *decrpytedReader) nextPart() (io.ReadCloser, error) {
 				end = min(r.parts[r.ranges[r.pos].PartNo].Size-1, underlyingOffset+underlyingLimit-1)
 			}
 
-			return newTGReader(r.ctx, r.client, location, underlyingOffset, end)
+			return newTGReader(r.ctx, r.router, location, underlyingOffset, end)
 		}, start, end-start+1)
 
 }
@@ -0,0 +1,138 @@
+package reader
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// maxChunkSize is the largest chunk calculateChunkSize picks.
+	maxChunkSize = 1024 * 1024
+)
+
+// Chunk buffers are reused across requests, as every stream would otherwise
+// allocate a megabyte per chunk and keep the collector busy.
+var chunkPool = sync.Pool{New: func() any {
+	buf := make([]byte, maxChunkSize)
+	return &buf
+}}
+
+// copyPools holds a pool of copy buffers for each size in use.
+var copyPools sync.Map
+
+func copyPool(size int) *sync.Pool {
+	if pool, ok := copyPools.Load(size); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := copyPools.LoadOrStore(size, &sync.Pool{New: func() any {
+		buf := make([]byte, size)
+		return &buf
+	}})
+	return pool.(*sync.Pool)
+}
+
+// chunk is the result of upload.getFile, decoded straight into a pooled
+// buffer rather than into a fresh slice as the generated decoder does.
+type chunk struct {
+	buf  *[]byte
+	data []byte
+}
+
+func (c *chunk) Decode(b *bin.Buffer) error {
+	id, err := b.PeekID()
+	if err != nil {
+		return err
+	}
+	if id != tg.UploadFileTypeID {
+		return fmt.Errorf("unexpected type %#x", id)
+	}
+	if err := b.ConsumeID(tg.UploadFileTypeID); err != nil {
+		return err
+	}
+	if _, err := tg.DecodeStorageFileType(b); err != nil {
+		return err
+	}
+	// mtime
+	if _, err := b.Int(); err != nil {
+		return err
+	}
+	return c.decodeBytes(b)
+}
+
+// decodeBytes reads a TL byte string: a one byte length, or 254 and a three
+// byte length, then the bytes padded to four.
+func (c *chunk) decodeBytes(b *bin.Buffer) error {
+	if len(b.Buf) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	n, header := int(b.Buf[0]), 1
+	if n == 254 {
+		if len(b.Buf) < 4 {
+			return io.ErrUnexpectedEOF
+		}
+		n, header = int(b.Buf[1])|int(b.Buf[2])<<8|int(b.Buf[3])<<16, 4
+	}
+	padded := (header + n + 3) &^ 3
+	if len(b.Buf) < padded {
+		return io.ErrUnexpectedEOF
+	}
+
+	// a retried request is decoded again
+	c.release()
+	if n <= maxChunkSize {
+		c.buf = chunkPool.Get().(*[]byte)
+		c.data = (*c.buf)[:n]
+	} else {
+		c.data = make([]byte, n)
+	}
+	copy(c.data, b.Buf[header:header+n])
+	b.Buf = b.Buf[padded:]
+	return nil
+}
+
+// newChunk copies data into a chunk with a buffer of its own.
+func newChunk(data []byte) *chunk {
+	res := &chunk{}
+	if len(data) <= maxChunkSize {
+		res.buf = chunkPool.Get().(*[]byte)
+		res.data = (*res.buf)[:len(data)]
+	} else {
+		res.data = make([]byte, len(data))
+	}
+	copy(res.data, data)
+	return res
+}
+
+// clone copies the data into a buffer of its own.
+func (c *chunk) clone() *chunk {
+	return newChunk(c.data)
+}
+
+// release hands the buffer back to the pool. The data must not be used after.
+func (c *chunk) release() {
+	if c == nil || c.buf == nil {
+		return
+	}
+	chunkPool.Put(c.buf)
+	c.buf, c.data = nil, nil
+}
+
+// CopyN copies n bytes from src to dst like io.CopyN, through a pooled buffer
+// of size bytes, so dst is written at most size bytes at a time.
+func CopyN(dst io.Writer, src io.Reader, n int64, size int) (int64, error) {
+	pool := copyPool(size)
+	buf := pool.Get().(*[]byte)
+	defer pool.Put(buf)
+	written, err := io.CopyBuffer(dst, io.LimitReader(src, n), *buf)
+	if written == n {
+		return n, nil
+	}
+	if written < n && err == nil {
+		err = io.EOF
+	}
+	return written, err
+}
@@ -40,7 +40,7 @@ type linearReader struct {
 	parts  []types.Part
 	ranges []types.Range
 	pos    int
-	client *telegram.Client
+	router *dcRouter
 	reader io.ReadCloser
 	limit  int64
 	err    error
@@ -50,12 +50,13 @@ func NewLinearReader(ctx context.Context,
 	client *telegram.Client,
 	parts []types.Part,
 	start, end int64,
+	opts ...Option,
 ) (reader io.ReadCloser, err error) {
 
 	r := &linearReader{
 		ctx:    ctx,
 		parts:  parts,
-		client: client,
+		router: newDCRouter(ctx, client, opts...),
 		limit:  end - start + 1,
 		ranges: calculatePartByteRanges(start, end, parts[0].Size),
 	}
@@ -91,8 +92,11 @@ func (r *linearReader) Read(p []byte) (n int, err error) {
 		}
 		r.pos++
 		if r.pos < len(r.ranges) {
-			r.reader, err = r.nextPart()
-
+			r.reader.Close()
+			r.reader = nil
+			if err = r.ctx.Err(); err == nil {
+				r.reader, err = r.nextPart()
+			}
 		}
 	}
 	r.err = err
@@ -105,14 +109,16 @@ func (r *linearReader) nextPart() (io.ReadCloser, error) {
 	startByte := r.ranges[r.pos].Start
 	endByte := r.ranges[r.pos].End
 
-	return newTGReader(r.ctx, r.client, location, startByte, endByte)
+	return newTGReader(r.ctx, r.router, location, startByte, endByte)
 }
 
 func (r *linearReader) Close() (err error) {
 	if r.reader != nil {
 		err = r.reader.Close()
 		r.reader = nil
-		return err
 	}
-	return nil
+	if cerr := r.router.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
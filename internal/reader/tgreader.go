@@ -2,20 +2,20 @@ package reader
 
 import (
 	"context"
-	"fmt"
 	"io"
 
-	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
 )
 
 type tgReader struct {
 	ctx       context.Context
-	client    *telegram.Client
+	cancel    context.CancelFunc
+	router    *dcRouter
 	location  *tg.InputDocumentFileLocation
 	start     int64
 	end       int64
-	next      func() ([]byte, error)
+	next      func() (*chunk, error)
+	current   *chunk
 	buffer    []byte
 	limit     int64
 	chunkSize int64
@@ -34,7 +34,7 @@ func calculateChunkSize(start, end int64) int64 {
 
 func newTGReader(
 	ctx context.Context,
-	client *telegram.Client,
+	router *dcRouter,
 	location *tg.InputDocumentFileLocation,
 	start int64,
 	end int64,
@@ -44,7 +44,7 @@ func newTGReader(
 	r := &tgReader{
 		ctx:       ctx,
 		location:  location,
-		client:    client,
+		router:    router,
 		start:     start,
 		end:       end,
 		chunkSize: calculateChunkSize(start, end),
@@ -61,18 +61,25 @@ func (r *tgReader) Read(p []byte) (n int, err error) {
 	}
 
 	if r.i >= int64(len(r.buffer)) {
-		r.buffer, err = r.next()
+		// no more chunks are requested for a reader nobody waits for
+		if err := r.ctx.Err(); err != nil {
+			return 0, err
+		}
+		// the previous chunk was read whole, its buffer goes back to the pool
+		r.current.release()
+		r.current, r.buffer = nil, nil
+		c, err := r.next()
 		if err != nil {
 			return 0, err
 		}
-		if len(r.buffer) == 0 {
+		if len(c.data) == 0 {
 			r.next = r.partStream()
-			r.buffer, err = r.next()
+			c, err = r.next()
 			if err != nil {
 				return 0, err
 			}
-
 		}
+		r.current, r.buffer = c, c.data
 		r.i = 0
 	}
 	n = copy(p, r.buffer[r.i:])
@@ -82,11 +89,16 @@ func (r *tgReader) Read(p []byte) (n int, err error) {
 	return
 }
 
-func (*tgReader) Close() error {
+func (r *tgReader) Close() error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.current.release()
+	r.current, r.buffer = nil, nil
 	return nil
 }
 
-func (r *tgReader) chunk(offset int64, limit int64) ([]byte, error) {
+func (r *tgReader) chunk(ctx context.Context, offset int64, limit int64) (*chunk, error) {
 
 	req := &tg.UploadGetFileRequest{
 		Offset:   offset,
@@ -95,21 +107,19 @@ func (r *tgReader) chunk(offset int64, limit int64) ([]byte, error) {
 		Precise:  true,
 	}
 
-	res, err := r.client.API().UploadGetFile(r.ctx, req)
+	res, err := r.router.getFile(ctx, r.location, req)
 
 	if err != nil {
+		// report the cancellation rather than what it made the call fail with
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
-
-	switch result := res.(type) {
-	case *tg.UploadFile:
-		return result.Bytes, nil
-	default:
-		return nil, fmt.Errorf("unexpected type %T", r)
-	}
+	return res, nil
 }
 
-func (r *tgReader) partStream() func() ([]byte, error) {
+func (r *tgReader) partStream() func() (*chunk, error) {
 
 	start := r.start
 	end := r.end
@@ -120,22 +130,29 @@ func (r *tgReader) partStream() func() ([]byte, error) {
 	totalParts := int((end - offset + r.chunkSize) / r.chunkSize)
 	currentPart := 1
 
-	return func() ([]byte, error) {
+	fetch := func(offset int64) (*chunk, error) {
+		return r.chunk(r.ctx, offset, r.chunkSize)
+	}
+	if r.router.prefetch > 0 {
+		fetch = r.prefetcher(offset, totalParts)
+	}
+
+	return func() (*chunk, error) {
 		if currentPart > totalParts {
-			return make([]byte, 0), nil
+			return &chunk{}, nil
 		}
-		res, err := r.chunk(offset, r.chunkSize)
+		res, err := fetch(offset)
 		if err != nil {
 			return nil, err
 		}
-		if len(res) == 0 {
+		if len(res.data) == 0 {
 			return res, nil
 		} else if totalParts == 1 {
-			res = res[leftCut:rightCut]
+			res.data = res.data[leftCut:rightCut]
 		} else if currentPart == 1 {
-			res = res[leftCut:]
+			res.data = res.data[leftCut:]
 		} else if currentPart == totalParts {
-			res = res[:rightCut]
+			res.data = res.data[:rightCut]
 		}
 
 		currentPart++
@@ -143,3 +160,50 @@ func (r *tgReader) partStream() func() ([]byte, error) {
 		return res, nil
 	}
 }
+
+type chunkResult struct {
+	chunk *chunk
+	err   error
+}
+
+// prefetcher requests count chunks starting at offset ahead of the reader,
+// keeping up to router.prefetch requests in flight. The returned func yields
+// the chunks in order and ignores its argument.
+func (r *tgReader) prefetcher(offset int64, count int) func(int64) (*chunk, error) {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.cancel = cancel
+
+	queue := make(chan chan chunkResult, r.router.prefetch)
+
+	go func() {
+		defer close(queue)
+		for i := range count {
+			res := make(chan chunkResult, 1)
+			select {
+			case queue <- res:
+			case <-ctx.Done():
+				return
+			}
+			go func(offset int64) {
+				c, err := r.chunk(ctx, offset, r.chunkSize)
+				res <- chunkResult{chunk: c, err: err}
+			}(offset + int64(i)*r.chunkSize)
+		}
+	}()
+
+	return func(int64) (*chunk, error) {
+		select {
+		case res, ok := <-queue:
+			if !ok {
+				return nil, io.ErrUnexpectedEOF
+			}
+			result := <-res
+			return result.chunk, result.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
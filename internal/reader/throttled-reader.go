@@ -0,0 +1,45 @@
+package reader
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// NewThrottledReader limits reads from r to bytesPerSec. A non-positive rate
+// returns r unchanged.
+func NewThrottledReader(ctx context.Context, r io.Reader, bytesPerSec int) io.Reader {
+	if bytesPerSec <= 0 {
+		return r
+	}
+	return NewLimitedReader(ctx, r, rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec))
+}
+
+// NewLimitedReader limits reads from r with limiter, which may be shared by
+// several readers to cap their combined rate. A nil limiter returns r unchanged.
+func NewLimitedReader(ctx context.Context, r io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.limiter.Burst() {
+		p = p[:t.limiter.Burst()]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.limiter.WaitN(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
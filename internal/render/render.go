@@ -0,0 +1,151 @@
+// Package render converts office documents to PDF through an external
+// conversion service, so they can be previewed in the browser.
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/divyam234/teldrive/internal/config"
+)
+
+var ErrDisabled = errors.New("document rendering is not configured")
+
+// Renderer converts documents to PDF.
+type Renderer interface {
+	// Supports reports whether the document named name can be converted.
+	Supports(name string) bool
+	// Render converts the document named name read from r.
+	Render(ctx context.Context, name string, r io.Reader) ([]byte, error)
+}
+
+// Factory creates the renderer of a backend from its settings.
+type Factory func(cnf *config.RenderConfig, client *http.Client) Renderer
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]Factory{
+		"gotenberg": newGotenberg,
+		"collabora": newCollabora,
+	}
+)
+
+// Register makes a backend available under name to the render-backend setting.
+func Register(name string, f Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = f
+}
+
+// New returns the renderer selected by the configuration. Without a backend
+// it returns a renderer that supports nothing.
+func New(cnf *config.Config) (Renderer, error) {
+	rc := &cnf.Render
+	if rc.Backend == "" {
+		return disabled{}, nil
+	}
+	backendsMu.RLock()
+	f, ok := backends[rc.Backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown render backend %q", rc.Backend)
+	}
+	if rc.Url == "" {
+		return nil, fmt.Errorf("render backend %s needs a url", rc.Backend)
+	}
+	return f(rc, &http.Client{Timeout: rc.Timeout}), nil
+}
+
+type disabled struct{}
+
+func (disabled) Supports(string) bool { return false }
+
+func (disabled) Render(context.Context, string, io.Reader) ([]byte, error) {
+	return nil, ErrDisabled
+}
+
+// officeExtensions are the formats LibreOffice based services convert.
+var officeExtensions = []string{
+	"doc", "docx", "odt", "rtf", "xls", "xlsx", "ods", "csv", "ppt", "pptx", "pps", "ppsx", "odp", "odg",
+}
+
+func isOffice(name string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	for _, e := range officeExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// formService posts the document as a multipart form and expects the PDF as
+// the response body, which is how both Gotenberg and Collabora work.
+type formService struct {
+	url    string
+	field  string
+	client *http.Client
+}
+
+func newGotenberg(cnf *config.RenderConfig, client *http.Client) Renderer {
+	return &formService{url: strings.TrimSuffix(cnf.Url, "/") + "/forms/libreoffice/convert", field: "files",
+		client: client}
+}
+
+func newCollabora(cnf *config.RenderConfig, client *http.Client) Renderer {
+	return &formService{url: strings.TrimSuffix(cnf.Url, "/") + "/cool/convert-to/pdf", field: "data",
+		client: client}
+}
+
+func (s *formService) Supports(name string) bool {
+	return isOffice(name)
+}
+
+func (s *formService) Render(ctx context.Context, name string, r io.Reader) ([]byte, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		part, err := form.CreateFormFile(s.field, filepath.Base(name))
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, res.Body); err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(buf.String())
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		return nil, fmt.Errorf("render service: %s: %s", res.Status, msg)
+	}
+	return buf.Bytes(), nil
+}
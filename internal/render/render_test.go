@@ -0,0 +1,59 @@
+package render
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGotenberg(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/forms/libreoffice/convert", r.URL.Path)
+		f, h, err := r.FormFile("files")
+		require.NoError(t, err)
+		assert.Equal(t, "report.docx", h.Filename)
+		body, _ := io.ReadAll(f)
+		w.Write([]byte("%PDF " + string(body)))
+	}))
+	defer srv.Close()
+
+	cnf := &config.Config{Render: config.RenderConfig{Backend: "gotenberg", Url: srv.URL + "/"}}
+	r, err := New(cnf)
+	require.NoError(t, err)
+
+	assert.True(t, r.Supports("report.DOCX"))
+	assert.False(t, r.Supports("movie.mkv"))
+
+	pdf, err := r.Render(context.Background(), "docs/report.docx", strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF hello", string(pdf))
+}
+
+func TestRenderError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "conversion failed", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	r, err := New(&config.Config{Render: config.RenderConfig{Backend: "collabora", Url: srv.URL}})
+	require.NoError(t, err)
+
+	_, err = r.Render(context.Background(), "a.odt", strings.NewReader("x"))
+	assert.ErrorContains(t, err, "conversion failed")
+}
+
+func TestNew(t *testing.T) {
+	r, err := New(&config.Config{})
+	require.NoError(t, err)
+	assert.False(t, r.Supports("a.docx"))
+
+	_, err = New(&config.Config{Render: config.RenderConfig{Backend: "nope", Url: "http://x"}})
+	assert.Error(t, err)
+}
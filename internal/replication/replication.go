@@ -0,0 +1,147 @@
+// Package replication carries the metadata of a primary teldrive instance to
+// its replicas. The primary serves a feed of its accounts and of the files
+// changed since a cursor, which replicas pull over HTTP with a shared token.
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/models"
+)
+
+// PageSize is the most files a page of the feed holds.
+const PageSize = 500
+
+const requestTimeout = time.Minute
+
+// Accounts are replicated whole on every pull, as they are few. Sessions are
+// part of them so the replica can reach the channels of its users, only when
+// the primary has the public key of the replica to seal them to.
+type Accounts struct {
+	Users    []models.User    `json:"users"`
+	Sessions []Session        `json:"sessions"`
+	Channels []models.Channel `json:"channels"`
+}
+
+// Session is a Telegram session of the primary sealed to the public key of
+// the replica, so only the replica can open it.
+type Session struct {
+	UserID    int64     `json:"userId"`
+	Hash      string    `json:"hash"`
+	Sealed    string    `json:"sealed"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Cursor orders the files of the feed by their last update, then by id.
+type Cursor struct {
+	UpdatedAt time.Time `json:"updatedAt"`
+	ID        string    `json:"id"`
+}
+
+// Changes is a page of the active files updated after a cursor. Latest is
+// when the newest file of the primary was updated, so a replica can tell how
+// far behind it is.
+type Changes struct {
+	Files  []models.File `json:"files"`
+	Next   Cursor        `json:"next"`
+	Latest time.Time     `json:"latest"`
+}
+
+// Version identifies the state of a file for reconciliation.
+type Version struct {
+	ID        string    `json:"id"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Versions is a page of the active files of the primary ordered by id.
+type Versions struct {
+	Files []Version `json:"files"`
+}
+
+// Client pulls the feed of a primary.
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+func NewClient(primaryUrl, token string) *Client {
+	return &Client{base: strings.TrimSuffix(primaryUrl, "/") + "/api/replication", token: token,
+		http: &http.Client{Timeout: requestTimeout}}
+}
+
+func (c *Client) Accounts(ctx context.Context) (*Accounts, error) {
+	var res Accounts
+	if err := c.do(ctx, http.MethodGet, "/accounts", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Changes returns the files updated after cursor.
+func (c *Client) Changes(ctx context.Context, cursor Cursor) (*Changes, error) {
+	q := url.Values{}
+	q.Set("since", cursor.UpdatedAt.Format(time.RFC3339Nano))
+	q.Set("after", cursor.ID)
+	var res Changes
+	if err := c.do(ctx, http.MethodGet, "/changes?"+q.Encode(), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Versions returns the versions of the files whose id sorts after after.
+func (c *Client) Versions(ctx context.Context, after string) (*Versions, error) {
+	var res Versions
+	if err := c.do(ctx, http.MethodGet, "/versions?after="+url.QueryEscape(after), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Files returns the active files among ids.
+func (c *Client) Files(ctx context.Context, ids []string) ([]models.File, error) {
+	body, err := json.Marshal(map[string][]string{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+	var res []models.File
+	if err := c.do(ctx, http.MethodPost, "/files", body, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("primary answered %s: %s", strconv.Itoa(res.StatusCode), bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
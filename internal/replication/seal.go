@@ -0,0 +1,74 @@
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+var errSealed = errors.New("sealed session cannot be opened")
+
+// ParseKey decodes a base64 X25519 key, public on the primary and private on
+// the replica.
+func ParseKey(s string) (*[32]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, errors.New("replication session key must be 32 bytes")
+	}
+	var key [32]byte
+	copy(key[:], b)
+	return &key, nil
+}
+
+// PublicKey returns the base64 public key of a private key, which the primary
+// seals sessions to.
+func PublicKey(private *[32]byte) (string, error) {
+	public, err := publicKey(private)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(public[:]), nil
+}
+
+func publicKey(private *[32]byte) (*[32]byte, error) {
+	b, err := curve25519.X25519(private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	var public [32]byte
+	copy(public[:], b)
+	return &public, nil
+}
+
+// SealSession encrypts session so that only the owner of the private key of
+// public can read it.
+func SealSession(session string, public *[32]byte) (string, error) {
+	sealed, err := box.SealAnonymous(nil, []byte(session), public, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSession decrypts a session sealed to the public key of private.
+func OpenSession(sealed string, private *[32]byte) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	public, err := publicKey(private)
+	if err != nil {
+		return "", err
+	}
+	session, ok := box.OpenAnonymous(nil, b, public, private)
+	if !ok {
+		return "", errSealed
+	}
+	return string(session), nil
+}
@@ -0,0 +1,41 @@
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func TestSealSession(t *testing.T) {
+	private := make([]byte, 32)
+	if _, err := rand.Read(private); err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := ParseKey(base64.StdEncoding.EncodeToString(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := PublicKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ParseKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := SealSession("session", publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSession(sealed, publicKey); err == nil {
+		t.Fatal("session opened without the private key")
+	}
+	session, err := OpenSession(sealed, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session != "session" {
+		t.Fatalf("got %q, want %q", session, "session")
+	}
+}
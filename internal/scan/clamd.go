@@ -0,0 +1,103 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+)
+
+// clamdChunkSize is how much of the file each INSTREAM chunk carries.
+const clamdChunkSize = 64 * 1024
+
+// clamd scans through the INSTREAM command of a clamd daemon, reached at
+// tcp://host:port or unix:///path/to/clamd.sock.
+type clamd struct {
+	network, addr string
+	timeout       time.Duration
+}
+
+func newClamd(cnf *config.ScanConfig, u *url.URL) (Scanner, error) {
+	switch u.Scheme {
+	case "tcp":
+		return &clamd{network: "tcp", addr: u.Host, timeout: cnf.Timeout}, nil
+	case "unix":
+		return &clamd{network: "unix", addr: u.Path, timeout: cnf.Timeout}, nil
+	}
+	return nil, fmt.Errorf("clamav scan url must be tcp:// or unix://, got %q", u.Scheme)
+}
+
+func (s *clamd) Scan(ctx context.Context, name string, r io.Reader) (*Result, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := deadline(ctx, s.timeout); ok {
+		conn.SetDeadline(deadline)
+	}
+	// closing the connection aborts a scan whose context ends
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return nil, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return nil, err
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamdReply reads replies like "stream: OK" or
+// "stream: Eicar-Signature FOUND".
+func parseClamdReply(reply string) (*Result, error) {
+	_, status, _ := strings.Cut(reply, ": ")
+	switch {
+	case status == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	}
+	return nil, fmt.Errorf("clamd: %s", reply)
+}
+
+// deadline returns the earlier of the deadline of ctx and timeout from now.
+func deadline(ctx context.Context, timeout time.Duration) (time.Time, bool) {
+	d, ok := ctx.Deadline()
+	if timeout > 0 {
+		if t := time.Now().Add(timeout); !ok || t.Before(d) {
+			d, ok = t, true
+		}
+	}
+	return d, ok
+}
@@ -0,0 +1,117 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+)
+
+// infectionHeaders are the headers ICAP servers name what they found in.
+var infectionHeaders = []string{"X-Infection-Found", "X-Virus-Id", "X-Violations-Found"}
+
+// icap sends files as the body of a RESPMOD request to an ICAP service, such
+// as icap://host:1344/avscan. Servers answer 204 for clean files.
+type icap struct {
+	url     *url.URL
+	timeout time.Duration
+}
+
+func newICAP(cnf *config.ScanConfig, u *url.URL) (Scanner, error) {
+	if u.Scheme != "icap" {
+		return nil, fmt.Errorf("icap scan url must be icap://, got %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "1344")
+	}
+	return &icap{url: u, timeout: cnf.Timeout}, nil
+}
+
+func (s *icap) Scan(ctx context.Context, name string, r io.Reader) (*Result, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.url.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := deadline(ctx, s.timeout); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	resHeader := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=" + strconv.Quote(name) + "\r\n\r\n"
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "RESPMOD %s ICAP/1.0\r\nHost: %s\r\nAllow: 204\r\nEncapsulated: res-hdr=0, res-body=%d\r\n\r\n",
+		s.url.String(), s.url.Hostname(), len(resHeader))
+	w.WriteString(resHeader)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			w.WriteString("\r\n")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.WriteString("0\r\n\r\n")
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(conn))
+	status, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return nil, err
+	}
+	return parseICAPReply(status, header)
+}
+
+func parseICAPReply(status string, header textproto.MIMEHeader) (*Result, error) {
+	_, code, _ := strings.Cut(status, " ")
+	code, _, _ = strings.Cut(code, " ")
+	switch code {
+	case "204":
+		return &Result{}, nil
+	case "200":
+		for _, name := range infectionHeaders {
+			if v := header.Get(name); v != "" {
+				return &Result{Infected: true, Signature: icapThreat(v)}, nil
+			}
+		}
+		// the content came back unmodified
+		return &Result{}, nil
+	}
+	return nil, fmt.Errorf("icap: %s", status)
+}
+
+// icapThreat picks the threat name out of values like
+// "Type=0; Resolution=2; Threat=EICAR;".
+func icapThreat(v string) string {
+	for _, field := range strings.Split(v, ";") {
+		if threat, ok := strings.CutPrefix(strings.TrimSpace(field), "Threat="); ok {
+			return threat
+		}
+	}
+	return strings.TrimSpace(v)
+}
@@ -0,0 +1,81 @@
+// Package scan streams files through an external virus scanner, a clamd
+// daemon or an ICAP server, so infected uploads can be quarantined.
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/divyam234/teldrive/internal/config"
+)
+
+var ErrDisabled = errors.New("virus scanning is not configured")
+
+// Result is the verdict on a file. Signature names what was found.
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner checks files for malware.
+type Scanner interface {
+	// Scan reads the file named name from r and returns the verdict.
+	Scan(ctx context.Context, name string, r io.Reader) (*Result, error)
+}
+
+// Factory creates the scanner of a backend from its settings.
+type Factory func(cnf *config.ScanConfig, u *url.URL) (Scanner, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]Factory{
+		"clamav": newClamd,
+		"icap":   newICAP,
+	}
+)
+
+// Register makes a backend available under name to the scan-backend setting.
+func Register(name string, f Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = f
+}
+
+// New returns the scanner selected by the configuration. Without a backend it
+// returns a scanner failing with ErrDisabled, which Enabled tells apart.
+func New(cnf *config.Config) (Scanner, error) {
+	sc := &cnf.Scan
+	if sc.Backend == "" {
+		return disabled{}, nil
+	}
+	backendsMu.RLock()
+	f, ok := backends[sc.Backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown scan backend %q", sc.Backend)
+	}
+	if sc.Url == "" {
+		return nil, fmt.Errorf("scan backend %s needs a url", sc.Backend)
+	}
+	u, err := url.Parse(sc.Url)
+	if err != nil {
+		return nil, fmt.Errorf("scan url: %w", err)
+	}
+	return f(sc, u)
+}
+
+// Enabled tells whether s scans anything.
+func Enabled(s Scanner) bool {
+	_, off := s.(disabled)
+	return s != nil && !off
+}
+
+type disabled struct{}
+
+func (disabled) Scan(context.Context, string, io.Reader) (*Result, error) {
+	return nil, ErrDisabled
+}
@@ -0,0 +1,121 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/divyam234/teldrive/internal/config"
+)
+
+// serve answers a single connection on a local listener with handle.
+func serve(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return l.Addr().String()
+}
+
+func TestClamd(t *testing.T) {
+	addr := serve(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		if cmd, _ := r.ReadString(0); cmd != "zINSTREAM\x00" {
+			return
+		}
+		var body strings.Builder
+		for {
+			var n uint32
+			if binary.Read(r, binary.BigEndian, &n) != nil || n == 0 {
+				break
+			}
+			io.CopyN(&body, r, int64(n))
+		}
+		if strings.Contains(body.String(), "EICAR") {
+			io.WriteString(conn, "stream: Eicar-Signature FOUND\x00")
+		} else {
+			io.WriteString(conn, "stream: OK\x00")
+		}
+	})
+
+	s, err := newClamd(&config.ScanConfig{}, &url.URL{Scheme: "tcp", Host: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Scan(context.Background(), "eicar.com", strings.NewReader("X5O!P%@AP EICAR test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Infected || res.Signature != "Eicar-Signature" {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestICAP(t *testing.T) {
+	addr := serve(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		// the request ends with the last chunk of the body
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || line == "0\r\n" {
+				break
+			}
+		}
+		io.WriteString(conn, "ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=EICAR;\r\n\r\n")
+	})
+
+	s, err := newICAP(&config.ScanConfig{}, &url.URL{Scheme: "icap", Host: addr, Path: "/avscan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Scan(context.Background(), "eicar.com", strings.NewReader("EICAR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Infected || res.Signature != "EICAR" {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestParseReplies(t *testing.T) {
+	if res, err := parseClamdReply("stream: OK"); err != nil || res.Infected {
+		t.Errorf("clean reply = %+v, %v", res, err)
+	}
+	if _, err := parseClamdReply("INSTREAM size limit exceeded. ERROR"); err == nil {
+		t.Error("error reply accepted")
+	}
+	if res, err := parseICAPReply("ICAP/1.0 204 No Content", nil); err != nil || res.Infected {
+		t.Errorf("clean reply = %+v, %v", res, err)
+	}
+	if _, err := parseICAPReply("ICAP/1.0 500 Server Error", nil); err == nil {
+		t.Error("error reply accepted")
+	}
+}
+
+func TestNew(t *testing.T) {
+	s, err := New(&config.Config{})
+	if err != nil || Enabled(s) {
+		t.Errorf("scanner without backend = %v, %v", s, err)
+	}
+	if _, err := New(&config.Config{Scan: config.ScanConfig{Backend: "clamav"}}); err == nil {
+		t.Error("backend without url accepted")
+	}
+	if _, err := New(&config.Config{Scan: config.ScanConfig{Backend: "clamav", Url: "http://x"}}); err == nil {
+		t.Error("wrong scheme accepted")
+	}
+}
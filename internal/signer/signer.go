@@ -0,0 +1,46 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxTTL bounds how long a signature stays valid.
+const MaxTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("signature expired")
+	ErrTTLTooLong       = errors.New("signature valid for too long")
+)
+
+func mac(secret, fileID string, userID int64, expires int64) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "%s:%d:%d", fileID, userID, expires)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Sign returns a signature granting userID's access to fileID until expires,
+// which Verify only accepts within MaxTTL.
+func Sign(secret, fileID string, userID int64, expires time.Time) string {
+	return mac(secret, fileID, userID, expires.Unix())
+}
+
+// Verify checks a signature produced by Sign.
+func Verify(secret, fileID string, userID int64, expires int64, signature string) error {
+	if !hmac.Equal([]byte(mac(secret, fileID, userID, expires)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	now := time.Now()
+	if now.Unix() > expires {
+		return ErrExpired
+	}
+	if expires > now.Add(MaxTTL).Unix() {
+		return ErrTTLTooLong
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package signer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignVerify(t *testing.T) {
+	exp := time.Now().Add(time.Hour)
+	sig := Sign("secret", "file1", 42, exp)
+
+	assert.NoError(t, Verify("secret", "file1", 42, exp.Unix(), sig))
+	assert.ErrorIs(t, Verify("other", "file1", 42, exp.Unix(), sig), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", "file2", 42, exp.Unix(), sig), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", "file1", 43, exp.Unix(), sig), ErrInvalidSignature)
+
+	past := time.Now().Add(-time.Minute)
+	assert.ErrorIs(t, Verify("secret", "file1", 42, past.Unix(), Sign("secret", "file1", 42, past)), ErrExpired)
+
+	far := time.Now().Add(MaxTTL + time.Hour)
+	assert.ErrorIs(t, Verify("secret", "file1", 42, far.Unix(), Sign("secret", "file1", 42, far)), ErrTTLTooLong)
+}
@@ -0,0 +1,89 @@
+// Package sniff determines the mime type of a file from its leading bytes,
+// falling back to its extension where the content is not conclusive.
+package sniff
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Len is the number of leading bytes Detect looks at.
+const Len = 512
+
+const generic = "application/octet-stream"
+
+// extensions covers media types missing from many system mime tables. They are
+// needed to tell containers sharing a signature apart, like mkv and webm.
+var extensions = map[string]string{
+	".mkv":  "video/x-matroska",
+	".mka":  "audio/x-matroska",
+	".webm": "video/webm",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".avi":  "video/x-msvideo",
+	".ts":   "video/mp2t",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".opus": "audio/ogg",
+	".srt":  "application/x-subrip",
+	".vtt":  "text/vtt",
+}
+
+// ByExtension returns the mime type registered for the extension of name, or
+// "" when it has none.
+func ByExtension(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := extensions[ext]; ok {
+		return t
+	}
+	t, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	return t
+}
+
+// Detect returns the mime type of the file named name starting with head.
+// The content decides the kind of file. The extension only refines audio and
+// video containers sharing a signature, text, and zip based formats, or
+// stands in when the content is not recognised.
+func Detect(name string, head []byte) string {
+	byExt := ByExtension(name)
+	if len(head) == 0 {
+		return fallback(byExt)
+	}
+
+	sniffed, params, _ := mime.ParseMediaType(http.DetectContentType(head))
+	switch {
+	case sniffed == generic:
+		return fallback(byExt)
+	case sniffed == "text/plain":
+		// text is all the sniffer can say about source code, csv, json...
+		if byExt != "" && !strings.HasPrefix(byExt, "image/") && !strings.HasPrefix(byExt, "video/") &&
+			!strings.HasPrefix(byExt, "audio/") {
+			return byExt
+		}
+	case isMedia(byExt) && isMedia(sniffed):
+		return byExt
+	case sniffed == "application/zip" && byExt != "" && strings.HasPrefix(byExt, "application/"):
+		// office documents, jars and epubs are zip files
+		return byExt
+	}
+	if sniffed == "text/plain" || sniffed == "text/html" || sniffed == "text/xml" {
+		if charset := params["charset"]; charset != "" {
+			return mime.FormatMediaType(sniffed, map[string]string{"charset": charset})
+		}
+	}
+	return sniffed
+}
+
+func fallback(t string) string {
+	if t == "" {
+		return generic
+	}
+	return t
+}
+
+func isMedia(t string) bool {
+	return strings.HasPrefix(t, "video/") || strings.HasPrefix(t, "audio/") || t == "application/ogg"
+}
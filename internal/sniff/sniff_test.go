@@ -0,0 +1,32 @@
+package sniff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	ebml := []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\xf7\x81\x01\x42\xf2\x81\x04\x42\xf3\x81\x08\x42\x82\x84webm")
+	zip := []byte("PK\x03\x04\x14\x00\x06\x00")
+
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"photo.jpg", png, "image/png"},
+		{"movie.mkv", ebml, "video/x-matroska"},
+		{"movie.bin", ebml, "video/webm"},
+		{"song.m4a", []byte("\x00\x00\x00\x18ftypM4A \x00\x00\x00\x00"), "audio/mp4"},
+		{"README", []byte("hello\n"), "text/plain; charset=utf-8"},
+		{"data.json", []byte(`{"a": 1}`), "application/json"},
+		{"report.docx", zip, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"movie.mkv", nil, "video/x-matroska"},
+		{"blob", []byte{0x00, 0x01, 0x02, 0xff}, "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Detect(tt.name, tt.head), tt.name)
+	}
+}
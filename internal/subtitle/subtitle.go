@@ -0,0 +1,71 @@
+package subtitle
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var extensions = []string{"srt", "ass", "ssa", "vtt", "sub"}
+
+var timingLine = regexp.MustCompile(`^(\d+:\d{2}:\d{2}),(\d{3})(\s+-->\s+)(\d+:\d{2}:\d{2}),(\d{3})(.*)$`)
+
+// Format returns the subtitle format of a file name or an empty string if the
+// file is not a subtitle.
+func Format(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	for _, e := range extensions {
+		if e == ext {
+			return ext
+		}
+	}
+	return ""
+}
+
+// Match reports whether subName is a sidecar subtitle for videoName and returns
+// the language tag embedded between both names (e.g. "en" for movie.en.srt).
+func Match(videoName, subName string) (string, bool) {
+	if Format(subName) == "" {
+		return "", false
+	}
+	videoBase := strings.TrimSuffix(videoName, filepath.Ext(videoName))
+	subBase := strings.TrimSuffix(subName, filepath.Ext(subName))
+
+	if strings.EqualFold(subBase, videoBase) {
+		return "", true
+	}
+	if len(subBase) > len(videoBase)+1 && strings.EqualFold(subBase[:len(videoBase)+1], videoBase+".") {
+		return subBase[len(videoBase)+1:], true
+	}
+	return "", false
+}
+
+// SRTToVTT converts SubRip subtitles to WebVTT for browser players.
+func SRTToVTT(w io.Writer, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString("WEBVTT\n\n"); err != nil {
+		return err
+	}
+
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		line = timingLine.ReplaceAllString(line, "$1.$2$3$4.$5$6")
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
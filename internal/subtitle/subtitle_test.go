@@ -0,0 +1,35 @@
+package subtitle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		video, sub string
+		lang       string
+		ok         bool
+	}{
+		{"Movie.2020.mkv", "Movie.2020.srt", "", true},
+		{"Movie.2020.mkv", "movie.2020.en.srt", "en", true},
+		{"Movie.2020.mkv", "Movie.2020.eng.forced.ass", "eng.forced", true},
+		{"Movie.2020.mkv", "Movie.2021.srt", "", false},
+		{"Movie.2020.mkv", "Movie.2020.nfo", "", false},
+	}
+	for _, tt := range tests {
+		lang, ok := Match(tt.video, tt.sub)
+		assert.Equal(t, tt.ok, ok, tt.sub)
+		assert.Equal(t, tt.lang, lang, tt.sub)
+	}
+}
+
+func TestSRTToVTT(t *testing.T) {
+	srt := "\ufeff1\r\n00:00:01,000 --> 00:00:02,500\r\nHello\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000 X1:0\r\nWorld\r\n"
+	var out bytes.Buffer
+	assert.NoError(t, SRTToVTT(&out, strings.NewReader(srt)))
+	assert.Equal(t, "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.500\nHello\n\n2\n00:00:03.000 --> 00:00:04.000 X1:0\nWorld\n", out.String())
+}
@@ -0,0 +1,173 @@
+package tgc
+
+import (
+	"context"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	StatusIdle         = "idle"
+	StatusRunning      = "running"
+	StatusReconnecting = "reconnecting"
+	StatusFailed       = "failed"
+)
+
+const (
+	pingTimeout     = 10 * time.Second
+	maxPingFailures = 3
+)
+
+// Event describes a state transition of a supervised client.
+type Event struct {
+	Name string
+	From string
+	To   string
+	Err  error
+	Time time.Time
+}
+
+type ClientStats struct {
+	Name           string        `json:"name"`
+	Status         string        `json:"status"`
+	Since          time.Time     `json:"since"`
+	Reconnects     int           `json:"reconnects"`
+	Latency        time.Duration `json:"latency"`
+	LastError      string        `json:"lastError,omitempty"`
+	Disabled       bool          `json:"disabled"`
+	Streams        int           `json:"streams"`
+	BytesServed    int64         `json:"bytesServed"`
+	Errors         int           `json:"errors"`
+	FloodWaitUntil *time.Time    `json:"floodWaitUntil,omitempty"`
+}
+
+type clientFactory func() (*telegram.Client, error)
+
+// supervise pings a running client and replaces it with a freshly connected
+// one after repeated failures. A gotd client cannot be run again once stopped,
+// so reconnecting always goes through newClient.
+func (w *StreamWorker) supervise(c *Client, newClient clientFactory, opts ...Option) {
+	interval := w.cnf.PingInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		w.mu.Lock()
+		tgClient, status := c.Tg, c.Status
+		w.mu.Unlock()
+
+		if status == StatusRunning {
+			ctx, cancel := context.WithTimeout(w.ctx, pingTimeout)
+			start := time.Now()
+			err := tgClient.Ping(ctx)
+			cancel()
+
+			if err == nil {
+				failures = 0
+				w.mu.Lock()
+				c.latency = time.Since(start)
+				w.mu.Unlock()
+				continue
+			}
+
+			failures++
+			w.mu.Lock()
+			c.lastErr = err
+			w.mu.Unlock()
+			if failures < maxPingFailures {
+				continue
+			}
+		}
+
+		w.reconnect(c, newClient, opts...)
+		failures = 0
+	}
+}
+
+func (w *StreamWorker) reconnect(c *Client, newClient clientFactory, opts ...Option) {
+	w.mu.Lock()
+	stop := c.Stop
+	w.setStatus(c, StatusReconnecting, c.lastErr)
+	w.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+
+	tgClient, err := newClient()
+	if err == nil {
+		var pool tg.Invoker
+		if stop, pool, err = w.connect(c, tgClient, opts...); err == nil {
+			w.mu.Lock()
+			c.setConn(tgClient, stop, pool)
+			c.reconnects++
+			w.setStatus(c, StatusRunning, nil)
+			w.mu.Unlock()
+			return
+		}
+	}
+
+	w.mu.Lock()
+	c.setConn(c.Tg, nil, nil)
+	w.setStatus(c, StatusFailed, err)
+	w.mu.Unlock()
+}
+
+// setStatus must be called with w.mu held.
+func (w *StreamWorker) setStatus(c *Client, status string, err error) {
+	if c.Status == status {
+		return
+	}
+	event := Event{Name: c.name, From: c.Status, To: status, Err: err, Time: time.Now()}
+	c.Status = status
+	c.since = event.Time
+	if err != nil {
+		c.lastErr = err
+	}
+
+	logger := logging.DefaultLogger()
+	if err != nil {
+		logger.Warnw("telegram client state changed", "client", event.Name, "from", event.From, "to", event.To, "err", err)
+	} else {
+		logger.Debugw("telegram client state changed", "client", event.Name, "from", event.From, "to", event.To)
+	}
+
+	for _, fn := range w.listeners {
+		go fn(event)
+	}
+}
+
+// OnEvent registers fn to be called for every client state transition.
+func (w *StreamWorker) OnEvent(fn func(Event)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Stats returns a snapshot of all clients managed by the worker.
+func (w *StreamWorker) Stats() []ClientStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := []ClientStats{}
+	for _, clients := range w.clients {
+		for _, c := range clients {
+			stats = append(stats, w.stats(c))
+		}
+	}
+	return stats
+}
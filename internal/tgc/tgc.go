@@ -2,6 +2,10 @@ package tgc
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -32,19 +36,13 @@ func defaultMiddlewares(ctx context.Context, retries int) ([]telegram.Middleware
 
 func New(ctx context.Context, config *config.TGConfig, handler telegram.UpdateHandler, storage session.Storage, middlewares ...telegram.Middleware) (*telegram.Client, error) {
 
-	var dialer dcs.DialFunc = proxy.Direct.DialContext
-	if config.Proxy != "" {
-		d, err := utils.Proxy.GetDial(config.Proxy)
-		if err != nil {
-			return nil, errors.Wrap(err, "get dialer")
-		}
-		dialer = d.DialContext
+	resolver, err := newResolver(config.Proxy)
+	if err != nil {
+		return nil, err
 	}
 
 	opts := telegram.Options{
-		Resolver: dcs.Plain(dcs.PlainOptions{
-			Dial: dialer,
-		}),
+		Resolver: resolver,
 		Device: telegram.DeviceConfig{
 			DeviceModel:    config.DeviceModel,
 			SystemVersion:  config.SystemVersion,
@@ -64,13 +62,54 @@ func New(ctx context.Context, config *config.TGConfig, handler telegram.UpdateHa
 	return telegram.NewClient(config.AppId, config.AppHash, opts), nil
 }
 
+// newResolver returns the DC resolver for the configured proxy. HTTP and
+// SOCKS5 URLs wrap a plain dialer (credentials go in the userinfo part), while
+// mtproxy://host:port?secret=... routes connections through an MTProto proxy.
+func newResolver(proxyUrl string) (dcs.Resolver, error) {
+	if proxyUrl == "" {
+		return dcs.Plain(dcs.PlainOptions{Dial: proxy.Direct.DialContext}), nil
+	}
+
+	u, err := url.Parse(proxyUrl)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse proxy url")
+	}
+
+	if u.Scheme == "mtproxy" {
+		secret, err := parseProxySecret(u.Query().Get("secret"))
+		if err != nil {
+			return nil, errors.Wrap(err, "parse proxy secret")
+		}
+		return dcs.MTProxy(u.Host, secret, dcs.MTProxyOptions{})
+	}
+
+	d, err := utils.Proxy.GetDial(proxyUrl)
+	if err != nil {
+		return nil, errors.Wrap(err, "get dialer")
+	}
+	return dcs.Plain(dcs.PlainOptions{Dial: d.DialContext}), nil
+}
+
+// parseProxySecret accepts secrets in hex, as shown by most proxy bots, or in
+// the base64 form used by tg://proxy links.
+func parseProxySecret(secret string) ([]byte, error) {
+	if secret == "" {
+		return nil, errors.New("secret is required")
+	}
+	if b, err := hex.DecodeString(secret); err == nil {
+		return b, nil
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(
+		strings.NewReplacer("+", "-", "/", "_").Replace(secret), "="))
+}
+
 func NoAuthClient(ctx context.Context, config *config.TGConfig, handler telegram.UpdateHandler, storage session.Storage) (*telegram.Client, error) {
 	middlewares, _ := defaultMiddlewares(ctx, 5)
 	middlewares = append(middlewares, ratelimit.New(rate.Every(time.Millisecond*100), 5))
 	return New(ctx, config, handler, storage, middlewares...)
 }
 
-func AuthClient(ctx context.Context, config *config.TGConfig, sessionStr string) (*telegram.Client, error) {
+func AuthClient(ctx context.Context, config *config.TGConfig, sessionStr string, extra ...telegram.Middleware) (*telegram.Client, error) {
 	data, err := session.TelethonSession(sessionStr)
 
 	if err != nil {
@@ -88,10 +127,11 @@ func AuthClient(ctx context.Context, config *config.TGConfig, sessionStr string)
 	middlewares, _ := defaultMiddlewares(ctx, 5)
 	middlewares = append(middlewares, ratelimit.New(rate.Every(time.Millisecond*
 		time.Duration(config.Rate)), config.RateBurst))
+	middlewares = append(middlewares, extra...)
 	return New(ctx, config, nil, storage, middlewares...)
 }
 
-func BotClient(ctx context.Context, KV kv.KV, config *config.TGConfig, token string, retries int) (*telegram.Client, error) {
+func BotClient(ctx context.Context, KV kv.KV, config *config.TGConfig, token string, retries int, extra ...telegram.Middleware) (*telegram.Client, error) {
 	storage := kv.NewSession(KV, kv.Key("botsession", token))
 	middlewares, _ := defaultMiddlewares(ctx, retries)
 	if config.RateLimit {
@@ -99,8 +139,19 @@ func BotClient(ctx context.Context, KV kv.KV, config *config.TGConfig, token str
 			time.Duration(config.Rate)), config.RateBurst))
 
 	}
+	middlewares = append(middlewares, extra...)
 	return New(ctx, config, nil, storage, middlewares...)
 }
+
+// BotUpdatesClient is a bot client passing the updates it receives to handler.
+// Its session is kept apart from the one BotClient uses for the same token.
+func BotUpdatesClient(ctx context.Context, KV kv.KV, config *config.TGConfig, token string,
+	handler telegram.UpdateHandler) (*telegram.Client, error) {
+	storage := kv.NewSession(KV, kv.Key("botupdatessession", token))
+	middlewares, _ := defaultMiddlewares(ctx, 5)
+	return New(ctx, config, handler, storage, middlewares...)
+}
+
 func Backoff(_clock tdclock.Clock) backoff.BackOff {
 	b := backoff.NewExponentialBackOff()
 
@@ -2,11 +2,17 @@ package tgc
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/kv"
 	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
 )
 
 type UploadWorker struct {
@@ -18,10 +24,13 @@ type UploadWorker struct {
 func (w *UploadWorker) Set(bots []string, channelId int64) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	_, ok := w.bots[channelId]
-	if !ok {
+	// parts of a file uploaded at once go round the bots of its channel, so
+	// the bots of other channels must be kept
+	if w.bots == nil {
 		w.bots = make(map[int64][]string)
 		w.currIdx = make(map[int64]int)
+	}
+	if _, ok := w.bots[channelId]; !ok {
 		w.bots[channelId] = bots
 		w.currIdx[channelId] = 0
 	}
@@ -43,16 +52,102 @@ type Client struct {
 	Tg     *telegram.Client
 	Stop   StopFunc
 	Status string
+
+	// mu guards the connection, Tg and Stop are replaced together with it
+	mu         sync.Mutex
+	pool       tg.Invoker
+	dcs        map[int]telegram.CloseInvoker
+	dcMu       sync.Mutex
+	connMu     sync.Mutex
+	name       string
+	channel    int64
+	since      time.Time
+	reconnects int
+	latency    time.Duration
+	lastErr    error
+	streams    map[int64]context.CancelFunc
+	active     atomic.Int64
+	bytes      atomic.Int64
+	errors     atomic.Int64
+	floodUntil atomic.Int64
+}
+
+var errReconnected = errors.New("tgc: client reconnected")
+
+// Invoker returns the client's connection pool, or nil when pooling is off.
+func (c *Client) Invoker() tg.Invoker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pool
+}
+
+// DC returns a connection to data center dc. It is kept until the client
+// reconnects, so readers of migrated files do not export the authorization to
+// that DC again each time.
+func (c *Client) DC(ctx context.Context, dc int) (tg.Invoker, error) {
+	c.dcMu.Lock()
+	defer c.dcMu.Unlock()
+
+	c.mu.Lock()
+	inv, ok := c.dcs[dc]
+	tgClient := c.Tg
+	c.mu.Unlock()
+	if ok {
+		return inv, nil
+	}
+
+	pool, err := tgClient.DC(ctx, dc, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Tg != tgClient {
+		pool.Close()
+		return nil, errReconnected
+	}
+	if c.dcs == nil {
+		c.dcs = make(map[int]telegram.CloseInvoker)
+	}
+	c.dcs[dc] = pool
+	return pool, nil
+}
+
+// setConn replaces the client's connection and closes the DC connections
+// opened over the previous one.
+func (c *Client) setConn(tgClient *telegram.Client, stop StopFunc, pool tg.Invoker) {
+	c.mu.Lock()
+	dcs := c.dcs
+	c.Tg, c.Stop, c.pool, c.dcs = tgClient, stop, pool, nil
+	c.mu.Unlock()
+	for _, inv := range dcs {
+		inv.Close()
+	}
 }
 
 type StreamWorker struct {
-	mu      sync.Mutex
-	bots    map[int64][]string
-	clients map[int64][]*Client
-	currIdx map[int64]int
-	cnf     *config.TGConfig
-	kv      kv.KV
-	ctx     context.Context
+	mu        sync.Mutex
+	bots      map[int64][]string
+	clients   map[int64][]*Client
+	currIdx   map[int64]int
+	cnf       *config.TGConfig
+	kv        kv.KV
+	ctx       context.Context
+	listeners []func(Event)
+	disabled  map[clientKey]bool
+	streamSeq int64
+}
+
+// clientKey names a client within the channel it serves. Several users may add
+// the same bot, each of them only controls it in their own channels.
+type clientKey struct {
+	channel int64
+	name    string
+}
+
+func (c *Client) key() clientKey {
+	return clientKey{channel: c.channel, name: c.name}
 }
 
 func (w *StreamWorker) Set(bots []string, channelId int64) {
@@ -60,13 +155,12 @@ func (w *StreamWorker) Set(bots []string, channelId int64) {
 	defer w.mu.Unlock()
 	_, ok := w.bots[channelId]
 	if !ok {
-		w.bots = make(map[int64][]string)
-		w.clients = make(map[int64][]*Client)
-		w.currIdx = make(map[int64]int)
 		w.bots[channelId] = bots
 		for _, token := range bots {
-			client, _ := BotClient(w.ctx, w.kv, w.cnf, token, 5)
-			w.clients[channelId] = append(w.clients[channelId], &Client{Tg: client, Status: "idle"})
+			c := &Client{Status: StatusIdle, name: "bot:" + strings.Split(token, ":")[0], channel: channelId,
+				since: time.Now()}
+			c.Tg, _ = BotClient(w.ctx, w.kv, w.cnf, token, 5, floodWaitRecorder(c))
+			w.clients[channelId] = append(w.clients[channelId], c)
 		}
 		w.currIdx[channelId] = 0
 	}
@@ -75,46 +169,120 @@ func (w *StreamWorker) Set(bots []string, channelId int64) {
 
 func (w *StreamWorker) Next(channelId int64) (*Client, int, error) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	clients := w.clients[channelId]
 	index := w.currIdx[channelId]
-	nextClient := w.clients[channelId][index]
-	w.currIdx[channelId] = (index + 1) % len(w.clients[channelId])
-	if nextClient.Status == "idle" {
-		stop, err := Connect(nextClient.Tg, WithBotToken(w.bots[channelId][index]))
-		if err != nil {
-			return nil, 0, err
+	// skip disabled clients and the ones the supervisor is currently replacing as
+	// long as another one is usable
+	for range len(clients) - 1 {
+		status := clients[index].Status
+		if !w.disabled[clients[index].key()] && status != StatusReconnecting && status != StatusFailed {
+			break
 		}
-		nextClient.Stop = stop
-		nextClient.Status = "running"
+		index = (index + 1) % len(clients)
+	}
+	nextClient := clients[index]
+	if w.disabled[nextClient.key()] {
+		w.mu.Unlock()
+		return nil, 0, ErrNoClients
+	}
+	w.currIdx[channelId] = (index + 1) % len(clients)
+	token := w.bots[channelId][index]
+	w.mu.Unlock()
+
+	err := w.start(nextClient, func() (*telegram.Client, error) {
+		return BotClient(w.ctx, w.kv, w.cnf, token, 5, floodWaitRecorder(nextClient))
+	}, WithBotToken(token))
+	if err != nil {
+		return nil, 0, err
 	}
 	return nextClient, index, nil
 }
 
-func (w *StreamWorker) UserWorker(client *telegram.Client, userId int64) (*Client, error) {
+func (w *StreamWorker) UserWorker(session string, userId int64) (*Client, error) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	_, ok := w.clients[userId]
+	clients, ok := w.clients[userId]
+	w.mu.Unlock()
 
 	if !ok {
-		w.clients = make(map[int64][]*Client)
-		w.clients[userId] = append(w.clients[userId], &Client{Tg: client, Status: "idle"})
-	}
-	nextClient := w.clients[userId][0]
-	if nextClient.Status == "idle" {
-		stop, err := Connect(nextClient.Tg, WithContext(w.ctx))
+		// creating the client loads the session, which must not hold up the
+		// other streams waiting for w.mu
+		c := &Client{Status: StatusIdle, name: "user:" + strconv.FormatInt(userId, 10), since: time.Now()}
+		client, err := AuthClient(w.ctx, w.cnf, session, floodWaitRecorder(c))
 		if err != nil {
 			return nil, err
 		}
-		nextClient.Stop = stop
-		nextClient.Status = "running"
+		c.Tg = client
+		w.mu.Lock()
+		if clients, ok = w.clients[userId]; !ok {
+			clients = []*Client{c}
+			w.clients[userId] = clients
+		}
+		w.mu.Unlock()
+	}
+	nextClient := clients[0]
+	err := w.start(nextClient, func() (*telegram.Client, error) {
+		return AuthClient(w.ctx, w.cnf, session, floodWaitRecorder(nextClient))
+	}, WithContext(w.ctx))
+	if err != nil {
+		return nil, err
 	}
 	return nextClient, nil
 }
 
+// start connects c if it is idle and puts it under supervision. The caller
+// must not hold w.mu, connecting waits on the network.
+func (w *StreamWorker) start(c *Client, newClient clientFactory, opts ...Option) error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	w.mu.Lock()
+	idle := c.Status == StatusIdle
+	w.mu.Unlock()
+	if !idle {
+		return nil
+	}
+
+	stop, pool, err := w.connect(c, c.Tg, opts...)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	c.setConn(c.Tg, stop, pool)
+	w.setStatus(c, StatusRunning, nil)
+	w.mu.Unlock()
+	go w.supervise(c, newClient, opts...)
+	return nil
+}
+
+// connect starts tgClient and, when pooling is enabled, opens a pool of data
+// connections to its DC so chunk requests are spread over several sockets.
+func (w *StreamWorker) connect(c *Client, tgClient *telegram.Client, opts ...Option) (StopFunc, tg.Invoker, error) {
+	stop, err := Connect(tgClient, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if w.cnf.PoolSize <= 1 {
+		return stop, nil, nil
+	}
+	pool, err := tgClient.Pool(int64(w.cnf.PoolSize))
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	return func() error {
+		pool.Close()
+		return stop()
+	}, wrapPool(c, pool), nil
+}
+
 func NewStreamWorker(ctx context.Context) func(cnf *config.Config, kv kv.KV) *StreamWorker {
 	return func(cnf *config.Config, kv kv.KV) *StreamWorker {
-		return &StreamWorker{cnf: &cnf.TG, kv: kv, ctx: ctx}
+		return &StreamWorker{cnf: &cnf.TG, kv: kv, ctx: ctx,
+			bots:     make(map[int64][]string),
+			clients:  make(map[int64][]*Client),
+			currIdx:  make(map[int64]int),
+			disabled: make(map[clientKey]bool),
+		}
 	}
 
 }
@@ -0,0 +1,163 @@
+package tgc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gotd/contrib/middleware/floodwait"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+var ErrNoClients = errors.New("no enabled clients available")
+
+// floodWaitRecorder notes flood waits returned by Telegram on c. It has to sit
+// after the flood wait middleware so that waits handled by retrying are seen.
+func floodWaitRecorder(c *Client) telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			err := next.Invoke(ctx, input, output)
+			if d, ok := tgerr.AsFloodWait(err); ok {
+				c.floodUntil.Store(time.Now().Add(d).UnixNano())
+			}
+			return err
+		}
+	})
+}
+
+// wrapPool applies the middlewares stream reads rely on to a connection pool,
+// since pooled connections bypass the client's own middleware chain.
+func wrapPool(c *Client, pool tg.Invoker) tg.Invoker {
+	var inv tg.Invoker = floodWaitRecorder(c).Handle(pool)
+	return floodwait.NewSimpleWaiter().Handle(inv)
+}
+
+// Lease is a stream slot held on a client. The slot is given back when the
+// stream context ends or when Release is called, whichever comes first, so a
+// stream whose handler panicked or returned early does not stay counted.
+type Lease struct {
+	w      *StreamWorker
+	c      *Client
+	id     int64
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   func() bool
+	freed  sync.Once
+	done   sync.Once
+}
+
+// Acquire takes a stream slot on c. The returned context is cancelled when
+// streams are rotated off the client. Release must be called once the stream
+// ends, deferring it covers panics.
+func (w *StreamWorker) Acquire(ctx context.Context, c *Client) (context.Context, *Lease) {
+	ctx, cancel := context.WithCancel(ctx)
+	l := &Lease{w: w, c: c, ctx: ctx, cancel: cancel}
+
+	w.mu.Lock()
+	w.streamSeq++
+	l.id = w.streamSeq
+	if c.streams == nil {
+		c.streams = make(map[int64]context.CancelFunc)
+	}
+	c.streams[l.id] = cancel
+	w.mu.Unlock()
+	c.active.Add(1)
+
+	l.stop = context.AfterFunc(ctx, l.free)
+	return ctx, l
+}
+
+// Release records the bytes written and the read error, if any, and gives the
+// slot back. Only the first call counts.
+func (l *Lease) Release(n int64, err error) {
+	l.done.Do(func() {
+		// errors caused by the viewer going away or by a rotation are not the client's fault
+		failed := err != nil && l.ctx.Err() == nil
+		l.c.bytes.Add(n)
+		if failed {
+			l.c.errors.Add(1)
+			l.w.mu.Lock()
+			l.c.lastErr = err
+			l.w.mu.Unlock()
+		}
+		l.stop()
+		l.cancel()
+		l.free()
+	})
+}
+
+func (l *Lease) free() {
+	l.freed.Do(func() {
+		l.w.mu.Lock()
+		delete(l.c.streams, l.id)
+		l.w.mu.Unlock()
+		l.c.active.Add(-1)
+	})
+}
+
+// SetDisabled excludes the named client from stream selection in the given
+// channels, or puts it back. It applies to channels not loaded yet as well.
+func (w *StreamWorker) SetDisabled(channelIds []int64, name string, disabled bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, channelId := range channelIds {
+		key := clientKey{channel: channelId, name: name}
+		if disabled {
+			w.disabled[key] = true
+		} else {
+			delete(w.disabled, key)
+		}
+	}
+}
+
+// Rotate cancels all streams the named client currently serves in the given
+// channels and returns how many were cancelled. Players resume with a range
+// request, which then lands on another client.
+func (w *StreamWorker) Rotate(channelIds []int64, name string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	count := 0
+	for _, channelId := range channelIds {
+		for _, c := range w.clients[channelId] {
+			if c.name != name {
+				continue
+			}
+			// the leases free their slots once their contexts end
+			for _, cancel := range c.streams {
+				cancel()
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// ClientStats returns the stats of the named client serving channelId.
+func (w *StreamWorker) ClientStats(channelId int64, name string) (ClientStats, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, c := range w.clients[channelId] {
+		if c.name == name {
+			return w.stats(c), true
+		}
+	}
+	disabled := w.disabled[clientKey{channel: channelId, name: name}]
+	return ClientStats{Name: name, Status: StatusIdle, Disabled: disabled}, false
+}
+
+// stats must be called with w.mu held.
+func (w *StreamWorker) stats(c *Client) ClientStats {
+	s := ClientStats{Name: c.name, Status: c.Status, Since: c.since, Reconnects: c.reconnects, Latency: c.latency,
+		Disabled: w.disabled[c.key()], Streams: int(c.active.Load()), BytesServed: c.bytes.Load(), Errors: int(c.errors.Load())}
+	if c.lastErr != nil {
+		s.LastError = c.lastErr.Error()
+	}
+	if until := time.Unix(0, c.floodUntil.Load()); until.After(time.Now()) {
+		s.FloodWaitUntil = &until
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package tgc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	w := &StreamWorker{disabled: make(map[clientKey]bool)}
+	c := &Client{name: "bot:1"}
+
+	_, lease := w.Acquire(context.Background(), c)
+	if got := w.stats(c).Streams; got != 1 {
+		t.Fatalf("streams = %d, want 1", got)
+	}
+	lease.Release(10, errors.New("read failed"))
+	lease.Release(10, nil)
+	if s := w.stats(c); s.Streams != 0 || s.BytesServed != 10 || s.Errors != 1 {
+		t.Errorf("stats after release = %+v", s)
+	}
+
+	// a stream whose viewer went away gives its slot back without Release
+	ctx, cancel := context.WithCancel(context.Background())
+	w.Acquire(ctx, c)
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for c.active.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("slot not freed on cancellation")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// a handler that panics releases through its deferred call
+	func() {
+		defer func() { recover() }()
+		_, lease := w.Acquire(context.Background(), c)
+		defer lease.Release(0, nil)
+		panic("handler")
+	}()
+	if s := w.stats(c); s.Streams != 0 || s.Errors != 1 {
+		t.Errorf("stats after panic = %+v", s)
+	}
+}
+
+func TestUploadWorkerChannels(t *testing.T) {
+	w := NewUploadWorker()
+	w.Set([]string{"a", "b"}, 1)
+	w.Set([]string{"c"}, 2)
+
+	for _, want := range []string{"a", "b", "a"} {
+		if got, _ := w.Next(1); got != want {
+			t.Fatalf("Next(1) = %s, want %s", got, want)
+		}
+	}
+	if got, _ := w.Next(2); got != "c" {
+		t.Errorf("Next(2) = %s, want c", got)
+	}
+}
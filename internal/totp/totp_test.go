@@ -0,0 +1,69 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the RFC vectors are eight digits long, these are their last six
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := GenerateSecret()
+	now := time.Now()
+	step := Step(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := Code(secret, step+offset)
+		got, ok := Validate(secret, code[:3]+" "+code[3:], now)
+		if !ok || got != step+offset {
+			t.Errorf("code of step %+d: got step %d, %v", offset, got-step, ok)
+		}
+	}
+
+	code, _ := Code(secret, step-2)
+	if _, ok := Validate(secret, code, now); ok {
+		t.Error("expired code accepted")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestURL(t *testing.T) {
+	u, err := url.Parse(URL("Teldrive", "alice", "ABC"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Teldrive:alice" {
+		t.Errorf("unexpected url %s", u)
+	}
+	if u.Query().Get("secret") != "ABC" || u.Query().Get("issuer") != "Teldrive" {
+		t.Errorf("unexpected query %s", u.RawQuery)
+	}
+}
@@ -0,0 +1,75 @@
+// Package uploadpolicy decides whether an uploaded file is accepted, rejected
+// or quarantined from its name, mime type and size. Rules are file extensions
+// like ".exe" or mime types like "application/x-msdownload", where "video/*"
+// matches every subtype.
+package uploadpolicy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+type Verdict int
+
+const (
+	Accept Verdict = iota
+	Quarantine
+	Block
+	TooLarge
+)
+
+// Policy holds the rules applied to uploads. MaxSize is in bytes, 0 lifts the
+// limit.
+type Policy struct {
+	Blocked     []string
+	Quarantined []string
+	MaxSize     int64
+}
+
+// Validate checks that every rule is an extension or a mime type.
+func Validate(rules []string) error {
+	for _, rule := range rules {
+		if len(rule) < 2 || (!strings.HasPrefix(rule, ".") && !strings.Contains(rule, "/")) {
+			return fmt.Errorf("upload rule must be an extension starting with . or a mime type, got %q", rule)
+		}
+	}
+	return nil
+}
+
+// Check returns the verdict on a file. Blocked rules win over quarantined ones.
+func (p *Policy) Check(name, mimeType string, size int64) Verdict {
+	switch {
+	case p.MaxSize > 0 && size > p.MaxSize:
+		return TooLarge
+	case matches(p.Blocked, name, mimeType):
+		return Block
+	case matches(p.Quarantined, name, mimeType):
+		return Quarantine
+	}
+	return Accept
+}
+
+func matches(rules []string, name, mimeType string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	mimeType = strings.ToLower(mimeType)
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+	for _, rule := range rules {
+		rule = strings.ToLower(rule)
+		switch {
+		case strings.HasPrefix(rule, "."):
+			if ext == rule {
+				return true
+			}
+		case strings.HasSuffix(rule, "/*"):
+			if strings.HasPrefix(mimeType, strings.TrimSuffix(rule, "*")) {
+				return true
+			}
+		case mimeType == rule:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package uploadpolicy
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	p := &Policy{
+		Blocked:     []string{".exe", "application/x-msdownload"},
+		Quarantined: []string{".ZIP", "video/*"},
+		MaxSize:     100,
+	}
+	tests := []struct {
+		name, mimeType string
+		size           int64
+		want           Verdict
+	}{
+		{"notes.txt", "text/plain", 10, Accept},
+		{"setup.EXE", "application/octet-stream", 10, Block},
+		{"setup", "application/x-msdownload; charset=binary", 10, Block},
+		{"archive.zip", "application/zip", 10, Quarantine},
+		{"clip.mkv", "video/x-matroska", 10, Quarantine},
+		{"videos.txt", "text/plain", 10, Accept},
+		{"notes.txt", "text/plain", 101, TooLarge},
+	}
+	for _, tt := range tests {
+		if got := p.Check(tt.name, tt.mimeType, tt.size); got != tt.want {
+			t.Errorf("Check(%q, %q, %d) = %v, want %v", tt.name, tt.mimeType, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]string{".exe", "video/*"}); err != nil {
+		t.Error(err)
+	}
+	for _, rule := range []string{"exe", ".", ""} {
+		if err := Validate([]string{rule}); err == nil {
+			t.Errorf("rule %q accepted", rule)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"hash/fnv"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -48,6 +50,8 @@ func GetField(v interface{}, field string) string {
 		return v
 	case time.Time:
 		return v.Format(time.RFC3339)
+	case int64:
+		return strconv.FormatInt(v, 10)
 	default:
 		return ""
 	}
@@ -63,6 +67,9 @@ func IntPointer(b int) *int {
 func Int64Pointer(b int64) *int64 {
 	return &b
 }
+func StringPointer(b string) *string {
+	return &b
+}
 
 func PathExists(path string) (bool, error) {
 	_, err := os.Stat(path)
@@ -81,3 +88,10 @@ func ExecutableDir() string {
 
 	return filepath.Dir(path)
 }
+
+// StableInode maps a file id to a stable 64 bit number usable as an inode.
+func StableInode(id string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return h.Sum64()
+}
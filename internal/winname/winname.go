@@ -0,0 +1,144 @@
+// Package winname reversibly escapes file names that are invalid on Windows.
+//
+// Forbidden characters and trailing dots/spaces are replaced by their
+// fullwidth Unicode lookalikes, reserved device names (CON, NUL, COM1, ...)
+// get their first letter replaced the same way. Lookalikes already present in
+// the original name are prefixed with an escape rune so Decode can always
+// restore the stored name.
+package winname
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const escape = '‛'
+
+var replacements = map[rune]rune{
+	'<':  '＜',
+	'>':  '＞',
+	':':  '：',
+	'"':  '＂',
+	'|':  '｜',
+	'?':  '？',
+	'*':  '＊',
+	'\\': '＼',
+}
+
+const (
+	dot   = '．'
+	space = '␠'
+)
+
+var reserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+var decodeMap = func() map[rune]rune {
+	m := map[rune]rune{dot: '.', space: ' '}
+	for k, v := range replacements {
+		m[v] = k
+	}
+	for r := 'Ａ'; r <= 'Ｚ'; r++ {
+		m[r] = r - 'Ａ' + 'A'
+	}
+	for r := 'ａ'; r <= 'ｚ'; r++ {
+		m[r] = r - 'ａ' + 'a'
+	}
+	return m
+}()
+
+func isReserved(name string) bool {
+	base := name
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	return reserved[strings.ToUpper(base)]
+}
+
+func toFullwidth(r rune) rune {
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return r - 'A' + 'Ａ'
+	case r >= 'a' && r <= 'z':
+		return r - 'a' + 'ａ'
+	}
+	return r
+}
+
+// Encode escapes name so it is valid on Windows.
+func Encode(name string) string {
+	if name == "" {
+		return name
+	}
+
+	var b strings.Builder
+	runes := []rune(name)
+
+	trailing := len(runes)
+	for trailing > 0 && (runes[trailing-1] == '.' || runes[trailing-1] == ' ') {
+		trailing--
+	}
+
+	for i, r := range runes {
+		switch {
+		case i == 0 && isReserved(name):
+			b.WriteRune(toFullwidth(r))
+		case i >= trailing && r == '.':
+			b.WriteRune(dot)
+		case i >= trailing && r == ' ':
+			b.WriteRune(space)
+		case replacements[r] != 0:
+			b.WriteRune(replacements[r])
+		case r == escape || decodeMap[r] != 0:
+			b.WriteRune(escape)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Decode restores a name produced by Encode.
+func Decode(name string) string {
+	var b strings.Builder
+	for len(name) > 0 {
+		r, size := utf8.DecodeRuneInString(name)
+		name = name[size:]
+		if r == escape && len(name) > 0 {
+			r, size = utf8.DecodeRuneInString(name)
+			name = name[size:]
+			b.WriteRune(r)
+			continue
+		}
+		if orig, ok := decodeMap[r]; ok {
+			b.WriteRune(orig)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// EncodePath encodes every segment of a slash separated path.
+func EncodePath(path string) string {
+	return mapSegments(path, Encode)
+}
+
+// DecodePath decodes every segment of a slash separated path.
+func DecodePath(path string) string {
+	return mapSegments(path, Decode)
+}
+
+func mapSegments(path string, fn func(string) string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = fn(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,36 @@
+package winname
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"a:b?.txt", "a：b？.txt"},
+		{"CON", "ＣON"},
+		{"nul.txt", "ｎul.txt"},
+		{"console.txt", "console.txt"},
+		{"dots...", "dots．．．"},
+		{"space ", "space␠"},
+		{"already：there", "already‛：there"},
+		{"Ｆull", "‛Ｆull"},
+	}
+	for _, tt := range tests {
+		got := Encode(tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+		assert.Equal(t, tt.name, Decode(got), tt.name)
+	}
+}
+
+func TestPath(t *testing.T) {
+	path := "/Movies/What?/CON"
+	encoded := EncodePath(path)
+	assert.Equal(t, "/Movies/What？/ＣON", encoded)
+	assert.Equal(t, path, DecodePath(encoded))
+}
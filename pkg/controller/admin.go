@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (ac *Controller) ListBots(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.ListBots(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) DisableBot(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.SetBotDisabled(c, userId, c.Param("botID"), true)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) EnableBot(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.SetBotDisabled(c, userId, c.Param("botID"), false)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) RotateBot(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.RotateBot(c, userId, c.Param("botID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) VerifyFiles(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var query schemas.VerifyQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.FileService.VerifyFiles(c, userId, &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
+
+func (ac *Controller) ReloadConfig(c *gin.Context) {
+	res, err := ac.AdminService.ReloadConfig(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) CacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, ac.AdminService.CacheStats())
+}
+
+func (ac *Controller) GetMaintenance(c *gin.Context) {
+	res, err := ac.AdminService.GetMaintenance(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) SetMaintenance(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var in schemas.Maintenance
+	if err := c.ShouldBindJSON(&in); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.AdminService.SetMaintenance(c, userId, &in)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) ListInvites(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.ListInvites(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) CreateInvite(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var in schemas.InviteIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.AdminService.CreateInvite(c, userId, &in)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (ac *Controller) DeleteInvite(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.DeleteInvite(c, userId, c.Param("code"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) ListRegistrations(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var query schemas.RegistrationQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.AdminService.ListRegistrations(c, userId, &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) ApproveRegistration(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.ApproveRegistration(c, userId, c.Param("userID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) RejectRegistration(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.RejectRegistration(c, userId, c.Param("userID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) ListQuarantine(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.ListQuarantine(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) ReleaseQuarantined(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.ReleaseQuarantined(c, userId, c.Param("fileID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) DeleteQuarantined(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.AdminService.DeleteQuarantined(c, userId, c.Param("fileID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
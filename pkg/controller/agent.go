@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (ac *Controller) CreateAgent(c *gin.Context) {
+	var payload schemas.AgentIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.FileService.CreateAgent(c, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (ac *Controller) ListAgents(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.FileService.ListAgents(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) DeleteAgent(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.FileService.DeleteAgent(c, userId, c.Param("agentID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) AgentSession(c *gin.Context) {
+	res, err := ac.AuthService.AgentSession(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) PlanAgentSync(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.AgentManifest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.FileService.PlanAgentSync(c, userId, c.Param("agentID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) CommitAgentFile(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.AgentCommit
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.FileService.CommitAgentFile(c, userId, c.Param("agentID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) ListAgentConflicts(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := ac.FileService.ListAgentConflicts(c, userId, c.Param("agentID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) ResolveAgentConflict(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.AgentResolve
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.FileService.ResolveAgentConflict(c, userId, c.Param("agentID"), c.Param("conflictID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
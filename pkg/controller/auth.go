@@ -44,3 +44,85 @@ func (ac *Controller) Logout(c *gin.Context) {
 func (ac *Controller) HandleMultipleLogin(c *gin.Context) {
 	ac.AuthService.HandleMultipleLogin(c)
 }
+
+func (ac *Controller) GetOIDCConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, ac.AuthService.GetOIDCConfig())
+}
+
+func (ac *Controller) OIDCLogin(c *gin.Context) {
+	url, err := ac.AuthService.OIDCLogin(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+func (ac *Controller) OIDCCallback(c *gin.Context) {
+	var query schemas.OIDCCallback
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	location, err := ac.AuthService.OIDCCallback(c, &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.Redirect(http.StatusFound, location)
+}
+
+func (ac *Controller) SetupTOTP(c *gin.Context) {
+	res, err := ac.AuthService.SetupTOTP(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) EnableTOTP(c *gin.Context) {
+	var payload schemas.TOTPCode
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.AuthService.EnableTOTP(c, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) DisableTOTP(c *gin.Context) {
+	res, err := ac.AuthService.DisableTOTP(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (ac *Controller) Elevate(c *gin.Context) {
+	var payload schemas.ElevateIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := ac.AuthService.Elevate(c, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -5,20 +5,40 @@ import (
 )
 
 type Controller struct {
-	FileService   *services.FileService
-	UserService   *services.UserService
-	UploadService *services.UploadService
-	AuthService   *services.AuthService
+	FileService    *services.FileService
+	UserService    *services.UserService
+	UploadService  *services.UploadService
+	AuthService    *services.AuthService
+	JobService     *services.JobService
+	ArchiveService *services.ArchiveService
+	AdminService   *services.AdminService
+	StatusService  *services.StatusService
+	OrgService     *services.OrgService
+
+	ReplicationService *services.ReplicationService
 }
 
 func NewController(fileService *services.FileService,
 	userService *services.UserService,
 	uploadService *services.UploadService,
-	authService *services.AuthService) *Controller {
+	authService *services.AuthService,
+	jobService *services.JobService,
+	archiveService *services.ArchiveService,
+	adminService *services.AdminService,
+	statusService *services.StatusService,
+	orgService *services.OrgService,
+	replicationService *services.ReplicationService) *Controller {
 	return &Controller{
-		FileService:   fileService,
-		UserService:   userService,
-		UploadService: uploadService,
-		AuthService:   authService,
+		FileService:    fileService,
+		UserService:    userService,
+		UploadService:  uploadService,
+		AuthService:    authService,
+		JobService:     jobService,
+		ArchiveService: archiveService,
+		AdminService:   adminService,
+		StatusService:  statusService,
+		OrgService:     orgService,
+
+		ReplicationService: replicationService,
 	}
 }
@@ -2,8 +2,10 @@ package controller
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
-	"github.com/divyam234/teldrive/internal/cache"
+	"github.com/divyam234/teldrive/internal/backup"
 	"github.com/divyam234/teldrive/pkg/httputil"
 	"github.com/divyam234/teldrive/pkg/logging"
 	"github.com/divyam234/teldrive/pkg/schemas"
@@ -34,6 +36,25 @@ func (fc *Controller) CreateFile(c *gin.Context) {
 	c.JSON(http.StatusCreated, res)
 }
 
+func (fc *Controller) UploadSnippet(c *gin.Context) {
+
+	var query schemas.SnippetQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.UploadSnippet(c, userId, &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
 func (fc *Controller) UpdateFile(c *gin.Context) {
 
 	userId, _ := services.GetUserAuth(c)
@@ -44,22 +65,29 @@ func (fc *Controller) UpdateFile(c *gin.Context) {
 		httputil.NewError(c, http.StatusBadRequest, err)
 		return
 	}
-	res, err := fc.FileService.UpdateFile(c.Param("fileID"), userId, &fileUpdate, cache.FromContext(c))
+	if revision, ok := ifMatchRevision(c); ok {
+		fileUpdate.Revision = &revision
+	}
+	res, err := fc.FileService.UpdateFile(c, c.Param("fileID"), userId, &fileUpdate)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
 		return
 	}
 
+	c.Header("ETag", revisionETag(res.Revision))
 	c.JSON(http.StatusOK, res)
 }
 
 func (fc *Controller) GetFileByID(c *gin.Context) {
-	res, err := fc.FileService.GetFileByID(c.Param("fileID"))
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.GetFileByID(c, c.Param("fileID"), userId)
 	if err != nil {
 		httputil.NewError(c, http.StatusNotFound, err.Error)
 		return
 	}
 
+	c.Header("ETag", revisionETag(res.Revision))
 	c.JSON(http.StatusOK, res)
 }
 
@@ -79,7 +107,45 @@ func (fc *Controller) ListFiles(c *gin.Context) {
 		return
 	}
 
-	res, err := fc.FileService.ListFiles(userId, &fquery)
+	res, err := fc.FileService.ListFiles(c, userId, &fquery)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	if res.ETag != "" {
+		etag := "\"" + res.ETag + "\""
+		c.Header("ETag", etag)
+		if c.GetHeader("If-None-Match") == etag || res.ETag == fquery.IfChangedSince {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// ListCategory lists the files of a category across the whole drive, most
+// recent first.
+func (fc *Controller) ListCategory(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	fquery := schemas.FileQuery{
+		PerPage: 100,
+		Order:   "desc",
+		Sort:    "updatedAt",
+	}
+
+	if err := c.ShouldBindQuery(&fquery); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+	fquery.Op = "category"
+	fquery.Category = c.Param("category")
+	fquery.Path, fquery.ParentID = "", ""
+
+	res, err := fc.FileService.ListFiles(c, userId, &fquery)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
 		return
@@ -97,7 +163,7 @@ func (fc *Controller) MakeDirectory(c *gin.Context) {
 		httputil.NewError(c, http.StatusBadRequest, err)
 		return
 	}
-	res, err := fc.FileService.MakeDirectory(userId, &payload)
+	res, err := fc.FileService.MakeDirectory(c, userId, &payload)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
 		return
@@ -106,6 +172,24 @@ func (fc *Controller) MakeDirectory(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (fc *Controller) CreateFromTemplate(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.FolderTemplate
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+	res, err := fc.FileService.CreateFromTemplate(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
 func (fc *Controller) CopyFile(c *gin.Context) {
 	res, err := fc.FileService.CopyFile(c)
 	if err != nil {
@@ -116,6 +200,42 @@ func (fc *Controller) CopyFile(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (fc *Controller) SplitFile(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.FileSplit
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.SplitFile(c, userId, c.Param("fileID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (fc *Controller) JoinFiles(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.FileJoin
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.JoinFiles(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
 func (fc *Controller) MoveFiles(c *gin.Context) {
 
 	userId, _ := services.GetUserAuth(c)
@@ -125,7 +245,20 @@ func (fc *Controller) MoveFiles(c *gin.Context) {
 		httputil.NewError(c, http.StatusBadRequest, err)
 		return
 	}
-	res, err := fc.FileService.MoveFiles(userId, &payload)
+	if dryRun(c) {
+		res, err := fc.FileService.PreviewMoveFiles(c, userId, &payload)
+		if err != nil {
+			httputil.NewError(c, err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	// If-Match names a single revision, so it only applies to moving one file
+	if revision, ok := ifMatchRevision(c); ok && len(payload.Files) == 1 && len(payload.Revisions) == 0 {
+		payload.Revisions = map[string]int64{payload.Files[0]: revision}
+	}
+	res, err := fc.FileService.MoveFiles(c, userId, &payload)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
 		return
@@ -143,15 +276,98 @@ func (fc *Controller) DeleteFiles(c *gin.Context) {
 		httputil.NewError(c, http.StatusBadRequest, err)
 		return
 	}
-	res, err := fc.FileService.DeleteFiles(userId, &payload)
+	if dryRun(c) {
+		res, err := fc.FileService.PreviewDeleteFiles(c, userId, &payload)
+		if err != nil {
+			httputil.NewError(c, err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	res, job, err := fc.FileService.DeleteFiles(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	if job != nil {
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) ListTrash(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	var query schemas.TrashQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.ListTrash(c, userId, query.Path)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) RestoreFiles(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.TrashRestore
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+	res, job, err := fc.FileService.RestoreFiles(c, userId, &payload)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
 		return
 	}
 
+	if job != nil {
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+
 	c.JSON(http.StatusOK, res)
 }
 
+func (fc *Controller) PurgeTrash(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.TrashRestore
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+	if dryRun(c) {
+		res, err := fc.FileService.PreviewPurgeTrash(c, userId, &payload)
+		if err != nil {
+			httputil.NewError(c, err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	job, err := fc.FileService.PurgeTrash(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
 func (fc *Controller) DeleteFileParts(c *gin.Context) {
 
 	res, err := fc.FileService.DeleteFileParts(c, c.Param("fileID"))
@@ -171,7 +387,16 @@ func (fc *Controller) MoveDirectory(c *gin.Context) {
 		httputil.NewError(c, http.StatusBadRequest, err)
 		return
 	}
-	res, err := fc.FileService.MoveDirectory(userId, &payload)
+	if dryRun(c) {
+		res, err := fc.FileService.PreviewMoveDirectory(c, userId, &payload)
+		if err != nil {
+			httputil.NewError(c, err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	res, err := fc.FileService.MoveDirectory(c, userId, &payload)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
 		return
@@ -183,7 +408,7 @@ func (fc *Controller) MoveDirectory(c *gin.Context) {
 func (fc *Controller) GetCategoryStats(c *gin.Context) {
 	userId, _ := services.GetUserAuth(c)
 
-	res, err := fc.FileService.GetCategoryStats(userId)
+	res, err := fc.FileService.GetCategoryStats(c, userId)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
 		return
@@ -195,3 +420,304 @@ func (fc *Controller) GetCategoryStats(c *gin.Context) {
 func (fc *Controller) GetFileStream(c *gin.Context) {
 	fc.FileService.GetFileStream(c)
 }
+
+func (fc *Controller) GetPreview(c *gin.Context) {
+	fc.FileService.GetPreview(c)
+}
+
+func (fc *Controller) GetRendered(c *gin.Context) {
+	fc.FileService.GetRendered(c)
+}
+
+func (fc *Controller) GetSubtitles(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.GetSubtitles(c, userId, c.Param("fileID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) GetSubtitle(c *gin.Context) {
+	fc.FileService.GetSubtitle(c)
+}
+
+func (fc *Controller) GetImage(c *gin.Context) {
+	fc.FileService.GetImage(c)
+}
+
+func (fc *Controller) GetPlaylist(c *gin.Context) {
+	fc.FileService.GetPlaylist(c)
+}
+
+func (fc *Controller) ShareFile(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.ShareIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.ShareFile(c, userId, c.Param("fileID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) ListShares(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.ListShares(c, userId, c.Param("fileID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) DeleteShare(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.DeleteShare(c, userId, c.Param("fileID"), c.Param("shareID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) CreateShareLink(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.ShareLinkIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.CreateShareLink(c, userId, c.Param("fileID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (fc *Controller) ListShareLinks(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.ListShareLinks(c, userId, c.Param("fileID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) DeleteShareLink(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.DeleteShareLink(c, userId, c.Param("fileID"), c.Param("linkID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) SendToTelegram(c *gin.Context) {
+	var payload schemas.TelegramSend
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.SendToTelegram(c, c.Param("fileID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) ListCleanupRules(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.ListCleanupRules(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) CreateCleanupRule(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.CleanupRuleIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.CreateCleanupRule(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (fc *Controller) UpdateCleanupRule(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.CleanupRuleIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.UpdateCleanupRule(c, userId, c.Param("ruleID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) DeleteCleanupRule(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.DeleteCleanupRule(c, userId, c.Param("ruleID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) PreviewCleanupRule(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.PreviewCleanupRule(c, userId, c.Param("ruleID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) ExportMetadata(c *gin.Context) {
+	fc.FileService.ExportMetadata(c)
+}
+
+func (fc *Controller) ExportIndex(c *gin.Context) {
+	fc.FileService.ExportIndex(c)
+}
+
+func (fc *Controller) RestoreMetadata(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var snap backup.Snapshot
+	if err := c.ShouldBindJSON(&snap); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.RestoreMetadata(c, userId, &snap)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func revisionETag(revision int64) string {
+	return "\"" + strconv.FormatInt(revision, 10) + "\""
+}
+
+// dryRun tells whether a destructive request, with ?dryRun=1, only asks what
+// it would change.
+func dryRun(c *gin.Context) bool {
+	v, _ := strconv.ParseBool(c.Query("dryRun"))
+	return v
+}
+
+// ifMatchRevision reads the revision of the ETag a client sent in If-Match.
+// A missing header or * matches any revision. An ETag that is not a revision
+// is returned as -1, which never matches.
+func ifMatchRevision(c *gin.Context) (int64, bool) {
+	value := strings.TrimPrefix(strings.TrimSpace(c.GetHeader("If-Match")), "W/")
+	if value == "" || value == "*" {
+		return 0, false
+	}
+	revision, err := strconv.ParseInt(strings.Trim(value, "\""), 10, 64)
+	if err != nil {
+		return -1, true
+	}
+	return revision, true
+}
+
+func (fc *Controller) ListOperations(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.ListOperations(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) UndoOperation(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.UndoOperation(c, userId, c.Param("operationID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) SetFolderAppearance(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.FolderAppearance
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.SetFolderAppearance(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (jc *Controller) ListJobs(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var query schemas.JobQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := jc.JobService.ListJobs(c, userId, &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (jc *Controller) GetJob(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := jc.JobService.GetJob(c, userId, c.Param("id"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (jc *Controller) CancelJob(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := jc.JobService.CancelJob(c, userId, c.Param("id"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (jc *Controller) ExtractArchive(c *gin.Context) {
+	res, err := jc.ArchiveService.ExtractArchive(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
+
+func (jc *Controller) CreateArchive(c *gin.Context) {
+	res, err := jc.ArchiveService.CreateArchive(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
+
+func (jc *Controller) BackfillChecksums(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := jc.FileService.BackfillChecksums(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
+
+func (jc *Controller) BackfillQuickHashes(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := jc.FileService.BackfillQuickHashes(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
+
+func (jc *Controller) RepairMimeTypes(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := jc.FileService.RepairMimeTypes(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
+
+func (jc *Controller) FindDuplicates(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := jc.FileService.FindDuplicates(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
+
+func (jc *Controller) ResolveDuplicates(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.DuplicateResolve
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+	if dryRun(c) {
+		res, err := jc.FileService.PreviewResolveDuplicates(c, userId, &payload)
+		if err != nil {
+			httputil.NewError(c, err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	res, job, err := jc.FileService.ResolveDuplicates(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	if job != nil {
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (jc *Controller) ImportChannel(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.ImportIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := jc.FileService.ImportChannel(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
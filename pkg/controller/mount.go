@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (mc *Controller) CreateMount(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.MountIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := mc.FileService.CreateMount(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (mc *Controller) ListMounts(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := mc.FileService.ListMounts(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (mc *Controller) DeleteMount(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := mc.FileService.DeleteMount(c, userId, c.Param("mountID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (mc *Controller) ListMountFiles(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var query schemas.MountQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := mc.FileService.ListMountFiles(c, userId, c.Param("mountID"), &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (mc *Controller) GetMountFileStream(c *gin.Context) {
+	mc.FileService.GetMountFileStream(c)
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (oc *Controller) CreateOrg(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.OrgIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := oc.OrgService.CreateOrg(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (oc *Controller) ListOrgs(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := oc.OrgService.ListOrgs(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (oc *Controller) DeleteOrg(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := oc.OrgService.DeleteOrg(c, userId, c.Param("orgID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (oc *Controller) ListOrgMembers(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := oc.OrgService.ListMembers(c, userId, c.Param("orgID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (oc *Controller) SetOrgMember(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.OrgMemberIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := oc.OrgService.SetMember(c, userId, c.Param("orgID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (oc *Controller) RemoveOrgMember(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := oc.OrgService.RemoveMember(c, userId, c.Param("orgID"), c.Param("userID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (oc *Controller) ListOrgAudit(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var query schemas.OrgAuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := oc.OrgService.ListAudit(c, userId, c.Param("orgID"), &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
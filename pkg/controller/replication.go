@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/replication"
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gin-gonic/gin"
+)
+
+func (rc *Controller) GetReplicationStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, rc.ReplicationService.Status())
+}
+
+func (rc *Controller) ReplicationAccounts(c *gin.Context) {
+	res, err := rc.ReplicationService.Accounts(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (rc *Controller) ReplicationChanges(c *gin.Context) {
+	cursor := replication.Cursor{ID: c.Query("after")}
+	if since := c.Query("since"); since != "" {
+		var err error
+		if cursor.UpdatedAt, err = time.Parse(time.RFC3339Nano, since); err != nil {
+			httputil.NewError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	res, err := rc.ReplicationService.Changes(c, cursor)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (rc *Controller) ReplicationVersions(c *gin.Context) {
+	res, err := rc.ReplicationService.Versions(c, c.Query("after"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (rc *Controller) ReplicationFiles(c *gin.Context) {
+	var in schemas.ReplicationFiles
+	if err := c.ShouldBindJSON(&in); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := rc.ReplicationService.Files(c, &in)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (sc *Controller) CreateSnapshot(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.SnapshotIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := sc.FileService.CreateSnapshot(c, userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (sc *Controller) ListSnapshots(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := sc.FileService.ListSnapshots(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (sc *Controller) ListSnapshotFiles(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := sc.FileService.ListSnapshotFiles(c, userId, c.Param("snapshotID"), c.Query("path"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (sc *Controller) RestoreSnapshot(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.SnapshotRestore
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := sc.FileService.RestoreSnapshot(c, userId, c.Param("snapshotID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (sc *Controller) DeleteSnapshot(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := sc.FileService.DeleteSnapshot(c, userId, c.Param("snapshotID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (sc *Controller) GetStatus(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=30")
+	c.JSON(http.StatusOK, sc.StatusService.GetStatus())
+}
+
+// Healthz only tells the server is up and serving requests, so a liveness
+// probe does not restart it over an outage of a dependency.
+func (sc *Controller) Healthz(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (sc *Controller) Readyz(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	res, ready := sc.StatusService.Ready(c)
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, res)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -29,6 +29,27 @@ func (uc *Controller) DeleteUploadFile(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (uc *Controller) ListUploadSessions(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+	res, err := uc.UploadService.ListUploadSessions(c, userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) AbortUploadSession(c *gin.Context) {
+	res, err := uc.UploadService.AbortUploadSession(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
 func (uc *Controller) UploadFile(c *gin.Context) {
 	res, err := uc.UploadService.UploadFile(c)
 	if err != nil {
@@ -48,7 +69,7 @@ func (uc *Controller) UploadStats(c *gin.Context) {
 		days, _ = strconv.Atoi(c.Query("days"))
 	}
 
-	res, err := uc.UploadService.GetUploadStats(userId, days)
+	res, err := uc.UploadService.GetUploadStats(c, userId, days)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
 		return
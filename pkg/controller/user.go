@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
 	"github.com/gin-gonic/gin"
 )
 
@@ -27,6 +29,26 @@ func (uc *Controller) UpdateChannel(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (uc *Controller) CreateChannel(c *gin.Context) {
+	res, err := uc.UserService.CreateChannel(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (uc *Controller) RemoveChannel(c *gin.Context) {
+	res, err := uc.UserService.RemoveChannel(c, c.Param("channelID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
 func (uc *Controller) ListChannels(c *gin.Context) {
 	res, err := uc.UserService.ListChannels(c)
 	if err != nil {
@@ -37,6 +59,115 @@ func (uc *Controller) ListChannels(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (uc *Controller) GetTimeline(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	var query schemas.TimelineQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := uc.UserService.GetTimeline(c, userId, &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) GetPreferences(c *gin.Context) {
+	res, err := uc.UserService.GetPreferences(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) UpdatePreferences(c *gin.Context) {
+	res, err := uc.UserService.UpdatePreferences(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) ListQuickAccess(c *gin.Context) {
+	res, err := uc.UserService.ListQuickAccess(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) AddQuickAccess(c *gin.Context) {
+	res, err := uc.UserService.AddQuickAccess(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) ReorderQuickAccess(c *gin.Context) {
+	res, err := uc.UserService.ReorderQuickAccess(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) RemoveQuickAccess(c *gin.Context) {
+	res, err := uc.UserService.RemoveQuickAccess(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) GetNotificationSettings(c *gin.Context) {
+	res, err := uc.UserService.GetNotificationSettings(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) UpdateNotificationSettings(c *gin.Context) {
+	res, err := uc.UserService.UpdateNotificationSettings(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) TestNotification(c *gin.Context) {
+	res, err := uc.UserService.TestNotification(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
 func (uc *Controller) AddBots(c *gin.Context) {
 	res, err := uc.UserService.AddBots(c)
 	if err != nil {
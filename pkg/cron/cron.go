@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
 	"github.com/divyam234/teldrive/pkg/logging"
 	"github.com/divyam234/teldrive/pkg/models"
 	"github.com/divyam234/teldrive/pkg/services"
@@ -32,19 +33,6 @@ func (a *Files) Scan(value interface{}) error {
 	return nil
 }
 
-type UpParts []int
-
-func (a UpParts) Value() (driver.Value, error) {
-	return json.Marshal(a)
-}
-
-func (a *UpParts) Scan(value interface{}) error {
-	if err := json.Unmarshal(value.([]byte), &a); err != nil {
-		return err
-	}
-	return nil
-}
-
 type Result struct {
 	Files     Files
 	Session   string
@@ -52,44 +40,64 @@ type Result struct {
 	ChannelId int64
 }
 
-type UploadResult struct {
-	Parts     UpParts
-	Session   string
-	UserId    int64
-	ChannelId int64
-}
-
 type CronService struct {
-	db     *gorm.DB
-	cnf    *config.Config
-	logger *zap.SugaredLogger
+	db       *gorm.DB
+	cnf      *config.Config
+	files    *services.FileService
+	notifier *services.Notifier
+	// cleanup jobs wait while maintenance is on
+	maintenance *services.Maintenance
+	logger      *zap.SugaredLogger
 }
 
-func StartCronJobs(db *gorm.DB, cnf *config.Config) {
+func StartCronJobs(db *gorm.DB, cnf *config.Config, files *services.FileService, notifier *services.Notifier,
+	maintenance *services.Maintenance) {
 	scheduler := gocron.NewScheduler(time.UTC)
 
 	ctx := context.Background()
 
-	cron := CronService{db: db, cnf: cnf, logger: logging.DefaultLogger()}
+	cron := CronService{db: db, cnf: cnf, files: files, notifier: notifier, maintenance: maintenance,
+		logger: logging.DefaultLogger()}
 
 	scheduler.Every(1).Hour().Do(cron.CleanFiles, ctx)
 
 	scheduler.Every(2).Hour().Do(cron.UpdateFolderSize)
 
-	scheduler.Every(12).Hour().Do(cron.CleanUploads, ctx)
+	scheduler.Every(1).Hour().Do(cron.CleanUploads, ctx)
+
+	scheduler.Every(1).Hour().Do(cron.RollupStorageStats, ctx)
+
+	scheduler.Every(1).Hour().Do(cron.RunCleanupRules, ctx)
+
+	scheduler.Every(1).Hour().Do(cron.CheckStorage, ctx)
+
+	scheduler.Every(1).Hour().Do(cron.PruneOperations, ctx)
+
+	scheduler.Every(1).Minute().SingletonMode().Do(cron.ScanFiles, ctx)
+
+	scheduler.Every(5).Minute().SingletonMode().Do(cron.DedupFiles, ctx)
 
 	scheduler.StartAsync()
 }
 
+func (c *CronService) paused() bool {
+	on, _, _ := c.maintenance.Active()
+	return on
+}
+
 func (c *CronService) CleanFiles(ctx context.Context) {
+	if c.paused() {
+		return
+	}
 
 	var results []Result
-	if err := c.db.Model(&models.File{}).
+	if err := c.db.WithContext(ctx).Model(&models.File{}).
 		Select("JSONB_AGG(jsonb_build_object('id',files.id, 'parts',files.parts)) as files", "files.channel_id", "files.user_id", "s.session").
 		Joins("left join teldrive.users as u  on u.user_id = files.user_id").
 		Joins("left join (select * from teldrive.sessions order by created_at desc limit 1) as s on u.user_id = s.user_id").
 		Where("type = ?", "file").
 		Where("status = ?", "pending_deletion").
+		Where("files.deleted_at IS NULL OR files.deleted_at < ?", time.Now().UTC().Add(-c.cnf.Trash.Retention)).
 		Group("files.channel_id").Group("files.user_id").Group("s.session").
 		Scan(&results).Error; err != nil {
 		return
@@ -111,47 +119,79 @@ func (c *CronService) CleanFiles(ctx context.Context) {
 			}
 
 		}
-		err := services.DeleteTGMessages(ctx, &c.cnf.TG, row.Session, row.ChannelId, row.UserId, ids)
+		ids, err := services.ReleasableParts(ctx, c.db, row.ChannelId, ids, fileIds)
+		if err == nil && len(ids) > 0 {
+			err = services.DeleteTGMessages(ctx, &c.cnf.TG, row.Session, row.ChannelId, row.UserId, ids)
+		}
 		if err != nil {
 			c.logger.Errorw("failed to clean files", err)
 		}
 		if err == nil {
-			c.db.Where("id = any($1)", fileIds).Delete(&models.File{})
+			if err := services.PurgeFiles(ctx, c.db, fileIds); err != nil {
+				c.logger.Errorw("failed to purge files", err)
+			}
 		}
 		c.logger.Infow("cleaned files", "user", row.UserId, "channel", row.ChannelId)
 	}
 }
 
 func (c *CronService) CleanUploads(ctx context.Context) {
+	if c.paused() {
+		return
+	}
+	if err := services.CleanExpiredUploads(ctx, c.db, &c.cnf.TG); err != nil {
+		c.logger.Errorw("failed to clean uploads", err)
+	}
+}
 
-	var upResults []UploadResult
-	if err := c.db.Model(&models.Upload{}).
-		Select("JSONB_AGG(uploads.part_id) as parts", "uploads.channel_id", "uploads.user_id", "s.session").
-		Joins("left join teldrive.users as u  on u.user_id = uploads.user_id").
-		Joins("left join (select * from teldrive.sessions order by created_at desc limit 1) as s on s.user_id = uploads.user_id").
-		Where("uploads.created_at > ?", time.Now().UTC().Add(c.cnf.TG.Uploads.Retention)).
-		Group("uploads.channel_id").Group("uploads.user_id").Group("s.session").
-		Scan(&upResults).Error; err != nil {
+func (c *CronService) RollupStorageStats(ctx context.Context) {
+	if err := services.RollupStorageStats(ctx, c.db); err != nil {
+		c.logger.Errorw("failed to roll up storage stats", err)
+	}
+}
+
+func (c *CronService) RunCleanupRules(ctx context.Context) {
+	if c.paused() {
 		return
 	}
+	if err := c.files.RunCleanupRules(ctx); err != nil {
+		c.logger.Errorw("failed to run cleanup rules", err)
+	}
+}
 
-	for _, result := range upResults {
-		if result.Session == "" {
-			break
-		}
-		err := services.DeleteTGMessages(ctx, &c.cnf.TG, result.Session, result.ChannelId, result.UserId, result.Parts)
-		c.logger.Errorw("failed to delete messages", err)
-		parts := []int{}
-		for _, id := range result.Parts {
-			parts = append(parts, id)
-		}
+func (c *CronService) ScanFiles(ctx context.Context) {
+	if c.paused() {
+		return
+	}
+	if err := c.files.ScanPendingFiles(ctx); err != nil {
+		c.logger.Errorw("failed to scan files", err)
+	}
+}
 
-		if err == nil {
-			c.db.Where("part_id = any($1)", parts).Delete(&models.Upload{})
-		}
+func (c *CronService) DedupFiles(ctx context.Context) {
+	if c.paused() || !c.cnf.TG.Uploads.Dedup {
+		return
+	}
+	if err := c.files.DedupPendingFiles(ctx); err != nil {
+		c.logger.Errorw("failed to dedup files", err)
+	}
+}
+
+func (c *CronService) PruneOperations(ctx context.Context) {
+	if c.paused() {
+		return
+	}
+	if err := c.files.PruneOperations(ctx); err != nil {
+		c.logger.Errorw("failed to prune operations", err)
+	}
+}
+
+func (c *CronService) CheckStorage(ctx context.Context) {
+	if err := c.notifier.CheckStorage(ctx); err != nil {
+		c.logger.Errorw("failed to check storage limits", err)
 	}
 }
 
 func (c *CronService) UpdateFolderSize() {
-	c.db.Exec("call teldrive.update_size();")
+	database.Procs(c.db).UpdateFolderSizes(c.db)
 }
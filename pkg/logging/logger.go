@@ -19,6 +19,9 @@ const loggerKey = contextKey("logger")
 var (
 	defaultLogger     *zap.SugaredLogger
 	defaultLoggerOnce sync.Once
+	// defaultLevel is shared by the cores of the default logger so SetLevel
+	// applies to it after it is built.
+	defaultLevel = zap.NewAtomicLevel()
 )
 
 var conf = &Config{
@@ -42,9 +45,14 @@ func SetConfig(c *Config) {
 
 func SetLevel(l zapcore.Level) {
 	conf.Level = l
+	defaultLevel.SetLevel(l)
 }
 
 func NewLogger(conf *Config) *zap.SugaredLogger {
+	return newLogger(conf, zap.NewAtomicLevelAt(conf.Level))
+}
+
+func newLogger(conf *Config, level zap.AtomicLevel) *zap.SugaredLogger {
 
 	ec := zap.NewProductionEncoderConfig()
 	ec.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -57,7 +65,7 @@ func NewLogger(conf *Config) *zap.SugaredLogger {
 	var cores []zapcore.Core
 
 	cores = append(cores, zapcore.NewCore(zapcore.NewConsoleEncoder(ec),
-		zapcore.AddSync(os.Stdout), zap.NewAtomicLevelAt(conf.Level)))
+		zapcore.AddSync(os.Stdout), level))
 
 	if conf.FilePath != "" {
 		lumberjackLogger := &lumberjack.Logger{
@@ -68,7 +76,7 @@ func NewLogger(conf *Config) *zap.SugaredLogger {
 			Compress:   true,
 		}
 		cores = append(cores, zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
-			zapcore.AddSync(lumberjackLogger), zap.NewAtomicLevelAt(conf.Level)))
+			zapcore.AddSync(lumberjackLogger), level))
 	}
 
 	options := []zap.Option{}
@@ -81,7 +89,8 @@ func NewLogger(conf *Config) *zap.SugaredLogger {
 
 func DefaultLogger() *zap.SugaredLogger {
 	defaultLoggerOnce.Do(func() {
-		defaultLogger = NewLogger(conf)
+		defaultLevel.SetLevel(conf.Level)
+		defaultLogger = newLogger(conf, defaultLevel)
 	})
 	return defaultLogger
 }
@@ -1,6 +1,9 @@
 package mapper
 
 import (
+	"encoding/json"
+	"strings"
+
 	"github.com/divyam234/teldrive/pkg/models"
 	"github.com/divyam234/teldrive/pkg/schemas"
 )
@@ -10,18 +13,55 @@ func ToFileOut(file models.File) *schemas.FileOut {
 	if file.Size != nil {
 		size = *file.Size
 	}
+	var checksum string
+	if file.Checksum != nil {
+		checksum = *file.Checksum
+	}
+	var quickHash string
+	if file.QuickHash != nil {
+		quickHash = *file.QuickHash
+	}
+	var integrityError string
+	if file.IntegrityError != nil {
+		integrityError = *file.IntegrityError
+	}
+	var scanStatus string
+	if file.ScanStatus != nil {
+		scanStatus = *file.ScanStatus
+	}
+	var color, icon string
+	if file.Color != nil {
+		color = *file.Color
+	}
+	if file.Icon != nil {
+		icon = *file.Icon
+	}
+	var targetId string
+	if file.TargetID != nil {
+		targetId = *file.TargetID
+	}
 	return &schemas.FileOut{
-		ID:        file.ID,
-		Name:      file.Name,
-		Type:      file.Type,
-		MimeType:  file.MimeType,
-		Category:  file.Category,
-		Path:      file.Path,
-		Encrypted: file.Encrypted,
-		Size:      size,
-		Starred:   file.Starred,
-		ParentID:  file.ParentID,
-		UpdatedAt: file.UpdatedAt,
+		ID:             file.ID,
+		Name:           file.Name,
+		Type:           file.Type,
+		MimeType:       file.MimeType,
+		Category:       file.Category,
+		Path:           file.Path,
+		Encrypted:      file.Encrypted,
+		Size:           size,
+		Checksum:       checksum,
+		QuickHash:      quickHash,
+		TargetID:       targetId,
+		IntegrityError: integrityError,
+		Starred:        file.Starred,
+		Hidden:         file.Hidden,
+		Color:          color,
+		Icon:           icon,
+		ScanStatus:     scanStatus,
+		Revision:       file.Revision,
+		ParentID:       file.ParentID,
+		UpdatedAt:      file.UpdatedAt,
+		CreatedAt:      file.CreatedAt,
 	}
 }
 
@@ -54,3 +94,143 @@ func ToUploadOut(in *models.Upload) *schemas.UploadPartOut {
 	}
 	return out
 }
+
+func ToJobOut(in *models.Job) *schemas.JobOut {
+	out := &schemas.JobOut{
+		ID:         in.ID,
+		Type:       in.Type,
+		Status:     in.Status,
+		Progress:   in.Progress,
+		Total:      in.Total,
+		Error:      in.Error,
+		CreatedAt:  in.CreatedAt,
+		UpdatedAt:  in.UpdatedAt,
+		FinishedAt: in.FinishedAt,
+	}
+	if in.Result != nil {
+		out.Result = json.RawMessage(*in.Result)
+	}
+	return out
+}
+
+func ToCleanupRuleOut(in *models.CleanupRule) *schemas.CleanupRuleOut {
+	return &schemas.CleanupRuleOut{
+		ID:        in.ID,
+		Name:      in.Name,
+		Action:    in.Action,
+		Path:      in.Path,
+		Days:      in.Days,
+		Enabled:   in.Enabled,
+		LastRunAt: in.LastRunAt,
+		LastCount: in.LastCount,
+		CreatedAt: in.CreatedAt,
+	}
+}
+
+func ToInviteOut(in *models.Invite) *schemas.InviteOut {
+	return &schemas.InviteOut{
+		Code:      in.Code,
+		Note:      in.Note,
+		MaxUses:   in.MaxUses,
+		Uses:      in.Uses,
+		ExpiresAt: in.ExpiresAt,
+		CreatedAt: in.CreatedAt,
+	}
+}
+
+func ToRegistrationOut(in *models.Registration) *schemas.RegistrationOut {
+	return &schemas.RegistrationOut{
+		UserID:    in.UserID,
+		Name:      in.Name,
+		UserName:  in.UserName,
+		IsPremium: in.IsPremium,
+		Status:    in.Status,
+		CreatedAt: in.CreatedAt,
+	}
+}
+
+func ToShareLinkOut(in *models.ShareLink) *schemas.ShareLinkOut {
+	return &schemas.ShareLinkOut{
+		ID:           in.ID,
+		MaxDownloads: in.MaxDownloads,
+		RateLimit:    in.RateLimit,
+		ExpiresAt:    in.ExpiresAt,
+		Downloads:    in.Downloads,
+		BytesServed:  in.BytesServed,
+		LastAccessAt: in.LastAccessAt,
+		CreatedAt:    in.CreatedAt,
+	}
+}
+
+func ToAgentOut(in *models.Agent) *schemas.AgentOut {
+	return &schemas.AgentOut{
+		ID:         in.ID,
+		Name:       in.Name,
+		Root:       in.Root,
+		Conflict:   in.Conflict,
+		LastSeenAt: in.LastSeenAt,
+		CreatedAt:  in.CreatedAt,
+	}
+}
+
+func ToAgentConflictOut(in *models.AgentConflict) *schemas.AgentConflictOut {
+	out := &schemas.AgentConflictOut{
+		ID:         in.ID,
+		Path:       strings.TrimPrefix(in.Path, "/"),
+		Checksum:   in.Checksum,
+		Size:       in.Size,
+		ModTime:    in.ModTime,
+		Policy:     in.Policy,
+		CreatedAt:  in.CreatedAt,
+		ResolvedAt: in.ResolvedAt,
+	}
+	if in.FileID != nil {
+		out.FileID = *in.FileID
+	}
+	if in.Resolution != nil {
+		out.Resolution = *in.Resolution
+	}
+	return out
+}
+
+func ToSnapshotOut(in *models.Snapshot) *schemas.SnapshotOut {
+	out := &schemas.SnapshotOut{
+		ID:        in.ID,
+		Path:      in.Path,
+		Name:      in.Name,
+		Files:     in.Files,
+		Size:      in.Size,
+		CreatedAt: in.CreatedAt,
+	}
+	if in.FolderID != nil {
+		out.FolderID = *in.FolderID
+	}
+	return out
+}
+
+func ToMountOut(in *models.Mount) *schemas.MountOut {
+	return &schemas.MountOut{
+		ID:        in.ID,
+		ChannelID: in.ChannelID,
+		Name:      in.Name,
+		CreatedAt: in.CreatedAt,
+	}
+}
+
+func ToSnapshotEntry(in *models.SnapshotFile) *schemas.SnapshotEntry {
+	out := &schemas.SnapshotEntry{
+		Path:      in.Path,
+		Name:      in.Name,
+		Type:      in.Type,
+		MimeType:  in.MimeType,
+		Encrypted: in.Encrypted,
+		UpdatedAt: in.UpdatedAt,
+	}
+	if in.Size != nil {
+		out.Size = *in.Size
+	}
+	if in.Checksum != nil {
+		out.Checksum = *in.Checksum
+	}
+	return out
+}
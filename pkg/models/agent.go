@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// Agent is a watcher mirroring a local folder into Root. It trades its token
+// for short sessions of the login session it was created from, identified by
+// SessionHash, so it stops working when that session logs out.
+type Agent struct {
+	ID          string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID      int64      `gorm:"type:bigint;not null"`
+	Name        string     `gorm:"type:text;not null"`
+	Root        string     `gorm:"type:text;not null"`
+	Conflict    string     `gorm:"type:text;not null"`
+	TokenHash   string     `gorm:"type:text;not null"`
+	SessionHash string     `gorm:"type:text;not null"`
+	LastSeenAt  *time.Time `gorm:"type:timestamp"`
+	CreatedAt   time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
+
+// AgentConflict is a file an agent pushed over one that changed since the
+// agent last synced it. Open conflicts have no Resolution and hold the parts
+// of the pushed file.
+type AgentConflict struct {
+	ID         string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	AgentID    string     `gorm:"type:text;not null"`
+	UserID     int64      `gorm:"type:bigint;not null"`
+	Path       string     `gorm:"type:text;not null"`
+	FileID     *string    `gorm:"type:text"`
+	Checksum   string     `gorm:"type:text;not null"`
+	Size       int64      `gorm:"type:bigint;not null"`
+	ModTime    *time.Time `gorm:"type:timestamp"`
+	Parts      *Parts     `gorm:"type:jsonb"`
+	ChannelID  int64      `gorm:"type:bigint;not null"`
+	Encrypted  bool       `gorm:"default:false"`
+	Policy     string     `gorm:"type:text;not null"`
+	Resolution *string    `gorm:"type:text"`
+	CreatedAt  time.Time  `gorm:"default:timezone('utc'::text, now())"`
+	ResolvedAt *time.Time `gorm:"type:timestamp"`
+}
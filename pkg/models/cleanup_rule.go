@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// CleanupRule moves files older than Days below Path to the trash, or purges
+// files that have been in the trash for longer than Days, when the cleanup
+// cron runs.
+type CleanupRule struct {
+	ID        string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID    int64      `gorm:"type:bigint;not null"`
+	Name      string     `gorm:"type:text;not null"`
+	Action    string     `gorm:"type:text;not null"`
+	Path      string     `gorm:"type:text;not null"`
+	Days      int        `gorm:"type:integer;not null"`
+	Enabled   bool       `gorm:"type:boolean;not null"`
+	LastRunAt *time.Time `gorm:"type:timestamp"`
+	LastCount int64      `gorm:"type:bigint;not null"`
+	CreatedAt time.Time  `gorm:"default:timezone('utc'::text, now())"`
+	UpdatedAt time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
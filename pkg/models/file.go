@@ -17,13 +17,40 @@ type File struct {
 	Depth     *int      `gorm:"type:integer"`
 	Category  string    `gorm:"type:text"`
 	Encrypted bool      `gorm:"default:false"`
+	Hidden    bool      `gorm:"default:false"`
+	Revision  int64     `gorm:"type:bigint;default:0"`
 	UserID    int64     `gorm:"type:bigint;not null"`
 	Status    string    `gorm:"type:text"`
 	ParentID  string    `gorm:"type:text;index"`
 	Parts     *Parts    `gorm:"type:jsonb"`
 	ChannelID *int64    `gorm:"type:bigint"`
+	Checksum  *string   `gorm:"type:text"`
+	QuickHash *string   `gorm:"type:text"`
+	TargetID  *string   `gorm:"type:text"`
 	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
 	UpdatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+
+	VerifiedAt     *time.Time `gorm:"type:timestamp"`
+	IntegrityError *string    `gorm:"type:text"`
+
+	// ScanStatus tracks the virus scan of an upload and QuarantineReason
+	// tells why a quarantined file is held. ScanAttempts and ScannedAt pace
+	// the retries of failed scans.
+	ScanStatus       *string    `gorm:"type:text"`
+	QuarantineReason *string    `gorm:"type:text"`
+	ScanAttempts     int        `gorm:"default:0"`
+	ScannedAt        *time.Time `gorm:"type:timestamp"`
+
+	// Color and Icon customize how a folder is shown.
+	Color *string `gorm:"type:text"`
+	Icon  *string `gorm:"type:text"`
+
+	// DedupPending marks uploads the dedup pass has yet to hash.
+	DedupPending bool `gorm:"default:false"`
+
+	// DeletedAt and DeletedPath are set by a trigger when the file is deleted.
+	DeletedAt   *time.Time `gorm:"type:timestamp"`
+	DeletedPath *string    `gorm:"type:text"`
 }
 
 type Parts []Part
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Identity is a user of an OpenID Connect provider. UserID is the Telegram
+// account storing its files, nil until the identity is linked to one.
+type Identity struct {
+	Issuer      string     `gorm:"type:text;primaryKey"`
+	Subject     string     `gorm:"type:text;primaryKey"`
+	UserID      *int64     `gorm:"type:bigint"`
+	Email       string     `gorm:"type:text;not null"`
+	Name        string     `gorm:"type:text;not null"`
+	LastLoginAt *time.Time `gorm:"type:timestamp"`
+	CreatedAt   time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+type Job struct {
+	ID         string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID     int64      `gorm:"type:bigint;not null"`
+	Type       string     `gorm:"type:text;not null"`
+	Status     string     `gorm:"type:text;not null"`
+	Payload    string     `gorm:"type:jsonb"`
+	Result     *string    `gorm:"type:jsonb"`
+	Progress   int64      `gorm:"type:bigint;default:0"`
+	Total      int64      `gorm:"type:bigint;default:0"`
+	Error      string     `gorm:"type:text"`
+	CreatedAt  time.Time  `gorm:"default:timezone('utc'::text, now())"`
+	UpdatedAt  time.Time  `gorm:"default:timezone('utc'::text, now())"`
+	FinishedAt *time.Time `gorm:"type:timestamp"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+type Login struct {
+	ID        string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID    int64     `gorm:"type:bigint;not null"`
+	IP        string    `gorm:"type:text;not null"`
+	Network   string    `gorm:"type:text;not null"`
+	Country   string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
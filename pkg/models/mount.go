@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// Mount attaches a Telegram channel the user is a member of as a read-only
+// folder listing the documents of its history.
+type Mount struct {
+	ID        string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID    int64     `gorm:"type:bigint;not null"`
+	ChannelID int64     `gorm:"type:bigint;not null"`
+	Name      string    `gorm:"type:text;not null"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
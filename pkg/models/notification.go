@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// NotificationSetting holds the events a user is sent a message about.
+// StorageAlerted is set once the user was told their storage passed the
+// warning threshold of StorageLimit, until it falls below it again.
+type NotificationSetting struct {
+	UserID          int64     `gorm:"type:bigint;primaryKey"`
+	ShareAccessed   bool      `gorm:"type:boolean;not null"`
+	StorageFull     bool      `gorm:"type:boolean;not null"`
+	ImportFinished  bool      `gorm:"type:boolean;not null"`
+	IntegrityFailed bool      `gorm:"type:boolean;not null"`
+	StorageLimit    int64     `gorm:"type:bigint;not null"`
+	StorageAlerted  bool      `gorm:"type:boolean;not null"`
+	UpdatedAt       time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
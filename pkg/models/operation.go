@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// Operation is a recent change of a user kept with what undoes it, for the
+// undo window.
+type Operation struct {
+	ID        string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID    int64      `gorm:"type:bigint;not null"`
+	Kind      string     `gorm:"type:text;not null"`
+	Inverse   string     `gorm:"type:jsonb;not null"`
+	CreatedAt time.Time  `gorm:"default:timezone('utc'::text, now())"`
+	UndoneAt  *time.Time `gorm:"type:timestamp"`
+}
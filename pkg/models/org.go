@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// Org is a storage space shared by its members. Its files live below RootID in
+// the owner's tree and are uploaded to the org's channel.
+type Org struct {
+	ID        string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	Name      string    `gorm:"type:text;not null"`
+	OwnerID   int64     `gorm:"type:bigint;not null"`
+	ChannelID int64     `gorm:"type:bigint;not null"`
+	RootID    string    `gorm:"type:text;not null"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
+
+type OrgMember struct {
+	OrgID     string    `gorm:"type:text;primaryKey"`
+	UserID    int64     `gorm:"type:bigint;primaryKey"`
+	Role      string    `gorm:"type:text;not null"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
+
+// OrgAudit records who changed what inside an org.
+type OrgAudit struct {
+	ID        int64     `gorm:"primaryKey"`
+	OrgID     string    `gorm:"type:text;not null"`
+	UserID    int64     `gorm:"type:bigint;not null"`
+	Action    string    `gorm:"type:text;not null"`
+	Target    *string   `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// Pin puts a file or folder on the quick access list of a user, in the order
+// of Position.
+type Pin struct {
+	UserID    int64     `gorm:"type:bigint;primaryKey"`
+	FileID    string    `gorm:"type:text;primaryKey"`
+	Position  int       `gorm:"type:integer;not null"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
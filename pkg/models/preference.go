@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Preference holds the display settings of a user, so they follow the user
+// across devices.
+type Preference struct {
+	UserID     int64     `gorm:"type:bigint;primaryKey"`
+	Sort       string    `gorm:"type:text;not null"`
+	SortOrder  string    `gorm:"type:text;not null"`
+	PageSize   int       `gorm:"type:integer;not null"`
+	ShowHidden bool      `gorm:"type:boolean;not null"`
+	DateFormat string    `gorm:"type:text;not null"`
+	UpdatedAt  time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
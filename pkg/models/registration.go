@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Invite lets up to MaxUses new users sign up when registration needs an
+// invite or an approval.
+type Invite struct {
+	Code      string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	CreatedBy int64      `gorm:"type:bigint;not null"`
+	Note      string     `gorm:"type:text;not null"`
+	MaxUses   int        `gorm:"type:integer;not null"`
+	Uses      int        `gorm:"type:integer;not null"`
+	ExpiresAt *time.Time `gorm:"type:timestamp"`
+	CreatedAt time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
+
+// Registration is a sign up waiting for an admin, or turned down by one.
+type Registration struct {
+	UserID    int64     `gorm:"type:bigint;primaryKey"`
+	Name      string    `gorm:"type:text;not null"`
+	UserName  string    `gorm:"type:text;not null"`
+	IsPremium bool      `gorm:"type:boolean;not null"`
+	Status    string    `gorm:"type:text;not null"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+	UpdatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
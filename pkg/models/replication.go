@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// ReplicationState is the single row where a replica keeps the cursor of the
+// feed of its primary.
+type ReplicationState struct {
+	ID           int        `gorm:"type:int;primaryKey"`
+	CursorAt     time.Time  `gorm:"type:timestamp"`
+	CursorID     string     `gorm:"type:text"`
+	ReconciledAt *time.Time `gorm:"type:timestamp"`
+	UpdatedAt    time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
+
+// ReplicaChannel is the channel a replica forwards the messages of a user to.
+type ReplicaChannel struct {
+	UserID    int64 `gorm:"type:bigint;primaryKey"`
+	ChannelID int64 `gorm:"type:bigint"`
+}
+
+// ReplicaCopy is the forwarded copy of the messages of a replicated file. The
+// source parts tell whether the file still holds the messages copied.
+type ReplicaCopy struct {
+	FileID          string    `gorm:"type:text;primaryKey"`
+	UserID          int64     `gorm:"type:bigint"`
+	SourceChannelID int64     `gorm:"type:bigint"`
+	SourceParts     Parts     `gorm:"type:jsonb"`
+	ChannelID       int64     `gorm:"type:bigint"`
+	Parts           Parts     `gorm:"type:jsonb"`
+	CreatedAt       time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
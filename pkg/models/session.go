@@ -5,8 +5,10 @@ import (
 )
 
 type Session struct {
-	UserId    int64     `gorm:"type:bigint;primaryKey"`
-	Hash      string    `gorm:"type:text"`
-	Session   string    `gorm:"type:text"`
-	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+	UserId  int64  `gorm:"type:bigint;primaryKey"`
+	Hash    string `gorm:"type:text"`
+	Session string `gorm:"type:text"`
+	// Replicated marks the sessions a replica pulled from its primary.
+	Replicated bool      `gorm:"type:bool"`
+	CreatedAt  time.Time `gorm:"default:timezone('utc'::text, now())"`
 }
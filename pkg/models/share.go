@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// Share grants another user access to a file or to everything below a folder.
+type Share struct {
+	ID         string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	FileID     string    `gorm:"type:text;not null"`
+	OwnerID    int64     `gorm:"type:bigint;not null"`
+	UserID     int64     `gorm:"type:bigint;not null"`
+	Permission string    `gorm:"type:text;not null"`
+	CreatedAt  time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
+
+// ShareLink lets anyone holding its id download a file, within the limits set
+// by the owner. Zero limits mean unlimited.
+type ShareLink struct {
+	ID           string     `gorm:"type:text;primaryKey;default:generate_uid(24)"`
+	FileID       string     `gorm:"type:text;not null"`
+	OwnerID      int64      `gorm:"type:bigint;not null"`
+	MaxDownloads int        `gorm:"type:integer"`
+	RateLimit    int        `gorm:"type:integer"`
+	ExpiresAt    *time.Time `gorm:"type:timestamp"`
+	Downloads    int64      `gorm:"type:bigint"`
+	BytesServed  int64      `gorm:"type:bigint"`
+	LastAccessAt *time.Time `gorm:"type:timestamp"`
+	CreatedAt    time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
+
+// ShareLinkVisitor records an address a share link was downloaded from.
+type ShareLinkVisitor struct {
+	LinkID string `gorm:"type:text;primaryKey"`
+	IP     string `gorm:"type:text;primaryKey"`
+}
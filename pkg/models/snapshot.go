@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Snapshot is the frozen state of the folder at Path. Its entries share the
+// messages of the files they were taken from, which are kept until no file
+// or snapshot holds them.
+type Snapshot struct {
+	ID        string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID    int64     `gorm:"type:bigint;not null"`
+	FolderID  *string   `gorm:"type:text"`
+	Path      string    `gorm:"type:text;not null"`
+	Name      string    `gorm:"type:text;not null"`
+	Files     int64     `gorm:"type:bigint;not null"`
+	Size      int64     `gorm:"type:bigint;not null"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
+
+// SnapshotFile is an entry of a snapshot, at Path relative to its folder.
+type SnapshotFile struct {
+	SnapshotID string    `gorm:"type:text;primaryKey"`
+	Path       string    `gorm:"type:text;primaryKey"`
+	Parent     string    `gorm:"type:text;not null"`
+	Name       string    `gorm:"type:text;not null"`
+	Type       string    `gorm:"type:text;not null"`
+	MimeType   string    `gorm:"type:text;not null"`
+	Size       *int64    `gorm:"type:bigint"`
+	Parts      *Parts    `gorm:"type:jsonb"`
+	ChannelID  *int64    `gorm:"type:bigint"`
+	Encrypted  bool      `gorm:"default:false"`
+	Checksum   *string   `gorm:"type:text"`
+	UpdatedAt  time.Time `gorm:"type:timestamp"`
+}
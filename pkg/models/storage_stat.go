@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// StorageStat is the daily rollup of the bytes a user added and removed in a
+// category, maintained by the storage stats cron job.
+type StorageStat struct {
+	UserID       int64     `gorm:"type:bigint;primaryKey"`
+	Day          time.Time `gorm:"type:date;primaryKey"`
+	Category     string    `gorm:"type:text;primaryKey"`
+	AddedBytes   int64     `gorm:"type:bigint;not null"`
+	AddedFiles   int64     `gorm:"type:bigint;not null"`
+	RemovedBytes int64     `gorm:"type:bigint;not null"`
+	RemovedFiles int64     `gorm:"type:bigint;not null"`
+}
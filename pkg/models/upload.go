@@ -14,5 +14,6 @@ type Upload struct {
 	Salt      string    `gorm:"type:text"`
 	ChannelID int64     `gorm:"type:bigint"`
 	Size      int64     `gorm:"type:bigint"`
+	MimeType  *string   `gorm:"type:text"`
 	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
 }
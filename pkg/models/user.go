@@ -4,11 +4,17 @@ import (
 	"time"
 )
 
+// User is a Telegram account using the drive. Its two-factor settings are
+// secrets and are left out of JSON, so backups do not carry them.
 type User struct {
-	UserId    int64     `gorm:"type:bigint;primaryKey"`
-	Name      string    `gorm:"type:text"`
-	UserName  string    `gorm:"type:text"`
-	IsPremium bool      `gorm:"type:bool"`
-	UpdatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
-	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+	UserId       int64     `gorm:"type:bigint;primaryKey"`
+	Name         string    `gorm:"type:text"`
+	UserName     string    `gorm:"type:text"`
+	IsPremium    bool      `gorm:"type:bool"`
+	Disabled     bool      `gorm:"type:bool"`
+	TotpSecret   *string   `gorm:"type:text" json:"-"`
+	TotpEnabled  bool      `gorm:"type:bool" json:"-"`
+	TotpLastStep int64     `gorm:"type:bigint" json:"-"`
+	UpdatedAt    time.Time `gorm:"default:timezone('utc'::text, now())"`
+	CreatedAt    time.Time `gorm:"default:timezone('utc'::text, now())"`
 }
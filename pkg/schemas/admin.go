@@ -0,0 +1,71 @@
+package schemas
+
+import "time"
+
+type BotWorkload struct {
+	BotID          int64      `json:"botId"`
+	BotUserName    string     `json:"botUserName"`
+	ChannelID      int64      `json:"channelId"`
+	Status         string     `json:"status"`
+	Disabled       bool       `json:"disabled"`
+	Streams        int        `json:"streams"`
+	BytesServed    int64      `json:"bytesServed"`
+	Errors         int        `json:"errors"`
+	Reconnects     int        `json:"reconnects"`
+	LatencyMs      int64      `json:"latencyMs"`
+	FloodWaitUntil *time.Time `json:"floodWaitUntil,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+}
+
+// ConfigReload lists the flag names of the settings a reload applied and of
+// those that changed but need a restart.
+type ConfigReload struct {
+	Changed         []string `json:"changed"`
+	RestartRequired []string `json:"restartRequired"`
+}
+
+// Maintenance keeps the API read-only. RetryAfter, in seconds, is what
+// rejected requests are told to wait.
+type Maintenance struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message,omitempty"`
+	RetryAfter int        `json:"retryAfter,omitempty" binding:"min=0"`
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+// ReplicationStatus reports how far a replica is behind its primary. Lag is
+// the time between the newest change of the primary and the newest change
+// applied, as of LastPullAt. SessionKey is the public key of a replica, which
+// its primary seals sessions to.
+type ReplicationStatus struct {
+	Role            string     `json:"role"`
+	PrimaryUrl      string     `json:"primaryUrl,omitempty"`
+	SessionKey      string     `json:"sessionKey,omitempty"`
+	Cursor          *time.Time `json:"cursor,omitempty"`
+	Latest          *time.Time `json:"latest,omitempty"`
+	LagSeconds      float64    `json:"lagSeconds"`
+	LastPullAt      *time.Time `json:"lastPullAt,omitempty"`
+	LastReconcileAt *time.Time `json:"lastReconcileAt,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+	Applied         int64      `json:"applied"`
+	Removed         int64      `json:"removed"`
+	Mirrored        int64      `json:"mirrored"`
+}
+
+type ReplicationFiles struct {
+	IDs []string `json:"ids" binding:"required,max=500"`
+}
+
+// QuarantinedFile is an upload held by the upload policy until an admin
+// releases or deletes it.
+type QuarantinedFile struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mimeType"`
+	Size      int64     `json:"size"`
+	UserID    int64     `json:"userId"`
+	ParentID  string    `json:"parentId"`
+	CreatedAt time.Time `json:"createdAt"`
+	// QuarantineReason is the rule or the scan result that held the file.
+	QuarantineReason string `json:"reason,omitempty"`
+}
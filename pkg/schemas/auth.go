@@ -1,5 +1,7 @@
 package schemas
 
+import "time"
+
 type TgSession struct {
 	Sesssion  string `json:"session"`
 	UserID    int64  `json:"userId"`
@@ -7,12 +9,80 @@ type TgSession struct {
 	UserName  string `json:"userName"`
 	Name      string `json:"name"`
 	IsPremium bool   `json:"isPremium"`
+	// InviteCode lets a new user sign up when registration needs an invite.
+	InviteCode string `json:"inviteCode,omitempty"`
 }
 
 type Session struct {
-	Name      string `json:"name"`
-	UserName  string `json:"userName"`
-	IsPremium bool   `json:"isPremium"`
-	Hash      string `json:"hash"`
-	Expires   string `json:"expires"`
+	Name        string       `json:"name"`
+	UserName    string       `json:"userName"`
+	IsPremium   bool         `json:"isPremium"`
+	Hash        string       `json:"hash"`
+	Expires     string       `json:"expires"`
+	Preferences *Preferences `json:"preferences,omitempty"`
+	QuickAccess []FileOut    `json:"quickAccess,omitempty"`
+}
+
+type InviteIn struct {
+	Note      string     `json:"note"`
+	MaxUses   int        `json:"maxUses" binding:"omitempty,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type InviteOut struct {
+	Code      string     `json:"code"`
+	Note      string     `json:"note"`
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type RegistrationQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending rejected"`
+}
+
+type RegistrationOut struct {
+	UserID    int64     `json:"userId"`
+	Name      string    `json:"name"`
+	UserName  string    `json:"userName"`
+	IsPremium bool      `json:"isPremium"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OIDCConfig struct {
+	Enabled bool `json:"enabled"`
+	Enforce bool `json:"enforce"`
+}
+
+type OIDCCallback struct {
+	Code             string `form:"code"`
+	State            string `form:"state"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+// TOTPSetup is the secret an authenticator app is enrolled with, also as an
+// otpauth URL for QR codes.
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+type TOTPCode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ElevateIn confirms the session with a TOTP code when two-factor
+// authentication is enabled, or with a Telegram session from a fresh login of
+// the same account otherwise.
+type ElevateIn struct {
+	Code    string `json:"code,omitempty"`
+	Session string `json:"session,omitempty"`
+}
+
+type Elevation struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
 }
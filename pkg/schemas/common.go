@@ -2,4 +2,6 @@ package schemas
 
 type Message struct {
 	Message string `json:"message"`
+	// Operation is the id to undo the change with, see /api/operations.
+	Operation string `json:"operation,omitempty"`
 }
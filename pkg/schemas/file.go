@@ -16,6 +16,7 @@ type FileQuery struct {
 	Path          string     `form:"path"`
 	Op            string     `form:"op"`
 	Starred       *bool      `form:"starred"`
+	Hidden        *bool      `form:"hidden"`
 	ParentID      string     `form:"parentId"`
 	Category      string     `form:"category"`
 	UpdatedAt     *time.Time `form:"updatedAt"`
@@ -23,6 +24,13 @@ type FileQuery struct {
 	Order         string     `form:"order"`
 	PerPage       int        `form:"perPage"`
 	NextPageToken string     `form:"nextPageToken"`
+	Scanner       bool       `form:"scanner"`
+	WinCompat     bool       `form:"winCompat"`
+	Count         bool       `form:"count"`
+	// Wait holds a listing until the folder no longer matches IfChangedSince,
+	// the etag of an earlier listing.
+	Wait           time.Duration `form:"wait"`
+	IfChangedSince string        `form:"ifChangedSince"`
 }
 
 type FileIn struct {
@@ -35,21 +43,51 @@ type FileIn struct {
 	Size      int64  `json:"size"`
 	ParentID  string `json:"parentId"`
 	Encrypted bool   `json:"encrypted"`
+	Hidden    bool   `json:"hidden"`
+	// QuickHash is the quick hash the uploader computed, see internal/quickhash.
+	QuickHash string `json:"quickHash" binding:"omitempty,len=64,hexadecimal"`
+	// SHA256 and MD5 are checksums the uploader expects, checked against the
+	// stored parts before the file is created.
+	SHA256 string `json:"sha256" binding:"omitempty,len=64,hexadecimal"`
+	MD5    string `json:"md5" binding:"omitempty,len=32,hexadecimal"`
+	// TargetID is the file or folder a shortcut points at.
+	TargetID string `json:"targetId" binding:"required_if=Type shortcut"`
 }
 
 type FileOut struct {
-	ID         string    `json:"id"`
-	Name       string    `json:"name"`
-	Type       string    `json:"type"`
-	MimeType   string    `json:"mimeType"`
-	Category   string    `json:"category,omitempty"`
-	Encrypted  bool      `json:"encrypted"`
-	Path       string    `json:"path,omitempty"`
-	Size       int64     `json:"size,omitempty"`
-	Starred    bool      `json:"starred"`
-	ParentID   string    `json:"parentId,omitempty"`
-	ParentPath string    `json:"parentPath,omitempty"`
-	UpdatedAt  time.Time `json:"updatedAt,omitempty"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	MimeType  string `json:"mimeType"`
+	Category  string `json:"category,omitempty"`
+	Encrypted bool   `json:"encrypted"`
+	Path      string `json:"path,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Checksum  string `json:"checksum,omitempty"`
+	QuickHash string `json:"quickHash,omitempty"`
+	// Operation is set on renames, with the id to undo them with.
+	Operation string `json:"operation,omitempty"`
+	// TargetID and TargetType are set on shortcuts, which otherwise list
+	// the size and type of their target.
+	TargetID   string `json:"targetId,omitempty"`
+	TargetType string `json:"targetType,omitempty" gorm:"-"`
+	// IntegrityError is set when verification found the file damaged.
+	IntegrityError string    `json:"integrityError,omitempty"`
+	Starred        bool      `json:"starred"`
+	Hidden         bool      `json:"hidden,omitempty"`
+	Color          string    `json:"color,omitempty"`
+	Icon           string    `json:"icon,omitempty"`
+	Quarantined    bool      `json:"quarantined,omitempty" gorm:"-"`
+	ScanStatus     string    `json:"scanStatus,omitempty"`
+	Revision       int64     `json:"revision"`
+	ParentID       string    `json:"parentId,omitempty"`
+	ParentPath     string    `json:"parentPath,omitempty"`
+	UpdatedAt      time.Time `json:"updatedAt,omitempty"`
+	CreatedAt      time.Time `json:"createdAt,omitempty"`
+	Inode          uint64    `json:"inode,omitempty" gorm:"-"`
+	ModTime        int64     `json:"mtime,omitempty" gorm:"-"`
+	// SortValue is the listing's sort key as text, read for page tokens.
+	SortValue string `json:"-"`
 }
 
 type FileOutFull struct {
@@ -64,20 +102,103 @@ type FileUpdate struct {
 	Type      string    `json:"type,omitempty"`
 	Path      string    `json:"path,omitempty"`
 	Starred   *bool     `json:"starred,omitempty"`
+	Hidden    *bool     `json:"hidden,omitempty"`
+	Color     *string   `json:"color,omitempty" binding:"omitempty,hexcolor"`
+	Icon      *string   `json:"icon,omitempty" binding:"omitempty,max=32"`
 	ParentID  string    `json:"parentId,omitempty"`
 	UpdatedAt time.Time `json:"updatedAt,omitempty"`
 	Parts     []Part    `json:"parts,omitempty"`
 	Size      *int64    `json:"size,omitempty"`
+	// Revision, when set, makes the update fail unless the file is still at it.
+	Revision *int64 `json:"revision,omitempty"`
 }
 
 type FileResponse struct {
 	Files         []FileOut `json:"results"`
 	NextPageToken string    `json:"nextPageToken,omitempty"`
+	HasMore       bool      `json:"hasMore"`
+	ETag          string    `json:"etag,omitempty"`
+	// TotalCount and Summary cover all pages and are only set when asked for.
+	TotalCount *int64       `json:"totalCount,omitempty"`
+	Summary    *ListSummary `json:"summary,omitempty"`
+}
+
+type ListSummary struct {
+	Files   int64 `json:"files"`
+	Folders int64 `json:"folders"`
+	Size    int64 `json:"size"`
+}
+
+// FolderAppearance sets the color and icon of folders. A field left out is
+// kept and an empty one is cleared.
+type FolderAppearance struct {
+	Files []string `json:"files" binding:"required,min=1"`
+	Color *string  `json:"color" binding:"omitempty,hexcolor"`
+	Icon  *string  `json:"icon" binding:"omitempty,max=32"`
 }
 
 type FileOperation struct {
 	Files       []string `json:"files"  binding:"required"`
 	Destination string   `json:"destination,omitempty"`
+	// Revisions maps file ids to the revision they must still be at.
+	Revisions map[string]int64 `json:"revisions,omitempty"`
+}
+
+type TrashQuery struct {
+	Path string `form:"path"`
+}
+
+type TrashOut struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	MimeType    string     `json:"mimeType"`
+	Size        int64      `json:"size,omitempty"`
+	DeletedPath string     `json:"deletedPath,omitempty"`
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"`
+}
+
+// TrashRestore selects deleted files by id, or everything deleted from below
+// Path.
+type TrashRestore struct {
+	Files []string `json:"files,omitempty"`
+	Path  string   `json:"path,omitempty"`
+}
+
+// CleanupRuleIn either trashes files under Path not modified for Days, or
+// purges files deleted from below Path more than Days ago.
+type CleanupRuleIn struct {
+	Name    string `json:"name" binding:"required"`
+	Action  string `json:"action" binding:"required,oneof=trash purge"`
+	Path    string `json:"path"`
+	Days    int    `json:"days" binding:"required,min=1"`
+	Enabled *bool  `json:"enabled,omitempty"`
+}
+
+type CleanupRuleOut struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Action    string     `json:"action"`
+	Path      string     `json:"path"`
+	Days      int        `json:"days"`
+	Enabled   bool       `json:"enabled"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+	LastCount int64      `json:"lastCount"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// CleanupPreview lists what a cleanup rule would remove if it ran now. Files
+// holds at most the first hundred of them, oldest first.
+type CleanupPreview struct {
+	Count int64                `json:"count"`
+	Size  int64                `json:"size"`
+	Files []CleanupPreviewFile `json:"files"`
+}
+
+type CleanupPreviewFile struct {
+	ID   string    `json:"id"`
+	Name string    `json:"name"`
+	Size int64     `json:"size"`
+	Date time.Time `json:"date"`
 }
 
 type DirMove struct {
@@ -89,14 +210,207 @@ type MkDir struct {
 	Path string `json:"path" binding:"required"`
 }
 
+type FolderTemplate struct {
+	Path     string   `json:"path" binding:"required"`
+	Template string   `json:"template,omitempty"`
+	Folders  []string `json:"folders,omitempty"`
+}
+
 type Copy struct {
 	ID          string `json:"id" binding:"required"`
 	Name        string `json:"name" binding:"required"`
 	Destination string `json:"destination" binding:"required"`
 }
 
+// FileSplit cuts a file into Pieces files along its parts.
+type FileSplit struct {
+	Pieces int `json:"pieces" binding:"required,min=2"`
+}
+
+// FileJoin joins Files, in order, into a file named Name in the folder of the
+// first one.
+type FileJoin struct {
+	Files []string `json:"files" binding:"required,min=2,max=1000"`
+	Name  string   `json:"name" binding:"required"`
+}
+
+type SnapshotIn struct {
+	FolderID string `json:"folderId" binding:"required"`
+	Name     string `json:"name" binding:"required,max=128"`
+}
+
+type SnapshotOut struct {
+	ID        string    `json:"id"`
+	FolderID  string    `json:"folderId,omitempty"`
+	Path      string    `json:"path"`
+	Name      string    `json:"name"`
+	Files     int64     `json:"files"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SnapshotEntry is a file or folder of a snapshot, Path is relative to the
+// snapshotted folder.
+type SnapshotEntry struct {
+	Path      string    `json:"path"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	MimeType  string    `json:"mimeType"`
+	Size      int64     `json:"size,omitempty"`
+	Encrypted bool      `json:"encrypted"`
+	Checksum  string    `json:"checksum,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SnapshotRestore recreates a snapshot at Destination, which must not exist
+// yet. It defaults to the snapshotted folder with the snapshot name appended.
+type SnapshotRestore struct {
+	Destination string `json:"destination" binding:"omitempty,startswith=/"`
+}
+
+// MountIn attaches a channel, Name defaults to the title of the channel.
+type MountIn struct {
+	ChannelID int64  `json:"channelId" binding:"required"`
+	Name      string `json:"name" binding:"max=128"`
+}
+
+type MountOut struct {
+	ID        string    `json:"id"`
+	ChannelID int64     `json:"channelId"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// MountQuery pages through the history of a mounted channel, newest first,
+// from the message before OffsetID.
+type MountQuery struct {
+	OffsetID int `form:"offsetId"`
+	PerPage  int `form:"perPage,default=100" binding:"min=1,max=100"`
+}
+
+// MountListing lists the documents of a mounted channel, each one a file
+// whose id is the id of its message.
+type MountListing struct {
+	Files        []FileOut `json:"results"`
+	NextOffsetID int       `json:"nextOffsetId,omitempty"`
+}
+
 type FileCategoryStats struct {
 	TotalFiles int    `json:"totalFiles"`
 	TotalSize  int    `json:"totalSize"`
 	Category   string `json:"category"`
 }
+
+type Subtitle struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Language string `json:"language,omitempty"`
+	Format   string `json:"format"`
+}
+
+type ImageQuery struct {
+	Width   int    `form:"w" binding:"gte=0,lte=4096"`
+	Height  int    `form:"h" binding:"gte=0,lte=4096"`
+	Format  string `form:"format"`
+	Quality int    `form:"q" binding:"gte=0,lte=100"`
+}
+
+type PlaylistQuery struct {
+	Format  string `form:"format" binding:"omitempty,oneof=m3u m3u8"`
+	Expires string `form:"expires"`
+}
+
+type ShareIn struct {
+	UserName   string `json:"userName" binding:"required"`
+	Permission string `json:"permission" binding:"required,oneof=read write"`
+}
+
+type ShareOut struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"userId"`
+	UserName   string    `json:"userName"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ShareLinkIn limits a share link. RateLimit is in KiB per second and zero
+// values mean unlimited.
+type ShareLinkIn struct {
+	MaxDownloads int        `json:"maxDownloads" binding:"gte=0"`
+	RateLimit    int        `json:"rateLimit" binding:"gte=0"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+}
+
+type ShareLinkOut struct {
+	ID           string     `json:"id"`
+	URL          string     `json:"url"`
+	MaxDownloads int        `json:"maxDownloads"`
+	RateLimit    int        `json:"rateLimit"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	Downloads    int64      `json:"downloads"`
+	UniqueIPs    int64      `json:"uniqueIps"`
+	BytesServed  int64      `json:"bytesServed"`
+	LastAccessAt *time.Time `json:"lastAccessAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// TelegramSend names the chat a file is sent to: "me" for Saved Messages, a
+// username, a t.me link or the phone number of a contact.
+type TelegramSend struct {
+	To     string `json:"to" binding:"required"`
+	Silent bool   `json:"silent"`
+}
+
+type ExportQuery struct {
+	Format string `form:"format" binding:"omitempty,oneof=json sql"`
+}
+
+// IndexQuery picks the format of a folder index and whether its files get
+// share links, which expire at ExpiresAt when set.
+type IndexQuery struct {
+	Format    string     `form:"format" binding:"omitempty,oneof=json html"`
+	Links     bool       `form:"links"`
+	ExpiresAt *time.Time `form:"expiresAt"`
+}
+
+// FolderIndex lists the items below a folder, with their paths relative to
+// it, for publishing a catalog of its content.
+type FolderIndex struct {
+	Name        string       `json:"name"`
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Files       int64        `json:"files"`
+	Folders     int64        `json:"folders"`
+	Size        int64        `json:"size"`
+	Entries     []IndexEntry `json:"entries"`
+}
+
+type IndexEntry struct {
+	Path      string    `json:"path"`
+	Type      string    `json:"type"`
+	Size      int64     `json:"size,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	URL       string    `json:"url,omitempty"`
+}
+
+type PreviewQuery struct {
+	Size int `form:"size" binding:"gte=0,lte=1024"`
+}
+
+// DryRun lists what a move or delete would affect, without making it. Files,
+// Folders and Size count whole subtrees while Entries holds the first of them,
+// shallowest first, and Truncated tells that there are more.
+type DryRun struct {
+	Files     int64         `json:"files"`
+	Folders   int64         `json:"folders"`
+	Size      int64         `json:"size"`
+	Entries   []DryRunEntry `json:"entries"`
+	Truncated bool          `json:"truncated"`
+}
+
+type DryRunEntry struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	ParentID string `json:"parentId"`
+}
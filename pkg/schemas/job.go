@@ -0,0 +1,117 @@
+package schemas
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobOut struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Progress   int64           `json:"progress"`
+	Total      int64           `json:"total"`
+	Error      string          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+type JobQuery struct {
+	Type   string `form:"type"`
+	Status string `form:"status"`
+}
+
+type ArchiveExtract struct {
+	Destination string `json:"destination" binding:"required"`
+}
+
+type ArchiveExtractResult struct {
+	Files   int      `json:"files"`
+	Folders int      `json:"folders"`
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+type DeleteResult struct {
+	Deleted int `json:"deleted"`
+	// Pending counts deleted files whose messages are left to the cleanup cron.
+	Pending int      `json:"pending,omitempty"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+type RestoreResult struct {
+	Restored int      `json:"restored"`
+	Renamed  int      `json:"renamed"`
+	Failed   int      `json:"failed"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+type ArchiveCreate struct {
+	Files       []string `json:"files" binding:"required,min=1"`
+	Name        string   `json:"name" binding:"required"`
+	Destination string   `json:"destination" binding:"required"`
+	Level       *int     `json:"level,omitempty" binding:"omitempty,min=0,max=9"`
+	Encrypted   bool     `json:"encrypted"`
+}
+
+type VerifyQuery struct {
+	Full bool `form:"full"`
+	// UserID limits the run to the files of one user, all users when unset.
+	UserID int64 `form:"userId" json:"userId,omitempty"`
+}
+
+type VerifyResult struct {
+	Checked   int      `json:"checked"`
+	Corrupted int      `json:"corrupted"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+type OrphanResult struct {
+	Found  int      `json:"found"`
+	Purged int      `json:"purged"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type ChecksumResult struct {
+	Updated int      `json:"updated"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+type MimeResult struct {
+	Checked int      `json:"checked"`
+	Updated int      `json:"updated"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+type DuplicateSet struct {
+	Checksum string    `json:"checksum"`
+	Size     int64     `json:"size"`
+	Files    []FileOut `json:"files"`
+}
+
+type DuplicateResult struct {
+	Sets     []DuplicateSet `json:"sets"`
+	Unhashed int64          `json:"unhashed"`
+	// Wasted is the size taken by all copies but one of each set.
+	Wasted int64 `json:"wasted"`
+}
+
+type DuplicateResolve struct {
+	Checksums []string `json:"checksums" binding:"required,min=1"`
+}
+
+type ImportIn struct {
+	ChannelID   int64  `json:"channelId" binding:"required"`
+	Destination string `json:"destination" binding:"required"`
+}
+
+type ImportResult struct {
+	Scanned  int `json:"scanned"`
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
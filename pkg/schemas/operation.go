@@ -0,0 +1,12 @@
+package schemas
+
+import "time"
+
+type OperationOut struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Files     []string   `json:"files"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UndoneAt  *time.Time `json:"undoneAt,omitempty"`
+}
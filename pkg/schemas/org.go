@@ -0,0 +1,46 @@
+package schemas
+
+import (
+	"time"
+)
+
+type OrgIn struct {
+	Name      string `json:"name" binding:"required,excludesall=/"`
+	ChannelID int64  `json:"channelId" binding:"required"`
+}
+
+type OrgOut struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   int64     `json:"ownerId"`
+	ChannelID int64     `json:"channelId"`
+	RootID    string    `json:"rootId"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OrgMemberIn struct {
+	UserName string `json:"userName" binding:"required"`
+	Role     string `json:"role" binding:"required,oneof=admin editor viewer"`
+}
+
+type OrgMemberOut struct {
+	UserID    int64     `json:"userId"`
+	UserName  string    `json:"userName"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OrgAuditQuery struct {
+	UserID int64 `form:"userId"`
+	Before int64 `form:"before"`
+}
+
+type OrgAuditOut struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"userId"`
+	UserName  string    `json:"userName"`
+	Action    string    `json:"action"`
+	Target    *string   `json:"target,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,28 @@
+package schemas
+
+type Preferences struct {
+	Sort       string `json:"sort" binding:"required,oneof=name updatedAt createdAt size id category extension"`
+	Order      string `json:"order" binding:"required,oneof=asc desc"`
+	PageSize   int    `json:"pageSize" binding:"required,min=1,max=1000"`
+	ShowHidden bool   `json:"showHidden"`
+	DateFormat string `json:"dateFormat" binding:"max=64"`
+}
+
+// NotificationSettings opts in to the messages the notification bot sends.
+// StorageLimit is the storage in bytes the user is warned about nearing, none
+// when 0.
+type NotificationSettings struct {
+	ShareAccessed   bool  `json:"shareAccessed"`
+	StorageFull     bool  `json:"storageFull"`
+	ImportFinished  bool  `json:"importFinished"`
+	IntegrityFailed bool  `json:"integrityFailed"`
+	StorageLimit    int64 `json:"storageLimit" binding:"min=0"`
+	// Available is false when the server has no notification bot.
+	Available bool `json:"available"`
+}
+
+// QuickAccessIn names files and folders to pin, or the whole quick access
+// list in its new order.
+type QuickAccessIn struct {
+	Files []string `json:"files" binding:"required,min=1,dive,required"`
+}
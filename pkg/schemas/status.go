@@ -0,0 +1,26 @@
+package schemas
+
+import "time"
+
+type ComponentStatus struct {
+	Name   string  `json:"name"`
+	Status string  `json:"status"`
+	Uptime float64 `json:"uptime"`
+}
+
+type Status struct {
+	Status     string            `json:"status"`
+	Components []ComponentStatus `json:"components"`
+	Since      time.Time         `json:"since"`
+	CheckedAt  time.Time         `json:"checkedAt"`
+}
+
+type ComponentCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type Readiness struct {
+	Status     string           `json:"status"`
+	Components []ComponentCheck `json:"components"`
+}
@@ -1,5 +1,7 @@
 package schemas
 
+import "time"
+
 type UploadQuery struct {
 	PartName  string `form:"partName" binding:"required"`
 	FileName  string `form:"fileName" binding:"required"`
@@ -36,3 +38,115 @@ type UploadStats struct {
 	UploadDate    string `json:"uploadDate"`
 	TotalUploaded int64  `json:"totalUploaded"`
 }
+
+type SnippetQuery struct {
+	Path      string `form:"path" binding:"required"`
+	Name      string `form:"name" binding:"required"`
+	Encrypted bool   `form:"encrypted"`
+}
+
+// AgentIn registers a watcher agent mirroring a local folder into Root.
+// Conflict is how files pushed over one changed on the server are stored.
+type AgentIn struct {
+	Name     string `json:"name" binding:"required,max=128"`
+	Root     string `json:"root" binding:"required,startswith=/"`
+	Conflict string `json:"conflict" binding:"omitempty,oneof=keep-both client-wins last-writer-wins server-wins"`
+}
+
+// AgentOut describes an agent. Token is only returned when it is created.
+type AgentOut struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Root       string     `json:"root"`
+	Conflict   string     `json:"conflict"`
+	Token      string     `json:"token,omitempty"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type AgentSession struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// AgentEntry is a local file, at Path relative to the mirrored folder, with
+// the hex SHA-256 of its content.
+type AgentEntry struct {
+	Path     string `json:"path" binding:"required"`
+	Size     int64  `json:"size" binding:"gte=0"`
+	Checksum string `json:"checksum" binding:"required,len=64,hexadecimal"`
+}
+
+// AgentManifest lists every file of the mirrored folder.
+type AgentManifest struct {
+	Files []AgentEntry `json:"files" binding:"max=50000,dive"`
+}
+
+type AgentMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// AgentPlan tells an agent which files to push. Files renamed locally were
+// found by their checksum and already moved, and Orphans are stored under the
+// root without a local file.
+type AgentPlan struct {
+	Upload    []string    `json:"upload"`
+	Moved     []AgentMove `json:"moved"`
+	Orphans   []string    `json:"orphans"`
+	Unchanged int         `json:"unchanged"`
+}
+
+// AgentCommit stores the parts pushed for a local file. BaseChecksum is the
+// checksum of the stored file the agent last synced, ModTime when the local
+// file was last modified. Conflict overrides the policy of the agent.
+type AgentCommit struct {
+	Path         string     `json:"path" binding:"required"`
+	Size         int64      `json:"size" binding:"gte=0"`
+	Checksum     string     `json:"checksum" binding:"required,len=64,hexadecimal"`
+	BaseChecksum string     `json:"baseChecksum" binding:"omitempty,len=64,hexadecimal"`
+	ModTime      *time.Time `json:"modTime,omitempty"`
+	Parts        []Part     `json:"parts" binding:"required,min=1"`
+	ChannelID    int64      `json:"channelId"`
+	Encrypted    bool       `json:"encrypted"`
+	Conflict     string     `json:"conflict" binding:"omitempty,oneof=keep-both client-wins last-writer-wins server-wins"`
+}
+
+// AgentCommitOut tells what a commit did: created, replaced, conflict or
+// resolved. File is the stored pushed file, if it was stored.
+type AgentCommitOut struct {
+	Action   string            `json:"action"`
+	File     *FileOut          `json:"file,omitempty"`
+	Conflict *AgentConflictOut `json:"conflict,omitempty"`
+}
+
+type AgentConflictOut struct {
+	ID         string     `json:"id"`
+	Path       string     `json:"path"`
+	FileID     string     `json:"fileId,omitempty"`
+	Checksum   string     `json:"checksum"`
+	Size       int64      `json:"size"`
+	ModTime    *time.Time `json:"modTime,omitempty"`
+	Policy     string     `json:"policy"`
+	Resolution string     `json:"resolution,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+type AgentResolve struct {
+	Keep string `json:"keep" binding:"required,oneof=server client both"`
+}
+
+// UploadSession is an upload in progress, whose parts are kept until it is
+// finalized, aborted or expires.
+type UploadSession struct {
+	UploadId  string    `json:"uploadId"`
+	Name      string    `json:"name"`
+	ChannelID int64     `json:"channelId"`
+	Parts     int       `json:"parts"`
+	Size      int64     `json:"size"`
+	Encrypted bool      `json:"encrypted"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
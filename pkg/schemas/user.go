@@ -5,7 +5,28 @@ type Channel struct {
 	ChannelName string `json:"channelName"`
 }
 
+type ChannelCreate struct {
+	ChannelName string   `json:"channelName"`
+	Bots        []string `json:"bots"`
+}
+
 type AccountStats struct {
 	ChannelID int64    `json:"channelId,omitempty"`
 	Bots      []string `json:"bots"`
 }
+
+type TimelineQuery struct {
+	Days     int    `form:"days" binding:"omitempty,min=1,max=366"`
+	Category string `form:"category"`
+}
+
+// TimelinePoint is the storage a user added and removed in a category on a
+// day, with removals counted once the file is purged from the trash.
+type TimelinePoint struct {
+	Day          string `json:"day"`
+	Category     string `json:"category"`
+	AddedBytes   int64  `json:"addedBytes"`
+	AddedFiles   int64  `json:"addedFiles"`
+	RemovedBytes int64  `json:"removedBytes"`
+	RemovedFiles int64  `json:"removedFiles"`
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/divyam234/teldrive/internal/cache"
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+)
+
+type AdminService struct {
+	db     *gorm.DB
+	cnf    *config.Config
+	worker *tgc.StreamWorker
+	live   *config.Live
+
+	maintenance *Maintenance
+}
+
+func NewAdminService(db *gorm.DB, cnf *config.Config, worker *tgc.StreamWorker, live *config.Live,
+	maintenance *Maintenance) *AdminService {
+	return &AdminService{db: db, cnf: cnf, worker: worker, live: live, maintenance: maintenance}
+}
+
+func botClientName(botId int64) string {
+	return "bot:" + strconv.FormatInt(botId, 10)
+}
+
+// ListBots reports the live workload of every bot the user has added. Bots that
+// have not served a stream since startup are reported as idle.
+func (as *AdminService) ListBots(ctx context.Context, userId int64) ([]schemas.BotWorkload, *types.AppError) {
+	var bots []models.Bot
+	if err := as.db.WithContext(ctx).Where("user_id = ?", userId).Order("channel_id, bot_id").
+		Find(&bots).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := make([]schemas.BotWorkload, 0, len(bots))
+	for _, bot := range bots {
+		stats, _ := as.worker.ClientStats(bot.ChannelID, botClientName(bot.BotID))
+		res = append(res, schemas.BotWorkload{
+			BotID:          bot.BotID,
+			BotUserName:    bot.BotUserName,
+			ChannelID:      bot.ChannelID,
+			Status:         stats.Status,
+			Disabled:       stats.Disabled,
+			Streams:        stats.Streams,
+			BytesServed:    stats.BytesServed,
+			Errors:         stats.Errors,
+			Reconnects:     stats.Reconnects,
+			LatencyMs:      stats.Latency.Milliseconds(),
+			FloodWaitUntil: stats.FloodWaitUntil,
+			LastError:      stats.LastError,
+		})
+	}
+	return res, nil
+}
+
+// ownedBot returns the client name of a bot the user added and the channels
+// they added it to, which are the only ones its state is changed in.
+func (as *AdminService) ownedBot(ctx context.Context, userId int64, botId string) (string, []int64, *types.AppError) {
+	id, err := strconv.ParseInt(botId, 10, 64)
+	if err != nil {
+		return "", nil, &types.AppError{Error: errors.New("invalid bot id"), Code: http.StatusBadRequest}
+	}
+	var channelIds []int64
+	if err := as.db.WithContext(ctx).Model(&models.Bot{}).Where("user_id = ?", userId).
+		Where("bot_id = ?", id).Pluck("channel_id", &channelIds).Error; err != nil {
+		return "", nil, &types.AppError{Error: err}
+	}
+	if len(channelIds) == 0 {
+		return "", nil, &types.AppError{Error: errors.New("bot not found"), Code: http.StatusNotFound}
+	}
+	return botClientName(id), channelIds, nil
+}
+
+// SetBotDisabled takes a bot out of stream rotation in the user's channels, or
+// puts it back. The flag lives in memory and is cleared on restart.
+func (as *AdminService) SetBotDisabled(ctx context.Context, userId int64, botId string, disabled bool) (*schemas.Message, *types.AppError) {
+	name, channelIds, appErr := as.ownedBot(ctx, userId, botId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	as.worker.SetDisabled(channelIds, name, disabled)
+	if disabled {
+		return &schemas.Message{Message: "bot disabled"}, nil
+	}
+	return &schemas.Message{Message: "bot enabled"}, nil
+}
+
+// RotateBot cancels the streams a bot is serving in the user's channels so
+// clients reconnect through the remaining bots.
+func (as *AdminService) RotateBot(ctx context.Context, userId int64, botId string) (*schemas.Message, *types.AppError) {
+	name, channelIds, appErr := as.ownedBot(ctx, userId, botId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	count := as.worker.Rotate(channelIds, name)
+	return &schemas.Message{Message: fmt.Sprintf("%d streams rotated", count)}, nil
+}
+
+// ReloadConfig applies the reloadable settings from the configuration sources
+// right away, as a SIGHUP would.
+func (as *AdminService) ReloadConfig(ctx context.Context) (*schemas.ConfigReload, *types.AppError) {
+	changed, restart, err := as.live.Reload()
+	if err != nil {
+		if errors.Is(err, config.ErrReloadUnsupported) {
+			return nil, &types.AppError{Error: err, Code: http.StatusNotImplemented}
+		}
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+	res := &schemas.ConfigReload{Changed: []string{}, RestartRequired: []string{}}
+	res.Changed = append(res.Changed, changed...)
+	res.RestartRequired = append(res.RestartRequired, restart...)
+	return res, nil
+}
+
+// CacheStats reports the hits and misses of every cache namespace.
+func (as *AdminService) CacheStats() []cache.NamespaceStats {
+	return cache.Stats()
+}
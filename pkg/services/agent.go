@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/auth"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+// agentSessionTtl is how long the sessions agents trade their token for last.
+const agentSessionTtl = time.Hour
+
+// agentFilesQuery lists the active files in the folder tree of an agent root
+// along with the path of their folder.
+const agentFilesQuery = `
+SELECT f.id, f.name, f.size, f.checksum, p.path AS dir FROM teldrive.files f
+JOIN teldrive.files p ON p.id = f.parent_id
+WHERE f.user_id = ? AND f.type = 'file' AND f.status = 'active' AND p.type = 'folder'
+AND (p.path = ? OR p.path LIKE ?)`
+
+var errAgentSession = errors.New("invalid agent token")
+
+// CreateAgent registers a watcher agent on the caller's login session and
+// returns its token, which is not stored and cannot be shown again.
+func (fs *FileService) CreateAgent(c *gin.Context, payload *schemas.AgentIn) (*schemas.AgentOut, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+	val, _ := c.Get("jwtUser")
+	jwtUser := val.(*types.JWTClaims)
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	agent := &models.Agent{UserID: userId, Name: payload.Name, Root: path.Clean(payload.Root),
+		Conflict: payload.Conflict, TokenHash: hashAgentToken(token), SessionHash: jwtUser.Hash}
+	if agent.Conflict == "" {
+		agent.Conflict = "keep-both"
+	}
+	if _, err := createDirectories(c, fs.db, userId, agent.Root); err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if err := fs.db.WithContext(c).Create(agent).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := mapper.ToAgentOut(agent)
+	res.Token = token
+	return res, nil
+}
+
+func (fs *FileService) ListAgents(ctx context.Context, userId int64) ([]schemas.AgentOut, *types.AppError) {
+	var agents []models.Agent
+	if err := fs.db.WithContext(ctx).Where("user_id = ?", userId).Order("created_at").Find(&agents).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res := make([]schemas.AgentOut, 0, len(agents))
+	for i := range agents {
+		res = append(res, *mapper.ToAgentOut(&agents[i]))
+	}
+	return res, nil
+}
+
+func (fs *FileService) DeleteAgent(ctx context.Context, userId int64, id string) (*schemas.Message, *types.AppError) {
+	res := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).Delete(&models.Agent{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "agent removed"}, nil
+}
+
+// AgentSession trades the agent token in the Authorization header for a
+// session used with the rest of the API, uploads included.
+func (as *AuthService) AgentSession(c *gin.Context) (*schemas.AgentSession, *types.AppError) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, &types.AppError{Error: errAgentSession, Code: http.StatusUnauthorized}
+	}
+
+	var agent models.Agent
+	if err := as.db.WithContext(c).Where("token_hash = ?", hashAgentToken(token)).First(&agent).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: errAgentSession, Code: http.StatusUnauthorized}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	session, err := getSessionByHash(c, as.db, agent.SessionHash)
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("the login session of the agent ended"),
+			Code: http.StatusUnauthorized}
+	}
+
+	var user models.User
+	if err := as.db.WithContext(c).Where("user_id = ?", agent.UserID).First(&user).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if user.Disabled {
+		return nil, &types.AppError{Error: errors.New("user disabled"), Code: http.StatusUnauthorized}
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(agentSessionTtl)
+	claims := &types.JWTClaims{Claims: jwt.Claims{
+		Subject:  strconv.FormatInt(agent.UserID, 10),
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(expires),
+	}, TgSession: session.Session,
+		Name:      user.Name,
+		UserName:  user.UserName,
+		IsPremium: user.IsPremium,
+		Hash:      session.Hash,
+	}
+	jweToken, err := auth.Encode(as.cnf.JWT.Secret, claims)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	as.db.WithContext(c).Model(&agent).Update("last_seen_at", now)
+
+	return &schemas.AgentSession{Token: jweToken, ExpiresAt: expires}, nil
+}
+
+// PlanAgentSync compares the manifest of an agent with the files under its
+// root. A file missing at its path whose content is stored at a path the
+// manifest no longer has was renamed locally, so it is moved instead of
+// being pushed again. Stored files without a checksum count as unchanged
+// when their size matches.
+func (fs *FileService) PlanAgentSync(ctx context.Context, userId int64, id string, manifest *schemas.AgentManifest) (*schemas.AgentPlan, *types.AppError) {
+	agent, appErr := fs.agent(ctx, userId, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	prefix := strings.TrimSuffix(agent.Root, "/")
+	var remote []struct {
+		ID       string
+		Name     string
+		Size     *int64
+		Checksum *string
+		Dir      string
+	}
+	if err := fs.db.WithContext(ctx).Raw(agentFilesQuery, userId, agent.Root, escapeLike(prefix)+"/%").
+		Scan(&remote).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	type stored struct {
+		id       string
+		size     int64
+		checksum string
+	}
+	byPath := make(map[string]stored, len(remote))
+	for _, file := range remote {
+		s := stored{id: file.ID}
+		if file.Size != nil {
+			s.size = *file.Size
+		}
+		if file.Checksum != nil {
+			s.checksum = *file.Checksum
+		}
+		byPath[strings.TrimPrefix(path.Join(file.Dir, file.Name), prefix)] = s
+	}
+
+	local := make(map[string]bool, len(manifest.Files))
+	for i := range manifest.Files {
+		key, err := agentPath(manifest.Files[i].Path)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
+		manifest.Files[i].Path = key
+		local[key] = true
+	}
+
+	// stored files gone from their local path may have been renamed
+	renamed := make(map[string][]string)
+	for key, s := range byPath {
+		if !local[key] && s.checksum != "" {
+			content := s.checksum + ":" + strconv.FormatInt(s.size, 10)
+			renamed[content] = append(renamed[content], key)
+		}
+	}
+
+	plan := &schemas.AgentPlan{Upload: []string{}, Moved: []schemas.AgentMove{}, Orphans: []string{}}
+	for _, entry := range manifest.Files {
+		key, checksum := entry.Path, strings.ToLower(entry.Checksum)
+		if s, ok := byPath[key]; ok {
+			if s.size == entry.Size && (s.checksum == "" || s.checksum == checksum) {
+				plan.Unchanged++
+			} else {
+				plan.Upload = append(plan.Upload, strings.TrimPrefix(key, "/"))
+			}
+			continue
+		}
+
+		content := checksum + ":" + strconv.FormatInt(entry.Size, 10)
+		if from := renamed[content]; len(from) > 0 {
+			moved, err := fs.moveAgentFile(ctx, userId, byPath[from[0]].id, path.Join(agent.Root, key))
+			if err != nil {
+				return nil, &types.AppError{Error: err}
+			}
+			if moved {
+				renamed[content] = from[1:]
+				delete(byPath, from[0])
+				plan.Moved = append(plan.Moved, schemas.AgentMove{From: strings.TrimPrefix(from[0], "/"),
+					To: strings.TrimPrefix(key, "/")})
+				continue
+			}
+		}
+		plan.Upload = append(plan.Upload, strings.TrimPrefix(key, "/"))
+	}
+
+	for key := range byPath {
+		if !local[key] {
+			plan.Orphans = append(plan.Orphans, strings.TrimPrefix(key, "/"))
+		}
+	}
+	sort.Strings(plan.Orphans)
+	return plan, nil
+}
+
+// CommitAgentFile creates the file of parts an agent pushed through the upload
+// API. A file stored at the path replaces the one the agent last synced,
+// named by its checksum in BaseChecksum. When the stored file changed since,
+// both sides changed and the conflict policy decides:
+//
+//   - keep-both stores the pushed file under a numbered name
+//   - client-wins replaces the stored file
+//   - last-writer-wins replaces it when the local file was modified later
+//   - server-wins keeps the stored file
+//
+// Every conflict is recorded. Those where the pushed file was not stored stay
+// open, holding its parts until they are resolved by hand.
+func (fs *FileService) CommitAgentFile(c *gin.Context, userId int64, id string, payload *schemas.AgentCommit) (*schemas.AgentCommitOut, *types.AppError) {
+	agent, appErr := fs.agent(c, userId, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+	key, err := agentPath(payload.Path)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+	policy := payload.Conflict
+	if policy == "" {
+		policy = agent.Conflict
+	}
+	payload.Checksum = strings.ToLower(payload.Checksum)
+
+	dir, name := path.Split(path.Join(agent.Root, key))
+	dir = path.Clean(dir)
+	parentId, err := createDirectories(c, fs.db, userId, dir)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	var existing models.File
+	err = fs.db.WithContext(c).Where("parent_id = ?", parentId).Where("name = ?", name).
+		Where("user_id = ?", userId).Where("status = ?", "active").First(&existing).Error
+	if database.IsRecordNotFoundErr(err) {
+		res, appErr := fs.storeAgentFile(c, userId, dir, name, payload, nil, false)
+		if appErr != nil {
+			return nil, appErr
+		}
+		return &schemas.AgentCommitOut{Action: agentCreated, File: res}, nil
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if existing.Type != "file" {
+		return nil, &types.AppError{Error: fmt.Errorf("%s is a folder", key), Code: http.StatusConflict}
+	}
+
+	if existing.Checksum != nil && *existing.Checksum == strings.ToLower(payload.BaseChecksum) {
+		res, appErr := fs.storeAgentFile(c, userId, dir, name, payload, &existing, false)
+		if appErr != nil {
+			return nil, appErr
+		}
+		return &schemas.AgentCommitOut{Action: agentReplaced, File: res}, nil
+	}
+
+	keep := agentKeepServer
+	switch policy {
+	case "keep-both":
+		keep = agentKeepBoth
+	case "client-wins":
+		keep = agentKeepClient
+	case "last-writer-wins":
+		if payload.ModTime != nil && payload.ModTime.After(existing.UpdatedAt) {
+			keep = agentKeepClient
+		}
+	}
+
+	conflict, appErr := fs.recordConflict(c, agent, key, &existing, payload, policy)
+	if appErr != nil {
+		return nil, appErr
+	}
+	res := &schemas.AgentCommitOut{Action: agentConflicted}
+	if keep != agentKeepServer {
+		res.File, appErr = fs.storeAgentFile(c, userId, dir, name, payload, &existing, keep == agentKeepBoth)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if err := fs.resolveConflict(c, conflict, keep); err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+	}
+	res.Conflict = mapper.ToAgentConflictOut(conflict)
+	return res, nil
+}
+
+// storeAgentFile creates the pushed file in dir, moving replace to the trash
+// first, or under the next free numbered name with keepBoth.
+func (fs *FileService) storeAgentFile(c *gin.Context, userId int64, dir, name string, payload *schemas.AgentCommit,
+	replace *models.File, keepBoth bool) (*schemas.FileOut, *types.AppError) {
+	if replace != nil && !keepBoth {
+		if _, _, appErr := fs.DeleteFiles(c, userId, &schemas.FileOperation{Files: []string{replace.ID}}); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	fileIn := &schemas.FileIn{Name: name, Type: "file", Parts: payload.Parts, Path: dir, Size: payload.Size,
+		ChannelID: payload.ChannelID, Encrypted: payload.Encrypted}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	var (
+		res    *schemas.FileOut
+		appErr *types.AppError
+	)
+	for n := 1; ; n++ {
+		if keepBoth {
+			fileIn.Name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		res, appErr = fs.CreateFile(c, userId, fileIn)
+		if appErr == nil || appErr.Code != http.StatusConflict || !keepBoth || n >= maxRestoreRenames {
+			break
+		}
+	}
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err := fs.db.WithContext(c).Model(&models.File{}).Where("id = ?", res.ID).
+		Update("checksum", payload.Checksum).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res.Checksum = payload.Checksum
+	return res, nil
+}
+
+func (fs *FileService) agent(ctx context.Context, userId int64, id string) (*models.Agent, *types.AppError) {
+	var agent models.Agent
+	if err := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).First(&agent).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return &agent, nil
+}
+
+// moveAgentFile moves file id to target, reporting false when another item
+// already sits there.
+func (fs *FileService) moveAgentFile(ctx context.Context, userId int64, id, target string) (bool, error) {
+	dir, name := path.Split(target)
+	parentId, err := createDirectories(ctx, fs.db, userId, path.Clean(dir))
+	if err != nil {
+		return false, err
+	}
+	err = fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", id).Where("user_id = ?", userId).
+		Updates(map[string]any{"parent_id": parentId, "name": name}).Error
+	if database.IsKeyConflictErr(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// agentPath cleans the path of a local file relative to the mirrored folder
+// into a rooted path, which cannot leave the folder.
+func agentPath(rel string) (string, error) {
+	key := path.Clean("/" + strings.ReplaceAll(rel, "\\", "/"))
+	if key == "/" {
+		return "", fmt.Errorf("invalid path %q", rel)
+	}
+	return key, nil
+}
+
+func hashAgentToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
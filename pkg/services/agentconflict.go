@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+)
+
+// What a commit of an agent did.
+const (
+	agentCreated    = "created"
+	agentReplaced   = "replaced"
+	agentConflicted = "conflict"
+	agentResolved   = "resolved"
+)
+
+// agentConflictLimit caps how many conflicts of an agent are listed.
+const agentConflictLimit = 500
+
+// Which side of a conflict is kept.
+const (
+	agentKeepServer = "server"
+	agentKeepClient = "client"
+	agentKeepBoth   = "both"
+)
+
+// recordConflict stores the file pushed over existing, which changed since
+// the agent last synced it, along with the parts of the pushed file.
+func (fs *FileService) recordConflict(c *gin.Context, agent *models.Agent, key string, existing *models.File,
+	payload *schemas.AgentCommit, policy string) (*models.AgentConflict, *types.AppError) {
+	channelId := payload.ChannelID
+	if channelId == 0 {
+		var err error
+		if channelId, err = GetDefaultChannel(c, fs.db, agent.UserID); err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+	}
+	parts := make(models.Parts, 0, len(payload.Parts))
+	for _, part := range payload.Parts {
+		parts = append(parts, models.Part{ID: part.ID, Salt: part.Salt})
+	}
+
+	conflict := &models.AgentConflict{AgentID: agent.ID, UserID: agent.UserID, Path: key, FileID: &existing.ID,
+		Checksum: payload.Checksum, Size: payload.Size, ModTime: payload.ModTime, Parts: &parts,
+		ChannelID: channelId, Encrypted: payload.Encrypted, Policy: policy}
+	if err := fs.db.WithContext(c).Create(conflict).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return conflict, nil
+}
+
+// resolveConflict closes conflict with keep. The parts it held belong to a
+// file now, or were deleted, so they are dropped.
+func (fs *FileService) resolveConflict(ctx context.Context, conflict *models.AgentConflict, keep string) error {
+	now := time.Now().UTC()
+	if err := fs.db.WithContext(ctx).Model(conflict).Updates(map[string]any{"resolution": keep,
+		"resolved_at": now, "parts": nil}).Error; err != nil {
+		return err
+	}
+	conflict.Resolution, conflict.ResolvedAt, conflict.Parts = &keep, &now, nil
+	return nil
+}
+
+// ListAgentConflicts returns the conflicts of an agent, the open ones first.
+func (fs *FileService) ListAgentConflicts(ctx context.Context, userId int64, id string) ([]schemas.AgentConflictOut, *types.AppError) {
+	if _, appErr := fs.agent(ctx, userId, id); appErr != nil {
+		return nil, appErr
+	}
+	var conflicts []models.AgentConflict
+	if err := fs.db.WithContext(ctx).Where("agent_id = ?", id).Order("resolution IS NOT NULL").
+		Order("created_at DESC").Limit(agentConflictLimit).Find(&conflicts).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res := make([]schemas.AgentConflictOut, 0, len(conflicts))
+	for i := range conflicts {
+		res = append(res, *mapper.ToAgentConflictOut(&conflicts[i]))
+	}
+	return res, nil
+}
+
+// ResolveAgentConflict settles an open conflict by hand: server deletes the
+// pushed file, client replaces the stored file with it and both stores it
+// under a numbered name.
+func (fs *FileService) ResolveAgentConflict(c *gin.Context, userId int64, id, conflictId string,
+	in *schemas.AgentResolve) (*schemas.AgentCommitOut, *types.AppError) {
+	agent, appErr := fs.agent(c, userId, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var conflict models.AgentConflict
+	if err := fs.db.WithContext(c).Where("id = ?", conflictId).Where("agent_id = ?", id).
+		Where("resolution IS NULL").First(&conflict).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := &schemas.AgentCommitOut{Action: agentResolved}
+
+	if in.Keep == agentKeepServer {
+		_, session := GetUserAuth(c)
+		ids := make([]int, 0, len(*conflict.Parts))
+		for _, part := range *conflict.Parts {
+			ids = append(ids, int(part.ID))
+		}
+		if err := DeleteTGMessages(c, fs.cnf, session, conflict.ChannelID, userId, ids); err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+	} else {
+		payload := &schemas.AgentCommit{Checksum: conflict.Checksum, Size: conflict.Size,
+			ChannelID: conflict.ChannelID, Encrypted: conflict.Encrypted}
+		for _, part := range *conflict.Parts {
+			payload.Parts = append(payload.Parts, schemas.Part{ID: part.ID, Salt: part.Salt})
+		}
+
+		dir, name := path.Split(path.Join(agent.Root, conflict.Path))
+		dir = path.Clean(dir)
+		parentId, err := createDirectories(c, fs.db, userId, dir)
+		if err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+
+		// the stored side may have changed again since
+		var existing *models.File
+		var file models.File
+		err = fs.db.WithContext(c).Where("parent_id = ?", parentId).Where("name = ?", name).
+			Where("user_id = ?", userId).Where("status = ?", "active").Where("type = ?", "file").First(&file).Error
+		switch {
+		case err == nil:
+			existing = &file
+		case !database.IsRecordNotFoundErr(err):
+			return nil, &types.AppError{Error: err}
+		}
+
+		res.File, appErr = fs.storeAgentFile(c, userId, dir, name, payload, existing,
+			existing != nil && in.Keep == agentKeepBoth)
+		if appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	if err := fs.resolveConflict(c, &conflict, in.Keep); err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res.Conflict = mapper.ToAgentConflictOut(&conflict)
+	return res, nil
+}
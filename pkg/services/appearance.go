@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+)
+
+// appearanceColumns returns the columns that set the color and icon of a
+// folder. Nil fields are kept and empty ones cleared.
+func appearanceColumns(color, icon *string) map[string]any {
+	columns := make(map[string]any)
+	for column, value := range map[string]*string{"color": color, "icon": icon} {
+		switch {
+		case value == nil:
+		case *value == "":
+			columns[column] = nil
+		default:
+			columns[column] = *value
+		}
+	}
+	return columns
+}
+
+// SetFolderAppearance sets the color and icon of folders of a user at once.
+func (fs *FileService) SetFolderAppearance(ctx context.Context, userId int64, payload *schemas.FolderAppearance) (*schemas.Message, *types.AppError) {
+	columns := appearanceColumns(payload.Color, payload.Icon)
+	if len(columns) == 0 {
+		return nil, &types.AppError{Error: fmt.Errorf("nothing to set"), Code: http.StatusBadRequest}
+	}
+	if err := fs.checkOwned(ctx, userId, payload.Files); err != nil {
+		return nil, err
+	}
+
+	res := fs.db.WithContext(ctx).Model(&models.File{}).Where("id IN ?", payload.Files).
+		Where("user_id = ?", userId).Where("type = ?", "folder").UpdateColumns(columns)
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	for _, id := range payload.Files {
+		fileCache.Delete(ctx, fileCache.Key(id))
+	}
+
+	return &schemas.Message{Message: fmt.Sprintf("appearance set on %d folders", res.RowsAffected)}, nil
+}
@@ -0,0 +1,542 @@
+package services
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/divyam234/teldrive/internal/archive"
+	"github.com/divyam234/teldrive/internal/bandwidth"
+	"github.com/divyam234/teldrive/internal/category"
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/kv"
+	"github.com/divyam234/teldrive/internal/scan"
+	"github.com/divyam234/teldrive/internal/uploadpolicy"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+)
+
+const (
+	JobExtractArchive = "archive.extract"
+	JobCreateArchive  = "archive.create"
+)
+
+// Extraction limits, checked against the sizes the archive declares before
+// anything is uploaded. Entries are uploaded at their declared size, so an
+// archive cannot expand past them.
+const (
+	maxExtractEntries   = 10000
+	maxExtractEntrySize = 16 << 30
+	maxExtractSize      = 64 << 30
+	// maxExtractRatio bounds the extracted size relative to the archive.
+	maxExtractRatio = 100
+)
+
+var errExtractLimit = errors.New("archive exceeds the extraction limits")
+
+type extractPayload struct {
+	FileID      string `json:"fileId"`
+	Destination string `json:"destination"`
+}
+
+type archiveEntry struct {
+	ID   string
+	Type string
+	Rel  string
+}
+
+type ArchiveService struct {
+	db    *gorm.DB
+	cnf   *config.TGConfig
+	live  *config.Live
+	level int
+	jobs  *JobService
+	kv    kv.KV
+	// bandwidth is shared with the uploads of users
+	bandwidth    *bandwidth.Limiter
+	uploadPolicy *uploadpolicy.Policy
+	scanner      scan.Scanner
+	scanMaxSize  int64
+}
+
+func NewArchiveService(db *gorm.DB, cnf *config.Config, live *config.Live, jobs *JobService, kv kv.KV,
+	bandwidth *bandwidth.Limiter, scanner scan.Scanner) *ArchiveService {
+	ars := &ArchiveService{db: db, cnf: &cnf.TG, live: live, level: cnf.Archive.CompressionLevel, jobs: jobs, kv: kv,
+		bandwidth: bandwidth, uploadPolicy: newUploadPolicy(&cnf.TG), scanner: scanner, scanMaxSize: cnf.Scan.MaxSize}
+	jobs.Register(JobExtractArchive, ars.extractArchive)
+	jobs.Register(JobCreateArchive, ars.createArchive)
+	return ars
+}
+
+func (ars *ArchiveService) ExtractArchive(c *gin.Context) (*schemas.JobOut, *types.AppError) {
+	var payload schemas.ArchiveExtract
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	userId, _ := GetUserAuth(c)
+
+	var file models.File
+	// quarantined archives must not be unpacked into regular files
+	if err := ars.db.WithContext(c).Where("id = ?", c.Param("fileID")).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").First(&file).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &types.AppError{Error: errors.New("file not found"), Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	if archive.Format(file.Name) == "" {
+		return nil, &types.AppError{Error: archive.ErrUnsupported, Code: http.StatusBadRequest}
+	}
+
+	if file.Encrypted && ars.cnf.Uploads.EncryptionKey == "" {
+		return nil, &types.AppError{Error: errors.New("encryption key not found"), Code: http.StatusBadRequest}
+	}
+
+	return ars.jobs.Submit(c, userId, JobExtractArchive, extractPayload{
+		FileID:      file.ID,
+		Destination: path.Clean("/" + strings.TrimSpace(payload.Destination)),
+	})
+}
+
+// extractArchive downloads the archive to a temporary file, since zip and 7z
+// need random access, and re-uploads every entry as a regular file below the
+// destination folder.
+func (ars *ArchiveService) extractArchive(ctx context.Context, run *JobRun) (any, error) {
+	var payload extractPayload
+	if err := run.Payload(&payload); err != nil {
+		return nil, err
+	}
+
+	var file models.File
+	if err := ars.db.WithContext(ctx).Where("id = ?", payload.FileID).Where("user_id = ?", run.UserID).
+		Where("status = ?", "active").First(&file).Error; err != nil {
+		return nil, err
+	}
+
+	channelId, err := GetDefaultChannel(ctx, ars.db, run.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "teldrive-archive-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	result := &schemas.ArchiveExtractResult{}
+
+	err = runWithUserClient(ctx, ars.db, ars.cnf, run.UserID, func(ctx context.Context, client *telegram.Client, user string) error {
+		src := mapper.ToFileOutFull(file)
+
+		r, err := newFileReader(ctx, client, ars.cnf, src, 0, src.Size-1, user)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tmp, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+
+		format := archive.Format(file.Name)
+
+		entries, err := archive.List(tmp, src.Size, format)
+		if err != nil {
+			return err
+		}
+
+		if err := checkExtractLimits(entries, src.Size); err != nil {
+			return err
+		}
+
+		var total, done int64
+		for _, entry := range entries {
+			total += entry.Size
+		}
+		run.Progress(0, total)
+
+		channel, err := GetChannelById(ctx, client, channelId, user)
+		if err != nil {
+			return err
+		}
+
+		folders := make(map[string]string)
+
+		return archive.Walk(tmp, src.Size, format, func(entry archive.Entry, r io.Reader) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			// the entries are read again, so they are held to what was checked
+			if entry.Size > maxExtractEntrySize || done+entry.Size > total {
+				return errExtractLimit
+			}
+
+			fullPath := path.Join(payload.Destination, entry.Name)
+
+			if entry.Dir {
+				if _, err := ars.mkdir(ctx, run.UserID, fullPath, folders); err != nil {
+					return err
+				}
+				result.Folders++
+				return nil
+			}
+
+			parentId, err := ars.mkdir(ctx, run.UserID, path.Dir(fullPath), folders)
+			if err != nil {
+				return err
+			}
+
+			created, err := ars.uploadEntry(ctx, client, channel, run.UserID, parentId, path.Base(fullPath),
+				r, entry.Size, file.Encrypted)
+			if err != nil {
+				return fmt.Errorf("%s: %w", entry.Name, err)
+			}
+			if created {
+				result.Files++
+			} else {
+				result.Skipped = append(result.Skipped, entry.Name)
+			}
+
+			done += entry.Size
+			run.Progress(done, total)
+			return nil
+		})
+	})
+
+	return result, err
+}
+
+// checkExtractLimits refuses archives with too many entries, or whose
+// entries add up to more than the size or ratio limits.
+func checkExtractLimits(entries []archive.Entry, archiveSize int64) error {
+	if len(entries) > maxExtractEntries {
+		return fmt.Errorf("%w: more than %d entries", errExtractLimit, maxExtractEntries)
+	}
+	var total int64
+	for _, entry := range entries {
+		if entry.Size < 0 || entry.Size > maxExtractEntrySize {
+			return fmt.Errorf("%w: %s is too large", errExtractLimit, entry.Name)
+		}
+		total += entry.Size
+		if total > maxExtractSize || total > max(archiveSize, 1)*maxExtractRatio {
+			return fmt.Errorf("%w: expands too much", errExtractLimit)
+		}
+	}
+	return nil
+}
+
+func (ars *ArchiveService) CreateArchive(c *gin.Context) (*schemas.JobOut, *types.AppError) {
+	var payload schemas.ArchiveCreate
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	if payload.Encrypted && ars.cnf.Uploads.EncryptionKey == "" {
+		return nil, &types.AppError{Error: errors.New("encryption key not found"), Code: http.StatusBadRequest}
+	}
+
+	if payload.Level == nil {
+		payload.Level = &ars.level
+	}
+
+	if !strings.HasSuffix(strings.ToLower(payload.Name), ".zip") {
+		payload.Name += ".zip"
+	}
+
+	payload.Destination = path.Clean("/" + strings.TrimSpace(payload.Destination))
+
+	userId, _ := GetUserAuth(c)
+
+	return ars.jobs.Submit(c, userId, JobCreateArchive, payload)
+}
+
+// createArchive writes the selected files and folders into a zip file on disk
+// and uploads it to the destination folder once complete, as the upload needs
+// to know the final size.
+func (ars *ArchiveService) createArchive(ctx context.Context, run *JobRun) (any, error) {
+	var payload schemas.ArchiveCreate
+	if err := run.Payload(&payload); err != nil {
+		return nil, err
+	}
+
+	var entries []archiveEntry
+	if err := ars.db.WithContext(ctx).Raw(`
+	WITH RECURSIVE tree AS (
+		SELECT id, type, name::text AS rel FROM teldrive.files
+		WHERE id IN ? AND user_id = ? AND status IS DISTINCT FROM 'pending_deletion' AND status IS DISTINCT FROM ?
+		UNION ALL
+		SELECT f.id, f.type, t.rel || '/' || f.name FROM teldrive.files f
+		JOIN tree t ON f.parent_id = t.id
+		WHERE t.type = 'folder' AND f.status IS DISTINCT FROM 'pending_deletion' AND f.status IS DISTINCT FROM ?
+	)
+	SELECT id, type, rel FROM tree ORDER BY rel`, payload.Files, run.UserID, statusQuarantined, statusQuarantined).Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("nothing to archive")
+	}
+
+	files := make(map[string]models.File)
+	ids := []string{}
+	for _, entry := range entries {
+		if entry.Type == "file" {
+			ids = append(ids, entry.ID)
+		}
+	}
+
+	var total int64
+	for _, batch := range chunks(ids, 500) {
+		var rows []models.File
+		if err := ars.db.WithContext(ctx).Where("id IN ?", batch).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			files[row.ID] = row
+			if row.Size != nil {
+				total += *row.Size
+			}
+		}
+	}
+
+	if err := checkEncryptedFiles(ars.cnf, files); err != nil {
+		return nil, err
+	}
+
+	channelId, err := GetDefaultChannel(ctx, ars.db, run.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "teldrive-archive-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var out *schemas.FileOut
+
+	err = runWithUserClient(ctx, ars.db, ars.cnf, run.UserID, func(ctx context.Context, client *telegram.Client, user string) error {
+		zw := zip.NewWriter(tmp)
+		zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, *payload.Level)
+		})
+
+		method := zip.Deflate
+		if *payload.Level == 0 {
+			method = zip.Store
+		}
+
+		var done int64
+		run.Progress(0, total)
+
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if entry.Type == "folder" {
+				if _, err := zw.Create(entry.Rel + "/"); err != nil {
+					return err
+				}
+				continue
+			}
+
+			file, ok := files[entry.ID]
+			if !ok {
+				continue
+			}
+
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.Rel, Method: method, Modified: file.UpdatedAt})
+			if err != nil {
+				return err
+			}
+
+			src := mapper.ToFileOutFull(file)
+			if src.Size == 0 {
+				continue
+			}
+
+			r, err := newFileReader(ctx, client, ars.cnf, src, 0, src.Size-1, user)
+			if err != nil {
+				return fmt.Errorf("%s: %w", entry.Rel, err)
+			}
+			_, err = io.Copy(w, r)
+			r.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", entry.Rel, err)
+			}
+
+			done += src.Size
+			run.Progress(done, total)
+		}
+
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		size, err := tmp.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		parentId, err := ars.mkdir(ctx, run.UserID, payload.Destination, make(map[string]string))
+		if err != nil {
+			return err
+		}
+
+		channel, err := GetChannelById(ctx, client, channelId, user)
+		if err != nil {
+			return err
+		}
+
+		bots, err := getBotsToken(ctx, ars.db, run.UserID, channelId)
+		if err != nil {
+			return err
+		}
+
+		dbFile := models.File{
+			Name:      payload.Name,
+			Type:      "file",
+			MimeType:  "application/zip",
+			Category:  string(category.GetCategory(payload.Name)),
+			Size:      &size,
+			ChannelID: &channelId,
+			ParentID:  parentId,
+			UserID:    run.UserID,
+			Status:    "active",
+			Encrypted: payload.Encrypted,
+		}
+		dbFile.ScanStatus = scanStatus(ars.scanner, ars.scanMaxSize, size)
+		if appErr := applyUploadPolicy(ars.uploadPolicy, &dbFile, size); appErr != nil {
+			return appErr.Error
+		}
+
+		parts, err := uploadPartsWithBots(ctx, client, bots, ars.kv, ars.cnf, ars.live.Load().ChunkSize, channel,
+			payload.Name, tmp, size, payload.Encrypted, ars.bandwidth)
+		if err != nil {
+			deleteParts(ctx, client, channel, parts)
+			return err
+		}
+
+		dbFile.Parts = &parts
+
+		if err := ars.db.WithContext(ctx).Create(&dbFile).Error; err != nil {
+			deleteParts(ctx, client, channel, parts)
+			return err
+		}
+
+		out = mapper.ToFileOut(dbFile)
+		return nil
+	})
+
+	return out, err
+}
+
+func checkEncryptedFiles(cnf *config.TGConfig, files map[string]models.File) error {
+	if cnf.Uploads.EncryptionKey != "" {
+		return nil
+	}
+	for _, file := range files {
+		if file.Encrypted {
+			return errors.New("encryption key not found")
+		}
+	}
+	return nil
+}
+
+func (ars *ArchiveService) mkdir(ctx context.Context, userId int64, dir string, folders map[string]string) (string, error) {
+	if id, ok := folders[dir]; ok {
+		return id, nil
+	}
+	id, err := createDirectories(ctx, ars.db, userId, dir)
+	if err != nil {
+		return "", err
+	}
+	folders[dir] = id
+	return id, nil
+}
+
+// uploadEntry stores a single archive entry and reports false when a file with
+// the same name already exists in the target folder or the upload policy
+// refuses the entry.
+func (ars *ArchiveService) uploadEntry(ctx context.Context, client *telegram.Client, channel *tg.InputChannel,
+	userId int64, parentId, name string, r io.Reader, size int64, encrypted bool) (bool, error) {
+
+	var count int64
+	if err := ars.db.WithContext(ctx).Model(&models.File{}).Where("parent_id = ?", parentId).
+		Where("name = ?", name).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	channelId := channel.ChannelID
+
+	dbFile := models.File{
+		Name:      name,
+		Type:      "file",
+		MimeType:  mimeType,
+		Category:  string(category.GetCategory(name)),
+		Size:      &size,
+		ChannelID: &channelId,
+		ParentID:  parentId,
+		UserID:    userId,
+		Status:    "active",
+		Encrypted: encrypted,
+	}
+	dbFile.ScanStatus = scanStatus(ars.scanner, ars.scanMaxSize, size)
+	// entries refused by the upload policy are skipped like existing ones
+	if appErr := applyUploadPolicy(ars.uploadPolicy, &dbFile, size); appErr != nil {
+		return false, nil
+	}
+
+	parts, err := uploadParts(ctx, client, ars.cnf, ars.live.Load().ChunkSize, channel, name, r, size, encrypted,
+		ars.bandwidth)
+	if err != nil {
+		deleteParts(ctx, client, channel, parts)
+		return false, err
+	}
+	dbFile.Parts = &parts
+
+	if err := ars.db.WithContext(ctx).Create(&dbFile).Error; err != nil {
+		deleteParts(ctx, client, channel, parts)
+		if database.IsKeyConflictErr(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
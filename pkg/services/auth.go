@@ -16,10 +16,13 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/divyam234/teldrive/internal/alert"
 	"github.com/divyam234/teldrive/internal/auth"
+	"github.com/divyam234/teldrive/internal/bruteforce"
 	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/middleware"
+	"github.com/divyam234/teldrive/internal/oidc"
 	"github.com/divyam234/teldrive/internal/tgc"
-	"github.com/divyam234/teldrive/internal/utils"
 	"github.com/divyam234/teldrive/pkg/models"
 	"github.com/divyam234/teldrive/pkg/schemas"
 	"github.com/divyam234/teldrive/pkg/types"
@@ -35,22 +38,48 @@ import (
 )
 
 type AuthService struct {
-	db  *gorm.DB
-	cnf *config.Config
+	db     *gorm.DB
+	cnf    *config.Config
+	guard  *bruteforce.Guard
+	alerts *alert.Notifier
+	oidc   *oidc.Provider
 }
 
 func NewAuthService(db *gorm.DB, cnf *config.Config) *AuthService {
-	return &AuthService{db: db, cnf: cnf}
-
+	as := &AuthService{db: db, cnf: cnf,
+		guard:  bruteforce.New(cnf.Login.MaxAttempts, cnf.Login.Lockout, cnf.Login.MaxLockout),
+		alerts: alert.New(&cnf.Alerts),
+	}
+	if cnf.OIDC.Enabled() {
+		as.oidc = oidc.New(&cnf.OIDC)
+	}
+	return as
 }
 
 func (as *AuthService) LogIn(c *gin.Context, session *schemas.TgSession) (*schemas.Message, *types.AppError) {
 
+	// accounts are locked per client IP, so failing from one address cannot lock
+	// their owner out everywhere
+	ipKey, userKey := "ip:"+c.ClientIP(), "user:"+strconv.FormatInt(session.UserID, 10)+"@"+c.ClientIP()
+
+	if err := as.checkLocked(c, ipKey, userKey); err != nil {
+		return nil, err
+	}
+
 	if !checkUserIsAllowed(as.cnf.JWT.AllowedUsers, session.UserName) {
+		as.loginFailed(c, "user not allowed", ipKey, userKey)
 		return nil, &types.AppError{Error: errors.New("user not allowed"),
 			Code: http.StatusUnauthorized}
 	}
 
+	// with single sign-on enforced, Telegram logins only link the account
+	// storing the files of an identity signed in through the provider
+	link := as.pendingLink(c)
+	if link == nil && as.cnf.OIDC.Enforce {
+		return nil, &types.AppError{Error: errors.New("single sign-on required"),
+			Code: http.StatusUnauthorized}
+	}
+
 	now := time.Now().UTC()
 
 	jwtClaims := &types.JWTClaims{Claims: jwt.Claims{
@@ -68,12 +97,6 @@ func (as *AuthService) LogIn(c *gin.Context, session *schemas.TgSession) (*schem
 	hexToken := hex.EncodeToString(tokenhash[:])
 	jwtClaims.Hash = hexToken
 
-	jweToken, err := auth.Encode(as.cnf.JWT.Secret, jwtClaims)
-
-	if err != nil {
-		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
-	}
-
 	user := models.User{
 		UserId:    session.UserID,
 		Name:      session.Name,
@@ -81,39 +104,32 @@ func (as *AuthService) LogIn(c *gin.Context, session *schemas.TgSession) (*schem
 		IsPremium: session.IsPremium,
 	}
 
-	var result []models.User
-
-	if err := as.db.Model(&models.User{}).Where("user_id = ?", session.UserID).
-		Find(&result).Error; err != nil {
-		return nil, &types.AppError{Error: err}
+	if err := as.admit(c, &user, session.InviteCode, ipKey, userKey); err != nil {
+		return nil, err
 	}
-	if len(result) == 0 {
-		if err := as.db.Create(&user).Error; err != nil {
-			return nil, &types.AppError{Error: err}
-		}
 
-		//Create root folder on first login
-		file := &models.File{
-			Name:     "root",
-			Type:     "folder",
-			MimeType: "drive/folder",
-			Path:     "/",
-			Depth:    utils.IntPointer(0),
-			UserID:   session.UserID,
-			Status:   "active",
-			ParentID: "root",
-		}
-		if err := as.db.Create(file).Error; err != nil {
-			return nil, &types.AppError{Error: err}
+	if link != nil {
+		if err := as.linkIdentity(c, link, session.UserID); err != nil {
+			return nil, err
 		}
+		jwtClaims.Identity = link.Subject
+	}
+
+	jweToken, err := auth.Encode(as.cnf.JWT.Secret, jwtClaims)
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
 	}
 
 	//create session
-	if err := as.db.Create(&models.Session{UserId: session.UserID, Hash: hexToken,
+	if err := as.db.WithContext(c).Create(&models.Session{UserId: session.UserID, Hash: hexToken,
 		Session: session.Sesssion}).Error; err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
+	as.guard.Succeed(ipKey, userKey)
+	as.recordLogin(c, session.UserID, session.UserName)
+
 	setSessionCookie(c, jweToken, int(as.cnf.JWT.SessionTime.Seconds()))
 
 	return &schemas.Message{Message: "login success"}, nil
@@ -142,6 +158,19 @@ func (as *AuthService) GetSession(c *gin.Context) *schemas.Session {
 		Hash:     jwePayload.Hash,
 		Expires:  newExpires.Format(time.RFC3339)}
 
+	if as.cnf.OIDC.Enforce && jwePayload.Identity == "" {
+		return nil
+	}
+
+	if userId, err := strconv.ParseInt(jwePayload.Subject, 10, 64); err == nil {
+		// sessions of disabled users are not renewed, so they run out
+		if disabled, _ := isUserDisabled(c, as.db, userId); disabled {
+			return nil
+		}
+		session.Preferences, _ = getPreferences(c, as.db, userId)
+		session.QuickAccess, _ = getQuickAccess(c, as.db, userId)
+	}
+
 	jwePayload.IssuedAt = jwt.NewNumericDate(now)
 
 	jwePayload.Expiry = jwt.NewNumericDate(newExpires)
@@ -155,9 +184,42 @@ func (as *AuthService) GetSession(c *gin.Context) *schemas.Session {
 	return session
 }
 
+var errSessionRevoked = errors.New("session revoked")
+
+// SessionActive tells whether the session a token was issued for is still
+// there and belongs to a user that is not disabled. Answers are kept for a
+// short while, so revoking a session takes effect within that delay.
+func (as *AuthService) SessionActive(ctx context.Context, claims *types.JWTClaims) error {
+	userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return err
+	}
+	active, err := activeCache.Fetch(ctx, activeCache.Key(claims.Hash), func(ctx context.Context) (bool, error) {
+		var count int64
+		err := as.db.WithContext(ctx).Table("teldrive.sessions s").
+			Joins("JOIN teldrive.users u ON u.user_id = s.user_id").
+			Where("s.hash = ? AND s.user_id = ? AND NOT u.disabled", claims.Hash, userId).
+			Count(&count).Error
+		return count > 0, err
+	})
+	if err != nil {
+		return err
+	}
+	if !active {
+		return errSessionRevoked
+	}
+	return nil
+}
+
 func (as *AuthService) Logout(c *gin.Context) (*schemas.Message, *types.AppError) {
 	val, _ := c.Get("jwtUser")
 	jwtUser := val.(*types.JWTClaims)
+	// the Telegram session of single sign-on users keeps serving their files
+	if jwtUser.Identity != "" {
+		setSessionCookie(c, "", -1)
+		clearElevation(c)
+		return &schemas.Message{Message: "logout success"}, nil
+	}
 	client, _ := tgc.AuthClient(c, &as.cnf.TG, jwtUser.TgSession)
 
 	tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
@@ -165,7 +227,8 @@ func (as *AuthService) Logout(c *gin.Context) (*schemas.Message, *types.AppError
 		return err
 	})
 	setSessionCookie(c, "", -1)
-	as.db.Where("session = ?", jwtUser.TgSession).Delete(&models.Session{})
+	clearElevation(c)
+	as.db.WithContext(c).Where("session = ?", jwtUser.TgSession).Delete(&models.Session{})
 	return &schemas.Message{Message: "logout success"}, nil
 }
 
@@ -186,6 +249,8 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 	sessionStorage := &session.StorageMemory{}
 	tgClient, _ := tgc.NoAuthClient(c, &as.cnf.TG, dispatcher, sessionStorage)
 
+	ipKey, phoneKey := "ip:"+c.ClientIP(), ""
+
 	err = tgClient.Run(c, func(ctx context.Context) error {
 		for {
 			message := &types.SocketMessage{}
@@ -194,6 +259,19 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 			if err != nil {
 				return err
 			}
+			if message.AuthType == "phone" && message.PhoneNo != "" {
+				phoneKey = "phone:" + message.PhoneNo + "@" + c.ClientIP()
+			}
+			keys := []string{ipKey}
+			if phoneKey != "" {
+				keys = append(keys, phoneKey)
+			}
+			if message.AuthType == "phone" || message.AuthType == "2fa" {
+				if err := as.checkLocked(c, keys...); err != nil {
+					conn.WriteJSON(map[string]interface{}{"type": "error", "message": err.Error.Error()})
+					continue
+				}
+			}
 			if message.AuthType == "qr" {
 				go func() {
 					authorization, err := tgClient.QR().Auth(c, loggedIn, func(ctx context.Context, token qrlogin.Token) error {
@@ -216,6 +294,7 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 						return
 					}
 					if !checkUserIsAllowed(as.cnf.JWT.AllowedUsers, user.Username) {
+						as.loginFailed(c, "user not allowed", keys...)
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": "user not allowed"})
 						tgClient.API().AuthLogOut(c)
 						return
@@ -224,6 +303,7 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 					sessionData := &types.SessionData{}
 					json.Unmarshal(res, sessionData)
 					session := prepareSession(user, &sessionData.Data)
+					as.guard.Succeed(keys...)
 					conn.WriteJSON(map[string]interface{}{"type": "auth", "payload": session, "message": "success"})
 				}()
 			}
@@ -248,6 +328,7 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 					}
 
 					if err != nil {
+						as.loginFailed(c, "invalid code", keys...)
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": err.Error()})
 						return
 					}
@@ -257,6 +338,7 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 						return
 					}
 					if !checkUserIsAllowed(as.cnf.JWT.AllowedUsers, user.Username) {
+						as.loginFailed(c, "user not allowed", keys...)
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": "user not allowed"})
 						tgClient.API().AuthLogOut(c)
 						return
@@ -265,6 +347,7 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 					sessionData := &types.SessionData{}
 					json.Unmarshal(res, sessionData)
 					session := prepareSession(user, &sessionData.Data)
+					as.guard.Succeed(keys...)
 					conn.WriteJSON(map[string]interface{}{"type": "auth", "payload": session, "message": "success"})
 				}()
 			}
@@ -273,6 +356,7 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 				go func() {
 					auth, err := tgClient.Auth().Password(c, message.Password)
 					if err != nil {
+						as.loginFailed(c, "invalid password", keys...)
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": err.Error()})
 						return
 					}
@@ -282,6 +366,7 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 						return
 					}
 					if !checkUserIsAllowed(as.cnf.JWT.AllowedUsers, user.Username) {
+						as.loginFailed(c, "user not allowed", keys...)
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": "user not allowed"})
 						tgClient.API().AuthLogOut(c)
 						return
@@ -290,6 +375,7 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 					sessionData := &types.SessionData{}
 					json.Unmarshal(res, sessionData)
 					session := prepareSession(user, &sessionData.Data)
+					as.guard.Succeed(keys...)
 					conn.WriteJSON(map[string]interface{}{"type": "auth", "payload": session, "message": "success"})
 				}()
 			}
@@ -369,5 +455,5 @@ func prepareSession(user *tg.User, data *session.Data) *schemas.TgSession {
 
 func setSessionCookie(c *gin.Context, value string, maxAge int) {
 	c.SetSameSite(2)
-	c.SetCookie("user-session", value, maxAge, "/", "", false, true)
+	c.SetCookie("user-session", value, maxAge, middleware.BasePath(c)+"/", "", false, true)
 }
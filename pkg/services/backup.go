@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/backup"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportMetadata sends the metadata of the user's drive as a backup snapshot,
+// either as JSON to be restored through RestoreMetadata or as SQL.
+func (fs *FileService) ExportMetadata(c *gin.Context) {
+	userId, _ := GetUserAuth(c)
+
+	var query schemas.ExportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := backup.Export(c, fs.db, userId)
+	if err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contentType, ext := "application/json", "json"
+	if query.Format == "sql" {
+		contentType, ext = "application/sql", "sql"
+	}
+
+	c.Header("Content-Type", contentType+"; charset=utf-8")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": "teldrive-" + snap.CreatedAt.Format("20060102-150405") + "." + ext}))
+	c.Status(http.StatusOK)
+
+	if query.Format == "sql" {
+		backup.WriteSQL(c.Writer, fs.db, snap)
+		return
+	}
+	backup.WriteJSON(c.Writer, snap)
+}
+
+// RestoreMetadata adds the channels and files of snap to the user's drive.
+// Files already present are left untouched, ids taken by other users are
+// reported as conflicts.
+func (fs *FileService) RestoreMetadata(ctx context.Context, userId int64, snap *backup.Snapshot) (*backup.Result, *types.AppError) {
+	res, err := backup.Restore(ctx, fs.db, snap, userId)
+	if errors.Is(err, backup.ErrUnsupportedVersion) {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
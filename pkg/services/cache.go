@@ -0,0 +1,32 @@
+package services
+
+import (
+	"time"
+
+	"github.com/divyam234/teldrive/internal/cache"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+)
+
+// streamFile is a file cached for streaming along with its owner, whose session
+// serves streams of shared files.
+type streamFile struct {
+	File    schemas.FileOutFull
+	OwnerID int64
+}
+
+var (
+	fileCache        = cache.NewNamespace[streamFile]("files", 0)
+	partsCache       = cache.NewNamespace[[]types.Part]("messages", time.Hour)
+	channelCache     = cache.NewNamespace[int64]("users:channel", 0)
+	botsCache        = cache.NewNamespace[[]string]("users:bots", 0)
+	sessionCache     = cache.NewNamespace[models.Session]("sessions", 30*time.Second)
+	activeCache      = cache.NewNamespace[bool]("sessions:active", 30*time.Second)
+	userSessionCache = cache.NewNamespace[models.Session]("sessions:user", 5*time.Minute)
+	preferenceCache  = cache.NewNamespace[schemas.Preferences]("users:preferences", 0)
+	oidcLoginCache   = cache.NewNamespace[oidcLogin]("oidc:login", 10*time.Minute)
+	mountCache       = cache.NewNamespace[schemas.MountListing]("mounts:history", 5*time.Minute)
+	mountFileCache   = cache.NewNamespace[schemas.FileOut]("mounts:files", time.Hour)
+	inboxRemovals    = cache.NewNamespace[string]("inbox:removals", 2*time.Minute)
+)
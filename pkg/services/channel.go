@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/message/peer"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const storageChannelName = "Teldrive Storage"
+
+// storageChannelLocks keeps concurrent part uploads of a user without a
+// channel from creating one channel each.
+var storageChannelLocks = &userLocks{locks: make(map[int64]*userLock)}
+
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+// userLocks hands out one mutex per user, dropped once nobody holds it.
+type userLocks struct {
+	mu    sync.Mutex
+	locks map[int64]*userLock
+}
+
+func (l *userLocks) lock(userId int64) (unlock func()) {
+	l.mu.Lock()
+	lock, ok := l.locks[userId]
+	if !ok {
+		lock = &userLock{}
+		l.locks[userId] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, userId)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// uploadChannel returns the default channel of userId. Without one it creates
+// a storage channel when auto channels are enabled.
+func uploadChannel(ctx context.Context, db *gorm.DB, cnf *config.TGConfig, userId int64, session string) (int64, error) {
+	channelId, err := GetDefaultChannel(ctx, db, userId)
+	if err == nil || !cnf.Uploads.AutoChannel {
+		return channelId, err
+	}
+
+	unlock := storageChannelLocks.lock(userId)
+	defer unlock()
+
+	if channelId, err := GetDefaultChannel(ctx, db, userId); err == nil {
+		return channelId, nil
+	}
+	return createStorageChannel(ctx, db, cnf, userId, session, storageChannelName)
+}
+
+// createStorageChannel creates a private channel with the user's session,
+// selects it as their default channel and makes the bots they added to other
+// channels admins of it.
+func createStorageChannel(ctx context.Context, db *gorm.DB, cnf *config.TGConfig, userId int64, session,
+	name string) (int64, error) {
+
+	client, err := tgc.AuthClient(ctx, cnf, session)
+	if err != nil {
+		return 0, err
+	}
+
+	var bots []models.Bot
+	if err := db.WithContext(ctx).Where("user_id = ?", userId).Find(&bots).Error; err != nil {
+		return 0, err
+	}
+
+	var channel *tg.Channel
+	added := []models.Bot{}
+
+	err = tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) (err error) {
+		res, err := client.API().ChannelsCreateChannel(ctx, &tg.ChannelsCreateChannelRequest{
+			Broadcast: true,
+			Title:     name,
+			About:     "Files uploaded through teldrive",
+		})
+		if err != nil {
+			return err
+		}
+		updates, ok := res.(interface{ GetChats() []tg.ChatClass })
+		if !ok {
+			return errors.New("unexpected response creating channel")
+		}
+		for _, chat := range updates.GetChats() {
+			if c, ok := chat.(*tg.Channel); ok {
+				channel = c
+				break
+			}
+		}
+		if channel == nil {
+			return errors.New("created channel missing from response")
+		}
+		// a channel that could not be set up is not left behind
+		defer func() {
+			if err != nil {
+				client.API().ChannelsDeleteChannel(context.WithoutCancel(ctx), channel.AsInput())
+			}
+		}()
+
+		seen := map[int64]bool{}
+		for _, bot := range bots {
+			if seen[bot.BotID] {
+				continue
+			}
+			seen[bot.BotID] = true
+			botPeer, err := peer.DefaultResolver(client.API()).ResolveDomain(ctx, bot.BotUserName)
+			if err != nil {
+				return err
+			}
+			user, ok := botPeer.(*tg.InputPeerUser)
+			if !ok {
+				return errors.New("bot " + bot.BotUserName + " is not a user")
+			}
+			if err := makeBotAdmin(ctx, client, channel.AsInput(),
+				&tg.InputUser{UserID: user.UserID, AccessHash: user.AccessHash}); err != nil {
+				return err
+			}
+			bot.ChannelID = channel.ID
+			added = append(added, bot)
+		}
+
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Channel{}).Where("user_id = ?", userId).Update("selected", false).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&models.Channel{ChannelID: channel.ID, ChannelName: channel.Title, UserID: userId,
+				Selected: true}).Error; err != nil {
+				return err
+			}
+			if len(added) == 0 {
+				return nil
+			}
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&added).Error
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	channelCache.Set(ctx, channelCache.Key(userId), channel.ID)
+	botsCache.Delete(ctx, botsCache.Key(userId, channel.ID))
+	return channel.ID, nil
+}
+
+// makeBotAdmin grants a bot the rights it needs to upload to and clean up
+// channel.
+func makeBotAdmin(ctx context.Context, client *telegram.Client, channel tg.InputChannelClass, bot tg.InputUserClass) error {
+	_, err := client.API().ChannelsEditAdmin(ctx, &tg.ChannelsEditAdminRequest{
+		Channel: channel,
+		UserID:  bot,
+		AdminRights: tg.ChatAdminRights{
+			ChangeInfo:     true,
+			PostMessages:   true,
+			EditMessages:   true,
+			DeleteMessages: true,
+			BanUsers:       true,
+			InviteUsers:    true,
+			PinMessages:    true,
+			ManageCall:     true,
+			Other:          true,
+			ManageTopics:   true,
+		},
+		Rank: "bot",
+	})
+	return err
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/divyam234/teldrive/internal/reader"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/telegram"
+	"gorm.io/gorm"
+)
+
+const JobChecksumBackfill = "files.checksum"
+
+const (
+	checksumBatchSize = 100
+	// checksumReadRate caps how fast the backfill pulls file contents so it
+	// does not compete with interactive streams for the same account.
+	checksumReadRate = 8 * 1024 * 1024
+)
+
+func (fs *FileService) BackfillChecksums(ctx context.Context, userId int64) (*schemas.JobOut, *types.AppError) {
+	return fs.jobs.SubmitExclusive(ctx, userId, JobChecksumBackfill, struct{}{}, "checksum backfill already running")
+}
+
+func (fs *FileService) pendingChecksums(ctx context.Context, userId int64) *gorm.DB {
+	return fs.db.WithContext(ctx).Model(&models.File{}).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").
+		Where("checksum IS NULL").Where("parts IS NOT NULL")
+}
+
+// backfillChecksums hashes files uploaded before checksums were recorded. Files
+// are processed one at a time in id order so an interrupted run can simply be
+// started again.
+func (fs *FileService) backfillChecksums(ctx context.Context, run *JobRun) (any, error) {
+	var total int64
+	if err := fs.pendingChecksums(ctx, run.UserID).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	result := &schemas.ChecksumResult{}
+
+	if total == 0 {
+		return result, nil
+	}
+
+	run.Progress(0, total)
+
+	err := runWithUserClient(ctx, fs.db, fs.cnf, run.UserID, func(ctx context.Context, client *telegram.Client, user string) error {
+		lastId := ""
+		for {
+			var files []models.File
+			if err := fs.pendingChecksums(ctx, run.UserID).Where("id > ?", lastId).Order("id").
+				Limit(checksumBatchSize).Find(&files).Error; err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				return nil
+			}
+
+			for _, file := range files {
+				lastId = file.ID
+
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				sum, err := fs.fileChecksum(ctx, client, file, user)
+				if err == nil {
+					err = fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).
+						Where("checksum IS NULL").Update("checksum", sum).Error
+				}
+				if err != nil {
+					result.Failed++
+					if len(result.Errors) < maxDeleteErrors {
+						result.Errors = append(result.Errors, file.Name+": "+err.Error())
+					}
+				} else {
+					result.Updated++
+				}
+				run.Progress(int64(result.Updated+result.Failed), total)
+			}
+		}
+	})
+
+	return result, err
+}
+
+func (fs *FileService) fileChecksum(ctx context.Context, client *telegram.Client, file models.File, user string) (string, error) {
+	h := sha256.New()
+
+	src := mapper.ToFileOutFull(file)
+	if src.Size > 0 {
+		r, err := newFileReader(ctx, client, fs.cnf, src, 0, src.Size-1, user)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		if _, err := io.Copy(h, reader.NewThrottledReader(ctx, r, checksumReadRate)); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyUpload reads back the parts of a file being finalized and checks them
+// against the checksums the uploader sent, returning their SHA-256.
+func (fs *FileService) verifyUpload(c *gin.Context, file *models.File, in *schemas.FileIn) (string, *types.AppError) {
+	sha, md := sha256.New(), md5.New()
+
+	src := mapper.ToFileOutFull(*file)
+	if src.Size > 0 {
+		hash := func(r io.Reader) error {
+			_, err := io.Copy(io.MultiWriter(sha, md), r)
+			return err
+		}
+		var err error
+		if userId, _ := GetUserAuth(c); userId == file.UserID {
+			err = readFileWithAuth(c, fs.cnf, src, 0, src.Size-1, hash)
+		} else {
+			// org uploads sit in the org channel, which the owner's session reads
+			err = runWithUserClient(c, fs.db, fs.cnf, file.UserID, func(ctx context.Context, client *telegram.Client, user string) error {
+				r, err := newFileReader(ctx, client, fs.cnf, src, 0, src.Size-1, user)
+				if err != nil {
+					return err
+				}
+				defer r.Close()
+				return hash(r)
+			})
+		}
+		if err != nil {
+			return "", &types.AppError{Error: fmt.Errorf("failed to read upload: %w", err)}
+		}
+	}
+
+	sum := hex.EncodeToString(sha.Sum(nil))
+	if (in.SHA256 != "" && !strings.EqualFold(in.SHA256, sum)) ||
+		(in.MD5 != "" && !strings.EqualFold(in.MD5, hex.EncodeToString(md.Sum(nil)))) {
+		return "", &types.AppError{Error: errors.New("checksum mismatch"), Code: http.StatusUnprocessableEntity}
+	}
+	return sum, nil
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+)
+
+const (
+	CleanupTrash = "trash"
+	CleanupPurge = "purge"
+)
+
+const cleanupPreviewLimit = 100
+
+// cleanupTargets selects the files rule applies to at now, along with the
+// column their age is measured from.
+func (fs *FileService) cleanupTargets(ctx context.Context, rule *models.CleanupRule, now time.Time) (*gorm.DB, string) {
+	cutoff := now.AddDate(0, 0, -rule.Days)
+
+	if rule.Action == CleanupPurge {
+		return fs.trashed(ctx, rule.UserID, nil, rule.Path).Where("deleted_at < ?", cutoff), "deleted_at"
+	}
+
+	query := fs.db.WithContext(ctx).Model(&models.File{}).Where("user_id = ?", rule.UserID).
+		Where("type = ?", "file").Where("status = ?", "active").Where("updated_at < ?", cutoff)
+
+	if dir := strings.TrimSuffix(rule.Path, "/"); dir != "" {
+		folders := fs.db.Model(&models.File{}).Select("id").Where("user_id = ?", rule.UserID).
+			Where("type = ?", "folder").Where("path = ? OR path LIKE ?", dir, escapeLike(dir)+"/%")
+		query = query.Where("parent_id IN (?)", folders)
+	}
+	return query, "updated_at"
+}
+
+func cleanupRule(payload *schemas.CleanupRuleIn) (*models.CleanupRule, *types.AppError) {
+	rulePath := strings.TrimSpace(payload.Path)
+	if rulePath != "" {
+		rulePath = path.Clean("/" + rulePath)
+	}
+	// a trash rule without a path would sweep the whole drive by accident
+	if payload.Action == CleanupTrash && rulePath == "" {
+		return nil, &types.AppError{Error: errors.New("path is required for trash rules"), Code: http.StatusBadRequest}
+	}
+
+	rule := &models.CleanupRule{Name: payload.Name, Action: payload.Action, Path: rulePath, Days: payload.Days,
+		Enabled: true}
+	if payload.Enabled != nil {
+		rule.Enabled = *payload.Enabled
+	}
+	return rule, nil
+}
+
+func (fs *FileService) getCleanupRule(ctx context.Context, userId int64, id string) (*models.CleanupRule, *types.AppError) {
+	var rule models.CleanupRule
+	if err := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).First(&rule).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return &rule, nil
+}
+
+func (fs *FileService) ListCleanupRules(ctx context.Context, userId int64) ([]schemas.CleanupRuleOut, *types.AppError) {
+	var rules []models.CleanupRule
+	if err := fs.db.WithContext(ctx).Where("user_id = ?", userId).Order("created_at").Find(&rules).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := make([]schemas.CleanupRuleOut, 0, len(rules))
+	for i := range rules {
+		res = append(res, *mapper.ToCleanupRuleOut(&rules[i]))
+	}
+	return res, nil
+}
+
+func (fs *FileService) CreateCleanupRule(ctx context.Context, userId int64, payload *schemas.CleanupRuleIn) (*schemas.CleanupRuleOut, *types.AppError) {
+	rule, appErr := cleanupRule(payload)
+	if appErr != nil {
+		return nil, appErr
+	}
+	rule.UserID = userId
+
+	if err := fs.db.WithContext(ctx).Create(rule).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return mapper.ToCleanupRuleOut(rule), nil
+}
+
+func (fs *FileService) UpdateCleanupRule(ctx context.Context, userId int64, id string, payload *schemas.CleanupRuleIn) (*schemas.CleanupRuleOut, *types.AppError) {
+	rule, appErr := fs.getCleanupRule(ctx, userId, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	update, appErr := cleanupRule(payload)
+	if appErr != nil {
+		return nil, appErr
+	}
+	rule.Name, rule.Action, rule.Path, rule.Days, rule.Enabled = update.Name, update.Action, update.Path,
+		update.Days, update.Enabled
+	rule.UpdatedAt = time.Now().UTC()
+
+	if err := fs.db.WithContext(ctx).Save(rule).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return mapper.ToCleanupRuleOut(rule), nil
+}
+
+func (fs *FileService) DeleteCleanupRule(ctx context.Context, userId int64, id string) (*schemas.Message, *types.AppError) {
+	res := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).Delete(&models.CleanupRule{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "cleanup rule deleted"}, nil
+}
+
+// PreviewCleanupRule reports what the rule would remove if it ran now,
+// without changing anything. Disabled rules can be previewed too.
+func (fs *FileService) PreviewCleanupRule(ctx context.Context, userId int64, id string) (*schemas.CleanupPreview, *types.AppError) {
+	rule, appErr := fs.getCleanupRule(ctx, userId, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	now := time.Now().UTC()
+	res := &schemas.CleanupPreview{Files: []schemas.CleanupPreviewFile{}}
+
+	query, _ := fs.cleanupTargets(ctx, rule, now)
+	if err := query.Select("count(*) AS count, COALESCE(SUM(size), 0) AS size").Scan(res).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	query, column := fs.cleanupTargets(ctx, rule, now)
+	if err := query.Select("id", "name", "COALESCE(size, 0) AS size", column+" AS date").Order(column).
+		Limit(cleanupPreviewLimit).Scan(&res.Files).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
+
+// RunCleanupRules applies the enabled cleanup rules of all users. A failing
+// rule is logged and does not stop the others.
+func (fs *FileService) RunCleanupRules(ctx context.Context) error {
+	var rules []models.CleanupRule
+	if err := fs.db.WithContext(ctx).Where("enabled = ?", true).Order("user_id").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	logger := logging.DefaultLogger()
+
+	for i := range rules {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rule := &rules[i]
+		now := time.Now().UTC()
+		count, err := fs.runCleanupRule(ctx, rule, now)
+		if err != nil {
+			logger.Errorw("cleanup rule failed", "rule", rule.ID, "user", rule.UserID, "err", err)
+		}
+		fs.db.WithContext(ctx).Model(rule).Updates(map[string]any{"last_run_at": now, "last_count": count})
+	}
+	return nil
+}
+
+// runCleanupRule returns how many files were trashed or purged. Files whose
+// messages could not be deleted stay in the trash for the next run.
+func (fs *FileService) runCleanupRule(ctx context.Context, rule *models.CleanupRule, now time.Time) (int64, error) {
+	query, _ := fs.cleanupTargets(ctx, rule, now)
+
+	if rule.Action == CleanupTrash {
+		res := query.Update("status", "pending_deletion")
+		return res.RowsAffected, res.Error
+	}
+
+	var ids []string
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var (
+		purged int64
+		kept   []error
+	)
+	err := runWithUserClient(ctx, fs.db, fs.cnf, rule.UserID, func(ctx context.Context, client *telegram.Client, user string) error {
+		channels := make(map[int64]*tg.InputChannel)
+		for _, batch := range chunks(ids, deleteBatchSize) {
+			pending, batchKept, err := fs.deleteFileBatch(ctx, client, user, channels, batch)
+			if err != nil {
+				return err
+			}
+			purged += int64(len(batch) - pending)
+			if batchKept != nil {
+				kept = append(kept, batchKept)
+			}
+		}
+		return nil
+	})
+	return purged, errors.Join(append(kept, err)...)
+}
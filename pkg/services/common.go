@@ -8,20 +8,28 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/divyam234/teldrive/internal/cache"
+	"github.com/divyam234/teldrive/internal/bandwidth"
 	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/crypt"
+	"github.com/divyam234/teldrive/internal/database"
 	"github.com/divyam234/teldrive/internal/kv"
+	"github.com/divyam234/teldrive/internal/middleware"
+	"github.com/divyam234/teldrive/internal/reader"
 	"github.com/divyam234/teldrive/internal/tgc"
 	"github.com/divyam234/teldrive/pkg/models"
 	"github.com/divyam234/teldrive/pkg/schemas"
 	"github.com/divyam234/teldrive/pkg/types"
 	"github.com/gin-gonic/gin"
 	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
 	"github.com/pkg/errors"
 	"github.com/thoas/go-funk"
@@ -63,7 +71,7 @@ type batchResult struct {
 	Messages *tg.MessagesChannelMessages
 }
 
-func getChunk(ctx context.Context, tgClient *telegram.Client, location tg.InputFileLocationClass, offset int64, limit int64) ([]byte, error) {
+func getChunk(ctx context.Context, api *tg.Client, location tg.InputFileLocationClass, offset int64, limit int64) ([]byte, error) {
 
 	req := &tg.UploadGetFileRequest{
 		Offset:   offset,
@@ -71,7 +79,7 @@ func getChunk(ctx context.Context, tgClient *telegram.Client, location tg.InputF
 		Location: location,
 	}
 
-	r, err := tgClient.API().UploadGetFile(ctx, req)
+	r, err := api.UploadGetFile(ctx, req)
 
 	if err != nil {
 		return nil, err
@@ -90,7 +98,7 @@ func iterContent(ctx context.Context, tgClient *telegram.Client, location tg.Inp
 	limit := int64(1024 * 1024)
 	buff := &bytes.Buffer{}
 	for {
-		r, err := getChunk(ctx, tgClient, location, offset, limit)
+		r, err := getChunk(ctx, tgClient.API(), location, offset, limit)
 		if err != nil {
 			return buff, err
 		}
@@ -207,44 +215,324 @@ func getTGMessages(ctx context.Context, client *telegram.Client, parts []schemas
 	return allMessages, nil
 }
 
-func getParts(ctx context.Context, client *telegram.Client, file *schemas.FileOutFull, userID string) ([]types.Part, error) {
-	cache := cache.FromContext(ctx)
-	parts := []types.Part{}
+// partsKey keys the parts of file as read by userID. It follows the messages,
+// which the dedup pass can swap.
+func partsKey(file *schemas.FileOutFull, userID string) string {
+	first := int64(0)
+	if len(file.Parts) > 0 {
+		first = file.Parts[0].ID
+	}
+	return partsCache.Key(file.ID, file.ChannelID, first, userID)
+}
 
-	key := fmt.Sprintf("messages:%s:%s", file.ID, userID)
+func getParts(ctx context.Context, client *telegram.Client, file *schemas.FileOutFull, userID string) ([]types.Part, error) {
+	return partsCache.Fetch(ctx, partsKey(file, userID), func(ctx context.Context) ([]types.Part, error) {
+		messages, err := getTGMessages(ctx, client, file.Parts, file.ChannelID, userID)
 
-	err := cache.Get(key, &parts)
+		if err != nil {
+			return nil, err
+		}
 
-	if err == nil {
+		parts := []types.Part{}
+
+		for i, message := range messages {
+			item := message.(*tg.Message)
+			media := item.Media.(*tg.MessageMediaDocument)
+			document := media.Document.(*tg.Document)
+			location := document.AsInputDocumentFileLocation()
+
+			part := types.Part{
+				Location: location,
+				Size:     document.Size,
+				Salt:     file.Parts[i].Salt,
+			}
+			if file.Encrypted {
+				part.DecryptedSize, _ = crypt.DecryptedSize(document.Size)
+			}
+			parts = append(parts, part)
+		}
 		return parts, nil
-	}
+	})
+}
 
-	messages, err := getTGMessages(ctx, client, file.Parts, file.ChannelID, userID)
+func newFileReader(ctx context.Context, client *telegram.Client, cnf *config.TGConfig, file *schemas.FileOutFull,
+	start, end int64, channelUser string, opts ...reader.Option) (io.ReadCloser, error) {
 
+	parts, err := getParts(ctx, client, file, channelUser)
 	if err != nil {
 		return nil, err
 	}
 
-	for i, message := range messages {
-		item := message.(*tg.Message)
-		media := item.Media.(*tg.MessageMediaDocument)
-		document := media.Document.(*tg.Document)
-		location := document.AsInputDocumentFileLocation()
+	opts = append([]reader.Option{reader.WithChunkTimeout(cnf.ChunkTimeout)}, opts...)
+	if file.Encrypted {
+		return reader.NewDecryptedReader(ctx, client, parts, start, end, cnf.Uploads.EncryptionKey, opts...)
+	}
+	return reader.NewLinearReader(ctx, client, parts, start, end, opts...)
+}
+
+// readFileWithAuth opens a reader over the given byte range of a file using the
+// caller's own Telegram session and hands it to fn while the client is running.
+func readFileWithAuth(c *gin.Context, cnf *config.TGConfig, file *schemas.FileOutFull, start, end int64,
+	fn func(r io.Reader) error) error {
+
+	userId, session := GetUserAuth(c)
 
-		part := types.Part{
-			Location: location,
-			Size:     document.Size,
-			Salt:     file.Parts[i].Salt,
+	client, err := tgc.AuthClient(c, cnf, session)
+	if err != nil {
+		return err
+	}
+
+	return tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
+		r, err := newFileReader(ctx, client, cnf, file, start, end, strconv.FormatInt(userId, 10))
+		if err != nil {
+			return err
 		}
-		if file.Encrypted {
-			part.DecryptedSize, _ = crypt.DecryptedSize(document.Size)
+		defer r.Close()
+		return fn(r)
+	})
+}
+
+// uploadToChannel uploads r as a single document to the channel in requests of
+// chunkSize bytes and returns the id of the message holding it.
+func uploadToChannel(ctx context.Context, client *telegram.Client, channel *tg.InputChannel, name string,
+	r io.Reader, size int64, chunkSize int, cnf *config.TGConfig) (int, error) {
+
+	u := uploader.NewUploader(client.API()).WithThreads(cnf.Uploads.Threads).WithPartSize(chunkSize)
+
+	upload, err := u.Upload(ctx, uploader.NewUpload(name, r, size))
+
+	if err != nil {
+		return 0, err
+	}
+
+	document := message.UploadedDocument(upload).Filename(name).ForceFile(true)
+
+	sender := message.NewSender(client.API())
+
+	target := sender.To(&tg.InputPeerChannel{ChannelID: channel.ChannelID,
+		AccessHash: channel.AccessHash})
+
+	res, err := target.Media(ctx, document)
+
+	if err != nil {
+		return 0, err
+	}
+
+	updates, ok := res.(*tg.Updates)
+	if !ok {
+		return 0, fmt.Errorf("unexpected response type: %T", res)
+	}
+
+	for _, update := range updates.Updates {
+		if channelMsg, ok := update.(*tg.UpdateNewChannelMessage); ok {
+			if msg, ok := channelMsg.Message.(*tg.Message); ok && msg.ID != 0 {
+				return msg.ID, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("upload failed")
+}
+
+// splitSize returns the size of the parts uploadParts cuts a file into, smaller
+// than the configured one when encryption would grow a part past what Telegram
+// accepts.
+func splitSize(cnf *config.TGConfig, encrypted bool) int64 {
+	size := cnf.Uploads.SplitSize
+	if !encrypted {
+		return size
+	}
+	// the overhead only shrinks with the size, so removing the excess once is enough
+	if excess := crypt.EncryptedSize(size) - config.MaxSplitSize; excess > 0 {
+		size -= excess
+	}
+	return size
+}
+
+// uploadParts uploads size bytes from r to the channel, splitting them into
+// documents of at most the configured split size and encrypting each one when requested.
+func uploadParts(ctx context.Context, client *telegram.Client, cnf *config.TGConfig, chunkSize int, channel *tg.InputChannel,
+	name string, r io.Reader, size int64, encrypted bool, limiter *bandwidth.Limiter) (models.Parts, error) {
+
+	parts := models.Parts{}
+
+	split := splitSize(cnf, encrypted)
+	count := int((size + split - 1) / split)
+
+	for i := range count {
+		partSize := min(split, size-int64(i)*split)
+		part, err := uploadPart(ctx, client, cnf, chunkSize, channel, name, i, count,
+			limiter.Reader(ctx, io.LimitReader(r, partSize)), partSize, encrypted)
+		if err != nil {
+			return parts, err
 		}
 		parts = append(parts, part)
 	}
-	cache.Set(key, &parts, 3600)
+
+	return parts, nil
+}
+
+// uploadPartsWithBots uploads the parts of a file read from r at their offsets,
+// spreading them over the bots of the channel so that they upload at once,
+// each bot over its own connection. Without bots, or for a single part, the
+// parts are uploaded in turn with client. On failure the parts uploaded so far
+// are returned for the caller to delete.
+func uploadPartsWithBots(ctx context.Context, client *telegram.Client, bots []string, store kv.KV, cnf *config.TGConfig,
+	chunkSize int, channel *tg.InputChannel, name string, r io.ReaderAt, size int64, encrypted bool,
+	limiter *bandwidth.Limiter) (models.Parts, error) {
+
+	split := splitSize(cnf, encrypted)
+	count := int((size + split - 1) / split)
+	if len(bots) == 0 || count < 2 {
+		return uploadParts(ctx, client, cnf, chunkSize, channel, name, io.NewSectionReader(r, 0, size), size, encrypted,
+			limiter)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		parts    = make(models.Parts, count)
+		uploaded = make([]bool, count)
+		next     = make(chan int)
+		errs     = make(chan error, len(bots))
+		wg       sync.WaitGroup
+	)
+
+	for _, token := range bots[:min(len(bots), count)] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := func() error {
+				bot, err := tgc.BotClient(ctx, store, cnf, token, cnf.Uploads.MaxRetries)
+				if err != nil {
+					return err
+				}
+				return tgc.RunWithAuth(ctx, bot, token, func(ctx context.Context) error {
+					botChannel, err := GetChannelById(ctx, bot, channel.ChannelID, strings.Split(token, ":")[0])
+					if err != nil {
+						return err
+					}
+					for i := range next {
+						offset := int64(i) * split
+						partSize := min(split, size-offset)
+						part, err := uploadPart(ctx, bot, cnf, chunkSize, botChannel, name, i, count,
+							limiter.Reader(ctx, io.NewSectionReader(r, offset, partSize)), partSize, encrypted)
+						if err != nil {
+							return err
+						}
+						parts[i], uploaded[i] = part, true
+					}
+					return nil
+				})
+			}()
+			if err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+
+feed:
+	for i := range count {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		done := models.Parts{}
+		for i, ok := range uploaded {
+			if ok {
+				done = append(done, parts[i])
+			}
+		}
+		return done, err
+	}
 	return parts, nil
 }
 
+// uploadPart uploads the part at index i of count parts of a file, encrypting
+// it when requested.
+func uploadPart(ctx context.Context, client *telegram.Client, cnf *config.TGConfig, chunkSize int, channel *tg.InputChannel,
+	name string, i, count int, r io.Reader, size int64, encrypted bool) (models.Part, error) {
+
+	partName := name
+	if count > 1 {
+		partName = fmt.Sprintf("%s.part.%03d", name, i+1)
+	}
+
+	var salt string
+	if encrypted {
+		salt, _ = generateRandomSalt()
+		cipher, err := crypt.NewCipher(cnf.Uploads.EncryptionKey, salt)
+		if err != nil {
+			return models.Part{}, err
+		}
+		r, err = cipher.EncryptData(r)
+		if err != nil {
+			return models.Part{}, err
+		}
+		size = crypt.EncryptedSize(size)
+	}
+
+	id, err := uploadToChannel(ctx, client, channel, partName, r, size, chunkSize, cnf)
+	if err != nil {
+		return models.Part{}, err
+	}
+	return models.Part{ID: int64(id), Salt: salt}, nil
+}
+
+func deleteParts(ctx context.Context, client *telegram.Client, channel *tg.InputChannel, parts models.Parts) error {
+	if len(parts) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(parts))
+	for _, part := range parts {
+		ids = append(ids, int(part.ID))
+	}
+	_, err := client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: ids})
+	return err
+}
+
+// createDirectories creates dir and any missing parents, returning the id of
+// the deepest folder.
+func createDirectories(ctx context.Context, db *gorm.DB, userId int64, dir string) (string, error) {
+	res, err := database.Procs(db).CreateDirectories(db.WithContext(ctx), userId, dir)
+	if err != nil {
+		return "", err
+	}
+	if len(res) == 0 {
+		return "", fmt.Errorf("failed to create directory %s", dir)
+	}
+	return res[0].ID, nil
+}
+
+// runWithUserClient runs fn with a Telegram client authorized as the user, for
+// background work that outlives the request that started it.
+func runWithUserClient(ctx context.Context, db *gorm.DB, cnf *config.TGConfig, userId int64,
+	fn func(ctx context.Context, client *telegram.Client, user string) error) error {
+
+	session, err := getLatestSession(ctx, db, userId)
+	if err != nil {
+		return err
+	}
+
+	client, err := tgc.AuthClient(ctx, cnf, session.Session)
+	if err != nil {
+		return err
+	}
+
+	return tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		return fn(ctx, client, strconv.FormatInt(userId, 10))
+	})
+}
+
 func GetChannelById(ctx context.Context, client *telegram.Client, channelId int64, userID string) (*tg.InputChannel, error) {
 
 	channel := &tg.InputChannel{}
@@ -266,23 +554,21 @@ func GetChannelById(ctx context.Context, client *telegram.Client, channelId int6
 }
 
 func GetDefaultChannel(ctx context.Context, db *gorm.DB, userID int64) (int64, error) {
-	cache := cache.FromContext(ctx)
-	var channelId int64
-	key := fmt.Sprintf("users:channel:%d", userID)
-
-	err := cache.Get(key, &channelId)
+	key := channelCache.Key(userID)
 
-	if err == nil {
+	if channelId, ok := channelCache.Get(ctx, key); ok {
 		return channelId, nil
 	}
 
+	var channelId int64
+
 	var channelIds []int64
-	db.Model(&models.Channel{}).Where("user_id = ?", userID).Where("selected = ?", true).
+	db.WithContext(ctx).Model(&models.Channel{}).Where("user_id = ?", userID).Where("selected = ?", true).
 		Pluck("channel_id", &channelIds)
 
 	if len(channelIds) == 1 {
 		channelId = channelIds[0]
-		cache.Set(key, channelId, 0)
+		channelCache.Set(ctx, key, channelId)
 	}
 
 	if channelId == 0 {
@@ -293,46 +579,78 @@ func GetDefaultChannel(ctx context.Context, db *gorm.DB, userID int64) (int64, e
 }
 
 func getBotsToken(ctx context.Context, db *gorm.DB, userID, channelId int64) ([]string, error) {
-	cache := cache.FromContext(ctx)
-	var bots []string
-
-	key := fmt.Sprintf("users:bots:%d:%d", userID, channelId)
+	key := botsCache.Key(userID, channelId)
 
-	err := cache.Get(key, &bots)
-
-	if err == nil {
+	if bots, ok := botsCache.Get(ctx, key); ok {
 		return bots, nil
 	}
 
-	if err := db.Model(&models.Bot{}).Where("user_id = ?", userID).
+	var bots []string
+
+	if err := db.WithContext(ctx).Model(&models.Bot{}).Where("user_id = ?", userID).
 		Where("channel_id = ?", channelId).Pluck("token", &bots).Error; err != nil {
 		return nil, err
 	}
 
-	cache.Set(key, &bots, 0)
+	botsCache.Set(ctx, key, bots)
 	return bots, nil
 
 }
 
-func getSessionByHash(db *gorm.DB, cache *cache.Cache, hash string) (*models.Session, error) {
+// getSessionByHash returns the session a stream url was issued for. Sessions
+// of disabled users are refused, and answers are only kept for a short while,
+// so revoked sessions stop streaming within that delay.
+func getSessionByHash(ctx context.Context, db *gorm.DB, hash string) (*models.Session, error) {
+	key := sessionCache.Key(hash)
+
+	if session, ok := sessionCache.Get(ctx, key); ok {
+		return &session, nil
+	}
+
 	var session models.Session
 
-	key := fmt.Sprintf("sessions:%s", hash)
+	if err := db.WithContext(ctx).Model(&models.Session{}).Select("sessions.*").
+		Joins("JOIN teldrive.users u ON u.user_id = sessions.user_id").
+		Where("sessions.hash = ?", hash).Where("NOT u.disabled").First(&session).Error; err != nil {
+		return nil, err
+	}
+
+	sessionCache.Set(ctx, key, session)
+
+	return &session, nil
+
+}
 
-	err := cache.Get(key, &session)
+func getLatestSession(ctx context.Context, db *gorm.DB, userId int64) (*models.Session, error) {
+	key := userSessionCache.Key(userId)
 
-	if err == nil {
+	if session, ok := userSessionCache.Get(ctx, key); ok {
 		return &session, nil
 	}
 
-	if err := db.Model(&models.Session{}).Where("hash = ?", hash).First(&session).Error; err != nil {
+	var session models.Session
+
+	if err := db.WithContext(ctx).Model(&models.Session{}).Where("user_id = ?", userId).Order("created_at desc").
+		First(&session).Error; err != nil {
 		return nil, err
 	}
 
-	cache.Set(key, &session, 0)
+	userSessionCache.Set(ctx, key, session)
 
 	return &session, nil
+}
+
+var errNoPublicURL = errors.New("server-public-url has to be set to make links")
 
+// requestBaseURL returns the configured address of the server for links.
+// Links are refused without it rather than made from the Host header, which
+// would let a client pick where published links point to.
+func requestBaseURL(c *gin.Context) (string, error) {
+	base := middleware.BaseURL(c)
+	if base == "" {
+		return "", errNoPublicURL
+	}
+	return base, nil
 }
 
 func DeleteTGMessages(ctx context.Context, cnf *config.TGConfig, session string, channelId, userId int64, ids []int) error {
@@ -357,3 +675,53 @@ func DeleteTGMessages(ctx context.Context, cnf *config.TGConfig, session string,
 	})
 	return err
 }
+
+// streamWriter flushes every write to the client, so players get the first
+// frames as soon as they are fetched rather than once the server buffers
+// fill. It fails a write the client has not taken within idle, so a stream to
+// a client that went away releases its Telegram client. The deadline is
+// cleared by reset before the connection serves another request.
+type streamWriter struct {
+	w    http.ResponseWriter
+	rc   *http.ResponseController
+	idle time.Duration
+}
+
+func newStreamWriter(w http.ResponseWriter, idle time.Duration) *streamWriter {
+	return &streamWriter{w: w, rc: http.NewResponseController(w), idle: idle}
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if sw.idle > 0 {
+		// not every writer supports deadlines, those write without one
+		_ = sw.rc.SetWriteDeadline(time.Now().Add(sw.idle))
+	}
+	n, err := sw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := sw.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
+
+func (sw *streamWriter) reset() {
+	if sw.idle > 0 {
+		_ = sw.rc.SetWriteDeadline(time.Time{})
+	}
+}
+
+// formatSize writes n bytes for people to read.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
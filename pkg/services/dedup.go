@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// dedupBatchSize bounds how many uploads a run of DedupPendingFiles hashes.
+	dedupBatchSize = 20
+	// dedupCandidates bounds how many stored copies of an upload are tried.
+	dedupCandidates = 3
+)
+
+// DedupPendingFiles hashes new uploads and points those whose content is
+// already stored at the messages of the stored copy, deleting their own.
+// Copies are only used from channels the uploader can read, so every read path
+// keeps working with the uploader's session, and they are hashed again before
+// use as stored checksums can come from clients. Channels are private to their
+// user unless shared through an organization, so in practice uploads are only
+// deduplicated against the uploader's own files and those of their
+// organizations. Shared messages are deleted once no file or snapshot
+// references them.
+func (fs *FileService) DedupPendingFiles(ctx context.Context) error {
+	var files []models.File
+	if err := fs.db.WithContext(ctx).Where("dedup_pending").Where("status = ?", "active").
+		Order("created_at").Limit(dedupBatchSize).Find(&files).Error; err != nil {
+		return err
+	}
+
+	byUser := make(map[int64][]models.File)
+	for _, file := range files {
+		byUser[file.UserID] = append(byUser[file.UserID], file)
+	}
+
+	logger := logging.FromContext(ctx)
+	for userId, files := range byUser {
+		err := runWithUserClient(ctx, fs.db, fs.cnf, userId, func(ctx context.Context, client *telegram.Client, user string) error {
+			for _, file := range files {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := fs.dedupFile(ctx, client, file, user); err != nil {
+					logger.Warnw("failed to dedup file", "file", file.ID, "err", err)
+				}
+				if err := fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).
+					Update("dedup_pending", false).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Errorw("failed to dedup files", "user", userId, "err", err)
+		}
+	}
+	return nil
+}
+
+func (fs *FileService) dedupFile(ctx context.Context, client *telegram.Client, file models.File, user string) error {
+	if file.Parts == nil || len(*file.Parts) == 0 || file.ChannelID == nil || file.Size == nil {
+		return nil
+	}
+	sum, err := fs.fileChecksum(ctx, client, file, user)
+	if err != nil {
+		return err
+	}
+	if file.Checksum == nil {
+		if err := fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).
+			Where("checksum IS NULL").Update("checksum", sum).Error; err != nil {
+			return err
+		}
+	}
+
+	var copies []models.File
+	if err := fs.db.WithContext(ctx).Where("checksum = ?", sum).Where("size = ?", *file.Size).
+		Where("type = ?", "file").Where("status = ?", "active").Where("id <> ?", file.ID).
+		Where("NOT dedup_pending").Order("created_at").Limit(dedupCandidates).Find(&copies).Error; err != nil {
+		return err
+	}
+	for _, stored := range copies {
+		if stored.Parts == nil || len(*stored.Parts) == 0 || stored.ChannelID == nil {
+			continue
+		}
+		if *stored.ChannelID == *file.ChannelID && (*stored.Parts)[0].ID == (*file.Parts)[0].ID {
+			return nil
+		}
+		// reading the copy checks both that the uploader can reach it and
+		// that it holds the same content
+		if storedSum, err := fs.fileChecksum(ctx, client, stored, user); err != nil || storedSum != sum {
+			continue
+		}
+		return fs.pointAtCopy(ctx, client, file, stored, user)
+	}
+	return nil
+}
+
+// pointAtCopy swaps the messages of file for those of stored and deletes the
+// messages nothing references anymore.
+func (fs *FileService) pointAtCopy(ctx context.Context, client *telegram.Client, file, stored models.File, user string) error {
+	res := fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).
+		Where("updated_at = ?", file.UpdatedAt).Updates(map[string]any{
+		"parts":      stored.Parts,
+		"channel_id": stored.ChannelID,
+		"encrypted":  stored.Encrypted,
+	})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	fileCache.Delete(ctx, fileCache.Key(file.ID))
+	logging.FromContext(ctx).Infow("deduplicated file", "file", file.ID, "copy", stored.ID)
+
+	ids := make([]int, 0, len(*file.Parts))
+	for _, part := range *file.Parts {
+		ids = append(ids, int(part.ID))
+	}
+	ids, err := ReleasableParts(ctx, fs.db, *file.ChannelID, ids, nil)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	channel, err := GetChannelById(ctx, client, *file.ChannelID, user)
+	if err != nil {
+		return err
+	}
+	_, err = client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: ids})
+	return err
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+)
+
+const JobDeleteFiles = "files.delete"
+
+const (
+	asyncDeleteThreshold = 1000
+	deleteBatchSize      = 500
+	maxDeleteErrors      = 10
+	// deleteMessagesLimit is the most message ids Telegram accepts in one
+	// channels.deleteMessages call.
+	deleteMessagesLimit = 100
+)
+
+const deleteTreeQuery = `
+WITH RECURSIVE tree AS (
+	SELECT id, type, parent_id, 0 AS level FROM teldrive.files WHERE id IN ? AND user_id = ?
+	UNION ALL
+	SELECT f.id, f.type, f.parent_id, t.level + 1 FROM teldrive.files f
+	JOIN tree t ON f.parent_id = t.id WHERE t.type = 'folder'
+)`
+
+// deletePayload is the payload of a delete job. Owner is set when the items
+// belong to another user who shared them for writing.
+type deletePayload struct {
+	schemas.FileOperation
+	Owner int64 `json:"owner,omitempty"`
+}
+
+type deleteItem struct {
+	ID       string
+	Type     string
+	ParentID string
+	Level    int
+}
+
+// DeleteFiles removes the selected items right away when the subtree is small
+// and hands it to a background job otherwise, in which case the job is returned.
+func (fs *FileService) DeleteFiles(ctx context.Context, userId int64, payload *schemas.FileOperation) (*schemas.Message, *schemas.JobOut, *types.AppError) {
+
+	owner, appErr := fs.checkItemsAccess(ctx, userId, payload.Files, PermissionWrite)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+
+	var count int64
+
+	if err := fs.db.WithContext(ctx).Raw(deleteTreeQuery+" SELECT count(*) FROM tree", payload.Files, owner).
+		Scan(&count).Error; err != nil {
+		return nil, nil, &types.AppError{Error: err}
+	}
+
+	if count > asyncDeleteThreshold {
+		job, err := fs.jobs.Submit(ctx, userId, JobDeleteFiles, deletePayload{FileOperation: *payload, Owner: owner})
+		return nil, job, err
+	}
+
+	// deleted files can be restored while they are in the trash
+	var trashed []string
+	if fs.trashRetention > 0 && fs.undoWindow > 0 {
+		if err := fs.db.WithContext(ctx).Raw(deleteTreeQuery+" SELECT id FROM tree WHERE type = 'file'",
+			payload.Files, owner).Scan(&trashed).Error; err != nil {
+			return nil, nil, &types.AppError{Error: err}
+		}
+	}
+
+	audits := orgAudits(ctx, fs.db, userId, "file.delete", payload.Files)
+	if err := database.Procs(fs.db).DeleteFiles(fs.db.WithContext(ctx), payload.Files); err != nil {
+		return nil, nil, &types.AppError{Error: err}
+	}
+	saveOrgAudits(ctx, fs.db, audits)
+
+	var op string
+	if len(trashed) > 0 {
+		op = fs.recordOperation(ctx, userId, OperationDelete, &operationInverse{Files: trashed, Owner: owner})
+	}
+	return &schemas.Message{Message: "files deleted", Operation: op}, nil, nil
+}
+
+// deleteFilesJob deletes the messages backing files and then their rows, and
+// removes folders in batches so a failing batch only affects its own items.
+// Folders that still contain failed items are kept. Files whose messages could
+// not be deleted, or all of them while deleted files are kept in the trash, are
+// marked for deletion and left to the cleanup cron.
+func (fs *FileService) deleteFilesJob(ctx context.Context, run *JobRun) (any, error) {
+	var payload deletePayload
+	if err := run.Payload(&payload); err != nil {
+		return nil, err
+	}
+	if payload.Owner == 0 {
+		payload.Owner = run.UserID
+	}
+
+	var items []deleteItem
+	if err := fs.db.WithContext(ctx).Raw(deleteTreeQuery+" SELECT id, type, parent_id, level FROM tree",
+		payload.Files, payload.Owner).Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	audits := orgAudits(ctx, fs.db, run.UserID, "file.delete", payload.Files)
+
+	total := int64(len(items))
+	result := &schemas.DeleteResult{}
+	failed := make(map[string]bool)
+	parents := make(map[string]string, len(items))
+
+	var done int64
+
+	fail := func(ids []string, err error) {
+		for _, id := range ids {
+			failed[id] = true
+		}
+		result.Failed += len(ids)
+		if len(result.Errors) < maxDeleteErrors {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+
+	files := []string{}
+	folders := []deleteItem{}
+
+	for _, item := range items {
+		parents[item.ID] = item.ParentID
+		if item.Type == "folder" {
+			folders = append(folders, item)
+		} else {
+			files = append(files, item.ID)
+		}
+	}
+
+	batches := chunks(files, deleteBatchSize)
+	next := 0
+
+	deleteBatches := func(ctx context.Context, client *telegram.Client, user string) error {
+		channels := make(map[int64]*tg.InputChannel)
+		for ; next < len(batches); next++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			batch := batches[next]
+			pending, kept, err := fs.deleteFileBatch(ctx, client, user, channels, batch)
+			if err != nil {
+				fail(batch, err)
+			} else {
+				result.Deleted += len(batch)
+				result.Pending += pending
+			}
+			if kept != nil && len(result.Errors) < maxDeleteErrors {
+				result.Errors = append(result.Errors, kept.Error())
+			}
+			done += int64(len(batch))
+			run.Progress(done, total)
+		}
+		return nil
+	}
+
+	// with a trash the files are only marked and purged by the cleanup cron
+	if len(batches) > 0 && fs.trashRetention == 0 {
+		err := runWithUserClient(ctx, fs.db, fs.cnf, payload.Owner, deleteBatches)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, ctxErr
+		}
+		if err != nil && len(result.Errors) < maxDeleteErrors {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	// files left without a working session are only marked
+	deleteBatches(ctx, nil, "")
+
+	blocked := make(map[string]bool)
+	block := func(id string) {
+		for p, ok := parents[id]; ok; p, ok = parents[p] {
+			blocked[p] = true
+		}
+	}
+	for id := range failed {
+		block(id)
+	}
+
+	sort.SliceStable(folders, func(i, j int) bool {
+		return folders[i].Level > folders[j].Level
+	})
+
+	for start := 0; start < len(folders); {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		level := folders[start].Level
+		ids := []string{}
+		end := start
+		for ; end < len(folders) && folders[end].Level == level; end++ {
+			if blocked[folders[end].ID] {
+				result.Failed++
+				block(folders[end].ID)
+				continue
+			}
+			ids = append(ids, folders[end].ID)
+		}
+
+		for _, batch := range chunks(ids, deleteBatchSize) {
+			if err := fs.db.WithContext(ctx).Where("id IN ?", batch).Delete(&models.File{}).Error; err != nil {
+				fail(batch, err)
+				for _, id := range batch {
+					block(id)
+				}
+			} else {
+				result.Deleted += len(batch)
+			}
+		}
+
+		done += int64(end - start)
+		run.Progress(done, total)
+		start = end
+	}
+
+	run.Progress(total, total)
+
+	// items kept for a retry are audited once they are gone
+	deleted := audits[:0]
+	for _, audit := range audits {
+		if audit.Target != nil && !failed[*audit.Target] && !blocked[*audit.Target] {
+			deleted = append(deleted, audit)
+		}
+	}
+	saveOrgAudits(ctx, fs.db, deleted)
+
+	return result, nil
+}
+
+// deleteFileBatch deletes the messages of the files in ids channel by channel
+// and removes the rows of the files whose messages are gone. The other files
+// are marked for deletion and their count is returned. A nil client marks all
+// of them. Channels whose messages could not be deleted are reported in kept,
+// their files stay marked so the cleanup cron retries them.
+func (fs *FileService) deleteFileBatch(ctx context.Context, client *telegram.Client, user string,
+	channels map[int64]*tg.InputChannel, ids []string) (pending int, kept error, err error) {
+
+	marked := ids
+	var errs []error
+
+	if client != nil {
+		var files []models.File
+		if err := fs.db.WithContext(ctx).Select("id", "channel_id", "parts").Where("id IN ?", ids).
+			Find(&files).Error; err != nil {
+			return 0, nil, err
+		}
+
+		purged := make(map[string]bool)
+		byChannel := make(map[int64][]models.File)
+		for _, file := range files {
+			if file.ChannelID == nil || file.Parts == nil || len(*file.Parts) == 0 {
+				purged[file.ID] = true
+				continue
+			}
+			byChannel[*file.ChannelID] = append(byChannel[*file.ChannelID], file)
+		}
+
+		for channelId, files := range byChannel {
+			if err := deleteFileMessages(ctx, fs.db, client, user, channels, channelId, files, ids); err != nil {
+				errs = append(errs, fmt.Errorf("channel %d: %w", channelId, err))
+				continue
+			}
+			for _, file := range files {
+				purged[file.ID] = true
+			}
+		}
+
+		if len(purged) > 0 {
+			marked = []string{}
+			removed := []string{}
+			for _, id := range ids {
+				if purged[id] {
+					removed = append(removed, id)
+				} else {
+					marked = append(marked, id)
+				}
+			}
+			if err := PurgeFiles(ctx, fs.db, removed); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+
+	if len(marked) > 0 {
+		if err := fs.db.WithContext(ctx).Model(&models.File{}).Where("id IN ?", marked).
+			Update("status", "pending_deletion").Error; err != nil {
+			return 0, nil, err
+		}
+	}
+	return len(marked), errors.Join(errs...), nil
+}
+
+func deleteFileMessages(ctx context.Context, db *gorm.DB, client *telegram.Client, user string,
+	channels map[int64]*tg.InputChannel, channelId int64, files []models.File, purging []string) error {
+
+	channel, ok := channels[channelId]
+	if !ok {
+		var err error
+		if channel, err = GetChannelById(ctx, client, channelId, user); err != nil {
+			return err
+		}
+		channels[channelId] = channel
+	}
+
+	ids := []int{}
+	for _, file := range files {
+		for _, part := range *file.Parts {
+			ids = append(ids, int(part.ID))
+		}
+	}
+
+	// messages shared with copies or snapshots outlive this batch
+	ids, err := ReleasableParts(ctx, db, channelId, ids, purging)
+	if err != nil {
+		return err
+	}
+
+	for _, batch := range chunks(ids, deleteMessagesLimit) {
+		if _, err := client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{
+			Channel: channel, ID: batch}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func chunks[T any](items []T, size int) [][]T {
+	res := [][]T{}
+	for i := 0; i < len(items); i += size {
+		res = append(res, items[i:min(i+size, len(items))])
+	}
+	return res
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+)
+
+// dryRunLimit bounds the entries a dry run lists, the counts cover them all.
+const dryRunLimit = 1000
+
+const (
+	dryRunCounts = `count(*) FILTER (WHERE f.type = 'folder') AS folders,
+	count(*) FILTER (WHERE f.type <> 'folder') AS files,
+	coalesce(sum(f.size) FILTER (WHERE f.type = 'file'), 0) AS size`
+	dryRunEntries = `f.id, f.name, f.type, coalesce(f.size, 0) AS size, f.parent_id`
+)
+
+// dryRunTree reports the items with the given ids of a user and everything
+// below them.
+func (fs *FileService) dryRunTree(ctx context.Context, userId int64, ids []string) (*schemas.DryRun, *types.AppError) {
+	res := &schemas.DryRun{Entries: []schemas.DryRunEntry{}}
+	db := fs.db.WithContext(ctx)
+	if err := db.Raw(deleteTreeQuery+" SELECT "+dryRunCounts+" FROM tree t JOIN teldrive.files f ON f.id = t.id",
+		ids, userId).Scan(res).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if err := db.Raw(deleteTreeQuery+" SELECT "+dryRunEntries+" FROM tree t JOIN teldrive.files f ON f.id = t.id "+
+		"ORDER BY t.level, f.name LIMIT ?", ids, userId, dryRunLimit).Scan(&res.Entries).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res.Truncated = res.Files+res.Folders > int64(len(res.Entries))
+	return res, nil
+}
+
+// dryRunQuery reports the files a query on teldrive.files selects.
+func dryRunQuery(query func() *gorm.DB) (*schemas.DryRun, *types.AppError) {
+	res := &schemas.DryRun{Entries: []schemas.DryRunEntry{}}
+	if err := query().Table("teldrive.files AS f").Select(dryRunCounts).
+		Scan(res).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if err := query().Table("teldrive.files AS f").Select(dryRunEntries).Order("f.name").
+		Limit(dryRunLimit).Scan(&res.Entries).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res.Truncated = res.Files+res.Folders > int64(len(res.Entries))
+	return res, nil
+}
+
+// PreviewDeleteFiles reports what DeleteFiles would remove.
+func (fs *FileService) PreviewDeleteFiles(ctx context.Context, userId int64, payload *schemas.FileOperation) (*schemas.DryRun, *types.AppError) {
+	owner, appErr := fs.checkItemsAccess(ctx, userId, payload.Files, PermissionWrite)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return fs.dryRunTree(ctx, owner, payload.Files)
+}
+
+// PreviewMoveFiles reports what MoveFiles would move, subtrees included.
+func (fs *FileService) PreviewMoveFiles(ctx context.Context, userId int64, payload *schemas.FileOperation) (*schemas.DryRun, *types.AppError) {
+	if err := fs.checkOwned(ctx, userId, payload.Files); err != nil {
+		return nil, err
+	}
+	return fs.dryRunTree(ctx, userId, payload.Files)
+}
+
+// PreviewMoveDirectory reports what MoveDirectory would move.
+func (fs *FileService) PreviewMoveDirectory(ctx context.Context, userId int64, payload *schemas.DirMove) (*schemas.DryRun, *types.AppError) {
+	id, err := fs.getPathId(ctx, payload.Source, userId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return fs.dryRunTree(ctx, userId, []string{id})
+}
+
+// PreviewPurgeTrash reports the deleted files PurgeTrash would remove.
+func (fs *FileService) PreviewPurgeTrash(ctx context.Context, userId int64, payload *schemas.TrashRestore) (*schemas.DryRun, *types.AppError) {
+	return dryRunQuery(func() *gorm.DB { return fs.trashed(ctx, userId, payload.Files, payload.Path) })
+}
+
+// PreviewResolveDuplicates reports the copies ResolveDuplicates would delete.
+func (fs *FileService) PreviewResolveDuplicates(ctx context.Context, userId int64, payload *schemas.DuplicateResolve) (*schemas.DryRun, *types.AppError) {
+	rest, err := fs.duplicatesToDelete(ctx, userId, payload)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return fs.dryRunTree(ctx, userId, rest)
+}
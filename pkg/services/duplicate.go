@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+)
+
+const JobFindDuplicates = "files.duplicates"
+
+// maxDuplicateSets bounds the sets stored in a job result, the largest
+// wasted sizes come first.
+const maxDuplicateSets = 1000
+
+func (fs *FileService) FindDuplicates(ctx context.Context, userId int64) (*schemas.JobOut, *types.AppError) {
+	return fs.jobs.SubmitExclusive(ctx, userId, JobFindDuplicates, struct{}{}, "duplicate search already running")
+}
+
+type duplicateGroup struct {
+	Checksum string
+	Size     int64
+	Count    int64
+}
+
+// findDuplicates groups the files of a user by size and checksum. Files
+// without a checksum are only counted, the checksum backfill hashes them.
+func (fs *FileService) findDuplicates(ctx context.Context, run *JobRun) (any, error) {
+	active := func() *gorm.DB {
+		return fs.db.WithContext(ctx).Model(&models.File{}).Where("user_id = ?", run.UserID).
+			Where("type = ?", "file").Where("status = ?", "active")
+	}
+
+	result := &schemas.DuplicateResult{Sets: []schemas.DuplicateSet{}}
+
+	if err := active().Where("checksum IS NULL").Count(&result.Unhashed).Error; err != nil {
+		return nil, err
+	}
+
+	var groups []duplicateGroup
+	if err := active().Select("checksum", "coalesce(size, 0) AS size", "count(*) AS count").
+		Where("checksum IS NOT NULL").Group("checksum").Group("coalesce(size, 0)").Having("count(*) > 1").
+		Order("coalesce(size, 0) * (count(*) - 1) DESC").Limit(maxDuplicateSets).
+		Scan(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	total := int64(len(groups))
+	run.Progress(0, total)
+
+	for i, group := range groups {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		files := []schemas.FileOut{}
+		if err := active().Select("*", "(select path from teldrive.files as f where f.id = files.parent_id) as parent_path").
+			Where("checksum = ?", group.Checksum).Where("coalesce(size, 0) = ?", group.Size).
+			Order("updated_at DESC").Order("id").Scan(&files).Error; err != nil {
+			return result, err
+		}
+		result.Sets = append(result.Sets, schemas.DuplicateSet{Checksum: group.Checksum, Size: group.Size, Files: files})
+		result.Wasted += group.Size * (group.Count - 1)
+		run.Progress(int64(i+1), total)
+	}
+
+	return result, nil
+}
+
+// ResolveDuplicates keeps the most recently updated file of each set named by
+// its checksum and deletes the others, which go to the trash when it is on.
+func (fs *FileService) ResolveDuplicates(ctx context.Context, userId int64, payload *schemas.DuplicateResolve) (*schemas.Message, *schemas.JobOut, *types.AppError) {
+	rest, err := fs.duplicatesToDelete(ctx, userId, payload)
+	if err != nil {
+		return nil, nil, &types.AppError{Error: err}
+	}
+
+	if len(rest) == 0 {
+		return &schemas.Message{Message: "no duplicates to delete"}, nil, nil
+	}
+	return fs.DeleteFiles(ctx, userId, &schemas.FileOperation{Files: rest})
+}
+
+// duplicatesToDelete returns the files of the sets named by their checksum
+// other than the most recently updated one of each.
+func (fs *FileService) duplicatesToDelete(ctx context.Context, userId int64, payload *schemas.DuplicateResolve) ([]string, error) {
+	var files []models.File
+	if err := fs.db.WithContext(ctx).Select("id", "checksum", "size").Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").Where("checksum IN ?", payload.Checksums).
+		Order("checksum").Order("coalesce(size, 0)").Order("updated_at DESC").Order("id").
+		Find(&files).Error; err != nil {
+		return nil, err
+	}
+
+	type setKey struct {
+		checksum string
+		size     int64
+	}
+	kept := make(map[setKey]bool)
+	rest := []string{}
+	for _, file := range files {
+		key := setKey{checksum: *file.Checksum}
+		if file.Size != nil {
+			key.size = *file.Size
+		}
+		if !kept[key] {
+			kept[key] = true
+			continue
+		}
+		rest = append(rest, file.ID)
+	}
+	return rest, nil
+}
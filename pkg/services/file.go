@@ -1,24 +1,42 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/divyam234/teldrive/internal/cache"
 	"github.com/divyam234/teldrive/internal/category"
+	"github.com/divyam234/teldrive/internal/clientclass"
 	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/diskcache"
+	"github.com/divyam234/teldrive/internal/disposition"
+	"github.com/divyam234/teldrive/internal/foldertemplate"
 	"github.com/divyam234/teldrive/internal/http_range"
+	"github.com/divyam234/teldrive/internal/imaging"
 	"github.com/divyam234/teldrive/internal/md5"
+	"github.com/divyam234/teldrive/internal/playlist"
 	"github.com/divyam234/teldrive/internal/reader"
+	"github.com/divyam234/teldrive/internal/render"
+	"github.com/divyam234/teldrive/internal/scan"
+	"github.com/divyam234/teldrive/internal/signer"
+	"github.com/divyam234/teldrive/internal/sniff"
+	"github.com/divyam234/teldrive/internal/subtitle"
 	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/internal/uploadpolicy"
 	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/divyam234/teldrive/internal/winname"
 	"github.com/divyam234/teldrive/pkg/logging"
 	"github.com/divyam234/teldrive/pkg/mapper"
 	"github.com/divyam234/teldrive/pkg/models"
@@ -28,19 +46,72 @@ import (
 	"github.com/gotd/td/tg"
 	"go.uber.org/zap"
 
-	"github.com/jackc/pgx/v5/pgtype"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+const (
+	maxSubtitleSize    = 10 * 1024 * 1024
+	maxImageSourceSize = 50 * 1024 * 1024
+	maxListWait        = time.Minute
+)
+
 type FileService struct {
-	db     *gorm.DB
-	cnf    *config.TGConfig
-	worker *tgc.StreamWorker
+	db            *gorm.DB
+	cnf           *config.TGConfig
+	live          *config.Live
+	secret        string
+	worker        *tgc.StreamWorker
+	diskCache     *diskcache.Cache
+	jobs          *JobService
+	policies      map[clientclass.Class]streamPolicy
+	streamIdle    time.Duration
+	streamBuffer  int
+	chunks        *reader.ChunkCache
+	faststart     bool
+	search        string
+	renderer      render.Renderer
+	renderMaxSize int64
+	// trashRetention keeps deleted files restorable before their messages go
+	trashRetention time.Duration
+	// undoWindow is how long operations can be undone
+	undoWindow time.Duration
+	// linkStreams tracks the downloads of share links and their rate limiters
+	linkStreams linkStreams
+	// warmed holds the videos whose head and tail were cached lately
+	warmed sync.Map
+	// layouts holds the faststart layouts of the MP4s streamed lately
+	layouts layoutCache
+	// folderChanges wakes long polling listings when a folder changes
+	folderChanges *database.Listener
+	notifier      *Notifier
+	uploadPolicy  *uploadpolicy.Policy
+	scanner       scan.Scanner
+	scanMaxSize   int64
+	scans         scanQueue
 }
 
-func NewFileService(db *gorm.DB, cnf *config.Config, worker *tgc.StreamWorker) *FileService {
-	return &FileService{db: db, cnf: &cnf.TG, worker: worker}
+func NewFileService(db *gorm.DB, cnf *config.Config, live *config.Live, worker *tgc.StreamWorker,
+	diskCache *diskcache.Cache, jobs *JobService, renderer render.Renderer, notifier *Notifier,
+	scanner scan.Scanner) *FileService {
+	fs := &FileService{db: db, cnf: &cnf.TG, live: live, secret: cnf.JWT.Secret, worker: worker, diskCache: diskCache, jobs: jobs,
+		policies: newStreamPolicies(&cnf.Stream), streamIdle: cnf.Stream.IdleTimeout,
+		streamBuffer: cnf.Stream.BufferSize * 1024, chunks: reader.NewChunkCache(int64(cnf.Stream.WarmCacheSize) << 20),
+		faststart: cnf.Stream.Faststart, search: cnf.Search.Mode, renderer: renderer,
+		renderMaxSize: cnf.Render.MaxSize, folderChanges: database.NewListener(cnf.DB.DataSource, "folder_changes"),
+		trashRetention: cnf.Trash.Retention, undoWindow: cnf.Undo.Window, notifier: notifier,
+		uploadPolicy: newUploadPolicy(&cnf.TG),
+		scanner:      scanner, scanMaxSize: cnf.Scan.MaxSize}
+	jobs.Register(JobDeleteFiles, fs.deleteFilesJob)
+	jobs.Register(JobRestoreFiles, fs.restoreFilesJob)
+	jobs.Register(JobPurgeTrash, fs.purgeTrashJob)
+	jobs.Register(JobChecksumBackfill, fs.backfillChecksums)
+	jobs.Register(JobQuickHashBackfill, fs.backfillQuickHashes)
+	jobs.Register(JobVerifyFiles, fs.verifyFiles)
+	jobs.Register(JobImportChannel, fs.importChannel)
+	jobs.Register(JobSniffMime, fs.repairMimeTypes)
+	jobs.Register(JobFindDuplicates, fs.findDuplicates)
+	return fs
 }
 
 func (fs *FileService) CreateFile(c *gin.Context, userId int64, fileIn *schemas.FileIn) (*schemas.FileOut, *types.AppError) {
@@ -49,14 +120,35 @@ func (fs *FileService) CreateFile(c *gin.Context, userId int64, fileIn *schemas.
 
 	fileIn.Path = strings.TrimSpace(fileIn.Path)
 
-	if fileIn.Path != "" {
-		pathId, err := fs.getPathId(fileIn.Path, userId)
+	// org members add files by passing the org folder as parentId, the files
+	// belong to the org owner and are stored in the org channel
+	var org *models.Org
+	ownerId := userId
+	if fileIn.ParentID != "" {
+		parent, appErr := fs.accessibleFile(c, fileIn.ParentID, userId, PermissionWrite)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if parent.Type != "folder" {
+			return nil, &types.AppError{Error: errors.New("parent is not a folder"), Code: http.StatusBadRequest}
+		}
+		if parent.UserID != userId {
+			if org, appErr = orgWriter(c, fs.db, parent.ID, userId); appErr != nil {
+				return nil, appErr
+			}
+			ownerId = parent.UserID
+		}
+		fileDB.ParentID = parent.ID
+		fileIn.Path = parent.Path
+	} else if fileIn.Path != "" {
+		pathId, err := fs.getPathId(c, fileIn.Path, userId)
 		if err != nil || pathId == "" {
 			return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
 		}
 		fileDB.ParentID = pathId
 	}
 
+	fileDB.Name = fileIn.Name
 	if fileIn.Type == "folder" {
 		fileDB.MimeType = "drive/folder"
 		var fullPath string
@@ -70,7 +162,11 @@ func (fs *FileService) CreateFile(c *gin.Context, userId int64, fileIn *schemas.
 	} else if fileIn.Type == "file" {
 		fileDB.Path = ""
 		channelId := fileIn.ChannelID
-		if fileIn.ChannelID == 0 {
+		if org != nil && channelId != org.ChannelID {
+			return nil, &types.AppError{Error: errors.New("files of org members must be uploaded to the org channel"),
+				Code: http.StatusBadRequest}
+		}
+		if channelId == 0 {
 			var err error
 			channelId, err = GetDefaultChannel(c, fs.db, userId)
 			if err != nil {
@@ -78,7 +174,13 @@ func (fs *FileService) CreateFile(c *gin.Context, userId int64, fileIn *schemas.
 			}
 		}
 		fileDB.ChannelID = &channelId
-		fileDB.MimeType = fileIn.MimeType
+		fileDB.MimeType = fs.uploadedMimeType(c, userId, channelId, fileIn)
+		size := fs.uploadedSize(c, userId, channelId, fileIn)
+		if appErr := applyUploadPolicy(fs.uploadPolicy, &fileDB, size); appErr != nil {
+			return nil, appErr
+		}
+		fileDB.ScanStatus = fs.scanStatus(size)
+		fileDB.DedupPending = fs.cnf.Uploads.Dedup && fileIn.Size > 0
 		fileDB.Category = string(category.GetCategory(fileIn.Name))
 		parts := models.Parts{}
 		for _, part := range fileIn.Parts {
@@ -91,46 +193,162 @@ func (fs *FileService) CreateFile(c *gin.Context, userId int64, fileIn *schemas.
 		fileDB.Parts = &parts
 		fileDB.Starred = false
 		fileDB.Size = &fileIn.Size
+		if fileIn.QuickHash != "" {
+			quickHash := strings.ToLower(fileIn.QuickHash)
+			fileDB.QuickHash = &quickHash
+		}
+	} else if fileIn.Type == "shortcut" {
+		if ownerId != userId {
+			if _, appErr := fs.accessibleFile(c, fileIn.TargetID, userId, PermissionRead); appErr != nil {
+				return nil, appErr
+			}
+		}
+		target, appErr := fs.shortcutTarget(c, ownerId, fileIn.TargetID)
+		if appErr != nil {
+			return nil, appErr
+		}
+		fileDB.TargetID = &target.ID
+		fileDB.MimeType = target.MimeType
+		fileDB.Category = target.Category
 	}
-	fileDB.Name = fileIn.Name
 	fileDB.Type = fileIn.Type
-	fileDB.UserID = userId
-	fileDB.Status = "active"
+	fileDB.UserID = ownerId
+	if fileDB.Status == "" {
+		fileDB.Status = "active"
+	}
 	fileDB.Encrypted = fileIn.Encrypted
+	fileDB.Hidden = fileIn.Hidden
+
+	if fileIn.Type == "file" && (fileIn.SHA256 != "" || fileIn.MD5 != "") {
+		sum, appErr := fs.verifyUpload(c, &fileDB, fileIn)
+		if appErr != nil {
+			return nil, appErr
+		}
+		fileDB.Checksum = &sum
+	}
 
-	if err := fs.db.Create(&fileDB).Error; err != nil {
+	if err := fs.db.WithContext(c).Create(&fileDB).Error; err != nil {
 		if database.IsKeyConflictErr(err) {
 			return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
 		}
 		return nil, &types.AppError{Error: err}
 	}
 
+	recordOrgAudit(c, fs.db, userId, "file.create", []string{fileDB.ID})
+	if fileDB.ScanStatus != nil {
+		fs.scanSoon()
+	}
+
 	res := mapper.ToFileOut(fileDB)
+	res.Quarantined = fileDB.Status == statusQuarantined
 
 	return res, nil
 }
 
-func (fs *FileService) UpdateFile(id string, userId int64, update *schemas.FileUpdate, cache *cache.Cache) (*schemas.FileOut, *types.AppError) {
+func (fs *FileService) UpdateFile(ctx context.Context, id string, userId int64, update *schemas.FileUpdate) (*schemas.FileOut, *types.AppError) {
 	var (
 		files []models.File
-		chain *gorm.DB
+		err   error
+		rows  int64
 	)
-	if update.Type == "folder" && update.Name != "" {
-		chain = fs.db.Raw("select * from teldrive.update_folder(?, ?, ?)", id, update.Name, userId).Scan(&files)
-	} else {
+
+	// users the file is shared with for writing update it on the owner's behalf
+	target, appErr := fs.accessibleFile(ctx, id, userId, PermissionWrite)
+	if appErr != nil {
+		return nil, appErr
+	}
+	caller := userId
+	userId = target.UserID
+
+	// grantees may rename and mark the file, its content and its place in the
+	// tree stay with the owner
+	if caller != userId && (len(update.Parts) > 0 || update.Size != nil || update.ParentID != "" || update.Path != "" ||
+		!update.UpdatedAt.IsZero() || update.Color != nil || update.Icon != nil) {
+		return nil, &types.AppError{Error: errors.New("only the owner can change this"), Code: http.StatusForbidden}
+	}
+
+	// a new name or content is held to the upload policy like an upload
+	held := models.File{Name: target.Name, MimeType: target.MimeType}
+	changed := len(update.Parts) > 0 || update.Size != nil
+	var size int64
+	if changed {
+		if target.Size != nil {
+			size = *target.Size
+		}
+		if update.Size != nil {
+			size = *update.Size
+		}
+		if len(update.Parts) > 0 && target.ChannelID != nil {
+			size = fs.uploadedSize(ctx, userId, *target.ChannelID, &schemas.FileIn{Parts: update.Parts, Size: size})
+		}
+	}
+	if target.Type == "file" && ((update.Name != "" && update.Name != target.Name) || changed) {
+		if update.Name != "" {
+			held.Name = update.Name
+		}
+		if appErr := applyUploadPolicy(fs.uploadPolicy, &held, size); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	err = fs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if update.Revision != nil {
+			if err := checkRevisions(tx, map[string]int64{id: *update.Revision}); err != nil {
+				return err
+			}
+		}
+
+		// a zero valued field is skipped by Updates, so hiding is set on its own
+		if update.Hidden != nil {
+			if err := tx.Model(&models.File{}).Where("id = ?", id).
+				Where("user_id = ?", userId).UpdateColumn("hidden", *update.Hidden).Error; err != nil {
+				return err
+			}
+		}
+
+		if columns := appearanceColumns(update.Color, update.Icon); len(columns) > 0 {
+			if err := tx.Model(&models.File{}).Where("id = ?", id).Where("user_id = ?", userId).
+				Where("type = ?", "folder").UpdateColumns(columns).Error; err != nil {
+				return err
+			}
+		}
+
+		if update.Type == "folder" && update.Name != "" {
+			var err error
+			files, err = database.Procs(tx).UpdateFolder(tx, id, update.Name, userId)
+			rows = int64(len(files))
+			return err
+		}
 
 		updateDb := models.File{
-			Name:      update.Name,
-			ParentID:  update.ParentID,
-			UpdatedAt: update.UpdatedAt,
-			Path:      update.Path,
-			Size:      update.Size,
+			Name:             update.Name,
+			ParentID:         update.ParentID,
+			UpdatedAt:        update.UpdatedAt,
+			Path:             update.Path,
+			Size:             update.Size,
+			Status:           held.Status,
+			QuarantineReason: held.QuarantineReason,
 		}
 
 		if update.Starred != nil {
 			updateDb.Starred = *update.Starred
 		}
 
+		// hashes of the old content would let sync clients skip the new one,
+		// and new parts have to be scanned again
+		if changed {
+			columns := map[string]any{"checksum": nil, "quick_hash": nil}
+			if len(update.Parts) > 0 {
+				columns["scan_status"] = fs.scanStatus(size)
+				columns["scan_attempts"] = 0
+				columns["scanned_at"] = nil
+			}
+			if err := tx.Model(&models.File{}).Where("id = ?", id).Where("user_id = ?", userId).
+				UpdateColumns(columns).Error; err != nil {
+				return err
+			}
+		}
+
 		if len(update.Parts) > 0 {
 			parts := models.Parts{}
 
@@ -144,60 +362,165 @@ func (fs *FileService) UpdateFile(id string, userId int64, update *schemas.FileU
 
 			updateDb.Parts = &parts
 		}
-		chain = fs.db.Model(&files).Clauses(clause.Returning{}).Where("id = ?", id).Updates(updateDb)
+		chain := tx.Model(&files).Clauses(clause.Returning{}).Where("id = ?", id).
+			Where("user_id = ?", userId).Updates(updateDb)
+		rows = chain.RowsAffected
+		return chain.Error
+	})
 
-		cache.Delete(fmt.Sprintf("files:%s", id))
-	}
+	fileCache.Delete(ctx, fileCache.Key(id))
 
-	if chain.Error != nil {
-		return nil, &types.AppError{Error: chain.Error}
+	if errors.Is(err, errRevisionMismatch) {
+		return nil, &types.AppError{Error: err, Code: http.StatusPreconditionFailed}
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
 	}
-	if chain.RowsAffected == 0 {
+	if rows == 0 {
 		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
 	}
 
-	return mapper.ToFileOut(files[0]), nil
+	recordOrgAudit(ctx, fs.db, caller, "file.update", []string{id})
+	if len(update.Parts) > 0 && files[0].ScanStatus != nil {
+		fs.scanSoon()
+	}
+
+	res := mapper.ToFileOut(files[0])
+	if update.Name != "" && update.Name != target.Name {
+		res.Operation = fs.recordOperation(ctx, caller, OperationRename,
+			&operationInverse{ID: id, Type: target.Type, Name: target.Name})
+	}
+	return res, nil
 
 }
 
-func (fs *FileService) GetFileByID(id string) (*schemas.FileOutFull, *types.AppError) {
-	var file models.File
-	if err := fs.db.Where("id = ?", id).First(&file).Error; err != nil {
-		if database.IsRecordNotFoundErr(err) {
-			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+// uploadedMimeType prefers the mime type sniffed when the first part was
+// uploaded over the one claimed by the client.
+func (fs *FileService) uploadedMimeType(ctx context.Context, userId, channelId int64, fileIn *schemas.FileIn) string {
+	if len(fileIn.Parts) > 0 {
+		var sniffed []string
+		fs.db.WithContext(ctx).Model(&models.Upload{}).Where("user_id = ?", userId).
+			Where("channel_id = ?", channelId).Where("part_id = ?", fileIn.Parts[0].ID).
+			Where("part_no = ?", 1).Where("mime_type IS NOT NULL").Limit(1).Pluck("mime_type", &sniffed)
+		if len(sniffed) > 0 {
+			return sniffed[0]
 		}
-		return nil, &types.AppError{Error: err}
 	}
+	if fileIn.MimeType != "" && fileIn.MimeType != "application/octet-stream" {
+		return fileIn.MimeType
+	}
+	return sniff.Detect(fileIn.Name, nil)
+}
 
-	return mapper.ToFileOutFull(file), nil
+// uploadedSize is the size of an upload as recorded for its parts, or the
+// size claimed by the client when that is larger or the parts were uploaded
+// elsewhere.
+func (fs *FileService) uploadedSize(ctx context.Context, userId, channelId int64, fileIn *schemas.FileIn) int64 {
+	if len(fileIn.Parts) == 0 {
+		return fileIn.Size
+	}
+	ids := make([]int64, 0, len(fileIn.Parts))
+	for _, part := range fileIn.Parts {
+		ids = append(ids, part.ID)
+	}
+	var size int64
+	fs.db.WithContext(ctx).Model(&models.Upload{}).Where("user_id = ?", userId).
+		Where("channel_id = ?", channelId).Where("part_id IN ?", ids).
+		Select("coalesce(sum(size), 0)").Scan(&size)
+	return max(size, fileIn.Size)
 }
 
-func (fs *FileService) ListFiles(userId int64, fquery *schemas.FileQuery) (*schemas.FileResponse, *types.AppError) {
+// searchCondition matches file names against search. In substring mode every
+// word of search has to appear in the name, which works on any Postgres
+// install and can be sped up with a pg_trgm index on name.
+func (fs *FileService) searchCondition(search string) clause.Expression {
+	if fs.search != config.SearchSubstring {
+		return database.Procs(fs.db).SearchName(search)
+	}
+	words := strings.Fields(search)
+	conds := make([]clause.Expression, 0, len(words))
+	for _, word := range words {
+		conds = append(conds, clause.Expr{SQL: `name ILIKE ? ESCAPE '\'`, Vars: []interface{}{"%" + escapeLike(word) + "%"}})
+	}
+	return clause.And(conds...)
+}
+
+func escapeLike(s string) string {
+	return database.EscapeLike(s)
+}
+
+func (fs *FileService) GetFileByID(ctx context.Context, id string, userId int64) (*schemas.FileOutFull, *types.AppError) {
+	file, err := fs.accessibleFile(ctx, id, userId, PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.resolvedFile(ctx, file)
+}
+
+func (fs *FileService) ListFiles(ctx context.Context, userId int64, fquery *schemas.FileQuery) (*schemas.FileResponse, *types.AppError) {
 
 	var (
 		pathId string
 		err    error
 	)
 
+	key, ok := sortKeys[fquery.Sort]
+	if !ok {
+		return nil, &types.AppError{Error: fmt.Errorf("invalid sort %q", fquery.Sort), Code: http.StatusBadRequest}
+	}
+	if fquery.Order != "asc" && fquery.Order != "desc" {
+		return nil, &types.AppError{Error: fmt.Errorf("invalid order %q", fquery.Order), Code: http.StatusBadRequest}
+	}
+	browse, ok := browseCategories[fquery.Category]
+	if fquery.Op == "category" && !ok {
+		return nil, &types.AppError{Error: fmt.Errorf("unknown category %q", fquery.Category), Code: http.StatusNotFound}
+	}
+	if fquery.PerPage < 1 {
+		return nil, &types.AppError{Error: fmt.Errorf("invalid perPage %d", fquery.PerPage), Code: http.StatusBadRequest}
+	}
+
+	if fquery.WinCompat {
+		fquery.Path = winname.DecodePath(fquery.Path)
+		fquery.Name = winname.Decode(fquery.Name)
+	}
+
+	// folders shared by other users are listed by id on behalf of their owner
+	owner := userId
+
 	if fquery.Path != "" {
-		pathId, err = fs.getPathId(fquery.Path, userId)
+		pathId, err = fs.getPathId(ctx, fquery.Path, userId)
 		if err != nil {
 			return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
 		}
+	} else if fquery.Op == "list" && fquery.ParentID != "" {
+		folder, appErr := fs.accessibleFile(ctx, fquery.ParentID, userId, PermissionRead)
+		if appErr != nil {
+			return nil, appErr
+		}
+		// shortcuts to folders list the folder they point at
+		if folder.Type == "shortcut" {
+			if folder, appErr = fs.shortcutTarget(ctx, folder.UserID, *folder.TargetID); appErr != nil {
+				return nil, appErr
+			}
+		}
+		pathId, owner = folder.ID, folder.UserID
 	}
 
-	query := fs.db.Limit(fquery.PerPage)
-
-	filter := &models.File{UserID: userId, Status: "active"}
-
-	setOrderFilter(query, fquery)
-
-	if fquery.Op == "list" {
+	// long polling clients only get a listing once the folder changed
+	if fquery.Op == "list" && fquery.IfChangedSince != "" {
+		etag, err := fs.waitForFolderChange(ctx, owner, pathId, fquery.IfChangedSince, fquery.Wait)
+		if err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+		if etag == fquery.IfChangedSince {
+			return &schemas.FileResponse{Files: []schemas.FileOut{}, ETag: etag}, nil
+		}
+	}
 
-		query.Order("type DESC").Order(getOrder(fquery)).Where("parent_id = ?", pathId).
-			Model(filter).Where(&filter)
+	filter := &models.File{UserID: owner, Status: "active"}
 
-	} else if fquery.Op == "find" {
+	if fquery.Op == "find" {
 
 		filter.Name = fquery.Name
 		filter.Type = fquery.Type
@@ -214,20 +537,52 @@ func (fs *FileService) ListFiles(userId int64, fquery *schemas.FileQuery) (*sche
 			filter.Path = ""
 		}
 
-		query.Order("type DESC").Order(getOrder(fquery)).
-			Model(&filter).Where(&filter)
+	} else if fquery.Op == "shared" {
+		filter.UserID = 0
+	}
+
+	// scope selects every item of the listing, across all pages
+	scope := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Model(filter).Where(filter)
+		if fquery.Hidden != nil && !*fquery.Hidden {
+			tx = tx.Where("hidden = ?", false)
+		}
+		switch fquery.Op {
+		case "list":
+			tx = tx.Where("parent_id = ?", pathId)
+		case "shared":
+			tx = fs.sharedWith(tx, userId)
+		case "search":
+			tx = tx.Where(fs.searchCondition(fquery.Search))
+		case "category":
+			tx = tx.Where("type = ?", "file")
+			if browse.mimePrefix != "" {
+				tx = tx.Where("category = ? OR mime_type LIKE ?", browse.category, browse.mimePrefix+"%")
+			} else {
+				tx = tx.Where("category = ?", browse.category)
+			}
+		}
+		return tx
+	}
+
+	// one extra row tells whether another page follows
+	query := scope(fs.db.WithContext(ctx)).Limit(fquery.PerPage + 1)
 
-	} else if fquery.Op == "search" {
+	// search results are ranked without putting folders first
+	typed := fquery.Op != "search"
 
-		query.Where("teldrive.get_tsquery(?) @@ teldrive.get_tsvector(name)", fquery.Search)
+	setOrderFilter(query, key, fquery, typed)
 
-		query.Order(getOrder(fquery)).
-			Model(&filter).Where(&filter)
+	if typed {
+		query.Order("type DESC")
 	}
+	query.Order(getOrder(key, fquery))
 
+	columns := []string{"*", "(" + key.expr + ")::text AS sort_value"}
 	if fquery.Path == "" {
-		query.Select("*,(select path from teldrive.files as f where f.id = files.parent_id) as parent_path")
+		columns = append(columns, "(select path from teldrive.files as f where f.id = files.parent_id) as parent_path")
 	}
+	query.Select(columns)
 
 	files := []schemas.FileOut{}
 
@@ -235,22 +590,109 @@ func (fs *FileService) ListFiles(userId int64, fquery *schemas.FileQuery) (*sche
 
 	token := ""
 
-	if len(files) == fquery.PerPage {
-		lastItem := files[len(files)-1]
-		token = utils.GetField(&lastItem, utils.CamelToPascalCase(fquery.Sort))
-		token = base64.StdEncoding.EncodeToString([]byte(token))
+	hasMore := len(files) > fquery.PerPage
+	if hasMore {
+		files = files[:fquery.PerPage]
+		token = encodeCursor(&files[len(files)-1], typed)
 	}
 
-	res := &schemas.FileResponse{Files: files, NextPageToken: token}
+	if err := fs.resolveShortcuts(ctx, owner, files); err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := &schemas.FileResponse{Files: files, NextPageToken: token, HasMore: hasMore}
+
+	if fquery.Count {
+		var summary schemas.ListSummary
+		if err := scope(fs.db.WithContext(ctx)).Select(
+			"count(*) FILTER (WHERE type = 'file') AS files",
+			"count(*) FILTER (WHERE type = 'folder') AS folders",
+			"coalesce(sum(size) FILTER (WHERE type = 'file'), 0) AS size").
+			Scan(&summary).Error; err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+		total := summary.Files + summary.Folders
+		res.TotalCount = &total
+		res.Summary = &summary
+	}
+
+	if fquery.WinCompat {
+		for i := range res.Files {
+			res.Files[i].Name = winname.Encode(res.Files[i].Name)
+			res.Files[i].Path = winname.EncodePath(res.Files[i].Path)
+			res.Files[i].ParentPath = winname.EncodePath(res.Files[i].ParentPath)
+		}
+	}
+
+	if fquery.Scanner {
+		for i := range res.Files {
+			res.Files[i].Inode = utils.StableInode(res.Files[i].ID)
+			res.Files[i].ModTime = res.Files[i].UpdatedAt.Unix()
+		}
+	}
+
+	if fquery.Op == "list" && (fquery.Scanner || fquery.Wait > 0 || fquery.IfChangedSince != "") {
+		res.ETag, err = fs.folderETag(ctx, owner, pathId)
+		if err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+	}
 
 	return res, nil
 }
 
-func (fs *FileService) getPathId(path string, userId int64) (string, error) {
+// folderETag derives a directory validator from the children of a folder so
+// media scanners can skip unchanged folders without walking them again.
+func (fs *FileService) folderETag(ctx context.Context, userId int64, folderId string) (string, error) {
+	var summary struct {
+		Total     int64
+		Size      int64
+		UpdatedAt time.Time
+	}
+	if err := fs.db.WithContext(ctx).Model(&models.File{}).
+		Select("count(*) as total", "coalesce(sum(size),0) as size", "coalesce(max(updated_at),'epoch') as updated_at").
+		Where("parent_id = ?", folderId).Where("user_id = ?", userId).Where("status = ?", "active").
+		Scan(&summary).Error; err != nil {
+		return "", err
+	}
+	return md5.FromString(fmt.Sprintf("%s:%d:%d:%d", folderId, summary.Total, summary.Size,
+		summary.UpdatedAt.UnixNano())), nil
+}
+
+// waitForFolderChange waits until the etag of a folder differs from etag or
+// wait, capped to maxListWait, elapsed. The etag is only computed again when
+// the database notifies a change of the folder. The last etag seen is returned.
+func (fs *FileService) waitForFolderChange(ctx context.Context, userId int64, folderId, etag string,
+	wait time.Duration) (string, error) {
+
+	deadline := time.NewTimer(min(wait, maxListWait))
+	defer deadline.Stop()
+
+	for {
+		// waiting starts before the check so no change slips in between
+		changed, stop := fs.folderChanges.Wait(folderId)
+		current, err := fs.folderETag(ctx, userId, folderId)
+		if err != nil || current != etag {
+			stop()
+			return current, err
+		}
+		select {
+		case <-ctx.Done():
+			stop()
+			return current, ctx.Err()
+		case <-deadline.C:
+			stop()
+			return current, nil
+		case <-changed:
+		}
+	}
+}
+
+func (fs *FileService) getPathId(ctx context.Context, path string, userId int64) (string, error) {
 
 	var file models.File
 
-	if err := fs.db.Model(&models.File{}).Select("id").Where("path = ?", path).Where("user_id = ?", userId).
+	if err := fs.db.WithContext(ctx).Model(&models.File{}).Select("id").Where("path = ?", path).Where("user_id = ?", userId).
 		First(&file).Error; database.IsRecordNotFoundErr(err) {
 		return "", database.ErrNotFound
 
@@ -258,11 +700,9 @@ func (fs *FileService) getPathId(path string, userId int64) (string, error) {
 	return file.ID, nil
 }
 
-func (fs *FileService) MakeDirectory(userId int64, payload *schemas.MkDir) (*schemas.FileOut, *types.AppError) {
-	var files []models.File
-
-	if err := fs.db.Raw("select * from teldrive.create_directories(?, ?)", userId, payload.Path).
-		Scan(&files).Error; err != nil {
+func (fs *FileService) MakeDirectory(ctx context.Context, userId int64, payload *schemas.MkDir) (*schemas.FileOut, *types.AppError) {
+	files, err := database.Procs(fs.db).CreateDirectories(fs.db.WithContext(ctx), userId, payload.Path)
+	if err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
@@ -271,48 +711,118 @@ func (fs *FileService) MakeDirectory(userId int64, payload *schemas.MkDir) (*sch
 	return file, nil
 }
 
-func (fs *FileService) MoveFiles(userId int64, payload *schemas.FileOperation) (*schemas.Message, *types.AppError) {
+func (fs *FileService) CreateFromTemplate(ctx context.Context, userId int64, payload *schemas.FolderTemplate) (*schemas.FileOut, *types.AppError) {
+
+	folders := payload.Folders
+
+	if payload.Template != "" {
+		var err error
+		folders, err = foldertemplate.Get(payload.Template)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
+	}
 
-	items := pgtype.Array[string]{
-		Elements: payload.Files,
-		Valid:    true,
-		Dims:     []pgtype.ArrayDimension{{Length: int32(len(payload.Files)), LowerBound: 1}},
+	paths, err := foldertemplate.Expand(payload.Path, folders)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
 	}
 
-	if err := fs.db.Exec("select * from teldrive.move_items(? , ? , ?)", items, payload.Destination, userId).Error; err != nil {
+	var base []models.File
+
+	procs := database.Procs(fs.db)
+	err = fs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if base, err = procs.CreateDirectories(tx, userId, payload.Path); err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if _, err := procs.CreateDirectories(tx, userId, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
-	return &schemas.Message{Message: "files moved"}, nil
+	// nothing is returned when the base folder already existed
+	if len(base) == 0 {
+		var folder models.File
+		if err := fs.db.WithContext(ctx).Where("path = ?", payload.Path).Where("user_id = ?", userId).
+			Where("type = ?", "folder").First(&folder).Error; err != nil {
+			if database.IsRecordNotFoundErr(err) {
+				return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+			}
+			return nil, &types.AppError{Error: err}
+		}
+		base = append(base, folder)
+	}
+
+	return mapper.ToFileOut(base[0]), nil
 }
 
-func (fs *FileService) DeleteFiles(userId int64, payload *schemas.FileOperation) (*schemas.Message, *types.AppError) {
+func (fs *FileService) MoveFiles(ctx context.Context, userId int64, payload *schemas.FileOperation) (*schemas.Message, *types.AppError) {
+
+	if err := fs.checkOwned(ctx, userId, payload.Files); err != nil {
+		return nil, err
+	}
+
+	var moved []models.File
+	if err := fs.db.WithContext(ctx).Select("id", "parent_id").Where("id IN ?", payload.Files).
+		Find(&moved).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
 
-	if err := fs.db.Exec("call teldrive.delete_files($1)", payload.Files).Error; err != nil {
+	err := fs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(payload.Revisions) > 0 {
+			if err := checkRevisions(tx, payload.Revisions); err != nil {
+				return err
+			}
+		}
+		return database.Procs(tx).MoveItems(tx, payload.Files, payload.Destination, userId)
+	})
+	if errors.Is(err, errRevisionMismatch) {
+		return nil, &types.AppError{Error: err, Code: http.StatusPreconditionFailed}
+	}
+	if err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
-	return &schemas.Message{Message: "files deleted"}, nil
+	recordOrgAudit(ctx, fs.db, userId, "file.move", payload.Files)
+
+	parents := make(map[string]string, len(moved))
+	for _, file := range moved {
+		parents[file.ID] = file.ParentID
+	}
+	op := fs.recordOperation(ctx, userId, OperationMove, &operationInverse{Parents: parents})
+
+	return &schemas.Message{Message: "files moved", Operation: op}, nil
 }
 
 func (fs *FileService) DeleteFileParts(c *gin.Context, id string) (*schemas.Message, *types.AppError) {
+	userId, session := GetUserAuth(c)
+
 	var file models.File
-	if err := fs.db.Where("id = ?", id).First(&file).Error; err != nil {
+	if err := fs.db.WithContext(c).Where("id = ?", id).Where("user_id = ?", userId).First(&file).Error; err != nil {
 		if database.IsRecordNotFoundErr(err) {
 			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
 		}
 		return nil, &types.AppError{Error: err}
 	}
 
-	userId, session := GetUserAuth(c)
-
 	ids := []int{}
 
 	for _, part := range *file.Parts {
 		ids = append(ids, int(part.ID))
 	}
 
-	err := DeleteTGMessages(c, fs.cnf, session, *file.ChannelID, userId, ids)
+	ids, err := ReleasableParts(c, fs.db, *file.ChannelID, ids, []string{file.ID})
+	if err == nil && len(ids) > 0 {
+		err = DeleteTGMessages(c, fs.cnf, session, *file.ChannelID, userId, ids)
+	}
 
 	if err != nil {
 		return nil, &types.AppError{Error: err}
@@ -321,21 +831,65 @@ func (fs *FileService) DeleteFileParts(c *gin.Context, id string) (*schemas.Mess
 	return &schemas.Message{Message: "file parts deleted"}, nil
 }
 
-func (fs *FileService) MoveDirectory(userId int64, payload *schemas.DirMove) (*schemas.Message, *types.AppError) {
+var errRevisionMismatch = errors.New("file was modified by another client")
+
+// checkRevisions locks the files in revisions for the rest of tx and fails
+// unless each is still at the expected revision.
+func checkRevisions(tx *gorm.DB, revisions map[string]int64) error {
+	ids := make([]string, 0, len(revisions))
+	for id := range revisions {
+		ids = append(ids, id)
+	}
+
+	var files []models.File
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "revision").
+		Where("id IN ?", ids).Find(&files).Error; err != nil {
+		return err
+	}
+	if len(files) != len(ids) {
+		return database.ErrNotFound
+	}
+	for _, file := range files {
+		if file.Revision != revisions[file.ID] {
+			return errRevisionMismatch
+		}
+	}
+	return nil
+}
+
+// checkOwned fails with not found unless every id names a file of userId, so
+// that ids of other users' files cannot be probed or acted on.
+func (fs *FileService) checkOwned(ctx context.Context, userId int64, ids []string) *types.AppError {
+	unique := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	var count int64
+	if err := fs.db.WithContext(ctx).Model(&models.File{}).Where("id IN ?", ids).Where("user_id = ?", userId).
+		Count(&count).Error; err != nil {
+		return &types.AppError{Error: err}
+	}
+	if count != int64(len(unique)) {
+		return &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	return nil
+}
+
+func (fs *FileService) MoveDirectory(ctx context.Context, userId int64, payload *schemas.DirMove) (*schemas.Message, *types.AppError) {
 
-	if err := fs.db.Exec("select * from teldrive.move_directory(? , ? , ?)", payload.Source,
-		payload.Destination, userId).Error; err != nil {
+	if err := database.Procs(fs.db).MoveDirectory(fs.db.WithContext(ctx), payload.Source,
+		payload.Destination, userId); err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
 	return &schemas.Message{Message: "directory moved"}, nil
 }
 
-func (fs *FileService) GetCategoryStats(userId int64) ([]schemas.FileCategoryStats, *types.AppError) {
+func (fs *FileService) GetCategoryStats(ctx context.Context, userId int64) ([]schemas.FileCategoryStats, *types.AppError) {
 
 	var stats []schemas.FileCategoryStats
 
-	if err := fs.db.Model(&models.File{}).Select("category", "COUNT(*) as total_files", "coalesce(SUM(size),0) as total_size").
+	if err := fs.db.WithContext(ctx).Model(&models.File{}).Select("category", "COUNT(*) as total_files", "coalesce(SUM(size),0) as total_size").
 		Where(&models.File{UserID: userId, Type: "file", Status: "active"}).
 		Order("category ASC").Group("category").Find(&stats).Error; err != nil {
 		return nil, &types.AppError{Error: err}
@@ -358,12 +912,29 @@ func (fs *FileService) CopyFile(c *gin.Context) (*schemas.FileOut, *types.AppErr
 
 	var res []models.File
 
-	if err := fs.db.Model(&models.File{}).Where("id = ?", payload.ID).Find(&res).Error; err != nil {
+	// quarantined files stay where they are until released
+	if err := fs.db.WithContext(c).Model(&models.File{}).Where("id = ?", payload.ID).Where("user_id = ?", userId).
+		Where("status = ?", "active").Find(&res).Error; err != nil {
 		return nil, &types.AppError{Error: err}
 	}
+	if len(res) == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+
+	if res[0].Type == "shortcut" {
+		return fs.copyShortcut(c, userId, &res[0], &payload)
+	}
 
 	file := mapper.ToFileOutFull(res[0])
 
+	// the copy is held to the upload policy under its new name before any
+	// message is sent
+	dbFile := models.File{Name: payload.Name, MimeType: file.MimeType, Status: "active",
+		ScanStatus: fs.scanStatus(file.Size)}
+	if appErr := applyUploadPolicy(fs.uploadPolicy, &dbFile, file.Size); appErr != nil {
+		return nil, appErr
+	}
+
 	newIds := models.Parts{}
 
 	channelId, err := GetDefaultChannel(c, fs.db, userId)
@@ -424,30 +995,24 @@ func (fs *FileService) CopyFile(c *gin.Context) (*schemas.FileOut, *types.AppErr
 		return nil, &types.AppError{Error: err}
 	}
 
-	var destRes []models.File
-
-	if err := fs.db.Raw("select * from teldrive.create_directories(?, ?)", userId, payload.Destination).Scan(&destRes).Error; err != nil {
+	destRes, err := database.Procs(fs.db).CreateDirectories(fs.db.WithContext(c), userId, payload.Destination)
+	if err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
 	dest := destRes[0]
 
-	dbFile := models.File{}
-
-	dbFile.Name = payload.Name
 	dbFile.Size = &file.Size
 	dbFile.Type = file.Type
-	dbFile.MimeType = file.MimeType
 	dbFile.Parts = &newIds
 	dbFile.UserID = userId
 	dbFile.Starred = false
-	dbFile.Status = "active"
 	dbFile.ParentID = dest.ID
 	dbFile.ChannelID = &channelId
 	dbFile.Encrypted = file.Encrypted
 	dbFile.Category = file.Category
 
-	if err := fs.db.Create(&dbFile).Error; err != nil {
+	if err := fs.db.WithContext(c).Create(&dbFile).Error; err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
@@ -462,38 +1027,83 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 
 	fileID := c.Param("fileID")
 
-	authHash := c.Query("hash")
+	session, link, err := fs.streamSession(c, fileID)
 
-	if authHash == "" {
-		http.Error(w, "missing hash param", http.StatusBadRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	cache := cache.FromContext(c)
 
-	session, err := getSessionByHash(fs.db, cache, authHash)
+	key := fileCache.Key(fileID)
 
-	if err != nil {
-		http.Error(w, "invalid hash", http.StatusBadRequest)
+	cached, ok := fileCache.Get(c, key)
+	if !ok {
+		dbFile, appErr := fs.accessibleFile(c, fileID, session.UserId, PermissionRead)
+		if appErr != nil {
+			http.Error(w, appErr.Error.Error(), http.StatusBadRequest)
+			return
+		}
+		if dbFile.Status == statusQuarantined {
+			http.Error(w, "file is quarantined", http.StatusForbidden)
+			return
+		}
+		resolved, appErr := fs.resolvedFile(c, dbFile)
+		if appErr != nil {
+			http.Error(w, appErr.Error.Error(), http.StatusBadRequest)
+			return
+		}
+		if resolved.TargetType == "folder" {
+			http.Error(w, "folder shortcuts cannot be streamed", http.StatusBadRequest)
+			return
+		}
+		// held files are not cached, so they are served once the scan is done
+		if awaitingScan(resolved.ScanStatus) {
+			http.Error(w, errAwaitingScan.Error(), http.StatusConflict)
+			return
+		}
+		cached = streamFile{File: *resolved, OwnerID: dbFile.UserID}
+		fileCache.Set(c, key, cached)
+	} else if appErr := fs.checkAccess(c, fileID, cached.OwnerID, session.UserId, PermissionRead); appErr != nil {
+		http.Error(w, appErr.Error.Error(), http.StatusBadRequest)
 		return
 	}
 
-	file := &schemas.FileOutFull{}
-
-	key := fmt.Sprintf("files:%s", fileID)
+	file := &cached.File
 
-	err = cache.Get(key, file)
-
-	var appErr *types.AppError
+	if link != nil {
+		counted, err := fs.admitLinkStream(c, link, r, c.ClientIP())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if counted {
+			fs.notifier.Notify(link.OwnerID, notifyShareAccessed,
+				fmt.Sprintf("%s was downloaded through a share link from %s.", file.Name, c.ClientIP()))
+		}
+	}
 
-	if err != nil {
-		file, appErr = fs.GetFileByID(fileID)
-		if appErr != nil {
-			http.Error(w, appErr.Error.Error(), http.StatusBadRequest)
+	// shared files live in the owner's channels, so they are read as the owner
+	if cached.OwnerID != session.UserId {
+		session, err = getLatestSession(c, fs.db, cached.OwnerID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		cache.Set(key, file, 0)
 	}
 
+	fs.serveFile(c, session, link, file, false)
+}
+
+// serveFile streams file to the client, honouring Range requests. Files of
+// channels the bots of the user cannot read, like mounted channels, are read
+// with the session of the user when userOnly is set.
+func (fs *FileService) serveFile(c *gin.Context, session *models.Session, link *models.ShareLink,
+	file *schemas.FileOutFull, userOnly bool) {
+
+	w := c.Writer
+
+	r := c.Request
+
 	c.Header("Accept-Ranges", "bytes")
 
 	var start, end int64
@@ -540,13 +1150,19 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 	c.Header("E-Tag", fmt.Sprintf("\"%s\"", md5.FromString(file.ID+strconv.FormatInt(file.Size, 10))))
 	c.Header("Last-Modified", file.UpdatedAt.UTC().Format(http.TimeFormat))
 
-	disposition := "inline"
+	kind := disposition.Inline
 
-	if c.Query("d") == "1" {
-		disposition = "attachment"
+	// d is the older spelling of download
+	if c.Query("download") == "1" || c.Query("d") == "1" {
+		kind = disposition.Attachment
 	}
 
-	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+	name := file.Name
+	if override := strings.TrimSpace(c.Query("filename")); override != "" {
+		name = override
+	}
+
+	c.Header("Content-Disposition", disposition.Format(kind, name))
 
 	tokens, err := getBotsToken(c, fs.db, session.UserId, file.ChannelID)
 
@@ -564,9 +1180,10 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 
 	var client *tgc.Client
 
-	if fs.cnf.DisableStreamBots || len(tokens) == 0 {
-		tgClient, _ := tgc.AuthClient(c, fs.cnf, session.Session)
-		client, err = fs.worker.UserWorker(tgClient, session.UserId)
+	runtime := fs.live.Load()
+
+	if runtime.DisableStreamBots || userOnly || len(tokens) == 0 {
+		client, err = fs.worker.UserWorker(session.Session, session.UserId)
 		if err != nil {
 			logger.Error("file stream", zap.Error(err))
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -580,7 +1197,7 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 	} else {
 		var index int
 
-		limit := min(len(tokens), fs.cnf.BgBotsLimit)
+		limit := min(len(tokens), runtime.BgBotsLimit)
 
 		fs.worker.Set(tokens[:limit], file.ChannelID)
 
@@ -597,20 +1214,45 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 	}
 
 	if r.Method != "HEAD" {
-		parts, err := getParts(c, client.Tg, file, channelUser)
-		if err != nil {
-			logger.Error("file stream", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		class := clientclass.Classify(r)
+		policy := fs.policies[class]
+
+		logger.Debugw("stream policy", "class", class, "prefetch", policy.prefetch, "limited", policy.limiter != nil)
+
+		if policy.limiter == nil && (link == nil || link.RateLimit <= 0) {
+			if data, ok := fs.cachedRange(c, file, channelUser, kind, start, end); ok {
+				out := newStreamWriter(w, fs.streamIdle)
+				var n int64
+				for _, b := range data {
+					written, err := out.Write(b)
+					n += int64(written)
+					if err != nil {
+						break
+					}
+				}
+				out.reset()
+				if link != nil {
+					fs.recordLinkStream(c, link, c.ClientIP(), n)
+				}
+				return
+			}
 		}
 
-		if file.Encrypted {
-			lr, err = reader.NewDecryptedReader(c, client.Tg, parts, start, end, fs.cnf.Uploads.EncryptionKey)
+		ctx, lease := fs.worker.Acquire(c, client)
+		defer lease.Release(0, nil)
+
+		opts := []reader.Option{reader.WithInvoker(client.Invoker()), reader.WithDC(client.DC),
+			reader.WithPrefetch(policy.prefetch), reader.WithCache(fs.chunks)}
+		if layout := fs.faststartLayout(ctx, client, file, channelUser, kind); layout != nil {
+			lr, err = newSegmentReader(layout.Range(start, end), func(start, end int64) (io.ReadCloser, error) {
+				return newFileReader(ctx, client.Tg, fs.cnf, file, start, end, channelUser, opts...)
+			}), nil
 		} else {
-			lr, err = reader.NewLinearReader(c, client.Tg, parts, start, end)
+			lr, err = newFileReader(ctx, client.Tg, fs.cnf, file, start, end, channelUser, opts...)
 		}
 
 		if err != nil {
+			lease.Release(0, err)
 			logger.Error("file stream", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -619,29 +1261,376 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 			http.Error(w, "failed to initialise reader", http.StatusInternalServerError)
 			return
 		}
+		defer lr.Close()
+
+		if rangeHeader != "" && strings.HasPrefix(file.MimeType, "video/") {
+			fs.warm(r.Context(), client, file, channelUser)
+		}
+
+		var src io.Reader = reader.NewLimitedReader(ctx, lr, policy.limiter)
+		if link != nil {
+			src = reader.NewLimitedReader(ctx, src, fs.linkLimiter(link))
+		}
 
-		io.CopyN(w, lr, contentLength)
+		out := newStreamWriter(w, fs.streamIdle)
+		n, err := reader.CopyN(out, src, contentLength, fs.streamBuffer)
+		out.reset()
+		lease.Release(n, err)
+		if link != nil {
+			fs.recordLinkStream(c, link, c.ClientIP(), n)
+		}
 	}
 }
-func setOrderFilter(query *gorm.DB, fquery *schemas.FileQuery) *gorm.DB {
-	if fquery.NextPageToken != "" {
-		sortColumn := utils.CamelToSnake(fquery.Sort)
 
-		tokenValue, err := base64.StdEncoding.DecodeString(fquery.NextPageToken)
-		if err == nil {
-			if fquery.Order == "asc" {
-				return query.Where(fmt.Sprintf("%s > ?", sortColumn), string(tokenValue))
-			} else {
-				return query.Where(fmt.Sprintf("%s < ?", sortColumn), string(tokenValue))
-			}
+// streamSession resolves the Telegram session used to serve a stream, either
+// from the session hash, from a signed link bound to the file or from a share
+// link of the file, which is returned too.
+func (fs *FileService) streamSession(c *gin.Context, fileID string) (*models.Session, *models.ShareLink, error) {
+	if hash := c.Query("hash"); hash != "" {
+		session, err := getSessionByHash(c, fs.db, hash)
+		if err != nil {
+			return nil, nil, errors.New("invalid hash")
+		}
+		return session, nil, nil
+	}
+
+	if sig := c.Query("sig"); sig != "" {
+		userId, _ := strconv.ParseInt(c.Query("uid"), 10, 64)
+		expires, _ := strconv.ParseInt(c.Query("exp"), 10, 64)
+		if err := signer.Verify(fs.secret, fileID, userId, expires, sig); err != nil {
+			return nil, nil, err
+		}
+		session, err := getLatestSession(c, fs.db, userId)
+		return session, nil, err
+	}
+
+	if linkId := c.Query("link"); linkId != "" {
+		link, err := fs.shareLink(c, fileID, linkId)
+		if err != nil {
+			return nil, nil, err
+		}
+		session, err := getLatestSession(c, fs.db, link.OwnerID)
+		return session, link, err
+	}
+
+	return nil, nil, errors.New("missing hash param")
+}
+
+// streamURL builds a stream link for a file of a server reached at baseURL,
+// which expires after ttl without exposing the caller's session hash.
+func (fs *FileService) streamURL(baseURL string, userId int64, fileID, name string, ttl time.Duration) string {
+	expires := time.Now().Add(ttl)
+	return fmt.Sprintf("%s/api/files/%s/stream/%s?uid=%d&exp=%d&sig=%s", strings.TrimSuffix(baseURL, "/"), fileID,
+		url.PathEscape(name), userId, expires.Unix(), signer.Sign(fs.secret, fileID, userId, expires))
+}
+
+func (fs *FileService) GetPlaylist(c *gin.Context) {
+	userId, _ := GetUserAuth(c)
+
+	var query schemas.PlaylistQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ttl := 24 * time.Hour
+	if query.Expires != "" {
+		var err error
+		ttl, err = time.ParseDuration(query.Expires)
+		if err != nil || ttl <= 0 || ttl > signer.MaxTTL {
+			http.Error(c.Writer, "invalid expires", http.StatusBadRequest)
+			return
+		}
+	}
+
+	baseURL, err := requestBaseURL(c)
+	if err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var folder models.File
+	if err := fs.db.WithContext(c).Where("id = ?", c.Param("fileID")).Where("user_id = ?", userId).
+		Where("type = ?", "folder").First(&folder).Error; err != nil {
+		http.Error(c.Writer, database.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	var files []models.File
+	if err := fs.db.WithContext(c).Where("parent_id = ?", folder.ID).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").
+		Where("category = ?", string(category.Audio)).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "name"}}).Find(&files).Error; err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tracks := []playlist.Track{}
+	for _, file := range files {
+		tracks = append(tracks, playlist.Track{
+			Title: strings.TrimSuffix(file.Name, filepath.Ext(file.Name)),
+			URL:   fs.streamURL(baseURL, userId, file.ID, file.Name, ttl),
+		})
+	}
+
+	contentType, ext := "audio/x-mpegurl", "m3u"
+	if query.Format == "m3u8" {
+		contentType, ext = "application/vnd.apple.mpegurl", "m3u8"
+	}
+
+	c.Header("Content-Type", contentType+"; charset=utf-8")
+	c.Header("Content-Disposition", disposition.Format(disposition.Attachment, folder.Name+"."+ext))
+	c.Status(http.StatusOK)
+	playlist.Write(c.Writer, tracks)
+}
+
+func (fs *FileService) GetSubtitles(ctx context.Context, userId int64, id string) ([]schemas.Subtitle, *types.AppError) {
+	var video models.File
+	if err := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).First(&video).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
 		}
+		return nil, &types.AppError{Error: err}
 	}
-	return query
+
+	var siblings []models.File
+	if err := fs.db.WithContext(ctx).Where("parent_id = ?", video.ParentID).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").Where("id != ?", video.ID).
+		Order("name ASC").Find(&siblings).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	subtitles := []schemas.Subtitle{}
+	for _, file := range siblings {
+		if lang, ok := subtitle.Match(video.Name, file.Name); ok {
+			subtitles = append(subtitles, schemas.Subtitle{
+				ID:       file.ID,
+				Name:     file.Name,
+				Language: lang,
+				Format:   subtitle.Format(file.Name),
+			})
+		}
+	}
+	return subtitles, nil
 }
 
-func getOrder(fquery *schemas.FileQuery) clause.OrderByColumn {
-	sortColumn := utils.CamelToSnake(fquery.Sort)
+func (fs *FileService) GetSubtitle(c *gin.Context) {
+	userId, _ := GetUserAuth(c)
+
+	var file models.File
+	if err := fs.db.WithContext(c).Where("id = ?", c.Param("subtitleID")).Where("user_id = ?", userId).
+		Where("status = ?", "active").First(&file).Error; err != nil {
+		http.Error(c.Writer, database.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if file.ScanStatus != nil && awaitingScan(*file.ScanStatus) {
+		http.Error(c.Writer, errAwaitingScan.Error(), http.StatusConflict)
+		return
+	}
+
+	format := subtitle.Format(file.Name)
+	if format == "" {
+		http.Error(c.Writer, "not a subtitle file", http.StatusBadRequest)
+		return
+	}
+
+	if file.Size == nil || *file.Size == 0 || *file.Size > maxSubtitleSize {
+		http.Error(c.Writer, "invalid subtitle size", http.StatusBadRequest)
+		return
+	}
+
+	toVTT := c.Query("format") == "vtt" && format == "srt"
+
+	contentType := "text/plain; charset=utf-8"
+	if toVTT || format == "vtt" {
+		contentType = "text/vtt; charset=utf-8"
+	}
+
+	out := mapper.ToFileOutFull(file)
+
+	err := readFileWithAuth(c, fs.cnf, out, 0, out.Size-1, func(r io.Reader) error {
+		c.Header("Content-Type", contentType)
+		c.Header("Cache-Control", "private, max-age=3600")
+		c.Status(http.StatusOK)
+		if toVTT {
+			return subtitle.SRTToVTT(c.Writer, r)
+		}
+		_, err := io.CopyN(c.Writer, r, out.Size)
+		return err
+	})
+	if err != nil && !c.Writer.Written() {
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (fs *FileService) GetImage(c *gin.Context) {
+	userId, _ := GetUserAuth(c)
+
+	var query schemas.ImageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if query.Quality == 0 {
+		query.Quality = 85
+	}
+
+	if query.Format != "" && imaging.ContentType(query.Format) == "" {
+		http.Error(c.Writer, imaging.ErrUnknownFormat.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var file models.File
+	if err := fs.db.WithContext(c).Where("id = ?", c.Param("fileID")).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").First(&file).Error; err != nil {
+		http.Error(c.Writer, database.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
 
-	return clause.OrderByColumn{Column: clause.Column{Name: sortColumn},
-		Desc: fquery.Order == "desc"}
+	if file.ScanStatus != nil && awaitingScan(*file.ScanStatus) {
+		http.Error(c.Writer, errAwaitingScan.Error(), http.StatusConflict)
+		return
+	}
+
+	if file.Size == nil || *file.Size == 0 || *file.Size > maxImageSourceSize {
+		http.Error(c.Writer, "invalid image size", http.StatusBadRequest)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%s\"", md5.FromString(fmt.Sprintf("%s:%d:%d:%d:%s:%d", file.ID,
+		file.UpdatedAt.UnixNano(), query.Width, query.Height, query.Format, query.Quality)))
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	key := etag
+	contentType := imaging.ContentType(query.Format)
+
+	if cached, err := fs.diskCache.Open("images", key); err == nil {
+		defer cached.Close()
+		if contentType == "" {
+			buf := make([]byte, 512)
+			n, _ := cached.Read(buf)
+			contentType = http.DetectContentType(buf[:n])
+			cached.Seek(0, io.SeekStart)
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, max-age=86400")
+		http.ServeContent(c.Writer, c.Request, "", file.UpdatedAt, cached)
+		return
+	}
+
+	out := mapper.ToFileOutFull(file)
+
+	var buf bytes.Buffer
+
+	err := readFileWithAuth(c, fs.cnf, out, 0, out.Size-1, func(r io.Reader) error {
+		var err error
+		contentType, err = imaging.Resize(&buf, io.LimitReader(r, out.Size), query.Width, query.Height,
+			query.Format, query.Quality)
+		return err
+	})
+
+	if err != nil {
+		logging.FromContext(c).Errorw("image resize", "file", file.ID, "err", err)
+		http.Error(c.Writer, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := fs.diskCache.Write("images", key, buf.Bytes()); err != nil {
+		logging.FromContext(c).Warnw("image cache write", "file", file.ID, "err", err)
+	}
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// browseCategories are the groups files can be browsed by across the drive.
+// Files are matched by the category of their extension or by mime type, as
+// either may be missing.
+var browseCategories = map[string]struct {
+	category   category.Category
+	mimePrefix string
+}{
+	"images":    {category: category.Image, mimePrefix: "image/"},
+	"videos":    {category: category.Video, mimePrefix: "video/"},
+	"audio":     {category: category.Audio, mimePrefix: "audio/"},
+	"documents": {category: category.Document},
+}
+
+// sortKey is an expression ListFiles can sort and page by, along with the
+// type next page tokens are cast back to.
+type sortKey struct {
+	expr string
+	cast string
+}
+
+// sortKeys whitelists the sort parameter, so it never reaches SQL as is.
+var sortKeys = map[string]sortKey{
+	"name":      {expr: "name", cast: "text"},
+	"updatedAt": {expr: "updated_at", cast: "timestamp"},
+	"createdAt": {expr: "created_at", cast: "timestamp"},
+	"size":      {expr: "coalesce(size, 0)", cast: "bigint"},
+	"id":        {expr: "id", cast: "text"},
+	"category":  {expr: "coalesce(category, '')", cast: "text"},
+	"extension": {expr: `coalesce(lower(substring(name from '\.([^.]+)$')), '')`, cast: "text"},
+}
+
+// pageCursor is the position after the last item of a page. Sort values are
+// not unique, so the id breaks ties, and folders are listed before files.
+type pageCursor struct {
+	Type  string `json:"t,omitempty"`
+	Value string `json:"v"`
+	ID    string `json:"i"`
+}
+
+func encodeCursor(file *schemas.FileOut, typed bool) string {
+	cursor := pageCursor{Value: file.SortValue, ID: file.ID}
+	if typed {
+		cursor.Type = file.Type
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// setOrderFilter skips the items up to the next page token. Tokens that do
+// not decode start over from the first page.
+func setOrderFilter(query *gorm.DB, key sortKey, fquery *schemas.FileQuery, typed bool) *gorm.DB {
+	if fquery.NextPageToken == "" {
+		return query
+	}
+	data, err := base64.StdEncoding.DecodeString(fquery.NextPageToken)
+	if err != nil {
+		return query
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return query
+	}
+
+	cmp := ">"
+	if fquery.Order == "desc" {
+		cmp = "<"
+	}
+	cond := fmt.Sprintf("(%[1]s %[2]s CAST(? AS %[3]s) OR (%[1]s = CAST(? AS %[3]s) AND id %[2]s ?))",
+		key.expr, cmp, key.cast)
+	args := []any{cursor.Value, cursor.Value, cursor.ID}
+	if typed {
+		cond = "(type < ? OR (type = ? AND " + cond + "))"
+		args = append([]any{cursor.Type, cursor.Type}, args...)
+	}
+	return query.Where(cond, args...)
+}
+
+func getOrder(key sortKey, fquery *schemas.FileQuery) string {
+	if fquery.Order == "desc" {
+		return key.expr + " DESC, id DESC"
+	}
+	return key.expr + " ASC, id ASC"
 }
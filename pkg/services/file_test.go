@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"testing"
 
 	"github.com/divyam234/teldrive/internal/database"
@@ -21,7 +22,7 @@ type FileServiceSuite struct {
 
 func (s *FileServiceSuite) SetupSuite() {
 	s.db = database.NewTestDatabase(s.T(), false)
-	s.srv = NewFileService(s.db, nil, nil)
+	s.srv = NewFileService(s.db, nil, nil, nil, nil, nil, nil, nil, nil)
 }
 
 func (s *FileServiceSuite) SetupTest() {
@@ -58,7 +59,7 @@ func TestSuite(t *testing.T) {
 func (s *FileServiceSuite) TestSave() {
 	res, err := s.srv.CreateFile(&gin.Context{}, 123456, s.entry("file.jpeg"))
 	s.NoError(err.Error)
-	find, err := s.srv.GetFileByID(res.ID)
+	find, err := s.srv.GetFileByID(context.Background(), res.ID, 123456)
 	s.NoError(err.Error)
 	s.Equal(find.ID, res.ID)
 	s.Equal(find.MimeType, res.MimeType)
@@ -83,14 +84,47 @@ func (s *FileServiceSuite) Test_Update() {
 		Path: "/dwkd",
 		Type: "file",
 	}
-	r, err := s.srv.UpdateFile(res.ID, 123456, data, nil)
+	r, err := s.srv.UpdateFile(context.Background(), res.ID, 123456, data)
 	s.NoError(err.Error)
 	s.Equal(r.Name, data.Name)
 	s.Equal(r.Path, data.Path)
 }
 
 func (s *FileServiceSuite) Test_NoFound() {
-	_, err := s.srv.GetFileByID("kj2ei28bdkj")
+	_, err := s.srv.GetFileByID(context.Background(), "kj2ei28bdkj", 123456)
 	s.Error(err.Error)
 	s.Equal(err, database.ErrNotFound)
 }
+
+func (s *FileServiceSuite) TestShortcut() {
+	c := &gin.Context{}
+	res, err := s.srv.CreateFile(c, 123456, s.entry("target.jpeg"))
+	s.NoError(err.Error)
+	shortcut, err := s.srv.CreateFile(c, 123456, &schemas.FileIn{Name: "link.jpeg", Type: "shortcut",
+		Path: "/", TargetID: res.ID})
+	s.NoError(err.Error)
+	find, err := s.srv.GetFileByID(context.Background(), shortcut.ID, 123456)
+	s.NoError(err.Error)
+	s.Equal(shortcut.ID, find.ID)
+	s.Equal(res.ID, find.TargetID)
+	s.Equal(res.Size, find.Size)
+}
+
+func (s *FileServiceSuite) TestReleasableParts() {
+	c := &gin.Context{}
+	first := s.entry("first.jpeg")
+	first.Parts = []schemas.Part{{ID: 7}}
+	a, err := s.srv.CreateFile(c, 123456, first)
+	s.NoError(err.Error)
+	second := s.entry("second.jpeg")
+	second.Parts = []schemas.Part{{ID: 7}}
+	b, err := s.srv.CreateFile(c, 123456, second)
+	s.NoError(err.Error)
+
+	ids, e := ReleasableParts(context.Background(), s.db, 123456, []int{7}, []string{a.ID})
+	s.NoError(e)
+	s.Empty(ids)
+	ids, e = ReleasableParts(context.Background(), s.db, 123456, []int{7}, []string{a.ID, b.ID})
+	s.NoError(e)
+	s.Equal([]int{7}, ids)
+}
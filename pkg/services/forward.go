@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/telegram/message/peer"
+	"github.com/gotd/td/tg"
+)
+
+// SendToTelegram sends the documents holding a file to a chat from the user's
+// account, reusing the stored documents instead of uploading them again. A
+// file split in parts arrives as one document per part.
+func (fs *FileService) SendToTelegram(c *gin.Context, id string, payload *schemas.TelegramSend) (*schemas.Message, *types.AppError) {
+	userId, session := GetUserAuth(c)
+
+	var dbFile models.File
+	if err := fs.db.WithContext(c).Where("id = ?", id).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").First(&dbFile).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	if dbFile.ScanStatus != nil && awaitingScan(*dbFile.ScanStatus) {
+		return nil, &types.AppError{Error: errAwaitingScan, Code: http.StatusConflict}
+	}
+	if dbFile.Encrypted {
+		return nil, &types.AppError{Error: errors.New("encrypted files cannot be sent to telegram"),
+			Code: http.StatusBadRequest}
+	}
+	file := mapper.ToFileOutFull(dbFile)
+	if len(file.Parts) == 0 {
+		return nil, &types.AppError{Error: errors.New("file has no content"), Code: http.StatusBadRequest}
+	}
+
+	client, _ := tgc.AuthClient(c, fs.cnf, session)
+
+	var errPeer error
+	err := tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
+		to, err := resolvePeer(ctx, client.API(), payload.To)
+		if err != nil {
+			errPeer = fmt.Errorf("resolve %s: %w", payload.To, err)
+			return errPeer
+		}
+
+		messages, err := getTGMessages(ctx, client, file.Parts, file.ChannelID, strconv.FormatInt(userId, 10))
+		if err != nil {
+			return err
+		}
+
+		for i, message := range messages {
+			item, ok := message.(*tg.Message)
+			if !ok {
+				return fmt.Errorf("part %d is missing", i+1)
+			}
+			media, ok := item.Media.(*tg.MessageMediaDocument)
+			if !ok {
+				return fmt.Errorf("part %d has no document", i+1)
+			}
+			document, ok := media.Document.(*tg.Document)
+			if !ok {
+				return fmt.Errorf("part %d has no document", i+1)
+			}
+
+			caption := file.Name
+			if len(messages) > 1 {
+				caption = fmt.Sprintf("%s (part %d/%d)", file.Name, i+1, len(messages))
+			}
+			randomId, err := randInt64()
+			if err != nil {
+				return err
+			}
+			if _, err := client.API().MessagesSendMedia(ctx, &tg.MessagesSendMediaRequest{
+				Silent:   payload.Silent,
+				Peer:     to,
+				Media:    &tg.InputMediaDocument{ID: document.AsInput()},
+				Message:  caption,
+				RandomID: randomId,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if errPeer != nil {
+		return nil, &types.AppError{Error: errPeer, Code: http.StatusBadRequest}
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "file sent to " + payload.To}, nil
+}
+
+// resolvePeer finds the chat to: "me" for Saved Messages, a username, a t.me
+// link or the phone number of a contact.
+func resolvePeer(ctx context.Context, api *tg.Client, to string) (tg.InputPeerClass, error) {
+	to = strings.TrimSpace(to)
+	if strings.EqualFold(to, "me") || strings.EqualFold(to, "self") {
+		return &tg.InputPeerSelf{}, nil
+	}
+	return peer.Resolve(peer.DefaultResolver(api), to)(ctx)
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/category"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const JobImportChannel = "files.import"
+
+const importBatchSize = 100
+
+func (fs *FileService) ImportChannel(ctx context.Context, userId int64, payload *schemas.ImportIn) (*schemas.JobOut, *types.AppError) {
+	return fs.jobs.SubmitExclusive(ctx, userId, JobImportChannel, payload, "import already running")
+}
+
+// importChannel walks the history of a channel the user can read and creates a
+// file for every document message, pointing at the message as its only part.
+// Messages imported by an earlier run are skipped, so an interrupted import
+// can simply be started again.
+func (fs *FileService) importChannel(ctx context.Context, run *JobRun) (any, error) {
+	var payload schemas.ImportIn
+	if err := run.Payload(&payload); err != nil {
+		return nil, err
+	}
+
+	parentId, err := createDirectories(ctx, fs.db, run.UserID, payload.Destination)
+	if err != nil {
+		return nil, err
+	}
+
+	imported, err := fs.importedMessages(ctx, run.UserID, payload.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &schemas.ImportResult{}
+
+	err = runWithUserClient(ctx, fs.db, fs.cnf, run.UserID, func(ctx context.Context, client *telegram.Client, user string) error {
+		channel, err := importableChannel(ctx, client, payload.ChannelID)
+		if err != nil {
+			return err
+		}
+
+		peer := &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash}
+		iter := messages.NewQueryBuilder(client.API()).GetHistory(peer).BatchSize(importBatchSize).Iter()
+
+		total, err := iter.Total(ctx)
+		if err != nil {
+			return err
+		}
+		run.Progress(0, int64(total))
+
+		for iter.Next(ctx) {
+			result.Scanned++
+			run.Progress(int64(result.Scanned), int64(total))
+
+			msg, ok := iter.Value().Msg.(*tg.Message)
+			if !ok {
+				continue
+			}
+			file, ok := importedFile(msg)
+			if !ok {
+				continue
+			}
+			if imported[int64(msg.ID)] {
+				result.Skipped++
+				continue
+			}
+
+			// documents refused by the upload policy stay in the channel only
+			if appErr := applyUploadPolicy(fs.uploadPolicy, file, *file.Size); appErr != nil {
+				result.Skipped++
+				continue
+			}
+
+			file.ParentID = parentId
+			file.UserID = run.UserID
+			file.ChannelID = &payload.ChannelID
+			file.ScanStatus = fs.scanStatus(*file.Size)
+
+			if err := fs.createImported(ctx, file, msg.ID); err != nil {
+				return err
+			}
+			result.Imported++
+		}
+		return iter.Err()
+	})
+	if err == nil {
+		// streams of imported files go through the channel like any other
+		err = fs.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.Channel{ChannelID: payload.ChannelID, UserID: run.UserID}).Error
+	}
+
+	switch {
+	case err == nil:
+		fs.notifier.Notify(run.UserID, notifyImportFinished, fmt.Sprintf(
+			"Import into %s finished: %d files imported, %d already there.",
+			payload.Destination, result.Imported, result.Skipped))
+	case ctx.Err() == nil:
+		fs.notifier.Notify(run.UserID, notifyImportFinished, fmt.Sprintf(
+			"Import into %s failed after %d files: %v", payload.Destination, result.Imported, err))
+	}
+
+	return result, err
+}
+
+// importedMessages returns the ids of the messages of channelId already
+// backing files of userId.
+func (fs *FileService) importedMessages(ctx context.Context, userId, channelId int64) (map[int64]bool, error) {
+	var ids []int64
+	if err := fs.db.WithContext(ctx).Raw(`
+	SELECT (p->>'id')::bigint FROM teldrive.files f, jsonb_array_elements(f.parts) p
+	WHERE f.user_id = ? AND f.channel_id = ? AND f.parts IS NOT NULL`, userId, channelId).
+		Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	res := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		res[id] = true
+	}
+	return res, nil
+}
+
+// importableChannel resolves channelId, which has to be a broadcast channel.
+// Groups and chats are not imported.
+func importableChannel(ctx context.Context, client *telegram.Client, channelId int64) (*tg.InputChannel, error) {
+	res, err := client.API().ChannelsGetChannels(ctx, []tg.InputChannelClass{&tg.InputChannel{ChannelID: channelId}})
+	if err != nil {
+		return nil, err
+	}
+	for _, chat := range res.GetChats() {
+		if channel, ok := chat.(*tg.Channel); ok && channel.ID == channelId {
+			if !channel.Broadcast {
+				return nil, errors.New("only channels can be imported")
+			}
+			return channel.AsInput(), nil
+		}
+	}
+	return nil, errors.New("no channels found")
+}
+
+// createImported stores file, suffixing its name with the message id when the
+// destination already holds a file of the same name. The message is recorded
+// as imported, so deleting the file leaves it in the channel.
+func (fs *FileService) createImported(ctx context.Context, file *models.File, msgId int) error {
+	return fs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO teldrive.imported_parts (channel_id, message_id) VALUES (?, ?)
+		ON CONFLICT DO NOTHING`, *file.ChannelID, msgId).Error; err != nil {
+			return err
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(file)
+		if res.Error != nil || res.RowsAffected > 0 {
+			return res.Error
+		}
+		ext := path.Ext(file.Name)
+		file.Name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(file.Name, ext), msgId, ext)
+		return tx.Create(file).Error
+	})
+}
+
+// importedFile describes the document attached to msg, if any.
+func importedFile(msg *tg.Message) (*models.File, bool) {
+	media, ok := msg.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return nil, false
+	}
+	document, ok := media.Document.(*tg.Document)
+	if !ok {
+		return nil, false
+	}
+
+	name := ""
+	for _, attr := range document.Attributes {
+		if fn, ok := attr.(*tg.DocumentAttributeFilename); ok {
+			name = fn.FileName
+			break
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("%d", msg.ID)
+		if exts, _ := mime.ExtensionsByType(document.MimeType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+
+	mimeType := document.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	size := document.Size
+	parts := models.Parts{{ID: int64(msg.ID)}}
+	date := time.Unix(int64(msg.Date), 0).UTC()
+
+	return &models.File{
+		Name:      name,
+		Type:      "file",
+		MimeType:  mimeType,
+		Category:  string(category.GetCategory(name)),
+		Size:      &size,
+		Parts:     &parts,
+		Status:    "active",
+		CreatedAt: date,
+		UpdatedAt: date,
+	}, true
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/kv"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/message/peer"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// inboxRestart is how long the inbox bot waits before connecting again.
+const inboxRestart = 30 * time.Second
+
+var errNotInboxUser = errors.New("not a teldrive user")
+
+// inbox files the documents users send or forward to the inbox bot under their
+// inbox folder. The message is copied into the user's default channel by the
+// bot, which is made an admin of the channel with the user's session when it
+// is not one yet. Commands of inboxcmd.go browse the drive from the chat.
+type inbox struct {
+	db     *gorm.DB
+	cnf    *config.Config
+	files  *FileService
+	client *telegram.Client
+	self   *tg.User
+	logger *zap.SugaredLogger
+
+	maintenance *Maintenance
+}
+
+// StartInbox runs the inbox bot for as long as the server runs, when a bot
+// token is configured.
+func StartInbox(lc fx.Lifecycle, cnf *config.Config, KV kv.KV, files *FileService, maintenance *Maintenance) error {
+	if cnf.Inbox.BotToken == "" {
+		return nil
+	}
+
+	ib := &inbox{db: files.db, cnf: cnf, files: files, maintenance: maintenance,
+		logger: logging.DefaultLogger().Named("inbox")}
+
+	dispatcher := tg.NewUpdateDispatcher()
+	dispatcher.OnNewMessage(ib.onMessage)
+	gaps := updates.New(updates.Config{Handler: dispatcher})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := tgc.BotUpdatesClient(ctx, KV, &cnf.TG, cnf.Inbox.BotToken, gaps)
+	if err != nil {
+		cancel()
+		return err
+	}
+	ib.client = client
+
+	var wg sync.WaitGroup
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					err := tgc.RunWithAuth(ctx, client, cnf.Inbox.BotToken, func(ctx context.Context) error {
+						self, err := client.Self(ctx)
+						if err != nil {
+							return err
+						}
+						ib.self = self
+						ib.logger.Infow("inbox bot started", "bot", self.Username)
+						return gaps.Run(ctx, client.API(), self.ID, updates.AuthOptions{IsBot: true})
+					})
+					if ctx.Err() != nil {
+						return
+					}
+					ib.logger.Errorw("inbox bot stopped", "err", err)
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(inboxRestart):
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			wg.Wait()
+			return nil
+		},
+	})
+	return nil
+}
+
+func (ib *inbox) onMessage(ctx context.Context, e tg.Entities, u *tg.UpdateNewMessage) error {
+	msg, ok := u.Message.(*tg.Message)
+	if !ok || msg.Out {
+		return nil
+	}
+	from, ok := msg.PeerID.(*tg.PeerUser)
+	if !ok {
+		return nil
+	}
+	user, ok := e.Users[from.UserID]
+	if !ok {
+		return nil
+	}
+	sender := &tg.InputPeerUser{UserID: user.ID, AccessHash: user.AccessHash}
+
+	reply := "Send or forward a file to store it in your drive, or /help for commands."
+	if strings.HasPrefix(msg.Message, "/") && msg.Media == nil {
+		reply = ib.command(ctx, user.ID, sender, msg.Message)
+	} else if file, ok := importedFile(msg); ok {
+		if err := ib.paused(); err != nil {
+			reply = "Could not store " + file.Name + ": " + err.Error()
+		} else if err := ib.store(ctx, user.ID, sender, msg, file); err != nil {
+			ib.logger.Warnw("failed to file inbox document", "user", user.ID, "err", err)
+			reply = "Could not store " + file.Name + ": " + err.Error()
+		} else {
+			reply = "Stored as " + path.Join(ib.cnf.Inbox.Folder, file.Name)
+		}
+	}
+
+	to := message.NewSender(ib.client.API()).To(sender)
+	for i, part := range splitReply(reply) {
+		var err error
+		if i == 0 {
+			_, err = to.Reply(msg.ID).Text(ctx, part)
+		} else {
+			_, err = to.Text(ctx, part)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// store copies msg into the default channel of userId and creates file for
+// the copy under the inbox folder.
+func (ib *inbox) store(ctx context.Context, userId int64, sender tg.InputPeerClass, msg *tg.Message, file *models.File) error {
+	if err := ib.checkUser(ctx, userId); err != nil {
+		return err
+	}
+	if appErr := applyUploadPolicy(ib.files.uploadPolicy, file, *file.Size); appErr != nil {
+		return appErr.Error
+	}
+
+	channelId, err := GetDefaultChannel(ctx, ib.db, userId)
+	if err != nil {
+		return err
+	}
+
+	msgId, err := ib.copyToChannel(ctx, channelId, sender, msg.ID)
+	if err != nil {
+		// the bot may not be an admin of the channel yet
+		if err := ib.joinChannel(ctx, userId, channelId); err != nil {
+			return fmt.Errorf("add inbox bot to channel: %w", err)
+		}
+		if msgId, err = ib.copyToChannel(ctx, channelId, sender, msg.ID); err != nil {
+			return err
+		}
+	}
+
+	parentId, err := createDirectories(ctx, ib.db, userId, ib.cnf.Inbox.Folder)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	parts := models.Parts{{ID: int64(msgId)}}
+	file.UserID, file.ParentID, file.ChannelID, file.Parts = userId, parentId, &channelId, &parts
+	file.CreatedAt, file.UpdatedAt = now, now
+	file.ScanStatus = ib.files.scanStatus(*file.Size)
+	return ib.files.createImported(ctx, file, msgId)
+}
+
+// paused fails while maintenance keeps the drive from changing.
+func (ib *inbox) paused() error {
+	on, message, _ := ib.maintenance.Active()
+	if !on {
+		return nil
+	}
+	if message == "" {
+		message = "the server is under maintenance"
+	}
+	return errors.New(message)
+}
+
+// checkUser tells whether userId may use the bot.
+func (ib *inbox) checkUser(ctx context.Context, userId int64) error {
+	var user models.User
+	if err := ib.db.WithContext(ctx).Where("user_id = ?", userId).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errNotInboxUser
+		}
+		return err
+	}
+	if user.Disabled {
+		return errNotInboxUser
+	}
+	return nil
+}
+
+// copyToChannel forwards message id of the chat with sender into the channel
+// without its author and returns the id of the copy.
+func (ib *inbox) copyToChannel(ctx context.Context, channelId int64, sender tg.InputPeerClass, id int) (int, error) {
+	channel, err := GetChannelById(ctx, ib.client, channelId, strconv.FormatInt(ib.self.ID, 10))
+	if err != nil {
+		return 0, err
+	}
+	randomId, err := randInt64()
+	if err != nil {
+		return 0, err
+	}
+	res, err := ib.client.API().MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+		Silent:     true,
+		DropAuthor: true,
+		FromPeer:   sender,
+		ID:         []int{id},
+		RandomID:   []int64{randomId},
+		ToPeer:     &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
+	})
+	if err != nil {
+		return 0, err
+	}
+	updates, ok := res.(*tg.Updates)
+	if !ok {
+		return 0, fmt.Errorf("unexpected response type: %T", res)
+	}
+	for _, update := range updates.Updates {
+		if channelMsg, ok := update.(*tg.UpdateNewChannelMessage); ok {
+			if msg, ok := channelMsg.Message.(*tg.Message); ok && msg.ID != 0 {
+				return msg.ID, nil
+			}
+		}
+	}
+	return 0, errors.New("copied message missing from response")
+}
+
+// joinChannel makes the inbox bot an admin of the channel as the user.
+func (ib *inbox) joinChannel(ctx context.Context, userId, channelId int64) error {
+	return runWithUserClient(ctx, ib.db, &ib.cnf.TG, userId, func(ctx context.Context, client *telegram.Client, user string) error {
+		channel, err := GetChannelById(ctx, client, channelId, user)
+		if err != nil {
+			return err
+		}
+		botPeer, err := peer.DefaultResolver(client.API()).ResolveDomain(ctx, ib.self.Username)
+		if err != nil {
+			return err
+		}
+		bot, ok := botPeer.(*tg.InputPeerUser)
+		if !ok {
+			return errors.New("inbox bot is not a user")
+		}
+		return makeBotAdmin(ctx, client, channel, &tg.InputUser{UserID: bot.UserID, AccessHash: bot.AccessHash})
+	})
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// inboxListLimit is the most items a listing or search replies with, to
+	// stay under the length of a message.
+	inboxListLimit = 40
+	inboxLinkTtl   = 24 * time.Hour
+	// inboxReplyLimit is the longest text a Telegram message can hold.
+	inboxReplyLimit = 4096
+)
+
+const inboxHelp = `Send or forward a file to store it in your drive.
+
+/ls [folder] - list a folder
+/find <text> - search your drive
+/get <path or id> - get a file and its streaming link
+/rm <path or id> - move a file or folder to the trash, once confirmed with /confirm`
+
+// command runs a bot command of userId and returns the reply.
+func (ib *inbox) command(ctx context.Context, userId int64, sender tg.InputPeerClass, text string) string {
+	name, arg, _ := strings.Cut(strings.TrimSpace(text), " ")
+	name, _, _ = strings.Cut(strings.ToLower(name), "@")
+	arg = strings.TrimSpace(arg)
+
+	if name == "/start" || name == "/help" {
+		return inboxHelp
+	}
+
+	if err := ib.checkUser(ctx, userId); err != nil {
+		return err.Error()
+	}
+
+	var (
+		reply string
+		err   error
+	)
+	switch name {
+	case "/ls":
+		reply, err = ib.list(ctx, userId, arg)
+	case "/find":
+		reply, err = ib.find(ctx, userId, arg)
+	case "/get":
+		reply, err = ib.get(ctx, userId, sender, arg)
+	case "/rm":
+		reply, err = ib.remove(ctx, userId, arg)
+	case "/confirm":
+		reply, err = ib.confirmRemove(ctx, userId)
+	default:
+		return "Unknown command, see /help."
+	}
+	if err != nil {
+		ib.logger.Warnw("inbox command failed", "user", userId, "command", name, "err", err)
+		return err.Error()
+	}
+	return reply
+}
+
+func (ib *inbox) list(ctx context.Context, userId int64, dir string) (string, error) {
+	if dir == "" {
+		dir = "/"
+	}
+	dir = path.Clean("/" + dir)
+	res, appErr := ib.files.ListFiles(ctx, userId, &schemas.FileQuery{Op: "list", Path: dir, Sort: "name",
+		Order: "asc", PerPage: inboxListLimit})
+	if appErr != nil {
+		if errors.Is(appErr.Error, database.ErrNotFound) {
+			return "", fmt.Errorf("%s not found", dir)
+		}
+		return "", appErr.Error
+	}
+	if len(res.Files) == 0 {
+		return dir + " is empty", nil
+	}
+
+	var b strings.Builder
+	b.WriteString(dir)
+	for _, file := range res.Files {
+		b.WriteString("\n" + inboxEntry(file.Name, file))
+	}
+	if res.HasMore {
+		b.WriteString("\n…")
+	}
+	return b.String(), nil
+}
+
+func (ib *inbox) find(ctx context.Context, userId int64, text string) (string, error) {
+	if text == "" {
+		return "", errors.New("usage: /find <text>")
+	}
+	res, appErr := ib.files.ListFiles(ctx, userId, &schemas.FileQuery{Op: "search", Search: text, Sort: "updatedAt",
+		Order: "desc", PerPage: inboxListLimit})
+	if appErr != nil {
+		return "", appErr.Error
+	}
+	if len(res.Files) == 0 {
+		return "Nothing found", nil
+	}
+
+	var b strings.Builder
+	for i, file := range res.Files {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(inboxEntry(path.Join("/", file.ParentPath, file.Name), file))
+	}
+	return b.String(), nil
+}
+
+// get sends the documents of a file to the chat, along with a streaming link
+// when the public URL of the server is configured. Encrypted files are only
+// readable through the link.
+func (ib *inbox) get(ctx context.Context, userId int64, sender tg.InputPeerClass, arg string) (string, error) {
+	file, err := ib.lookup(ctx, userId, arg)
+	if err != nil {
+		return "", err
+	}
+	if file.Type != "file" {
+		return "", fmt.Errorf("%s is a folder, use /ls", file.Name)
+	}
+
+	var link string
+	if ib.cnf.Inbox.PublicUrl != "" {
+		link = ib.files.streamURL(ib.cnf.Inbox.PublicUrl, userId, file.ID, file.Name, inboxLinkTtl)
+	}
+
+	if file.Encrypted || file.Parts == nil || file.ChannelID == nil {
+		if link == "" {
+			return "", fmt.Errorf("%s can only be downloaded from the web app", file.Name)
+		}
+		return file.Name + "\n" + link, nil
+	}
+
+	ids := make([]int, 0, len(*file.Parts))
+	for _, part := range *file.Parts {
+		ids = append(ids, int(part.ID))
+	}
+	if err := ib.sendParts(ctx, *file.ChannelID, sender, ids); err != nil {
+		// the bot may not be an admin of the channel yet
+		if err := ib.joinChannel(ctx, userId, *file.ChannelID); err != nil {
+			return "", fmt.Errorf("add inbox bot to channel: %w", err)
+		}
+		if err := ib.sendParts(ctx, *file.ChannelID, sender, ids); err != nil {
+			return "", err
+		}
+	}
+
+	if link == "" {
+		return file.Name, nil
+	}
+	return file.Name + "\n" + link, nil
+}
+
+// remove asks to confirm the removal of an item with /confirm, which has to
+// come before inboxRemovals expires.
+func (ib *inbox) remove(ctx context.Context, userId int64, arg string) (string, error) {
+	if err := ib.paused(); err != nil {
+		return "", err
+	}
+	file, err := ib.lookup(ctx, userId, arg)
+	if err != nil {
+		return "", err
+	}
+	if err := inboxRemovals.Set(ctx, inboxRemovals.Key(userId), file.ID); err != nil {
+		return "", err
+	}
+	action := "move " + file.Name + " to the trash"
+	if ib.files.trashRetention <= 0 {
+		action = "delete " + file.Name + " for good"
+	}
+	return "Send /confirm within two minutes to " + action + ".", nil
+}
+
+func (ib *inbox) confirmRemove(ctx context.Context, userId int64) (string, error) {
+	if err := ib.paused(); err != nil {
+		return "", err
+	}
+	key := inboxRemovals.Key(userId)
+	id, ok := inboxRemovals.Get(ctx, key)
+	if !ok {
+		return "", errors.New("nothing to confirm, send /rm first")
+	}
+	inboxRemovals.Delete(ctx, key)
+	file, err := ib.lookup(ctx, userId, id)
+	if err != nil {
+		return "", err
+	}
+	msg, job, appErr := ib.files.DeleteFiles(ctx, userId, &schemas.FileOperation{Files: []string{file.ID}})
+	if appErr != nil {
+		return "", appErr.Error
+	}
+	if job != nil {
+		return "Deleting " + file.Name + " in the background", nil
+	}
+	return msg.Message + ": " + file.Name, nil
+}
+
+// lookup finds an active item of userId by its id or its absolute path.
+func (ib *inbox) lookup(ctx context.Context, userId int64, arg string) (*models.File, error) {
+	if arg == "" {
+		return nil, errors.New("a path or an id is required")
+	}
+
+	query := ib.db.WithContext(ctx).Where("user_id = ?", userId).Where("status = ?", "active")
+	if strings.HasPrefix(arg, "/") {
+		arg = path.Clean(arg)
+		dir, name := path.Split(arg)
+		if name == "" {
+			return nil, errors.New("the root folder cannot be used")
+		}
+		parentId, err := ib.files.getPathId(ctx, path.Clean(dir), userId)
+		if err != nil {
+			return nil, fmt.Errorf("%s not found", arg)
+		}
+		query = query.Where("parent_id = ?", parentId).Where("name = ?", name)
+	} else {
+		query = query.Where("id = ?", arg)
+	}
+
+	var file models.File
+	if err := query.First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, fmt.Errorf("%s not found", arg)
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// sendParts forwards the messages ids of the channel to the chat without their
+// author.
+func (ib *inbox) sendParts(ctx context.Context, channelId int64, to tg.InputPeerClass, ids []int) error {
+	channel, err := GetChannelById(ctx, ib.client, channelId, strconv.FormatInt(ib.self.ID, 10))
+	if err != nil {
+		return err
+	}
+	for _, batch := range chunks(ids, 100) {
+		randomIds := make([]int64, len(batch))
+		for i := range randomIds {
+			if randomIds[i], err = randInt64(); err != nil {
+				return err
+			}
+		}
+		if _, err := ib.client.API().MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+			DropAuthor: true,
+			FromPeer:   &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
+			ID:         batch,
+			RandomID:   randomIds,
+			ToPeer:     to,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inboxEntry(name string, file schemas.FileOut) string {
+	if file.Type == "folder" {
+		return "📁 " + name + "/"
+	}
+	return fmt.Sprintf("%s (%s) · %s", name, formatSize(file.Size), file.ID)
+}
+
+// splitReply cuts text into messages Telegram accepts, at line breaks where
+// it can. Lengths are counted in UTF-16 code units, as Telegram does.
+func splitReply(text string) []string {
+	var parts []string
+	for utf16Len(text) > inboxReplyLimit {
+		end, size := 0, 0
+		for i, r := range text {
+			size += utf16Units(r)
+			if size > inboxReplyLimit {
+				end = i
+				break
+			}
+		}
+		if nl := strings.LastIndexByte(text[:end], '\n'); nl > 0 {
+			end = nl + 1
+		}
+		parts = append(parts, text[:end])
+		text = text[end:]
+	}
+	return append(parts, text)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16Units(r)
+	}
+	return n
+}
+
+func utf16Units(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// maxIndexEntries bounds the items a folder index lists.
+const maxIndexEntries = 20000
+
+// indexTreeQuery selects the visible files and folders below a folder, with
+// their paths relative to it.
+const indexTreeQuery = `
+WITH RECURSIVE tree AS (
+	SELECT id, type, name, size, updated_at, name::text AS rel FROM teldrive.files
+	WHERE parent_id = ? AND user_id = ? AND status = 'active' AND NOT hidden AND type IN ('file', 'folder')
+	UNION ALL
+	SELECT f.id, f.type, f.name, f.size, f.updated_at, t.rel || '/' || f.name FROM teldrive.files f
+	JOIN tree t ON f.parent_id = t.id
+	WHERE t.type = 'folder' AND f.status = 'active' AND NOT f.hidden AND f.type IN ('file', 'folder')
+)
+SELECT id, type, name, size, updated_at, rel FROM tree ORDER BY rel LIMIT ?`
+
+var errIndexTooLarge = fmt.Errorf("folder has more than %d items to index", maxIndexEntries)
+
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{"size": formatSize}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<style>
+body{font-family:system-ui,sans-serif;margin:2rem auto;max-width:60rem;padding:0 1rem;color:#222}
+table{border-collapse:collapse;width:100%}
+th,td{padding:.3rem .6rem;text-align:left;border-bottom:1px solid #ddd}
+td.size,th.size{text-align:right;white-space:nowrap}
+tr.folder td{font-weight:600}
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>{{.Files}} files in {{.Folders}} folders, {{size .Size}}, generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}</p>
+<table>
+<tr><th>Path</th><th class="size">Size</th><th>Modified</th></tr>
+{{- range .Entries}}
+<tr class="{{.Type}}"><td>{{if .URL}}<a href="{{.URL}}">{{.Path}}</a>{{else}}{{.Path}}{{if eq .Type "folder"}}/{{end}}{{end}}</td><td class="size">{{if eq .Type "file"}}{{size .Size}}{{end}}</td><td>{{.UpdatedAt.Format "2006-01-02"}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// ExportIndex writes a static index of a folder of the user as JSON or HTML,
+// giving each file a share link when asked to. Links are only made through
+// POST, so reads cannot create them.
+func (fs *FileService) ExportIndex(c *gin.Context) {
+	userId, _ := GetUserAuth(c)
+
+	var query schemas.IndexQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Links && c.Request.Method != http.MethodPost {
+		http.Error(c.Writer, "share links are only made with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if query.ExpiresAt != nil && !query.ExpiresAt.After(time.Now()) {
+		http.Error(c.Writer, "expiry must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	var folder models.File
+	if err := fs.db.WithContext(c).Where("id = ?", c.Param("fileID")).Where("user_id = ?", userId).
+		Where("type = ?", "folder").Where("status = ?", "active").First(&folder).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			http.Error(c.Writer, database.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	index, err := fs.folderIndex(c, userId, &folder, &query)
+	if errors.Is(err, errIndexTooLarge) {
+		http.Error(c.Writer, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, errNoPublicURL) {
+		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contentType, ext := "application/json", "json"
+	if query.Format == "html" {
+		contentType, ext = "text/html", "html"
+	}
+
+	c.Header("Content-Type", contentType+"; charset=utf-8")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": folder.Name + "-index." + ext}))
+	c.Status(http.StatusOK)
+
+	if query.Format == "html" {
+		indexTemplate.Execute(c.Writer, index)
+		return
+	}
+	enc := json.NewEncoder(c.Writer)
+	enc.SetIndent("", "  ")
+	enc.Encode(index)
+}
+
+func (fs *FileService) folderIndex(c *gin.Context, userId int64, folder *models.File, query *schemas.IndexQuery) (*schemas.FolderIndex, error) {
+	var rows []struct {
+		ID        string
+		Type      string
+		Name      string
+		Size      *int64
+		UpdatedAt time.Time
+		Rel       string
+	}
+	if err := fs.db.WithContext(c).Raw(indexTreeQuery, folder.ID, userId, maxIndexEntries+1).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) > maxIndexEntries {
+		return nil, errIndexTooLarge
+	}
+
+	index := &schemas.FolderIndex{Name: folder.Name, GeneratedAt: time.Now().UTC(),
+		Entries: make([]schemas.IndexEntry, 0, len(rows))}
+	var ids []string
+	for _, row := range rows {
+		entry := schemas.IndexEntry{Path: row.Rel, Type: row.Type, UpdatedAt: row.UpdatedAt}
+		if row.Type == "folder" {
+			index.Folders++
+		} else {
+			index.Files++
+			if row.Size != nil {
+				entry.Size = *row.Size
+				index.Size += *row.Size
+			}
+			ids = append(ids, row.ID)
+		}
+		index.Entries = append(index.Entries, entry)
+	}
+
+	if !query.Links || len(ids) == 0 {
+		return index, nil
+	}
+	baseURL, err := requestBaseURL(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt *time.Time
+	if query.ExpiresAt != nil {
+		t := query.ExpiresAt.UTC()
+		expiresAt = &t
+	}
+
+	// files keep the plain links of earlier indexes with the same expiry, so
+	// exporting again does not pile up links
+	linkIds := make(map[string]string, len(ids))
+	for _, batch := range chunks(ids, 5000) {
+		var existing []models.ShareLink
+		tx := fs.db.WithContext(c).Where("file_id IN ?", batch).Where("owner_id = ?", userId).
+			Where("coalesce(max_downloads, 0) = 0").Where("coalesce(rate_limit, 0) = 0")
+		if expiresAt != nil {
+			tx = tx.Where("expires_at = ?", *expiresAt)
+		} else {
+			tx = tx.Where("expires_at IS NULL")
+		}
+		if err := tx.Order("created_at").Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		for _, link := range existing {
+			if linkIds[link.FileID] == "" {
+				linkIds[link.FileID] = link.ID
+			}
+		}
+	}
+
+	var links []models.ShareLink
+	for _, id := range ids {
+		if linkIds[id] == "" {
+			links = append(links, models.ShareLink{FileID: id, OwnerID: userId, ExpiresAt: expiresAt})
+		}
+	}
+
+	// the links are made in one transaction, so a failed index leaves none behind
+	if len(links) > 0 {
+		if err := fs.db.WithContext(c).Clauses(clause.Returning{}).CreateInBatches(&links, 500).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, link := range links {
+		linkIds[link.FileID] = link.ID
+	}
+	for i, row := range rows {
+		if linkId := linkIds[row.ID]; linkId != "" {
+			index.Entries[i].URL = shareLinkURL(baseURL, &models.File{ID: row.ID, Name: row.Name}, linkId)
+		}
+	}
+	return index, nil
+}
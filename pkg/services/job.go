@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+const (
+	maxConcurrentJobs   = 2
+	jobProgressInterval = time.Second
+)
+
+var (
+	errJobInterrupted = errors.New("job interrupted by server restart")
+	errJobBusy        = errors.New("job already running")
+)
+
+// JobHandler runs a background job and returns a JSON serializable result.
+type JobHandler func(ctx context.Context, run *JobRun) (any, error)
+
+// JobRun is the handle passed to a JobHandler for reading its payload and
+// reporting progress.
+type JobRun struct {
+	ID     string
+	UserID int64
+
+	payload    string
+	db         *gorm.DB
+	mu         sync.Mutex
+	lastReport time.Time
+}
+
+func (r *JobRun) Payload(v any) error {
+	return json.Unmarshal([]byte(r.payload), v)
+}
+
+// Progress records how much work is done. Updates are throttled so handlers can
+// call it as often as they like.
+func (r *JobRun) Progress(done, total int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if done < total && time.Since(r.lastReport) < jobProgressInterval {
+		return
+	}
+	r.lastReport = time.Now()
+	r.db.Model(&models.Job{}).Where("id = ?", r.ID).
+		Updates(map[string]any{"progress": done, "total": total, "updated_at": time.Now().UTC()})
+}
+
+type JobService struct {
+	db       *gorm.DB
+	handlers map[string]JobHandler
+	sem      chan struct{}
+	ctx      context.Context
+	mu       sync.Mutex
+	running  map[string]context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewJobService(lc fx.Lifecycle, db *gorm.DB) *JobService {
+	ctx, cancel := context.WithCancel(context.Background())
+	js := &JobService{
+		db:       db,
+		handlers: make(map[string]JobHandler),
+		sem:      make(chan struct{}, maxConcurrentJobs),
+		ctx:      ctx,
+		running:  make(map[string]context.CancelFunc),
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return js.db.WithContext(ctx).Model(&models.Job{}).
+				Where("status in ?", []string{JobPending, JobRunning}).
+				Updates(map[string]any{"status": JobFailed, "error": errJobInterrupted.Error(),
+					"finished_at": time.Now().UTC()}).Error
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			js.wg.Wait()
+			return nil
+		},
+	})
+	return js
+}
+
+// Register adds a handler for a job type. It must be called before any job of
+// that type is submitted.
+func (js *JobService) Register(jobType string, handler JobHandler) {
+	js.handlers[jobType] = handler
+}
+
+func (js *JobService) Submit(ctx context.Context, userId int64, jobType string, payload any) (*schemas.JobOut, *types.AppError) {
+	handler, ok := js.handlers[jobType]
+	if !ok {
+		return nil, &types.AppError{Error: fmt.Errorf("unknown job type %q", jobType), Code: http.StatusBadRequest}
+	}
+
+	job, err := js.create(ctx, userId, jobType, payload, "")
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return js.start(job, handler), nil
+}
+
+// SubmitExclusive is Submit for job types a user runs one at a time. It fails
+// with busy while a job of the type is pending or running; the check and the
+// insert are made under a lock, so concurrent requests cannot both pass it.
+func (js *JobService) SubmitExclusive(ctx context.Context, userId int64, jobType string, payload any, busy string) (*schemas.JobOut, *types.AppError) {
+	handler, ok := js.handlers[jobType]
+	if !ok {
+		return nil, &types.AppError{Error: fmt.Errorf("unknown job type %q", jobType), Code: http.StatusBadRequest}
+	}
+
+	job, err := js.create(ctx, userId, jobType, payload, busy)
+	if errors.Is(err, errJobBusy) {
+		return nil, &types.AppError{Error: errors.New(busy), Code: http.StatusConflict}
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return js.start(job, handler), nil
+}
+
+func (js *JobService) start(job *models.Job, handler JobHandler) *schemas.JobOut {
+	jobCtx, cancel := context.WithCancel(js.ctx)
+
+	js.mu.Lock()
+	js.running[job.ID] = cancel
+	js.mu.Unlock()
+
+	js.wg.Add(1)
+	go js.run(jobCtx, job, handler)
+
+	return mapper.ToJobOut(job)
+}
+
+// Run executes a job in the foreground and returns its result. It is meant for
+// the command line, the job is recorded like any other.
+func (js *JobService) Run(ctx context.Context, userId int64, jobType string, payload any) (any, error) {
+	handler, ok := js.handlers[jobType]
+	if !ok {
+		return nil, fmt.Errorf("unknown job type %q", jobType)
+	}
+
+	job, err := js.create(ctx, userId, jobType, payload, "")
+	if err != nil {
+		return nil, err
+	}
+
+	js.db.Model(&models.Job{}).Where("id = ?", job.ID).
+		Updates(map[string]any{"status": JobRunning, "updated_at": time.Now().UTC()})
+
+	run := &JobRun{ID: job.ID, UserID: job.UserID, payload: job.Payload, db: js.db}
+
+	result, err := handler(ctx, run)
+	js.finish(job.ID, result, err)
+	return result, err
+}
+
+// create records a pending job. Exclusive jobs, those with a busy message,
+// are only recorded when the user has none of the type pending or running.
+func (js *JobService) create(ctx context.Context, userId int64, jobType string, payload any, busy string) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.Job{UserID: userId, Type: jobType, Status: JobPending, Payload: string(data)}
+
+	err = js.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if busy != "" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))",
+				fmt.Sprintf("job:%d:%s", userId, jobType)).Error; err != nil {
+				return err
+			}
+			var count int64
+			if err := tx.Model(&models.Job{}).Where("user_id = ?", userId).Where("type = ?", jobType).
+				Where("status IN ?", []string{JobPending, JobRunning}).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return errJobBusy
+			}
+		}
+		return tx.Create(job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (js *JobService) run(ctx context.Context, job *models.Job, handler JobHandler) {
+	defer func() {
+		js.mu.Lock()
+		if cancel, ok := js.running[job.ID]; ok {
+			cancel()
+			delete(js.running, job.ID)
+		}
+		js.mu.Unlock()
+		js.wg.Done()
+	}()
+
+	logger := logging.DefaultLogger().With("jobId", job.ID, "type", job.Type)
+
+	select {
+	case js.sem <- struct{}{}:
+		defer func() { <-js.sem }()
+	case <-ctx.Done():
+		js.finish(job.ID, nil, ctx.Err())
+		return
+	}
+
+	js.db.Model(&models.Job{}).Where("id = ?", job.ID).
+		Updates(map[string]any{"status": JobRunning, "updated_at": time.Now().UTC()})
+
+	run := &JobRun{ID: job.ID, UserID: job.UserID, payload: job.Payload, db: js.db}
+
+	result, err := handler(ctx, run)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		logger.Errorw("job failed", "err", err)
+	} else {
+		logger.Debugw("job completed")
+	}
+	js.finish(job.ID, result, err)
+}
+
+func (js *JobService) finish(id string, result any, err error) {
+	update := map[string]any{"finished_at": time.Now().UTC(), "updated_at": time.Now().UTC()}
+	switch {
+	case errors.Is(err, context.Canceled):
+		update["status"] = JobCancelled
+	case err != nil:
+		update["status"] = JobFailed
+		update["error"] = err.Error()
+	default:
+		update["status"] = JobCompleted
+	}
+	if result != nil {
+		if data, err := json.Marshal(result); err == nil {
+			update["result"] = string(data)
+		}
+	}
+	js.db.Model(&models.Job{}).Where("id = ?", id).Updates(update)
+}
+
+func (js *JobService) ListJobs(ctx context.Context, userId int64, query *schemas.JobQuery) ([]schemas.JobOut, *types.AppError) {
+	var jobs []models.Job
+
+	tx := js.db.WithContext(ctx).Where("user_id = ?", userId)
+	if query.Type != "" {
+		tx = tx.Where("type = ?", query.Type)
+	}
+	if query.Status != "" {
+		tx = tx.Where("status = ?", query.Status)
+	}
+
+	if err := tx.Order("created_at desc").Limit(100).Find(&jobs).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := []schemas.JobOut{}
+	for i := range jobs {
+		res = append(res, *mapper.ToJobOut(&jobs[i]))
+	}
+	return res, nil
+}
+
+func (js *JobService) GetJob(ctx context.Context, userId int64, id string) (*schemas.JobOut, *types.AppError) {
+	var job models.Job
+	if err := js.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &types.AppError{Error: errors.New("job not found"), Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return mapper.ToJobOut(&job), nil
+}
+
+func (js *JobService) CancelJob(ctx context.Context, userId int64, id string) (*schemas.Message, *types.AppError) {
+	if _, err := js.GetJob(ctx, userId, id); err != nil {
+		return nil, err
+	}
+
+	js.mu.Lock()
+	cancel, ok := js.running[id]
+	js.mu.Unlock()
+
+	if !ok {
+		return nil, &types.AppError{Error: errors.New("job is not running"), Code: http.StatusConflict}
+	}
+	cancel()
+	return &schemas.Message{Message: "job cancelled"}, nil
+}
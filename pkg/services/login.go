@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/alert"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+)
+
+// checkLocked answers 429 when any of keys is locked out after repeated failures.
+func (as *AuthService) checkLocked(c *gin.Context, keys ...string) *types.AppError {
+	wait := as.guard.Locked(keys...)
+	if wait == 0 {
+		return nil
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return &types.AppError{Error: lockedError(wait), Code: http.StatusTooManyRequests}
+}
+
+// loginFailed records a failed attempt for keys and alerts when it locks any of them out.
+func (as *AuthService) loginFailed(c *gin.Context, reason string, keys ...string) {
+	locked, wait := as.guard.Fail(keys...)
+	if len(locked) == 0 {
+		return
+	}
+	logging.FromContext(c).Warnw("login locked out", "keys", locked, "reason", reason, "lockout", wait)
+	as.alerts.Notify(alert.Event{
+		Type:    "login_lockout",
+		Message: "Repeated failed logins, access locked",
+		Fields: map[string]string{
+			"ip":      c.ClientIP(),
+			"keys":    strings.Join(locked, ", "),
+			"reason":  reason,
+			"lockout": wait.String(),
+		},
+	})
+}
+
+// recordLogin stores a successful login and alerts when it comes from a
+// country or network the user has not logged in from before.
+func (as *AuthService) recordLogin(c *gin.Context, userId int64, userName string) {
+	login := models.Login{UserID: userId, IP: c.ClientIP()}
+	login.Network = loginNetwork(login.IP)
+	if as.cnf.Login.CountryHeader != "" {
+		login.Country = strings.ToUpper(strings.TrimSpace(c.GetHeader(as.cnf.Login.CountryHeader)))
+	}
+
+	var seen struct {
+		Total   int64
+		Network int64
+		Country int64
+	}
+	err := as.db.WithContext(c).Model(&models.Login{}).
+		Select("count(*) as total, count(*) filter (where network = ?) as network, count(*) filter (where country = ?) as country",
+			login.Network, login.Country).
+		Where("user_id = ?", userId).Scan(&seen).Error
+	if err != nil {
+		logging.FromContext(c).Warnw("failed to load login history", "err", err)
+		return
+	}
+
+	if err := as.db.WithContext(c).Create(&login).Error; err != nil {
+		logging.FromContext(c).Warnw("failed to record login", "err", err)
+		return
+	}
+
+	if seen.Total == 0 {
+		return
+	}
+	var reasons []string
+	if login.Country != "" && seen.Country == 0 {
+		reasons = append(reasons, "new country")
+	}
+	if seen.Network == 0 {
+		reasons = append(reasons, "new network")
+	}
+	if len(reasons) == 0 {
+		return
+	}
+	as.alerts.Notify(alert.Event{
+		Type:    "login_anomaly",
+		Message: fmt.Sprintf("Login from %s", strings.Join(reasons, " and ")),
+		Fields: map[string]string{
+			"user":    userName,
+			"ip":      login.IP,
+			"country": login.Country,
+			"agent":   c.Request.UserAgent(),
+		},
+	})
+}
+
+// loginNetwork returns the /24 (IPv4) or /48 (IPv6) network of ip, so that
+// address changes within the same provider network are not reported.
+func loginNetwork(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: addr.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+type lockedError time.Duration
+
+func (e lockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, retry in %s", time.Duration(e).Round(time.Second))
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/kv"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+)
+
+const (
+	maintenanceKey        = "maintenance"
+	maintenanceRetryAfter = 5 * time.Minute
+)
+
+// Maintenance keeps the API read-only while an admin migrates the database or
+// works on channels: listings and streams go on, changes are turned away and
+// the cleanup jobs wait. The state is kept in the kv store so a restart in the
+// middle of the work does not end it.
+type Maintenance struct {
+	kv    kv.KV
+	state atomic.Pointer[schemas.Maintenance]
+}
+
+func NewMaintenance(KV kv.KV) *Maintenance {
+	m := &Maintenance{kv: KV}
+	state := &schemas.Maintenance{}
+	b, err := KV.Get(maintenanceKey)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, state); err != nil {
+			logging.DefaultLogger().Warnw("ignoring unreadable maintenance state", "err", err)
+			state = &schemas.Maintenance{}
+		}
+	case !errors.Is(err, kv.ErrNotFound):
+		logging.DefaultLogger().Warnw("failed to load maintenance state", "err", err)
+	}
+	m.state.Store(state)
+	return m
+}
+
+// Active tells whether maintenance is on, with the message and the wait told
+// to clients.
+func (m *Maintenance) Active() (bool, string, time.Duration) {
+	if m == nil {
+		return false, "", 0
+	}
+	state := m.state.Load()
+	if !state.Enabled {
+		return false, "", 0
+	}
+	if state.RetryAfter > 0 {
+		return true, state.Message, time.Duration(state.RetryAfter) * time.Second
+	}
+	return true, state.Message, maintenanceRetryAfter
+}
+
+func (m *Maintenance) State() *schemas.Maintenance {
+	state := *m.state.Load()
+	return &state
+}
+
+func (m *Maintenance) set(in *schemas.Maintenance) (*schemas.Maintenance, error) {
+	state := &schemas.Maintenance{Enabled: in.Enabled}
+	if in.Enabled {
+		state.Message, state.RetryAfter = in.Message, in.RetryAfter
+		// turning it on again keeps when it started
+		if current := m.state.Load(); current.Enabled {
+			state.Since = current.Since
+		} else {
+			now := time.Now().UTC()
+			state.Since = &now
+		}
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.kv.Set(maintenanceKey, b); err != nil {
+		return nil, err
+	}
+	m.state.Store(state)
+	return state, nil
+}
+
+func (as *AdminService) GetMaintenance(ctx context.Context) (*schemas.Maintenance, *types.AppError) {
+	return as.maintenance.State(), nil
+}
+
+// SetMaintenance turns maintenance on or off. It stops every change on the
+// instance, so only the users listed in access-admins may call it, and nobody
+// when the list is empty.
+func (as *AdminService) SetMaintenance(ctx context.Context, userId int64, in *schemas.Maintenance) (*schemas.Maintenance, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	state, err := as.maintenance.set(in)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	logging.FromContext(ctx).Infow("maintenance mode changed", "enabled", state.Enabled, "user", userId)
+	return state, nil
+}
+
+// MaintenanceActive reports the maintenance state to the middleware guarding
+// the API.
+func (as *AdminService) MaintenanceActive() (bool, string, time.Duration) {
+	if as == nil {
+		return false, "", 0
+	}
+	return as.maintenance.Active()
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"io"
+
+	"github.com/divyam234/teldrive/internal/sniff"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"gorm.io/gorm"
+)
+
+const JobSniffMime = "files.mime"
+
+const mimeBatchSize = 100
+
+func (fs *FileService) RepairMimeTypes(ctx context.Context, userId int64) (*schemas.JobOut, *types.AppError) {
+	return fs.jobs.SubmitExclusive(ctx, userId, JobSniffMime, struct{}{}, "mime repair already running")
+}
+
+func (fs *FileService) sniffableFiles(ctx context.Context, userId int64) *gorm.DB {
+	return fs.db.WithContext(ctx).Model(&models.File{}).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").Where("parts IS NOT NULL")
+}
+
+// repairMimeTypes re-detects the mime type of every file from its first bytes
+// and fixes the ones the client got wrong at upload time.
+func (fs *FileService) repairMimeTypes(ctx context.Context, run *JobRun) (any, error) {
+	var total int64
+	if err := fs.sniffableFiles(ctx, run.UserID).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	result := &schemas.MimeResult{}
+
+	if total == 0 {
+		return result, nil
+	}
+
+	run.Progress(0, total)
+
+	err := runWithUserClient(ctx, fs.db, fs.cnf, run.UserID, func(ctx context.Context, client *telegram.Client, user string) error {
+		lastId := ""
+		for {
+			var files []models.File
+			if err := fs.sniffableFiles(ctx, run.UserID).Where("id > ?", lastId).Order("id").
+				Limit(mimeBatchSize).Find(&files).Error; err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				return nil
+			}
+
+			for _, file := range files {
+				lastId = file.ID
+
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				result.Checked++
+				mimeType, err := fs.sniffFile(ctx, client, file, user)
+				if err == nil && mimeType != file.MimeType {
+					err = fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).
+						UpdateColumn("mime_type", mimeType).Error
+					if err == nil {
+						result.Updated++
+					}
+				}
+				if err != nil {
+					result.Failed++
+					if len(result.Errors) < maxDeleteErrors {
+						result.Errors = append(result.Errors, file.Name+": "+err.Error())
+					}
+				}
+				run.Progress(int64(result.Checked), total)
+			}
+		}
+	})
+
+	return result, err
+}
+
+func (fs *FileService) sniffFile(ctx context.Context, client *telegram.Client, file models.File, user string) (string, error) {
+	src := mapper.ToFileOutFull(file)
+	if src.Size == 0 {
+		return sniff.Detect(file.Name, nil), nil
+	}
+
+	r, err := newFileReader(ctx, client, fs.cnf, src, 0, min(src.Size, sniff.Len)-1, user)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	head, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return sniff.Detect(file.Name, head), nil
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/tg"
+)
+
+var errNotMember = errors.New("not a member of the channel")
+
+// CreateMount attaches a channel the user is a member of. Nothing is copied,
+// listings and streams read the channel as the user.
+func (fs *FileService) CreateMount(c *gin.Context, userId int64, in *schemas.MountIn) (*schemas.MountOut, *types.AppError) {
+	_, session := GetUserAuth(c)
+
+	client, _ := tgc.AuthClient(c, fs.cnf, session)
+
+	var title string
+	err := tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
+		res, err := client.API().ChannelsGetChannels(ctx, []tg.InputChannelClass{&tg.InputChannel{ChannelID: in.ChannelID}})
+		if err != nil {
+			return err
+		}
+		if len(res.GetChats()) == 0 {
+			return errNotMember
+		}
+		channel, ok := res.GetChats()[0].(*tg.Channel)
+		if !ok || channel.Left {
+			return errNotMember
+		}
+		title = channel.Title
+		return nil
+	})
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
+	}
+
+	mount := &models.Mount{UserID: userId, ChannelID: in.ChannelID, Name: in.Name}
+	if mount.Name == "" {
+		mount.Name = title
+	}
+	if err := fs.db.WithContext(c).Create(mount).Error; err != nil {
+		if database.IsKeyConflictErr(err) {
+			return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return mapper.ToMountOut(mount), nil
+}
+
+func (fs *FileService) ListMounts(ctx context.Context, userId int64) ([]schemas.MountOut, *types.AppError) {
+	var mounts []models.Mount
+	if err := fs.db.WithContext(ctx).Where("user_id = ?", userId).Order("name").Find(&mounts).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res := make([]schemas.MountOut, 0, len(mounts))
+	for i := range mounts {
+		res = append(res, *mapper.ToMountOut(&mounts[i]))
+	}
+	return res, nil
+}
+
+func (fs *FileService) DeleteMount(ctx context.Context, userId int64, id string) (*schemas.Message, *types.AppError) {
+	res := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).Delete(&models.Mount{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "mount deleted"}, nil
+}
+
+func (fs *FileService) mount(ctx context.Context, userId int64, id string) (*models.Mount, *types.AppError) {
+	var mount models.Mount
+	if err := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).First(&mount).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return &mount, nil
+}
+
+// ListMountFiles lists a page of the documents in the history of a mounted
+// channel. Pages are cached for a few minutes, so new posts show up late.
+func (fs *FileService) ListMountFiles(c *gin.Context, userId int64, id string, query *schemas.MountQuery) (*schemas.MountListing, *types.AppError) {
+	mount, appErr := fs.mount(c, userId, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	_, session := GetUserAuth(c)
+
+	key := mountCache.Key(mount.ChannelID, query.OffsetID, query.PerPage)
+	listing, err := mountCache.Fetch(c, key, func(ctx context.Context) (schemas.MountListing, error) {
+		listing := schemas.MountListing{Files: []schemas.FileOut{}}
+		client, _ := tgc.AuthClient(ctx, fs.cnf, session)
+		err := tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+			channel, err := GetChannelById(ctx, client, mount.ChannelID, strconv.FormatInt(userId, 10))
+			if err != nil {
+				return err
+			}
+			res, err := client.API().MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+				Peer:     &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
+				OffsetID: query.OffsetID,
+				Limit:    query.PerPage,
+			})
+			if err != nil {
+				return err
+			}
+			history, ok := res.(*tg.MessagesChannelMessages)
+			if !ok {
+				return fmt.Errorf("unexpected response type: %T", res)
+			}
+			for _, message := range history.Messages {
+				msg, ok := message.(*tg.Message)
+				if !ok {
+					continue
+				}
+				if file, ok := importedFile(msg); ok {
+					out := mapper.ToFileOut(*file)
+					out.ID = strconv.Itoa(msg.ID)
+					listing.Files = append(listing.Files, *out)
+				}
+			}
+			// a full page means older messages may follow
+			if len(history.Messages) == query.PerPage {
+				listing.NextOffsetID = history.Messages[len(history.Messages)-1].GetID()
+			}
+			return nil
+		})
+		return listing, err
+	})
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &listing, nil
+}
+
+// GetMountFileStream streams the document of a message in a mounted channel.
+// Bots are not members of such channels, so it is always read as the user.
+func (fs *FileService) GetMountFileStream(c *gin.Context) {
+	userId, session := GetUserAuth(c)
+
+	mount, appErr := fs.mount(c, userId, c.Param("mountID"))
+	if appErr != nil {
+		http.Error(c.Writer, appErr.Error.Error(), appErr.Code)
+		return
+	}
+	msgId, err := strconv.Atoi(c.Param("messageID"))
+	if err != nil {
+		http.Error(c.Writer, "invalid message id", http.StatusBadRequest)
+		return
+	}
+
+	key := mountFileCache.Key(mount.ChannelID, msgId)
+	out, err := mountFileCache.Fetch(c, key, func(ctx context.Context) (schemas.FileOut, error) {
+		var out schemas.FileOut
+		client, _ := tgc.AuthClient(ctx, fs.cnf, session)
+		err := tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+			messages, err := getTGMessages(ctx, client, []schemas.Part{{ID: int64(msgId)}}, mount.ChannelID,
+				strconv.FormatInt(userId, 10))
+			if err != nil {
+				return err
+			}
+			if len(messages) == 0 {
+				return database.ErrNotFound
+			}
+			msg, ok := messages[0].(*tg.Message)
+			if !ok {
+				return database.ErrNotFound
+			}
+			file, ok := importedFile(msg)
+			if !ok {
+				return database.ErrNotFound
+			}
+			out = *mapper.ToFileOut(*file)
+			// parts of mounted files are cached under the channel and message
+			out.ID = fmt.Sprintf("%d:%d", mount.ChannelID, msgId)
+			return nil
+		})
+		return out, err
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(c.Writer, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	file := &schemas.FileOutFull{FileOut: &out, Parts: []schemas.Part{{ID: int64(msgId)}}, ChannelID: mount.ChannelID}
+	fs.serveFile(c, &models.Session{UserId: userId, Session: session}, nil, file, true)
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/alert"
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Events users opt in to, named after their column in notification_settings.
+const (
+	notifyShareAccessed   = "share_accessed"
+	notifyStorageFull     = "storage_full"
+	notifyImportFinished  = "import_finished"
+	notifyIntegrityFailed = "integrity_failed"
+)
+
+const notifyTimeout = 10 * time.Second
+
+// storageWarnRatio is how much of their storage limit users fill before they
+// are warned.
+const storageWarnRatio = 0.9
+
+const storageUsageQuery = `
+SELECT n.user_id, n.storage_limit, n.storage_alerted, COALESCE(SUM(f.size), 0) AS used
+FROM teldrive.notification_settings n
+LEFT JOIN teldrive.files f ON f.user_id = n.user_id AND f.type = 'file'
+WHERE n.storage_full AND n.storage_limit > 0
+GROUP BY n.user_id, n.storage_limit, n.storage_alerted`
+
+var errNotifyDisabled = errors.New("notifications are not enabled on this server")
+
+// Notifier messages users through the notification bot about the events they
+// opted in to. Delivery failures are only logged, most often the user never
+// started a chat with the bot.
+type Notifier struct {
+	db     *gorm.DB
+	token  string
+	client *http.Client
+}
+
+func NewNotifier(db *gorm.DB, cnf *config.Config) *Notifier {
+	return &Notifier{db: db, token: cnf.Notify.BotToken, client: &http.Client{Timeout: notifyTimeout}}
+}
+
+func (n *Notifier) Enabled() bool {
+	return n != nil && n.token != ""
+}
+
+// Notify sends text to userId in the background when they opted in to event.
+func (n *Notifier) Notify(userId int64, event, text string) {
+	if !n.Enabled() {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		var count int64
+		if err := n.db.WithContext(ctx).Model(&models.NotificationSetting{}).Where("user_id = ?", userId).
+			Where(event+" = ?", true).Count(&count).Error; err != nil || count == 0 {
+			return
+		}
+		if err := alert.SendTelegram(ctx, n.client, n.token, userId, text); err != nil {
+			logging.DefaultLogger().Warnw("failed to send notification", "user", userId, "event", event, "err", err)
+		}
+	}()
+}
+
+// CheckStorage warns the users who opted in once their files fill most of the
+// storage limit they set. They are warned again only after going back under.
+func (n *Notifier) CheckStorage(ctx context.Context) error {
+	if !n.Enabled() {
+		return nil
+	}
+
+	var rows []struct {
+		UserID         int64
+		StorageLimit   int64
+		StorageAlerted bool
+		Used           int64
+	}
+	if err := n.db.WithContext(ctx).Raw(storageUsageQuery).Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		full := float64(row.Used) >= storageWarnRatio*float64(row.StorageLimit)
+		if full == row.StorageAlerted {
+			continue
+		}
+		if full {
+			text := fmt.Sprintf("Your drive holds %s of the %s you set as your storage limit.",
+				formatSize(row.Used), formatSize(row.StorageLimit))
+			if err := alert.SendTelegram(ctx, n.client, n.token, row.UserID, text); err != nil {
+				logging.DefaultLogger().Warnw("failed to send notification", "user", row.UserID,
+					"event", notifyStorageFull, "err", err)
+				continue
+			}
+		}
+		if err := n.db.WithContext(ctx).Model(&models.NotificationSetting{}).Where("user_id = ?", row.UserID).
+			Update("storage_alerted", full).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (us *UserService) GetNotificationSettings(c *gin.Context) (*schemas.NotificationSettings, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	var setting models.NotificationSetting
+	if err := us.db.WithContext(c).Where("user_id = ?", userId).Limit(1).Find(&setting).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.NotificationSettings{ShareAccessed: setting.ShareAccessed, StorageFull: setting.StorageFull,
+		ImportFinished: setting.ImportFinished, IntegrityFailed: setting.IntegrityFailed,
+		StorageLimit: setting.StorageLimit, Available: us.notifier.Enabled()}, nil
+}
+
+func (us *UserService) UpdateNotificationSettings(c *gin.Context) (*schemas.NotificationSettings, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	var payload schemas.NotificationSettings
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	setting := &models.NotificationSetting{UserID: userId, ShareAccessed: payload.ShareAccessed,
+		StorageFull: payload.StorageFull, ImportFinished: payload.ImportFinished,
+		IntegrityFailed: payload.IntegrityFailed, StorageLimit: payload.StorageLimit}
+
+	// a new limit is checked from scratch
+	if err := us.db.WithContext(c).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]any{"share_accessed": setting.ShareAccessed,
+			"storage_full": setting.StorageFull, "import_finished": setting.ImportFinished,
+			"integrity_failed": setting.IntegrityFailed, "storage_limit": setting.StorageLimit,
+			"storage_alerted": gorm.Expr("teldrive.notification_settings.storage_alerted AND " +
+				"teldrive.notification_settings.storage_limit = EXCLUDED.storage_limit"),
+			"updated_at": gorm.Expr("timezone('utc'::text, now())")}),
+	}).Create(setting).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	payload.Available = us.notifier.Enabled()
+	return &payload, nil
+}
+
+// TestNotification sends a message to the user, so they can tell whether the
+// bot reaches them.
+func (us *UserService) TestNotification(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	if !us.notifier.Enabled() {
+		return nil, &types.AppError{Error: errNotifyDisabled, Code: http.StatusBadRequest}
+	}
+	if err := alert.SendTelegram(c, us.notifier.client, us.notifier.token, userId,
+		"Notifications from your drive will arrive here."); err != nil {
+		return nil, &types.AppError{Error: fmt.Errorf("start a chat with the notification bot first: %w", err),
+			Code: http.StatusBadRequest}
+	}
+	return &schemas.Message{Message: "test notification sent"}, nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+)
+
+// Kinds of operations that can be undone.
+const (
+	OperationMove   = "move"
+	OperationRename = "rename"
+	OperationDelete = "delete"
+)
+
+// operationInverse holds what undoes an operation.
+type operationInverse struct {
+	// Parents maps moved items to the folder they were moved out of.
+	Parents map[string]string `json:"parents,omitempty"`
+	// ID, Type and Name are the renamed item and the name it had.
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Files are the files a delete moved to the trash of Owner.
+	Files []string `json:"files,omitempty"`
+	Owner int64    `json:"owner,omitempty"`
+}
+
+func (in *operationInverse) files() []string {
+	switch {
+	case in.Parents != nil:
+		ids := make([]string, 0, len(in.Parents))
+		for id := range in.Parents {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	case in.ID != "":
+		return []string{in.ID}
+	}
+	return in.Files
+}
+
+var errUndoExpired = errors.New("operation can no longer be undone")
+
+// recordOperation logs an operation of a user for the undo window and returns
+// its id, or an empty id when undo is off or the log failed.
+func (fs *FileService) recordOperation(ctx context.Context, userId int64, kind string, inverse *operationInverse) string {
+	if fs.undoWindow <= 0 {
+		return ""
+	}
+	data, _ := json.Marshal(inverse)
+	op := &models.Operation{UserID: userId, Kind: kind, Inverse: string(data)}
+	if err := fs.db.WithContext(ctx).Create(op).Error; err != nil {
+		logging.FromContext(ctx).Warnw("failed to record operation", "kind", kind, "err", err)
+		return ""
+	}
+	return op.ID
+}
+
+// PruneOperations deletes the operations that can no longer be undone.
+func (fs *FileService) PruneOperations(ctx context.Context) error {
+	return fs.db.WithContext(ctx).Where("created_at <= ?", time.Now().UTC().Add(-max(fs.undoWindow, 0))).
+		Delete(&models.Operation{}).Error
+}
+
+// ListOperations returns the operations of a user that can still be undone,
+// newest first.
+func (fs *FileService) ListOperations(ctx context.Context, userId int64) ([]schemas.OperationOut, *types.AppError) {
+	var ops []models.Operation
+	if err := fs.db.WithContext(ctx).Where("user_id = ?", userId).Where("undone_at IS NULL").
+		Where("created_at > ?", time.Now().UTC().Add(-fs.undoWindow)).Order("created_at DESC").
+		Find(&ops).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res := make([]schemas.OperationOut, 0, len(ops))
+	for _, op := range ops {
+		var inverse operationInverse
+		json.Unmarshal([]byte(op.Inverse), &inverse)
+		res = append(res, schemas.OperationOut{ID: op.ID, Kind: op.Kind, Files: inverse.files(),
+			CreatedAt: op.CreatedAt, ExpiresAt: op.CreatedAt.Add(fs.undoWindow), UndoneAt: op.UndoneAt})
+	}
+	return res, nil
+}
+
+// UndoOperation reverts an operation of a user within the undo window. Moved
+// items go back to their folders, renamed ones get their name back and
+// deleted files are restored from the trash. Each operation is undone once.
+func (fs *FileService) UndoOperation(ctx context.Context, userId int64, id string) (*schemas.Message, *types.AppError) {
+	var op models.Operation
+	if err := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).First(&op).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	// claiming the operation first keeps concurrent undos from both running
+	res := fs.db.WithContext(ctx).Model(&models.Operation{}).Where("id = ?", op.ID).Where("undone_at IS NULL").
+		Where("created_at > ?", time.Now().UTC().Add(-fs.undoWindow)).Update("undone_at", time.Now().UTC())
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: errUndoExpired, Code: http.StatusGone}
+	}
+
+	var inverse operationInverse
+	if err := json.Unmarshal([]byte(op.Inverse), &inverse); err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	var err error
+	switch op.Kind {
+	case OperationMove:
+		err = fs.undoMove(ctx, userId, inverse.Parents)
+	case OperationRename:
+		err = fs.undoRename(ctx, inverse)
+	case OperationDelete:
+		_, err = fs.restoreFiles(ctx, inverse.Owner, &schemas.TrashRestore{Files: inverse.Files}, nil)
+	}
+	if err != nil {
+		// a failed undo can be tried again
+		fs.db.WithContext(ctx).Model(&models.Operation{}).Where("id = ?", op.ID).Update("undone_at", nil)
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: op.Kind + " undone"}, nil
+}
+
+// undoMove moves items back into the folders they were moved out of.
+func (fs *FileService) undoMove(ctx context.Context, userId int64, parents map[string]string) error {
+	byParent := make(map[string][]string)
+	for id, parent := range parents {
+		byParent[parent] = append(byParent[parent], id)
+	}
+	return fs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for parent, ids := range byParent {
+			var folder models.File
+			if err := tx.Select("path").Where("id = ?", parent).Where("user_id = ?", userId).
+				Where("type = ?", "folder").Where("status = ?", "active").First(&folder).Error; err != nil {
+				if database.IsRecordNotFoundErr(err) {
+					return errors.New("the folder the items were moved out of is gone")
+				}
+				return err
+			}
+			if err := database.Procs(tx).MoveItems(tx, ids, folder.Path, userId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// undoRename gives a renamed item its name back.
+func (fs *FileService) undoRename(ctx context.Context, inverse operationInverse) error {
+	db := fs.db.WithContext(ctx)
+	var owner int64
+	if err := db.Model(&models.File{}).Where("id = ?", inverse.ID).Pluck("user_id", &owner).Error; err != nil {
+		return err
+	}
+	if inverse.Type == "folder" {
+		_, err := database.Procs(db).UpdateFolder(db, inverse.ID, inverse.Name, owner)
+		return err
+	}
+	err := db.Model(&models.File{}).Where("id = ?", inverse.ID).Update("name", inverse.Name).Error
+	fileCache.Delete(ctx, fileCache.Key(inverse.ID))
+	return err
+}
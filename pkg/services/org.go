@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OrgOwner  = "owner"
+	OrgAdmin  = "admin"
+	OrgEditor = "editor"
+	OrgViewer = "viewer"
+)
+
+// orgsRoot is the folder of the owner's tree holding the roots of their orgs.
+const orgsRoot = "/Orgs"
+
+const maxAuditEntries = 100
+
+var errOrgForbidden = errors.New("insufficient org role")
+
+// Members reach the org root through a share on it, so org files are listed,
+// streamed and edited through the regular file endpoints. Viewers get read
+// access, everybody else write access.
+func rolePermission(role string) string {
+	if role == OrgViewer {
+		return PermissionRead
+	}
+	return PermissionWrite
+}
+
+func canManage(role string) bool {
+	return role == OrgOwner || role == OrgAdmin
+}
+
+type OrgService struct {
+	db *gorm.DB
+}
+
+func NewOrgService(db *gorm.DB) *OrgService {
+	return &OrgService{db: db}
+}
+
+func (ors *OrgService) CreateOrg(ctx context.Context, userId int64, payload *schemas.OrgIn) (*schemas.OrgOut, *types.AppError) {
+	var count int64
+	if err := ors.db.WithContext(ctx).Model(&models.Channel{}).Where("channel_id = ?", payload.ChannelID).
+		Where("user_id = ?", userId).Count(&count).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if count == 0 {
+		return nil, &types.AppError{Error: errors.New("channel not found"), Code: http.StatusNotFound}
+	}
+
+	if err := ors.db.WithContext(ctx).Model(&models.Org{}).Where("owner_id = ?", userId).
+		Where("name = ?", payload.Name).Count(&count).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if count > 0 {
+		return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
+	}
+
+	rootId, err := createDirectories(ctx, ors.db, userId, orgsRoot+"/"+payload.Name)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	org := models.Org{Name: payload.Name, OwnerID: userId, ChannelID: payload.ChannelID, RootID: rootId}
+	err = ors.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Returning{}).Create(&org).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.OrgMember{OrgID: org.ID, UserID: userId, Role: OrgOwner}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrgAudit{OrgID: org.ID, UserID: userId, Action: "org.create"}).Error
+	})
+	if err != nil {
+		if database.IsKeyConflictErr(err) {
+			return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	return &schemas.OrgOut{ID: org.ID, Name: org.Name, OwnerID: org.OwnerID, ChannelID: org.ChannelID,
+		RootID: org.RootID, Role: OrgOwner, CreatedAt: org.CreatedAt}, nil
+}
+
+func (ors *OrgService) ListOrgs(ctx context.Context, userId int64) ([]schemas.OrgOut, *types.AppError) {
+	res := []schemas.OrgOut{}
+	if err := ors.db.WithContext(ctx).Model(&models.Org{}).
+		Select("orgs.id, orgs.name, orgs.owner_id, orgs.channel_id, orgs.root_id, org_members.role, orgs.created_at").
+		Joins("JOIN teldrive.org_members ON org_members.org_id = orgs.id").
+		Where("org_members.user_id = ?", userId).Order("orgs.name").Scan(&res).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
+
+// DeleteOrg removes the org and revokes its members' access. The files below
+// the org root stay in the owner's tree.
+func (ors *OrgService) DeleteOrg(ctx context.Context, userId int64, id string) (*schemas.Message, *types.AppError) {
+	org, role, appErr := ors.member(ctx, id, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if role != OrgOwner {
+		return nil, &types.AppError{Error: errOrgForbidden, Code: http.StatusForbidden}
+	}
+
+	err := ors.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", org.RootID).Where("owner_id = ?", org.OwnerID).
+			Where("user_id IN (?)", tx.Model(&models.OrgMember{}).Select("user_id").Where("org_id = ?", id)).
+			Delete(&models.Share{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.Org{}).Error
+	})
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "org deleted"}, nil
+}
+
+func (ors *OrgService) ListMembers(ctx context.Context, userId int64, id string) ([]schemas.OrgMemberOut, *types.AppError) {
+	if _, _, err := ors.member(ctx, id, userId); err != nil {
+		return nil, err
+	}
+
+	res := []schemas.OrgMemberOut{}
+	if err := ors.db.WithContext(ctx).Model(&models.OrgMember{}).
+		Select("org_members.user_id, users.user_name, org_members.role, org_members.created_at").
+		Joins("JOIN teldrive.users ON users.user_id = org_members.user_id").
+		Where("org_members.org_id = ?", id).Order("org_members.created_at").Scan(&res).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
+
+// SetMember adds a user to the org or changes their role. Admins manage
+// editors and viewers, only the owner manages admins.
+func (ors *OrgService) SetMember(ctx context.Context, userId int64, id string, payload *schemas.OrgMemberIn) (*schemas.OrgMemberOut, *types.AppError) {
+	org, role, appErr := ors.member(ctx, id, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var user models.User
+	if err := ors.db.WithContext(ctx).Where("user_name = ?", payload.UserName).First(&user).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: errors.New("user not found"), Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	current, err := ors.role(ctx, id, user.UserId)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if !canManage(role) || current == OrgOwner || (role != OrgOwner && (current == OrgAdmin || payload.Role == OrgAdmin)) {
+		return nil, &types.AppError{Error: errOrgForbidden, Code: http.StatusForbidden}
+	}
+
+	m := models.OrgMember{OrgID: id, UserID: user.UserId, Role: payload.Role}
+	err = ors.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "org_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role"}),
+		}, clause.Returning{}).Create(&m).Error; err != nil {
+			return err
+		}
+		share := models.Share{FileID: org.RootID, OwnerID: org.OwnerID, UserID: user.UserId,
+			Permission: rolePermission(payload.Role)}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "file_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"permission"}),
+		}).Create(&share).Error; err != nil {
+			return err
+		}
+		target := user.UserName + ":" + payload.Role
+		return tx.Create(&models.OrgAudit{OrgID: id, UserID: userId, Action: "member.set", Target: &target}).Error
+	})
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return &schemas.OrgMemberOut{UserID: user.UserId, UserName: user.UserName, Role: m.Role,
+		CreatedAt: m.CreatedAt}, nil
+}
+
+// RemoveMember takes a user out of the org. Members may always leave, removing
+// others follows the same rules as SetMember.
+func (ors *OrgService) RemoveMember(ctx context.Context, userId int64, id, member string) (*schemas.Message, *types.AppError) {
+	memberId, err := strconv.ParseInt(member, 10, 64)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	org, role, appErr := ors.member(ctx, id, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	current, err := ors.role(ctx, id, memberId)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if current == "" {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	if current == OrgOwner || (memberId != userId && (!canManage(role) || (role != OrgOwner && current == OrgAdmin))) {
+		return nil, &types.AppError{Error: errOrgForbidden, Code: http.StatusForbidden}
+	}
+
+	err = ors.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("org_id = ?", id).Where("user_id = ?", memberId).Delete(&models.OrgMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("file_id = ?", org.RootID).Where("owner_id = ?", org.OwnerID).
+			Where("user_id = ?", memberId).Delete(&models.Share{}).Error; err != nil {
+			return err
+		}
+		var target string
+		if err := tx.Model(&models.User{}).Where("user_id = ?", memberId).Pluck("user_name", &target).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrgAudit{OrgID: id, UserID: userId, Action: "member.remove", Target: &target}).Error
+	})
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "member removed"}, nil
+}
+
+// ListAudit returns the newest audit entries of the org, older pages are
+// fetched by passing the last id seen as before.
+func (ors *OrgService) ListAudit(ctx context.Context, userId int64, id string, query *schemas.OrgAuditQuery) ([]schemas.OrgAuditOut, *types.AppError) {
+	_, role, appErr := ors.member(ctx, id, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if !canManage(role) {
+		return nil, &types.AppError{Error: errOrgForbidden, Code: http.StatusForbidden}
+	}
+
+	tx := ors.db.WithContext(ctx).Model(&models.OrgAudit{}).
+		Select("org_audits.id, org_audits.user_id, users.user_name, org_audits.action, org_audits.target, org_audits.created_at").
+		Joins("LEFT JOIN teldrive.users ON users.user_id = org_audits.user_id").
+		Where("org_audits.org_id = ?", id)
+	if query.UserID != 0 {
+		tx = tx.Where("org_audits.user_id = ?", query.UserID)
+	}
+	if query.Before != 0 {
+		tx = tx.Where("org_audits.id < ?", query.Before)
+	}
+
+	res := []schemas.OrgAuditOut{}
+	if err := tx.Order("org_audits.id desc").Limit(maxAuditEntries).Scan(&res).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
+
+// member loads org id and the role userId holds in it. Non members get not
+// found so that org ids cannot be probed.
+func (ors *OrgService) member(ctx context.Context, id string, userId int64) (*models.Org, string, *types.AppError) {
+	role, err := ors.role(ctx, id, userId)
+	if err != nil {
+		return nil, "", &types.AppError{Error: err}
+	}
+	if role == "" {
+		return nil, "", &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	var org models.Org
+	if err := ors.db.WithContext(ctx).Where("id = ?", id).First(&org).Error; err != nil {
+		return nil, "", &types.AppError{Error: err}
+	}
+	return &org, role, nil
+}
+
+func (ors *OrgService) role(ctx context.Context, id string, userId int64) (string, error) {
+	return orgRole(ctx, ors.db, id, userId)
+}
+
+// orgRole returns the role userId holds in org id, or "" for non members.
+func orgRole(ctx context.Context, db *gorm.DB, id string, userId int64) (string, error) {
+	var roles []string
+	err := db.WithContext(ctx).Model(&models.OrgMember{}).Where("org_id = ?", id).Where("user_id = ?", userId).
+		Pluck("role", &roles).Error
+	if err != nil || len(roles) == 0 {
+		return "", err
+	}
+	return roles[0], nil
+}
+
+// orgChain walks from the files in ids up to the root folder. Every row keeps
+// the file it started from as target.
+const orgChain = `
+WITH RECURSIVE chain AS (
+	SELECT id AS target, id, parent_id FROM teldrive.files WHERE id IN ?
+	UNION ALL
+	SELECT c.target, f.id, f.parent_id FROM teldrive.files f JOIN chain c ON f.id = c.parent_id
+)`
+
+// orgAudits resolves the audit entries of the ids that lie inside an org.
+// Files outside any org are skipped. Entries are resolved before the operation
+// runs, so deleted files can still be traced to their org, and saved with
+// saveOrgAudits once it went through.
+func orgAudits(ctx context.Context, db *gorm.DB, userId int64, action string, ids []string) []models.OrgAudit {
+	if len(ids) == 0 {
+		return nil
+	}
+	var audits []models.OrgAudit
+	err := db.WithContext(ctx).Raw(orgChain+`
+	SELECT o.id AS org_id, c.target FROM chain c JOIN teldrive.orgs o ON o.root_id = c.id`,
+		ids).Scan(&audits).Error
+	if err != nil {
+		logging.FromContext(ctx).Warnw("failed to resolve org audit", "action", action, "err", err)
+	}
+	for i := range audits {
+		audits[i].UserID = userId
+		audits[i].Action = action
+	}
+	return audits
+}
+
+// saveOrgAudits stores audits. Failures are logged and do not fail the
+// operation being audited.
+func saveOrgAudits(ctx context.Context, db *gorm.DB, audits []models.OrgAudit) {
+	if len(audits) == 0 {
+		return
+	}
+	if err := db.WithContext(ctx).Create(&audits).Error; err != nil {
+		logging.FromContext(ctx).Warnw("failed to record org audit", "action", audits[0].Action, "err", err)
+	}
+}
+
+// recordOrgAudit adds an audit entry for each of ids that lies inside an org,
+// for operations that leave the files in place.
+func recordOrgAudit(ctx context.Context, db *gorm.DB, userId int64, action string, ids []string) {
+	saveOrgAudits(ctx, db, orgAudits(ctx, db, userId, action, ids))
+}
+
+// folderOrg returns the org the folder id lies in, or nil outside of orgs.
+func folderOrg(ctx context.Context, db *gorm.DB, id string) (*models.Org, error) {
+	var orgs []models.Org
+	err := db.WithContext(ctx).Raw(orgChain+`
+	SELECT o.* FROM chain c JOIN teldrive.orgs o ON o.root_id = c.id LIMIT 1`,
+		[]string{id}).Scan(&orgs).Error
+	if err != nil || len(orgs) == 0 {
+		return nil, err
+	}
+	return &orgs[0], nil
+}
+
+// orgWriter resolves the folder a member adds files to: it must lie inside an
+// org in which userId holds a role above viewer. Files added there belong to
+// the org owner and are stored in the org channel.
+func orgWriter(ctx context.Context, db *gorm.DB, id string, userId int64) (*models.Org, *types.AppError) {
+	org, err := folderOrg(ctx, db, id)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if org == nil {
+		return nil, &types.AppError{Error: errors.New("only org folders accept files from other users"),
+			Code: http.StatusForbidden}
+	}
+	role, err := orgRole(ctx, db, org.ID, userId)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if role == "" || rolePermission(role) != PermissionWrite {
+		return nil, &types.AppError{Error: errOrgForbidden, Code: http.StatusForbidden}
+	}
+	return org, nil
+}
+
+// channelOrg returns the org storing its files in channelId in which userId
+// holds a role above viewer, or nil if there is none.
+func channelOrg(ctx context.Context, db *gorm.DB, channelId, userId int64) (*models.Org, error) {
+	var orgs []models.Org
+	err := db.WithContext(ctx).Model(&models.Org{}).
+		Joins("JOIN teldrive.org_members ON org_members.org_id = orgs.id").
+		Where("orgs.channel_id = ?", channelId).Where("org_members.user_id = ?", userId).
+		Where("org_members.role <> ?", OrgViewer).Limit(1).Find(&orgs).Error
+	if err != nil || len(orgs) == 0 {
+		return nil, err
+	}
+	return &orgs[0], nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// orphanedFiles lists, by user, the files and folders cut off from the drive
+// tree because a folder above them no longer exists.
+func (fs *FileService) orphanedFiles(ctx context.Context, userId int64) (map[int64][]string, error) {
+	var rows []struct {
+		ID     string
+		UserID int64
+	}
+	if err := fs.db.WithContext(ctx).Raw(`
+	WITH RECURSIVE orphans AS (
+		SELECT f.id, f.user_id FROM teldrive.files f
+		WHERE f.parent_id IS NOT NULL AND f.parent_id <> 'root' AND (? = 0 OR f.user_id = ?)
+		AND NOT EXISTS (SELECT 1 FROM teldrive.files p WHERE p.id = f.parent_id)
+		UNION
+		SELECT f.id, f.user_id FROM teldrive.files f JOIN orphans o ON f.parent_id = o.id
+	)
+	SELECT id, user_id FROM orphans`, userId, userId).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	res := make(map[int64][]string)
+	for _, row := range rows {
+		res[row.UserID] = append(res[row.UserID], row.ID)
+	}
+	return res, nil
+}
+
+// PurgeOrphans deletes the files cut off from the drive tree, of one user or
+// of all users when userId is 0, along with their Telegram messages. Files
+// whose messages could not be deleted are left in the trash. With dryRun the
+// orphans are only counted.
+func (fs *FileService) PurgeOrphans(ctx context.Context, userId int64, dryRun bool) (*schemas.OrphanResult, error) {
+	orphans, err := fs.orphanedFiles(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &schemas.OrphanResult{}
+	for _, ids := range orphans {
+		result.Found += len(ids)
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	for owner, ids := range orphans {
+		err := runWithUserClient(ctx, fs.db, fs.cnf, owner, func(ctx context.Context, client *telegram.Client, user string) error {
+			channels := make(map[int64]*tg.InputChannel)
+			for _, batch := range chunks(ids, deleteBatchSize) {
+				pending, kept, err := fs.deleteFileBatch(ctx, client, user, channels, batch)
+				if err != nil {
+					return err
+				}
+				result.Purged += len(batch) - pending
+				if kept != nil && len(result.Errors) < maxDeleteErrors {
+					result.Errors = append(result.Errors, fmt.Sprintf("user %d: %v", owner, kept))
+				}
+			}
+			return nil
+		})
+		if err != nil && len(result.Errors) < maxDeleteErrors {
+			result.Errors = append(result.Errors, fmt.Sprintf("user %d: %v", owner, err))
+		}
+	}
+	return result, nil
+}
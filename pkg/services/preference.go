@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultPreferences match the listing defaults of the file API and are
+// returned until a user saves their own.
+var defaultPreferences = schemas.Preferences{Sort: "name", Order: "asc", PageSize: 500, ShowHidden: true}
+
+func getPreferences(ctx context.Context, db *gorm.DB, userId int64) (*schemas.Preferences, error) {
+	prefs, err := preferenceCache.Fetch(ctx, preferenceCache.Key(userId), func(ctx context.Context) (schemas.Preferences, error) {
+		var pref models.Preference
+		err := db.WithContext(ctx).Where("user_id = ?", userId).First(&pref).Error
+		if database.IsRecordNotFoundErr(err) {
+			return defaultPreferences, nil
+		}
+		if err != nil {
+			return schemas.Preferences{}, err
+		}
+		return schemas.Preferences{Sort: pref.Sort, Order: pref.SortOrder, PageSize: pref.PageSize,
+			ShowHidden: pref.ShowHidden, DateFormat: pref.DateFormat}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+func (us *UserService) GetPreferences(c *gin.Context) (*schemas.Preferences, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	prefs, err := getPreferences(c, us.db, userId)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return prefs, nil
+}
+
+func (us *UserService) UpdatePreferences(c *gin.Context) (*schemas.Preferences, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	var payload schemas.Preferences
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	pref := &models.Preference{UserID: userId, Sort: payload.Sort, SortOrder: payload.Order,
+		PageSize: payload.PageSize, ShowHidden: payload.ShowHidden, DateFormat: payload.DateFormat}
+
+	if err := us.db.WithContext(c).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"sort": pref.Sort, "sort_order": pref.SortOrder,
+			"page_size": pref.PageSize, "show_hidden": pref.ShowHidden, "date_format": pref.DateFormat,
+			"updated_at": gorm.Expr("timezone('utc'::text, now())")}),
+	}).Create(pref).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to update preferences"),
+			Code: http.StatusInternalServerError}
+	}
+
+	preferenceCache.Delete(c, preferenceCache.Key(userId))
+	return &payload, nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/md5"
+	"github.com/divyam234/teldrive/internal/pdftext"
+	"github.com/divyam234/teldrive/internal/render"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPreviewSize = 64
+	// maxPDFPreviewRead is how much of a PDF is fetched to find the text of its
+	// first page.
+	maxPDFPreviewRead = 4 * 1024 * 1024
+)
+
+// GetPreview sends the start of a text file, or the text of the first page
+// of a PDF, as plain text. Only the bytes needed are read from Telegram.
+func (fs *FileService) GetPreview(c *gin.Context) {
+	userId, _ := GetUserAuth(c)
+
+	var query schemas.PreviewQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Size == 0 {
+		query.Size = defaultPreviewSize
+	}
+	limit := int64(query.Size) * 1024
+
+	var file models.File
+	if err := fs.db.WithContext(c).Where("id = ?", c.Param("fileID")).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").First(&file).Error; err != nil {
+		http.Error(c.Writer, database.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if file.ScanStatus != nil && awaitingScan(*file.ScanStatus) {
+		http.Error(c.Writer, errAwaitingScan.Error(), http.StatusConflict)
+		return
+	}
+
+	if file.Size == nil || *file.Size == 0 {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", nil)
+		return
+	}
+
+	isPDF := file.MimeType == "application/pdf" || strings.EqualFold(filepath.Ext(file.Name), ".pdf")
+
+	read := min(limit, *file.Size)
+	if isPDF {
+		read = min(maxPDFPreviewRead, *file.Size)
+	}
+
+	out := mapper.ToFileOutFull(file)
+
+	var buf bytes.Buffer
+	if err := readFileWithAuth(c, fs.cnf, out, 0, read-1, func(r io.Reader) error {
+		_, err := io.CopyN(&buf, r, read)
+		return err
+	}); err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		text      []byte
+		truncated bool
+	)
+	if isPDF {
+		page, err := pdftext.FirstPage(buf.Bytes(), int(limit))
+		if errors.Is(err, pdftext.ErrNoText) {
+			http.Error(c.Writer, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		text, truncated = []byte(page), len(page) >= int(limit)
+	} else {
+		var ok bool
+		if text, ok = previewText(buf.Bytes()); !ok {
+			http.Error(c.Writer, "file is not text", http.StatusUnsupportedMediaType)
+			return
+		}
+		truncated = read < *file.Size
+	}
+
+	c.Header("X-Preview-Truncated", strconv.FormatBool(truncated))
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", text)
+}
+
+// previewText drops a rune cut off at the end of b and reports whether the
+// rest is UTF-8 text.
+func previewText(b []byte) ([]byte, bool) {
+	for i := 0; i < utf8.UTFMax-1 && len(b) > 0 && !utf8.Valid(b); i++ {
+		b = b[:len(b)-1]
+	}
+	return b, utf8.Valid(b) && bytes.IndexByte(b, 0) < 0
+}
+
+// GetRendered sends an office document converted to PDF by the configured
+// render service. Conversions are cached on disk per file version.
+func (fs *FileService) GetRendered(c *gin.Context) {
+	userId, _ := GetUserAuth(c)
+
+	var file models.File
+	if err := fs.db.WithContext(c).Where("id = ?", c.Param("fileID")).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").First(&file).Error; err != nil {
+		http.Error(c.Writer, database.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if file.ScanStatus != nil && awaitingScan(*file.ScanStatus) {
+		http.Error(c.Writer, errAwaitingScan.Error(), http.StatusConflict)
+		return
+	}
+
+	if !fs.renderer.Supports(file.Name) {
+		http.Error(c.Writer, "document cannot be rendered", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if file.Size == nil || *file.Size == 0 || *file.Size > fs.renderMaxSize {
+		http.Error(c.Writer, "invalid document size", http.StatusBadRequest)
+		return
+	}
+
+	key := fmt.Sprintf("%s:%d", file.ID, file.UpdatedAt.UnixNano())
+	etag := fmt.Sprintf("\"%s\"", md5.FromString(key))
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age=86400")
+
+	if cached, err := fs.diskCache.Open("renders", key); err == nil {
+		defer cached.Close()
+		c.Header("Content-Type", "application/pdf")
+		http.ServeContent(c.Writer, c.Request, "", file.UpdatedAt, cached)
+		return
+	}
+
+	out := mapper.ToFileOutFull(file)
+
+	var pdf []byte
+	err := readFileWithAuth(c, fs.cnf, out, 0, out.Size-1, func(r io.Reader) error {
+		var err error
+		pdf, err = fs.renderer.Render(c, file.Name, io.LimitReader(r, out.Size))
+		return err
+	})
+	if err != nil {
+		logging.FromContext(c).Errorw("document render", "file", file.ID, "err", err)
+		status := http.StatusBadGateway
+		if errors.Is(err, render.ErrDisabled) {
+			status = http.StatusUnsupportedMediaType
+		}
+		http.Error(c.Writer, err.Error(), status)
+		return
+	}
+
+	if err := fs.diskCache.Write("renders", key, pdf); err != nil {
+		logging.FromContext(c).Warnw("render cache write", "file", file.ID, "err", err)
+	}
+
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/uploadpolicy"
+	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+)
+
+// statusQuarantined marks uploads held by the upload policy. They are left out
+// of listings and cannot be streamed until an admin releases them.
+const statusQuarantined = "quarantined"
+
+func newUploadPolicy(cnf *config.TGConfig) *uploadpolicy.Policy {
+	return &uploadpolicy.Policy{Blocked: cnf.Uploads.Blocked, Quarantined: cnf.Uploads.Quarantined,
+		MaxSize: cnf.Uploads.MaxFileSize}
+}
+
+// applyUploadPolicy holds file to policy before it is stored under its name
+// and mime type. A quarantined file is still stored, with its status changed.
+// Rejected files leave their messages to the orphan finder.
+func applyUploadPolicy(policy *uploadpolicy.Policy, file *models.File, size int64) *types.AppError {
+	switch policy.Check(file.Name, file.MimeType, size) {
+	case uploadpolicy.TooLarge:
+		return &types.AppError{Error: fmt.Errorf("files larger than %d bytes are not accepted", policy.MaxSize),
+			Code: http.StatusRequestEntityTooLarge}
+	case uploadpolicy.Block:
+		return &types.AppError{Error: errors.New("files of this type are not accepted"),
+			Code: http.StatusUnsupportedMediaType}
+	case uploadpolicy.Quarantine:
+		file.Status = statusQuarantined
+		file.QuarantineReason = utils.StringPointer("upload policy")
+	}
+	return nil
+}
+
+func (as *AdminService) quarantined(ctx context.Context, id string) (*models.File, *types.AppError) {
+	var file models.File
+	if err := as.db.WithContext(ctx).Where("id = ?", id).Where("status = ?", statusQuarantined).
+		First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return &file, nil
+}
+
+func (as *AdminService) ListQuarantine(ctx context.Context, userId int64) ([]schemas.QuarantinedFile, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	res := []schemas.QuarantinedFile{}
+	if err := as.db.WithContext(ctx).Model(&models.File{}).Where("status = ?", statusQuarantined).
+		Order("created_at").Scan(&res).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
+
+// ReleaseQuarantined makes a held upload a regular file of its owner.
+func (as *AdminService) ReleaseQuarantined(ctx context.Context, userId int64, id string) (*schemas.Message, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	if _, appErr := as.quarantined(ctx, id); appErr != nil {
+		return nil, appErr
+	}
+	if err := as.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", id).
+		Updates(map[string]any{"status": "active", "quarantine_reason": nil}).Error; err != nil {
+		if database.IsKeyConflictErr(err) {
+			return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "file released"}, nil
+}
+
+// DeleteQuarantined deletes a held upload along with its messages. It skips
+// the trash, so the owner cannot restore it.
+func (as *AdminService) DeleteQuarantined(ctx context.Context, userId int64, id string) (*schemas.Message, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	file, appErr := as.quarantined(ctx, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if file.ChannelID != nil && file.Parts != nil && len(*file.Parts) > 0 {
+		session, err := getLatestSession(ctx, as.db, file.UserID)
+		if err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+		ids := []int{}
+		for _, part := range *file.Parts {
+			ids = append(ids, int(part.ID))
+		}
+		ids, err = ReleasableParts(ctx, as.db, *file.ChannelID, ids, []string{file.ID})
+		if err == nil && len(ids) > 0 {
+			err = DeleteTGMessages(ctx, &as.cnf.TG, session.Session, *file.ChannelID, file.UserID, ids)
+		}
+		if err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+	}
+	if err := PurgeFiles(ctx, as.db, []string{file.ID}); err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "file deleted"}, nil
+}
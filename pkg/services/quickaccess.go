@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPins bounds the quick access list of a user.
+const maxPins = 50
+
+var (
+	errPinsChanged = errors.New("files must list every pinned item once")
+	errTooManyPins = fmt.Errorf("at most %d items can be pinned", maxPins)
+)
+
+// getQuickAccess returns the pinned items of a user in their order. Items in
+// the trash stay pinned but are left out until restored.
+func getQuickAccess(ctx context.Context, db *gorm.DB, userId int64) ([]schemas.FileOut, error) {
+	var files []models.File
+	if err := db.WithContext(ctx).Model(&models.File{}).Select("files.*").
+		Joins("JOIN teldrive.pins ON pins.file_id = files.id AND pins.user_id = files.user_id").
+		Where("pins.user_id = ?", userId).Where("files.status = ?", "active").
+		Order("pins.position ASC").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	res := make([]schemas.FileOut, 0, len(files))
+	for _, file := range files {
+		res = append(res, *mapper.ToFileOut(file))
+	}
+	return res, nil
+}
+
+// visiblePins returns the ids of the pinned items of a user that are not in
+// the trash.
+func visiblePins(tx *gorm.DB, userId int64) (map[string]bool, error) {
+	var ids []string
+	if err := tx.Model(&models.Pin{}).Joins("JOIN teldrive.files ON files.id = pins.file_id").
+		Where("pins.user_id = ?", userId).Where("files.status = ?", "active").
+		Pluck("pins.file_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	visible := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		visible[id] = true
+	}
+	return visible, nil
+}
+
+func (us *UserService) ListQuickAccess(c *gin.Context) ([]schemas.FileOut, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	res, err := getQuickAccess(c, us.db, userId)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
+
+// AddQuickAccess pins files and folders of the user after the ones already
+// pinned.
+func (us *UserService) AddQuickAccess(c *gin.Context) ([]schemas.FileOut, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	var payload schemas.QuickAccessIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	ids := uniqueIDs(payload.Files)
+	var count int64
+	if err := us.db.WithContext(c).Model(&models.File{}).Where("id IN ?", ids).Where("user_id = ?", userId).
+		Where("status = ?", "active").Count(&count).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if count != int64(len(ids)) {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+
+	err := us.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var pinned []models.Pin
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userId).
+			Order("position ASC").Find(&pinned).Error; err != nil {
+			return err
+		}
+		// pins of items in the trash do not count, as they are not shown
+		visible, err := visiblePins(tx, userId)
+		if err != nil {
+			return err
+		}
+		position := 0
+		seen := make(map[string]bool, len(pinned))
+		for _, pin := range pinned {
+			seen[pin.FileID] = true
+			position = pin.Position + 1
+		}
+		var pins []models.Pin
+		for _, id := range ids {
+			if !seen[id] {
+				pins = append(pins, models.Pin{UserID: userId, FileID: id, Position: position})
+				position++
+			}
+		}
+		if len(visible)+len(pins) > maxPins {
+			return errTooManyPins
+		}
+		if len(pins) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&pins).Error
+	})
+	if errors.Is(err, errTooManyPins) {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return us.ListQuickAccess(c)
+}
+
+// ReorderQuickAccess puts the pinned items of the user in the order of files,
+// which must list each of them once. Pins of items in the trash are not
+// listed, they keep their order after the others.
+func (us *UserService) ReorderQuickAccess(c *gin.Context) ([]schemas.FileOut, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	var payload schemas.QuickAccessIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	err := us.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var pinned []models.Pin
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userId).
+			Order("position ASC").Find(&pinned).Error; err != nil {
+			return err
+		}
+		visible, err := visiblePins(tx, userId)
+		if err != nil {
+			return err
+		}
+		order := uniqueIDs(payload.Files)
+		if len(order) != len(payload.Files) || len(order) != len(visible) {
+			return errPinsChanged
+		}
+		for _, id := range order {
+			if !visible[id] {
+				return errPinsChanged
+			}
+		}
+		for _, pin := range pinned {
+			if !visible[pin.FileID] {
+				order = append(order, pin.FileID)
+			}
+		}
+		for position, id := range order {
+			if err := tx.Model(&models.Pin{}).Where("user_id = ?", userId).Where("file_id = ?", id).
+				Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errPinsChanged) {
+		return nil, &types.AppError{Error: err, Code: http.StatusConflict}
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return us.ListQuickAccess(c)
+}
+
+func (us *UserService) RemoveQuickAccess(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	res := us.db.WithContext(c).Where("user_id = ?", userId).Where("file_id = ?", c.Param("fileID")).
+		Delete(&models.Pin{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "unpinned"}, nil
+}
+
+// uniqueIDs drops repeated ids, keeping the first of each.
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+	return res
+}
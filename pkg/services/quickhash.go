@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"io"
+
+	"github.com/divyam234/teldrive/internal/quickhash"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"gorm.io/gorm"
+)
+
+const JobQuickHashBackfill = "files.quickhash"
+
+func (fs *FileService) BackfillQuickHashes(ctx context.Context, userId int64) (*schemas.JobOut, *types.AppError) {
+	return fs.jobs.SubmitExclusive(ctx, userId, JobQuickHashBackfill, struct{}{}, "quick hash backfill already running")
+}
+
+func (fs *FileService) pendingQuickHashes(ctx context.Context, userId int64) *gorm.DB {
+	return fs.db.WithContext(ctx).Model(&models.File{}).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "active").
+		Where("quick_hash IS NULL").Where("parts IS NOT NULL")
+}
+
+// backfillQuickHashes computes the quick hash of files that have none. Only
+// the ends of each file are read, so unlike checksums the reads are not
+// throttled.
+func (fs *FileService) backfillQuickHashes(ctx context.Context, run *JobRun) (any, error) {
+	var total int64
+	if err := fs.pendingQuickHashes(ctx, run.UserID).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	result := &schemas.ChecksumResult{}
+
+	if total == 0 {
+		return result, nil
+	}
+
+	run.Progress(0, total)
+
+	err := runWithUserClient(ctx, fs.db, fs.cnf, run.UserID, func(ctx context.Context, client *telegram.Client, user string) error {
+		lastId := ""
+		for {
+			var files []models.File
+			if err := fs.pendingQuickHashes(ctx, run.UserID).Where("id > ?", lastId).Order("id").
+				Limit(checksumBatchSize).Find(&files).Error; err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				return nil
+			}
+
+			for _, file := range files {
+				lastId = file.ID
+
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				sum, err := fs.fileQuickHash(ctx, client, file, user)
+				if err == nil {
+					err = fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).
+						Where("quick_hash IS NULL").Update("quick_hash", sum).Error
+				}
+				if err != nil {
+					result.Failed++
+					if len(result.Errors) < maxDeleteErrors {
+						result.Errors = append(result.Errors, file.Name+": "+err.Error())
+					}
+				} else {
+					result.Updated++
+				}
+				run.Progress(int64(result.Updated+result.Failed), total)
+			}
+		}
+	})
+
+	return result, err
+}
+
+func (fs *FileService) fileQuickHash(ctx context.Context, client *telegram.Client, file models.File, user string) (string, error) {
+	src := mapper.ToFileOutFull(file)
+	var chunks [][]byte
+	for _, r := range quickhash.Ranges(src.Size) {
+		rd, err := newFileReader(ctx, client, fs.cnf, src, r[0], r[1], user)
+		if err != nil {
+			return "", err
+		}
+		chunk, err := io.ReadAll(rd)
+		rd.Close()
+		if err != nil {
+			return "", err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return quickhash.Sum(src.Size, chunks...), nil
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	RegistrationPending  = "pending"
+	RegistrationRejected = "rejected"
+)
+
+// admit checks that user may log in, creating its account on its first login
+// as the registration mode allows. An invite code is only looked at for new
+// users.
+func (as *AuthService) admit(c *gin.Context, user *models.User, inviteCode string, keys ...string) *types.AppError {
+	var existing models.User
+	err := as.db.WithContext(c).Where("user_id = ?", user.UserId).First(&existing).Error
+	if err == nil {
+		if existing.Disabled {
+			as.loginFailed(c, "user disabled", keys...)
+			return &types.AppError{Error: errors.New("user disabled"), Code: http.StatusUnauthorized}
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &types.AppError{Error: err}
+	}
+
+	mode := as.cnf.Registration.Mode
+	switch {
+	case mode == config.RegistrationOpen:
+	case inviteCode != "" && (mode == config.RegistrationInvite || mode == config.RegistrationApproval):
+		return as.redeemInvite(c, user, inviteCode, keys...)
+	case mode == config.RegistrationInvite:
+		return &types.AppError{Error: errors.New("invite code required"), Code: http.StatusForbidden}
+	case mode == config.RegistrationApproval:
+		return as.queueRegistration(c, user)
+	default:
+		return &types.AppError{Error: errors.New("registration is closed"), Code: http.StatusForbidden}
+	}
+
+	if _, err := AddUser(c, as.db, user); err != nil {
+		return &types.AppError{Error: err}
+	}
+	return nil
+}
+
+// redeemInvite uses up one sign up of the invite and creates the account. A
+// wrong code counts as a failed login, so codes cannot be guessed.
+func (as *AuthService) redeemInvite(c *gin.Context, user *models.User, code string, keys ...string) *types.AppError {
+	errInvalid := errors.New("invalid invite code")
+	err := as.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Invite{}).Where("code = ?", code).Where("uses < max_uses").
+			Where("expires_at IS NULL OR expires_at > ?", time.Now().UTC()).
+			Update("uses", gorm.Expr("uses + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInvalid
+		}
+		if err := tx.Where("user_id = ?", user.UserId).Delete(&models.Registration{}).Error; err != nil {
+			return err
+		}
+		_, err := AddUser(c, tx, user)
+		return err
+	})
+	if errors.Is(err, errInvalid) {
+		as.loginFailed(c, "invalid invite code", keys...)
+		return &types.AppError{Error: err, Code: http.StatusForbidden}
+	}
+	if err != nil {
+		return &types.AppError{Error: err}
+	}
+	return nil
+}
+
+// queueRegistration records the sign up for an admin to approve, once.
+func (as *AuthService) queueRegistration(ctx context.Context, user *models.User) *types.AppError {
+	registration := &models.Registration{UserID: user.UserId, Name: user.Name, UserName: user.UserName,
+		IsPremium: user.IsPremium, Status: RegistrationPending}
+	if err := as.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(registration).Error; err != nil {
+		return &types.AppError{Error: err}
+	}
+	if err := as.db.WithContext(ctx).Where("user_id = ?", user.UserId).First(registration).Error; err != nil {
+		return &types.AppError{Error: err}
+	}
+	if registration.Status == RegistrationRejected {
+		return &types.AppError{Error: errors.New("registration rejected"), Code: http.StatusForbidden}
+	}
+	return &types.AppError{Error: errors.New("registration pending approval"), Code: http.StatusForbidden}
+}
+
+// checkAdmin tells whether userId may manage invites, approvals, maintenance
+// and quarantined uploads. Nobody may when no admin is configured.
+func (as *AdminService) checkAdmin(userId int64) *types.AppError {
+	if !slices.Contains(as.cnf.Access.Admins, userId) {
+		return &types.AppError{Error: errors.New("admin access required"), Code: http.StatusForbidden}
+	}
+	return nil
+}
+
+func (as *AdminService) ListInvites(ctx context.Context, userId int64) ([]schemas.InviteOut, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	var invites []models.Invite
+	if err := as.db.WithContext(ctx).Order("created_at desc").Find(&invites).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res := []schemas.InviteOut{}
+	for i := range invites {
+		res = append(res, *mapper.ToInviteOut(&invites[i]))
+	}
+	return res, nil
+}
+
+func (as *AdminService) CreateInvite(ctx context.Context, userId int64,
+	in *schemas.InviteIn) (*schemas.InviteOut, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	invite := &models.Invite{CreatedBy: userId, Note: in.Note, MaxUses: max(in.MaxUses, 1), ExpiresAt: in.ExpiresAt}
+	if err := as.db.WithContext(ctx).Create(invite).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return mapper.ToInviteOut(invite), nil
+}
+
+func (as *AdminService) DeleteInvite(ctx context.Context, userId int64, code string) (*schemas.Message, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	res := as.db.WithContext(ctx).Where("code = ?", code).Delete(&models.Invite{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: errors.New("invite not found"), Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "invite deleted"}, nil
+}
+
+func (as *AdminService) ListRegistrations(ctx context.Context, userId int64,
+	query *schemas.RegistrationQuery) ([]schemas.RegistrationOut, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	status := query.Status
+	if status == "" {
+		status = RegistrationPending
+	}
+	var registrations []models.Registration
+	if err := as.db.WithContext(ctx).Where("status = ?", status).Order("created_at").
+		Find(&registrations).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res := []schemas.RegistrationOut{}
+	for i := range registrations {
+		res = append(res, *mapper.ToRegistrationOut(&registrations[i]))
+	}
+	return res, nil
+}
+
+// ApproveRegistration creates the account of a queued or rejected sign up,
+// which can log in right away.
+func (as *AdminService) ApproveRegistration(ctx context.Context, userId int64, user string) (*schemas.Message, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	userId, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+	err = as.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var registration models.Registration
+		if err := tx.Where("user_id = ?", userId).First(&registration).Error; err != nil {
+			return err
+		}
+		user := &models.User{UserId: registration.UserID, Name: registration.Name, UserName: registration.UserName,
+			IsPremium: registration.IsPremium}
+		if _, err := AddUser(ctx, tx, user); err != nil {
+			return err
+		}
+		return tx.Delete(&registration).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &types.AppError{Error: errors.New("registration not found"), Code: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "registration approved"}, nil
+}
+
+// RejectRegistration turns a sign up down. It stays listed as rejected so the
+// user is not queued again on its next login.
+func (as *AdminService) RejectRegistration(ctx context.Context, userId int64, user string) (*schemas.Message, *types.AppError) {
+	if err := as.checkAdmin(userId); err != nil {
+		return nil, err
+	}
+	userId, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+	res := as.db.WithContext(ctx).Model(&models.Registration{}).Where("user_id = ?", userId).
+		Updates(map[string]any{"status": RegistrationRejected, "updated_at": time.Now().UTC()})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: errors.New("registration not found"), Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "registration rejected"}, nil
+}
@@ -0,0 +1,518 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/replication"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const replicaChannelName = "teldrive replica"
+
+// replicatedFileColumns are updated when a file changes on the primary. The
+// revision is left to the triggers of the replica.
+var replicatedFileColumns = []string{"name", "type", "mime_type", "path", "size", "starred", "depth", "category",
+	"encrypted", "hidden", "user_id", "status", "parent_id", "parts", "channel_id", "checksum", "quick_hash",
+	"color", "icon", "created_at", "updated_at", "verified_at", "integrity_error"}
+
+func (rs *ReplicationService) run(ctx context.Context) {
+	ticker := time.NewTicker(rs.cnf.Replication.Interval)
+	defer ticker.Stop()
+	for {
+		err := rs.pull(ctx)
+		if err == nil && rs.reconcileDue(ctx) {
+			err = rs.reconcile(ctx)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			rs.logger.Errorw("replication failed", "err", err)
+		}
+		rs.mu.Lock()
+		rs.status.LastError = ""
+		if err != nil {
+			rs.status.LastError = err.Error()
+		}
+		rs.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pull applies the accounts of the primary and the files changed since the
+// cursor, saving the cursor after every page.
+func (rs *ReplicationService) pull(ctx context.Context) error {
+	accounts, err := rs.client.Accounts(ctx)
+	if err != nil {
+		return err
+	}
+	if err := rs.applyAccounts(ctx, accounts); err != nil {
+		return err
+	}
+
+	state, err := rs.state(ctx)
+	if err != nil {
+		return err
+	}
+	cursor := replication.Cursor{UpdatedAt: state.CursorAt, ID: state.CursorID}
+
+	for {
+		changes, err := rs.client.Changes(ctx, cursor)
+		if err != nil {
+			return err
+		}
+		if err := rs.applyFiles(ctx, changes.Files); err != nil {
+			return err
+		}
+		cursor = changes.Next
+		if err := rs.db.WithContext(ctx).Model(&models.ReplicationState{}).Where("id = ?", 1).
+			Updates(map[string]any{"cursor_at": cursor.UpdatedAt, "cursor_id": cursor.ID,
+				"updated_at": gorm.Expr("timezone('utc'::text, now())")}).Error; err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		rs.mu.Lock()
+		rs.status.Applied += int64(len(changes.Files))
+		rs.status.Cursor, rs.status.LastPullAt = &cursor.UpdatedAt, &now
+		rs.status.LagSeconds = 0
+		if !changes.Latest.IsZero() {
+			latest := changes.Latest
+			rs.status.Latest = &latest
+			if lag := latest.Sub(cursor.UpdatedAt); lag > 0 {
+				rs.status.LagSeconds = lag.Seconds()
+			}
+		}
+		rs.mu.Unlock()
+
+		if len(changes.Files) < replication.PageSize {
+			return nil
+		}
+	}
+}
+
+// applyAccounts upserts the users, channels and sessions of the primary.
+// Sessions missing from the primary were logged out there and are removed,
+// those of users logging in to the replica stay. Channels the replica created
+// to mirror files are its own and stay.
+func (rs *ReplicationService) applyAccounts(ctx context.Context, accounts *replication.Accounts) error {
+	sessions := make([]models.Session, 0, len(accounts.Sessions))
+	if rs.sessionKey != nil {
+		for _, session := range accounts.Sessions {
+			opened, err := replication.OpenSession(session.Sealed, rs.sessionKey)
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, models.Session{UserId: session.UserID, Hash: session.Hash, Session: opened,
+				Replicated: true, CreatedAt: session.CreatedAt})
+		}
+	}
+	return rs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(accounts.Users) > 0 {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"name", "user_name", "is_premium", "disabled", "updated_at"}),
+			}).Create(&accounts.Users).Error; err != nil {
+				return err
+			}
+		}
+		if len(accounts.Channels) > 0 {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "channel_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"channel_name", "user_id", "selected"}),
+			}).Create(&accounts.Channels).Error; err != nil {
+				return err
+			}
+		}
+
+		hashes := make([]string, 0, len(sessions))
+		for _, session := range sessions {
+			hashes = append(hashes, session.Hash)
+		}
+		remove := tx.Where("replicated")
+		if len(hashes) > 0 {
+			remove = remove.Where("hash NOT IN ?", hashes)
+		}
+		if err := remove.Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		if len(sessions) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&sessions).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// applyFiles upserts files as they are on the primary, pointing them at their
+// copies first when the replica mirrors them.
+func (rs *ReplicationService) applyFiles(ctx context.Context, files []models.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if rs.cnf.Replication.Mirror {
+		if err := rs.mirror(ctx, files); err != nil {
+			return err
+		}
+	}
+	return rs.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns(replicatedFileColumns),
+	}).Create(&files).Error
+}
+
+func (rs *ReplicationService) state(ctx context.Context) (*models.ReplicationState, error) {
+	state := &models.ReplicationState{ID: 1}
+	if err := rs.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(state).Error; err != nil {
+		return nil, err
+	}
+	if err := rs.db.WithContext(ctx).Where("id = ?", 1).First(state).Error; err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (rs *ReplicationService) reconcileDue(ctx context.Context) bool {
+	state, err := rs.state(ctx)
+	if err != nil {
+		return false
+	}
+	return state.ReconciledAt == nil || time.Since(*state.ReconciledAt) >= rs.cnf.Replication.Reconcile
+}
+
+// reconcile walks the files of the primary and of the replica in id order,
+// refetching those that differ and removing those the primary no longer has.
+func (rs *ReplicationService) reconcile(ctx context.Context) error {
+	var removed int64
+	after := ""
+	for {
+		page, err := rs.client.Versions(ctx, after)
+		if err != nil {
+			return err
+		}
+		last := ""
+		if n := len(page.Files); n > 0 {
+			last = page.Files[n-1].ID
+		}
+
+		var local []replication.Version
+		query := rs.db.WithContext(ctx).Model(&models.File{}).Select("id", "updated_at").Where("id > ?", after)
+		if last != "" && len(page.Files) == replicationVersionsPage {
+			query = query.Where("id <= ?", last)
+		}
+		if err := query.Scan(&local).Error; err != nil {
+			return err
+		}
+
+		versions := make(map[string]time.Time, len(local))
+		for _, v := range local {
+			versions[v.ID] = v.UpdatedAt
+		}
+		stale := []string{}
+		for _, v := range page.Files {
+			if updatedAt, ok := versions[v.ID]; !ok || !updatedAt.Equal(v.UpdatedAt) {
+				stale = append(stale, v.ID)
+			}
+			delete(versions, v.ID)
+		}
+		gone := make([]string, 0, len(versions))
+		for id := range versions {
+			gone = append(gone, id)
+		}
+
+		for _, ids := range chunks(stale, replication.PageSize) {
+			files, err := rs.client.Files(ctx, ids)
+			if err != nil {
+				return err
+			}
+			if err := rs.applyFiles(ctx, files); err != nil {
+				return err
+			}
+		}
+		if err := rs.removeFiles(ctx, gone); err != nil {
+			return err
+		}
+		removed += int64(len(gone))
+
+		if len(page.Files) < replicationVersionsPage {
+			break
+		}
+		after = last
+	}
+
+	now := time.Now().UTC()
+	if err := rs.db.WithContext(ctx).Model(&models.ReplicationState{}).Where("id = ?", 1).
+		Update("reconciled_at", now).Error; err != nil {
+		return err
+	}
+	rs.mu.Lock()
+	rs.status.Removed += removed
+	rs.status.LastReconcileAt = &now
+	rs.mu.Unlock()
+	return nil
+}
+
+// removeFiles deletes files gone from the primary, along with the copies the
+// replica made of their messages.
+func (rs *ReplicationService) removeFiles(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var copies []models.ReplicaCopy
+	if err := rs.db.WithContext(ctx).Where("file_id IN ?", ids).Find(&copies).Error; err != nil {
+		return err
+	}
+	byUser := map[int64][]models.ReplicaCopy{}
+	for _, c := range copies {
+		byUser[c.UserID] = append(byUser[c.UserID], c)
+	}
+	for userId, copies := range byUser {
+		err := runWithUserClient(ctx, rs.db, &rs.cnf.TG, userId, func(ctx context.Context, client *telegram.Client, user string) error {
+			for _, c := range copies {
+				if err := deleteCopy(ctx, client, user, &c); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("delete copies of user %d: %w", userId, err)
+		}
+	}
+
+	return rs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id IN ?", ids).Delete(&models.ReplicaCopy{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.File{}).Error
+	})
+}
+
+// mirror points files at copies of their messages in the replica channel of
+// their owner, forwarding the messages of those not copied yet or whose
+// parts changed since.
+func (rs *ReplicationService) mirror(ctx context.Context, files []models.File) error {
+	ids := make([]string, 0, len(files))
+	for _, f := range files {
+		ids = append(ids, f.ID)
+	}
+	var found []models.ReplicaCopy
+	if err := rs.db.WithContext(ctx).Where("file_id IN ?", ids).Find(&found).Error; err != nil {
+		return err
+	}
+	copies := make(map[string]models.ReplicaCopy, len(found))
+	for _, c := range found {
+		copies[c.FileID] = c
+	}
+
+	pending := map[int64][]*models.File{}
+	for i := range files {
+		f := &files[i]
+		if f.Type != "file" || f.Parts == nil || len(*f.Parts) == 0 || f.ChannelID == nil {
+			continue
+		}
+		if c, ok := copies[f.ID]; ok && c.SourceChannelID == *f.ChannelID && slices.Equal(c.SourceParts, *f.Parts) {
+			channelId, parts := c.ChannelID, c.Parts
+			f.ChannelID, f.Parts = &channelId, &parts
+			continue
+		}
+		pending[f.UserID] = append(pending[f.UserID], f)
+	}
+
+	for userId, files := range pending {
+		err := runWithUserClient(ctx, rs.db, &rs.cnf.TG, userId, func(ctx context.Context, client *telegram.Client, user string) error {
+			return rs.forwardFiles(ctx, client, user, userId, files, copies)
+		})
+		if err != nil {
+			return fmt.Errorf("mirror files of user %d: %w", userId, err)
+		}
+	}
+	return nil
+}
+
+func (rs *ReplicationService) forwardFiles(ctx context.Context, client *telegram.Client, user string, userId int64,
+	files []*models.File, copies map[string]models.ReplicaCopy) error {
+	channelId, err := rs.replicaChannel(ctx, client, userId)
+	if err != nil {
+		return err
+	}
+	dest, err := GetChannelById(ctx, client, channelId, user)
+	if err != nil {
+		return err
+	}
+
+	sources := map[int64]*tg.InputChannel{}
+	for _, f := range files {
+		src, ok := sources[*f.ChannelID]
+		if !ok {
+			if src, err = GetChannelById(ctx, client, *f.ChannelID, user); err != nil {
+				return err
+			}
+			sources[*f.ChannelID] = src
+		}
+
+		ids := make([]int, 0, len(*f.Parts))
+		for _, part := range *f.Parts {
+			ids = append(ids, int(part.ID))
+		}
+		copied, err := forwardMessages(ctx, client, src, dest, ids)
+		if err != nil {
+			// the messages may be gone from the primary's channel, the file
+			// keeps pointing at them and is tried again on its next change
+			rs.logger.Warnw("failed to mirror file", "file", f.ID, "err", err)
+			continue
+		}
+
+		parts := make(models.Parts, len(copied))
+		for i, id := range copied {
+			parts[i] = models.Part{ID: int64(id), Salt: (*f.Parts)[i].Salt}
+		}
+		replica := models.ReplicaCopy{FileID: f.ID, UserID: userId, SourceChannelID: *f.ChannelID,
+			SourceParts: *f.Parts, ChannelID: channelId, Parts: parts}
+		if err := rs.db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "file_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "source_channel_id", "source_parts",
+				"channel_id", "parts", "created_at"}),
+		}).Create(&replica).Error; err != nil {
+			return err
+		}
+		if old, ok := copies[f.ID]; ok {
+			if err := deleteCopy(ctx, client, user, &old); err != nil {
+				rs.logger.Warnw("failed to delete outdated copy", "file", f.ID, "err", err)
+			}
+		}
+
+		f.ChannelID, f.Parts = &replica.ChannelID, &replica.Parts
+		rs.mu.Lock()
+		rs.status.Mirrored++
+		rs.mu.Unlock()
+	}
+	return nil
+}
+
+// replicaChannel returns the channel the files of userId are mirrored to,
+// creating it on first use. It is recorded as a channel of the user, not
+// selected, so streams find it.
+func (rs *ReplicationService) replicaChannel(ctx context.Context, client *telegram.Client, userId int64) (int64, error) {
+	var existing models.ReplicaChannel
+	err := rs.db.WithContext(ctx).Where("user_id = ?", userId).First(&existing).Error
+	if err == nil {
+		return existing.ChannelID, nil
+	}
+	if !database.IsRecordNotFoundErr(err) {
+		return 0, err
+	}
+
+	res, err := client.API().ChannelsCreateChannel(ctx, &tg.ChannelsCreateChannelRequest{
+		Broadcast: true,
+		Title:     replicaChannelName,
+		About:     "Copies of files replicated by teldrive",
+	})
+	if err != nil {
+		return 0, err
+	}
+	updates, ok := res.(interface{ GetChats() []tg.ChatClass })
+	if !ok {
+		return 0, errors.New("unexpected response creating channel")
+	}
+	var channel *tg.Channel
+	for _, chat := range updates.GetChats() {
+		if c, ok := chat.(*tg.Channel); ok {
+			channel = c
+			break
+		}
+	}
+	if channel == nil {
+		return 0, errors.New("created channel missing from response")
+	}
+
+	err = rs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.Channel{ChannelID: channel.ID, ChannelName: channel.Title,
+			UserID: userId}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ReplicaChannel{UserID: userId, ChannelID: channel.ID}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return channel.ID, nil
+}
+
+// forwardMessages forwards the messages ids of src into dest without their
+// author and returns the ids of the copies in the same order.
+func forwardMessages(ctx context.Context, client *telegram.Client, src, dest *tg.InputChannel, ids []int) ([]int, error) {
+	copied := make([]int, 0, len(ids))
+	for _, batch := range chunks(ids, 100) {
+		randomIds := make([]int64, len(batch))
+		for i := range randomIds {
+			var err error
+			if randomIds[i], err = randInt64(); err != nil {
+				return nil, err
+			}
+		}
+		res, err := client.API().MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+			Silent:     true,
+			DropAuthor: true,
+			FromPeer:   &tg.InputPeerChannel{ChannelID: src.ChannelID, AccessHash: src.AccessHash},
+			ID:         batch,
+			RandomID:   randomIds,
+			ToPeer:     &tg.InputPeerChannel{ChannelID: dest.ChannelID, AccessHash: dest.AccessHash},
+		})
+		if err != nil {
+			return nil, err
+		}
+		updates, ok := res.(*tg.Updates)
+		if !ok {
+			return nil, fmt.Errorf("unexpected response type: %T", res)
+		}
+		byRandomId := map[int64]int{}
+		for _, update := range updates.Updates {
+			if u, ok := update.(*tg.UpdateMessageID); ok {
+				byRandomId[u.RandomID] = u.ID
+			}
+		}
+		for i, randomId := range randomIds {
+			id, ok := byRandomId[randomId]
+			if !ok {
+				return nil, fmt.Errorf("message %d was not copied", batch[i])
+			}
+			copied = append(copied, id)
+		}
+	}
+	return copied, nil
+}
+
+func deleteCopy(ctx context.Context, client *telegram.Client, user string, c *models.ReplicaCopy) error {
+	channel, err := GetChannelById(ctx, client, c.ChannelID, user)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, len(c.Parts))
+	for _, part := range c.Parts {
+		ids = append(ids, int(part.ID))
+	}
+	for _, batch := range chunks(ids, 100) {
+		if _, err := client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel,
+			ID: batch}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/replication"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	replicationOff     = "off"
+	replicationPrimary = "primary"
+	replicationReplica = "replica"
+)
+
+// replicationVersionsPage is the most file versions a page of reconciliation
+// holds, they are much smaller than files.
+const replicationVersionsPage = 10 * replication.PageSize
+
+// ReplicationService serves the replication feed of a primary and, on a
+// replica, pulls the feed of its primary for as long as the server runs. Pulls
+// follow the cursor of the feed, reconciliation catches what the cursor
+// misses: files deleted on the primary and files updated with an older time.
+// The pulling half lives in replica.go.
+type ReplicationService struct {
+	db     *gorm.DB
+	cnf    *config.Config
+	client *replication.Client
+	logger *zap.SugaredLogger
+	// sessionKey seals sessions on the primary and opens them on the replica
+	sessionKey *[32]byte
+
+	mu     sync.RWMutex
+	status schemas.ReplicationStatus
+}
+
+func NewReplicationService(lc fx.Lifecycle, db *gorm.DB, cnf *config.Config) *ReplicationService {
+	rs := &ReplicationService{db: db, cnf: cnf, logger: logging.DefaultLogger().Named("replication")}
+	if cnf.Replication.SessionKey != "" {
+		// the key was checked when the config was loaded
+		rs.sessionKey, _ = replication.ParseKey(cnf.Replication.SessionKey)
+	}
+
+	switch {
+	case cnf.Replication.PrimaryUrl != "":
+		rs.status.Role = replicationReplica
+		rs.status.PrimaryUrl = cnf.Replication.PrimaryUrl
+		if rs.sessionKey != nil {
+			rs.status.SessionKey, _ = replication.PublicKey(rs.sessionKey)
+		}
+	case cnf.Replication.Token != "":
+		rs.status.Role = replicationPrimary
+		return rs
+	default:
+		rs.status.Role = replicationOff
+		return rs
+	}
+
+	rs.client = replication.NewClient(cnf.Replication.PrimaryUrl, cnf.Replication.Token)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rs.run(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			wg.Wait()
+			return nil
+		},
+	})
+	return rs
+}
+
+// Status reports the role of the instance and, on a replica, its lag.
+func (rs *ReplicationService) Status() *schemas.ReplicationStatus {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	status := rs.status
+	return &status
+}
+
+// Accounts returns the users and channels of the primary, and its sessions
+// sealed to the replica when a session key is set.
+func (rs *ReplicationService) Accounts(ctx context.Context) (*replication.Accounts, *types.AppError) {
+	res := &replication.Accounts{}
+	db := rs.db.WithContext(ctx)
+	if err := db.Order("user_id").Find(&res.Users).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if rs.sessionKey != nil {
+		var sessions []models.Session
+		if err := db.Order("created_at").Find(&sessions).Error; err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+		for _, session := range sessions {
+			sealed, err := replication.SealSession(session.Session, rs.sessionKey)
+			if err != nil {
+				return nil, &types.AppError{Error: err}
+			}
+			res.Sessions = append(res.Sessions, replication.Session{UserID: session.UserId, Hash: session.Hash,
+				Sealed: sealed, CreatedAt: session.CreatedAt})
+		}
+	}
+	if err := db.Order("channel_id").Find(&res.Channels).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
+
+// Changes returns a page of the active files updated after cursor, oldest
+// first.
+func (rs *ReplicationService) Changes(ctx context.Context, cursor replication.Cursor) (*replication.Changes, *types.AppError) {
+	res := &replication.Changes{Next: cursor}
+	db := rs.db.WithContext(ctx)
+	if err := db.Where("status = ?", "active").Where("(updated_at, id) > (?, ?)", cursor.UpdatedAt, cursor.ID).
+		Order("updated_at").Order("id").Limit(replication.PageSize).Find(&res.Files).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if n := len(res.Files); n > 0 {
+		res.Next = replication.Cursor{UpdatedAt: res.Files[n-1].UpdatedAt, ID: res.Files[n-1].ID}
+	}
+
+	var latest *time.Time
+	if err := db.Model(&models.File{}).Where("status = ?", "active").Select("MAX(updated_at)").
+		Scan(&latest).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if latest != nil {
+		res.Latest = *latest
+	}
+	return res, nil
+}
+
+// Versions returns a page of the versions of the active files whose id sorts
+// after after.
+func (rs *ReplicationService) Versions(ctx context.Context, after string) (*replication.Versions, *types.AppError) {
+	res := &replication.Versions{Files: []replication.Version{}}
+	if err := rs.db.WithContext(ctx).Model(&models.File{}).Select("id", "updated_at").
+		Where("status = ?", "active").Where("id > ?", after).Order("id").Limit(replicationVersionsPage).
+		Scan(&res.Files).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
+
+// Files returns the active files among ids, for the replica to refetch those
+// reconciliation found out of date.
+func (rs *ReplicationService) Files(ctx context.Context, in *schemas.ReplicationFiles) ([]models.File, *types.AppError) {
+	files := []models.File{}
+	if err := rs.db.WithContext(ctx).Where("id IN ?", in.IDs).Where("status = ?", "active").
+		Find(&files).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return files, nil
+}
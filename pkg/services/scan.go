@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/scan"
+	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/gotd/td/telegram"
+	"gorm.io/gorm"
+)
+
+// Scan statuses of uploads. Files are pending from their upload until the
+// scanner has read them, and are not served before they are found clean.
+const (
+	scanPending  = "pending"
+	scanClean    = "clean"
+	scanInfected = "infected"
+	scanFailed   = "failed"
+)
+
+// scanBatchSize bounds how many uploads a run of ScanPendingFiles scans.
+const scanBatchSize = 20
+
+// A failed scan is retried after scanRetryBackoff, doubled on every further
+// failure. Files that failed maxScanAttempts scans are quarantined, as they
+// could not be shown to be clean.
+const (
+	scanRetryBackoff = time.Minute
+	maxScanAttempts  = 5
+)
+
+// scanStatus is the scan status of new content of size bytes, nil when it is
+// not going to be scanned.
+func scanStatus(scanner scan.Scanner, maxSize, size int64) *string {
+	if !scan.Enabled(scanner) || (maxSize > 0 && size > maxSize) {
+		return nil
+	}
+	return utils.StringPointer(scanPending)
+}
+
+func (fs *FileService) scanStatus(size int64) *string {
+	return scanStatus(fs.scanner, fs.scanMaxSize, size)
+}
+
+var errAwaitingScan = errors.New("file is waiting for its virus scan")
+
+// awaitingScan tells whether content of status has yet to be found clean.
+func awaitingScan(status string) bool {
+	return status == scanPending || status == scanFailed
+}
+
+// scanQueue keeps runs of ScanPendingFiles from overlapping. A run asked for
+// while another one is going is made by the running one once it is done.
+type scanQueue struct {
+	mu    sync.Mutex
+	again atomic.Bool
+}
+
+// scanSoon scans new uploads right away instead of waiting for the cron.
+func (fs *FileService) scanSoon() {
+	go func() {
+		if err := fs.ScanPendingFiles(context.Background()); err != nil {
+			logging.DefaultLogger().Errorw("failed to scan files", "err", err)
+		}
+	}()
+}
+
+// ScanPendingFiles streams the uploads waiting for a virus scan through the
+// scanner. Files are held from streams, previews and share links until they
+// are found clean, and are quarantined once found infected. Files that were
+// never tried come first, then failed ones whose backoff ran out, so files
+// that cannot be scanned do not hold up the queue.
+func (fs *FileService) ScanPendingFiles(ctx context.Context) error {
+	fs.scans.again.Store(true)
+	if !fs.scans.mu.TryLock() {
+		return nil
+	}
+	defer fs.scans.mu.Unlock()
+	for fs.scans.again.Swap(false) {
+		if err := fs.scanBatch(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *FileService) scanBatch(ctx context.Context) error {
+	var files []models.File
+	if err := fs.db.WithContext(ctx).Where("scan_status IN ?", []string{scanPending, scanFailed}).
+		Where("status = ?", "active").
+		Where("scanned_at IS NULL OR scanned_at < timezone('utc'::text, now()) - "+
+			"interval '1 second' * ? * power(2, greatest(scan_attempts - 1, 0))", scanRetryBackoff.Seconds()).
+		Order("scanned_at NULLS FIRST").Order("created_at").Limit(scanBatchSize).Find(&files).Error; err != nil {
+		return err
+	}
+
+	byUser := make(map[int64][]models.File)
+	for _, file := range files {
+		byUser[file.UserID] = append(byUser[file.UserID], file)
+	}
+
+	logger := logging.FromContext(ctx)
+	for userId, files := range byUser {
+		done := 0
+		err := runWithUserClient(ctx, fs.db, fs.cnf, userId, func(ctx context.Context, client *telegram.Client, user string) error {
+			for _, file := range files {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				status, reason, err := fs.scanFile(ctx, client, file, user)
+				if err != nil {
+					logger.Warnw("failed to scan file", "file", file.ID, "err", err)
+				}
+				if err := fs.recordScan(ctx, &file, status, reason); err != nil {
+					return err
+				}
+				done++
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Errorw("failed to scan files", "user", userId, "err", err)
+			// files left unscanned, as when the user has no working session,
+			// count as failed scans so they move behind the others
+			for _, file := range files[done:] {
+				if err := fs.recordScan(ctx, &file, scanFailed, ""); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (fs *FileService) scanFile(ctx context.Context, client *telegram.Client, file models.File, user string) (string, string, error) {
+	src := mapper.ToFileOutFull(file)
+	if src.Size == 0 {
+		return scanClean, "", nil
+	}
+	r, err := newFileReader(ctx, client, fs.cnf, src, 0, src.Size-1, user)
+	if err != nil {
+		return scanFailed, "", err
+	}
+	defer r.Close()
+	res, err := fs.scanner.Scan(ctx, file.Name, io.LimitReader(r, src.Size))
+	if err != nil {
+		return scanFailed, "", err
+	}
+	if res.Infected {
+		return scanInfected, "infected: " + res.Signature, nil
+	}
+	return scanClean, "", nil
+}
+
+// recordScan stores the outcome of a scan, quarantining infected files and
+// those that failed too many scans.
+func (fs *FileService) recordScan(ctx context.Context, file *models.File, status, reason string) error {
+	updates := map[string]any{"scan_status": status, "scan_attempts": gorm.Expr("scan_attempts + 1"),
+		"scanned_at": gorm.Expr("timezone('utc'::text, now())")}
+	if status == scanFailed && file.ScanAttempts+1 >= maxScanAttempts {
+		reason = "scan failed"
+	}
+	if reason != "" {
+		updates["status"] = statusQuarantined
+		updates["quarantine_reason"] = reason
+		logging.FromContext(ctx).Warnw("quarantined file", "file", file.ID, "user", file.UserID,
+			"reason", reason)
+	}
+	if err := fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).
+		Where("status = ?", "active").Updates(updates).Error; err != nil {
+		return err
+	}
+	// streams of the file must see the quarantine
+	fileCache.Delete(ctx, fileCache.Key(file.ID))
+	return nil
+}
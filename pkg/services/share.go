@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+)
+
+// sharedPermission returns the strongest permission userId was granted on
+// file id or any folder above it, or "" without a grant.
+func (fs *FileService) sharedPermission(ctx context.Context, id string, userId int64) (string, error) {
+	var perms []string
+	if err := fs.db.WithContext(ctx).Raw(`
+	WITH RECURSIVE chain AS (
+		SELECT id, parent_id FROM teldrive.files WHERE id = ?
+		UNION ALL
+		SELECT f.id, f.parent_id FROM teldrive.files f JOIN chain c ON f.id = c.parent_id
+	)
+	SELECT s.permission FROM teldrive.shares s JOIN chain c ON s.file_id = c.id WHERE s.user_id = ?`,
+		id, userId).Scan(&perms).Error; err != nil {
+		return "", err
+	}
+	best := ""
+	for _, p := range perms {
+		if p == PermissionWrite {
+			return p, nil
+		}
+		best = p
+	}
+	return best, nil
+}
+
+// allows reports whether granted satisfies the required permission.
+func allows(granted, required string) bool {
+	return granted == PermissionWrite || (granted == PermissionRead && required == PermissionRead)
+}
+
+// checkAccess fails with not found unless userId owns the file owned by
+// owner or holds a share granting perm on it.
+func (fs *FileService) checkAccess(ctx context.Context, id string, owner, userId int64, perm string) *types.AppError {
+	if owner == userId {
+		return nil
+	}
+	granted, err := fs.sharedPermission(ctx, id, userId)
+	if err != nil {
+		return &types.AppError{Error: err}
+	}
+	if !allows(granted, perm) {
+		return &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	return nil
+}
+
+// accessibleFile loads file id if userId owns it or holds a share granting perm.
+func (fs *FileService) accessibleFile(ctx context.Context, id string, userId int64, perm string) (*models.File, *types.AppError) {
+	var file models.File
+	if err := fs.db.WithContext(ctx).Where("id = ?", id).First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	if err := fs.checkAccess(ctx, id, file.UserID, userId, perm); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// checkItemsAccess resolves the owner of ids, which must all belong to the same
+// user, and fails unless userId owns them or may apply perm to each of them.
+func (fs *FileService) checkItemsAccess(ctx context.Context, userId int64, ids []string, perm string) (int64, *types.AppError) {
+	var owners []int64
+	if err := fs.db.WithContext(ctx).Model(&models.File{}).Distinct("user_id").Where("id IN ?", ids).
+		Pluck("user_id", &owners).Error; err != nil {
+		return 0, &types.AppError{Error: err}
+	}
+	if len(owners) != 1 {
+		return 0, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	if owners[0] == userId {
+		return userId, fs.checkOwned(ctx, userId, ids)
+	}
+	for _, id := range ids {
+		if err := fs.checkAccess(ctx, id, owners[0], userId, perm); err != nil {
+			return 0, err
+		}
+	}
+	return owners[0], fs.checkOwned(ctx, owners[0], ids)
+}
+
+// sharedWith selects the items shared with userId, which make up the
+// "Shared with me" root.
+func (fs *FileService) sharedWith(db *gorm.DB, userId int64) *gorm.DB {
+	return db.Where("id IN (?)", fs.db.Model(&models.Share{}).Select("file_id").Where("user_id = ?", userId))
+}
+
+func (fs *FileService) ShareFile(ctx context.Context, userId int64, id string, payload *schemas.ShareIn) (*schemas.ShareOut, *types.AppError) {
+	if err := fs.checkOwned(ctx, userId, []string{id}); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := fs.db.WithContext(ctx).Where("user_name = ?", payload.UserName).First(&user).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: errors.New("user not found"), Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	if user.UserId == userId {
+		return nil, &types.AppError{Error: errors.New("cannot share with yourself"), Code: http.StatusBadRequest}
+	}
+
+	share := models.Share{FileID: id, OwnerID: userId, UserID: user.UserId, Permission: payload.Permission}
+	if err := fs.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"permission"}),
+	}, clause.Returning{}).Create(&share).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return &schemas.ShareOut{ID: share.ID, UserID: user.UserId, UserName: user.UserName,
+		Permission: share.Permission, CreatedAt: share.CreatedAt}, nil
+}
+
+func (fs *FileService) ListShares(ctx context.Context, userId int64, id string) ([]schemas.ShareOut, *types.AppError) {
+	if err := fs.checkOwned(ctx, userId, []string{id}); err != nil {
+		return nil, err
+	}
+
+	res := []schemas.ShareOut{}
+	if err := fs.db.WithContext(ctx).Model(&models.Share{}).
+		Select("shares.id, shares.user_id, users.user_name, shares.permission, shares.created_at").
+		Joins("JOIN teldrive.users ON users.user_id = shares.user_id").
+		Where("shares.file_id = ?", id).Order("shares.created_at").Scan(&res).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return res, nil
+}
+
+func (fs *FileService) DeleteShare(ctx context.Context, userId int64, id, shareId string) (*schemas.Message, *types.AppError) {
+	res := fs.db.WithContext(ctx).Where("id = ?", shareId).Where("file_id = ?", id).Where("owner_id = ?", userId).
+		Delete(&models.Share{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "share removed"}, nil
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm/clause"
+)
+
+// linkSessionIdle is how long a client can pause between the requests of one
+// download of a share link before its next request counts as another one.
+const linkSessionIdle = 30 * time.Minute
+
+var (
+	errLinkExpired       = errors.New("share link expired")
+	errLinkDownloadLimit = errors.New("share link download limit reached")
+)
+
+func (fs *FileService) CreateShareLink(c *gin.Context, userId int64, id string, payload *schemas.ShareLinkIn) (*schemas.ShareLinkOut, *types.AppError) {
+	baseURL, err := requestBaseURL(c)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	var file models.File
+	if err := fs.db.WithContext(c).Where("id = ?", id).Where("user_id = ?", userId).
+		Where("status = ?", "active").First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	if file.Type != "file" {
+		return nil, &types.AppError{Error: errors.New("only files can be shared by link"), Code: http.StatusBadRequest}
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		return nil, &types.AppError{Error: errors.New("expiry must be in the future"), Code: http.StatusBadRequest}
+	}
+
+	link := &models.ShareLink{FileID: id, OwnerID: userId, MaxDownloads: payload.MaxDownloads,
+		RateLimit: payload.RateLimit, ExpiresAt: payload.ExpiresAt}
+	if err := fs.db.WithContext(c).Clauses(clause.Returning{}).Create(link).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := mapper.ToShareLinkOut(link)
+	res.URL = shareLinkURL(baseURL, &file, link.ID)
+	return res, nil
+}
+
+// ListShareLinks returns the links of a file along with how they were used.
+func (fs *FileService) ListShareLinks(c *gin.Context, userId int64, id string) ([]schemas.ShareLinkOut, *types.AppError) {
+	var file models.File
+	if err := fs.db.WithContext(c).Where("id = ?", id).Where("user_id = ?", userId).First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	var links []models.ShareLink
+	if err := fs.db.WithContext(c).Where("file_id = ?", id).Order("created_at").Find(&links).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	var visitors []struct {
+		LinkID string
+		Count  int64
+	}
+	if err := fs.db.WithContext(c).Model(&models.ShareLinkVisitor{}).Select("link_id, count(*) AS count").
+		Where("link_id IN (?)", fs.db.Model(&models.ShareLink{}).Select("id").Where("file_id = ?", id)).
+		Group("link_id").Scan(&visitors).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	unique := make(map[string]int64, len(visitors))
+	for _, v := range visitors {
+		unique[v.LinkID] = v.Count
+	}
+
+	// links are listed without their url when the server has no public url
+	baseURL, _ := requestBaseURL(c)
+	res := make([]schemas.ShareLinkOut, 0, len(links))
+	for i := range links {
+		out := mapper.ToShareLinkOut(&links[i])
+		if baseURL != "" {
+			out.URL = shareLinkURL(baseURL, &file, links[i].ID)
+		}
+		out.UniqueIPs = unique[links[i].ID]
+		res = append(res, *out)
+	}
+	return res, nil
+}
+
+func (fs *FileService) DeleteShareLink(ctx context.Context, userId int64, id, linkId string) (*schemas.Message, *types.AppError) {
+	res := fs.db.WithContext(ctx).Where("id = ?", linkId).Where("file_id = ?", id).Where("owner_id = ?", userId).
+		Delete(&models.ShareLink{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	fs.linkStreams.forget(linkId)
+	return &schemas.Message{Message: "share link removed"}, nil
+}
+
+func shareLinkURL(baseURL string, file *models.File, linkId string) string {
+	return fmt.Sprintf("%s/api/files/%s/stream/%s?link=%s", baseURL, file.ID, url.PathEscape(file.Name), linkId)
+}
+
+// shareLink loads the link a stream of file id was requested with.
+func (fs *FileService) shareLink(ctx context.Context, id, linkId string) (*models.ShareLink, error) {
+	var link models.ShareLink
+	if err := fs.db.WithContext(ctx).Where("id = ?", linkId).Where("file_id = ?", id).First(&link).Error; err != nil {
+		return nil, errors.New("invalid share link")
+	}
+	if link.ExpiresAt != nil && time.Now().UTC().After(*link.ExpiresAt) {
+		return nil, errLinkExpired
+	}
+	return &link, nil
+}
+
+// admitLinkStream counts a download of link when the request opens a new
+// download session, refusing it once the download limit is reached, and tells
+// whether it did. A session is the requests of one client, whatever the ranges
+// they ask for, until it stays idle for linkSessionIdle.
+func (fs *FileService) admitLinkStream(ctx context.Context, link *models.ShareLink, r *http.Request,
+	ip string) (bool, error) {
+	if r.Method == http.MethodHead {
+		return false, nil
+	}
+	session := link.ID + "\x00" + ip + "\x00" + r.UserAgent()
+	if fs.linkStreams.resume(session) {
+		return false, nil
+	}
+	res := fs.db.WithContext(ctx).Model(&models.ShareLink{}).Where("id = ?", link.ID).
+		Where("max_downloads = 0 OR downloads < max_downloads").
+		Update("downloads", clause.Expr{SQL: "downloads + 1"})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, errLinkDownloadLimit
+	}
+	fs.linkStreams.start(session)
+	return true, nil
+}
+
+// linkLimiter returns the limiter shared by all streams of link, nil when its
+// rate is unlimited.
+func (fs *FileService) linkLimiter(link *models.ShareLink) *rate.Limiter {
+	if link.RateLimit <= 0 {
+		return nil
+	}
+	return fs.linkStreams.limiter(link.ID, link.RateLimit*1024)
+}
+
+// linkStreams holds the download sessions and the rate limiters of share
+// links. Entries left idle for linkSessionIdle are swept, so it only keeps the
+// links streamed lately.
+type linkStreams struct {
+	mu        sync.Mutex
+	sessions  map[string]time.Time
+	limiters  map[string]*linkLimiter
+	lastSweep time.Time
+}
+
+type linkLimiter struct {
+	*rate.Limiter
+	usedAt time.Time
+}
+
+// resume tells whether session is a download in progress, keeping it going.
+func (l *linkStreams) resume(session string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.sweep(now)
+	if at, ok := l.sessions[session]; ok && now.Sub(at) < linkSessionIdle {
+		l.sessions[session] = now
+		return true
+	}
+	return false
+}
+
+func (l *linkStreams) start(session string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sessions == nil {
+		l.sessions = make(map[string]time.Time)
+	}
+	l.sessions[session] = time.Now()
+}
+
+func (l *linkStreams) limiter(linkId string, bytesPerSec int) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.sweep(now)
+	if l.limiters == nil {
+		l.limiters = make(map[string]*linkLimiter)
+	}
+	limiter, ok := l.limiters[linkId]
+	if !ok || limiter.Limit() != rate.Limit(bytesPerSec) {
+		limiter = &linkLimiter{Limiter: rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec)}
+		l.limiters[linkId] = limiter
+	}
+	limiter.usedAt = now
+	return limiter.Limiter
+}
+
+func (l *linkStreams) forget(linkId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.limiters, linkId)
+}
+
+// sweep drops the sessions and limiters left idle. Limiters still draining
+// their bucket serve a stream and are kept.
+func (l *linkStreams) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < linkSessionIdle {
+		return
+	}
+	l.lastSweep = now
+	for session, at := range l.sessions {
+		if now.Sub(at) >= linkSessionIdle {
+			delete(l.sessions, session)
+		}
+	}
+	for id, limiter := range l.limiters {
+		if now.Sub(limiter.usedAt) >= linkSessionIdle && limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(l.limiters, id)
+		}
+	}
+}
+
+// recordLinkStream adds a finished stream to the analytics of link.
+func (fs *FileService) recordLinkStream(ctx context.Context, link *models.ShareLink, ip string, n int64) {
+	ctx = context.WithoutCancel(ctx)
+	db := fs.db.WithContext(ctx)
+	err := db.Model(&models.ShareLink{}).Where("id = ?", link.ID).Updates(map[string]any{
+		"bytes_served":   clause.Expr{SQL: "bytes_served + ?", Vars: []any{n}},
+		"last_access_at": time.Now().UTC(),
+	}).Error
+	if err == nil {
+		err = db.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.ShareLinkVisitor{LinkID: link.ID, IP: ip}).Error
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warnw("failed to record share link stream", "link", link.ID, "err", err)
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+)
+
+// shortcutTarget loads the active file or folder of userId that a shortcut to
+// id points at. Shortcuts to shortcuts point at the final target instead, so
+// a target is never a shortcut itself.
+func (fs *FileService) shortcutTarget(ctx context.Context, userId int64, id string) (*models.File, *types.AppError) {
+	var target models.File
+	if err := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).
+		Where("status = ?", "active").First(&target).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	if target.Type == "shortcut" && target.TargetID != nil {
+		return fs.shortcutTarget(ctx, userId, *target.TargetID)
+	}
+	return &target, nil
+}
+
+// resolvedFile maps file, reading shortcuts to files as their target under
+// the name and id of the shortcut.
+func (fs *FileService) resolvedFile(ctx context.Context, file *models.File) (*schemas.FileOutFull, *types.AppError) {
+	if file.Type != "shortcut" {
+		return mapper.ToFileOutFull(*file), nil
+	}
+	target, err := fs.shortcutTarget(ctx, file.UserID, *file.TargetID)
+	if err != nil {
+		return nil, err
+	}
+	if target.Type == "folder" {
+		out := mapper.ToFileOut(*file)
+		out.TargetType = target.Type
+		return &schemas.FileOutFull{FileOut: out}, nil
+	}
+	res := mapper.ToFileOutFull(*target)
+	res.ID, res.Name, res.Type, res.ParentID = file.ID, file.Name, file.Type, file.ParentID
+	res.TargetID, res.TargetType = target.ID, target.Type
+	return res, nil
+}
+
+// resolveShortcuts fills in the shortcuts of a listing with the size and type
+// of their targets. Shortcuts whose target was deleted are left as they are.
+func (fs *FileService) resolveShortcuts(ctx context.Context, userId int64, files []schemas.FileOut) error {
+	ids := []string{}
+	for _, file := range files {
+		if file.Type == "shortcut" && file.TargetID != "" {
+			ids = append(ids, file.TargetID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var targets []models.File
+	if err := fs.db.WithContext(ctx).Select("id", "type", "mime_type", "category", "size", "encrypted").
+		Where("id IN ?", ids).Where("user_id = ?", userId).Where("status = ?", "active").
+		Find(&targets).Error; err != nil {
+		return err
+	}
+	byId := make(map[string]*models.File, len(targets))
+	for i := range targets {
+		byId[targets[i].ID] = &targets[i]
+	}
+	for i := range files {
+		target, ok := byId[files[i].TargetID]
+		if files[i].Type != "shortcut" || !ok {
+			continue
+		}
+		files[i].TargetType = target.Type
+		files[i].MimeType = target.MimeType
+		files[i].Category = target.Category
+		files[i].Encrypted = target.Encrypted
+		if target.Size != nil {
+			files[i].Size = *target.Size
+		}
+	}
+	return nil
+}
+
+// copyShortcut copies a shortcut as another shortcut to the same target.
+func (fs *FileService) copyShortcut(ctx context.Context, userId int64, file *models.File, payload *schemas.Copy) (*schemas.FileOut, *types.AppError) {
+	dest, err := createDirectories(ctx, fs.db, userId, payload.Destination)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	dbFile := models.File{Name: payload.Name, Type: file.Type, MimeType: file.MimeType, Category: file.Category,
+		TargetID: file.TargetID, UserID: userId, Status: "active", ParentID: dest}
+	if err := fs.db.WithContext(ctx).Create(&dbFile).Error; err != nil {
+		if database.IsKeyConflictErr(err) {
+			return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return mapper.ToFileOut(dbFile), nil
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// snapshotTree copies the active entries under a folder into a snapshot, with
+// their paths relative to the folder. Shortcuts are left out, they point at
+// live files rather than hold content.
+const snapshotTree = `
+WITH RECURSIVE tree AS (
+	SELECT id, type, name::text AS rel, ''::text AS parent FROM teldrive.files
+	WHERE parent_id = @folder AND user_id = @user AND status = 'active'
+	UNION ALL
+	SELECT f.id, f.type, t.rel || '/' || f.name, t.rel FROM teldrive.files f
+	JOIN tree t ON f.parent_id = t.id
+	WHERE t.type = 'folder' AND f.status = 'active'
+)
+INSERT INTO teldrive.snapshot_files (snapshot_id, path, parent, name, type, mime_type, size, parts, channel_id,
+	encrypted, checksum, updated_at)
+SELECT @snapshot, t.rel, t.parent, f.name, f.type, f.mime_type, f.size, f.parts, f.channel_id, f.encrypted,
+	f.checksum, f.updated_at
+FROM tree t JOIN teldrive.files f ON f.id = t.id
+WHERE t.type <> 'shortcut'`
+
+// heldParts selects the messages among @ids of a channel that are referenced
+// by more files and snapshot entries than those in @exclude, which are about
+// to be purged. References are counted in part_refs by triggers. Imported
+// messages are always held.
+const heldParts = `
+SELECT r.message_id FROM teldrive.part_refs r
+WHERE r.channel_id = @channel AND r.message_id IN @ids AND r.refs > (
+	SELECT count(DISTINCT f.id) FROM teldrive.files f, jsonb_array_elements(f.parts) p
+	WHERE f.id IN @exclude AND f.channel_id = r.channel_id AND (p->>'id')::bigint = r.message_id)
+UNION
+SELECT i.message_id FROM teldrive.imported_parts i WHERE i.channel_id = @channel AND i.message_id IN @ids`
+
+// ReleasableParts returns the messages among ids of a channel that can be
+// deleted along with the files in exclude, those whose last reference goes
+// with them. Messages still held by other files, or by snapshots, and those
+// of imported channels are left out.
+func ReleasableParts(ctx context.Context, db *gorm.DB, channelId int64, ids []int, exclude []string) ([]int, error) {
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	if exclude == nil {
+		exclude = []string{}
+	}
+	var held []int
+	if err := db.WithContext(ctx).Raw(heldParts, map[string]any{"channel": channelId, "ids": ids,
+		"exclude": exclude}).Scan(&held).Error; err != nil {
+		return nil, err
+	}
+	if len(held) == 0 {
+		return ids, nil
+	}
+	skip := make(map[int]bool, len(held))
+	for _, id := range held {
+		skip[id] = true
+	}
+	res := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !skip[id] {
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
+
+// CreateSnapshot freezes the current state of a folder. Only metadata is
+// copied, the entries share the messages of the files.
+func (fs *FileService) CreateSnapshot(ctx context.Context, userId int64, in *schemas.SnapshotIn) (*schemas.SnapshotOut, *types.AppError) {
+	var folder models.File
+	if err := fs.db.WithContext(ctx).Where("id = ?", in.FolderID).Where("user_id = ?", userId).
+		Where("type = ?", "folder").Where("status = ?", "active").First(&folder).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	snapshot := &models.Snapshot{UserID: userId, FolderID: &folder.ID, Path: folder.Path, Name: in.Name}
+	err := fs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(snapshot).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(snapshotTree, map[string]any{"folder": folder.ID, "user": userId,
+			"snapshot": snapshot.ID}).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE teldrive.snapshots s SET files = t.files, size = t.size
+		FROM (SELECT count(*) FILTER (WHERE type = 'file') AS files, coalesce(sum(size), 0) AS size
+		FROM teldrive.snapshot_files WHERE snapshot_id = ?) t WHERE s.id = ?`, snapshot.ID, snapshot.ID).Error
+	})
+	if database.IsKeyConflictErr(err) {
+		return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if err := fs.db.WithContext(ctx).First(snapshot, "id = ?", snapshot.ID).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return mapper.ToSnapshotOut(snapshot), nil
+}
+
+func (fs *FileService) ListSnapshots(ctx context.Context, userId int64) ([]schemas.SnapshotOut, *types.AppError) {
+	var snapshots []models.Snapshot
+	if err := fs.db.WithContext(ctx).Where("user_id = ?", userId).Order("path").Order("created_at DESC").
+		Find(&snapshots).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res := make([]schemas.SnapshotOut, 0, len(snapshots))
+	for i := range snapshots {
+		res = append(res, *mapper.ToSnapshotOut(&snapshots[i]))
+	}
+	return res, nil
+}
+
+func (fs *FileService) snapshot(ctx context.Context, userId int64, id string) (*models.Snapshot, *types.AppError) {
+	var snapshot models.Snapshot
+	if err := fs.db.WithContext(ctx).Where("id = ?", id).Where("user_id = ?", userId).First(&snapshot).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return &snapshot, nil
+}
+
+// ListSnapshotFiles returns the entries of a snapshot in the folder at dir,
+// relative to the snapshotted folder, folders first.
+func (fs *FileService) ListSnapshotFiles(ctx context.Context, userId int64, id, dir string) ([]schemas.SnapshotEntry, *types.AppError) {
+	if _, appErr := fs.snapshot(ctx, userId, id); appErr != nil {
+		return nil, appErr
+	}
+	dir = path.Clean("/" + dir)[1:]
+	var files []models.SnapshotFile
+	if err := fs.db.WithContext(ctx).Where("snapshot_id = ?", id).Where("parent = ?", dir).
+		Order("type DESC").Order("name").Find(&files).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	res := make([]schemas.SnapshotEntry, 0, len(files))
+	for i := range files {
+		res = append(res, *mapper.ToSnapshotEntry(&files[i]))
+	}
+	return res, nil
+}
+
+// RestoreSnapshot recreates the entries of a snapshot under a new folder. The
+// restored files share the messages of the snapshot.
+func (fs *FileService) RestoreSnapshot(c *gin.Context, userId int64, id string, in *schemas.SnapshotRestore) (*schemas.Message, *types.AppError) {
+	snapshot, appErr := fs.snapshot(c, userId, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+	dest := in.Destination
+	if dest == "" {
+		dest = snapshot.Path + " (" + snapshot.Name + ")"
+	}
+	dest = path.Clean(dest)
+
+	var count int64
+	if err := fs.db.WithContext(c).Model(&models.File{}).Where("user_id = ?", userId).Where("path = ?", dest).
+		Where("status = ?", "active").Count(&count).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if count > 0 {
+		return nil, &types.AppError{Error: errors.New("restore destination already exists"), Code: http.StatusConflict}
+	}
+
+	var entries []models.SnapshotFile
+	if err := fs.db.WithContext(c).Where("snapshot_id = ?", id).Order("path").Find(&entries).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	err := fs.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		folders := map[string]string{}
+		folder := func(rel string) (string, error) {
+			if id, ok := folders[rel]; ok {
+				return id, nil
+			}
+			id, err := createDirectories(c, tx, userId, path.Join(dest, rel))
+			if err == nil {
+				folders[rel] = id
+			}
+			return id, err
+		}
+		if _, err := folder(""); err != nil {
+			return err
+		}
+		files := []models.File{}
+		for _, entry := range entries {
+			if entry.Type == "folder" {
+				if _, err := folder(entry.Path); err != nil {
+					return err
+				}
+				continue
+			}
+			parentId, err := folder(entry.Parent)
+			if err != nil {
+				return err
+			}
+			files = append(files, models.File{Name: entry.Name, Type: "file", MimeType: entry.MimeType,
+				ParentID: parentId, Size: entry.Size, Parts: entry.Parts, ChannelID: entry.ChannelID,
+				Encrypted: entry.Encrypted, Checksum: entry.Checksum, UserID: userId, Status: "active"})
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&files, deleteBatchSize).Error
+	})
+	if database.IsKeyConflictErr(err) {
+		return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
+	}
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "snapshot restored to " + dest}, nil
+}
+
+// DeleteSnapshot removes a snapshot and deletes the messages only it held,
+// those of files deleted since it was taken.
+func (fs *FileService) DeleteSnapshot(c *gin.Context, userId int64, id string) (*schemas.Message, *types.AppError) {
+	if _, appErr := fs.snapshot(c, userId, id); appErr != nil {
+		return nil, appErr
+	}
+
+	var entries []models.SnapshotFile
+	if err := fs.db.WithContext(c).Select("channel_id", "parts").Where("snapshot_id = ?", id).
+		Where("parts IS NOT NULL").Find(&entries).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if err := fs.db.WithContext(c).Where("id = ?", id).Delete(&models.Snapshot{}).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	byChannel := make(map[int64][]int)
+	for _, entry := range entries {
+		if entry.ChannelID == nil {
+			continue
+		}
+		for _, part := range *entry.Parts {
+			byChannel[*entry.ChannelID] = append(byChannel[*entry.ChannelID], int(part.ID))
+		}
+	}
+	_, session := GetUserAuth(c)
+	for channelId, ids := range byChannel {
+		ids, err := ReleasableParts(c, fs.db, channelId, ids, nil)
+		if err == nil && len(ids) > 0 {
+			err = DeleteTGMessages(c, fs.cnf, session, channelId, userId, ids)
+		}
+		if err != nil {
+			// the orphan finder picks up what is left behind
+			logging.FromContext(c).Warnw("failed to delete snapshot messages", "snapshot", id, "err", err)
+		}
+	}
+	return &schemas.Message{Message: "snapshot deleted"}, nil
+}
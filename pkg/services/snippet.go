@@ -0,0 +1,132 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/divyam234/teldrive/internal/category"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+)
+
+// maxSnippetSize bounds request bodies accepted by UploadSnippet. Anything
+// larger should go through the regular multipart upload.
+const maxSnippetSize = 4 * 1024 * 1024
+
+// UploadSnippet stores the raw request body as a file in a single message,
+// creating the destination folder when needed.
+func (fs *FileService) UploadSnippet(c *gin.Context, userId int64, query *schemas.SnippetQuery) (*schemas.FileOut, *types.AppError) {
+	if query.Encrypted && fs.cnf.Uploads.EncryptionKey == "" {
+		return nil, &types.AppError{Error: errors.New("encryption key not found"), Code: http.StatusBadRequest}
+	}
+
+	if query.Name != path.Base(query.Name) || query.Name == "." || query.Name == "/" {
+		return nil, &types.AppError{Error: errors.New("invalid file name"), Code: http.StatusBadRequest}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSnippetSize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, &types.AppError{Error: errors.New("snippet too large"), Code: http.StatusRequestEntityTooLarge}
+		}
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	if len(body) == 0 {
+		return nil, &types.AppError{Error: errors.New("empty snippet"), Code: http.StatusBadRequest}
+	}
+
+	parentId, err := createDirectories(c, fs.db, userId, query.Path)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	var count int64
+	if err := fs.db.WithContext(c).Model(&models.File{}).Where("parent_id = ?", parentId).
+		Where("name = ?", query.Name).Where("user_id = ?", userId).Where("status = ?", "active").
+		Count(&count).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if count > 0 {
+		return nil, &types.AppError{Error: errors.New("file already exists"), Code: http.StatusConflict}
+	}
+
+	channelId, err := GetDefaultChannel(c, fs.db, userId)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(c.ContentType())
+	if mimeType == "" || mimeType == "application/x-www-form-urlencoded" {
+		mimeType = mime.TypeByExtension(path.Ext(query.Name))
+	}
+	if mimeType == "" {
+		mimeType = "text/plain"
+	}
+
+	size := int64(len(body))
+	dbFile := models.File{
+		Name:       query.Name,
+		Type:       "file",
+		MimeType:   mimeType,
+		Category:   string(category.GetCategory(query.Name)),
+		Size:       &size,
+		ChannelID:  &channelId,
+		ParentID:   parentId,
+		UserID:     userId,
+		Status:     "active",
+		Encrypted:  query.Encrypted,
+		ScanStatus: fs.scanStatus(size),
+	}
+	if appErr := applyUploadPolicy(fs.uploadPolicy, &dbFile, size); appErr != nil {
+		return nil, appErr
+	}
+
+	_, session := GetUserAuth(c)
+
+	client, err := tgc.AuthClient(c, fs.cnf, session)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	var out *schemas.FileOut
+
+	err = tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
+		channel, err := GetChannelById(ctx, client, channelId, strconv.FormatInt(userId, 10))
+		if err != nil {
+			return err
+		}
+
+		parts, err := uploadParts(ctx, client, fs.cnf, fs.live.Load().ChunkSize, channel, query.Name, bytes.NewReader(body), size, query.Encrypted, nil)
+		if err != nil {
+			deleteParts(ctx, client, channel, parts)
+			return err
+		}
+		dbFile.Parts = &parts
+
+		if err := fs.db.WithContext(ctx).Create(&dbFile).Error; err != nil {
+			deleteParts(ctx, client, channel, parts)
+			return err
+		}
+
+		out = mapper.ToFileOut(dbFile)
+		return nil
+	})
+
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return out, nil
+}
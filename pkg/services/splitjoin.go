@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/divyam234/teldrive/internal/category"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SplitFile cuts a file into in.Pieces files named after it with a numbered
+// extension, as the split tool does. Pieces take whole parts of the file, so
+// nothing is uploaded again, and the file is removed without deleting them.
+func (fs *FileService) SplitFile(c *gin.Context, userId int64, id string, in *schemas.FileSplit) ([]schemas.FileOut, *types.AppError) {
+	var file models.File
+	if err := fs.db.WithContext(c).Where("id = ?", id).Where("user_id = ?", userId).Where("type = ?", "file").
+		Where("status = ?", "active").First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	if file.Parts == nil || len(*file.Parts) < in.Pieces {
+		count := 0
+		if file.Parts != nil {
+			count = len(*file.Parts)
+		}
+		return nil, &types.AppError{Error: fmt.Errorf("file has %d parts and cannot be cut in more pieces", count),
+			Code: http.StatusBadRequest}
+	}
+
+	sizes, err := fs.partSizes(c, []models.File{file})
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	parts := *file.Parts
+	pieces := make([]models.File, 0, in.Pieces)
+	base, extra := len(parts)/in.Pieces, len(parts)%in.Pieces
+	for i, from := 0, 0; i < in.Pieces; i++ {
+		to := from + base
+		if i < extra {
+			to++
+		}
+		pieceParts := append(models.Parts{}, parts[from:to]...)
+		var size int64
+		for _, s := range sizes[0][from:to] {
+			size += s
+		}
+		name := fmt.Sprintf("%s.%03d", file.Name, i+1)
+		pieces = append(pieces, models.File{Name: name, Type: "file", MimeType: "application/octet-stream",
+			Category: string(category.GetCategory(name)), ParentID: file.ParentID, Parts: &pieceParts,
+			ChannelID: file.ChannelID, Size: &size, Encrypted: file.Encrypted, Hidden: file.Hidden,
+			UserID: userId, Status: "active", ScanStatus: fs.scanStatus(size)})
+		if appErr := applyUploadPolicy(fs.uploadPolicy, &pieces[i], size); appErr != nil {
+			return nil, appErr
+		}
+		from = to
+	}
+
+	audits := orgAudits(c, fs.db, userId, "file.delete", []string{file.ID})
+	if appErr := fs.replaceFiles(c, []string{file.ID}, pieces); appErr != nil {
+		return nil, appErr
+	}
+	saveOrgAudits(c, fs.db, audits)
+
+	res := make([]schemas.FileOut, 0, len(pieces))
+	ids := make([]string, 0, len(pieces))
+	for _, piece := range pieces {
+		res = append(res, *mapper.ToFileOut(piece))
+		ids = append(ids, piece.ID)
+	}
+	recordOrgAudit(c, fs.db, userId, "file.create", ids)
+	return res, nil
+}
+
+// JoinFiles joins files into one by chaining their parts, the reverse of
+// SplitFile. Readers locate a byte by dividing its offset by the size of the
+// first part, so every part but the last one has to be of that size, which
+// holds for pieces split from the same file.
+func (fs *FileService) JoinFiles(c *gin.Context, userId int64, in *schemas.FileJoin) (*schemas.FileOut, *types.AppError) {
+	var found []models.File
+	if err := fs.db.WithContext(c).Where("id IN ?", in.Files).Where("user_id = ?", userId).Where("type = ?", "file").
+		Where("status = ?", "active").Find(&found).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	byId := make(map[string]models.File, len(found))
+	for _, file := range found {
+		byId[file.ID] = file
+	}
+	files := make([]models.File, 0, len(in.Files))
+	for _, id := range in.Files {
+		file, ok := byId[id]
+		if !ok {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		if file.Parts == nil || len(*file.Parts) == 0 || file.ChannelID == nil {
+			return nil, &types.AppError{Error: fmt.Errorf("%s has no parts", file.Name), Code: http.StatusBadRequest}
+		}
+		if len(files) > 0 && (*file.ChannelID != *files[0].ChannelID || file.Encrypted != files[0].Encrypted) {
+			return nil, &types.AppError{Error: fmt.Errorf("%s is not stored like the other pieces", file.Name),
+				Code: http.StatusBadRequest}
+		}
+		files = append(files, file)
+		delete(byId, id)
+	}
+
+	sizes, err := fs.partSizes(c, files)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	parts := models.Parts{}
+	var all []int64
+	for i, file := range files {
+		parts = append(parts, *file.Parts...)
+		all = append(all, sizes[i]...)
+	}
+	var size int64
+	for i, s := range all {
+		if (i < len(all)-1 && s != all[0]) || s > all[0] {
+			return nil, &types.AppError{Error: fmt.Errorf("pieces are not cut along parts of %d bytes", all[0]),
+				Code: http.StatusBadRequest}
+		}
+		size += s
+	}
+
+	joined := models.File{Name: in.Name, Type: "file", Category: string(category.GetCategory(in.Name)),
+		ParentID: files[0].ParentID, Parts: &parts, ChannelID: files[0].ChannelID, Size: &size,
+		Encrypted: files[0].Encrypted, Hidden: files[0].Hidden, UserID: userId, Status: "active",
+		ScanStatus: fs.scanStatus(size)}
+	joined.MimeType = fs.uploadedMimeType(c, userId, *joined.ChannelID, &schemas.FileIn{Name: in.Name,
+		Parts: []schemas.Part{{ID: parts[0].ID}}})
+	if appErr := applyUploadPolicy(fs.uploadPolicy, &joined, size); appErr != nil {
+		return nil, appErr
+	}
+
+	audits := orgAudits(c, fs.db, userId, "file.delete", in.Files)
+	if appErr := fs.replaceFiles(c, in.Files, []models.File{joined}); appErr != nil {
+		return nil, appErr
+	}
+	saveOrgAudits(c, fs.db, audits)
+	recordOrgAudit(c, fs.db, userId, "file.create", []string{joined.ID})
+	return mapper.ToFileOut(joined), nil
+}
+
+// replaceFiles removes the rows of ids and creates files in their place. The
+// messages of the removed rows are not deleted, the created files hold them.
+func (fs *FileService) replaceFiles(ctx context.Context, ids []string, files []models.File) *types.AppError {
+	err := fs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id IN ?", ids).Delete(&models.File{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&files).Error
+	})
+	if database.IsKeyConflictErr(err) {
+		return &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
+	}
+	if err != nil {
+		return &types.AppError{Error: err}
+	}
+	return nil
+}
+
+// partSizes returns the size of every part of each file, as readers see them,
+// which takes asking Telegram for the messages.
+func (fs *FileService) partSizes(c *gin.Context, files []models.File) ([][]int64, error) {
+	userId, session := GetUserAuth(c)
+	client, err := tgc.AuthClient(c, fs.cnf, session)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([][]int64, 0, len(files))
+	err = tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
+		user := strconv.FormatInt(userId, 10)
+		for _, file := range files {
+			parts, err := getParts(ctx, client, mapper.ToFileOutFull(file), user)
+			if err != nil {
+				return err
+			}
+			s := make([]int64, 0, len(parts))
+			for _, part := range parts {
+				if file.Encrypted {
+					s = append(s, part.DecryptedSize)
+				} else {
+					s = append(s, part.Size)
+				}
+			}
+			sizes = append(sizes, s)
+		}
+		return nil
+	})
+	return sizes, err
+}
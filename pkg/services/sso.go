@@ -0,0 +1,235 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/auth"
+	"github.com/divyam234/teldrive/internal/middleware"
+	"github.com/divyam234/teldrive/internal/oidc"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	oidcLinkCookie = "oidc-link"
+	// oidcStateCookie ties a sign-in to the browser that started it, so a
+	// callback carrying someone else's code is refused.
+	oidcStateCookie = "oidc-state"
+	oidcStateTTL    = 10 * time.Minute
+	// oidcLinkTTL is how long a signed in identity waits for a Telegram login
+	// to link it to.
+	oidcLinkTTL = 15 * time.Minute
+)
+
+var errNoTelegramSession = errors.New("no telegram session")
+
+// oidcLogin is what a sign-in started by OIDCLogin is completed with.
+type oidcLogin struct {
+	Nonce       string
+	Verifier    string
+	RedirectURL string
+}
+
+// oidcLink is the identity a Telegram login links to.
+type oidcLink struct {
+	Issuer  string `json:"iss"`
+	Subject string `json:"sub"`
+	Expires int64  `json:"exp"`
+}
+
+func (as *AuthService) GetOIDCConfig() *schemas.OIDCConfig {
+	return &schemas.OIDCConfig{Enabled: as.oidc != nil, Enforce: as.cnf.OIDC.Enforce}
+}
+
+func (as *AuthService) oidcRedirectURL(c *gin.Context) (string, error) {
+	if as.cnf.OIDC.RedirectUrl != "" {
+		return as.cnf.OIDC.RedirectUrl, nil
+	}
+	base, err := requestBaseURL(c)
+	if err != nil {
+		return "", err
+	}
+	return base + "/api/auth/oidc/callback", nil
+}
+
+// OIDCLogin returns the provider page the user signs in on.
+func (as *AuthService) OIDCLogin(c *gin.Context) (string, *types.AppError) {
+	if as.oidc == nil {
+		return "", &types.AppError{Error: errors.New("single sign-on is not enabled"), Code: http.StatusNotFound}
+	}
+
+	redirectURL, err := as.oidcRedirectURL(c)
+	if err != nil {
+		return "", &types.AppError{Error: err}
+	}
+
+	state := oidc.RandomString()
+	login := oidcLogin{Nonce: oidc.RandomString(), Verifier: oidc.RandomString(), RedirectURL: redirectURL}
+
+	url, err := as.oidc.AuthCodeURL(c, login.RedirectURL, state, login.Nonce, login.Verifier)
+	if err != nil {
+		return "", &types.AppError{Error: err, Code: http.StatusBadGateway}
+	}
+	if err := oidcLoginCache.Set(c, oidcLoginCache.Key(state), login); err != nil {
+		return "", &types.AppError{Error: err}
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcStateTTL.Seconds()), middleware.BasePath(c)+"/", "", false, true)
+	return url, nil
+}
+
+// OIDCCallback completes a sign-in and returns where to send the user next:
+// the drive when the identity is linked to a Telegram account with a session,
+// the login page to link one otherwise.
+func (as *AuthService) OIDCCallback(c *gin.Context, query *schemas.OIDCCallback) (string, *types.AppError) {
+	if as.oidc == nil {
+		return "", &types.AppError{Error: errors.New("single sign-on is not enabled"), Code: http.StatusNotFound}
+	}
+	if query.Error != "" {
+		return "", &types.AppError{Error: errors.New("sign-in failed: " + query.Error + " " + query.ErrorDescription),
+			Code: http.StatusUnauthorized}
+	}
+
+	state, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(state), []byte(query.State)) != 1 {
+		return "", &types.AppError{Error: errors.New("sign-in was not started from this browser"),
+			Code: http.StatusBadRequest}
+	}
+	c.SetCookie(oidcStateCookie, "", -1, middleware.BasePath(c)+"/", "", false, true)
+
+	key := oidcLoginCache.Key(query.State)
+	login, ok := oidcLoginCache.Get(c, key)
+	if !ok {
+		return "", &types.AppError{Error: errors.New("sign-in expired, start again"), Code: http.StatusBadRequest}
+	}
+	oidcLoginCache.Delete(c, key)
+
+	claims, err := as.oidc.Exchange(c, login.RedirectURL, query.Code, login.Verifier, login.Nonce)
+	if err != nil {
+		return "", &types.AppError{Error: err, Code: http.StatusUnauthorized}
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.PreferredUsername
+	}
+	now := time.Now().UTC()
+	identity := &models.Identity{Issuer: claims.Issuer, Subject: claims.Subject, Email: claims.Email, Name: name,
+		LastLoginAt: &now}
+	if err := as.db.WithContext(c).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "issuer"}, {Name: "subject"}},
+		DoUpdates: clause.AssignmentColumns([]string{"email", "name", "last_login_at"}),
+	}).Create(identity).Error; err != nil {
+		return "", &types.AppError{Error: err}
+	}
+	if err := as.db.WithContext(c).Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).
+		First(identity).Error; err != nil {
+		return "", &types.AppError{Error: err}
+	}
+
+	home := middleware.BasePath(c) + "/"
+
+	if identity.UserID != nil {
+		err := as.startSSOSession(c, *identity.UserID, identity.Subject)
+		if err == nil {
+			return home, nil
+		}
+		if !errors.Is(err.Error, errNoTelegramSession) {
+			return "", err
+		}
+	}
+
+	token, err := auth.Seal(as.cnf.JWT.Secret, &oidcLink{Issuer: identity.Issuer, Subject: identity.Subject,
+		Expires: now.Add(oidcLinkTTL).Unix()})
+	if err != nil {
+		return "", &types.AppError{Error: err}
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcLinkCookie, token, int(oidcLinkTTL.Seconds()), home, "", false, true)
+	return home + "login", nil
+}
+
+// startSSOSession logs the user in with the latest Telegram session of the
+// account the identity is linked to.
+func (as *AuthService) startSSOSession(c *gin.Context, userId int64, subject string) *types.AppError {
+	var user models.User
+	if err := as.db.WithContext(c).Where("user_id = ?", userId).First(&user).Error; err != nil {
+		return &types.AppError{Error: err}
+	}
+	if user.Disabled {
+		return &types.AppError{Error: errors.New("user disabled"), Code: http.StatusUnauthorized}
+	}
+
+	session, err := getLatestSession(c, as.db, userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &types.AppError{Error: errNoTelegramSession}
+	}
+	if err != nil {
+		return &types.AppError{Error: err}
+	}
+
+	now := time.Now().UTC()
+	jwtClaims := &types.JWTClaims{Claims: jwt.Claims{
+		Subject:  strconv.FormatInt(userId, 10),
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(as.cnf.JWT.SessionTime)),
+	}, TgSession: session.Session,
+		Name:      user.Name,
+		UserName:  user.UserName,
+		IsPremium: user.IsPremium,
+		Hash:      session.Hash,
+		Identity:  subject,
+	}
+	jweToken, err := auth.Encode(as.cnf.JWT.Secret, jwtClaims)
+	if err != nil {
+		return &types.AppError{Error: err}
+	}
+
+	as.recordLogin(c, userId, user.UserName)
+	setSessionCookie(c, jweToken, int(as.cnf.JWT.SessionTime.Seconds()))
+	return nil
+}
+
+// pendingLink returns the identity signed in through the provider that waits
+// for a Telegram login, if any.
+func (as *AuthService) pendingLink(c *gin.Context) *oidcLink {
+	if as.oidc == nil {
+		return nil
+	}
+	cookie, err := c.Cookie(oidcLinkCookie)
+	if err != nil {
+		return nil
+	}
+	var link oidcLink
+	if err := auth.Open(as.cnf.JWT.Secret, cookie, &link); err != nil || time.Now().Unix() > link.Expires {
+		return nil
+	}
+	return &link
+}
+
+// linkIdentity ties the identity to the Telegram account userId. An identity
+// stays linked to the account it was first linked to.
+func (as *AuthService) linkIdentity(c *gin.Context, link *oidcLink, userId int64) *types.AppError {
+	res := as.db.WithContext(c).Model(&models.Identity{}).
+		Where("issuer = ? AND subject = ?", link.Issuer, link.Subject).
+		Where("user_id IS NULL OR user_id = ?", userId).
+		Update("user_id", userId)
+	if res.Error != nil {
+		return &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return &types.AppError{Error: errors.New("identity is linked to another telegram account"),
+			Code: http.StatusConflict}
+	}
+	c.SetCookie(oidcLinkCookie, "", -1, middleware.BasePath(c)+"/", "", false, true)
+	return nil
+}
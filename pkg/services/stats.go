@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// storageRollup names the stat_rollups row of the storage stats.
+const storageRollup = "storage"
+
+// rollupLag keeps the rollup behind the clock, so files inserted by
+// transactions that are still open when it runs are not skipped.
+const rollupLag = 5 * time.Minute
+
+const defaultTimelineDays = 30
+
+const rollupAddedQuery = `
+INSERT INTO teldrive.storage_stats AS s (user_id, day, category, added_bytes, added_files)
+SELECT user_id, created_at::date, COALESCE(NULLIF(category, ''), 'other'), COALESCE(SUM(size), 0), COUNT(*)
+FROM teldrive.files WHERE type = 'file' AND %s
+GROUP BY 1, 2, 3
+ON CONFLICT (user_id, day, category) DO UPDATE SET
+added_bytes = s.added_bytes + EXCLUDED.added_bytes, added_files = s.added_files + EXCLUDED.added_files`
+
+const rollupRemovedQuery = `
+INSERT INTO teldrive.storage_stats AS s (user_id, day, category, removed_bytes, removed_files)
+SELECT user_id, timezone('utc'::text, now())::date, COALESCE(NULLIF(category, ''), 'other'), COALESCE(SUM(size), 0), COUNT(*)
+FROM teldrive.files WHERE type = 'file' AND id IN @ids
+GROUP BY 1, 2, 3
+ON CONFLICT (user_id, day, category) DO UPDATE SET
+removed_bytes = s.removed_bytes + EXCLUDED.removed_bytes, removed_files = s.removed_files + EXCLUDED.removed_files`
+
+// lockRollup returns the time the storage stats are rolled up to, locking it
+// with strength until tx ends. The rollup takes it for update, purges only
+// share it so they do not wait on each other.
+func lockRollup(tx *gorm.DB, strength string) (time.Time, error) {
+	var until time.Time
+	if err := tx.Exec("INSERT INTO teldrive.stat_rollups (name, rolled_until) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		storageRollup, time.Time{}).Error; err != nil {
+		return until, err
+	}
+	err := tx.Raw("SELECT rolled_until FROM teldrive.stat_rollups WHERE name = ? FOR "+strength, storageRollup).
+		Scan(&until).Error
+	return until, err
+}
+
+// RollupStorageStats folds the files uploaded since the last run into the
+// daily storage stats. Removals are booked by PurgeFiles when the messages of
+// a file are gone, so files in the trash still count as stored.
+func RollupStorageStats(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		from, err := lockRollup(tx, "UPDATE")
+		if err != nil {
+			return err
+		}
+		to := time.Now().UTC().Add(-rollupLag)
+		if !to.After(from) {
+			return nil
+		}
+		if err := tx.Exec(fmt.Sprintf(rollupAddedQuery, "created_at > @from AND created_at <= @to"),
+			sql.Named("from", from), sql.Named("to", to)).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE teldrive.stat_rollups SET rolled_until = ? WHERE name = ?", to, storageRollup).Error
+	})
+}
+
+// PurgeFiles deletes the rows of files whose messages were deleted and books
+// them as removed in today's storage stats.
+func PurgeFiles(ctx context.Context, db *gorm.DB, ids []string) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		from, err := lockRollup(tx, "SHARE")
+		if err != nil {
+			return err
+		}
+		// files purged by a concurrent call are only booked once
+		var locked []string
+		if err := tx.Model(&models.File{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", ids).Pluck("id", &locked).Error; err != nil {
+			return err
+		}
+		if len(locked) == 0 {
+			return nil
+		}
+		ids = locked
+		// the rollup would never see files it has not reached yet
+		if err := tx.Exec(fmt.Sprintf(rollupAddedQuery, "id IN @ids AND created_at > @from"),
+			sql.Named("ids", ids), sql.Named("from", from)).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(rollupRemovedQuery, sql.Named("ids", ids)).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.File{}).Error
+	})
+}
+
+func (us *UserService) GetTimeline(c context.Context, userId int64, query *schemas.TimelineQuery) ([]schemas.TimelinePoint, *types.AppError) {
+	if query.Days == 0 {
+		query.Days = defaultTimelineDays
+	}
+
+	tx := us.db.WithContext(c).Model(&models.StorageStat{}).
+		Select("to_char(day, 'YYYY-MM-DD') AS day", "category", "added_bytes", "added_files", "removed_bytes", "removed_files").
+		Where("user_id = ?", userId).
+		Where("day > ?", time.Now().UTC().AddDate(0, 0, -query.Days))
+
+	if query.Category != "" {
+		tx = tx.Where("category = ?", query.Category)
+	}
+
+	points := []schemas.TimelinePoint{}
+	if err := tx.Order("day").Order("category").Scan(&points).Error; err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+	return points, nil
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/cache"
+	"github.com/divyam234/teldrive/internal/diskcache"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusDown        = "down"
+)
+
+const (
+	statusCheckInterval = time.Minute
+	statusCheckTimeout  = 5 * time.Second
+	// statusHistory is the number of checks uptime is computed over, one day
+	statusHistory = 24 * 60
+	// readyTTL is how long a readiness result answers further probes
+	readyTTL = 5 * time.Second
+)
+
+type statusCheck struct {
+	name  string
+	check func(ctx context.Context) string
+}
+
+// StatusService periodically checks the components the server depends on and
+// keeps a day of results to report uptime. It only exposes coarse states so
+// the result can be published without authentication.
+type StatusService struct {
+	checks    []statusCheck
+	since     time.Time
+	mu        sync.RWMutex
+	current   map[string]string
+	history   map[string][]bool
+	checkedAt time.Time
+	// readyMu serializes readiness checks, whose results are kept for readyTTL
+	readyMu sync.Mutex
+	ready   map[string]string
+	readyAt time.Time
+}
+
+func NewStatusService(lc fx.Lifecycle, db *gorm.DB, worker *tgc.StreamWorker, diskCache *diskcache.Cache) *StatusService {
+	ss := &StatusService{
+		since:   time.Now().UTC(),
+		current: make(map[string]string),
+		history: make(map[string][]bool),
+	}
+
+	ss.checks = []statusCheck{
+		{name: "database", check: func(ctx context.Context) string {
+			sqlDB, err := db.DB()
+			if err != nil || sqlDB.PingContext(ctx) != nil {
+				return StatusDown
+			}
+			return StatusOperational
+		}},
+		{name: "telegram", check: func(ctx context.Context) string {
+			return clientsStatus(worker.Stats())
+		}},
+		{name: "cache", check: func(ctx context.Context) string {
+			return cacheStatus(cache.FromContext(ctx), diskCache)
+		}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ss.run(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			wg.Wait()
+			return nil
+		},
+	})
+	return ss
+}
+
+// clientsStatus reports stream clients as degraded while some of them are down
+// and down once none is usable. Clients that never started count as healthy.
+func clientsStatus(stats []tgc.ClientStats) string {
+	failed := 0
+	for _, s := range stats {
+		if s.Status == tgc.StatusFailed || s.Status == tgc.StatusReconnecting {
+			failed++
+		}
+	}
+	switch {
+	case failed == 0:
+		return StatusOperational
+	case failed == len(stats):
+		return StatusDown
+	default:
+		return StatusDegraded
+	}
+}
+
+// cacheStatus round trips an entry through the memory cache and reports the
+// disk cache as degraded when its directory is not writable, as streams and
+// previews still work without it.
+func cacheStatus(mem *cache.Cache, disk *diskcache.Cache) string {
+	var probe int64
+	now := time.Now().UnixNano()
+	if mem.Set("status:probe", now, time.Minute) != nil || mem.Get("status:probe", &probe) != nil || probe != now {
+		return StatusDown
+	}
+	if disk.Check() != nil {
+		return StatusDegraded
+	}
+	return StatusOperational
+}
+
+func (ss *StatusService) run(ctx context.Context) {
+	ticker := time.NewTicker(statusCheckInterval)
+	defer ticker.Stop()
+	for {
+		ss.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ss *StatusService) runChecks(ctx context.Context) map[string]string {
+	results := make(map[string]string, len(ss.checks))
+	for _, c := range ss.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, statusCheckTimeout)
+		results[c.name] = c.check(checkCtx)
+		cancel()
+	}
+	return results
+}
+
+func (ss *StatusService) checkAll(ctx context.Context) {
+	results := ss.runChecks(ctx)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for name, status := range results {
+		ss.current[name] = status
+		history := append(ss.history[name], status != StatusDown)
+		if len(history) > statusHistory {
+			history = history[len(history)-statusHistory:]
+		}
+		ss.history[name] = history
+	}
+	ss.checkedAt = time.Now().UTC()
+}
+
+func (ss *StatusService) GetStatus() *schemas.Status {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	res := &schemas.Status{Status: StatusOperational, Since: ss.since, CheckedAt: ss.checkedAt,
+		Components: []schemas.ComponentStatus{}}
+
+	for _, c := range ss.checks {
+		status, ok := ss.current[c.name]
+		if !ok {
+			continue
+		}
+
+		up := 0
+		for _, ok := range ss.history[c.name] {
+			if ok {
+				up++
+			}
+		}
+		uptime := 100.0
+		if n := len(ss.history[c.name]); n > 0 {
+			uptime = float64(up) * 100 / float64(n)
+		}
+
+		res.Components = append(res.Components, schemas.ComponentStatus{Name: c.name, Status: status, Uptime: uptime})
+
+		if status == StatusDown {
+			res.Status = StatusDown
+		} else if status == StatusDegraded && res.Status == StatusOperational {
+			res.Status = StatusDegraded
+		}
+	}
+
+	return res
+}
+
+// Ready runs the checks rather than reporting the last periodic result, so a
+// probe sees a failure within readyTTL. Probes arriving meanwhile share the
+// result, as the endpoint is public. The server is ready while no component
+// is down, that is with the database reachable, at least one usable Telegram
+// client and a working cache.
+func (ss *StatusService) Ready(ctx context.Context) (*schemas.Readiness, bool) {
+	ss.readyMu.Lock()
+	if ss.ready == nil || time.Since(ss.readyAt) > readyTTL {
+		// a probe giving up must not leave a failed result behind
+		ss.ready, ss.readyAt = ss.runChecks(context.WithoutCancel(ctx)), time.Now()
+	}
+	results := ss.ready
+	ss.readyMu.Unlock()
+
+	res := &schemas.Readiness{Status: "ready", Components: make([]schemas.ComponentCheck, 0, len(ss.checks))}
+	ready := true
+	for _, c := range ss.checks {
+		res.Components = append(res.Components, schemas.ComponentCheck{Name: c.name, Status: results[c.name]})
+		if results[c.name] == StatusDown {
+			ready = false
+		}
+	}
+	if !ready {
+		res.Status = "unready"
+	}
+	return res, ready
+}
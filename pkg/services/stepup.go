@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/auth"
+	"github.com/divyam234/teldrive/internal/middleware"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/internal/totp"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+)
+
+const totpIssuer = "Teldrive"
+
+var errConfirmation = errors.New("confirmation failed")
+
+func (as *AuthService) currentUser(c *gin.Context) (*models.User, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+	var user models.User
+	if err := as.db.WithContext(c).Where("user_id = ?", userId).First(&user).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &user, nil
+}
+
+// SetupTOTP starts enrolling an authenticator app. The secret is only used
+// for confirmations once EnableTOTP checked a code of it. Both routes need a
+// confirmation from a fresh login, so a stolen session cannot enroll its own
+// app and then pass every confirmation with it.
+func (as *AuthService) SetupTOTP(c *gin.Context) (*schemas.TOTPSetup, *types.AppError) {
+	user, err := as.currentUser(c)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, &types.AppError{Error: errors.New("two-factor authentication is already enabled"),
+			Code: http.StatusConflict}
+	}
+
+	secret := totp.GenerateSecret()
+	if err := as.db.WithContext(c).Model(user).Updates(map[string]any{"totp_secret": secret,
+		"totp_last_step": 0}).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	account := user.UserName
+	if account == "" {
+		account = strconv.FormatInt(user.UserId, 10)
+	}
+	return &schemas.TOTPSetup{Secret: secret, URL: totp.URL(totpIssuer, account, secret)}, nil
+}
+
+func (as *AuthService) EnableTOTP(c *gin.Context, in *schemas.TOTPCode) (*schemas.Message, *types.AppError) {
+	user, err := as.currentUser(c)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, &types.AppError{Error: errors.New("two-factor authentication is already enabled"),
+			Code: http.StatusConflict}
+	}
+	if user.TotpSecret == nil {
+		return nil, &types.AppError{Error: errors.New("set up two-factor authentication first"),
+			Code: http.StatusBadRequest}
+	}
+	if !as.checkTOTP(c, user, in.Code) {
+		return nil, &types.AppError{Error: errors.New("invalid code"), Code: http.StatusBadRequest}
+	}
+	if err := as.db.WithContext(c).Model(user).Update("totp_enabled", true).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "two-factor authentication enabled"}, nil
+}
+
+// DisableTOTP removes the authenticator app. Its route needs a confirmation,
+// so a stolen session cannot turn it off.
+func (as *AuthService) DisableTOTP(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+	if err := as.db.WithContext(c).Model(&models.User{}).Where("user_id = ?", userId).
+		Updates(map[string]any{"totp_secret": nil, "totp_enabled": false, "totp_last_step": 0}).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "two-factor authentication disabled"}, nil
+}
+
+// checkTOTP tells whether code is a valid code of the user's secret that was
+// not used before.
+func (as *AuthService) checkTOTP(ctx context.Context, user *models.User, code string) bool {
+	if user.TotpSecret == nil {
+		return false
+	}
+	step, ok := totp.Validate(*user.TotpSecret, code, time.Now())
+	if !ok {
+		return false
+	}
+	res := as.db.WithContext(ctx).Model(&models.User{}).Where("user_id = ?", user.UserId).
+		Where("totp_last_step < ?", step).Update("totp_last_step", step)
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// Elevate confirms the session for irreversible operations, with a TOTP code
+// when the user enabled two-factor authentication and with a fresh Telegram
+// login otherwise. Failed confirmations count towards the login lockout.
+func (as *AuthService) Elevate(c *gin.Context, in *schemas.ElevateIn) (*schemas.Elevation, *types.AppError) {
+	val, _ := c.Get("jwtUser")
+	jwtUser := val.(*types.JWTClaims)
+	key := "elevate:" + jwtUser.Subject
+
+	if err := as.checkLocked(c, key); err != nil {
+		return nil, err
+	}
+
+	user, appErr := as.currentUser(c)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var confirmed bool
+	switch {
+	case user.TotpEnabled:
+		confirmed = as.checkTOTP(c, user, in.Code)
+	case in.Session != "":
+		confirmed = in.Session != jwtUser.TgSession && as.checkFreshLogin(c, user.UserId, in.Session)
+	default:
+		return nil, &types.AppError{Error: errors.New("session from a fresh login required"),
+			Code: http.StatusBadRequest}
+	}
+	if !confirmed {
+		as.loginFailed(c, errConfirmation.Error(), key)
+		return nil, &types.AppError{Error: errConfirmation, Code: http.StatusUnauthorized}
+	}
+	as.guard.Succeed(key)
+
+	ttl := as.cnf.Login.StepUpTtl
+	token, err := auth.Elevate(as.cnf.JWT.Secret, jwtUser, ttl)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(middleware.ElevationCookie, token, int(ttl.Seconds()), middleware.BasePath(c)+"/", "", false, true)
+	return &schemas.Elevation{Token: token, ExpiresAt: time.Now().UTC().Add(ttl)}, nil
+}
+
+// checkFreshLogin tells whether session is logged in to the Telegram account
+// userId. The session was only made to confirm, so it is logged out again.
+func (as *AuthService) checkFreshLogin(ctx context.Context, userId int64, session string) bool {
+	client, err := tgc.AuthClient(ctx, &as.cnf.TG, session)
+	if err != nil {
+		return false
+	}
+	var confirmed bool
+	tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		self, err := client.Self(ctx)
+		if err != nil {
+			return err
+		}
+		confirmed = self.ID == userId
+		_, err = client.API().AuthLogOut(ctx)
+		return err
+	})
+	return confirmed
+}
+
+func clearElevation(c *gin.Context) {
+	c.SetCookie(middleware.ElevationCookie, "", -1, middleware.BasePath(c)+"/", "", false, true)
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/clientclass"
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/disposition"
+	"github.com/divyam234/teldrive/internal/faststart"
+	"github.com/divyam234/teldrive/internal/reader"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// warmSize is how much of the head and of the tail of a video is cached,
+	// which is where MP4 keeps its moov atom and MKV its cues.
+	warmSize = 2 * 1024 * 1024
+	// warmTTL is how long a warmed video is not warmed again.
+	warmTTL     = 10 * time.Minute
+	warmTimeout = time.Minute
+)
+
+type streamPolicy struct {
+	prefetch int
+	// limiter is shared by all streams of the class, nil when unlimited
+	limiter *rate.Limiter
+}
+
+func newStreamPolicy(p config.StreamPolicy) streamPolicy {
+	policy := streamPolicy{prefetch: p.Prefetch}
+	if p.RateLimit > 0 {
+		bytesPerSec := p.RateLimit * 1024
+		policy.limiter = rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec)
+	}
+	return policy
+}
+
+func newStreamPolicies(cnf *config.StreamConfig) map[clientclass.Class]streamPolicy {
+	return map[clientclass.Class]streamPolicy{
+		clientclass.Browser: newStreamPolicy(cnf.Browser),
+		clientclass.Player:  newStreamPolicy(cnf.Player),
+		clientclass.Rclone:  newStreamPolicy(cnf.Rclone),
+		clientclass.Other:   newStreamPolicy(cnf.Other),
+	}
+}
+
+// warm caches the head and the tail of a video in the background on its first
+// ranged request, so the probes players send before playing it are answered
+// from memory.
+func (fs *FileService) warm(ctx context.Context, client *tgc.Client, file *schemas.FileOutFull, channelUser string) {
+	if fs.chunks == nil || file.Size <= 0 {
+		return
+	}
+	if _, loaded := fs.warmed.LoadOrStore(file.ID, struct{}{}); loaded {
+		return
+	}
+	time.AfterFunc(warmTTL, func() { fs.warmed.Delete(file.ID) })
+
+	logger := logging.FromContext(ctx)
+	ranges := [][2]int64{{0, min(warmSize, file.Size) - 1}}
+	if file.Size > warmSize {
+		ranges = append(ranges, [2]int64{max(file.Size-warmSize, warmSize), file.Size - 1})
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), warmTimeout)
+		defer cancel()
+		for _, rg := range ranges {
+			r, err := newFileReader(ctx, client.Tg, fs.cnf, file, rg[0], rg[1], channelUser,
+				reader.WithInvoker(client.Invoker()), reader.WithDC(client.DC), reader.WithCache(fs.chunks),
+				reader.WithCacheFill())
+			if err == nil {
+				_, err = io.Copy(io.Discard, r)
+				r.Close()
+			}
+			if err != nil {
+				logger.Debugw("stream warm", "file", file.ID, "err", err)
+				return
+			}
+		}
+	}()
+}
+
+// cachedRange returns the bytes start to end of file when the chunk cache
+// holds all of them, so they are written straight from memory instead of
+// going through a Telegram reader. Encrypted files and files streamed with a
+// faststart layout, or not known to need none, go through the reader.
+func (fs *FileService) cachedRange(ctx context.Context, file *schemas.FileOutFull, channelUser, kind string,
+	start, end int64) ([][]byte, bool) {
+	if fs.chunks == nil || file.Encrypted {
+		return nil, false
+	}
+	if fs.faststartEligible(file, kind) {
+		if layout, ok := fs.layouts.get(file.ID, file.Revision); !ok || layout != nil {
+			return nil, false
+		}
+	}
+	parts, ok := partsCache.Get(ctx, partsKey(file, channelUser))
+	if !ok {
+		return nil, false
+	}
+	return fs.chunks.Slices(parts, start, end)
+}
+
+func (fs *FileService) faststartEligible(file *schemas.FileOutFull, kind string) bool {
+	return fs.faststart && kind == disposition.Inline && (file.MimeType == "video/mp4" || file.MimeType == "video/quicktime")
+}
+
+// faststartLayout returns how to play an MP4 stored with its moov at the end
+// as if the moov came first, or nil when it should be streamed as is.
+// Downloads always get the stored bytes.
+func (fs *FileService) faststartLayout(ctx context.Context, client *tgc.Client, file *schemas.FileOutFull,
+	channelUser, kind string) *faststart.Layout {
+	if !fs.faststartEligible(file, kind) {
+		return nil
+	}
+	if layout, ok := fs.layouts.get(file.ID, file.Revision); ok {
+		return layout
+	}
+
+	layout, err := faststart.Plan(file.Size, func(off, n int64) ([]byte, error) {
+		r, err := newFileReader(ctx, client.Tg, fs.cnf, file, off, off+n-1, channelUser,
+			reader.WithInvoker(client.Invoker()), reader.WithDC(client.DC), reader.WithCache(fs.chunks))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	})
+	switch {
+	case errors.Is(err, faststart.ErrNotNeeded), errors.Is(err, faststart.ErrUnsupported):
+		// remembered too, so the file is not probed again
+		layout = nil
+	case err != nil:
+		logging.FromContext(ctx).Debugw("faststart", "file", file.ID, "err", err)
+		return nil
+	}
+	fs.layouts.put(file.ID, file.Revision, layout)
+	return layout
+}
+
+// layoutCacheSize bounds the bytes of moov the faststart layouts keep in
+// memory, enough for a few of the largest.
+const layoutCacheSize = 4 * faststart.MaxMoovSize
+
+// maxCachedLayouts bounds how many files are remembered, as files needing no
+// layout take no bytes.
+const maxCachedLayouts = 10000
+
+// layoutCache keeps the faststart layouts of the files streamed lately, the
+// least recently used going first once their moovs exceed layoutCacheSize.
+// Layouts are keyed by revision, so a file changed since is planned again.
+type layoutCache struct {
+	mu    sync.Mutex
+	used  int64
+	order *list.List
+	items map[layoutKey]*list.Element
+}
+
+type layoutKey struct {
+	id       string
+	revision int64
+}
+
+type cachedLayout struct {
+	key    layoutKey
+	layout *faststart.Layout
+	size   int64
+}
+
+// get returns the layout of the file at revision, nil when it needs none.
+func (c *layoutCache) get(id string, revision int64) (*faststart.Layout, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[layoutKey{id: id, revision: revision}]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cachedLayout).layout, true
+}
+
+func (c *layoutCache) put(id string, revision int64, layout *faststart.Layout) {
+	var size int64
+	if layout != nil {
+		size = layout.Size()
+	}
+	if size > layoutCacheSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.items == nil {
+		c.order, c.items = list.New(), make(map[layoutKey]*list.Element)
+	}
+	key := layoutKey{id: id, revision: revision}
+	if _, ok := c.items[key]; ok {
+		return
+	}
+	c.items[key] = c.order.PushFront(&cachedLayout{key: key, layout: layout, size: size})
+	c.used += size
+	for c.used > layoutCacheSize || c.order.Len() > maxCachedLayouts {
+		oldest := c.order.Remove(c.order.Back()).(*cachedLayout)
+		delete(c.items, oldest.key)
+		c.used -= oldest.size
+	}
+}
+
+// segmentReader reads the segments of a faststart layout in turn, opening a
+// reader over the stored file for those standing for its bytes.
+type segmentReader struct {
+	segments []faststart.Segment
+	open     func(start, end int64) (io.ReadCloser, error)
+	current  io.Reader
+	closer   io.Closer
+}
+
+func newSegmentReader(segments []faststart.Segment, open func(start, end int64) (io.ReadCloser, error)) *segmentReader {
+	return &segmentReader{segments: segments, open: open}
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.segments) == 0 {
+				return 0, io.EOF
+			}
+			s := r.segments[0]
+			r.segments = r.segments[1:]
+			if s.Data != nil {
+				r.current = bytes.NewReader(s.Data)
+			} else {
+				rc, err := r.open(s.Start, s.End)
+				if err != nil {
+					return 0, err
+				}
+				r.current, r.closer = rc, rc
+			}
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.Close()
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *segmentReader) Close() error {
+	r.current = nil
+	if r.closer == nil {
+		return nil
+	}
+	err := r.closer.Close()
+	r.closer = nil
+	return err
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+)
+
+const (
+	JobRestoreFiles = "files.restore"
+	JobPurgeTrash   = "trash.purge"
+)
+
+const (
+	trashListLimit = 1000
+	// maxRestoreRenames bounds the names tried for a file whose name is taken
+	maxRestoreRenames = 100
+)
+
+// trashed selects the deleted files of userId that are still restorable,
+// either the given ids or everything deleted from below dir.
+func (fs *FileService) trashed(ctx context.Context, userId int64, ids []string, dir string) *gorm.DB {
+	query := fs.db.WithContext(ctx).Model(&models.File{}).Where("user_id = ?", userId).
+		Where("type = ?", "file").Where("status = ?", "pending_deletion")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	if dir != "" && dir != "/" {
+		dir = strings.TrimSuffix(dir, "/")
+		query = query.Where("deleted_path = ? OR deleted_path LIKE ?", dir, escapeLike(dir)+"/%")
+	}
+	return query
+}
+
+func (fs *FileService) ListTrash(ctx context.Context, userId int64, dir string) ([]schemas.TrashOut, *types.AppError) {
+	var files []models.File
+	if err := fs.trashed(ctx, userId, nil, dir).Order("deleted_at DESC").Limit(trashListLimit).
+		Find(&files).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := make([]schemas.TrashOut, 0, len(files))
+	for _, file := range files {
+		out := schemas.TrashOut{ID: file.ID, Name: file.Name, MimeType: file.MimeType, DeletedAt: file.DeletedAt}
+		if file.Size != nil {
+			out.Size = *file.Size
+		}
+		if file.DeletedPath != nil {
+			out.DeletedPath = *file.DeletedPath
+		}
+		res = append(res, out)
+	}
+	return res, nil
+}
+
+// RestoreFiles restores small selections right away and hands large ones to a
+// background job, in which case the job is returned.
+func (fs *FileService) RestoreFiles(ctx context.Context, userId int64, payload *schemas.TrashRestore) (*schemas.RestoreResult, *schemas.JobOut, *types.AppError) {
+	if len(payload.Files) == 0 && payload.Path == "" {
+		return nil, nil, &types.AppError{Error: errors.New("files or path is required"), Code: http.StatusBadRequest}
+	}
+
+	var count int64
+	if err := fs.trashed(ctx, userId, payload.Files, payload.Path).Count(&count).Error; err != nil {
+		return nil, nil, &types.AppError{Error: err}
+	}
+	if count == 0 {
+		return nil, nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+
+	if count > asyncDeleteThreshold {
+		job, err := fs.jobs.Submit(ctx, userId, JobRestoreFiles, payload)
+		return nil, job, err
+	}
+
+	res, err := fs.restoreFiles(ctx, userId, payload, nil)
+	if err != nil {
+		return nil, nil, &types.AppError{Error: err}
+	}
+	return res, nil, nil
+}
+
+// PurgeTrash removes deleted files for good before their retention ends:
+// the selected ones, or the whole trash when nothing is selected. Their
+// messages are deleted by a background job, which is returned.
+func (fs *FileService) PurgeTrash(ctx context.Context, userId int64, payload *schemas.TrashRestore) (*schemas.JobOut, *types.AppError) {
+	var count int64
+	if err := fs.trashed(ctx, userId, payload.Files, payload.Path).Count(&count).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if count == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	return fs.jobs.Submit(ctx, userId, JobPurgeTrash, payload)
+}
+
+// purgeTrashJob deletes the messages of the selected deleted files and their
+// rows. Files whose messages could not be deleted stay in the trash.
+func (fs *FileService) purgeTrashJob(ctx context.Context, run *JobRun) (any, error) {
+	var payload schemas.TrashRestore
+	if err := run.Payload(&payload); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if err := fs.trashed(ctx, run.UserID, payload.Files, payload.Path).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	total := int64(len(ids))
+	result := &schemas.DeleteResult{}
+	var done int64
+
+	err := runWithUserClient(ctx, fs.db, fs.cnf, run.UserID, func(ctx context.Context, client *telegram.Client, user string) error {
+		channels := make(map[int64]*tg.InputChannel)
+		for _, batch := range chunks(ids, deleteBatchSize) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			pending, kept, err := fs.deleteFileBatch(ctx, client, user, channels, batch)
+			if err != nil {
+				result.Failed += len(batch)
+				if len(result.Errors) < maxDeleteErrors {
+					result.Errors = append(result.Errors, err.Error())
+				}
+			} else {
+				result.Deleted += len(batch) - pending
+				result.Pending += pending
+			}
+			if kept != nil && len(result.Errors) < maxDeleteErrors {
+				result.Errors = append(result.Errors, kept.Error())
+			}
+			done += int64(len(batch))
+			run.Progress(done, total)
+		}
+		return nil
+	})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return result, ctxErr
+	}
+	return result, err
+}
+
+func (fs *FileService) restoreFilesJob(ctx context.Context, run *JobRun) (any, error) {
+	var payload schemas.TrashRestore
+	if err := run.Payload(&payload); err != nil {
+		return nil, err
+	}
+	return fs.restoreFiles(ctx, run.UserID, &payload, run)
+}
+
+// restoreFiles moves deleted files back to the folder they were deleted from.
+// Folders are removed on delete, so missing ones are created again, shallow
+// paths first. A file whose name is taken in the meantime is restored under a
+// numbered name.
+func (fs *FileService) restoreFiles(ctx context.Context, userId int64, payload *schemas.TrashRestore, run *JobRun) (*schemas.RestoreResult, error) {
+	var files []models.File
+	if err := fs.trashed(ctx, userId, payload.Files, payload.Path).Select("id", "name", "deleted_path").
+		Order("deleted_path NULLS FIRST").Order("name").Find(&files).Error; err != nil {
+		return nil, err
+	}
+
+	total := int64(len(files))
+	result := &schemas.RestoreResult{}
+	folders := make(map[string]string)
+
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		dir := "/"
+		if file.DeletedPath != nil && *file.DeletedPath != "" {
+			dir = *file.DeletedPath
+		}
+
+		renamed, err := fs.restoreFile(ctx, userId, file, dir, folders)
+		if err != nil {
+			result.Failed++
+			if len(result.Errors) < maxDeleteErrors {
+				result.Errors = append(result.Errors, file.Name+": "+err.Error())
+			}
+		} else {
+			result.Restored++
+			if renamed {
+				result.Renamed++
+			}
+		}
+		if run != nil {
+			run.Progress(int64(i+1), total)
+		}
+	}
+
+	return result, nil
+}
+
+func (fs *FileService) restoreFile(ctx context.Context, userId int64, file models.File, dir string,
+	folders map[string]string) (bool, error) {
+
+	parentId, ok := folders[dir]
+	if !ok {
+		var err error
+		if parentId, err = createDirectories(ctx, fs.db, userId, dir); err != nil {
+			return false, err
+		}
+		folders[dir] = parentId
+	}
+
+	ext := path.Ext(file.Name)
+	base := strings.TrimSuffix(file.Name, ext)
+
+	name := file.Name
+	for n := 1; n <= maxRestoreRenames; n++ {
+		err := fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).
+			Where("status = ?", "pending_deletion").
+			Updates(map[string]any{"status": "active", "parent_id": parentId, "name": name}).Error
+		if err == nil {
+			return name != file.Name, nil
+		}
+		if !database.IsKeyConflictErr(err) {
+			return false, err
+		}
+		name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	return false, database.ErrKeyConflict
+}
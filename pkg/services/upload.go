@@ -1,6 +1,7 @@
 package services
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
@@ -8,13 +9,16 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/divyam234/teldrive/internal/bandwidth"
 	"github.com/divyam234/teldrive/internal/crypt"
 	"github.com/divyam234/teldrive/internal/kv"
+	"github.com/divyam234/teldrive/internal/sniff"
 	"github.com/divyam234/teldrive/internal/tgc"
 	"github.com/divyam234/teldrive/pkg/logging"
 	"github.com/divyam234/teldrive/pkg/mapper"
@@ -26,8 +30,6 @@ import (
 	"github.com/divyam234/teldrive/pkg/models"
 	"github.com/gin-gonic/gin"
 	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/telegram/message"
-	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
 	"gorm.io/gorm"
 )
@@ -38,17 +40,33 @@ type UploadService struct {
 	db     *gorm.DB
 	worker *tgc.UploadWorker
 	cnf    *config.TGConfig
+	live   *config.Live
 	kv     kv.KV
+	// bandwidth is shared by all uploads to Telegram
+	bandwidth *bandwidth.Limiter
 }
 
-func NewUploadService(db *gorm.DB, cnf *config.Config, worker *tgc.UploadWorker, kv kv.KV) *UploadService {
-	return &UploadService{db: db, worker: worker, cnf: &cnf.TG, kv: kv}
+func NewUploadService(db *gorm.DB, cnf *config.Config, live *config.Live, worker *tgc.UploadWorker, kv kv.KV,
+	bandwidth *bandwidth.Limiter) *UploadService {
+	return &UploadService{db: db, worker: worker, cnf: &cnf.TG, live: live, kv: kv, bandwidth: bandwidth}
+}
+
+// NewUploadLimiter builds the limiter uploads to Telegram share from the
+// upload rate settings.
+func NewUploadLimiter(cnf *config.Config) (*bandwidth.Limiter, error) {
+	schedule, err := bandwidth.Parse(cnf.TG.Uploads.RateLimit, cnf.TG.Uploads.RateSchedule)
+	if err != nil {
+		return nil, err
+	}
+	return bandwidth.NewLimiter(schedule), nil
 }
 
 func (us *UploadService) GetUploadFileById(c *gin.Context) (*schemas.UploadOut, *types.AppError) {
+	userId, _ := GetUserAuth(c)
 	uploadId := c.Param("id")
 	parts := []schemas.UploadPartOut{}
-	if err := us.db.Model(&models.Upload{}).Order("part_no").Where("upload_id = ?", uploadId).
+	if err := us.db.WithContext(c).Model(&models.Upload{}).Order("part_no").Where("upload_id = ?", uploadId).
+		Where("user_id = ?", userId).
 		Where("created_at < ?", time.Now().UTC().Add(us.cnf.Uploads.Retention)).
 		Find(&parts).Error; err != nil {
 		return nil, &types.AppError{Error: err}
@@ -58,16 +76,18 @@ func (us *UploadService) GetUploadFileById(c *gin.Context) (*schemas.UploadOut,
 }
 
 func (us *UploadService) DeleteUploadFile(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, _ := GetUserAuth(c)
 	uploadId := c.Param("id")
-	if err := us.db.Where("upload_id = ?", uploadId).Delete(&models.Upload{}).Error; err != nil {
+	if err := us.db.WithContext(c).Where("upload_id = ?", uploadId).Where("user_id = ?", userId).
+		Delete(&models.Upload{}).Error; err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 	return &schemas.Message{Message: "upload deleted"}, nil
 }
 
-func (us *UploadService) GetUploadStats(userId int64, days int) ([]schemas.UploadStats, *types.AppError) {
+func (us *UploadService) GetUploadStats(ctx context.Context, userId int64, days int) ([]schemas.UploadStats, *types.AppError) {
 	var stats []schemas.UploadStats
-	err := us.db.Raw(`
+	err := us.db.WithContext(ctx).Raw(`
     SELECT 
         dates.upload_date::date AS upload_date,
         COALESCE(SUM(files.size), 0)::bigint AS total_uploaded
@@ -124,8 +144,18 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 
 	defer c.Request.Body.Close()
 
+	// encryption adds its headers before the part reaches Telegram
+	storedSize := fileSize
+	if uploadQuery.Encrypted {
+		storedSize = crypt.EncryptedSize(fileSize)
+	}
+	if storedSize > config.MaxSplitSize {
+		return nil, &types.AppError{Error: fmt.Errorf("part exceeds the %d bytes Telegram accepts", config.MaxSplitSize),
+			Code: http.StatusRequestEntityTooLarge}
+	}
+
 	if uploadQuery.ChannelID == 0 {
-		channelId, err = GetDefaultChannel(c, us.db, userId)
+		channelId, err = uploadChannel(c, us.db, us.cnf, userId, session)
 		if err != nil {
 			return nil, &types.AppError{Error: err}
 		}
@@ -133,7 +163,32 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 		channelId = uploadQuery.ChannelID
 	}
 
-	tokens, err := getBotsToken(c, us.db, userId, channelId)
+	// org members upload to the org channel with the owner's bots or session
+	channelOwner := userId
+	org, err := channelOrg(c, us.db, channelId, userId)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if org != nil && org.OwnerID != userId {
+		channelOwner = org.OwnerID
+		ownerSession, err := getLatestSession(c, us.db, channelOwner)
+		if err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+		session = ownerSession.Session
+	}
+
+	// the first part carries the leading bytes the mime type is sniffed from
+	var mimeType *string
+	if uploadQuery.PartNo == 1 {
+		br := bufio.NewReaderSize(fileStream, sniff.Len)
+		head, _ := br.Peek(sniff.Len)
+		detected := sniff.Detect(uploadQuery.FileName, head)
+		mimeType = &detected
+		fileStream = io.NopCloser(br)
+	}
+
+	tokens, err := getBotsToken(c, us.db, channelOwner, channelId)
 
 	if err != nil {
 		return nil, &types.AppError{Error: err}
@@ -141,7 +196,7 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 
 	if len(tokens) == 0 {
 		client, _ = tgc.AuthClient(c, us.cnf, session)
-		channelUser = strconv.FormatInt(userId, 10)
+		channelUser = strconv.FormatInt(channelOwner, 10)
 	} else {
 		us.worker.Set(tokens, channelId)
 		token, index = us.worker.Next(channelId)
@@ -156,7 +211,8 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 		"bot", channelUser, "botNo", index,
 		"chunkNo", uploadQuery.PartNo, "partSize", fileSize)
 
-	ctx, _ := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
 
 	errChan := make(chan error, 1)
 
@@ -179,62 +235,29 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 				fileStream, _ = cipher.EncryptData(fileStream)
 			}
 
-			api := client.API()
-
-			u := uploader.NewUploader(api).WithThreads(us.cnf.Uploads.Threads).WithPartSize(512 * 1024)
-
-			upload, err := u.Upload(ctx, uploader.NewUpload(uploadQuery.PartName, fileStream, fileSize))
-
-			if err != nil {
-				return err
-			}
-
-			document := message.UploadedDocument(upload).Filename(uploadQuery.PartName).ForceFile(true)
-
-			sender := message.NewSender(client.API())
-
-			target := sender.To(&tg.InputPeerChannel{ChannelID: channel.ChannelID,
-				AccessHash: channel.AccessHash})
-
-			res, err := target.Media(ctx, document)
+			messageId, err := uploadToChannel(ctx, client, channel, uploadQuery.PartName,
+				us.bandwidth.Reader(ctx, fileStream), fileSize, us.live.Load().ChunkSize, us.cnf)
 
 			if err != nil {
 				return err
 			}
 
-			updates := res.(*tg.Updates)
-
-			var message *tg.Message
-
-			for _, update := range updates.Updates {
-				channelMsg, ok := update.(*tg.UpdateNewChannelMessage)
-				if ok {
-					message = channelMsg.Message.(*tg.Message)
-					break
-				}
-			}
-
-			if message.ID == 0 {
-				return fmt.Errorf("upload failed")
-			}
-
 			partUpload := &models.Upload{
 				Name:      uploadQuery.PartName,
 				UploadId:  uploadId,
-				PartId:    message.ID,
+				PartId:    messageId,
 				ChannelID: channelId,
 				Size:      fileSize,
 				PartNo:    uploadQuery.PartNo,
 				UserId:    userId,
 				Encrypted: uploadQuery.Encrypted,
 				Salt:      salt,
+				MimeType:  mimeType,
 			}
 
-			if err := us.db.Create(partUpload).Error; err != nil {
+			if err := us.db.WithContext(c).Create(partUpload).Error; err != nil {
 				//delete uploaded part if upload fails
-				if message.ID != 0 {
-					api.ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: []int{message.ID}})
-				}
+				client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: []int{messageId}})
 				return err
 			}
 
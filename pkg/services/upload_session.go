@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+)
+
+// uploadSessions groups the parts of uploads into sessions. A session expires
+// the upload retention after its last part.
+func uploadSessions(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Upload{}).Select("upload_id", "user_id", "min(name) AS name", "channel_id",
+		"count(*) AS parts", "sum(size) AS size", "bool_or(encrypted) AS encrypted",
+		"min(created_at) AS created_at", "max(created_at) AS updated_at").
+		Group("upload_id").Group("user_id").Group("channel_id")
+}
+
+type uploadSession struct {
+	schemas.UploadSession
+	UserId int64
+}
+
+// ListUploadSessions returns the uploads of a user that are in progress.
+func (us *UploadService) ListUploadSessions(ctx context.Context, userId int64) ([]schemas.UploadSession, *types.AppError) {
+	sessions := []schemas.UploadSession{}
+	if err := uploadSessions(us.db.WithContext(ctx)).Where("user_id = ?", userId).
+		Order("updated_at DESC").Scan(&sessions).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	for i := range sessions {
+		sessions[i].ExpiresAt = sessions[i].UpdatedAt.Add(us.cnf.Uploads.Retention)
+	}
+	return sessions, nil
+}
+
+// AbortUploadSession deletes the parts uploaded so far along with their
+// messages.
+func (us *UploadService) AbortUploadSession(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+	uploadId := c.Param("id")
+	var sessions []uploadSession
+	if err := uploadSessions(us.db.WithContext(c)).Where("upload_id = ?", uploadId).Where("user_id = ?", userId).
+		Scan(&sessions).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if len(sessions) == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	if err := removeUploadSessions(c, us.db, us.cnf, userId, sessions); err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.Message{Message: "upload aborted"}, nil
+}
+
+// CleanExpiredUploads deletes the upload sessions whose last part is older
+// than the upload retention, with their messages.
+func CleanExpiredUploads(ctx context.Context, db *gorm.DB, cnf *config.TGConfig) error {
+	var sessions []uploadSession
+	if err := uploadSessions(db.WithContext(ctx)).
+		Having("max(created_at) < ?", time.Now().UTC().Add(-cnf.Uploads.Retention)).
+		Scan(&sessions).Error; err != nil {
+		return err
+	}
+
+	byUser := make(map[int64][]uploadSession)
+	for _, session := range sessions {
+		byUser[session.UserId] = append(byUser[session.UserId], session)
+	}
+
+	logger := logging.FromContext(ctx)
+	for userId, sessions := range byUser {
+		if err := removeUploadSessions(ctx, db, cnf, userId, sessions); err != nil {
+			logger.Errorw("failed to clean uploads", "user", userId, "err", err)
+			continue
+		}
+		logger.Infow("cleaned expired uploads", "user", userId, "uploads", len(sessions))
+	}
+	return nil
+}
+
+// removeUploadSessions deletes the messages of upload sessions of a user and
+// then their parts. Messages a file already references, when a finalized
+// upload was not cleared, are kept.
+func removeUploadSessions(ctx context.Context, db *gorm.DB, cnf *config.TGConfig, userId int64, sessions []uploadSession) error {
+	return runWithUserClient(ctx, db, cnf, userId, func(ctx context.Context, client *telegram.Client, user string) error {
+		for _, session := range sessions {
+			var ids []int
+			if err := db.WithContext(ctx).Model(&models.Upload{}).Where("upload_id = ?", session.UploadId).
+				Where("channel_id = ?", session.ChannelID).Pluck("part_id", &ids).Error; err != nil {
+				return err
+			}
+			ids, err := ReleasableParts(ctx, db, session.ChannelID, ids, nil)
+			if err != nil {
+				return err
+			}
+			if len(ids) > 0 {
+				channel, err := GetChannelById(ctx, client, session.ChannelID, user)
+				if err != nil {
+					return err
+				}
+				if _, err := client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{
+					Channel: channel, ID: ids}); err != nil {
+					return err
+				}
+			}
+			if err := db.WithContext(ctx).Where("upload_id = ?", session.UploadId).
+				Where("channel_id = ?", session.ChannelID).Delete(&models.Upload{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -8,10 +8,10 @@ import (
 	"strconv"
 	"sync"
 
-	"github.com/divyam234/teldrive/internal/cache"
 	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/kv"
 	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/internal/utils"
 	"github.com/divyam234/teldrive/pkg/logging"
 	"github.com/divyam234/teldrive/pkg/models"
 	"github.com/divyam234/teldrive/pkg/schemas"
@@ -29,13 +29,14 @@ import (
 )
 
 type UserService struct {
-	db  *gorm.DB
-	cnf *config.Config
-	kv  kv.KV
+	db       *gorm.DB
+	cnf      *config.Config
+	kv       kv.KV
+	notifier *Notifier
 }
 
-func NewUserService(db *gorm.DB, cnf *config.Config, kv kv.KV) *UserService {
-	return &UserService{db: db, cnf: cnf, kv: kv}
+func NewUserService(db *gorm.DB, cnf *config.Config, kv kv.KV, notifier *Notifier) *UserService {
+	return &UserService{db: db, cnf: cnf, kv: kv, notifier: notifier}
 }
 func (us *UserService) GetProfilePhoto(c *gin.Context) {
 	_, session := GetUserAuth(c)
@@ -98,8 +99,6 @@ func (us *UserService) GetStats(c *gin.Context) (*schemas.AccountStats, *types.A
 
 func (us *UserService) UpdateChannel(c *gin.Context) (*schemas.Message, *types.AppError) {
 
-	cache := cache.FromContext(c)
-
 	userId, _ := GetUserAuth(c)
 
 	var payload schemas.Channel
@@ -111,21 +110,106 @@ func (us *UserService) UpdateChannel(c *gin.Context) (*schemas.Message, *types.A
 	channel := &models.Channel{ChannelID: payload.ChannelID, ChannelName: payload.ChannelName, UserID: userId,
 		Selected: true}
 
-	if err := us.db.Clauses(clause.OnConflict{
+	if err := us.db.WithContext(c).Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "channel_id"}},
 		DoUpdates: clause.Assignments(map[string]interface{}{"selected": true}),
 	}).Create(channel).Error; err != nil {
 		return nil, &types.AppError{Error: errors.New("failed to update channel"),
 			Code: http.StatusInternalServerError}
 	}
-	us.db.Model(&models.Channel{}).Where("channel_id != ?", payload.ChannelID).
+	us.db.WithContext(c).Model(&models.Channel{}).Where("channel_id != ?", payload.ChannelID).
 		Where("user_id = ?", userId).Update("selected", false)
 
-	key := fmt.Sprintf("users:channel:%d", userId)
-	cache.Set(key, payload.ChannelID, 0)
+	channelCache.Set(c, channelCache.Key(userId), payload.ChannelID)
 	return &schemas.Message{Message: "channel updated"}, nil
 }
 
+// CreateChannel creates a private storage channel and selects it as the
+// default channel. The bots the user already added and the bots whose tokens
+// are passed along are made admins of it.
+func (us *UserService) CreateChannel(c *gin.Context) (*schemas.Channel, *types.AppError) {
+	userId, session := GetUserAuth(c)
+
+	var payload schemas.ChannelCreate
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+	if payload.ChannelName == "" {
+		payload.ChannelName = storageChannelName
+	}
+
+	channelId, err := createStorageChannel(c, us.db, &us.cnf.TG, userId, session, payload.ChannelName)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	if len(payload.Bots) > 0 {
+		client, _ := tgc.AuthClient(c, &us.cnf.TG, session)
+		if _, err := us.addBots(c, client, userId, channelId, payload.Bots); err != nil {
+			return nil, err
+		}
+	}
+	return &schemas.Channel{ChannelID: channelId, ChannelName: payload.ChannelName}, nil
+}
+
+// RemoveChannel deletes a storage channel on Telegram along with the files
+// stored in it. The default channel has to be replaced first.
+func (us *UserService) RemoveChannel(c *gin.Context, id string) (*schemas.Message, *types.AppError) {
+	userId, session := GetUserAuth(c)
+
+	channelId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	var channel models.Channel
+	if err := us.db.WithContext(c).Where("channel_id = ?", channelId).Where("user_id = ?", userId).
+		First(&channel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &types.AppError{Error: errors.New("channel not found"), Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	if channel.Selected {
+		return nil, &types.AppError{Error: errors.New("select another default channel first"),
+			Code: http.StatusConflict}
+	}
+
+	client, _ := tgc.AuthClient(c, &us.cnf.TG, session)
+	err = tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
+		input, err := GetChannelById(ctx, client, channelId, strconv.FormatInt(userId, 10))
+		if err != nil {
+			return err
+		}
+		_, err = client.API().ChannelsDeleteChannel(ctx, input)
+		return err
+	})
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	var ids []string
+	if err := us.db.WithContext(c).Model(&models.File{}).Where("user_id = ?", userId).
+		Where("channel_id = ?", channelId).Pluck("id", &ids).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	for _, batch := range chunks(ids, deleteBatchSize) {
+		if err := PurgeFiles(c, us.db, batch); err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+	}
+	if err := us.db.WithContext(c).Where("user_id = ?", userId).Where("channel_id = ?", channelId).
+		Delete(&models.Bot{}).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	botsCache.Delete(c, botsCache.Key(userId, channelId))
+	if err := us.db.WithContext(c).Delete(&channel).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return &schemas.Message{Message: "channel removed"}, nil
+}
+
 func (us *UserService) ListChannels(c *gin.Context) (interface{}, *types.AppError) {
 	_, session := GetUserAuth(c)
 	client, _ := tgc.AuthClient(c, &us.cnf.TG, session)
@@ -179,8 +263,6 @@ func (us *UserService) AddBots(c *gin.Context) (*schemas.Message, *types.AppErro
 
 func (us *UserService) RemoveBots(c *gin.Context) (*schemas.Message, *types.AppError) {
 
-	cache := cache.FromContext(c)
-
 	userID, _ := GetUserAuth(c)
 
 	channelId, err := GetDefaultChannel(c, us.db, userID)
@@ -189,12 +271,12 @@ func (us *UserService) RemoveBots(c *gin.Context) (*schemas.Message, *types.AppE
 		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
 	}
 
-	if err := us.db.Where("user_id = ?", userID).Where("channel_id = ?", channelId).
+	if err := us.db.WithContext(c).Where("user_id = ?", userID).Where("channel_id = ?", channelId).
 		Delete(&models.Bot{}).Error; err != nil {
 		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
 	}
 
-	cache.Delete(fmt.Sprintf("users:bots:%d:%d", userID, channelId))
+	botsCache.Delete(c, botsCache.Key(userID, channelId))
 
 	return &schemas.Message{Message: "bots deleted"}, nil
 
@@ -208,8 +290,6 @@ func (us *UserService) addBots(c context.Context, client *telegram.Client, userI
 
 	logger := logging.FromContext(c)
 
-	cache := cache.FromContext(c)
-
 	err := tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
 
 		channel, err := GetChannelById(ctx, client, channelId, strconv.FormatInt(userId, 10))
@@ -260,24 +340,7 @@ func (us *UserService) addBots(c context.Context, client *telegram.Client, userI
 			})
 			botsToAdd := users.([]tg.InputUser)
 			for _, user := range botsToAdd {
-				payload := &tg.ChannelsEditAdminRequest{
-					Channel: channel,
-					UserID:  tg.InputUserClass(&user),
-					AdminRights: tg.ChatAdminRights{
-						ChangeInfo:     true,
-						PostMessages:   true,
-						EditMessages:   true,
-						DeleteMessages: true,
-						BanUsers:       true,
-						InviteUsers:    true,
-						PinMessages:    true,
-						ManageCall:     true,
-						Other:          true,
-						ManageTopics:   true,
-					},
-					Rank: "bot",
-				}
-				_, err := client.API().ChannelsEditAdmin(ctx, payload)
+				err := makeBotAdmin(ctx, client, channel, &user)
 				if err != nil {
 					logger.Error("error", zap.Error(err))
 					return err
@@ -302,12 +365,66 @@ func (us *UserService) addBots(c context.Context, client *telegram.Client, userI
 		})
 	}
 
-	cache.Delete(fmt.Sprintf("users:bots:%d:%d", userId, channelId))
+	botsCache.Delete(c, botsCache.Key(userId, channelId))
 
-	if err := us.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&payload).Error; err != nil {
+	if err := us.db.WithContext(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&payload).Error; err != nil {
 		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
 	}
 
 	return &schemas.Message{Message: "bots added"}, nil
 
 }
+
+// AddUser stores user along with the root folder of its drive. A user that
+// already exists is left as is and loaded into user instead.
+func AddUser(ctx context.Context, db *gorm.DB, user *models.User) (bool, error) {
+	created := false
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(user)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return tx.Where("user_id = ?", user.UserId).First(user).Error
+		}
+		created = true
+		return tx.Create(&models.File{
+			Name:     "root",
+			Type:     "folder",
+			MimeType: "drive/folder",
+			Path:     "/",
+			Depth:    utils.IntPointer(0),
+			UserID:   user.UserId,
+			Status:   "active",
+			ParentID: "root",
+		}).Error
+	})
+	return created, err
+}
+
+// SetUserDisabled blocks or allows the logins of a user. Disabling also drops
+// the sessions of the user, which stops background jobs acting for it. It is
+// run by the CLI, so running servers notice through the short lived caches of
+// sessions rather than by being told.
+func SetUserDisabled(ctx context.Context, db *gorm.DB, userId int64, disabled bool) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.User{}).Where("user_id = ?", userId).Update("disabled", disabled)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if !disabled {
+			return nil
+		}
+		return tx.Where("user_id = ?", userId).Delete(&models.Session{}).Error
+	})
+}
+
+func isUserDisabled(ctx context.Context, db *gorm.DB, userId int64) (bool, error) {
+	var disabled bool
+	err := db.WithContext(ctx).Model(&models.User{}).Select("disabled").Where("user_id = ?", userId).
+		Scan(&disabled).Error
+	return disabled, err
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/crypt"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"gorm.io/gorm"
+)
+
+const JobVerifyFiles = "files.verify"
+
+const (
+	verifyBatchSize = 100
+	// verifyChunkSize is the smallest request upload.getFile accepts.
+	verifyChunkSize = 4096
+)
+
+// VerifyFiles starts verifying the files of the user given in the query, or of
+// every user with a session. It is meant for admins.
+func (fs *FileService) VerifyFiles(ctx context.Context, userId int64, query *schemas.VerifyQuery) (*schemas.JobOut, *types.AppError) {
+	return fs.jobs.SubmitExclusive(ctx, userId, JobVerifyFiles, query, "verification already running")
+}
+
+func (fs *FileService) verifiableFiles(ctx context.Context, userIds []int64) *gorm.DB {
+	return fs.db.WithContext(ctx).Model(&models.File{}).Where("user_id IN ?", userIds).
+		Where("type = ?", "file").Where("status = ?", "active").Where("parts IS NOT NULL")
+}
+
+// verifyFiles checks that every file is still backed by readable Telegram
+// documents of the expected size. Damaged files are flagged through their
+// integrity error, which is cleared again once a file passes, and reported to
+// their owner.
+func (fs *FileService) verifyFiles(ctx context.Context, run *JobRun) (any, error) {
+	var query schemas.VerifyQuery
+	if err := run.Payload(&query); err != nil {
+		return nil, err
+	}
+
+	userIds := []int64{query.UserID}
+	if query.UserID == 0 {
+		userIds = nil
+		if err := fs.db.WithContext(ctx).Model(&models.Session{}).Distinct("user_id").
+			Pluck("user_id", &userIds).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	result := &schemas.VerifyResult{}
+	if len(userIds) == 0 {
+		return result, nil
+	}
+
+	var total int64
+	if err := fs.verifiableFiles(ctx, userIds).Count(&total).Error; err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return result, nil
+	}
+
+	run.Progress(0, total)
+
+	var errs []error
+	for _, userId := range userIds {
+		if err := fs.verifyUserFiles(ctx, run, userId, query.Full, result, total); err != nil {
+			if ctx.Err() != nil {
+				return result, err
+			}
+			// a user without a usable session must not keep the others unverified
+			errs = append(errs, fmt.Errorf("user %d: %w", userId, err))
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+func (fs *FileService) verifyUserFiles(ctx context.Context, run *JobRun, userId int64, full bool,
+	result *schemas.VerifyResult, total int64) error {
+	var damaged []string
+
+	err := runWithUserClient(ctx, fs.db, fs.cnf, userId, func(ctx context.Context, client *telegram.Client, user string) error {
+		edges := &edgeReader{client: client, dcs: make(map[int]telegram.CloseInvoker)}
+		defer edges.Close()
+
+		lastId := ""
+		for {
+			var files []models.File
+			if err := fs.verifiableFiles(ctx, []int64{userId}).Where("id > ?", lastId).Order("id").
+				Limit(verifyBatchSize).Find(&files).Error; err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				return nil
+			}
+
+			for _, file := range files {
+				lastId = file.ID
+
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				problem, err := fs.verifyFile(ctx, client, edges, file, user, full)
+				if err == nil {
+					var integrityError *string
+					if problem != "" {
+						integrityError = &problem
+					}
+					// files changed or moved to another channel meanwhile were
+					// checked against parts they no longer have
+					err = fs.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).
+						Where("revision = ?", file.Revision).Where("channel_id IS NOT DISTINCT FROM ?", file.ChannelID).
+						Updates(map[string]any{"verified_at": time.Now().UTC(), "integrity_error": integrityError}).Error
+				}
+
+				result.Checked++
+				switch {
+				case err != nil:
+					result.Failed++
+					problem = err.Error()
+				case problem != "":
+					result.Corrupted++
+					damaged = append(damaged, file.Name+": "+problem)
+				}
+				if (err != nil || problem != "") && len(result.Errors) < maxDeleteErrors {
+					result.Errors = append(result.Errors, file.Name+": "+problem)
+				}
+				run.Progress(int64(result.Checked), total)
+			}
+		}
+	})
+
+	if len(damaged) > 0 {
+		text := fmt.Sprintf("Verification found %d damaged files:", len(damaged))
+		for _, problem := range damaged[:min(len(damaged), maxDeleteErrors)] {
+			text += "\n" + problem
+		}
+		fs.notifier.Notify(userId, notifyIntegrityFailed, text)
+	}
+
+	return err
+}
+
+// verifyFile returns a description of the damage found on file, or an error
+// when the check itself could not be carried out.
+func (fs *FileService) verifyFile(ctx context.Context, client *telegram.Client, edges *edgeReader, file models.File,
+	user string, full bool) (string, error) {
+
+	if file.ChannelID == nil {
+		return "file has no channel", nil
+	}
+
+	src := mapper.ToFileOutFull(file)
+
+	messages, err := getTGMessages(ctx, client, src.Parts, src.ChannelID, user)
+	if err != nil {
+		return "", err
+	}
+	if len(messages) != len(src.Parts) {
+		return fmt.Sprintf("%d of %d parts found", len(messages), len(src.Parts)), nil
+	}
+
+	var size int64
+	for i, m := range messages {
+		msg, ok := m.(*tg.Message)
+		if !ok {
+			return fmt.Sprintf("part %d: message deleted", i+1), nil
+		}
+		media, ok := msg.Media.(*tg.MessageMediaDocument)
+		if !ok {
+			return fmt.Sprintf("part %d: message has no document", i+1), nil
+		}
+		document, ok := media.Document.(*tg.Document)
+		if !ok {
+			return fmt.Sprintf("part %d: document deleted", i+1), nil
+		}
+
+		partSize := document.Size
+		if file.Encrypted {
+			if partSize, err = crypt.DecryptedSize(document.Size); err != nil {
+				return fmt.Sprintf("part %d: %v", i+1, err), nil
+			}
+		}
+		size += partSize
+
+		problem, err := edges.verify(ctx, document)
+		if err != nil {
+			return "", err
+		}
+		if problem != "" {
+			return fmt.Sprintf("part %d: %s", i+1, problem), nil
+		}
+	}
+
+	if file.Size != nil && size != *file.Size {
+		return fmt.Sprintf("size mismatch: expected %d bytes, parts hold %d", *file.Size, size), nil
+	}
+
+	if full && file.Checksum != nil {
+		sum, err := fs.fileChecksum(ctx, client, file, user)
+		if err != nil {
+			return "", err
+		}
+		if sum != *file.Checksum {
+			return "checksum mismatch", nil
+		}
+	}
+
+	return "", nil
+}
+
+// edgeReader reads the first and last chunk of documents, which is enough to
+// tell that Telegram still serves all of them without downloading them.
+// Documents stored on another DC are read over connections kept for the run.
+type edgeReader struct {
+	client *telegram.Client
+	dcs    map[int]telegram.CloseInvoker
+}
+
+func (e *edgeReader) verify(ctx context.Context, document *tg.Document) (string, error) {
+	if document.Size == 0 {
+		return "", nil
+	}
+	location := document.AsInputDocumentFileLocation()
+	offsets := []int64{0}
+	if last := (document.Size - 1) / verifyChunkSize * verifyChunkSize; last > 0 {
+		offsets = append(offsets, last)
+	}
+	for _, offset := range offsets {
+		data, err := e.chunk(ctx, location, offset)
+		if rpcErr, ok := tgerr.As(err); ok && rpcErr.Code == http.StatusBadRequest {
+			return rpcErr.Message, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if want := min(verifyChunkSize, document.Size-offset); int64(len(data)) != want {
+			return fmt.Sprintf("read %d bytes at offset %d, expected %d", len(data), offset, want), nil
+		}
+	}
+	return "", nil
+}
+
+func (e *edgeReader) chunk(ctx context.Context, location *tg.InputDocumentFileLocation, offset int64) ([]byte, error) {
+	data, err := getChunk(ctx, e.client.API(), location, offset, verifyChunkSize)
+	rpcErr, ok := tgerr.AsType(err, "FILE_MIGRATE")
+	if !ok {
+		return data, err
+	}
+	pool, ok := e.dcs[rpcErr.Argument]
+	if !ok {
+		if pool, err = e.client.DC(ctx, rpcErr.Argument, 1); err != nil {
+			return nil, err
+		}
+		e.dcs[rpcErr.Argument] = pool
+	}
+	return getChunk(ctx, tg.NewClient(pool), location, offset, verifyChunkSize)
+}
+
+func (e *edgeReader) Close() {
+	for _, pool := range e.dcs {
+		pool.Close()
+	}
+}
@@ -26,6 +26,8 @@ type JWTClaims struct {
 	Bot       bool   `json:"bot"`
 	IsPremium bool   `json:"isPremium"`
 	Hash      string `json:"hash"`
+	// Identity is set on sessions started through single sign-on.
+	Identity string `json:"identity,omitempty"`
 }
 
 type SessionData struct {
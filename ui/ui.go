@@ -1,76 +1,95 @@
 package ui
 
 import (
+	"bytes"
 	"embed"
-	"fmt"
+	"html"
 	"io/fs"
 	"net/http"
+	"path"
 	"strings"
 
-	"github.com/gin-gonic/contrib/static"
+	"github.com/divyam234/teldrive/internal/middleware"
 	"github.com/gin-gonic/gin"
 )
 
 //go:embed all:dist
 var staticFS embed.FS
 
-func AddRoutes(router gin.IRouter) {
-	embeddedBuildFolder := newStaticFileSystem()
-	fallbackFileSystem := newFallbackFileSystem(embeddedBuildFolder)
-	router.Use(static.Serve("/", embeddedBuildFolder))
-	router.Use(static.Serve("/", fallbackFileSystem))
-}
-
-type staticFileSystem struct {
-	http.FileSystem
-}
-
-var _ static.ServeFileSystem = (*staticFileSystem)(nil)
-
-func newStaticFileSystem() *staticFileSystem {
-	sub, err := fs.Sub(staticFS, "dist")
+const (
+	// assets are emitted with content hashes in their names by the UI build
+	immutableCache = "public, max-age=31536000, immutable"
+	staticCache    = "public, max-age=3600"
+	// the entry point is always revalidated so a new UI is picked up at once
+	indexCache = "no-cache"
+)
 
+// AddRoutes serves the embedded UI for every GET or HEAD request no route
+// matched. Paths without a file extension fall back to index.html so the UI
+// router handles them, while unknown API paths and missing files stay 404.
+func AddRoutes(router *gin.Engine) {
+	dist, err := fs.Sub(staticFS, "dist")
 	if err != nil {
 		panic(err)
 	}
-
-	return &staticFileSystem{
-		FileSystem: http.FS(sub),
-	}
+	router.NoRoute(handler(dist))
 }
 
-func (s *staticFileSystem) Exists(prefix string, path string) bool {
-	buildpath := fmt.Sprintf("dist%s", path)
-
-	if strings.HasSuffix(path, "/") {
-		_, err := staticFS.ReadDir(strings.TrimSuffix(buildpath, "/"))
-		return err == nil
+func handler(dist fs.FS) gin.HandlerFunc {
+	files := http.FileServer(http.FS(dist))
+
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+
+		if (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) ||
+			p == "/api" || strings.HasPrefix(p, "/api/") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean(p), "/")
+
+		if name != "" && name != "index.html" {
+			if info, err := fs.Stat(dist, name); err == nil && !info.IsDir() {
+				if strings.HasPrefix(name, "assets/") {
+					c.Header("Cache-Control", immutableCache)
+				} else {
+					c.Header("Cache-Control", staticCache)
+				}
+				files.ServeHTTP(c.Writer, c.Request)
+				return
+			}
+			if path.Ext(name) != "" {
+				c.Status(http.StatusNotFound)
+				return
+			}
+		}
+
+		index, err := fs.ReadFile(dist, "index.html")
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Header("Cache-Control", indexCache)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", withBase(index, middleware.BasePath(c)))
 	}
-
-	f, err := staticFS.Open(buildpath)
-	if f != nil {
-		_ = f.Close()
-	}
-	return err == nil
-}
-
-type fallbackFileSystem struct {
-	staticFileSystem *staticFileSystem
 }
 
-var _ static.ServeFileSystem = (*fallbackFileSystem)(nil)
-var _ http.FileSystem = (*fallbackFileSystem)(nil)
-
-func newFallbackFileSystem(staticFileSystem *staticFileSystem) *fallbackFileSystem {
-	return &fallbackFileSystem{
-		staticFileSystem: staticFileSystem,
+// withBase points the relative URLs of the UI at the path prefix it is served
+// under.
+func withBase(index []byte, basePath string) []byte {
+	if basePath == "" {
+		return index
 	}
-}
-
-func (f *fallbackFileSystem) Open(path string) (http.File, error) {
-	return f.staticFileSystem.Open("/index.html")
-}
-
-func (f *fallbackFileSystem) Exists(prefix string, path string) bool {
-	return true
+	tag := []byte(`<base href="` + html.EscapeString(basePath) + `/">`)
+	head := []byte("<head>")
+	i := bytes.Index(index, head)
+	if i < 0 {
+		return append(tag, index...)
+	}
+	i += len(head)
+	out := make([]byte, 0, len(index)+len(tag))
+	out = append(out, index[:i]...)
+	out = append(out, tag...)
+	return append(out, index[i:]...)
 }
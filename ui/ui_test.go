@@ -0,0 +1,47 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.NoRoute(handler(fstest.MapFS{
+		"index.html":       {Data: []byte("<html></html>")},
+		"assets/app-1a.js": {Data: []byte("app")},
+		"favicon.ico":      {Data: []byte("icon")},
+	}))
+
+	tests := []struct {
+		method, path string
+		code         int
+		cache        string
+	}{
+		{http.MethodGet, "/", http.StatusOK, indexCache},
+		{http.MethodGet, "/index.html", http.StatusOK, indexCache},
+		{http.MethodGet, "/my-drive/photos", http.StatusOK, indexCache},
+		{http.MethodHead, "/my-drive", http.StatusOK, indexCache},
+		{http.MethodGet, "/assets/app-1a.js", http.StatusOK, immutableCache},
+		{http.MethodGet, "/favicon.ico", http.StatusOK, staticCache},
+		{http.MethodGet, "/assets/missing.js", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/unknown", http.StatusNotFound, ""},
+		{http.MethodPost, "/my-drive", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s: code %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+		if got := w.Header().Get("Cache-Control"); got != tt.cache {
+			t.Errorf("%s %s: Cache-Control %q, want %q", tt.method, tt.path, got, tt.cache)
+		}
+	}
+}